@@ -2,12 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/gob"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -161,15 +172,561 @@ func (s *UserService) Authenticate(email, password string) (*User, error) {
 	return user, nil
 }
 
+// --- Notifications & Audit ---
+
+type Notification struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// LogNotifier stands in for an email provider.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, n Notification) error {
+	log.Printf("NOTIFY to=%s subject=%q body=%q", n.To, n.Subject, n.Body)
+	return nil
+}
+
+type AuditEvent struct {
+	Type      string    `json:"type"`
+	Email     string    `json:"email"`
+	UserID    string    `json:"user_id,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+type AuditLog struct {
+	mu     sync.Mutex
+	events []AuditEvent
+	hooks  []func(AuditEvent)
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+// OnRecord registers fn to be called with every event once it is stored.
+func (a *AuditLog) OnRecord(fn func(AuditEvent)) {
+	a.mu.Lock()
+	a.hooks = append(a.hooks, fn)
+	a.mu.Unlock()
+}
+
+func (a *AuditLog) Record(e AuditEvent) {
+	e.At = time.Now().UTC()
+	a.mu.Lock()
+	a.events = append(a.events, e)
+	hooks := a.hooks
+	a.mu.Unlock()
+	log.Printf("AUDIT %s email=%s ip=%s detail=%q", e.Type, e.Email, e.IP, e.Detail)
+	for _, fn := range hooks {
+		fn(e)
+	}
+}
+
+// --- Login Analytics ---
+
+const (
+	loginBucketWidth  = time.Minute
+	loginRetention    = 24 * time.Hour
+	defaultLoginRange = time.Hour
+
+	// A region alerts when, over the last loginAlertWindow, at least
+	// loginAlertMinAttempts logins were tried and the failure ratio reached
+	// loginAlertSpikeFactor times the ratio of the hour before (and at least
+	// loginAlertMinRatio). Each region alerts at most once per cooldown.
+	loginAlertWindow      = 5 * time.Minute
+	loginBaselineWindow   = time.Hour
+	loginAlertMinAttempts = 20
+	loginAlertMinRatio    = 0.5
+	loginAlertSpikeFactor = 3.0
+	loginAlertCooldown    = 15 * time.Minute
+	maxLoginAlerts        = 100
+)
+
+// loginOutcomes maps the audit events that end a login attempt to whether
+// the attempt succeeded.
+var loginOutcomes = map[string]bool{
+	"login.succeeded":          true,
+	"login.failed":             false,
+	"magic_link.redeemed":      true,
+	"magic_link.redeem_failed": false,
+}
+
+// RegionResolver maps a client IP to a coarse region name. A GeoIP database
+// lookup would implement it in production.
+type RegionResolver interface {
+	Region(ip string) string
+}
+
+// defaultRegionTable assigns the documentation ranges to made-up regions so
+// the stub resolver gives distinct answers in development.
+var defaultRegionTable = map[string]string{
+	"192.0.2.0/24":    "us-east",
+	"198.51.100.0/24": "eu-west",
+	"203.0.113.0/24":  "ap-south",
+}
+
+type regionPrefix struct {
+	prefix netip.Prefix
+	region string
+}
+
+// StaticRegionResolver is the stub resolver: a fixed CIDR table, most
+// specific prefix first. Private and loopback addresses are "private";
+// anything else unmatched is "unknown".
+type StaticRegionResolver struct {
+	prefixes []regionPrefix
+}
+
+func NewStaticRegionResolver(table map[string]string) (*StaticRegionResolver, error) {
+	r := &StaticRegionResolver{}
+	for cidr, region := range table {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("region table: %w", err)
+		}
+		r.prefixes = append(r.prefixes, regionPrefix{prefix: prefix.Masked(), region: region})
+	}
+	sort.Slice(r.prefixes, func(i, j int) bool { return r.prefixes[i].prefix.Bits() > r.prefixes[j].prefix.Bits() })
+	return r, nil
+}
+
+func (r *StaticRegionResolver) Region(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "unknown"
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() {
+		return "private"
+	}
+	for _, p := range r.prefixes {
+		if p.prefix.Contains(addr) {
+			return p.region
+		}
+	}
+	return "unknown"
+}
+
+type LoginCounts struct {
+	Successes int `json:"successes"`
+	Failures  int `json:"failures"`
+}
+
+func (c LoginCounts) FailureRatio() float64 {
+	if total := c.Successes + c.Failures; total > 0 {
+		return float64(c.Failures) / float64(total)
+	}
+	return 0
+}
+
+type LoginBucket struct {
+	Minute time.Time `json:"minute"`
+	LoginCounts
+}
+
+type RegionLoginStats struct {
+	Region       string        `json:"region"`
+	Successes    int           `json:"successes"`
+	Failures     int           `json:"failures"`
+	FailureRatio float64       `json:"failure_ratio"`
+	Buckets      []LoginBucket `json:"buckets"`
+}
+
+type LoginAlert struct {
+	Region        string    `json:"region"`
+	At            time.Time `json:"at"`
+	Attempts      int       `json:"attempts"`
+	Failures      int       `json:"failures"`
+	FailureRatio  float64   `json:"failure_ratio"`
+	BaselineRatio float64   `json:"baseline_ratio"`
+}
+
+// LoginAnalytics counts login outcomes per region in one-minute buckets kept
+// for loginRetention, and raises an alert when a region's failure ratio
+// jumps well above its recent baseline.
+type LoginAnalytics struct {
+	resolver RegionResolver
+	notifier Notifier
+	alertTo  string
+
+	mu        sync.Mutex
+	buckets   map[string]map[int64]*LoginCounts // region -> bucket start (unix) -> counts
+	lastAlert map[string]time.Time
+	alerts    []LoginAlert
+}
+
+func NewLoginAnalytics(resolver RegionResolver, notifier Notifier, alertTo string) *LoginAnalytics {
+	return &LoginAnalytics{
+		resolver:  resolver,
+		notifier:  notifier,
+		alertTo:   alertTo,
+		buckets:   make(map[string]map[int64]*LoginCounts),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// Observe is an AuditLog hook; events other than login outcomes are ignored.
+func (a *LoginAnalytics) Observe(e AuditEvent) {
+	success, ok := loginOutcomes[e.Type]
+	if !ok {
+		return
+	}
+	a.record(a.resolver.Region(e.IP), success, e.At)
+}
+
+func bucketOf(t time.Time) int64 {
+	return t.Truncate(loginBucketWidth).Unix()
+}
+
+func (a *LoginAnalytics) record(region string, success bool, at time.Time) {
+	a.mu.Lock()
+	if a.buckets[region] == nil {
+		a.buckets[region] = make(map[int64]*LoginCounts)
+	}
+	counts := a.buckets[region][bucketOf(at)]
+	if counts == nil {
+		counts = &LoginCounts{}
+		a.buckets[region][bucketOf(at)] = counts
+	}
+	if success {
+		counts.Successes++
+	} else {
+		counts.Failures++
+	}
+	a.prune(at)
+	var alert *LoginAlert
+	if !success {
+		alert = a.checkSpike(region, at)
+	}
+	a.mu.Unlock()
+
+	if alert != nil {
+		go a.notify(*alert)
+	}
+}
+
+// prune drops buckets older than loginRetention. Callers must hold a.mu.
+func (a *LoginAnalytics) prune(now time.Time) {
+	oldest := bucketOf(now.Add(-loginRetention))
+	for region, buckets := range a.buckets {
+		for start := range buckets {
+			if start < oldest {
+				delete(buckets, start)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(a.buckets, region)
+		}
+	}
+}
+
+// sum totals region's buckets starting in [from, to). Callers must hold a.mu.
+func (a *LoginAnalytics) sum(region string, from, to int64) LoginCounts {
+	var total LoginCounts
+	for start, c := range a.buckets[region] {
+		if start >= from && start < to {
+			total.Successes += c.Successes
+			total.Failures += c.Failures
+		}
+	}
+	return total
+}
+
+// checkSpike compares the last loginAlertWindow of buckets, the current one
+// included, with the loginBaselineWindow before them. Callers must hold a.mu.
+func (a *LoginAnalytics) checkSpike(region string, now time.Time) *LoginAlert {
+	if now.Sub(a.lastAlert[region]) < loginAlertCooldown {
+		return nil
+	}
+	end := bucketOf(now) + int64(loginBucketWidth.Seconds())
+	windowStart := end - int64(loginAlertWindow.Seconds())
+	recent := a.sum(region, windowStart, end)
+	if recent.Successes+recent.Failures < loginAlertMinAttempts {
+		return nil
+	}
+	baseline := a.sum(region, windowStart-int64(loginBaselineWindow.Seconds()), windowStart)
+	threshold := math.Max(loginAlertMinRatio, baseline.FailureRatio()*loginAlertSpikeFactor)
+	if recent.FailureRatio() < threshold {
+		return nil
+	}
+
+	alert := LoginAlert{
+		Region:        region,
+		At:            now,
+		Attempts:      recent.Successes + recent.Failures,
+		Failures:      recent.Failures,
+		FailureRatio:  recent.FailureRatio(),
+		BaselineRatio: baseline.FailureRatio(),
+	}
+	a.lastAlert[region] = now
+	a.alerts = append(a.alerts, alert)
+	if len(a.alerts) > maxLoginAlerts {
+		a.alerts = a.alerts[len(a.alerts)-maxLoginAlerts:]
+	}
+	return &alert
+}
+
+func (a *LoginAnalytics) notify(alert LoginAlert) {
+	log.Printf("ALERT login failure spike region=%s failures=%d/%d ratio=%.2f baseline=%.2f",
+		alert.Region, alert.Failures, alert.Attempts, alert.FailureRatio, alert.BaselineRatio)
+	err := a.notifier.Send(context.Background(), Notification{
+		To:      a.alertTo,
+		Subject: "Login failure spike in " + alert.Region,
+		Body: fmt.Sprintf("%d of %d logins from %s failed in the last %d minutes (%.0f%%, against %.0f%% in the hour before).",
+			alert.Failures, alert.Attempts, alert.Region, int(loginAlertWindow.Minutes()), alert.FailureRatio*100, alert.BaselineRatio*100),
+	})
+	if err != nil {
+		log.Printf("login alert: %v", err)
+	}
+}
+
+// Query returns per-region totals and non-empty buckets starting in
+// [from, to), sorted by region. An empty region means all regions.
+func (a *LoginAnalytics) Query(from, to time.Time, region string) []RegionLoginStats {
+	lo, hi := bucketOf(from), to.Unix()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := []RegionLoginStats{}
+	for name, buckets := range a.buckets {
+		if region != "" && name != region {
+			continue
+		}
+		stats := RegionLoginStats{Region: name, Buckets: []LoginBucket{}}
+		for start, c := range buckets {
+			if start < lo || start >= hi {
+				continue
+			}
+			stats.Successes += c.Successes
+			stats.Failures += c.Failures
+			stats.Buckets = append(stats.Buckets, LoginBucket{Minute: time.Unix(start, 0).UTC(), LoginCounts: *c})
+		}
+		if len(stats.Buckets) == 0 {
+			continue
+		}
+		stats.FailureRatio = LoginCounts{Successes: stats.Successes, Failures: stats.Failures}.FailureRatio()
+		sort.Slice(stats.Buckets, func(i, j int) bool { return stats.Buckets[i].Minute.Before(stats.Buckets[j].Minute) })
+		out = append(out, stats)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Region < out[j].Region })
+	return out
+}
+
+// Alerts returns the alerts raised in [from, to), oldest first.
+func (a *LoginAnalytics) Alerts(from, to time.Time) []LoginAlert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := []LoginAlert{}
+	for _, alert := range a.alerts {
+		if !alert.At.Before(from) && alert.At.Before(to) {
+			out = append(out, alert)
+		}
+	}
+	return out
+}
+
+// --- Magic Link Service ---
+
+const (
+	magicLinkTTL        = 15 * time.Minute
+	magicLinkRateWindow = 15 * time.Minute
+	magicLinkRateLimit  = 3 // links per email per window
+)
+
+var (
+	ErrMagicLinkInvalid        = errors.New("magic link is invalid")
+	ErrMagicLinkExpired        = errors.New("magic link has expired")
+	ErrMagicLinkUsed           = errors.New("magic link was already used")
+	ErrMagicLinkDeviceMismatch = errors.New("magic link was opened on a different device")
+	ErrMagicLinkRateLimited    = errors.New("too many magic links requested")
+)
+
+type magicLink struct {
+	email     string
+	uaHash    string
+	expiresAt time.Time
+	used      bool
+}
+
+// MagicLinkService issues single-use login links. A token is "<id>.<mac>":
+// the MAC lets forged tokens be rejected without a lookup, and the server-side
+// record keyed by id makes each token redeemable exactly once.
+type MagicLinkService struct {
+	secret   []byte
+	baseURL  string
+	storage  *UserStorage
+	notifier Notifier
+	audit    *AuditLog
+
+	mu       sync.Mutex
+	links    map[string]*magicLink
+	requests map[string][]time.Time // per-email issuance times for rate limiting
+}
+
+func NewMagicLinkService(secret, baseURL string, storage *UserStorage, notifier Notifier, audit *AuditLog) *MagicLinkService {
+	return &MagicLinkService{
+		secret:   []byte(secret),
+		baseURL:  baseURL,
+		storage:  storage,
+		notifier: notifier,
+		audit:    audit,
+		links:    make(map[string]*magicLink),
+		requests: make(map[string][]time.Time),
+	}
+}
+
+func hashUserAgent(ua string) string {
+	sum := sha256.Sum256([]byte(ua))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *MagicLinkService) sign(id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("magic-link:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// allow records a request for email and reports whether it is within the limit.
+// Callers must hold s.mu.
+func (s *MagicLinkService) allow(email string, now time.Time) bool {
+	recent := s.requests[email][:0]
+	for _, t := range s.requests[email] {
+		if now.Sub(t) < magicLinkRateWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= magicLinkRateLimit {
+		s.requests[email] = recent
+		return false
+	}
+	s.requests[email] = append(recent, now)
+	return true
+}
+
+// prune drops expired links. Callers must hold s.mu.
+func (s *MagicLinkService) prune(now time.Time) {
+	for id, l := range s.links {
+		if now.After(l.expiresAt) {
+			delete(s.links, id)
+		}
+	}
+}
+
+// Issue sends a login link to email. Unknown or inactive accounts get no link
+// but the same nil result, so the endpoint cannot be used to probe emails.
+func (s *MagicLinkService) Issue(ctx context.Context, email, userAgent, ip string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+
+	s.mu.Lock()
+	s.prune(now)
+	if !s.allow(email, now) {
+		s.mu.Unlock()
+		s.audit.Record(AuditEvent{Type: "magic_link.rate_limited", Email: email, IP: ip, UserAgent: userAgent})
+		return ErrMagicLinkRateLimited
+	}
+	s.mu.Unlock()
+
+	user, err := s.storage.FindByEmail(email)
+	if err != nil || !user.IsActive {
+		s.audit.Record(AuditEvent{Type: "magic_link.issue_skipped", Email: email, IP: ip, UserAgent: userAgent, Detail: "unknown or inactive account"})
+		return nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	token := id + "." + s.sign(id)
+
+	s.mu.Lock()
+	s.links[id] = &magicLink{email: email, uaHash: hashUserAgent(userAgent), expiresAt: now.Add(magicLinkTTL)}
+	s.mu.Unlock()
+
+	link := s.baseURL + "?token=" + url.QueryEscape(token)
+	err = s.notifier.Send(ctx, Notification{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body:    fmt.Sprintf("Sign in within %d minutes using this link (it works once, on the device that requested it): %s", int(magicLinkTTL.Minutes()), link),
+	})
+	if err != nil {
+		s.mu.Lock()
+		delete(s.links, id)
+		s.mu.Unlock()
+		return fmt.Errorf("sending magic link: %w", err)
+	}
+	s.audit.Record(AuditEvent{Type: "magic_link.issued", Email: email, UserID: user.ID.String(), IP: ip, UserAgent: userAgent})
+	return nil
+}
+
+// Redeem consumes a token and returns its user. Any presented token that
+// passed the signature check is burned, even when redemption fails, so a leaked
+// link cannot be retried from another device.
+func (s *MagicLinkService) Redeem(token, userAgent, ip string) (*User, error) {
+	user, email, err := s.redeem(token, userAgent)
+	event := AuditEvent{Type: "magic_link.redeemed", Email: email, IP: ip, UserAgent: userAgent}
+	if err != nil {
+		event.Type = "magic_link.redeem_failed"
+		event.Detail = err.Error()
+	} else {
+		event.UserID = user.ID.String()
+	}
+	s.audit.Record(event)
+	return user, err
+}
+
+func (s *MagicLinkService) redeem(token, userAgent string) (*User, string, error) {
+	id, mac, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(s.sign(id))) {
+		return nil, "", ErrMagicLinkInvalid
+	}
+
+	s.mu.Lock()
+	link, ok := s.links[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, "", ErrMagicLinkInvalid
+	}
+	wasUsed := link.used
+	link.used = true
+	s.mu.Unlock()
+
+	switch {
+	case wasUsed:
+		return nil, link.email, ErrMagicLinkUsed
+	case time.Now().After(link.expiresAt):
+		return nil, link.email, ErrMagicLinkExpired
+	case !hmac.Equal([]byte(link.uaHash), []byte(hashUserAgent(userAgent))):
+		return nil, link.email, ErrMagicLinkDeviceMismatch
+	}
+
+	user, err := s.storage.FindByEmail(link.email)
+	if err != nil || !user.IsActive {
+		return nil, link.email, ErrMagicLinkInvalid
+	}
+	return user, link.email, nil
+}
+
 // --- Handler/Controller Layer ---
 
 type AuthHandler struct {
 	userService *UserService
 	authService *AuthService
+	magicLinks  *MagicLinkService
+	audit       *AuditLog
 }
 
-func NewAuthHandler(us *UserService, as *AuthService) *AuthHandler {
-	return &AuthHandler{userService: us, authService: as}
+func NewAuthHandler(us *UserService, as *AuthService, ml *MagicLinkService, audit *AuditLog) *AuthHandler {
+	return &AuthHandler{userService: us, authService: as, magicLinks: ml, audit: audit}
 }
 
 func (h *AuthHandler) Login(c echo.Context) error {
@@ -182,9 +739,14 @@ func (h *AuthHandler) Login(c echo.Context) error {
 	}
 
 	user, err := h.userService.Authenticate(req.Email, req.Password)
+	event := AuditEvent{Type: "login.succeeded", Email: req.Email, IP: c.RealIP(), UserAgent: c.Request().UserAgent()}
 	if err != nil {
+		event.Type, event.Detail = "login.failed", err.Error()
+		h.audit.Record(event)
 		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
 	}
+	event.UserID = user.ID.String()
+	h.audit.Record(event)
 
 	token, err := h.authService.GenerateJWT(user)
 	if err != nil {
@@ -194,6 +756,44 @@ func (h *AuthHandler) Login(c echo.Context) error {
 	return c.JSON(http.StatusOK, echo.Map{"token": token})
 }
 
+func (h *AuthHandler) RequestMagicLink(c echo.Context) error {
+	req := new(struct {
+		Email string `json:"email"`
+	})
+	if err := c.Bind(req); err != nil || req.Email == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid input")
+	}
+
+	err := h.magicLinks.Issue(c.Request().Context(), req.Email, c.Request().UserAgent(), c.RealIP())
+	if errors.Is(err, ErrMagicLinkRateLimited) {
+		c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", int(magicLinkRateWindow.Seconds())))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Too many sign-in links requested, try again later")
+	}
+	if err != nil {
+		log.Printf("magic link: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not send sign-in link")
+	}
+	return c.JSON(http.StatusAccepted, echo.Map{"message": "If the account exists, a sign-in link has been sent."})
+}
+
+func (h *AuthHandler) RedeemMagicLink(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing token")
+	}
+	user, err := h.magicLinks.Redeem(token, c.Request().UserAgent(), c.RealIP())
+	if err != nil {
+		// The precise reason is audited but not revealed.
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired sign-in link")
+	}
+
+	jwtToken, err := h.authService.GenerateJWT(user)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Could not generate token")
+	}
+	return c.JSON(http.StatusOK, echo.Map{"token": jwtToken})
+}
+
 func (h *AuthHandler) GoogleLogin(c echo.Context) error {
 	state := uuid.New().String()
 	sess, _ := session.Get("session", c)
@@ -255,6 +855,47 @@ func (h *PostHandler) CreatePost(c echo.Context) error {
 	})
 }
 
+type AnalyticsHandler struct {
+	logins *LoginAnalytics
+}
+
+func NewAnalyticsHandler(logins *LoginAnalytics) *AnalyticsHandler {
+	return &AnalyticsHandler{logins: logins}
+}
+
+// LoginStats serves GET /api/admin/analytics/logins?from=&to=&region=. from
+// and to are RFC 3339 and default to the last hour; the range may reach back
+// at most loginRetention.
+func (h *AnalyticsHandler) LoginStats(c echo.Context) error {
+	now := time.Now().UTC()
+	to, from := now, now.Add(-defaultLoginRange)
+	var err error
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "to must be an RFC 3339 time")
+		}
+		from = to.Add(-defaultLoginRange)
+	}
+	if v := c.QueryParam("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "from must be an RFC 3339 time")
+		}
+	}
+	if !from.Before(to) {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	if from.Before(now.Add(-loginRetention)) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("from may be at most %s ago", loginRetention))
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"from":           from,
+		"to":             to,
+		"bucket_seconds": int(loginBucketWidth.Seconds()),
+		"regions":        h.logins.Query(from, to, c.QueryParam("region")),
+		"alerts":         h.logins.Alerts(from, to),
+	})
+}
+
 // --- Middleware ---
 
 type MiddlewareManager struct {
@@ -307,7 +948,20 @@ func main() {
 	userStorage := NewUserStorage()
 	userService := NewUserService(userStorage)
 	authService := NewAuthService(jwtSecret)
-	authHandler := NewAuthHandler(userService, authService)
+	auditLog := NewAuditLog()
+	regions, err := NewStaticRegionResolver(defaultRegionTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	alertTo := os.Getenv("SECURITY_ALERT_EMAIL")
+	if alertTo == "" {
+		alertTo = "security@example.com"
+	}
+	loginAnalytics := NewLoginAnalytics(regions, LogNotifier{}, alertTo)
+	auditLog.OnRecord(loginAnalytics.Observe)
+	magicLinkService := NewMagicLinkService(jwtSecret, "http://localhost:1323/auth/magic", userStorage, LogNotifier{}, auditLog)
+	authHandler := NewAuthHandler(userService, authService, magicLinkService, auditLog)
+	analyticsHandler := NewAnalyticsHandler(loginAnalytics)
 	postHandler := NewPostHandler()
 	middlewareManager := NewMiddlewareManager(jwtSecret)
 
@@ -315,6 +969,8 @@ func main() {
 	e.POST("/login", authHandler.Login)
 	e.GET("/auth/google/login", authHandler.GoogleLogin)
 	e.GET("/auth/google/callback", authHandler.GoogleCallback)
+	e.POST("/auth/magic-link", authHandler.RequestMagicLink)
+	e.GET("/auth/magic", authHandler.RedeemMagicLink)
 
 	// Authenticated Routes
 	api := e.Group("/api")
@@ -327,6 +983,7 @@ func main() {
 	admin := api.Group("/admin")
 	admin.Use(middlewareManager.RoleCheck(ADMIN))
 	admin.GET("/dashboard", postHandler.GetAdminDashboard)
+	admin.GET("/analytics/logins", analyticsHandler.LoginStats)
 
 	log.Println("Starting server on :1323")
 	e.Logger.Fatal(e.Start(":1323"))
@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,14 +43,134 @@ type User struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+type Visibility string
+const (
+	VisibilityPublic    Visibility = "public"
+	VisibilityUnlisted  Visibility = "unlisted"  // reachable by id, never listed
+	VisibilityFollowers Visibility = "followers" // author's followers only
+	VisibilityPrivate   Visibility = "private"   // author only
+)
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityFollowers, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+const (
+	StatusDraft     = "DRAFT"
+	StatusPublished = "PUBLISHED"
+)
+
+// Post.UserID is the primary author. Authors is filled in on every read from
+// the co-author table, primary author first, and is never stored.
 type Post struct {
-	ID      uuid.UUID `json:"id"`
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Title      string       `json:"title"`
+	Content    string       `json:"content"`
+	Status     string       `json:"status"`
+	Visibility Visibility   `json:"visibility"`
+	CreatedAt  time.Time    `json:"created_at"`
+	Authors    []PostAuthor `json:"authors"`
+}
+
+type PostAuthor struct {
 	UserID  uuid.UUID `json:"user_id"`
-	Title   string    `json:"title"`
-	Content string    `json:"content"`
-	Status  string    `json:"status"`
+	Primary bool      `json:"primary"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationDeclined InvitationStatus = "declined"
+)
+
+// CoauthorInvitation asks InviteeID to become a co-author of PostID. The
+// post title is copied at invite time so the invitee can see what they are
+// being asked to join before they can read the post itself.
+type CoauthorInvitation struct {
+	ID          uuid.UUID        `json:"id"`
+	PostID      uuid.UUID        `json:"post_id"`
+	PostTitle   string           `json:"post_title"`
+	InviterID   uuid.UUID        `json:"inviter_id"`
+	InviteeID   uuid.UUID        `json:"invitee_id"`
+	Status      InvitationStatus `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	RespondedAt *time.Time       `json:"responded_at,omitempty"`
+}
+
+const (
+	NotificationCoauthorInvited  = "coauthor.invited"
+	NotificationCoauthorAnswered = "coauthor.answered"
+)
+
+// Notification is one entry in a user's in-app inbox. Payload carries the ids
+// and titles a client needs to render and link it; ReadAt is nil while unread.
+type Notification struct {
+	ID        uuid.UUID         `json:"id"`
+	UserID    uuid.UUID         `json:"user_id"`
+	Type      string            `json:"type"`
+	Payload   map[string]string `json:"payload"`
+	CreatedAt time.Time         `json:"created_at"`
+	ReadAt    *time.Time        `json:"read_at,omitempty"`
 }
 
+// NotificationCursor is the position of the last notification on a page.
+// Inbox order is newest first, ties broken by id, so the next page starts
+// right after this (CreatedAt, ID) pair.
+type NotificationCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// follows reports whether n comes after the cursor in inbox order.
+func (cur NotificationCursor) follows(n *Notification) bool {
+	if !n.CreatedAt.Equal(cur.CreatedAt) {
+		return n.CreatedAt.Before(cur.CreatedAt)
+	}
+	return n.ID.String() > cur.ID.String()
+}
+
+func (cur NotificationCursor) Encode() string {
+	raw := strconv.FormatInt(cur.CreatedAt.UnixNano(), 10) + "." + cur.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeNotificationCursor(cursor string) (NotificationCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return NotificationCursor{}, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return NotificationCursor{}, errors.New("malformed notification cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return NotificationCursor{}, err
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return NotificationCursor{}, err
+	}
+	return NotificationCursor{CreatedAt: time.Unix(0, n), ID: uid}, nil
+}
+
+// Viewer is who is asking, taken from verified JWT claims. The zero value is
+// an anonymous viewer.
+type Viewer struct {
+	UserID uuid.UUID
+	Role   Role
+}
+
+func (v Viewer) Anonymous() bool { return v.UserID == uuid.Nil }
+
 type JWTClaims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
@@ -56,8 +180,11 @@ type JWTClaims struct {
 
 // --- Repository Layer (Interfaces & Implementations) ---
 
+var ErrUserNotFound = errors.New("repository: user not found")
+
 type IUserRepository interface {
 	FindByEmail(email string) (*User, error)
+	FindByID(id uuid.UUID) (*User, error)
 	Save(user *User) error
 }
 
@@ -80,11 +207,22 @@ func (r *InMemoryUserRepository) FindByEmail(email string) (*User, error) {
 	defer r.mu.RUnlock()
 	user, ok := r.users[email]
 	if !ok {
-		return nil, errors.New("repository: user not found")
+		return nil, ErrUserNotFound
 	}
 	return user, nil
 }
 
+func (r *InMemoryUserRepository) FindByID(id uuid.UUID) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
 func (r *InMemoryUserRepository) Save(user *User) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -92,6 +230,473 @@ func (r *InMemoryUserRepository) Save(user *User) error {
 	return nil
 }
 
+type IFollowRepository interface {
+	Follow(followerID, followeeID uuid.UUID) error
+	Unfollow(followerID, followeeID uuid.UUID) error
+	IsFollowing(followerID, followeeID uuid.UUID) bool
+}
+
+// InMemoryFollowRepository stores the follower relationship as
+// follower -> set of followees.
+type InMemoryFollowRepository struct {
+	mu      sync.RWMutex
+	follows map[uuid.UUID]map[uuid.UUID]time.Time
+}
+
+func NewInMemoryFollowRepository() IFollowRepository {
+	return &InMemoryFollowRepository{follows: make(map[uuid.UUID]map[uuid.UUID]time.Time)}
+}
+
+func (r *InMemoryFollowRepository) Follow(followerID, followeeID uuid.UUID) error {
+	if followerID == followeeID {
+		return errors.New("repository: cannot follow yourself")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.follows[followerID] == nil {
+		r.follows[followerID] = make(map[uuid.UUID]time.Time)
+	}
+	if _, ok := r.follows[followerID][followeeID]; !ok {
+		r.follows[followerID][followeeID] = time.Now()
+	}
+	return nil
+}
+
+func (r *InMemoryFollowRepository) Unfollow(followerID, followeeID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.follows[followerID], followeeID)
+	return nil
+}
+
+func (r *InMemoryFollowRepository) IsFollowing(followerID, followeeID uuid.UUID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.follows[followerID][followeeID]
+	return ok
+}
+
+var (
+	ErrInvitationNotFound = errors.New("repository: invitation not found")
+	ErrInvitationPending  = errors.New("repository: an invitation to this user is already pending")
+	ErrInvitationClosed   = errors.New("repository: invitation has already been answered")
+)
+
+type ICoauthorRepository interface {
+	CreateInvitation(inv *CoauthorInvitation) error
+	ListInvitations(inviteeID uuid.UUID, status InvitationStatus) ([]*CoauthorInvitation, error)
+	Respond(id, inviteeID uuid.UUID, accept bool) (*CoauthorInvitation, error)
+	CoAuthors(postID uuid.UUID) []PostAuthor
+	IsCoAuthor(postID, userID uuid.UUID) bool
+}
+
+// InMemoryCoauthorRepository holds the invitations table and the accepted
+// co-authors as post -> user -> time added.
+type InMemoryCoauthorRepository struct {
+	mu          sync.RWMutex
+	invitations map[uuid.UUID]*CoauthorInvitation
+	coauthors   map[uuid.UUID]map[uuid.UUID]time.Time
+}
+
+func NewInMemoryCoauthorRepository() ICoauthorRepository {
+	return &InMemoryCoauthorRepository{
+		invitations: make(map[uuid.UUID]*CoauthorInvitation),
+		coauthors:   make(map[uuid.UUID]map[uuid.UUID]time.Time),
+	}
+}
+
+// CreateInvitation refuses a second pending invitation for the same post and
+// invitee; an answered one may be followed by a new one.
+func (r *InMemoryCoauthorRepository) CreateInvitation(inv *CoauthorInvitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.invitations {
+		if existing.PostID == inv.PostID && existing.InviteeID == inv.InviteeID && existing.Status == InvitationPending {
+			return ErrInvitationPending
+		}
+	}
+	cp := *inv
+	r.invitations[inv.ID] = &cp
+	return nil
+}
+
+func (r *InMemoryCoauthorRepository) ListInvitations(inviteeID uuid.UUID, status InvitationStatus) ([]*CoauthorInvitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []*CoauthorInvitation{}
+	for _, inv := range r.invitations {
+		if inv.InviteeID == inviteeID && (status == "" || inv.Status == status) {
+			cp := *inv
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Respond answers a pending invitation and, on acceptance, adds the co-author
+// in the same step. Invitations addressed to someone else are reported as not
+// found.
+func (r *InMemoryCoauthorRepository) Respond(id, inviteeID uuid.UUID, accept bool) (*CoauthorInvitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inv, ok := r.invitations[id]
+	if !ok || inv.InviteeID != inviteeID {
+		return nil, ErrInvitationNotFound
+	}
+	if inv.Status != InvitationPending {
+		return nil, ErrInvitationClosed
+	}
+	now := time.Now()
+	inv.RespondedAt = &now
+	inv.Status = InvitationDeclined
+	if accept {
+		inv.Status = InvitationAccepted
+		if r.coauthors[inv.PostID] == nil {
+			r.coauthors[inv.PostID] = make(map[uuid.UUID]time.Time)
+		}
+		r.coauthors[inv.PostID][inviteeID] = now
+	}
+	cp := *inv
+	return &cp, nil
+}
+
+// CoAuthors lists a post's co-authors in the order they joined.
+func (r *InMemoryCoauthorRepository) CoAuthors(postID uuid.UUID) []PostAuthor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]PostAuthor, 0, len(r.coauthors[postID]))
+	for userID, added := range r.coauthors[postID] {
+		out = append(out, PostAuthor{UserID: userID, AddedAt: added})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AddedAt.Before(out[j].AddedAt) })
+	return out
+}
+
+func (r *InMemoryCoauthorRepository) IsCoAuthor(postID, userID uuid.UUID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.coauthors[postID][userID]
+	return ok
+}
+
+var ErrNotificationNotFound = errors.New("repository: notification not found")
+
+type INotificationRepository interface {
+	Create(n *Notification) error
+	List(userID uuid.UUID, unreadOnly bool, after *NotificationCursor, limit int) ([]*Notification, error)
+	UnreadCount(userID uuid.UUID) int
+	MarkRead(userID uuid.UUID, ids []uuid.UUID, at time.Time) ([]*Notification, error)
+	MarkAllRead(userID uuid.UUID, at time.Time) int
+	PruneRead(before time.Time) int
+}
+
+// InMemoryNotificationRepository is the notifications table, keyed by id.
+type InMemoryNotificationRepository struct {
+	mu            sync.RWMutex
+	notifications map[uuid.UUID]*Notification
+}
+
+func NewInMemoryNotificationRepository() INotificationRepository {
+	return &InMemoryNotificationRepository{notifications: make(map[uuid.UUID]*Notification)}
+}
+
+func (r *InMemoryNotificationRepository) Create(n *Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *n
+	r.notifications[n.ID] = &cp
+	return nil
+}
+
+// List returns up to limit of the user's notifications in inbox order,
+// starting after the cursor when one is given.
+func (r *InMemoryNotificationRepository) List(userID uuid.UUID, unreadOnly bool, after *NotificationCursor, limit int) ([]*Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []*Notification{}
+	for _, n := range r.notifications {
+		if n.UserID == userID && (!unreadOnly || n.ReadAt == nil) && (after == nil || after.follows(n)) {
+			cp := *n
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID.String() < out[j].ID.String()
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (r *InMemoryNotificationRepository) UnreadCount(userID uuid.UUID) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, n := range r.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// MarkRead marks the given notifications read. Ones already read keep their
+// original ReadAt. Any id that is not one of the user's notifications fails
+// the whole call before anything is changed.
+func (r *InMemoryNotificationRepository) MarkRead(userID uuid.UUID, ids []uuid.UUID, at time.Time) ([]*Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if n, ok := r.notifications[id]; !ok || n.UserID != userID {
+			return nil, ErrNotificationNotFound
+		}
+	}
+	out := make([]*Notification, 0, len(ids))
+	for _, id := range ids {
+		n := r.notifications[id]
+		if n.ReadAt == nil {
+			readAt := at
+			n.ReadAt = &readAt
+		}
+		cp := *n
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+// MarkAllRead marks every unread notification of the user read and reports
+// how many there were.
+func (r *InMemoryNotificationRepository) MarkAllRead(userID uuid.UUID, at time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	marked := 0
+	for _, n := range r.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			readAt := at
+			n.ReadAt = &readAt
+			marked++
+		}
+	}
+	return marked
+}
+
+// PruneRead deletes notifications read before the cutoff. Unread ones stay
+// however old they are.
+func (r *InMemoryNotificationRepository) PruneRead(before time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pruned := 0
+	for id, n := range r.notifications {
+		if n.ReadAt != nil && n.ReadAt.Before(before) {
+			delete(r.notifications, id)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+var ErrPostNotFound = errors.New("repository: post not found")
+
+type PostListFilter struct {
+	AuthorID uuid.UUID // uuid.Nil for all authors; matches co-authors too
+}
+
+// IPostRepository enforces visibility on every read: callers pass the
+// viewer and only ever get back posts that viewer may see.
+type IPostRepository interface {
+	Save(post *Post) error
+	FindByID(viewer Viewer, id uuid.UUID) (*Post, error)
+	List(viewer Viewer, filter PostListFilter) ([]*Post, error)
+}
+
+type InMemoryPostRepository struct {
+	mu        sync.RWMutex
+	posts     map[uuid.UUID]*Post
+	follows   IFollowRepository
+	coauthors ICoauthorRepository
+}
+
+func NewInMemoryPostRepository(follows IFollowRepository, coauthors ICoauthorRepository) IPostRepository {
+	return &InMemoryPostRepository{posts: make(map[uuid.UUID]*Post), follows: follows, coauthors: coauthors}
+}
+
+func (r *InMemoryPostRepository) Save(post *Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cp := *post
+	cp.Authors = nil
+	r.posts[post.ID] = &cp
+	return nil
+}
+
+// isAuthor reports whether userID is the primary author or a co-author.
+func (r *InMemoryPostRepository) isAuthor(p *Post, userID uuid.UUID) bool {
+	return p.UserID == userID || r.coauthors.IsCoAuthor(p.ID, userID)
+}
+
+// withAuthors returns a copy of p carrying its author list.
+func (r *InMemoryPostRepository) withAuthors(p *Post) *Post {
+	cp := *p
+	cp.Authors = append([]PostAuthor{{UserID: p.UserID, Primary: true, AddedAt: p.CreatedAt}}, r.coauthors.CoAuthors(p.ID)...)
+	return &cp
+}
+
+// visibleTo is the visibility predicate. Admins and authors, co-authors
+// included, see everything of theirs (admins: everyone's); others see
+// published posts that are public, unlisted (direct access only, never in
+// listings) or followers-only when they follow the primary author.
+func (r *InMemoryPostRepository) visibleTo(viewer Viewer, listing bool) func(*Post) bool {
+	return func(p *Post) bool {
+		if viewer.Role == ADMIN || (!viewer.Anonymous() && r.isAuthor(p, viewer.UserID)) {
+			return true
+		}
+		if p.Status != StatusPublished {
+			return false
+		}
+		switch p.Visibility {
+		case VisibilityPublic:
+			return true
+		case VisibilityUnlisted:
+			return !listing
+		case VisibilityFollowers:
+			return !viewer.Anonymous() && r.follows.IsFollowing(viewer.UserID, p.UserID)
+		default:
+			return false
+		}
+	}
+}
+
+// FindByID reports ErrPostNotFound for posts the viewer may not see, so
+// their existence is not revealed.
+func (r *InMemoryPostRepository) FindByID(viewer Viewer, id uuid.UUID) (*Post, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.posts[id]
+	if !ok || !r.visibleTo(viewer, false)(p) {
+		return nil, ErrPostNotFound
+	}
+	return r.withAuthors(p), nil
+}
+
+func (r *InMemoryPostRepository) List(viewer Viewer, filter PostListFilter) ([]*Post, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	visible := r.visibleTo(viewer, true)
+	out := []*Post{}
+	for _, p := range r.posts {
+		if filter.AuthorID != uuid.Nil && !r.isAuthor(p, filter.AuthorID) {
+			continue
+		}
+		if visible(p) {
+			out = append(out, r.withAuthors(p))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// --- Notifications ---
+
+// Notifier delivers a message to a user; logNotifier stands in for email.
+type Notifier interface {
+	Notify(recipient, subject, body string) error
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(recipient, subject, body string) error {
+	log.Printf("NOTIFY %s: %s - %s", recipient, subject, body)
+	return nil
+}
+
+// NotificationTask is one notification for one user. Recipient, Subject and
+// Body are for the external notifier; UserID, Type and Payload become the
+// in-app inbox entry.
+type NotificationTask struct {
+	UserID    uuid.UUID
+	Type      string
+	Payload   map[string]string
+	Recipient string
+	Subject   string
+	Body      string
+}
+
+const (
+	notificationQueueSize = 256
+	notificationAttempts  = 3
+)
+
+// NotificationQueue sends notifications from background workers so that the
+// request which triggered one never waits on the notifier. A task that still
+// fails after notificationAttempts tries is logged and dropped. The inbox
+// entry is written before queueing, so it is kept even when the external
+// send is dropped or fails.
+type NotificationQueue struct {
+	notifier Notifier
+	inbox    INotificationRepository
+	tasks    chan NotificationTask
+}
+
+func NewNotificationQueue(notifier Notifier, inbox INotificationRepository, workers int) *NotificationQueue {
+	q := &NotificationQueue{notifier: notifier, inbox: inbox, tasks: make(chan NotificationTask, notificationQueueSize)}
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	return q
+}
+
+// Enqueue never blocks; when the queue is full the task is dropped.
+func (q *NotificationQueue) Enqueue(task NotificationTask) {
+	if task.UserID != uuid.Nil {
+		n := &Notification{ID: uuid.New(), UserID: task.UserID, Type: task.Type, Payload: task.Payload, CreatedAt: time.Now()}
+		if err := q.inbox.Create(n); err != nil {
+			log.Printf("could not add %q to the inbox of %s: %v", task.Type, task.UserID, err)
+		}
+	}
+	select {
+	case q.tasks <- task:
+	default:
+		log.Printf("notification queue full, dropping %q for %s", task.Subject, task.Recipient)
+	}
+}
+
+func (q *NotificationQueue) run() {
+	for task := range q.tasks {
+		var err error
+		for attempt := 1; attempt <= notificationAttempts; attempt++ {
+			if err = q.notifier.Notify(task.Recipient, task.Subject, task.Body); err == nil {
+				break
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err != nil {
+			log.Printf("giving up on %q for %s: %v", task.Subject, task.Recipient, err)
+		}
+	}
+}
+
+// RunNotificationPruner deletes notifications read more than retention ago,
+// once every interval, until ctx is done.
+func RunNotificationPruner(ctx context.Context, inbox INotificationRepository, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if pruned := inbox.PruneRead(now.Add(-retention)); pruned > 0 {
+				log.Printf("pruned %d read notifications", pruned)
+			}
+		}
+	}
+}
+
 // --- Service Layer (Interfaces & Implementations) ---
 
 type IAuthService interface {
@@ -168,6 +773,260 @@ func (s *AuthService) ProcessOAuth2Callback(email string) (*User, error) {
 	return user, nil
 }
 
+type IPostService interface {
+	Create(viewer Viewer, title, content, status string, visibility Visibility) (*Post, error)
+	Get(viewer Viewer, id uuid.UUID) (*Post, error)
+	List(viewer Viewer, filter PostListFilter) ([]*Post, error)
+	Update(viewer Viewer, id uuid.UUID, title, content *string) (*Post, error)
+	ChangeVisibility(viewer Viewer, id uuid.UUID, visibility Visibility) (*Post, error)
+	InviteCoauthor(viewer Viewer, postID uuid.UUID, email string) (*CoauthorInvitation, error)
+	ListInvitations(viewer Viewer) ([]*CoauthorInvitation, error)
+	RespondToInvitation(viewer Viewer, id uuid.UUID, accept bool) (*CoauthorInvitation, error)
+	Follow(viewer Viewer, userID uuid.UUID) error
+	Unfollow(viewer Viewer, userID uuid.UUID) error
+}
+
+var (
+	ErrInvalidVisibility = errors.New("service: visibility must be public, unlisted, followers or private")
+	ErrNotAuthor         = errors.New("service: only the post's authors can change it")
+	ErrNotPrimaryAuthor  = errors.New("service: only the primary author can invite co-authors")
+	ErrAlreadyAuthor     = errors.New("service: user is already an author of this post")
+	ErrEmptyTitle        = errors.New("service: title must not be empty")
+)
+
+type PostService struct {
+	posts         IPostRepository
+	follows       IFollowRepository
+	coauthors     ICoauthorRepository
+	users         IUserRepository
+	notifications *NotificationQueue
+}
+
+func NewPostService(posts IPostRepository, follows IFollowRepository, coauthors ICoauthorRepository, users IUserRepository, notifications *NotificationQueue) IPostService {
+	return &PostService{posts: posts, follows: follows, coauthors: coauthors, users: users, notifications: notifications}
+}
+
+// editable loads a post the viewer may change: any of its authors may.
+func (s *PostService) editable(viewer Viewer, id uuid.UUID) (*Post, error) {
+	post, err := s.posts.FindByID(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != viewer.UserID && !s.coauthors.IsCoAuthor(post.ID, viewer.UserID) {
+		return nil, ErrNotAuthor
+	}
+	return post, nil
+}
+
+func (s *PostService) Create(viewer Viewer, title, content, status string, visibility Visibility) (*Post, error) {
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	if !visibility.Valid() {
+		return nil, ErrInvalidVisibility
+	}
+	if status == "" {
+		status = StatusDraft
+	}
+	if status != StatusDraft && status != StatusPublished {
+		return nil, errors.New("service: status must be DRAFT or PUBLISHED")
+	}
+	post := &Post{
+		ID:         uuid.New(),
+		UserID:     viewer.UserID,
+		Title:      title,
+		Content:    content,
+		Status:     status,
+		Visibility: visibility,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.posts.Save(post); err != nil {
+		return nil, err
+	}
+	return s.posts.FindByID(viewer, post.ID)
+}
+
+func (s *PostService) Get(viewer Viewer, id uuid.UUID) (*Post, error) {
+	return s.posts.FindByID(viewer, id)
+}
+
+func (s *PostService) List(viewer Viewer, filter PostListFilter) ([]*Post, error) {
+	return s.posts.List(viewer, filter)
+}
+
+func (s *PostService) ChangeVisibility(viewer Viewer, id uuid.UUID, visibility Visibility) (*Post, error) {
+	if !visibility.Valid() {
+		return nil, ErrInvalidVisibility
+	}
+	post, err := s.editable(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	post.Visibility = visibility
+	return post, s.posts.Save(post)
+}
+
+// Update changes the title and/or content; nil leaves a field as it is.
+func (s *PostService) Update(viewer Viewer, id uuid.UUID, title, content *string) (*Post, error) {
+	if title != nil && strings.TrimSpace(*title) == "" {
+		return nil, ErrEmptyTitle
+	}
+	post, err := s.editable(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if title != nil {
+		post.Title = *title
+	}
+	if content != nil {
+		post.Content = *content
+	}
+	return post, s.posts.Save(post)
+}
+
+// InviteCoauthor records a pending invitation and notifies the invitee. Only
+// the primary author may invite.
+func (s *PostService) InviteCoauthor(viewer Viewer, postID uuid.UUID, email string) (*CoauthorInvitation, error) {
+	post, err := s.posts.FindByID(viewer, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != viewer.UserID {
+		return nil, ErrNotPrimaryAuthor
+	}
+	invitee, err := s.users.FindByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range post.Authors {
+		if a.UserID == invitee.ID {
+			return nil, ErrAlreadyAuthor
+		}
+	}
+	inv := &CoauthorInvitation{
+		ID:        uuid.New(),
+		PostID:    post.ID,
+		PostTitle: post.Title,
+		InviterID: viewer.UserID,
+		InviteeID: invitee.ID,
+		Status:    InvitationPending,
+		CreatedAt: time.Now(),
+	}
+	if err := s.coauthors.CreateInvitation(inv); err != nil {
+		return nil, err
+	}
+	s.notifications.Enqueue(NotificationTask{
+		UserID: invitee.ID,
+		Type:   NotificationCoauthorInvited,
+		Payload: map[string]string{
+			"invitation_id": inv.ID.String(),
+			"post_id":       post.ID.String(),
+			"post_title":    post.Title,
+			"inviter_id":    viewer.UserID.String(),
+		},
+		Recipient: invitee.Email,
+		Subject:   "You have been invited to co-author a post",
+		Body:      fmt.Sprintf("You have been invited to co-author %q. Accept or decline invitation %s.", post.Title, inv.ID),
+	})
+	return inv, nil
+}
+
+func (s *PostService) ListInvitations(viewer Viewer) ([]*CoauthorInvitation, error) {
+	return s.coauthors.ListInvitations(viewer.UserID, InvitationPending)
+}
+
+// RespondToInvitation accepts or declines one of the viewer's pending
+// invitations and lets the inviter know the answer.
+func (s *PostService) RespondToInvitation(viewer Viewer, id uuid.UUID, accept bool) (*CoauthorInvitation, error) {
+	inv, err := s.coauthors.Respond(id, viewer.UserID, accept)
+	if err != nil {
+		return nil, err
+	}
+	if inviter, err := s.users.FindByID(inv.InviterID); err == nil {
+		s.notifications.Enqueue(NotificationTask{
+			UserID: inviter.ID,
+			Type:   NotificationCoauthorAnswered,
+			Payload: map[string]string{
+				"invitation_id": inv.ID.String(),
+				"post_id":       inv.PostID.String(),
+				"post_title":    inv.PostTitle,
+				"invitee_id":    inv.InviteeID.String(),
+				"status":        string(inv.Status),
+			},
+			Recipient: inviter.Email,
+			Subject:   "Co-author invitation " + string(inv.Status),
+			Body:      fmt.Sprintf("Your invitation to co-author %q was %s.", inv.PostTitle, inv.Status),
+		})
+	}
+	return inv, nil
+}
+
+func (s *PostService) Follow(viewer Viewer, userID uuid.UUID) error {
+	return s.follows.Follow(viewer.UserID, userID)
+}
+
+func (s *PostService) Unfollow(viewer Viewer, userID uuid.UUID) error {
+	return s.follows.Unfollow(viewer.UserID, userID)
+}
+
+// NotificationInbox is one page of the viewer's inbox together with how
+// many of their notifications are unread in total. NextCursor is empty on
+// the last page.
+type NotificationInbox struct {
+	UnreadCount   int             `json:"unread_count"`
+	Notifications []*Notification `json:"notifications"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+}
+
+const (
+	defaultNotificationPageSize = 20
+	maxNotificationPageSize     = 100
+)
+
+type INotificationService interface {
+	List(viewer Viewer, unreadOnly bool, after *NotificationCursor, limit int) (*NotificationInbox, error)
+	MarkRead(viewer Viewer, ids []uuid.UUID) ([]*Notification, error)
+	MarkAllRead(viewer Viewer) int
+	UnreadCount(viewer Viewer) int
+}
+
+type NotificationService struct {
+	inbox INotificationRepository
+}
+
+func NewNotificationService(inbox INotificationRepository) INotificationService {
+	return &NotificationService{inbox: inbox}
+}
+
+// List returns one page of at most limit notifications. It asks the
+// repository for one extra to learn whether another page follows.
+func (s *NotificationService) List(viewer Viewer, unreadOnly bool, after *NotificationCursor, limit int) (*NotificationInbox, error) {
+	notifications, err := s.inbox.List(viewer.UserID, unreadOnly, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	inbox := &NotificationInbox{UnreadCount: s.inbox.UnreadCount(viewer.UserID)}
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[limit-1]
+		inbox.NextCursor = NotificationCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	inbox.Notifications = notifications
+	return inbox, nil
+}
+
+func (s *NotificationService) MarkRead(viewer Viewer, ids []uuid.UUID) ([]*Notification, error) {
+	return s.inbox.MarkRead(viewer.UserID, ids, time.Now())
+}
+
+func (s *NotificationService) MarkAllRead(viewer Viewer) int {
+	return s.inbox.MarkAllRead(viewer.UserID, time.Now())
+}
+
+func (s *NotificationService) UnreadCount(viewer Viewer) int {
+	return s.inbox.UnreadCount(viewer.UserID)
+}
+
 // --- Controller Layer ---
 
 type AuthController struct {
@@ -224,7 +1083,403 @@ func (ctrl *AuthController) OAuthCallback(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"token": token})
 }
 
+type PostController struct {
+	postService IPostService
+}
+
+func NewPostController(postService IPostService) *PostController {
+	return &PostController{postService: postService}
+}
+
+func (ctrl *PostController) Create(c echo.Context) error {
+	var body struct {
+		Title      string     `json:"title"`
+		Content    string     `json:"content"`
+		Status     string     `json:"status"`
+		Visibility Visibility `json:"visibility"`
+	}
+	if err := c.Bind(&body); err != nil || strings.TrimSpace(body.Title) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	post, err := ctrl.postService.Create(ViewerFrom(c), body.Title, body.Content, body.Status, body.Visibility)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, post)
+}
+
+func (ctrl *PostController) List(c echo.Context) error {
+	var filter PostListFilter
+	if author := c.QueryParam("author_id"); author != "" {
+		id, err := uuid.Parse(author)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid author_id"})
+		}
+		filter.AuthorID = id
+	}
+	posts, err := ctrl.postService.List(ViewerFrom(c), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not list posts"})
+	}
+	return c.JSON(http.StatusOK, posts)
+}
+
+func (ctrl *PostController) Get(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post id"})
+	}
+	post, err := ctrl.postService.Get(ViewerFrom(c), id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+	}
+	return c.JSON(http.StatusOK, post)
+}
+
+// postError maps service and repository errors to responses.
+func postError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrPostNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+	case errors.Is(err, ErrInvitationNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Invitation not found"})
+	case errors.Is(err, ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	case errors.Is(err, ErrNotAuthor), errors.Is(err, ErrNotPrimaryAuthor):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrAlreadyAuthor), errors.Is(err, ErrInvitationPending), errors.Is(err, ErrInvitationClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+}
+
+func (ctrl *PostController) Update(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post id"})
+	}
+	var body struct {
+		Title   *string `json:"title"`
+		Content *string `json:"content"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	post, err := ctrl.postService.Update(ViewerFrom(c), id, body.Title, body.Content)
+	if err != nil {
+		return postError(c, err)
+	}
+	return c.JSON(http.StatusOK, post)
+}
+
+func (ctrl *PostController) ChangeVisibility(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post id"})
+	}
+	var body struct {
+		Visibility Visibility `json:"visibility"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	post, err := ctrl.postService.ChangeVisibility(ViewerFrom(c), id, body.Visibility)
+	if err != nil {
+		return postError(c, err)
+	}
+	return c.JSON(http.StatusOK, post)
+}
+
+func (ctrl *PostController) InviteCoauthor(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post id"})
+	}
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := c.Bind(&body); err != nil || strings.TrimSpace(body.Email) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	inv, err := ctrl.postService.InviteCoauthor(ViewerFrom(c), id, strings.TrimSpace(body.Email))
+	if err != nil {
+		return postError(c, err)
+	}
+	return c.JSON(http.StatusCreated, inv)
+}
+
+func (ctrl *PostController) ListInvitations(c echo.Context) error {
+	invitations, err := ctrl.postService.ListInvitations(ViewerFrom(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not list invitations"})
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+func (ctrl *PostController) AcceptInvitation(c echo.Context) error {
+	return ctrl.respondToInvitation(c, true)
+}
+
+func (ctrl *PostController) DeclineInvitation(c echo.Context) error {
+	return ctrl.respondToInvitation(c, false)
+}
+
+func (ctrl *PostController) respondToInvitation(c echo.Context, accept bool) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid invitation id"})
+	}
+	inv, err := ctrl.postService.RespondToInvitation(ViewerFrom(c), id, accept)
+	if err != nil {
+		return postError(c, err)
+	}
+	return c.JSON(http.StatusOK, inv)
+}
+
+func (ctrl *PostController) Follow(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user id"})
+	}
+	if c.Request().Method == http.MethodDelete {
+		err = ctrl.postService.Unfollow(ViewerFrom(c), id)
+	} else {
+		err = ctrl.postService.Follow(ViewerFrom(c), id)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type NotificationController struct {
+	notificationService INotificationService
+}
+
+func NewNotificationController(notificationService INotificationService) *NotificationController {
+	return &NotificationController{notificationService: notificationService}
+}
+
+// List pages through the viewer's notifications, newest first; ?unread=true
+// limits it to unread ones. ?limit= sets the page size and ?cursor= takes
+// the next_cursor of the previous page.
+func (ctrl *NotificationController) List(c echo.Context) error {
+	unreadOnly := c.QueryParam("unread") == "true"
+	limit := defaultNotificationPageSize
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNotificationPageSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxNotificationPageSize)})
+		}
+		limit = n
+	}
+	var after *NotificationCursor
+	if v := c.QueryParam("cursor"); v != "" {
+		cur, err := DecodeNotificationCursor(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+		}
+		after = &cur
+	}
+	inbox, err := ctrl.notificationService.List(ViewerFrom(c), unreadOnly, after, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not list notifications"})
+	}
+	return c.JSON(http.StatusOK, inbox)
+}
+
+func (ctrl *NotificationController) MarkRead(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid notification id"})
+	}
+	marked, err := ctrl.notificationService.MarkRead(ViewerFrom(c), []uuid.UUID{id})
+	if errors.Is(err, ErrNotificationNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not mark notification read"})
+	}
+	return c.JSON(http.StatusOK, marked[0])
+}
+
+// MarkReadBulk marks the listed notifications read, or all of them when the
+// body sets "all". An empty request is rejected rather than read as "all".
+func (ctrl *NotificationController) MarkReadBulk(c echo.Context) error {
+	var body struct {
+		IDs []uuid.UUID `json:"ids"`
+		All bool        `json:"all"`
+	}
+	if err := c.Bind(&body); err != nil || (len(body.IDs) == 0) == !body.All {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Send either ids or all"})
+	}
+	viewer := ViewerFrom(c)
+	marked := 0
+	if body.All {
+		marked = ctrl.notificationService.MarkAllRead(viewer)
+	} else {
+		notifications, err := ctrl.notificationService.MarkRead(viewer, body.IDs)
+		if errors.Is(err, ErrNotificationNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification not found"})
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not mark notifications read"})
+		}
+		marked = len(notifications)
+	}
+	return c.JSON(http.StatusOK, map[string]int{
+		"marked":       marked,
+		"unread_count": ctrl.notificationService.UnreadCount(viewer),
+	})
+}
+
 // --- Middleware Factory ---
+
+// ViewerMiddleware parses the bearer token into a Viewer. With required set,
+// requests without a valid token are rejected; otherwise they continue as
+// anonymous viewers. A token that is present but invalid is always rejected.
+func ViewerMiddleware(jwtSecret string, required bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if header == "" {
+				if required {
+					return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+				}
+				c.Set("viewer", Viewer{})
+				return next(c)
+			}
+			claims := &JWTClaims{}
+			_, err := jwt.ParseWithClaims(strings.TrimPrefix(header, "Bearer "), claims, func(t *jwt.Token) (interface{}, error) {
+				return []byte(jwtSecret), nil
+			}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
+			}
+			userID, err := uuid.Parse(claims.UserID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token subject")
+			}
+			c.Set("viewer", Viewer{UserID: userID, Role: claims.Role})
+			return next(c)
+		}
+	}
+}
+
+func ViewerFrom(c echo.Context) Viewer {
+	v, _ := c.Get("viewer").(Viewer)
+	return v
+}
+
+// A token's claims are a snapshot from login time, so a user deactivated or
+// demoted since then keeps access until the token expires. Groups configured
+// for fresh state re-check the claims against the repository, through a
+// short-lived cache so the lookup is not paid on every request.
+
+type userState struct {
+	isActive bool
+	role     Role
+	expires  time.Time
+}
+
+type UserStateCache struct {
+	repo IUserRepository
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	states map[uuid.UUID]userState
+}
+
+func NewUserStateCache(repo IUserRepository, ttl time.Duration) *UserStateCache {
+	return &UserStateCache{repo: repo, ttl: ttl, states: make(map[uuid.UUID]userState)}
+}
+
+// Lookup returns the user's current state, hitting the repository at most
+// once per TTL. Missing users are not cached.
+func (c *UserStateCache) Lookup(id uuid.UUID) (userState, error) {
+	now := time.Now()
+	c.mu.Lock()
+	state, ok := c.states[id]
+	c.mu.Unlock()
+	if ok && now.Before(state.expires) {
+		return state, nil
+	}
+	user, err := c.repo.FindByID(id)
+	if err != nil {
+		return userState{}, err
+	}
+	state = userState{isActive: user.IsActive, role: user.Role, expires: now.Add(c.ttl)}
+	c.mu.Lock()
+	c.states[id] = state
+	c.mu.Unlock()
+	return state, nil
+}
+
+// FreshStateConfig names the route groups whose tokens are checked against
+// current user state. FRESH_STATE_GROUPS is a comma-separated list of group
+// names ("admin" when unset, none when empty) and FRESH_STATE_TTL bounds how
+// stale a cached state may be.
+type FreshStateConfig struct {
+	Groups map[string]bool
+	Cache  *UserStateCache
+}
+
+func LoadFreshStateConfig(repo IUserRepository) FreshStateConfig {
+	groups, ok := os.LookupEnv("FRESH_STATE_GROUPS")
+	if !ok {
+		groups = "admin"
+	}
+	ttl := 5 * time.Second
+	if raw := os.Getenv("FRESH_STATE_TTL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			log.Fatalf("FATAL: invalid FRESH_STATE_TTL %q", raw)
+		}
+		ttl = d
+	}
+	cfg := FreshStateConfig{Groups: make(map[string]bool), Cache: NewUserStateCache(repo, ttl)}
+	for _, g := range strings.Split(groups, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			cfg.Groups[g] = true
+		}
+	}
+	return cfg
+}
+
+// For returns the fresh state check for the named group, or a pass-through
+// when the group is not configured. It must run after ViewerMiddleware.
+func (cfg FreshStateConfig) For(group string) echo.MiddlewareFunc {
+	if !cfg.Groups[group] {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+	return FreshStateMiddleware(cfg.Cache)
+}
+
+// FreshStateMiddleware rejects tokens whose subject no longer exists, has
+// been deactivated, or no longer holds the role named in the claims.
+// Anonymous viewers pass through untouched.
+func FreshStateMiddleware(cache *UserStateCache) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			viewer := ViewerFrom(c)
+			if viewer.Anonymous() {
+				return next(c)
+			}
+			state, err := cache.Lookup(viewer.UserID)
+			switch {
+			case errors.Is(err, ErrUserNotFound):
+				return echo.NewHTTPError(http.StatusUnauthorized, "token subject no longer exists")
+			case err != nil:
+				return err
+			case !state.isActive:
+				return echo.NewHTTPError(http.StatusUnauthorized, "account is deactivated")
+			case state.role != viewer.Role:
+				return echo.NewHTTPError(http.StatusUnauthorized, "token role is out of date, sign in again")
+			}
+			return next(c)
+		}
+	}
+}
+
 func AuthMiddleware(jwtSecret string, requiredRole ...Role) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -273,8 +1528,30 @@ func main() {
 
 	// Dependency Injection
 	userRepo := NewInMemoryUserRepository()
+	followRepo := NewInMemoryFollowRepository()
+	coauthorRepo := NewInMemoryCoauthorRepository()
+	postRepo := NewInMemoryPostRepository(followRepo, coauthorRepo)
+	notificationRepo := NewInMemoryNotificationRepository()
+	notifications := NewNotificationQueue(logNotifier{}, notificationRepo, 2)
 	authService := NewAuthService(userRepo, jwtSecret)
+	postService := NewPostService(postRepo, followRepo, coauthorRepo, userRepo, notifications)
+	notificationService := NewNotificationService(notificationRepo)
 	authController := NewAuthController(authService)
+	postController := NewPostController(postService)
+	notificationController := NewNotificationController(notificationService)
+	fresh := LoadFreshStateConfig(userRepo)
+
+	// Read notifications are kept for NOTIFICATION_RETENTION (default 30
+	// days) after they were read; unread ones are never pruned.
+	retention := 30 * 24 * time.Hour
+	if raw := os.Getenv("NOTIFICATION_RETENTION"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Fatalf("FATAL: invalid NOTIFICATION_RETENTION %q", raw)
+		}
+		retention = d
+	}
+	go RunNotificationPruner(context.Background(), notificationRepo, retention, time.Hour)
 
 	// Routing
 	e.POST("/login", authController.Login)
@@ -284,11 +1561,29 @@ func main() {
 	api := e.Group("/api")
 	api.Use(middleware.JWT([]byte(jwtSecret)))
 
-	api.POST("/posts", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, "post created")
-	}, AuthMiddleware(jwtSecret, USER, ADMIN))
+	// Reads work for anonymous and signed-in viewers; visibility is applied
+	// by the repository according to who is asking.
+	public := e.Group("/posts", ViewerMiddleware(jwtSecret, false), fresh.For("public"))
+	public.GET("", postController.List)
+	public.GET("/:id", postController.Get)
+
+	authed := api.Group("", ViewerMiddleware(jwtSecret, true), fresh.For("authed"))
+	authed.POST("/posts", postController.Create, AuthMiddleware(jwtSecret, USER, ADMIN))
+	authed.PATCH("/posts/:id", postController.Update)
+	authed.PATCH("/posts/:id/visibility", postController.ChangeVisibility)
+	authed.POST("/posts/:id/invitations", postController.InviteCoauthor)
+	authed.GET("/invitations", postController.ListInvitations)
+	authed.POST("/invitations/:id/accept", postController.AcceptInvitation)
+	authed.POST("/invitations/:id/decline", postController.DeclineInvitation)
+	authed.GET("/notifications", notificationController.List)
+	authed.POST("/notifications/read", notificationController.MarkReadBulk)
+	authed.POST("/notifications/:id/read", notificationController.MarkRead)
+	authed.POST("/users/:id/follow", postController.Follow)
+	authed.DELETE("/users/:id/follow", postController.Follow)
 
-	admin := api.Group("/admin")
+	// The fresh state check runs ahead of AuthMiddleware so a demoted admin is
+	// turned away before the role in the stale claims is trusted.
+	admin := api.Group("/admin", ViewerMiddleware(jwtSecret, true), fresh.For("admin"))
 	admin.Use(AuthMiddleware(jwtSecret, ADMIN))
 	admin.GET("/dashboard", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, "welcome to the admin dashboard")
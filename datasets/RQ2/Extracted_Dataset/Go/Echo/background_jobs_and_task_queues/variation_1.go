@@ -1,27 +1,90 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/scrypt"
 )
 
 // This code requires a running Redis instance.
 // Example: docker run -d --name redis -p 6379:6379 redis
 const redisAddr = "127.0.0.1:6379"
 
+// --- Clock ---
+
+// Clock is the time source for timestamps, report dates and expiry checks,
+// so the e2e scenarios can move the application through days in an instant.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// clock is swapped for a FakeClock by the e2e scenarios.
+var clock Clock = systemClock{}
+
+// FakeClock only moves when Advance is called.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
 // --- Domain Models ---
 
 type UserRole string
@@ -37,6 +100,9 @@ type User struct {
 	Role         UserRole  `json:"role"`
 	IsActive     bool      `json:"is_active"`
 	CreatedAt    time.Time `json:"created_at"`
+	// Set when the address hard-bounces or complains; cleared with the suppression.
+	EmailUndeliverable bool   `json:"email_undeliverable,omitempty"`
+	EmailFlagReason    string `json:"email_flag_reason,omitempty"`
 }
 
 type PostStatus string
@@ -56,16 +122,596 @@ type Post struct {
 // --- Mock Database ---
 
 type MockDB struct {
-	users map[uuid.UUID]User
-	posts map[uuid.UUID]Post
-	mu    sync.RWMutex
+	users       map[uuid.UUID]User
+	posts       map[uuid.UUID]Post
+	comments    map[uuid.UUID]Comment
+	attachments map[uuid.UUID]Attachment
+	reports     map[uuid.UUID]ReportArtifact
+	takeouts    map[uuid.UUID]TakeoutExport
+	audit       []AuditEvent
+
+	quotaLimits    map[UserRole]QuotaLimits
+	quotaOverrides map[uuid.UUID]QuotaLimits
+	usage          map[uuid.UUID]*QuotaUsage
+	pendingJobs    map[string]uuid.UUID // task ID -> owning user
+	jobs           map[string]*JobRecord
+	jobSeq         uint64
+	notifications  map[string]*EmailNotification // by message ID
+	suppressions   map[string]Suppression        // by normalized address
+	mu             sync.RWMutex
 }
 
 func NewMockDB() *MockDB {
 	return &MockDB{
-		users: make(map[uuid.UUID]User),
-		posts: make(map[uuid.UUID]Post),
+		users:          make(map[uuid.UUID]User),
+		posts:          make(map[uuid.UUID]Post),
+		comments:       make(map[uuid.UUID]Comment),
+		attachments:    make(map[uuid.UUID]Attachment),
+		reports:        make(map[uuid.UUID]ReportArtifact),
+		takeouts:       make(map[uuid.UUID]TakeoutExport),
+		quotaLimits:    defaultQuotaLimits,
+		quotaOverrides: make(map[uuid.UUID]QuotaLimits),
+		usage:          make(map[uuid.UUID]*QuotaUsage),
+		pendingJobs:    make(map[string]uuid.UUID),
+		jobs:           make(map[string]*JobRecord),
+		notifications:  make(map[string]*EmailNotification),
+		suppressions:   make(map[string]Suppression),
+	}
+}
+
+type Comment struct {
+	ID        uuid.UUID `json:"id"`
+	PostID    uuid.UUID `json:"post_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Attachment is a processed post image; the bytes live in the BlobStore.
+type Attachment struct {
+	ID        uuid.UUID `json:"id"`
+	PostID    uuid.UUID `json:"post_id"`
+	FileName  string    `json:"file_name"`
+	BlobKey   string    `json:"-"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuditEvent struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// recordAudit appends to the audit trail. Callers must not hold db.mu.
+func (db *MockDB) recordAudit(userID uuid.UUID, action, detail string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.audit = append(db.audit, AuditEvent{ID: uuid.New(), UserID: userID, Action: action, Detail: detail, At: clock.Now().UTC()})
+}
+
+// --- Quotas ---
+// Soft per-user limits: checks happen before work is accepted, so concurrent
+// requests can overshoot a limit slightly. Usage counters are maintained by
+// the MockDB hooks below rather than recounted per request. A limit of 0
+// means unlimited.
+
+type QuotaResource string
+
+const (
+	QuotaPosts           QuotaResource = "posts"
+	QuotaAttachmentBytes QuotaResource = "attachment_bytes"
+	QuotaPendingJobs     QuotaResource = "pending_jobs"
+)
+
+// quotaHeaderNames are used as X-Quota-<name>-Limit and X-Quota-<name>-Used.
+var quotaHeaderNames = map[QuotaResource]string{
+	QuotaPosts:           "Posts",
+	QuotaAttachmentBytes: "Attachment-Bytes",
+	QuotaPendingJobs:     "Pending-Jobs",
+}
+
+type QuotaLimits struct {
+	MaxPosts           int64 `json:"max_posts"`
+	MaxAttachmentBytes int64 `json:"max_attachment_bytes"`
+	MaxPendingJobs     int64 `json:"max_pending_jobs"`
+}
+
+func (l QuotaLimits) limit(r QuotaResource) int64 {
+	switch r {
+	case QuotaPosts:
+		return l.MaxPosts
+	case QuotaAttachmentBytes:
+		return l.MaxAttachmentBytes
+	default:
+		return l.MaxPendingJobs
+	}
+}
+
+type QuotaUsage struct {
+	Posts           int64 `json:"posts"`
+	AttachmentBytes int64 `json:"attachment_bytes"`
+	PendingJobs     int64 `json:"pending_jobs"`
+}
+
+func (u QuotaUsage) used(r QuotaResource) int64 {
+	switch r {
+	case QuotaPosts:
+		return u.Posts
+	case QuotaAttachmentBytes:
+		return u.AttachmentBytes
+	default:
+		return u.PendingJobs
+	}
+}
+
+var defaultQuotaLimits = map[UserRole]QuotaLimits{
+	RoleUser:  {MaxPosts: 100, MaxAttachmentBytes: 50 << 20, MaxPendingJobs: 5},
+	RoleAdmin: {},
+}
+
+// loadQuotaLimits applies QUOTA_LIMITS, a JSON object of limits keyed by role,
+// over the defaults.
+func loadQuotaLimits() (map[UserRole]QuotaLimits, error) {
+	limits := make(map[UserRole]QuotaLimits, len(defaultQuotaLimits))
+	for role, l := range defaultQuotaLimits {
+		limits[role] = l
+	}
+	raw := os.Getenv("QUOTA_LIMITS")
+	if raw == "" {
+		return limits, nil
+	}
+	var overrides map[UserRole]QuotaLimits
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("QUOTA_LIMITS: %w", err)
+	}
+	for role, l := range overrides {
+		if l.MaxPosts < 0 || l.MaxAttachmentBytes < 0 || l.MaxPendingJobs < 0 {
+			return nil, fmt.Errorf("QUOTA_LIMITS: negative limit for role %s", role)
+		}
+		limits[role] = l
+	}
+	return limits, nil
+}
+
+// The hooks below keep usage in step with the tables. Callers hold db.mu.
+
+func (db *MockDB) usageOf(userID uuid.UUID) *QuotaUsage {
+	u, ok := db.usage[userID]
+	if !ok {
+		u = &QuotaUsage{}
+		db.usage[userID] = u
+	}
+	return u
+}
+
+func (db *MockDB) insertPost(p Post) {
+	if _, exists := db.posts[p.ID]; !exists {
+		db.usageOf(p.UserID).Posts++
+	}
+	db.posts[p.ID] = p
+}
+
+// insertAttachment charges the attachment to the post's author.
+func (db *MockDB) insertAttachment(a Attachment) {
+	if post, ok := db.posts[a.PostID]; ok {
+		db.usageOf(post.UserID).AttachmentBytes += a.SizeBytes
+	}
+	db.attachments[a.ID] = a
+}
+
+func (db *MockDB) trackJob(taskID string, userID uuid.UUID) {
+	if _, exists := db.pendingJobs[taskID]; !exists {
+		db.usageOf(userID).PendingJobs++
+	}
+	db.pendingJobs[taskID] = userID
+}
+
+// transferJob hands a pending-job slot, and the job record, on to the next
+// task of a chain, so the user sees one job for the whole pipeline.
+func (db *MockDB) transferJob(fromTaskID, toTaskID string) {
+	if userID, ok := db.pendingJobs[fromTaskID]; ok {
+		delete(db.pendingJobs, fromTaskID)
+		db.pendingJobs[toTaskID] = userID
+	}
+	if rec, ok := db.jobs[fromTaskID]; ok {
+		delete(db.jobs, fromTaskID)
+		rec.ID, rec.State, rec.UpdatedAt = toTaskID, JobQueued, clock.Now().UTC()
+		db.jobs[toTaskID] = rec
+	}
+}
+
+func (db *MockDB) releaseJob(taskID string) {
+	if userID, ok := db.pendingJobs[taskID]; ok {
+		delete(db.pendingJobs, taskID)
+		db.usageOf(userID).PendingJobs--
+	}
+}
+
+// quotaFor returns the user's override, or else their role's limits.
+func (db *MockDB) quotaFor(user User) QuotaLimits {
+	if l, ok := db.quotaOverrides[user.ID]; ok {
+		return l
+	}
+	return db.quotaLimits[user.Role]
+}
+
+// taskDone reports whether asynq is done with the task once this attempt
+// returns err: it succeeded, asked not to be retried or ran out of retries.
+func taskDone(ctx context.Context, err error) bool {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	return err == nil || errors.Is(err, asynq.SkipRetry) || retried >= maxRetry
+}
+
+// releaseJobsMiddleware frees a task's pending-job slot once asynq is done
+// with it, whether it succeeded or ran out of retries.
+func (db *MockDB) releaseJobsMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		err := next.ProcessTask(ctx, t)
+		if taskDone(ctx, err) {
+			if id, ok := asynq.GetTaskID(ctx); ok {
+				db.mu.Lock()
+				db.releaseJob(id)
+				db.mu.Unlock()
+			}
+		}
+		return err
+	})
+}
+
+// --- Job Records ---
+
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobRetrying  JobState = "retrying"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+)
+
+// JobRecord is a row in the jobs table: the history of a task a user
+// triggered. It outlives asynq's own retention and only carries a preview of
+// the payload, so it is safe to show to the user who owns it.
+type JobRecord struct {
+	ID        string                 `json:"id"`
+	UserID    uuid.UUID              `json:"user_id"`
+	Type      string                 `json:"type"`
+	Queue     string                 `json:"queue"`
+	State     JobState               `json:"state"`
+	Attempts  int                    `json:"attempts"`
+	LastError string                 `json:"last_error,omitempty"`
+	Preview   map[string]interface{} `json:"preview,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	seq       uint64
+}
+
+const maxPreviewString = 64
+
+// previewRedacted names payload fields that never appear in a preview.
+var previewRedacted = map[string]bool{"key": true, "salt": true, "password": true, "passphrase": true, "token": true, "secret": true}
+
+// summarizePayload keeps a JSON payload's top-level scalars, truncating long
+// strings (such as base64 image data) and dropping secrets.
+func summarizePayload(payload []byte) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil
+	}
+	preview := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if previewRedacted[k] {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			if len(v) > maxPreviewString {
+				preview[k] = fmt.Sprintf("%s... (%d chars)", v[:maxPreviewString], len(v))
+			} else {
+				preview[k] = v
+			}
+		case map[string]interface{}, []interface{}:
+			preview[k] = "(omitted)"
+		default:
+			preview[k] = v
+		}
+	}
+	return preview
+}
+
+// recordJob adds a task to its owner's job history. Callers hold db.mu.
+func (db *MockDB) recordJob(info *asynq.TaskInfo, userID uuid.UUID) {
+	db.jobSeq++
+	now := clock.Now().UTC()
+	db.jobs[info.ID] = &JobRecord{
+		ID:        info.ID,
+		UserID:    userID,
+		Type:      info.Type,
+		Queue:     info.Queue,
+		State:     JobQueued,
+		Preview:   summarizePayload(info.Payload),
+		CreatedAt: now,
+		UpdatedAt: now,
+		seq:       db.jobSeq,
+	}
+}
+
+// jobRecordsMiddleware keeps each record's state in step with its task.
+func (db *MockDB) jobRecordsMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		id, _ := asynq.GetTaskID(ctx)
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		db.mu.Lock()
+		if rec, ok := db.jobs[id]; ok {
+			rec.State, rec.Attempts, rec.UpdatedAt = JobRunning, retried+1, clock.Now().UTC()
+		}
+		db.mu.Unlock()
+
+		err := next.ProcessTask(ctx, t)
+
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		// A chained task may have moved the record on to its successor.
+		if rec, ok := db.jobs[id]; ok {
+			rec.UpdatedAt = clock.Now().UTC()
+			switch {
+			case err == nil:
+				rec.State, rec.LastError = JobSucceeded, ""
+			case errors.Is(err, asynq.SkipRetry) || retried >= maxRetry:
+				rec.State, rec.LastError = JobFailed, err.Error()
+			default:
+				rec.State, rec.LastError = JobRetrying, err.Error()
+			}
+		}
+		return err
+	})
+}
+
+// ReportArtifact is a row in the reports table; the bytes live in the BlobStore.
+type ReportArtifact struct {
+	ID          uuid.UUID `json:"id"`
+	ReportDate  string    `json:"report_date"`
+	Format      string    `json:"format"`
+	ContentType string    `json:"content_type"`
+	BlobKey     string    `json:"-"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// --- Blob Storage ---
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalBlobStore keeps blobs as files under dir; keys are slash-separated paths.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+// Put writes via a temp file and rename so readers never see a partial blob.
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
 	}
+	return n, os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// --- Payload Offloading ---
+
+const (
+	defaultPayloadOffloadBytes = 64 << 10
+	payloadBlobPrefix          = "task-payloads/"
+)
+
+// payloadRef stands in for an offloaded payload field.
+type payloadRef struct {
+	Blob string `json:"$blob"`
+	Size int64  `json:"size"`
+}
+
+// PayloadOffloader keeps large values such as image bytes out of Redis. Any
+// top-level field of a JSON payload whose encoding is over threshold bytes
+// is written to the BlobStore and replaced by a payloadRef. Its middleware
+// swaps the values back in before the handler sees the task and deletes the
+// blobs once asynq is done with it, so handlers never know.
+type PayloadOffloader struct {
+	blobs     BlobStore
+	threshold int
+}
+
+func NewPayloadOffloader(blobs BlobStore, threshold int) *PayloadOffloader {
+	return &PayloadOffloader{blobs: blobs, threshold: threshold}
+}
+
+// Offload returns payload with its oversized fields moved to the BlobStore,
+// along with the keys it wrote. Anything that is not a JSON object is left
+// as it is.
+func (o *PayloadOffloader) Offload(ctx context.Context, payload []byte) ([]byte, []string, error) {
+	if len(payload) <= o.threshold {
+		return payload, nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload, nil, nil
+	}
+	var keys []string
+	for name, raw := range fields {
+		if len(raw) <= o.threshold {
+			continue
+		}
+		key := payloadBlobPrefix + uuid.NewString()
+		size, err := o.blobs.Put(ctx, key, bytes.NewReader(raw))
+		if err != nil {
+			o.discard(keys)
+			return nil, nil, fmt.Errorf("offload payload field %q: %w", name, err)
+		}
+		keys = append(keys, key)
+		if fields[name], err = json.Marshal(payloadRef{Blob: key, Size: size}); err != nil {
+			o.discard(keys)
+			return nil, nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return payload, nil, nil
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		o.discard(keys)
+		return nil, nil, err
+	}
+	return out, keys, nil
+}
+
+// Enqueue offloads the payload and enqueues the task. If the enqueue fails
+// nothing will ever read the blobs, so they are deleted straight away.
+func (o *PayloadOffloader) Enqueue(ctx context.Context, client *asynq.Client, taskType string, payload []byte, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	payload, keys, err := o.Offload(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.EnqueueContext(ctx, asynq.NewTask(taskType, payload, opts...))
+	if err != nil {
+		o.discard(keys)
+	}
+	return info, err
+}
+
+// rehydrate puts the offloaded values back into payload. It returns every
+// key the payload references, even when one of them could not be read.
+// Only keys under payloadBlobPrefix are followed, so a payload cannot pull
+// in an unrelated blob such as a report or takeout.
+func (o *PayloadOffloader) rehydrate(ctx context.Context, payload []byte) ([]byte, []string, error) {
+	if !bytes.Contains(payload, []byte(`"$blob"`)) {
+		return payload, nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload, nil, nil
+	}
+	refs := make(map[string]string)
+	var keys []string
+	for name, raw := range fields {
+		var ref payloadRef
+		if json.Unmarshal(raw, &ref) == nil && strings.HasPrefix(ref.Blob, payloadBlobPrefix) {
+			refs[name] = ref.Blob
+			keys = append(keys, ref.Blob)
+		}
+	}
+	if len(refs) == 0 {
+		return payload, nil, nil
+	}
+	for name, key := range refs {
+		rc, err := o.blobs.Get(ctx, key)
+		if err != nil {
+			return nil, keys, fmt.Errorf("load payload field %q: %w", name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, keys, fmt.Errorf("load payload field %q: %w", name, err)
+		}
+		fields[name] = data
+	}
+	out, err := json.Marshal(fields)
+	return out, keys, err
+}
+
+// discard deletes offloaded blobs. It ignores the task's context, which may
+// already be past its deadline when the blobs become orphans.
+func (o *PayloadOffloader) discard(keys []string) {
+	for _, key := range keys {
+		if err := o.blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Could not delete offloaded payload blob %s: %v", key, err)
+		}
+	}
+}
+
+// middleware hands the handler a task with its payload rehydrated. A blob
+// that has gone missing cannot come back, so that fails without retrying.
+func (o *PayloadOffloader) middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		payload, keys, err := o.rehydrate(ctx, t.Payload())
+		if len(keys) == 0 && err == nil {
+			return next.ProcessTask(ctx, t)
+		}
+		if errors.Is(err, ErrBlobNotFound) {
+			err = fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		} else if err == nil {
+			err = next.ProcessTask(ctx, asynq.NewTask(t.Type(), payload))
+		}
+		if taskDone(ctx, err) {
+			o.discard(keys)
+		}
+		return err
+	})
 }
 
 // --- Task Definitions ---
@@ -75,8 +721,20 @@ const (
 	TaskTypeImageResize       = "image:resize"
 	TaskTypeImageWatermark    = "image:watermark"
 	TaskTypeGenerateDailyReport = "report:daily"
+	TaskTypeTakeoutBuild      = "takeout:build"
+	TaskTypeTakeoutCleanup    = "takeout:cleanup"
 )
 
+// TakeoutPayload carries the key derived from the user's passphrase, never
+// the passphrase itself, and only as WrappedKey: sealed under the server's
+// KeyWrapper so a Redis dump alone cannot open the archive. The task is
+// enqueued without retention, so asynq deletes it as soon as it completes.
+type TakeoutPayload struct {
+	ExportID   uuid.UUID `json:"export_id"`
+	Salt       []byte    `json:"salt"`
+	WrappedKey []byte    `json:"wrapped_key"`
+}
+
 type WelcomeEmailPayload struct {
 	UserID uuid.UUID `json:"user_id"`
 }
@@ -86,8 +744,9 @@ type ImageProcessingPayload struct {
 	SourceImage []byte    `json:"source_image"`
 }
 
+// DailyReportPayload.ReportDate is YYYY-MM-DD; empty means yesterday (UTC).
 type DailyReportPayload struct {
-	ReportDate string `json:"report_date"`
+	ReportDate string `json:"report_date,omitempty"`
 }
 
 // --- Job Service (Interface-based for DI) ---
@@ -95,15 +754,18 @@ type DailyReportPayload struct {
 type JobService interface {
 	EnqueueWelcomeEmail(ctx context.Context, userID uuid.UUID) (*asynq.TaskInfo, error)
 	EnqueueImageProcessingPipeline(ctx context.Context, postID uuid.UUID, image []byte) (*asynq.TaskInfo, error)
+	EnqueueTakeout(ctx context.Context, exportID uuid.UUID, salt, key []byte) (*asynq.TaskInfo, error)
 }
 
 type AsynqJobService struct {
-	client *asynq.Client
-	db     *MockDB
+	client    *asynq.Client
+	db        *MockDB
+	offloader *PayloadOffloader
+	wrapper   KeyWrapper
 }
 
-func NewAsynqJobService(client *asynq.Client, db *MockDB) JobService {
-	return &AsynqJobService{client: client, db: db}
+func NewAsynqJobService(client *asynq.Client, db *MockDB, offloader *PayloadOffloader, wrapper KeyWrapper) JobService {
+	return &AsynqJobService{client: client, db: db, offloader: offloader, wrapper: wrapper}
 }
 
 func (s *AsynqJobService) EnqueueWelcomeEmail(ctx context.Context, userID uuid.UUID) (*asynq.TaskInfo, error) {
@@ -120,18 +782,37 @@ func (s *AsynqJobService) EnqueueImageProcessingPipeline(ctx context.Context, po
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal image processing payload: %w", err)
 	}
-	task := asynq.NewTask(TaskTypeImageResize, payload, asynq.MaxRetry(3), asynq.Timeout(5*time.Minute))
+	return s.offloader.Enqueue(ctx, s.client, TaskTypeImageResize, payload, asynq.MaxRetry(3), asynq.Timeout(5*time.Minute))
+}
+
+func (s *AsynqJobService) EnqueueTakeout(ctx context.Context, exportID uuid.UUID, salt, key []byte) (*asynq.TaskInfo, error) {
+	wrapped, err := s.wrapper.Wrap(exportID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap takeout key: %w", err)
+	}
+	payload, err := json.Marshal(TakeoutPayload{ExportID: exportID, Salt: salt, WrappedKey: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal takeout payload: %w", err)
+	}
+	task := asynq.NewTask(TaskTypeTakeoutBuild, payload, asynq.MaxRetry(3), asynq.Timeout(30*time.Minute), asynq.TaskID("takeout:"+exportID.String()))
 	return s.client.EnqueueContext(ctx, task)
 }
 
 // --- Task Handlers (OOP Style) ---
 
 type TaskProcessor struct {
-	db *MockDB
+	db        *MockDB
+	client    *asynq.Client
+	inspector *asynq.Inspector
+	blobs     BlobStore
+	offloader *PayloadOffloader
+	retention time.Duration
+	takeout   TakeoutConfig
+	mailer    Mailer
 }
 
-func NewTaskProcessor(db *MockDB) *TaskProcessor {
-	return &TaskProcessor{db: db}
+func NewTaskProcessor(db *MockDB, client *asynq.Client, inspector *asynq.Inspector, blobs BlobStore, offloader *PayloadOffloader, retention time.Duration, takeout TakeoutConfig) *TaskProcessor {
+	return &TaskProcessor{db: db, client: client, inspector: inspector, blobs: blobs, offloader: offloader, retention: retention, takeout: takeout, mailer: takeout.Mailer}
 }
 
 func (p *TaskProcessor) HandleWelcomeEmailTask(ctx context.Context, t *asynq.Task) error {
@@ -139,8 +820,20 @@ func (p *TaskProcessor) HandleWelcomeEmailTask(ctx context.Context, t *asynq.Tas
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
 	}
+	p.db.mu.RLock()
+	user, ok := p.db.users[payload.UserID]
+	p.db.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("user %s not found: %w", payload.UserID, asynq.SkipRetry)
+	}
 	log.Printf("Sending welcome email to user %s...", payload.UserID)
-	time.Sleep(2 * time.Second) // Simulate email sending
+	err := p.mailer.Send(ctx, user.Email, "Welcome!", "Thanks for signing up.")
+	if errors.Is(err, ErrSuppressed) {
+		log.Printf("Welcome email to user %s skipped: %v", payload.UserID, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
 	log.Printf("Welcome email sent successfully to user %s", payload.UserID)
 	return nil
 }
@@ -154,14 +847,22 @@ func (p *TaskProcessor) HandleImageResizeTask(ctx context.Context, t *asynq.Task
 	time.Sleep(5 * time.Second) // Simulate resizing
 	log.Printf("Image resized for post %s. Enqueuing watermark task.", payload.PostID)
 
-	// Chain the next task in the pipeline
+	// Chain the next task in the pipeline. It gets its own copy of any
+	// offloaded image, since this task's is deleted when it completes.
 	watermarkPayloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal watermark payload: %w", err)
 	}
-	watermarkTask := asynq.NewTask(TaskTypeImageWatermark, watermarkPayloadBytes)
-	_, err = asynq.NewClient(asynq.RedisClientOpt{Addr: redisAddr}).Enqueue(watermarkTask)
-	return err
+	info, err := p.offloader.Enqueue(ctx, p.client, TaskTypeImageWatermark, watermarkPayloadBytes)
+	if err != nil {
+		return err
+	}
+	if id, ok := asynq.GetTaskID(ctx); ok {
+		p.db.mu.Lock()
+		p.db.transferJob(id, info.ID)
+		p.db.mu.Unlock()
+	}
+	return nil
 }
 
 func (p *TaskProcessor) HandleImageWatermarkTask(ctx context.Context, t *asynq.Task) error {
@@ -171,177 +872,2874 @@ func (p *TaskProcessor) HandleImageWatermarkTask(ctx context.Context, t *asynq.T
 	}
 	log.Printf("Adding watermark to image for post %s...", payload.PostID)
 	time.Sleep(3 * time.Second) // Simulate watermarking
+
+	att := Attachment{ID: uuid.New(), PostID: payload.PostID, FileName: "cover.img", CreatedAt: clock.Now().UTC()}
+	att.BlobKey = fmt.Sprintf("attachments/%s/%s.img", payload.PostID, att.ID)
+	size, err := p.blobs.Put(ctx, att.BlobKey, bytes.NewReader(payload.SourceImage))
+	if err != nil {
+		return fmt.Errorf("store processed image: %w", err)
+	}
+	att.SizeBytes = size
+	p.db.mu.Lock()
+	p.db.insertAttachment(att)
+	p.db.mu.Unlock()
 	log.Printf("Image processing pipeline complete for post %s.", payload.PostID)
 	return nil
 }
 
+// HandleDailyReportTask renders the day's statistics as CSV and HTML, stores
+// both through the BlobStore and records them in the reports table. A rerun
+// for the same date replaces that date's earlier artifacts.
 func (p *TaskProcessor) HandleDailyReportTask(ctx context.Context, t *asynq.Task) error {
 	var payload DailyReportPayload
-	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
+	if len(t.Payload()) > 0 {
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
+		}
+	}
+	if payload.ReportDate == "" {
+		payload.ReportDate = clock.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	day, err := time.Parse("2006-01-02", payload.ReportDate)
+	if err != nil {
+		return fmt.Errorf("invalid report date %q: %w", payload.ReportDate, asynq.SkipRetry)
 	}
 	log.Printf("Generating daily report for %s...", payload.ReportDate)
-	time.Sleep(10 * time.Second) // Simulate report generation
-	log.Printf("Daily report for %s generated successfully.", payload.ReportDate)
+
+	stats := p.gatherReportStats(day)
+	rendered := map[string]*bytes.Buffer{}
+	if rendered["csv"], err = renderReportCSV(stats); err != nil {
+		return fmt.Errorf("render csv: %w", err)
+	}
+	if rendered["html"], err = renderReportHTML(stats); err != nil {
+		return fmt.Errorf("render html: %w", err)
+	}
+
+	now := clock.Now().UTC()
+	var created []ReportArtifact
+	for _, format := range []string{"csv", "html"} {
+		artifact := ReportArtifact{
+			ID:          uuid.New(),
+			ReportDate:  payload.ReportDate,
+			Format:      format,
+			ContentType: reportContentTypes[format],
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(p.retention),
+		}
+		artifact.BlobKey = fmt.Sprintf("reports/%s/%s.%s", payload.ReportDate, artifact.ID, format)
+		if artifact.SizeBytes, err = p.blobs.Put(ctx, artifact.BlobKey, rendered[format]); err != nil {
+			for _, a := range created {
+				p.blobs.Delete(ctx, a.BlobKey)
+			}
+			return fmt.Errorf("store %s report: %w", format, err)
+		}
+		created = append(created, artifact)
+	}
+
+	p.db.mu.Lock()
+	var replaced []ReportArtifact
+	for id, a := range p.db.reports {
+		if a.ReportDate == payload.ReportDate {
+			replaced = append(replaced, a)
+			delete(p.db.reports, id)
+		}
+	}
+	for _, a := range created {
+		p.db.reports[a.ID] = a
+	}
+	p.db.mu.Unlock()
+	for _, a := range replaced {
+		if err := p.blobs.Delete(ctx, a.BlobKey); err != nil {
+			log.Printf("Could not delete replaced report blob %s: %v", a.BlobKey, err)
+		}
+	}
+
+	p.pruneExpiredReports(ctx, now)
+	log.Printf("Daily report for %s generated successfully (%d artifacts).", payload.ReportDate, len(created))
 	return nil
 }
 
-// --- API Handlers ---
+var reportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+}
 
-type APIHandler struct {
-	jobService JobService
-	db         *MockDB
-	inspector  *asynq.Inspector
+// reportQueues are the queues whose processed/failed counts go in the report.
+var reportQueues = []string{"critical", "default", "low"}
+
+type QueueDayStats struct {
+	Queue     string
+	Processed int
+	Failed    int
 }
 
-func NewAPIHandler(js JobService, db *MockDB, inspector *asynq.Inspector) *APIHandler {
-	return &APIHandler{jobService: js, db: db, inspector: inspector}
+type ReportStats struct {
+	ReportDate     string
+	GeneratedAt    time.Time
+	TotalUsers     int
+	NewUsers       int
+	ActiveUsers    int
+	TotalPosts     int
+	PostsByStatus  map[PostStatus]int
+	Queues         []QueueDayStats
+	JobsProcessed  int
+	JobsFailed     int
+	QueueStatsNote string
 }
 
-func (h *APIHandler) CreateUser(c echo.Context) error {
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+func (p *TaskProcessor) gatherReportStats(day time.Time) ReportStats {
+	stats := ReportStats{
+		ReportDate:    day.Format("2006-01-02"),
+		GeneratedAt:   clock.Now().UTC(),
+		PostsByStatus: map[PostStatus]int{StatusDraft: 0, StatusPublished: 0},
 	}
+	next := day.AddDate(0, 0, 1)
 
-	newUser := User{
-		ID:           uuid.New(),
-		Email:        req.Email,
-		PasswordHash: "hashed_" + req.Password,
-		Role:         RoleUser,
-		IsActive:     true,
-		CreatedAt:    time.Now(),
+	p.db.mu.RLock()
+	stats.TotalUsers = len(p.db.users)
+	for _, u := range p.db.users {
+		if !u.CreatedAt.Before(day) && u.CreatedAt.Before(next) {
+			stats.NewUsers++
+		}
+		if u.IsActive {
+			stats.ActiveUsers++
+		}
 	}
-	h.db.mu.Lock()
-	h.db.users[newUser.ID] = newUser
-	h.db.mu.Unlock()
-
-	taskInfo, err := h.jobService.EnqueueWelcomeEmail(c.Request().Context(), newUser.ID)
-	if err != nil {
-		log.Printf("Error enqueuing welcome email: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not schedule welcome email"})
+	stats.TotalPosts = len(p.db.posts)
+	for _, post := range p.db.posts {
+		stats.PostsByStatus[post.Status]++
 	}
+	p.db.mu.RUnlock()
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"message": "User created, welcome email scheduled.",
+	// asynq keeps per-day processed/failed counters for a limited window.
+	daysAgo := int(clock.Now().UTC().Sub(day).Hours()/24) + 1
+	for _, q := range reportQueues {
+		history, err := p.inspector.History(q, daysAgo)
+		if err != nil {
+			if !errors.Is(err, asynq.ErrQueueNotFound) {
+				stats.QueueStatsNote = "job statistics are incomplete: " + err.Error()
+			}
+			continue
+		}
+		for _, h := range history {
+			if h.Date.Format("2006-01-02") == stats.ReportDate {
+				stats.Queues = append(stats.Queues, QueueDayStats{Queue: q, Processed: h.Processed, Failed: h.Failed})
+				stats.JobsProcessed += h.Processed
+				stats.JobsFailed += h.Failed
+			}
+		}
+	}
+	return stats
+}
+
+func renderReportCSV(s ReportStats) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	rows := [][]string{
+		{"section", "metric", "value"},
+		{"report", "date", s.ReportDate},
+		{"report", "generated_at", s.GeneratedAt.Format(time.RFC3339)},
+		{"users", "total", strconv.Itoa(s.TotalUsers)},
+		{"users", "new", strconv.Itoa(s.NewUsers)},
+		{"users", "active", strconv.Itoa(s.ActiveUsers)},
+		{"posts", "total", strconv.Itoa(s.TotalPosts)},
+		{"posts", "draft", strconv.Itoa(s.PostsByStatus[StatusDraft])},
+		{"posts", "published", strconv.Itoa(s.PostsByStatus[StatusPublished])},
+		{"jobs", "processed", strconv.Itoa(s.JobsProcessed)},
+		{"jobs", "failed", strconv.Itoa(s.JobsFailed)},
+	}
+	for _, q := range s.Queues {
+		rows = append(rows,
+			[]string{"queue:" + q.Queue, "processed", strconv.Itoa(q.Processed)},
+			[]string{"queue:" + q.Queue, "failed", strconv.Itoa(q.Failed)},
+		)
+	}
+	if s.QueueStatsNote != "" {
+		rows = append(rows, []string{"report", "note", s.QueueStatsNote})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Daily report {{.ReportDate}}</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse;margin-bottom:1.5em}td,th{border:1px solid #ccc;padding:4px 10px;text-align:left}</style>
+</head>
+<body>
+<h1>Daily report for {{.ReportDate}}</h1>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+<h2>Users</h2>
+<table>
+<tr><th>Total</th><td>{{.TotalUsers}}</td></tr>
+<tr><th>New</th><td>{{.NewUsers}}</td></tr>
+<tr><th>Active</th><td>{{.ActiveUsers}}</td></tr>
+</table>
+<h2>Posts</h2>
+<table>
+<tr><th>Total</th><td>{{.TotalPosts}}</td></tr>
+{{range $status, $n := .PostsByStatus}}<tr><th>{{$status}}</th><td>{{$n}}</td></tr>
+{{end}}</table>
+<h2>Jobs</h2>
+<table>
+<tr><th>Queue</th><th>Processed</th><th>Failed</th></tr>
+{{range .Queues}}<tr><td>{{.Queue}}</td><td>{{.Processed}}</td><td>{{.Failed}}</td></tr>
+{{end}}<tr><th>Total</th><th>{{.JobsProcessed}}</th><th>{{.JobsFailed}}</th></tr>
+</table>
+{{with .QueueStatsNote}}<p><em>{{.}}</em></p>{{end}}
+</body>
+</html>
+`))
+
+func renderReportHTML(s ReportStats) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	if err := reportHTMLTemplate.Execute(buf, s); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// pruneExpiredReports drops artifacts past their retention. The row goes
+// first so a failed blob delete leaves an orphan file, never a dangling row.
+func (p *TaskProcessor) pruneExpiredReports(ctx context.Context, now time.Time) {
+	p.db.mu.Lock()
+	var expired []ReportArtifact
+	for id, a := range p.db.reports {
+		if now.After(a.ExpiresAt) {
+			expired = append(expired, a)
+			delete(p.db.reports, id)
+		}
+	}
+	p.db.mu.Unlock()
+	for _, a := range expired {
+		if err := p.blobs.Delete(ctx, a.BlobKey); err != nil {
+			log.Printf("Could not delete expired report blob %s: %v", a.BlobKey, err)
+		}
+	}
+}
+
+// --- Data Takeout ---
+
+type TakeoutStatus string
+
+const (
+	TakeoutQueued   TakeoutStatus = "queued"
+	TakeoutBuilding TakeoutStatus = "building"
+	TakeoutReady    TakeoutStatus = "ready"
+	TakeoutFailed   TakeoutStatus = "failed"
+	TakeoutExpired  TakeoutStatus = "expired"
+)
+
+type TakeoutExport struct {
+	ID          uuid.UUID     `json:"id"`
+	UserID      uuid.UUID     `json:"user_id"`
+	Status      TakeoutStatus `json:"status"`
+	BlobKey     string        `json:"-"`
+	SizeBytes   int64         `json:"size_bytes,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"`
+}
+
+// Mailer delivers user notifications. logMailer stands in for a real
+// provider, like the welcome email does.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("Emailing %s (message %s): %s\n%s", to, messageIDFrom(ctx), subject, body)
+	return nil
+}
+
+type TakeoutConfig struct {
+	TTL     time.Duration
+	BaseURL string
+	Signer  URLSigner
+	Keys    KeyWrapper
+	Mailer  Mailer
+}
+
+// URLSigner makes download links that are valid until exp without a session.
+type URLSigner struct {
+	secret []byte
+}
+
+func (s URLSigner) mac(id uuid.UUID, exp int64) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(m, "%s|%d", id, exp)
+	return m.Sum(nil)
+}
+
+func (s URLSigner) Sign(id uuid.UUID, exp time.Time) string {
+	return base64.RawURLEncoding.EncodeToString(s.mac(id, exp.Unix()))
+}
+
+func (s URLSigner) Verify(id uuid.UUID, exp int64, sig string, now time.Time) bool {
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || now.Unix() > exp {
+		return false
+	}
+	return hmac.Equal(given, s.mac(id, exp))
+}
+
+// KeyWrapper seals takeout keys with a server secret before they are put in
+// a task payload. The export ID is bound in as associated data, so a wrapped
+// key cannot be replayed against another export.
+type KeyWrapper struct {
+	secret []byte
+}
+
+func (w KeyWrapper) aead() (cipher.AEAD, error) {
+	k := sha256.Sum256(w.secret)
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (w KeyWrapper) Wrap(exportID uuid.UUID, key []byte) ([]byte, error) {
+	gcm, err := w.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, key, exportID[:]), nil
+}
+
+func (w KeyWrapper) Unwrap(exportID uuid.UUID, wrapped []byte) ([]byte, error) {
+	gcm, err := w.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	nonce, sealed := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, exportID[:])
+}
+
+// Takeout archives are sealed as: "TKO1" | salt (16) | nonce (12) |
+// AES-256-GCM ciphertext, keyed with scrypt(passphrase, salt). Open one with
+// `TAKEOUT_PASSPHRASE=... go run . decrypt-takeout in.zip.enc out.zip`.
+const takeoutMagic = "TKO1"
+
+func deriveTakeoutKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func sealTakeout(key, salt, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(takeoutMagic), salt...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, header...), nonce...)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+func openTakeout(passphrase string, sealed []byte) ([]byte, error) {
+	const saltLen, nonceLen = 16, 12
+	if len(sealed) < len(takeoutMagic)+saltLen+nonceLen || string(sealed[:len(takeoutMagic)]) != takeoutMagic {
+		return nil, errors.New("not a takeout archive")
+	}
+	header := sealed[:len(takeoutMagic)+saltLen]
+	key, err := deriveTakeoutKey(passphrase, header[len(takeoutMagic):])
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := sealed[len(header) : len(header)+nonceLen]
+	plain, err := gcm.Open(nil, nonce, sealed[len(header)+nonceLen:], header)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted archive")
+	}
+	return plain, nil
+}
+
+func (p *TaskProcessor) setTakeout(id uuid.UUID, update func(*TakeoutExport)) (TakeoutExport, bool) {
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+	exp, ok := p.db.takeouts[id]
+	if ok {
+		update(&exp)
+		p.db.takeouts[id] = exp
+	}
+	return exp, ok
+}
+
+// HandleTakeoutBuildTask gathers everything the user owns into a ZIP,
+// seals it with their passphrase-derived key, stores it and emails a signed
+// download link.
+func (p *TaskProcessor) HandleTakeoutBuildTask(ctx context.Context, t *asynq.Task) error {
+	var payload TakeoutPayload
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
+	}
+	export, ok := p.setTakeout(payload.ExportID, func(e *TakeoutExport) {
+		if e.Status == TakeoutQueued {
+			e.Status = TakeoutBuilding
+		}
+	})
+	if !ok || export.Status != TakeoutBuilding {
+		return nil // unknown or already finished
+	}
+
+	err := p.buildTakeout(ctx, export, payload)
+	if err != nil {
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		if retried >= maxRetry || errors.Is(err, asynq.SkipRetry) {
+			p.setTakeout(export.ID, func(e *TakeoutExport) { e.Status, e.Error = TakeoutFailed, "export could not be built" })
+			p.db.recordAudit(export.UserID, "takeout.failed", err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *TaskProcessor) buildTakeout(ctx context.Context, export TakeoutExport, payload TakeoutPayload) error {
+	p.db.mu.RLock()
+	user, ok := p.db.users[export.UserID]
+	var posts []Post
+	postIDs := make(map[uuid.UUID]bool)
+	for _, post := range p.db.posts {
+		if post.UserID == user.ID {
+			posts = append(posts, post)
+			postIDs[post.ID] = true
+		}
+	}
+	var comments []Comment
+	for _, c := range p.db.comments {
+		if c.UserID == user.ID {
+			comments = append(comments, c)
+		}
+	}
+	var attachments []Attachment
+	for _, a := range p.db.attachments {
+		if postIDs[a.PostID] {
+			attachments = append(attachments, a)
+		}
+	}
+	var audit []AuditEvent
+	for _, ev := range p.db.audit {
+		if ev.UserID == user.ID {
+			audit = append(audit, ev)
+		}
+	}
+	p.db.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("user %s no longer exists: %w", export.UserID, asynq.SkipRetry)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	addJSON := func(name string, v interface{}) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", user},
+		{"posts.json", posts},
+		{"comments.json", comments},
+		{"attachments.json", attachments},
+		{"audit_trail.json", audit},
+	}
+	for _, f := range files {
+		if err := addJSON(f.name, f.v); err != nil {
+			return err
+		}
+	}
+	var missing []uuid.UUID
+	for _, a := range attachments {
+		blob, err := p.blobs.Get(ctx, a.BlobKey)
+		if errors.Is(err, ErrBlobNotFound) {
+			missing = append(missing, a.ID)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read attachment %s: %w", a.ID, err)
+		}
+		w, err := zw.Create(fmt.Sprintf("attachments/%s-%s", a.ID, filepath.Base(a.FileName)))
+		if err == nil {
+			_, err = io.Copy(w, blob)
+		}
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := addJSON("manifest.json", map[string]interface{}{
+		"user_id":             user.ID,
+		"generated_at":        clock.Now().UTC(),
+		"posts":               len(posts),
+		"comments":            len(comments),
+		"attachments":         len(attachments),
+		"missing_attachments": missing,
+		"audit_events":        len(audit),
+	}); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	archiveKey, err := p.takeout.Keys.Unwrap(export.ID, payload.WrappedKey)
+	if err != nil {
+		// Only a different TAKEOUT_KEY_SECRET gets here; retrying cannot help.
+		return fmt.Errorf("unwrap takeout key: %v: %w", err, asynq.SkipRetry)
+	}
+	sealed, err := sealTakeout(archiveKey, payload.Salt, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("seal takeout: %w", err)
+	}
+	key := fmt.Sprintf("takeout/%s/%s.zip.enc", user.ID, export.ID)
+	size, err := p.blobs.Put(ctx, key, bytes.NewReader(sealed))
+	if err != nil {
+		return fmt.Errorf("store takeout: %w", err)
+	}
+
+	now := clock.Now().UTC()
+	expiresAt := now.Add(p.takeout.TTL)
+	p.setTakeout(export.ID, func(e *TakeoutExport) {
+		e.Status, e.BlobKey, e.SizeBytes = TakeoutReady, key, size
+		e.CompletedAt, e.ExpiresAt = &now, &expiresAt
+	})
+	p.db.recordAudit(user.ID, "takeout.ready", export.ID.String())
+
+	link := fmt.Sprintf("%s/users/me/exports/%s/download?exp=%d&sig=%s",
+		p.takeout.BaseURL, export.ID, expiresAt.Unix(), p.takeout.Signer.Sign(export.ID, expiresAt))
+	body := fmt.Sprintf("Your data export is ready and can be downloaded until %s:\n%s\n\nIt is encrypted with the passphrase you chose.",
+		expiresAt.Format(time.RFC1123), link)
+	// The archive is stored; a failed email must not rebuild it.
+	if err := p.takeout.Mailer.Send(ctx, user.Email, "Your data export is ready", body); err != nil {
+		log.Printf("Takeout %s ready but notification failed: %v", export.ID, err)
+	}
+	return nil
+}
+
+// HandleTakeoutCleanupTask deletes archives past their expiry.
+func (p *TaskProcessor) HandleTakeoutCleanupTask(ctx context.Context, t *asynq.Task) error {
+	now := clock.Now()
+	p.db.mu.RLock()
+	var expired []TakeoutExport
+	for _, e := range p.db.takeouts {
+		if e.Status == TakeoutReady && e.ExpiresAt != nil && now.After(*e.ExpiresAt) {
+			expired = append(expired, e)
+		}
+	}
+	p.db.mu.RUnlock()
+	for _, e := range expired {
+		if err := p.blobs.Delete(ctx, e.BlobKey); err != nil {
+			log.Printf("Error deleting expired takeout %s: %v", e.ID, err)
+			continue
+		}
+		p.setTakeout(e.ID, func(x *TakeoutExport) { x.Status, x.BlobKey = TakeoutExpired, "" })
+	}
+	return nil
+}
+
+// --- Email Delivery Status ---
+
+// DeliveryStatus only moves forward: a late "delivered" callback never
+// hides an earlier bounce or complaint.
+type DeliveryStatus string
+
+const (
+	DeliveryQueued     DeliveryStatus = "queued"
+	DeliveryFailed     DeliveryStatus = "failed"
+	DeliverySuppressed DeliveryStatus = "suppressed"
+	DeliverySent       DeliveryStatus = "sent"
+	DeliveryDelivered  DeliveryStatus = "delivered"
+	DeliveryBounced    DeliveryStatus = "bounced"
+	DeliveryComplained DeliveryStatus = "complained"
+)
+
+var deliveryRank = map[DeliveryStatus]int{
+	DeliverySent:       1,
+	DeliveryDelivered:  2,
+	DeliveryBounced:    3,
+	DeliveryComplained: 4,
+}
+
+// EmailNotification is the record of one message handed to the provider.
+// Its ID doubles as the provider message ID that callbacks refer to.
+type EmailNotification struct {
+	MessageID string          `json:"message_id"`
+	UserID    uuid.UUID       `json:"user_id,omitempty"`
+	To        string          `json:"to"`
+	Subject   string          `json:"subject"`
+	Status    DeliveryStatus  `json:"status"`
+	Detail    string          `json:"detail,omitempty"`
+	Events    []DeliveryEvent `json:"events,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type DeliveryEvent struct {
+	MessageID  string    `json:"message_id"`
+	Type       string    `json:"type"`                  // delivered, bounced, complained
+	BounceType string    `json:"bounce_type,omitempty"` // hard or soft
+	Detail     string    `json:"detail,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type Suppression struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	MessageID string    `json:"message_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var ErrSuppressed = errors.New("recipient is on the suppression list")
+
+func normalizeEmail(addr string) string {
+	return strings.ToLower(strings.TrimSpace(addr))
+}
+
+type messageIDKey struct{}
+
+func messageIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey{}).(string)
+	return id
+}
+
+// TrackingMailer records every send as an EmailNotification and refuses
+// suppressed recipients before the provider is called.
+type TrackingMailer struct {
+	db   *MockDB
+	next Mailer
+}
+
+func (m *TrackingMailer) Send(ctx context.Context, to, subject, body string) error {
+	now := clock.Now().UTC()
+	n := &EmailNotification{MessageID: uuid.NewString(), To: to, Subject: subject, Status: DeliveryQueued, CreatedAt: now, UpdatedAt: now}
+	addr := normalizeEmail(to)
+	m.db.mu.Lock()
+	for _, u := range m.db.users {
+		if normalizeEmail(u.Email) == addr {
+			n.UserID = u.ID
+			break
+		}
+	}
+	s, suppressed := m.db.suppressions[addr]
+	if suppressed {
+		n.Status, n.Detail = DeliverySuppressed, s.Reason
+	}
+	m.db.notifications[n.MessageID] = n
+	m.db.mu.Unlock()
+	if suppressed {
+		return fmt.Errorf("%w: %s", ErrSuppressed, to)
+	}
+
+	err := m.next.Send(context.WithValue(ctx, messageIDKey{}, n.MessageID), to, subject, body)
+	m.db.mu.Lock()
+	n.UpdatedAt = clock.Now().UTC()
+	if err != nil {
+		n.Status, n.Detail = DeliveryFailed, err.Error()
+	} else if n.Status == DeliveryQueued { // a fast callback may already have landed
+		n.Status = DeliverySent
+	}
+	m.db.mu.Unlock()
+	return err
+}
+
+// applyDeliveryEvent updates the notification and, for hard bounces and
+// complaints, suppresses the address and flags its user. Redelivered
+// callbacks are recognised and ignored.
+func (db *MockDB) applyDeliveryEvent(ev DeliveryEvent) (result string) {
+	db.mu.Lock()
+	n, ok := db.notifications[ev.MessageID]
+	if !ok {
+		db.mu.Unlock()
+		return "unknown_message"
+	}
+	for _, seen := range n.Events {
+		if seen.Type == ev.Type && seen.BounceType == ev.BounceType && seen.Timestamp.Equal(ev.Timestamp) {
+			db.mu.Unlock()
+			return "duplicate"
+		}
+	}
+	n.Events = append(n.Events, ev)
+	n.UpdatedAt = clock.Now().UTC()
+	if status := DeliveryStatus(ev.Type); deliveryRank[status] > deliveryRank[n.Status] {
+		n.Status, n.Detail = status, ev.Detail
+	}
+
+	var reason string
+	switch {
+	case ev.Type == string(DeliveryComplained):
+		reason = "complaint"
+	case ev.Type == string(DeliveryBounced) && ev.BounceType == "hard":
+		reason = "hard bounce"
+	}
+	addr := normalizeEmail(n.To)
+	if _, already := db.suppressions[addr]; reason == "" || already {
+		db.mu.Unlock()
+		return "applied"
+	}
+	db.suppressions[addr] = Suppression{Email: addr, Reason: reason, MessageID: n.MessageID, CreatedAt: n.UpdatedAt}
+	user, flagged := db.users[n.UserID]
+	if flagged {
+		user.EmailUndeliverable, user.EmailFlagReason = true, reason
+		db.users[user.ID] = user
+	}
+	db.mu.Unlock()
+
+	log.Printf("Suppressed %s after %s on message %s", addr, reason, n.MessageID)
+	if flagged {
+		db.recordAudit(user.ID, "email.suppressed", reason)
+	}
+	return "suppressed"
+}
+
+const emailWebhookTolerance = 5 * time.Minute
+
+// verifyWebhookSignature checks an "X-Email-Signature: t=<unix>,v1=<hex>"
+// header, where v1 is HMAC-SHA256 over "<t>.<body>". Several v1 values may
+// be sent while the provider rotates secrets.
+func verifyWebhookSignature(secret []byte, header string, body []byte, now time.Time) error {
+	var ts int64
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	if ts == 0 || len(sigs) == 0 {
+		return errors.New("malformed signature header")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > emailWebhookTolerance || age < -emailWebhookTolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// emailWebhookHandler receives delivery status callbacks from the email
+// provider. Unknown message IDs are acknowledged so the provider stops
+// retrying them.
+func emailWebhookHandler(db *MockDB) echo.HandlerFunc {
+	secret := []byte(os.Getenv("EMAIL_WEBHOOK_SECRET"))
+	return func(c echo.Context) error {
+		if len(secret) == 0 {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "email webhook not configured"})
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "could not read body"})
+		}
+		if err := verifyWebhookSignature(secret, c.Request().Header.Get("X-Email-Signature"), body, clock.Now()); err != nil {
+			log.Printf("Rejected email webhook: %v", err)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid signature"})
+		}
+		var req struct {
+			Events []DeliveryEvent `json:"events"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+		}
+		results := make([]map[string]string, 0, len(req.Events))
+		for _, ev := range req.Events {
+			result := "ignored"
+			switch DeliveryStatus(ev.Type) {
+			case DeliveryDelivered, DeliveryBounced, DeliveryComplained:
+				result = db.applyDeliveryEvent(ev)
+			}
+			results = append(results, map[string]string{"message_id": ev.MessageID, "result": result})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"results": results})
+	}
+}
+
+// --- Readiness ---
+// Workers must not consume tasks before the things handlers depend on are
+// usable, or the first tasks fail for reasons of their own. A ReadinessGate
+// runs one probe per dependency, retrying with backoff until every probe has
+// passed or the timeout runs out. WorkerSupervisor.Start waits on it and
+// /readyz reports its progress.
+
+const (
+	defaultReadinessTimeout  = 2 * time.Minute
+	defaultReadinessInterval = time.Second
+	maxReadinessInterval     = 15 * time.Second
+	probeAttemptTimeout      = 5 * time.Second
+)
+
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type ReadinessState string
+
+const (
+	ReadinessPending ReadinessState = "pending"
+	ReadinessWaiting ReadinessState = "waiting"
+	ReadinessReady   ReadinessState = "ready"
+	ReadinessFailed  ReadinessState = "failed"
+)
+
+type ProbeStatus struct {
+	Name      string     `json:"name"`
+	Ready     bool       `json:"ready"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+type ReadinessReport struct {
+	State     ReadinessState `json:"state"`
+	Consuming bool           `json:"consuming"`
+	ReadyAt   *time.Time     `json:"ready_at,omitempty"`
+	Probes    []ProbeStatus  `json:"probes"`
+}
+
+// ReadinessConfig bounds the wait. Interval is the first retry delay and
+// doubles up to maxReadinessInterval; zero values take the defaults.
+type ReadinessConfig struct {
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+type ReadinessGate struct {
+	cfg    ReadinessConfig
+	probes []Probe
+
+	mu       sync.Mutex
+	state    ReadinessState
+	statuses []ProbeStatus
+	readyAt  *time.Time
+}
+
+func NewReadinessGate(cfg ReadinessConfig, probes ...Probe) *ReadinessGate {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultReadinessTimeout
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultReadinessInterval
+	}
+	statuses := make([]ProbeStatus, len(probes))
+	for i, p := range probes {
+		statuses[i].Name = p.Name
+	}
+	return &ReadinessGate{cfg: cfg, probes: probes, state: ReadinessPending, statuses: statuses}
+}
+
+// Wait returns once every probe has passed. A probe that passed is not run
+// again, so a later Wait after a timeout only retries what was still failing.
+func (g *ReadinessGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.state == ReadinessReady {
+		g.mu.Unlock()
+		return nil
+	}
+	g.state = ReadinessWaiting
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.Timeout)
+	defer cancel()
+	began := time.Now()
+	delay := g.cfg.Interval
+	for {
+		failing := g.runPending(ctx)
+		if len(failing) == 0 {
+			now := clock.Now()
+			g.mu.Lock()
+			g.state, g.readyAt = ReadinessReady, &now
+			g.mu.Unlock()
+			log.Printf("Readiness: all dependencies ready after %s", time.Since(began).Round(time.Millisecond))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			g.mu.Lock()
+			g.state = ReadinessFailed
+			g.mu.Unlock()
+			return fmt.Errorf("dependencies not ready after %s: %s", time.Since(began).Round(time.Millisecond), strings.Join(failing, "; "))
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReadinessInterval {
+			delay = maxReadinessInterval
+		}
+	}
+}
+
+// runPending runs each probe that has not passed yet and describes those that
+// still fail.
+func (g *ReadinessGate) runPending(ctx context.Context) []string {
+	var failing []string
+	for i, p := range g.probes {
+		g.mu.Lock()
+		done := g.statuses[i].Ready
+		g.mu.Unlock()
+		if done {
+			continue
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, probeAttemptTimeout)
+		err := p.Check(attemptCtx)
+		cancel()
+		now := clock.Now()
+
+		g.mu.Lock()
+		st := &g.statuses[i]
+		st.Attempts++
+		st.CheckedAt = &now
+		st.Ready = err == nil
+		st.LastError = ""
+		if err != nil {
+			st.LastError = err.Error()
+			failing = append(failing, p.Name+": "+err.Error())
+		}
+		attempts := st.Attempts
+		g.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Readiness: %s not ready (attempt %d): %v", p.Name, attempts, err)
+		} else if attempts > 1 {
+			log.Printf("Readiness: %s ready after %d attempts", p.Name, attempts)
+		}
+	}
+	return failing
+}
+
+func (g *ReadinessGate) Report() ReadinessReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return ReadinessReport{
+		State:   g.state,
+		ReadyAt: g.readyAt,
+		Probes:  append([]ProbeStatus(nil), g.statuses...),
+	}
+}
+
+// blobStoreWritable round-trips a small blob through the store.
+func blobStoreWritable(blobs BlobStore) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		key := "readiness/" + uuid.NewString()
+		if _, err := blobs.Put(ctx, key, strings.NewReader("ok")); err != nil {
+			return err
+		}
+		return blobs.Delete(ctx, key)
+	}
+}
+
+// --- Worker Configuration ---
+
+// workerShutdownTimeout must outlast the slowest task timeout (image resize, 5m)
+// so a replaced server finishes its in-flight tasks instead of requeueing them.
+const workerShutdownTimeout = 6 * time.Minute
+
+// requiredQueues are the queues tasks are actually enqueued on; a config that
+// drops one of them would leave its tasks unprocessed.
+var requiredQueues = []string{"default"}
+
+type WorkerConfig struct {
+	Concurrency int            `json:"concurrency"`
+	Queues      map[string]int `json:"queues"`
+}
+
+func defaultWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		Concurrency: 10,
+		Queues: map[string]int{
+			"critical": 6,
+			"default":  3,
+			"low":      1,
+		},
+	}
+}
+
+func (c WorkerConfig) Validate() error {
+	if c.Concurrency < 1 || c.Concurrency > 200 {
+		return errors.New("concurrency must be between 1 and 200")
+	}
+	if len(c.Queues) == 0 {
+		return errors.New("at least one queue is required")
+	}
+	for name, weight := range c.Queues {
+		if name == "" {
+			return errors.New("queue names must not be empty")
+		}
+		if weight < 1 || weight > 100 {
+			return fmt.Errorf("weight for queue %q must be between 1 and 100", name)
+		}
+	}
+	for _, q := range requiredQueues {
+		if _, ok := c.Queues[q]; !ok {
+			return fmt.Errorf("queue %q is required: tasks are enqueued on it", q)
+		}
+	}
+	return nil
+}
+
+// readWorkerConfig reads and validates the persisted config.
+func readWorkerConfig(path string) (WorkerConfig, error) {
+	var cfg WorkerConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadWorkerConfig reads the persisted config, falling back to the defaults
+// when the file is missing or unusable.
+func loadWorkerConfig(path string) WorkerConfig {
+	cfg, err := readWorkerConfig(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultWorkerConfig()
+	}
+	if err != nil {
+		log.Printf("Could not load worker config %s, using defaults: %v", path, err)
+		return defaultWorkerConfig()
+	}
+	return cfg
+}
+
+// saveWorkerConfig writes via a temp file and rename so a crash never leaves
+// a half-written config behind.
+func saveWorkerConfig(path string, cfg WorkerConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".worker_config-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// WorkerSupervisor owns the asynq server and swaps it out when the config
+// changes. asynq servers cannot be reconfigured in place, so Apply starts a
+// fresh server with the new settings and then shuts the old one down in the
+// background; the old server stops fetching immediately and finishes its
+// in-flight tasks (or hands them back to Redis after workerShutdownTimeout).
+type WorkerSupervisor struct {
+	redisOpt  asynq.RedisClientOpt
+	handler   asynq.Handler
+	path      string
+	readiness *ReadinessGate
+
+	mu         sync.Mutex
+	cfg        WorkerConfig
+	paused     map[string]bool // runtime only; not persisted
+	server     *asynq.Server
+	started    bool // Start has passed the readiness gate
+	generation int
+	appliedAt  time.Time
+
+	draining    sync.WaitGroup
+	drainingNum int32
+}
+
+func NewWorkerSupervisor(redisOpt asynq.RedisClientOpt, handler asynq.Handler, path string, readiness *ReadinessGate) *WorkerSupervisor {
+	return &WorkerSupervisor{
+		redisOpt:  redisOpt,
+		handler:   handler,
+		path:      path,
+		readiness: readiness,
+		cfg:       loadWorkerConfig(path),
+		paused:    make(map[string]bool),
+	}
+}
+
+// newServer returns nil when every queue in cfg is paused.
+func (s *WorkerSupervisor) newServer(cfg WorkerConfig) *asynq.Server {
+	queues := make(map[string]int, len(cfg.Queues))
+	for name, weight := range cfg.Queues {
+		if !s.paused[name] {
+			queues[name] = weight
+		}
+	}
+	if len(queues) == 0 {
+		return nil
+	}
+	return asynq.NewServer(
+		s.redisOpt,
+		asynq.Config{
+			Concurrency: cfg.Concurrency,
+			Queues:      queues,
+			// Exponential backoff
+			RetryDelayFunc:  asynq.DefaultRetryDelayFunc,
+			ShutdownTimeout: workerShutdownTimeout,
+		},
+	)
+}
+
+// Start waits for the readiness gate, then begins consuming. Config changes
+// and pauses made while it waits take effect here.
+func (s *WorkerSupervisor) Start(ctx context.Context) error {
+	if err := s.readiness.Wait(ctx); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv := s.newServer(s.cfg)
+	if srv != nil {
+		if err := srv.Start(s.handler); err != nil {
+			return err
+		}
+	}
+	s.server = srv
+	s.started = true
+	s.generation = 1
+	s.appliedAt = clock.Now()
+	log.Printf("Worker started: concurrency=%d queues=%v paused=%v", s.cfg.Concurrency, s.cfg.Queues, s.pausedQueues())
+	return nil
+}
+
+// Apply validates and persists cfg, then rebalances onto a new server.
+func (s *WorkerSupervisor) Apply(cfg WorkerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prevCfg := s.cfg
+	if err := saveWorkerConfig(s.path, cfg); err != nil {
+		return fmt.Errorf("persisting worker config: %w", err)
+	}
+	if err := s.restart(cfg); err != nil {
+		if rerr := saveWorkerConfig(s.path, prevCfg); rerr != nil {
+			log.Printf("Could not restore previous worker config: %v", rerr)
+		}
+		return fmt.Errorf("starting worker with new config: %w", err)
+	}
+	return nil
+}
+
+// SetPaused stops or resumes fetching from one queue on this instance only.
+// Tasks stay in Redis for other instances, or for this one once resumed.
+func (s *WorkerSupervisor) SetPaused(queue string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cfg.Queues[queue]; !ok {
+		return fmt.Errorf("queue %q is not configured", queue)
+	}
+	if s.paused[queue] == paused {
+		return nil
+	}
+	s.paused[queue] = paused
+	if err := s.restart(s.cfg); err != nil {
+		s.paused[queue] = !paused
+		return err
+	}
+	return nil
+}
+
+// restart moves onto a new server for cfg and drains the previous one.
+// Before Start it only records cfg. Callers hold s.mu.
+func (s *WorkerSupervisor) restart(cfg WorkerConfig) error {
+	if !s.started {
+		s.cfg = cfg
+		return nil
+	}
+	next := s.newServer(cfg)
+	if next != nil {
+		if err := next.Start(s.handler); err != nil {
+			return err
+		}
+	}
+
+	prev := s.server
+	s.server = next
+	s.cfg = cfg
+	s.generation++
+	s.appliedAt = clock.Now()
+	if next == nil {
+		log.Printf("Worker generation %d idle: every queue is paused", s.generation)
+	} else {
+		log.Printf("Worker generation %d started: concurrency=%d queues=%v paused=%v", s.generation, cfg.Concurrency, cfg.Queues, s.pausedQueues())
+	}
+
+	if prev != nil {
+		s.draining.Add(1)
+		atomic.AddInt32(&s.drainingNum, 1)
+		go func(gen int) {
+			defer s.draining.Done()
+			defer atomic.AddInt32(&s.drainingNum, -1)
+			prev.Shutdown()
+			log.Printf("Worker generation %d drained", gen)
+		}(s.generation - 1)
+	}
+	return nil
+}
+
+func (s *WorkerSupervisor) pausedQueues() []string {
+	queues := []string{}
+	for name, paused := range s.paused {
+		if paused {
+			queues = append(queues, name)
+		}
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+func (s *WorkerSupervisor) Status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]interface{}{
+		"config":           s.cfg,
+		"paused_queues":    s.pausedQueues(),
+		"generation":       s.generation,
+		"applied_at":       s.appliedAt,
+		"draining_servers": atomic.LoadInt32(&s.drainingNum),
+		"consuming":        s.started,
+	}
+}
+
+// Readiness is the gate's report plus whether consumption has begun.
+func (s *WorkerSupervisor) Readiness() ReadinessReport {
+	report := s.readiness.Report()
+	s.mu.Lock()
+	report.Consuming = s.started
+	s.mu.Unlock()
+	return report
+}
+
+func (s *WorkerSupervisor) Config() WorkerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// Shutdown stops the current server and waits for any servers still draining.
+func (s *WorkerSupervisor) Shutdown() {
+	s.mu.Lock()
+	if s.server != nil {
+		s.server.Shutdown()
+		s.server = nil
+	}
+	s.mu.Unlock()
+	s.draining.Wait()
+}
+
+// --- Worker Control Channel ---
+// Every instance subscribes to workerControlChannel. An admin publishes a
+// ControlCommand there and each instance applies it to its own supervisor,
+// then publishes a ControlAck on the command's ack channel.
+
+const workerControlChannel = "workers:control"
+
+const (
+	ControlSetConcurrency = "set_concurrency"
+	ControlPauseQueue     = "pause_queue"
+	ControlResumeQueue    = "resume_queue"
+	ControlReload         = "reload"
+	ControlStatus         = "status"
+)
+
+type ControlCommand struct {
+	ID          string `json:"id"`
+	Action      string `json:"action"`
+	Concurrency int    `json:"concurrency,omitempty"`
+	Queue       string `json:"queue,omitempty"`
+}
+
+type ControlAck struct {
+	CommandID string                 `json:"command_id"`
+	Worker    string                 `json:"worker"`
+	OK        bool                   `json:"ok"`
+	Error     string                 `json:"error,omitempty"`
+	Status    map[string]interface{} `json:"status"`
+}
+
+func controlAckChannel(commandID string) string {
+	return workerControlChannel + ":acks:" + commandID
+}
+
+// Handle applies one control command to this instance.
+func (s *WorkerSupervisor) Handle(cmd ControlCommand) error {
+	switch cmd.Action {
+	case ControlSetConcurrency:
+		cfg := s.Config()
+		cfg.Concurrency = cmd.Concurrency
+		return s.Apply(cfg)
+	case ControlPauseQueue:
+		return s.SetPaused(cmd.Queue, true)
+	case ControlResumeQueue:
+		return s.SetPaused(cmd.Queue, false)
+	case ControlReload:
+		// Unlike startup, a reload never falls back to the defaults.
+		cfg, err := readWorkerConfig(s.path)
+		if err != nil {
+			return fmt.Errorf("reload: %w", err)
+		}
+		return s.Apply(cfg)
+	case ControlStatus:
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q", cmd.Action)
+	}
+}
+
+type WorkerControl struct {
+	rdb      *redis.Client
+	workers  *WorkerSupervisor
+	workerID string
+}
+
+// workerInstanceID names this instance in acks: WORKER_ID, else host:pid.
+func workerInstanceID() string {
+	if id := os.Getenv("WORKER_ID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Run handles commands until ctx is cancelled.
+func (wc *WorkerControl) Run(ctx context.Context) {
+	sub := wc.rdb.Subscribe(ctx, workerControlChannel)
+	defer sub.Close()
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			var cmd ControlCommand
+			if err := json.Unmarshal([]byte(msg.Payload), &cmd); err != nil || cmd.ID == "" {
+				log.Printf("Ignoring malformed control command: %q", msg.Payload)
+				continue
+			}
+			ack := ControlAck{CommandID: cmd.ID, Worker: wc.workerID, OK: true}
+			if err := wc.workers.Handle(cmd); err != nil {
+				log.Printf("Control command %s (%s) failed: %v", cmd.ID, cmd.Action, err)
+				ack.OK, ack.Error = false, err.Error()
+			}
+			ack.Status = wc.workers.Status()
+			data, _ := json.Marshal(ack)
+			if err := wc.rdb.Publish(ctx, controlAckChannel(cmd.ID), data).Err(); err != nil {
+				log.Printf("Could not acknowledge control command %s: %v", cmd.ID, err)
+			}
+		}
+	}
+}
+
+// --- API Handlers ---
+
+type APIHandler struct {
+	jobService JobService
+	db         *MockDB
+	inspector  *asynq.Inspector
+	workers    *WorkerSupervisor
+	blobs      BlobStore
+	signer     URLSigner
+	rdb        *redis.Client
+}
+
+func NewAPIHandler(js JobService, db *MockDB, inspector *asynq.Inspector, workers *WorkerSupervisor, blobs BlobStore, signer URLSigner, rdb *redis.Client) *APIHandler {
+	return &APIHandler{jobService: js, db: db, inspector: inspector, workers: workers, blobs: blobs, signer: signer, rdb: rdb}
+}
+
+// authenticate returns the active user with this email and password.
+func (db *MockDB) authenticate(email, password string) (User, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, u := range db.users {
+		if u.IsActive && strings.EqualFold(u.Email, email) &&
+			subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte("hashed_"+password)) == 1 {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// requireUser admits HTTP Basic credentials (email and password) of an
+// active user and puts that user in the context as "user".
+func (h *APIHandler) requireUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "api",
+		Validator: func(email, password string, c echo.Context) (bool, error) {
+			user, ok := h.db.authenticate(email, password)
+			if ok {
+				c.Set("user", user)
+			}
+			return ok, nil
+		},
+	})(next)
+}
+
+const minTakeoutPassphrase = 12
+
+// RequestTakeout starts an export of the caller's data. Only one export per
+// user may be in progress at a time.
+func (h *APIHandler) RequestTakeout(c echo.Context) error {
+	user := c.Get("user").(User)
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if len(req.Passphrase) < minTakeoutPassphrase {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("passphrase must be at least %d characters", minTakeoutPassphrase)})
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not start export"})
+	}
+	key, err := deriveTakeoutKey(req.Passphrase, salt)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not start export"})
+	}
+
+	export := TakeoutExport{ID: uuid.New(), UserID: user.ID, Status: TakeoutQueued, CreatedAt: clock.Now().UTC()}
+	h.db.mu.Lock()
+	for _, e := range h.db.takeouts {
+		if e.UserID == user.ID && (e.Status == TakeoutQueued || e.Status == TakeoutBuilding) {
+			h.db.mu.Unlock()
+			return c.JSON(http.StatusConflict, map[string]interface{}{"error": "an export is already in progress", "export": e})
+		}
+	}
+	h.db.takeouts[export.ID] = export
+	h.db.mu.Unlock()
+
+	info, err := h.jobService.EnqueueTakeout(c.Request().Context(), export.ID, salt, key)
+	if err != nil {
+		log.Printf("Error enqueuing takeout: %v", err)
+		h.db.mu.Lock()
+		delete(h.db.takeouts, export.ID)
+		h.db.mu.Unlock()
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not start export"})
+	}
+	h.db.mu.Lock()
+	h.db.trackJob(info.ID, user.ID)
+	h.db.recordJob(info, user.ID)
+	h.db.mu.Unlock()
+	h.db.recordAudit(user.ID, "takeout.requested", export.ID.String())
+	return c.JSON(http.StatusAccepted, export)
+}
+
+func (h *APIHandler) GetTakeout(c echo.Context) error {
+	user := c.Get("user").(User)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid export ID"})
+	}
+	h.db.mu.RLock()
+	export, ok := h.db.takeouts[id]
+	h.db.mu.RUnlock()
+	if !ok || export.UserID != user.ID {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found"})
+	}
+	return c.JSON(http.StatusOK, export)
+}
+
+// DownloadTakeout serves the sealed archive to anyone holding a valid signed
+// link; the passphrase is what protects the contents.
+func (h *APIHandler) DownloadTakeout(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid export ID"})
+	}
+	exp, _ := strconv.ParseInt(c.QueryParam("exp"), 10, 64)
+	if !h.signer.Verify(id, exp, c.QueryParam("sig"), clock.Now()) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "link is invalid or has expired"})
+	}
+	h.db.mu.RLock()
+	export, ok := h.db.takeouts[id]
+	h.db.mu.RUnlock()
+	if !ok || export.Status != TakeoutReady {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found"})
+	}
+
+	blob, err := h.blobs.Get(c.Request().Context(), export.BlobKey)
+	if errors.Is(err, ErrBlobNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "export not found"})
+	}
+	if err != nil {
+		log.Printf("Error reading takeout blob %s: %v", export.BlobKey, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not read export"})
+	}
+	defer blob.Close()
+	h.db.recordAudit(export.UserID, "takeout.downloaded", c.RealIP())
+
+	filename := fmt.Sprintf("takeout-%s.zip.enc", export.CreatedAt.Format("2006-01-02"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(export.SizeBytes, 10))
+	return c.Stream(http.StatusOK, "application/octet-stream", blob)
+}
+
+// enforceQuota checks that user can take on the requested amount of each
+// resource and reports current usage in X-Quota-* headers. When a limit
+// would be exceeded it writes the error response and returns false: 429 for
+// pending jobs, which free up on their own, and 402 otherwise.
+func (h *APIHandler) enforceQuota(c echo.Context, user User, requested map[QuotaResource]int64) (bool, error) {
+	h.db.mu.RLock()
+	limits := h.db.quotaFor(user)
+	usage := *h.db.usageOf(user.ID)
+	h.db.mu.RUnlock()
+
+	header := c.Response().Header()
+	var exceeded []QuotaResource
+	for r, amount := range requested {
+		limit, used := limits.limit(r), usage.used(r)
+		header.Set("X-Quota-"+quotaHeaderNames[r]+"-Used", strconv.FormatInt(used, 10))
+		if limit > 0 {
+			header.Set("X-Quota-"+quotaHeaderNames[r]+"-Limit", strconv.FormatInt(limit, 10))
+			if used+amount > limit {
+				exceeded = append(exceeded, r)
+			}
+		}
+	}
+	if len(exceeded) == 0 {
+		return true, nil
+	}
+	sort.Slice(exceeded, func(i, j int) bool { return exceeded[i] < exceeded[j] })
+	status := http.StatusPaymentRequired
+	for _, r := range exceeded {
+		if r == QuotaPendingJobs {
+			status = http.StatusTooManyRequests
+		}
+	}
+	return false, c.JSON(status, map[string]interface{}{
+		"error":    "quota exceeded",
+		"exceeded": exceeded,
+		"limits":   limits,
+		"usage":    usage,
+	})
+}
+
+// quotaMiddleware reserves one unit of each resource for the request. It
+// must run after requireUser.
+func (h *APIHandler) quotaMiddleware(resources ...QuotaResource) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			requested := make(map[QuotaResource]int64, len(resources))
+			for _, r := range resources {
+				requested[r] = 1
+			}
+			if ok, err := h.enforceQuota(c, c.Get("user").(User), requested); !ok {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// CreatePost creates a draft post owned by the caller.
+func (h *APIHandler) CreatePost(c echo.Context) error {
+	user := c.Get("user").(User)
+	var req struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}
+	if err := c.Bind(&req); err != nil || req.Title == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "title is required"})
+	}
+	post := Post{ID: uuid.New(), UserID: user.ID, Title: req.Title, Content: req.Content, Status: StatusDraft}
+	h.db.mu.Lock()
+	h.db.insertPost(post)
+	h.db.mu.Unlock()
+	return c.JSON(http.StatusCreated, post)
+}
+
+type quotaView struct {
+	UserID   uuid.UUID    `json:"user_id"`
+	Limits   QuotaLimits  `json:"limits"`
+	Override *QuotaLimits `json:"override,omitempty"`
+	Usage    QuotaUsage   `json:"usage"`
+}
+
+func (h *APIHandler) quotaViewOf(c echo.Context) (quotaView, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return quotaView{}, false
+	}
+	h.db.mu.RLock()
+	defer h.db.mu.RUnlock()
+	user, ok := h.db.users[id]
+	if !ok {
+		return quotaView{}, false
+	}
+	view := quotaView{UserID: id, Limits: h.db.quotaFor(user), Usage: *h.db.usageOf(id)}
+	if o, ok := h.db.quotaOverrides[id]; ok {
+		view.Override = &o
+	}
+	return view, true
+}
+
+func (h *APIHandler) GetUserQuota(c echo.Context) error {
+	view, ok := h.quotaViewOf(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+// SetUserQuota replaces the user's role limits with the given ones; fields
+// left out are taken from the current effective limits.
+func (h *APIHandler) SetUserQuota(c echo.Context) error {
+	view, ok := h.quotaViewOf(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	override := view.Limits
+	if err := c.Bind(&override); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if override.MaxPosts < 0 || override.MaxAttachmentBytes < 0 || override.MaxPendingJobs < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "limits must not be negative"})
+	}
+	h.db.mu.Lock()
+	h.db.quotaOverrides[view.UserID] = override
+	h.db.mu.Unlock()
+	h.db.recordAudit(view.UserID, "quota.overridden", fmt.Sprintf("%+v", override))
+	view, _ = h.quotaViewOf(c)
+	return c.JSON(http.StatusOK, view)
+}
+
+// ClearUserQuota drops the override so the user's role limits apply again.
+func (h *APIHandler) ClearUserQuota(c echo.Context) error {
+	view, ok := h.quotaViewOf(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	h.db.mu.Lock()
+	delete(h.db.quotaOverrides, view.UserID)
+	h.db.mu.Unlock()
+	h.db.recordAudit(view.UserID, "quota.override_cleared", "")
+	view, _ = h.quotaViewOf(c)
+	return c.JSON(http.StatusOK, view)
+}
+
+// ListNotifications shows the caller's emails with their delivery status.
+func (h *APIHandler) ListNotifications(c echo.Context) error {
+	user := c.Get("user").(User)
+	h.db.mu.RLock()
+	out := make([]EmailNotification, 0)
+	for _, n := range h.db.notifications {
+		if n.UserID == user.ID {
+			copied := *n
+			copied.Events = append([]DeliveryEvent(nil), n.Events...)
+			out = append(out, copied)
+		}
+	}
+	h.db.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return c.JSON(http.StatusOK, out)
+}
+
+func (h *APIHandler) ListSuppressions(c echo.Context) error {
+	h.db.mu.RLock()
+	out := make([]Suppression, 0, len(h.db.suppressions))
+	for _, s := range h.db.suppressions {
+		out = append(out, s)
+	}
+	h.db.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Email < out[j].Email })
+	return c.JSON(http.StatusOK, out)
+}
+
+// RemoveSuppression lets mail flow to an address again, e.g. after the
+// user fixed their mailbox, and clears the flag on any user with it.
+func (h *APIHandler) RemoveSuppression(c echo.Context) error {
+	addr := normalizeEmail(c.Param("email"))
+	h.db.mu.Lock()
+	if _, ok := h.db.suppressions[addr]; !ok {
+		h.db.mu.Unlock()
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "address is not suppressed"})
+	}
+	delete(h.db.suppressions, addr)
+	var cleared []uuid.UUID
+	for id, u := range h.db.users {
+		if normalizeEmail(u.Email) == addr && u.EmailUndeliverable {
+			u.EmailUndeliverable, u.EmailFlagReason = false, ""
+			h.db.users[id] = u
+			cleared = append(cleared, id)
+		}
+	}
+	h.db.mu.Unlock()
+	for _, id := range cleared {
+		h.db.recordAudit(id, "email.unsuppressed", addr)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func adminTokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	token := os.Getenv("ADMIN_TOKEN")
+	return func(c echo.Context) error {
+		given := c.Request().Header.Get("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+		return next(c)
+	}
+}
+
+// Readyz answers 200 once the worker is consuming and 503 until then, with
+// the probe statuses in both cases.
+func (h *APIHandler) Readyz(c echo.Context) error {
+	report := h.workers.Readiness()
+	if !report.Consuming {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *APIHandler) GetWorkerConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.workers.Status())
+}
+
+// UpdateWorkerConfig applies new queue weights and/or concurrency. Omitted
+// fields keep their current values.
+func (h *APIHandler) UpdateWorkerConfig(c echo.Context) error {
+	var req WorkerConfig
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	current := h.workers.Config()
+	if req.Concurrency == 0 {
+		req.Concurrency = current.Concurrency
+	}
+	if req.Queues == nil {
+		req.Queues = current.Queues
+	}
+	if err := req.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := h.workers.Apply(req); err != nil {
+		log.Printf("Error applying worker config: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not apply worker config"})
+	}
+	return c.JSON(http.StatusOK, h.workers.Status())
+}
+
+const defaultControlAckTimeout = 3 * time.Second
+
+// PublishWorkerCommand broadcasts a control command to every worker instance
+// and collects their acks until all subscribers have answered or ?timeout=
+// (default 3s) passes.
+func (h *APIHandler) PublishWorkerCommand(c echo.Context) error {
+	var cmd ControlCommand
+	if err := c.Bind(&cmd); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	switch cmd.Action {
+	case ControlSetConcurrency:
+		if cmd.Concurrency < 1 || cmd.Concurrency > 200 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "concurrency must be between 1 and 200"})
+		}
+	case ControlPauseQueue, ControlResumeQueue:
+		if cmd.Queue == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "queue is required"})
+		}
+	case ControlReload, ControlStatus:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown action"})
+	}
+	timeout := defaultControlAckTimeout
+	if v := c.QueryParam("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > 30*time.Second {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "timeout must be a duration up to 30s"})
+		}
+		timeout = d
+	}
+	cmd.ID = uuid.NewString()
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	defer cancel()
+	// Subscribe before publishing so no ack can arrive unheard.
+	sub := h.rdb.Subscribe(ctx, controlAckChannel(cmd.ID))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Printf("Error subscribing for control acks: %v", err)
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "control channel unavailable"})
+	}
+	data, _ := json.Marshal(cmd)
+	receivers, err := h.rdb.Publish(ctx, workerControlChannel, data).Result()
+	if err != nil {
+		log.Printf("Error publishing control command: %v", err)
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "control channel unavailable"})
+	}
+
+	acks := []ControlAck{}
+	msgs := sub.Channel()
+collect:
+	for int64(len(acks)) < receivers {
+		select {
+		case msg := <-msgs:
+			var ack ControlAck
+			if json.Unmarshal([]byte(msg.Payload), &ack) == nil {
+				acks = append(acks, ack)
+			}
+		case <-ctx.Done():
+			break collect
+		}
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].Worker < acks[j].Worker })
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"command":   cmd,
+		"receivers": receivers,
+		"complete":  int64(len(acks)) == receivers,
+		"acks":      acks,
+	})
+}
+
+func (h *APIHandler) CreateUser(c echo.Context) error {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	newUser := User{
+		ID:           uuid.New(),
+		Email:        req.Email,
+		PasswordHash: "hashed_" + req.Password,
+		Role:         RoleUser,
+		IsActive:     true,
+		CreatedAt:    clock.Now(),
+	}
+	h.db.mu.Lock()
+	h.db.users[newUser.ID] = newUser
+	h.db.mu.Unlock()
+	h.db.recordAudit(newUser.ID, "user.created", newUser.Email)
+
+	taskInfo, err := h.jobService.EnqueueWelcomeEmail(c.Request().Context(), newUser.ID)
+	if err != nil {
+		log.Printf("Error enqueuing welcome email: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not schedule welcome email"})
+	}
+	h.db.mu.Lock()
+	h.db.recordJob(taskInfo, newUser.ID)
+	h.db.mu.Unlock()
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "User created, welcome email scheduled.",
 		"user":    newUser,
 		"task_id": taskInfo.ID,
 	})
 }
 
-func (h *APIHandler) PublishPost(c echo.Context) error {
-	postID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid post ID"})
+func (h *APIHandler) PublishPost(c echo.Context) error {
+	postID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid post ID"})
+	}
+
+	// In a real app, you'd get the post from the DB and an image from the request body
+	mockImage := []byte("dummy-image-data")
+
+	// Posts we know of are charged to their author.
+	h.db.mu.RLock()
+	post, known := h.db.posts[postID]
+	author, hasAuthor := h.db.users[post.UserID]
+	h.db.mu.RUnlock()
+	if known && hasAuthor {
+		requested := map[QuotaResource]int64{QuotaAttachmentBytes: int64(len(mockImage)), QuotaPendingJobs: 1}
+		if ok, err := h.enforceQuota(c, author, requested); !ok {
+			return err
+		}
+	}
+
+	taskInfo, err := h.jobService.EnqueueImageProcessingPipeline(c.Request().Context(), postID, mockImage)
+	if err != nil {
+		log.Printf("Error enqueuing image processing: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not start image processing"})
+	}
+	if known && hasAuthor {
+		h.db.mu.Lock()
+		h.db.trackJob(taskInfo.ID, author.ID)
+		h.db.recordJob(taskInfo, author.ID)
+		h.db.mu.Unlock()
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message": "Image processing pipeline started.",
+		"task_id": taskInfo.ID,
+	})
+}
+
+func (h *APIHandler) GetJobStatus(c echo.Context) error {
+	taskID := c.Param("id")
+	queue := c.QueryParam("queue")
+	if queue == "" {
+		queue = "default"
+	}
+
+	taskInfo, err := h.inspector.GetTaskInfo(queue, taskID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	}
+
+	return c.JSON(http.StatusOK, taskInfo)
+}
+
+const (
+	defaultJobPageSize = 20
+	maxJobPageSize     = 100
+)
+
+func encodeJobCursor(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(seq, 10)))
+}
+
+func decodeJobCursor(cursor string) (uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(raw), 10, 64)
+}
+
+// ListUserJobs pages through the jobs a user triggered, newest first. Users
+// see only their own jobs; admins may list anyone's. ?state= takes a
+// comma-separated list, ?type= a task type, and ?cursor= the next_cursor of
+// the previous page.
+func (h *APIHandler) ListUserJobs(c echo.Context) error {
+	caller := c.Get("user").(User)
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user ID"})
+	}
+	if userID != caller.ID && caller.Role != RoleAdmin {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "forbidden"})
+	}
+
+	limit := defaultJobPageSize
+	if v := c.QueryParam("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxJobPageSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxJobPageSize)})
+		}
+	}
+	var before uint64
+	if v := c.QueryParam("cursor"); v != "" {
+		if before, err = decodeJobCursor(v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		}
+	}
+	states := make(map[JobState]bool)
+	for _, s := range strings.Split(c.QueryParam("state"), ",") {
+		switch st := JobState(strings.TrimSpace(s)); st {
+		case "":
+		case JobQueued, JobRunning, JobRetrying, JobSucceeded, JobFailed:
+			states[st] = true
+		default:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown state " + string(st)})
+		}
+	}
+	taskType := c.QueryParam("type")
+
+	h.db.mu.RLock()
+	var page []JobRecord
+	for _, rec := range h.db.jobs {
+		if rec.UserID != userID || (before != 0 && rec.seq >= before) {
+			continue
+		}
+		if (len(states) > 0 && !states[rec.State]) || (taskType != "" && rec.Type != taskType) {
+			continue
+		}
+		page = append(page, *rec)
 	}
+	h.db.mu.RUnlock()
 
-	// In a real app, you'd get the post from the DB and an image from the request body
-	mockImage := []byte("dummy-image-data")
-	taskInfo, err := h.jobService.EnqueueImageProcessingPipeline(c.Request().Context(), postID, mockImage)
-	if err != nil {
-		log.Printf("Error enqueuing image processing: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not start image processing"})
+	sort.Slice(page, func(i, j int) bool { return page[i].seq > page[j].seq })
+	resp := map[string]interface{}{}
+	if len(page) > limit {
+		page = page[:limit]
+		resp["next_cursor"] = encodeJobCursor(page[limit-1].seq)
 	}
+	if page == nil {
+		page = []JobRecord{}
+	}
+	resp["jobs"] = page
+	return c.JSON(http.StatusOK, resp)
+}
 
-	return c.JSON(http.StatusAccepted, map[string]interface{}{
-		"message": "Image processing pipeline started.",
-		"task_id": taskInfo.ID,
+// ListReports returns report artifacts, newest first. ?date= narrows to one day.
+func (h *APIHandler) ListReports(c echo.Context) error {
+	date := c.QueryParam("date")
+	now := clock.Now()
+	h.db.mu.RLock()
+	reports := make([]ReportArtifact, 0, len(h.db.reports))
+	for _, a := range h.db.reports {
+		if (date == "" || a.ReportDate == date) && now.Before(a.ExpiresAt) {
+			reports = append(reports, a)
+		}
+	}
+	h.db.mu.RUnlock()
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].ReportDate != reports[j].ReportDate {
+			return reports[i].ReportDate > reports[j].ReportDate
+		}
+		return reports[i].Format < reports[j].Format
 	})
+	return c.JSON(http.StatusOK, map[string]interface{}{"reports": reports})
 }
 
-func (h *APIHandler) GetJobStatus(c echo.Context) error {
-	taskID := c.Param("id")
-	queue := c.QueryParam("queue")
-	if queue == "" {
-		queue = "default"
+func (h *APIHandler) DownloadReport(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid report ID"})
+	}
+	h.db.mu.RLock()
+	artifact, ok := h.db.reports[id]
+	h.db.mu.RUnlock()
+	if !ok || clock.Now().After(artifact.ExpiresAt) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "report not found"})
 	}
 
-	taskInfo, err := h.inspector.GetTaskInfo(queue, taskID)
+	blob, err := h.blobs.Get(c.Request().Context(), artifact.BlobKey)
+	if errors.Is(err, ErrBlobNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "report not found"})
+	}
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+		log.Printf("Error reading report blob %s: %v", artifact.BlobKey, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "could not read report"})
 	}
+	defer blob.Close()
 
-	return c.JSON(http.StatusOK, taskInfo)
+	filename := fmt.Sprintf("daily-report-%s.%s", artifact.ReportDate, artifact.Format)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(artifact.SizeBytes, 10))
+	return c.Stream(http.StatusOK, artifact.ContentType, blob)
 }
 
-// --- Main Application ---
+// --- Application Wiring ---
 
-func main() {
-	// --- Dependencies ---
+// PeriodicTask is a cron spec and the task type it enqueues with no payload.
+type PeriodicTask struct {
+	Spec     string
+	TaskType string
+}
+
+// periodicTasks are registered with the asynq scheduler in production and
+// fired off the fake clock by the e2e scenarios.
+var periodicTasks = []PeriodicTask{
+	// No date in the payload: each run reports on the previous UTC day.
+	// Every minute for demonstration. In production, this would be "0 0 * * *" for daily.
+	{Spec: "@every 1m", TaskType: TaskTypeGenerateDailyReport},
+	{Spec: "@every 1h", TaskType: TaskTypeTakeoutCleanup},
+}
+
+// AppConfig is everything NewApp needs from the environment. Takeout.Mailer
+// is the provider; NewApp wraps it in a TrackingMailer.
+type AppConfig struct {
+	RedisAddr        string
+	ReportDir        string
+	ReportRetention  time.Duration
+	WorkerConfigPath string
+	QuotaLimits      map[UserRole]QuotaLimits
+	Takeout          TakeoutConfig
+	Readiness        ReadinessConfig
+
+	// PayloadOffloadBytes is the size above which a payload field is kept in
+	// the BlobStore instead of Redis; zero means defaultPayloadOffloadBytes.
+	PayloadOffloadBytes int
+}
+
+// App is the HTTP API and the worker pool, wired to one Redis and one MockDB.
+type App struct {
+	DB        *MockDB
+	Echo      *echo.Echo
+	Client    *asynq.Client
+	Inspector *asynq.Inspector
+	Redis     *redis.Client
+	Workers   *WorkerSupervisor
+	Payloads  *PayloadOffloader
+	Scheduler *asynq.Scheduler // nil until StartScheduler
+
+	redisOpt asynq.RedisClientOpt
+	control  *WorkerControl
+}
+
+func NewApp(cfg AppConfig) (*App, error) {
+	blobs, err := NewLocalBlobStore(cfg.ReportDir)
+	if err != nil {
+		return nil, fmt.Errorf("open report blob store: %w", err)
+	}
 	db := NewMockDB()
-	redisOpt := asynq.RedisClientOpt{Addr: redisAddr}
+	if cfg.QuotaLimits != nil {
+		db.quotaLimits = cfg.QuotaLimits
+	}
+	redisOpt := asynq.RedisClientOpt{Addr: cfg.RedisAddr}
 	asynqClient := asynq.NewClient(redisOpt)
-	defer asynqClient.Close()
 	asynqInspector := asynq.NewInspector(redisOpt)
 
-	jobService := NewAsynqJobService(asynqClient, db)
-	apiHandler := NewAPIHandler(jobService, db, asynqInspector)
+	takeoutCfg := cfg.Takeout
+	takeoutCfg.Mailer = &TrackingMailer{db: db, next: cfg.Takeout.Mailer}
+	offloadBytes := cfg.PayloadOffloadBytes
+	if offloadBytes == 0 {
+		offloadBytes = defaultPayloadOffloadBytes
+	}
+	offloader := NewPayloadOffloader(blobs, offloadBytes)
+	taskProcessor := NewTaskProcessor(db, asynqClient, asynqInspector, blobs, offloader, cfg.ReportRetention, takeoutCfg)
+	mux := asynq.NewServeMux()
+	mux.Use(db.releaseJobsMiddleware)
+	mux.Use(db.jobRecordsMiddleware)
+	mux.Use(offloader.middleware)
+	mux.HandleFunc(TaskTypeWelcomeEmail, taskProcessor.HandleWelcomeEmailTask)
+	mux.HandleFunc(TaskTypeImageResize, taskProcessor.HandleImageResizeTask)
+	mux.HandleFunc(TaskTypeImageWatermark, taskProcessor.HandleImageWatermarkTask)
+	mux.HandleFunc(TaskTypeGenerateDailyReport, taskProcessor.HandleDailyReportTask)
+	mux.HandleFunc(TaskTypeTakeoutBuild, taskProcessor.HandleTakeoutBuildTask)
+	mux.HandleFunc(TaskTypeTakeoutCleanup, taskProcessor.HandleTakeoutCleanupTask)
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+	readiness := NewReadinessGate(cfg.Readiness,
+		// MockDB is built fully shaped in memory, so there is nothing to
+		// migrate; a SQL store would compare its schema version here.
+		Probe{Name: "db", Check: func(ctx context.Context) error { return nil }},
+		Probe{Name: "redis", Check: func(ctx context.Context) error { return rdb.Ping(ctx).Err() }},
+		Probe{Name: "blobs", Check: blobStoreWritable(blobs)},
+	)
+	workers := NewWorkerSupervisor(redisOpt, mux, cfg.WorkerConfigPath, readiness)
 
-	// --- Echo Server ---
+	control := &WorkerControl{rdb: rdb, workers: workers, workerID: workerInstanceID()}
+
+	jobService := NewAsynqJobService(asynqClient, db, offloader, takeoutCfg.Keys)
+	apiHandler := NewAPIHandler(jobService, db, asynqInspector, workers, blobs, takeoutCfg.Signer, rdb)
+
+	return &App{
+		DB:        db,
+		Echo:      newRouter(apiHandler, db),
+		Client:    asynqClient,
+		Inspector: asynqInspector,
+		Redis:     rdb,
+		Workers:   workers,
+		Payloads:  offloader,
+		redisOpt:  redisOpt,
+		control:   control,
+	}, nil
+}
+
+func newRouter(apiHandler *APIHandler, db *MockDB) *echo.Echo {
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
+	e.GET("/readyz", apiHandler.Readyz)
 	e.POST("/users", apiHandler.CreateUser)
+	e.POST("/posts", apiHandler.CreatePost, apiHandler.requireUser, apiHandler.quotaMiddleware(QuotaPosts))
 	e.POST("/posts/:id/publish", apiHandler.PublishPost)
 	e.GET("/jobs/:id", apiHandler.GetJobStatus)
+	e.GET("/api/users/:id/jobs", apiHandler.ListUserJobs, apiHandler.requireUser)
+	// Signed by the email provider rather than authenticated.
+	e.POST("/webhooks/email", emailWebhookHandler(db))
 
-	// --- Asynq Worker Server ---
-	asynqServer := asynq.NewServer(
-		redisOpt,
-		asynq.Config{
-			Concurrency: 10,
-			Queues: map[string]int{
-				"critical": 6,
-				"default":  3,
-				"low":      1,
-			},
-			// Exponential backoff
-			RetryDelayFunc: asynq.DefaultRetryDelayFunc,
+	me := e.Group("/users/me")
+	me.POST("/export", apiHandler.RequestTakeout, apiHandler.requireUser, apiHandler.quotaMiddleware(QuotaPendingJobs))
+	me.GET("/exports/:id", apiHandler.GetTakeout, apiHandler.requireUser)
+	me.GET("/notifications", apiHandler.ListNotifications, apiHandler.requireUser)
+	// Reached from the emailed link, so authorised by its signature instead.
+	me.GET("/exports/:id/download", apiHandler.DownloadTakeout)
+
+	admin := e.Group("/admin", adminTokenMiddleware)
+	admin.GET("/worker-config", apiHandler.GetWorkerConfig)
+	admin.PUT("/worker-config", apiHandler.UpdateWorkerConfig)
+	admin.POST("/workers/commands", apiHandler.PublishWorkerCommand)
+	admin.GET("/users/:id/quota", apiHandler.GetUserQuota)
+	admin.PUT("/users/:id/quota", apiHandler.SetUserQuota)
+	admin.DELETE("/users/:id/quota", apiHandler.ClearUserQuota)
+	admin.GET("/email/suppressions", apiHandler.ListSuppressions)
+	admin.DELETE("/email/suppressions/:email", apiHandler.RemoveSuppression)
+
+	reports := e.Group("/api/reports", adminTokenMiddleware)
+	reports.GET("", apiHandler.ListReports)
+	reports.GET("/:id/download", apiHandler.DownloadReport)
+	return e
+}
+
+// StartWorkers waits for readiness, starts the asynq server and subscribes to
+// the control channel until ctx is cancelled.
+func (a *App) StartWorkers(ctx context.Context) error {
+	if err := a.Workers.Start(ctx); err != nil {
+		return err
+	}
+	go a.control.Run(ctx)
+	return nil
+}
+
+// StartScheduler registers periodicTasks with an asynq scheduler, which runs
+// off the wall clock.
+func (a *App) StartScheduler() error {
+	scheduler := asynq.NewScheduler(a.redisOpt, nil)
+	for _, pt := range periodicTasks {
+		if _, err := scheduler.Register(pt.Spec, asynq.NewTask(pt.TaskType, nil)); err != nil {
+			return fmt.Errorf("register %s: %w", pt.TaskType, err)
+		}
+	}
+	if err := scheduler.Start(); err != nil {
+		return err
+	}
+	a.Scheduler = scheduler
+	return nil
+}
+
+// Close stops the scheduler and the workers, letting in-flight tasks finish,
+// then closes the Redis connections. The HTTP server is the caller's to stop.
+func (a *App) Close() {
+	if a.Scheduler != nil {
+		a.Scheduler.Shutdown()
+	}
+	a.Workers.Shutdown()
+	a.Inspector.Close()
+	a.Client.Close()
+	a.Redis.Close()
+}
+
+// --- End-to-End Scenarios ---
+// Run with: go run . e2e -test.v
+//
+// Each scenario boots a full App against its own miniredis, with the package
+// clock swapped for a FakeClock. The app keeps its tables in MockDB rather
+// than SQL, so a fresh MockDB per scenario is the in-memory database. The
+// periodic tasks are fired by Advance instead of the asynq scheduler, whose
+// cron runs on the wall clock.
+
+var scenarioEpoch = time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+const (
+	scenarioAdminToken = "e2e-admin-token"
+	scenarioPassword   = "e2e-password"
+	scenarioTimeout    = 10 * time.Second
+	scenarioPoll       = 25 * time.Millisecond
+)
+
+type scheduledTask struct {
+	task     PeriodicTask
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// Scenario is a booted App and the handles a test drives it through.
+type Scenario struct {
+	t        *testing.T
+	App      *App
+	Redis    *miniredis.Miniredis
+	Clock    *FakeClock
+	Server   *httptest.Server
+	periodic []scheduledTask
+}
+
+func NewScenario(t *testing.T) *Scenario {
+	t.Helper()
+	t.Setenv("ADMIN_TOKEN", scenarioAdminToken)
+	mr := miniredis.RunT(t)
+	fake := NewFakeClock(scenarioEpoch)
+	prev := clock
+	clock = fake
+	t.Cleanup(func() { clock = prev })
+
+	dir := t.TempDir()
+	app, err := NewApp(AppConfig{
+		RedisAddr:        mr.Addr(),
+		ReportDir:        filepath.Join(dir, "reports"),
+		ReportRetention:  30 * 24 * time.Hour,
+		WorkerConfigPath: filepath.Join(dir, "worker_config.json"),
+		Takeout: TakeoutConfig{
+			TTL:     7 * 24 * time.Hour,
+			BaseURL: "http://e2e.invalid",
+			Signer:  URLSigner{secret: []byte("e2e-takeout-secret")},
+			Keys:    KeyWrapper{secret: []byte("e2e-takeout-key-secret")},
+			Mailer:  logMailer{},
 		},
-	)
+	})
+	if err != nil {
+		t.Fatalf("boot app: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := app.StartWorkers(ctx); err != nil {
+		cancel()
+		t.Fatalf("start workers: %v", err)
+	}
+	srv := httptest.NewServer(app.Echo)
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		app.Close()
+	})
 
-	taskProcessor := NewTaskProcessor(db)
-	mux := asynq.NewServeMux()
-	mux.HandleFunc(TaskTypeWelcomeEmail, taskProcessor.HandleWelcomeEmailTask)
-	mux.HandleFunc(TaskTypeImageResize, taskProcessor.HandleImageResizeTask)
-	mux.HandleFunc(TaskTypeImageWatermark, taskProcessor.HandleImageWatermarkTask)
-	mux.HandleFunc(TaskTypeGenerateDailyReport, taskProcessor.HandleDailyReportTask)
+	s := &Scenario{t: t, App: app, Redis: mr, Clock: fake, Server: srv}
+	for _, pt := range periodicTasks {
+		schedule, err := cron.ParseStandard(pt.Spec)
+		if err != nil {
+			t.Fatalf("periodic task %s: %v", pt.TaskType, err)
+		}
+		s.periodic = append(s.periodic, scheduledTask{task: pt, schedule: schedule, next: schedule.Next(fake.Now())})
+	}
+	return s
+}
 
-	// --- Asynq Scheduler for Periodic Tasks ---
-	scheduler := asynq.NewScheduler(redisOpt, nil)
-	reportPayload, _ := json.Marshal(DailyReportPayload{ReportDate: time.Now().Format("2006-01-02")})
-	// Schedule to run every minute for demonstration. In production, this would be "0 0 * * *" for daily.
-	_, err := scheduler.Register("@every 1m", asynq.NewTask(TaskTypeGenerateDailyReport, reportPayload))
+// Do sends a request to the app, JSON-encoding body when it is not nil, and
+// returns the status code and response body.
+func (s *Scenario) Do(method, path string, header http.Header, body interface{}) (int, []byte) {
+	s.t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.Server.URL+path, r)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	resp, err := s.Server.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("could not register scheduler task: %v", err)
+		s.t.Fatalf("%s %s: read body: %v", method, path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// DoJSON is Do for a JSON response, which it decodes into out.
+func (s *Scenario) DoJSON(method, path string, header http.Header, body, out interface{}) int {
+	s.t.Helper()
+	code, data := s.Do(method, path, header, body)
+	if err := json.Unmarshal(data, out); err != nil {
+		s.t.Fatalf("%s %s: decode %q: %v", method, path, data, err)
 	}
+	return code
+}
 
-	// --- Graceful Shutdown ---
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+// asUser signs in as u, which must have been registered with scenarioPassword.
+func (s *Scenario) asUser(u User) http.Header {
+	creds := base64.StdEncoding.EncodeToString([]byte(u.Email + ":" + scenarioPassword))
+	return http.Header{echo.HeaderAuthorization: {"Basic " + creds}}
+}
 
-	go func() {
-		if err := scheduler.Run(); err != nil {
-			log.Fatalf("could not run scheduler: %v", err)
+func (s *Scenario) asAdmin() http.Header {
+	return http.Header{"X-Admin-Token": {scenarioAdminToken}}
+}
+
+// RegisterUser signs up through POST /users and returns the new user and the
+// ID of its welcome email task.
+func (s *Scenario) RegisterUser(email string) (User, string) {
+	s.t.Helper()
+	var resp struct {
+		User   User   `json:"user"`
+		TaskID string `json:"task_id"`
+	}
+	req := map[string]string{"email": email, "password": scenarioPassword}
+	if code := s.DoJSON(http.MethodPost, "/users", nil, req, &resp); code != http.StatusCreated {
+		s.t.Fatalf("register %s: status %d", email, code)
+	}
+	return resp.User, resp.TaskID
+}
+
+// AddAdmin stores an active ADMIN user directly; there is no API for
+// creating one.
+func (s *Scenario) AddAdmin(email string) User {
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: "hashed_" + scenarioPassword, Role: RoleAdmin, IsActive: true, CreatedAt: s.Clock.Now()}
+	s.App.DB.mu.Lock()
+	s.App.DB.users[admin.ID] = admin
+	s.App.DB.mu.Unlock()
+	return admin
+}
+
+// Enqueue puts a task straight onto the queue, bypassing the API.
+func (s *Scenario) Enqueue(taskType string, payload interface{}, opts ...asynq.Option) *asynq.TaskInfo {
+	s.t.Helper()
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			s.t.Fatal(err)
 		}
-	}()
+	}
+	info, err := s.App.Client.Enqueue(asynq.NewTask(taskType, data), opts...)
+	if err != nil {
+		s.t.Fatalf("enqueue %s: %v", taskType, err)
+	}
+	return info
+}
 
-	go func() {
-		if err := asynqServer.Run(mux); err != nil {
-			log.Fatalf("could not run asynq server: %v", err)
+// Advance moves the clock and miniredis's TTLs forward by d, then enqueues
+// every periodic task that came due and returns their infos. A task that
+// missed several ticks fires once, at the new time.
+func (s *Scenario) Advance(d time.Duration) []*asynq.TaskInfo {
+	s.t.Helper()
+	s.Clock.Advance(d)
+	s.Redis.FastForward(d)
+	now := s.Clock.Now()
+	var fired []*asynq.TaskInfo
+	for i := range s.periodic {
+		p := &s.periodic[i]
+		if p.next.After(now) {
+			continue
 		}
-	}()
+		fired = append(fired, s.Enqueue(p.task.TaskType, nil))
+		p.next = p.schedule.Next(now)
+	}
+	return fired
+}
+
+// AwaitTask waits for a task to complete. Tasks are enqueued without
+// retention, so asynq deleting the task is how completion shows.
+func (s *Scenario) AwaitTask(info *asynq.TaskInfo) {
+	s.t.Helper()
+	deadline := time.Now().Add(scenarioTimeout)
+	for {
+		ti, err := s.App.Inspector.GetTaskInfo(info.Queue, info.ID)
+		switch {
+		case errors.Is(err, asynq.ErrTaskNotFound):
+			return
+		case err != nil:
+			s.t.Fatalf("task %s (%s): %v", info.ID, info.Type, err)
+		case ti.State == asynq.TaskStateCompleted:
+			return
+		case ti.State == asynq.TaskStateArchived:
+			s.t.Fatalf("task %s (%s) archived: %s", info.ID, info.Type, ti.LastErr)
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("task %s (%s) still %s after %s; last error %q", info.ID, info.Type, ti.State, scenarioTimeout, ti.LastErr)
+		}
+		time.Sleep(scenarioPoll)
+	}
+}
+
+// AwaitJobState polls the owner's job history endpoint until the job reaches
+// want, failing early if it settles in a different final state.
+func (s *Scenario) AwaitJobState(owner User, taskID string, want JobState) JobRecord {
+	s.t.Helper()
+	deadline := time.Now().Add(scenarioTimeout)
+	path := "/api/users/" + owner.ID.String() + "/jobs"
+	for {
+		var resp struct {
+			Jobs []JobRecord `json:"jobs"`
+		}
+		if code := s.DoJSON(http.MethodGet, path, s.asUser(owner), nil, &resp); code != http.StatusOK {
+			s.t.Fatalf("GET %s: status %d", path, code)
+		}
+		var rec *JobRecord
+		for i := range resp.Jobs {
+			if resp.Jobs[i].ID == taskID {
+				rec = &resp.Jobs[i]
+			}
+		}
+		switch {
+		case rec == nil:
+			s.t.Fatalf("job %s is not in %s's history", taskID, owner.Email)
+		case rec.State == want:
+			return *rec
+		case rec.State == JobSucceeded || rec.State == JobFailed:
+			s.t.Fatalf("job %s ended %s (%q), want %s", taskID, rec.State, rec.LastError, want)
+		case time.Now().After(deadline):
+			s.t.Fatalf("job %s still %s after %s, want %s", taskID, rec.State, scenarioTimeout, want)
+		}
+		time.Sleep(scenarioPoll)
+	}
+}
+
+// Audit returns the audit events recorded for action, oldest first.
+func (s *Scenario) Audit(action string) []AuditEvent {
+	s.App.DB.mu.RLock()
+	defer s.App.DB.mu.RUnlock()
+	var events []AuditEvent
+	for _, ev := range s.App.DB.audit {
+		if ev.Action == action {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// Emails returns the notifications sent to addr, oldest first.
+func (s *Scenario) Emails(addr string) []EmailNotification {
+	s.App.DB.mu.RLock()
+	defer s.App.DB.mu.RUnlock()
+	var sent []EmailNotification
+	for _, n := range s.App.DB.notifications {
+		if normalizeEmail(n.To) == normalizeEmail(addr) {
+			sent = append(sent, *n)
+		}
+	}
+	sort.Slice(sent, func(i, j int) bool { return sent[i].CreatedAt.Before(sent[j].CreatedAt) })
+	return sent
+}
+
+// Report downloads the CSV daily report for date through the reports API and
+// returns its values keyed "section.metric".
+func (s *Scenario) Report(date string) map[string]string {
+	s.t.Helper()
+	var list struct {
+		Reports []ReportArtifact `json:"reports"`
+	}
+	if code := s.DoJSON(http.MethodGet, "/api/reports?date="+date, s.asAdmin(), nil, &list); code != http.StatusOK {
+		s.t.Fatalf("list reports for %s: status %d", date, code)
+	}
+	for _, a := range list.Reports {
+		if a.Format != "csv" {
+			continue
+		}
+		code, data := s.Do(http.MethodGet, "/api/reports/"+a.ID.String()+"/download", s.asAdmin(), nil)
+		if code != http.StatusOK {
+			s.t.Fatalf("download report %s: status %d", a.ID, code)
+		}
+		rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			s.t.Fatalf("parse report %s: %v", a.ID, err)
+		}
+		values := make(map[string]string, len(rows))
+		for _, row := range rows[1:] {
+			values[row[0]+"."+row[1]] = row[2]
+		}
+		return values
+	}
+	s.t.Fatalf("no csv report for %s", date)
+	return nil
+}
+
+// advanceDay moves a day forward and waits for everything that fired,
+// returning the daily report task.
+func (s *Scenario) advanceDay() *asynq.TaskInfo {
+	s.t.Helper()
+	var report *asynq.TaskInfo
+	for _, info := range s.Advance(24 * time.Hour) {
+		s.AwaitTask(info)
+		if info.Type == TaskTypeGenerateDailyReport {
+			report = info
+		}
+	}
+	if report == nil {
+		s.t.Fatal("a day passed without the daily report firing")
+	}
+	return report
+}
+
+func scenarioSignupToDailyReport(t *testing.T) {
+	s := NewScenario(t)
+	user, taskID := s.RegisterUser("ada@example.com")
+	if got := s.Audit("user.created"); len(got) != 1 || got[0].UserID != user.ID {
+		t.Fatalf("user.created audit events = %+v, want one for %s", got, user.ID)
+	}
+
+	rec := s.AwaitJobState(user, taskID, JobSucceeded)
+	if rec.Type != TaskTypeWelcomeEmail || rec.Attempts != 1 {
+		t.Fatalf("welcome job = %+v, want one %s attempt", rec, TaskTypeWelcomeEmail)
+	}
+	emails := s.Emails(user.Email)
+	if len(emails) != 1 {
+		t.Fatalf("sent %d emails to %s, want 1", len(emails), user.Email)
+	}
+	if e := emails[0]; e.Subject != "Welcome!" || e.Status != DeliverySent || e.UserID != user.ID {
+		t.Fatalf("welcome email = %+v", e)
+	}
+
+	signupDay := s.Clock.Now().Format("2006-01-02")
+	s.advanceDay()
+	report := s.Report(signupDay)
+	if report["report.date"] != signupDay || report["users.new"] != "1" || report["users.total"] != "1" {
+		t.Fatalf("report for %s = %v, want one new user", signupDay, report)
+	}
+}
+
+func scenarioReportCountsOnlyItsDay(t *testing.T) {
+	s := NewScenario(t)
+	first, _ := s.RegisterUser("first@example.com")
+	firstDay := s.Clock.Now().Format("2006-01-02")
+	s.advanceDay()
+	second, taskID := s.RegisterUser("second@example.com")
+	s.AwaitJobState(second, taskID, JobSucceeded)
+	secondDay := s.Clock.Now().Format("2006-01-02")
+	s.advanceDay()
+
+	if r := s.Report(firstDay); r["users.new"] != "1" || r["users.total"] != "1" {
+		t.Fatalf("report for %s = %v, want only %s", firstDay, r, first.Email)
+	}
+	if r := s.Report(secondDay); r["users.new"] != "1" || r["users.total"] != "2" {
+		t.Fatalf("report for %s = %v, want %s new of 2", secondDay, r, second.Email)
+	}
+}
+
+// scenarioJobHistoryIsPrivate checks who may read a user's job history: the
+// user and admins, as proven by their credentials. Another signed-in user is
+// forbidden, and bad credentials are not a user at all.
+func scenarioJobHistoryIsPrivate(t *testing.T) {
+	s := NewScenario(t)
+	owner, _ := s.RegisterUser("owner@example.com")
+	other, _ := s.RegisterUser("other@example.com")
+	admin := s.AddAdmin("admin@example.com")
+	path := "/api/users/" + owner.ID.String() + "/jobs"
+
+	wrongPassword := http.Header{echo.HeaderAuthorization: {"Basic " + base64.StdEncoding.EncodeToString([]byte(admin.Email+":guess"))}}
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"admin with wrong password", wrongPassword, http.StatusUnauthorized},
+		{"other user", s.asUser(other), http.StatusForbidden},
+		{"owner", s.asUser(owner), http.StatusOK},
+		{"admin", s.asUser(admin), http.StatusOK},
+	} {
+		if code, body := s.Do(http.MethodGet, path, tc.header, nil); code != tc.want {
+			t.Errorf("%s: GET %s = %d %s, want %d", tc.name, path, code, body, tc.want)
+		}
+	}
+}
+
+// scenarioOversizedPayloadOffloaded sends an image over the offload threshold
+// through the watermark step: Redis only holds a reference, the handler still
+// stores the whole image, and the offloaded blob is gone once it is done.
+func scenarioOversizedPayloadOffloaded(t *testing.T) {
+	s := NewScenario(t)
+	image := bytes.Repeat([]byte{0xAB}, 2*defaultPayloadOffloadBytes)
+	postID := uuid.New()
+	payload, err := json.Marshal(ImageProcessingPayload{PostID: postID, SourceImage: image})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.App.Payloads.Enqueue(context.Background(), s.App.Client, TaskTypeImageWatermark, payload)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	var queued struct {
+		SourceImage payloadRef `json:"source_image"`
+	}
+	if err := json.Unmarshal(info.Payload, &queued); err != nil || queued.SourceImage.Blob == "" {
+		t.Fatalf("queued payload %q does not reference a blob", info.Payload)
+	}
+	if len(info.Payload) >= defaultPayloadOffloadBytes {
+		t.Fatalf("queued payload is %d bytes, want it offloaded", len(info.Payload))
+	}
+
+	s.AwaitTask(info)
+	var stored []Attachment
+	s.App.DB.mu.RLock()
+	for _, a := range s.App.DB.attachments {
+		if a.PostID == postID {
+			stored = append(stored, a)
+		}
+	}
+	s.App.DB.mu.RUnlock()
+	if len(stored) != 1 || stored[0].SizeBytes != int64(len(image)) {
+		t.Fatalf("attachments for post = %+v, want one of %d bytes", stored, len(image))
+	}
+	if _, err := s.App.Payloads.blobs.Get(context.Background(), queued.SourceImage.Blob); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("offloaded blob %s after completion: err = %v, want ErrBlobNotFound", queued.SourceImage.Blob, err)
+	}
+}
+
+func runScenarios(args []string) {
+	os.Args = append([]string{os.Args[0]}, args...)
+	testing.Init()
+	testing.Main(regexp.MatchString, []testing.InternalTest{
+		{Name: "SignupToDailyReport", F: scenarioSignupToDailyReport},
+		{Name: "ReportCountsOnlyItsDay", F: scenarioReportCountsOnlyItsDay},
+		{Name: "OversizedPayloadOffloaded", F: scenarioOversizedPayloadOffloaded},
+		{Name: "JobHistoryIsPrivate", F: scenarioJobHistoryIsPrivate},
+	}, nil, nil)
+}
+
+// --- Main Application ---
+
+// decryptTakeout implements the decrypt-takeout subcommand.
+func decryptTakeout(in, out string) error {
+	passphrase := os.Getenv("TAKEOUT_PASSPHRASE")
+	if passphrase == "" {
+		return errors.New("set TAKEOUT_PASSPHRASE")
+	}
+	sealed, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	plain, err := openTakeout(passphrase, sealed)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, plain, 0o600)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "e2e" {
+		runScenarios(os.Args[2:])
+		return
+	}
+	if len(os.Args) == 4 && os.Args[1] == "decrypt-takeout" {
+		if err := decryptTakeout(os.Args[2], os.Args[3]); err != nil {
+			log.Fatalf("decrypt-takeout: %v", err)
+		}
+		return
+	}
+
+	// --- Configuration ---
+	cfg := AppConfig{RedisAddr: redisAddr}
+	var err error
+	cfg.QuotaLimits, err = loadQuotaLimits()
+	if err != nil {
+		log.Fatalf("invalid quota limits: %v", err)
+	}
+
+	cfg.ReportDir = os.Getenv("REPORT_ARTIFACT_DIR")
+	if cfg.ReportDir == "" {
+		cfg.ReportDir = "report_artifacts"
+	}
+	retentionDays := 30
+	if v := os.Getenv("REPORT_RETENTION_DAYS"); v != "" {
+		if retentionDays, err = strconv.Atoi(v); err != nil || retentionDays < 1 {
+			log.Fatalf("REPORT_RETENTION_DAYS must be a positive integer, got %q", v)
+		}
+	}
+	cfg.ReportRetention = time.Duration(retentionDays) * 24 * time.Hour
+	if v := os.Getenv("TASK_PAYLOAD_OFFLOAD_BYTES"); v != "" {
+		if cfg.PayloadOffloadBytes, err = strconv.Atoi(v); err != nil || cfg.PayloadOffloadBytes < 1 {
+			log.Fatalf("TASK_PAYLOAD_OFFLOAD_BYTES must be a positive integer, got %q", v)
+		}
+	}
+
+	takeoutCfg := TakeoutConfig{TTL: 7 * 24 * time.Hour, BaseURL: os.Getenv("PUBLIC_BASE_URL"), Mailer: logMailer{}}
+	if takeoutCfg.BaseURL == "" {
+		takeoutCfg.BaseURL = "http://localhost:8080"
+	}
+	if v := os.Getenv("TAKEOUT_TTL_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours < 1 {
+			log.Fatalf("TAKEOUT_TTL_HOURS must be a positive integer, got %q", v)
+		}
+		takeoutCfg.TTL = time.Duration(hours) * time.Hour
+	}
+	if secret := os.Getenv("TAKEOUT_URL_SECRET"); secret != "" {
+		takeoutCfg.Signer = URLSigner{secret: []byte(secret)}
+	} else {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("could not generate takeout URL secret: %v", err)
+		}
+		takeoutCfg.Signer = URLSigner{secret: secret}
+		log.Println("TAKEOUT_URL_SECRET not set; download links will not survive a restart")
+	}
+	if secret := os.Getenv("TAKEOUT_KEY_SECRET"); secret != "" {
+		takeoutCfg.Keys = KeyWrapper{secret: []byte(secret)}
+	} else {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("could not generate takeout key secret: %v", err)
+		}
+		takeoutCfg.Keys = KeyWrapper{secret: secret}
+		log.Println("TAKEOUT_KEY_SECRET not set; takeouts queued before a restart, or on another process, will fail")
+	}
+	cfg.Takeout = takeoutCfg
+
+	cfg.WorkerConfigPath = os.Getenv("WORKER_CONFIG_PATH")
+	if cfg.WorkerConfigPath == "" {
+		cfg.WorkerConfigPath = "worker_config.json"
+	}
+	if v := os.Getenv("READINESS_TIMEOUT"); v != "" {
+		if cfg.Readiness.Timeout, err = time.ParseDuration(v); err != nil || cfg.Readiness.Timeout <= 0 {
+			log.Fatalf("READINESS_TIMEOUT must be a positive duration, got %q", v)
+		}
+	}
+	if v := os.Getenv("READINESS_RETRY_INTERVAL"); v != "" {
+		if cfg.Readiness.Interval, err = time.ParseDuration(v); err != nil || cfg.Readiness.Interval <= 0 {
+			log.Fatalf("READINESS_RETRY_INTERVAL must be a positive duration, got %q", v)
+		}
+	}
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		log.Fatalf("could not build application: %v", err)
+	}
 
+	// --- Graceful Shutdown ---
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// --- Echo Server ---
+	// Up first so /readyz can report while the workers wait on dependencies.
+	e := app.Echo
 	go func() {
 		if err := e.Start(":8080"); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
 		}
 	}()
 
+	// --- Asynq Worker Server and Scheduler ---
+	if err := app.StartWorkers(ctx); err != nil {
+		log.Fatalf("could not start asynq server: %v", err)
+	}
+	if err := app.StartScheduler(); err != nil {
+		log.Fatalf("could not run scheduler: %v", err)
+	}
+
 	<-ctx.Done()
 	log.Println("Shutting down...")
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -349,7 +3747,6 @@ func main() {
 	if err := e.Shutdown(shutdownCtx); err != nil {
 		e.Logger.Fatal(err)
 	}
-	scheduler.Shutdown()
-	asynqServer.Shutdown()
+	app.Close()
 	log.Println("Shutdown complete.")
 }
\ No newline at end of file
@@ -1,13 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
+	"io/fs"
 	"log"
+	"math"
+	"math/rand"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -16,6 +33,7 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
 )
 
 // This code requires a running Redis instance.
@@ -58,6 +76,8 @@ type Post struct {
 var (
 	asynqClient    *asynq.Client
 	asynqInspector *asynq.Inspector
+	redisClient    *redis.Client
+	retryAdvisor   *RetryAdvisor
 	mockUsers      = make(map[uuid.UUID]User)
 	mockPosts      = make(map[uuid.UUID]Post)
 	dbMutex        = &sync.RWMutex{}
@@ -70,6 +90,7 @@ const (
 	TypeImageProcess   = "image:process_pipeline"
 	TypeImageWatermark = "image:add_watermark"
 	TypeReportDaily    = "system:generate_report"
+	TypeStuckWatchdog  = "system:stuck_task_watchdog"
 )
 
 type EmailPayload struct {
@@ -80,6 +101,904 @@ type ImagePayload struct {
 	PostID uuid.UUID `json:"post_id"`
 }
 
+// --- Maintenance Mode ---
+
+// The flag lives in Redis so every API instance and worker sees the same state.
+// It is written with a TTL, so a forgotten maintenance window ends on its own.
+const (
+	maintenanceKey          = "maintenance:mode"
+	defaultMaintenanceTTL   = 30 * time.Minute
+	maxMaintenanceTTL       = 24 * time.Hour
+	maintenanceSyncInterval = 5 * time.Second
+)
+
+// Queues paused by workers while maintenance is on.
+var maintenanceQueues = []string{"default"}
+
+type MaintenanceState struct {
+	Reason    string    `json:"reason"`
+	EnabledAt time.Time `json:"enabled_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// getMaintenance returns nil when maintenance mode is off.
+func getMaintenance(ctx context.Context) (*MaintenanceState, error) {
+	raw, err := redisClient.Get(ctx, maintenanceKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state MaintenanceState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("corrupt maintenance flag: %v", err)
+	}
+	return &state, nil
+}
+
+func enableMaintenance(ctx context.Context, reason string, ttl time.Duration) (*MaintenanceState, error) {
+	now := time.Now().UTC()
+	state := MaintenanceState{Reason: reason, EnabledAt: now, ExpiresAt: now.Add(ttl)}
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if err := redisClient.Set(ctx, maintenanceKey, raw, ttl).Err(); err != nil {
+		return nil, err
+	}
+	syncWorkerPause(ctx, true)
+	return &state, nil
+}
+
+func disableMaintenance(ctx context.Context) error {
+	if err := redisClient.Del(ctx, maintenanceKey).Err(); err != nil {
+		return err
+	}
+	syncWorkerPause(ctx, false)
+	return nil
+}
+
+// syncWorkerPause pauses or resumes the worker queues. Pausing is stored in
+// Redis by asynq, so whichever instance notices a change applies it for all.
+// Queues being drained stay paused until the drain is stopped.
+func syncWorkerPause(ctx context.Context, paused bool) {
+	for _, queue := range maintenanceQueues {
+		info, err := asynqInspector.GetQueueInfo(queue)
+		if err != nil {
+			// A queue that has never had a task enqueued does not exist yet.
+			continue
+		}
+		if info.Paused == paused {
+			continue
+		}
+		if !paused && queueDraining(ctx, queue) {
+			continue
+		}
+		if paused {
+			err = asynqInspector.PauseQueue(queue)
+		} else {
+			err = asynqInspector.UnpauseQueue(queue)
+		}
+		if err != nil {
+			log.Printf("ERROR: could not set paused=%t on queue %s: %v", paused, queue, err)
+			continue
+		}
+		log.Printf("Maintenance: queue %s paused=%t", queue, paused)
+	}
+}
+
+// runMaintenanceSync keeps queue pausing in line with the flag, which matters
+// when the flag expires by TTL and nobody calls disableMaintenance.
+func runMaintenanceSync(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			state, err := getMaintenance(ctx)
+			if err != nil {
+				log.Printf("ERROR: could not read maintenance flag: %v", err)
+				continue
+			}
+			syncWorkerPause(ctx, state != nil)
+		}
+	}
+}
+
+// maintenanceMiddleware rejects mutating requests with 503 while maintenance
+// is on. Reads, health checks and the maintenance endpoints stay available.
+func maintenanceMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if c.Path() == "/admin/maintenance" {
+			return next(c)
+		}
+
+		state, err := getMaintenance(c.Request().Context())
+		if err != nil {
+			// Fail open: a Redis hiccup should not take writes down with it.
+			log.Printf("ERROR: could not read maintenance flag: %v", err)
+			return next(c)
+		}
+		if state == nil {
+			return next(c)
+		}
+
+		retryAdvisor.SetHeader(c, retryAdvisor.ForDeadline(state.ExpiresAt))
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"error":      "service is under maintenance",
+			"reason":     state.Reason,
+			"expires_at": state.ExpiresAt,
+		})
+	}
+}
+
+// adminTokenMiddleware guards admin routes with the ADMIN_TOKEN env var.
+// With no token configured, admin routes are disabled.
+func adminTokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	token := os.Getenv("ADMIN_TOKEN")
+	return func(c echo.Context) error {
+		given := c.Request().Header.Get("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+		return next(c)
+	}
+}
+
+// adminUserMiddleware admits HTTP Basic credentials of an active ADMIN user.
+func adminUserMiddleware() echo.MiddlewareFunc {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "admin",
+		Validator: func(email, password string, c echo.Context) (bool, error) {
+			dbMutex.RLock()
+			defer dbMutex.RUnlock()
+			for _, u := range mockUsers {
+				if u.Role == RoleAdmin && u.IsActive && strings.EqualFold(u.Email, email) {
+					return subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte("hashed:"+password)) == 1, nil
+				}
+			}
+			return false, nil
+		},
+	})
+}
+
+// seedAdminUser creates the ADMIN user named by ADMIN_EMAIL and
+// ADMIN_PASSWORD, if both are set.
+func seedAdminUser() {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; admin panel disabled")
+		return
+	}
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: "hashed:" + password, Role: RoleAdmin, IsActive: true, CreatedAt: time.Now()}
+	dbMutex.Lock()
+	mockUsers[admin.ID] = admin
+	dbMutex.Unlock()
+}
+
+// --- Queue Draining ---
+
+// A drain prepares the worker fleet for shutdown. New enqueues to the chosen
+// queues are refused and the queues are paused, so workers pick up nothing
+// new; the drain then waits for active tasks to finish. Pending tasks stay in
+// Redis for the next fleet. State is kept in Redis with a TTL like the
+// maintenance flag, so a forgotten drain lifts itself.
+const (
+	drainQueuesKey      = "drain:queues"
+	drainStatusKey      = "drain:status"
+	drainStateTTL       = 24 * time.Hour
+	drainReportInterval = 5 * time.Second
+	defaultDrainTimeout = 10 * time.Minute
+)
+
+const (
+	DrainRunning  = "draining"
+	DrainDone     = "drained"
+	DrainTimedOut = "timed_out"
+)
+
+var (
+	ErrQueueDraining     = errors.New("queue is draining for a deployment")
+	ErrDrainInProgress   = errors.New("a drain is already in progress; stop it first")
+	ErrNoDrainInProgress = errors.New("no drain in progress")
+	errDrainStopped      = errors.New("drain was stopped")
+)
+
+type QueueCounts struct {
+	Active    int `json:"active"`
+	Pending   int `json:"pending"`
+	Scheduled int `json:"scheduled"`
+	Retry     int `json:"retry"`
+}
+
+type DrainStatus struct {
+	ID         string                 `json:"id"`
+	Queues     []string               `json:"queues"`
+	PrePaused  []string               `json:"pre_paused,omitempty"` // already paused at start; stopping leaves them paused
+	State      string                 `json:"state"`
+	SafeToStop bool                   `json:"safe_to_stop"`
+	StartedAt  time.Time              `json:"started_at"`
+	Deadline   time.Time              `json:"deadline"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+	Remaining  map[string]QueueCounts `json:"remaining"`
+}
+
+// queueDraining fails open: a Redis error admits the enqueue.
+func queueDraining(ctx context.Context, queue string) bool {
+	draining, err := redisClient.SIsMember(ctx, drainQueuesKey, queue).Result()
+	if err != nil {
+		log.Printf("ERROR: could not read drain state: %v", err)
+		return false
+	}
+	return draining
+}
+
+// rejectDraining answers an API request whose enqueue was refused because
+// the queue is draining.
+func rejectDraining(c echo.Context, queue string) error {
+	wait := retryAdvisor.max
+	if status, err := getDrainStatus(c.Request().Context()); err == nil && status != nil {
+		wait = retryAdvisor.ForDrain(status, queue)
+	}
+	retryAdvisor.SetHeader(c, wait)
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": ErrQueueDraining.Error(), "queue": queue})
+}
+
+func getDrainStatus(ctx context.Context) (*DrainStatus, error) {
+	raw, err := redisClient.Get(ctx, drainStatusKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var status DrainStatus
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return nil, fmt.Errorf("corrupt drain status: %v", err)
+	}
+	return &status, nil
+}
+
+// saveDrainStatus overwrites the stored status only while it still belongs
+// to the same drain. Once the drain is stopped (or replaced by a new one) it
+// returns errDrainStopped instead of bringing the old drain back.
+func saveDrainStatus(ctx context.Context, status *DrainStatus) error {
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, drainStatusKey).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return errDrainStopped
+		}
+		if err != nil {
+			return err
+		}
+		var stored DrainStatus
+		if err := json.Unmarshal(current, &stored); err != nil || stored.ID != status.ID {
+			return errDrainStopped
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, drainStatusKey, raw, drainStateTTL)
+			return nil
+		})
+		if errors.Is(err, redis.TxFailedErr) {
+			return errDrainStopped
+		}
+		return err
+	}, drainStatusKey)
+}
+
+// startDrain closes admission and pauses the queues. Only one drain may exist
+// at a time, including a finished one that has not been stopped.
+func startDrain(ctx context.Context, queues []string, timeout time.Duration) (*DrainStatus, error) {
+	now := time.Now().UTC()
+	status := &DrainStatus{ID: uuid.NewString(), Queues: queues, State: DrainRunning, StartedAt: now, Deadline: now.Add(timeout), UpdatedAt: now}
+	for _, queue := range queues {
+		if info, err := asynqInspector.GetQueueInfo(queue); err == nil && info.Paused {
+			status.PrePaused = append(status.PrePaused, queue)
+		}
+	}
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := redisClient.SetNX(ctx, drainStatusKey, raw, drainStateTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrDrainInProgress
+	}
+
+	pipe := redisClient.TxPipeline()
+	pipe.Del(ctx, drainQueuesKey)
+	pipe.SAdd(ctx, drainQueuesKey, stringsToArgs(queues)...)
+	pipe.Expire(ctx, drainQueuesKey, drainStateTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		redisClient.Del(ctx, drainStatusKey)
+		return nil, err
+	}
+	for _, queue := range queues {
+		if contains(status.PrePaused, queue) {
+			continue
+		}
+		if err := asynqInspector.PauseQueue(queue); err != nil {
+			log.Printf("ERROR: drain could not pause queue %s: %v", queue, err)
+		}
+	}
+	log.Printf("Drain: started for queues %v, deadline %s", queues, status.Deadline.Format(time.RFC3339))
+	return status, nil
+}
+
+func stringsToArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// awaitDrain polls the queues every drainReportInterval until no task is
+// active or the deadline passes, saving and reporting the counts each time.
+func awaitDrain(ctx context.Context, status *DrainStatus, report func(DrainStatus)) (*DrainStatus, error) {
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+	for {
+		status.Remaining = make(map[string]QueueCounts, len(status.Queues))
+		active := 0
+		for _, queue := range status.Queues {
+			info, err := asynqInspector.GetQueueInfo(queue)
+			if err != nil {
+				// Never used, so nothing can be running on it.
+				status.Remaining[queue] = QueueCounts{}
+				continue
+			}
+			status.Remaining[queue] = QueueCounts{Active: info.Active, Pending: info.Pending, Scheduled: info.Scheduled, Retry: info.Retry}
+			active += info.Active
+		}
+		status.UpdatedAt = time.Now().UTC()
+		switch {
+		case active == 0:
+			status.State, status.SafeToStop = DrainDone, true
+		case status.UpdatedAt.After(status.Deadline):
+			status.State = DrainTimedOut
+		}
+		if err := saveDrainStatus(ctx, status); errors.Is(err, errDrainStopped) {
+			log.Printf("Drain: %s was stopped; no longer tracking it", status.ID)
+			return status, nil
+		} else if err != nil {
+			return status, err
+		}
+		report(*status)
+		if status.State != DrainRunning {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func logDrainProgress(status DrainStatus) {
+	parts := make([]string, 0, len(status.Queues))
+	for _, queue := range status.Queues {
+		n := status.Remaining[queue]
+		parts = append(parts, fmt.Sprintf("%s: %d active, %d pending", queue, n.Active, n.Pending))
+	}
+	log.Printf("Drain: %s (%s)", status.State, strings.Join(parts, "; "))
+	if status.SafeToStop {
+		log.Printf("Drain: no active tasks remain; it is safe to stop the workers")
+	}
+}
+
+// stopDrain reopens admission and unpauses the queues, unless maintenance
+// mode still wants them paused or they were paused before the drain began.
+func stopDrain(ctx context.Context) error {
+	status, err := getDrainStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		return ErrNoDrainInProgress
+	}
+	if err := redisClient.Del(ctx, drainQueuesKey, drainStatusKey).Err(); err != nil {
+		return err
+	}
+	maintenance, _ := getMaintenance(ctx)
+	for _, queue := range status.Queues {
+		if maintenance != nil && contains(maintenanceQueues, queue) {
+			continue
+		}
+		if contains(status.PrePaused, queue) {
+			continue
+		}
+		if err := asynqInspector.UnpauseQueue(queue); err != nil {
+			log.Printf("ERROR: could not unpause queue %s: %v", queue, err)
+		}
+	}
+	log.Printf("Drain: stopped, queues %v accept work again", status.Queues)
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// runDrainCommand implements `drain` and `drain -stop` for deploy scripts.
+// It exits 0 once the workers are safe to stop and 1 otherwise.
+func runDrainCommand(args []string) {
+	fs := flag.NewFlagSet("drain", flag.ExitOnError)
+	queues := fs.String("queues", "default", "comma-separated queues to drain")
+	timeout := fs.Duration("timeout", defaultDrainTimeout, "how long to wait for active tasks")
+	stop := fs.Bool("stop", false, "end the drain and resume the queues")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	if *stop {
+		if err := stopDrain(ctx); err != nil {
+			log.Fatalf("could not stop drain: %v", err)
+		}
+		return
+	}
+	status, err := startDrain(ctx, strings.Split(*queues, ","), *timeout)
+	if err != nil {
+		log.Fatalf("could not start drain: %v", err)
+	}
+	if status, err = awaitDrain(ctx, status, logDrainProgress); err != nil {
+		log.Fatalf("drain failed: %v", err)
+	}
+	if !status.SafeToStop {
+		log.Printf("Drain: timed out with active tasks remaining; not safe to stop")
+		os.Exit(1)
+	}
+}
+
+// --- Retry-After Estimation ---
+
+// Refused clients are told to come back when whatever refused them has
+// likely cleared, rather than after a fixed interval: a queue's backlog
+// worked off at its recent rate, the end of a maintenance window or drain,
+// or the reset of a rate-limit window.
+const (
+	minRetryAfter      = time.Second
+	maxRetryAfter      = 10 * time.Minute
+	loadSampleInterval = 10 * time.Second
+	// retryAfterSpread adds up to this fraction on top of an estimate, so
+	// clients refused together do not all come back in the same second.
+	retryAfterSpread = 0.1
+)
+
+// QueueLoad is a queue's backlog and recent processing rate. Depth counts
+// the tasks ahead of a new one: pending and active.
+type QueueLoad struct {
+	Queue     string    `json:"queue"`
+	Depth     int       `json:"depth"`
+	Active    int       `json:"active"`
+	PerSecond float64   `json:"processed_per_second"`
+	Paused    bool      `json:"paused"`
+	SampledAt time.Time `json:"sampled_at"`
+
+	processedTotal int
+}
+
+// RetryAdvisor samples queue load in the background and turns it into
+// Retry-After durations. Processing rates come from ProcessedTotal deltas
+// between samples, smoothed with an EWMA so one quiet interval does not send
+// every client away for the maximum.
+type RetryAdvisor struct {
+	inspector *asynq.Inspector
+	alpha     float64
+	min, max  time.Duration
+
+	mu     sync.Mutex
+	queues map[string]*QueueLoad
+}
+
+func NewRetryAdvisor(inspector *asynq.Inspector, alpha float64, min, max time.Duration) *RetryAdvisor {
+	return &RetryAdvisor{inspector: inspector, alpha: alpha, min: min, max: max, queues: make(map[string]*QueueLoad)}
+}
+
+func (a *RetryAdvisor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		a.sample(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *RetryAdvisor) sample(now time.Time) {
+	names, err := a.inspector.Queues()
+	if err != nil {
+		log.Printf("ERROR: could not list queues for load sampling: %v", err)
+		return
+	}
+	for _, name := range names {
+		info, err := a.inspector.GetQueueInfo(name)
+		if err != nil {
+			continue
+		}
+		a.observe(name, info, now)
+	}
+}
+
+func (a *RetryAdvisor) observe(name string, info *asynq.QueueInfo, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	load, seen := a.queues[name]
+	if !seen {
+		load = &QueueLoad{Queue: name}
+		a.queues[name] = load
+	}
+	// A total that went backwards means Redis was reset; keep the old rate.
+	if elapsed := now.Sub(load.SampledAt).Seconds(); seen && elapsed > 0 && info.ProcessedTotal >= load.processedTotal {
+		rate := float64(info.ProcessedTotal-load.processedTotal) / elapsed
+		load.PerSecond = a.alpha*rate + (1-a.alpha)*load.PerSecond
+	}
+	load.processedTotal = info.ProcessedTotal
+	load.Depth = info.Pending + info.Active
+	load.Active = info.Active
+	load.Paused = info.Paused
+	load.SampledAt = now
+}
+
+// Load returns the last sample taken of queue.
+func (a *RetryAdvisor) Load(queue string) (QueueLoad, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	load, ok := a.queues[queue]
+	if !ok {
+		return QueueLoad{}, false
+	}
+	return *load, true
+}
+
+// Loads returns the last sample of every queue, ordered by name.
+func (a *RetryAdvisor) Loads() []QueueLoad {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	loads := make([]QueueLoad, 0, len(a.queues))
+	for _, load := range a.queues {
+		loads = append(loads, *load)
+	}
+	sort.Slice(loads, func(i, j int) bool { return loads[i].Queue < loads[j].Queue })
+	return loads
+}
+
+func (a *RetryAdvisor) clamp(d time.Duration) time.Duration {
+	if d < a.min {
+		return a.min
+	}
+	if d > a.max {
+		return a.max
+	}
+	return d
+}
+
+// ForBacklog is how long the queue takes to work off n tasks at its recent
+// rate. With no throughput measured yet there is nothing to go on, so it
+// returns the maximum.
+func (a *RetryAdvisor) ForBacklog(queue string, n int) time.Duration {
+	load, ok := a.Load(queue)
+	if !ok || load.PerSecond <= 0 {
+		return a.max
+	}
+	return a.clamp(time.Duration(float64(n) / load.PerSecond * float64(time.Second)))
+}
+
+// ForDeadline waits out a condition that lifts by itself at t. Long waits
+// are capped, since maintenance can be switched off early.
+func (a *RetryAdvisor) ForDeadline(t time.Time) time.Duration {
+	return a.clamp(time.Until(t))
+}
+
+// ForDrain expects admission to reopen once the queue's active tasks are
+// done, or at the drain deadline if that comes first: that is when the
+// drain command gives up and the deploy proceeds anyway.
+func (a *RetryAdvisor) ForDrain(status *DrainStatus, queue string) time.Duration {
+	wait := a.max
+	if load, ok := a.Load(queue); ok {
+		wait = a.ForBacklog(queue, load.Active)
+	}
+	if untilDeadline := time.Until(status.Deadline); untilDeadline > 0 && untilDeadline < wait {
+		wait = untilDeadline
+	}
+	return a.clamp(wait)
+}
+
+// ForWindow waits for a rate-limit window that resets in reset.
+func (a *RetryAdvisor) ForWindow(reset time.Duration) time.Duration {
+	return a.clamp(reset)
+}
+
+// SetHeader writes d as Retry-After in whole seconds, rounded up and spread
+// by up to retryAfterSpread.
+func (a *RetryAdvisor) SetHeader(c echo.Context, d time.Duration) {
+	d += time.Duration(rand.Float64() * retryAfterSpread * float64(d))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// --- Enqueue Admission ---
+
+// API requests that enqueue work must pass three checks, in order: the queue
+// is not draining, the client is within enqueueRateLimit requests per
+// window, and the queue's backlog is below queueMaxBacklog.
+const enqueueRateWindow = time.Minute
+
+var (
+	enqueueRateLimit = envPositiveInt("ENQUEUE_RATE_LIMIT", 60)
+	queueMaxBacklog  = envPositiveInt("QUEUE_MAX_BACKLOG", 10000)
+)
+
+func envPositiveInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Fatalf("%s must be a positive integer, got %q", name, raw)
+	}
+	return n
+}
+
+// countEnqueue counts a request against the client's fixed window and
+// reports whether it fits and when the window resets. A Redis error admits
+// the request, like the other admission checks.
+func countEnqueue(ctx context.Context, client string) (bool, time.Duration) {
+	now := time.Now()
+	start := now.Truncate(enqueueRateWindow)
+	key := fmt.Sprintf("ratelimit:enqueue:%s:%d", client, start.Unix())
+	pipe := redisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, enqueueRateWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("ERROR: could not count enqueue rate: %v", err)
+		return true, 0
+	}
+	return count.Val() <= int64(enqueueRateLimit), start.Add(enqueueRateWindow).Sub(now)
+}
+
+// enqueueAdmission guards a route that enqueues onto queue. Only API
+// requests are checked: running tasks enqueue their follow-ups regardless,
+// so in-flight chains can finish during a drain or a spike.
+func enqueueAdmission(queue string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			if queueDraining(ctx, queue) {
+				return rejectDraining(c, queue)
+			}
+			if ok, reset := countEnqueue(ctx, c.RealIP()); !ok {
+				retryAdvisor.SetHeader(c, retryAdvisor.ForWindow(reset))
+				return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "enqueue rate limit exceeded"})
+			}
+			if load, ok := retryAdvisor.Load(queue); ok && load.Depth >= queueMaxBacklog {
+				// Admission reopens once the backlog drops below the limit.
+				retryAdvisor.SetHeader(c, retryAdvisor.ForBacklog(queue, load.Depth-queueMaxBacklog+1))
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "queue is saturated", "queue": queue})
+			}
+			return next(c)
+		}
+	}
+}
+
+// --- Heartbeats & Stuck Task Detection ---
+
+// Every running task holds a lease key in Redis that its handler refreshes
+// through heartbeat(ctx). The lease is only extended when the handler makes
+// progress, so a hung handler lets it lapse even though its worker is alive.
+// A scheduled watchdog reports tasks whose lease lapsed before they finished.
+const (
+	leaseKeyPrefix      = "heartbeat:lease:"
+	activeTasksKey      = "heartbeat:active"
+	stuckTasksKey       = "heartbeat:stuck"
+	leaseTTL            = 60 * time.Second
+	minHeartbeatSpacing = leaseTTL / 4
+	watchdogSchedule    = "@every 1m"
+)
+
+type TaskLease struct {
+	TaskID    string    `json:"task_id"`
+	Queue     string    `json:"queue"`
+	Type      string    `json:"type"`
+	Worker    string    `json:"worker"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type StuckTask struct {
+	TaskLease
+	DetectedAt   time.Time `json:"detected_at"`
+	ForceRetried bool      `json:"force_retried"`
+}
+
+type leaseCtxKey struct{}
+
+// leaseHolder is stored in the handler context so heartbeat can find it.
+type leaseHolder struct {
+	mu       sync.Mutex
+	key      string
+	lastBeat time.Time
+}
+
+var workerName = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+// heartbeatMiddleware takes a lease before the handler runs and drops it when
+// the handler returns, whatever the outcome.
+func heartbeatMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		id, _ := asynq.GetTaskID(ctx)
+		queue, _ := asynq.GetQueueName(ctx)
+		lease := TaskLease{TaskID: id, Queue: queue, Type: t.Type(), Worker: workerName, StartedAt: time.Now().UTC()}
+		raw, err := json.Marshal(lease)
+		if err != nil {
+			return err
+		}
+
+		key := leaseKeyPrefix + id
+		_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, workerName, leaseTTL)
+			pipe.HSet(ctx, activeTasksKey, id, raw)
+			return nil
+		})
+		if err != nil {
+			// Without a lease the task is simply unwatched; still run it.
+			log.Printf("WARN: could not take lease for task %s: %v", id, err)
+			return next.ProcessTask(ctx, t)
+		}
+
+		holder := &leaseHolder{key: key, lastBeat: time.Now()}
+		defer func() {
+			// Use a fresh context: ctx may already be cancelled or past its deadline.
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			redisClient.TxPipelined(cleanupCtx, func(pipe redis.Pipeliner) error {
+				pipe.Del(cleanupCtx, key)
+				pipe.HDel(cleanupCtx, activeTasksKey, id)
+				return nil
+			})
+		}()
+		return next.ProcessTask(context.WithValue(ctx, leaseCtxKey{}, holder), t)
+	})
+}
+
+// heartbeat extends the running task's lease. Handlers call it between units
+// of work; calls closer together than minHeartbeatSpacing are no-ops.
+func heartbeat(ctx context.Context) {
+	holder, ok := ctx.Value(leaseCtxKey{}).(*leaseHolder)
+	if !ok {
+		return
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	if time.Since(holder.lastBeat) < minHeartbeatSpacing {
+		return
+	}
+	if err := redisClient.Expire(ctx, holder.key, leaseTTL).Err(); err != nil {
+		log.Printf("WARN: heartbeat failed for %s: %v", holder.key, err)
+		return
+	}
+	holder.lastBeat = time.Now()
+}
+
+// sleepWithHeartbeat stands in for a long step of real work.
+func sleepWithHeartbeat(ctx context.Context, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		step := time.Until(deadline)
+		if step > time.Second {
+			step = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(step):
+		}
+		heartbeat(ctx)
+	}
+	return nil
+}
+
+// forceRetryStuckTasks makes the watchdog cancel stuck tasks. The handler's
+// context is cancelled, the task fails, and asynq retries it as usual.
+var forceRetryStuckTasks = os.Getenv("STUCK_TASK_FORCE_RETRY") == "true"
+
+// handleStuckTaskWatchdog finds tasks that are still registered as active
+// but whose lease has expired.
+func handleStuckTaskWatchdog(ctx context.Context, t *asynq.Task) error {
+	active, err := redisClient.HGetAll(ctx, activeTasksKey).Result()
+	if err != nil {
+		return fmt.Errorf("could not list active tasks: %v", err)
+	}
+	for id, raw := range active {
+		alive, err := redisClient.Exists(ctx, leaseKeyPrefix+id).Result()
+		if err != nil {
+			return fmt.Errorf("could not check lease for %s: %v", id, err)
+		}
+		if alive == 1 {
+			continue
+		}
+		// HDel decides which watchdog run owns the report if two overlap.
+		removed, err := redisClient.HDel(ctx, activeTasksKey, id).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		var stuck StuckTask
+		if err := json.Unmarshal([]byte(raw), &stuck.TaskLease); err != nil {
+			log.Printf("WARN: corrupt lease record for task %s: %v", id, err)
+			stuck.TaskID = id
+		}
+		stuck.DetectedAt = time.Now().UTC()
+		if forceRetryStuckTasks {
+			if err := asynqInspector.CancelProcessing(id); err != nil {
+				log.Printf("ERROR: could not cancel stuck task %s: %v", id, err)
+			} else {
+				stuck.ForceRetried = true
+			}
+		}
+
+		record, _ := json.Marshal(stuck)
+		if err := redisClient.HSet(ctx, stuckTasksKey, id, record).Err(); err != nil {
+			log.Printf("ERROR: could not record stuck task %s: %v", id, err)
+		}
+		notifyStuckTask(ctx, stuck)
+	}
+	return nil
+}
+
+// notifyStuckTask posts the alert to ALERT_WEBHOOK_URL. Without a webhook the
+// alert only goes to the log.
+func notifyStuckTask(ctx context.Context, stuck StuckTask) {
+	msg := fmt.Sprintf("task %s (%s) on %s stopped heartbeating; started %s, force_retried=%t",
+		stuck.TaskID, stuck.Type, stuck.Worker, stuck.StartedAt.Format(time.RFC3339), stuck.ForceRetried)
+	log.Printf("ALERT: %s", msg)
+
+	webhook := os.Getenv("ALERT_WEBHOOK_URL")
+	if webhook == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{"text": msg, "task": stuck})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("ERROR: could not build alert request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("ERROR: could not send stuck task alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("ERROR: alert webhook returned %s", resp.Status)
+	}
+}
+
 // --- API Handlers (Procedural Style) ---
 
 func createUserHandler(c echo.Context) error {
@@ -153,6 +1072,350 @@ func getJobStatusHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, taskInfo)
 }
 
+func getMaintenanceHandler(c echo.Context) error {
+	state, err := getMaintenance(c.Request().Context())
+	if err != nil {
+		log.Printf("ERROR: could not read maintenance flag: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"enabled": state != nil, "state": state})
+}
+
+func setMaintenanceHandler(c echo.Context) error {
+	var params struct {
+		Enabled    bool   `json:"enabled"`
+		Reason     string `json:"reason"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad request"})
+	}
+
+	ctx := c.Request().Context()
+	if !params.Enabled {
+		if err := disableMaintenance(ctx); err != nil {
+			log.Printf("ERROR: could not disable maintenance mode: %v", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		log.Printf("Maintenance mode disabled")
+		return c.JSON(http.StatusOK, map[string]interface{}{"enabled": false})
+	}
+
+	ttl := defaultMaintenanceTTL
+	if params.TTLSeconds > 0 {
+		ttl = time.Duration(params.TTLSeconds) * time.Second
+	}
+	if ttl > maxMaintenanceTTL {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("ttl_seconds must not exceed %d", int(maxMaintenanceTTL.Seconds()))})
+	}
+
+	state, err := enableMaintenance(ctx, params.Reason, ttl)
+	if err != nil {
+		log.Printf("ERROR: could not enable maintenance mode: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	log.Printf("Maintenance mode enabled until %s: %s", state.ExpiresAt.Format(time.RFC3339), state.Reason)
+	return c.JSON(http.StatusOK, map[string]interface{}{"enabled": true, "state": state})
+}
+
+func getDrainHandler(c echo.Context) error {
+	status, err := getDrainStatus(c.Request().Context())
+	if err != nil {
+		log.Printf("ERROR: could not read drain status: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if status == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": ErrNoDrainInProgress.Error()})
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// startDrainHandler starts a drain and waits for it in the background; poll
+// GET /admin/drain until safe_to_stop is true.
+func startDrainHandler(c echo.Context) error {
+	var params struct {
+		Queues         []string `json:"queues"`
+		TimeoutSeconds int      `json:"timeout_seconds"`
+	}
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad request"})
+	}
+	if len(params.Queues) == 0 {
+		params.Queues = []string{"default"}
+	}
+	timeout := defaultDrainTimeout
+	if params.TimeoutSeconds > 0 {
+		timeout = time.Duration(params.TimeoutSeconds) * time.Second
+	}
+
+	status, err := startDrain(c.Request().Context(), params.Queues, timeout)
+	if errors.Is(err, ErrDrainInProgress) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("ERROR: could not start drain: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	go func(status DrainStatus) {
+		if _, err := awaitDrain(context.Background(), &status, logDrainProgress); err != nil {
+			log.Printf("ERROR: drain failed: %v", err)
+		}
+	}(*status)
+	return c.JSON(http.StatusAccepted, status)
+}
+
+func stopDrainHandler(c echo.Context) error {
+	err := stopDrain(c.Request().Context())
+	if errors.Is(err, ErrNoDrainInProgress) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("ERROR: could not stop drain: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getLoadHandler shows what Retry-After estimates are based on.
+func getLoadHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"queues":             retryAdvisor.Loads(),
+		"enqueue_rate_limit": enqueueRateLimit,
+		"rate_window_sec":    enqueueRateWindow.Seconds(),
+		"queue_max_backlog":  queueMaxBacklog,
+	})
+}
+
+func listStuckTasksHandler(c echo.Context) error {
+	records, err := redisClient.HGetAll(c.Request().Context(), stuckTasksKey).Result()
+	if err != nil {
+		log.Printf("ERROR: could not list stuck tasks: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	stuck := make([]StuckTask, 0, len(records))
+	for _, raw := range records {
+		var s StuckTask
+		if err := json.Unmarshal([]byte(raw), &s); err == nil {
+			stuck = append(stuck, s)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"stuck_tasks": stuck})
+}
+
+func clearStuckTaskHandler(c echo.Context) error {
+	if err := redisClient.HDel(c.Request().Context(), stuckTasksKey, c.Param("id")).Err(); err != nil {
+		log.Printf("ERROR: could not clear stuck task: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func healthHandler(c echo.Context) error {
+	if err := redisClient.Ping(c.Request().Context()).Err(); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": "unhealthy", "redis": err.Error()})
+	}
+	state, _ := getMaintenance(c.Request().Context())
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "ok", "maintenance": state != nil})
+}
+
+// --- Admin Panel ---
+// The panel and the queue, job and user APIs it renders are for ADMIN users
+// and take their HTTP Basic credentials. The page's assets are hashed and
+// gzipped when the panel is built.
+
+const (
+	adminPanelPrefix  = "/admin/panel/"
+	adminListMaxLimit = 100
+)
+
+//go:embed admin_panel
+var adminPanelFiles embed.FS
+
+type panelFile struct {
+	body         []byte
+	gzipped      []byte // nil when compression does not pay off
+	contentType  string
+	etag         string
+	cacheControl string
+}
+
+func newPanelFile(name string, body []byte, cacheControl string) *panelFile {
+	sum := sha256.Sum256(body)
+	f := &panelFile{body: body, contentType: mime.TypeByExtension(path.Ext(name)), etag: `"` + hex.EncodeToString(sum[:6]) + `"`, cacheControl: cacheControl}
+	if f.contentType == "" {
+		f.contentType = echo.MIMEOctetStream
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(body)
+	zw.Close()
+	if buf.Len() < len(body) {
+		f.gzipped = buf.Bytes()
+	}
+	return f
+}
+
+// adminPanel maps paths below adminPanelPrefix to files; "" is index.html.
+type adminPanel map[string]*panelFile
+
+// buildAdminPanel renames every file but index.html to name.<hash>.ext.
+// index.html is a template in which {{asset "app.js"}} is the new URL of
+// app.js.
+func buildAdminPanel(files fs.FS) (adminPanel, error) {
+	panel := adminPanel{}
+	urls := map[string]string{}
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == "index.html" {
+			return err
+		}
+		body, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		f := newPanelFile(name, body, "public, max-age=31536000, immutable")
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + strings.Trim(f.etag, `"`) + ext
+		panel[hashed] = f
+		urls[name] = adminPanelPrefix + hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
+		"asset": func(name string) (string, error) {
+			if u, ok := urls[name]; ok {
+				return u, nil
+			}
+			return "", fmt.Errorf("admin panel: no asset %q", name)
+		},
+	}).ParseFS(files, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	var index bytes.Buffer
+	if err := tmpl.Execute(&index, nil); err != nil {
+		return nil, err
+	}
+	panel[""] = newPanelFile("index.html", index.Bytes(), "no-cache")
+	return panel, nil
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		return q > 0
+	}
+	return false
+}
+
+func (p adminPanel) handler(c echo.Context) error {
+	f, ok := p[c.Param("*")]
+	if !ok {
+		return echo.ErrNotFound
+	}
+	h := c.Response().Header()
+	h.Set("ETag", f.etag)
+	h.Set(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	h.Set(echo.HeaderCacheControl, f.cacheControl)
+	if c.Request().Header.Get("If-None-Match") == f.etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+	if f.gzipped != nil && acceptsGzip(c.Request().Header.Get(echo.HeaderAcceptEncoding)) {
+		h.Set(echo.HeaderContentEncoding, "gzip")
+		return c.Blob(http.StatusOK, f.contentType, f.gzipped)
+	}
+	return c.Blob(http.StatusOK, f.contentType, f.body)
+}
+
+var errUnknownTaskState = errors.New("state must be pending, active, scheduled, retry, archived or completed")
+
+// listTasks returns up to limit tasks of queue in the given state.
+func listTasks(queue, state string, limit int) ([]*asynq.TaskInfo, error) {
+	page := asynq.PageSize(limit)
+	switch state {
+	case "pending":
+		return asynqInspector.ListPendingTasks(queue, page)
+	case "active":
+		return asynqInspector.ListActiveTasks(queue, page)
+	case "scheduled":
+		return asynqInspector.ListScheduledTasks(queue, page)
+	case "retry":
+		return asynqInspector.ListRetryTasks(queue, page)
+	case "archived":
+		return asynqInspector.ListArchivedTasks(queue, page)
+	case "completed":
+		return asynqInspector.ListCompletedTasks(queue, page)
+	}
+	return nil, errUnknownTaskState
+}
+
+func adminQueuesHandler(c echo.Context) error {
+	queues, err := asynqInspector.Queues()
+	if err != nil {
+		log.Printf("ERROR: could not list queues: %v", err)
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "could not list queues"})
+	}
+	sort.Strings(queues)
+	rows := make([]map[string]interface{}, 0, len(queues))
+	for _, queue := range queues {
+		info, err := asynqInspector.GetQueueInfo(queue)
+		if err != nil {
+			continue
+		}
+		rows = append(rows, map[string]interface{}{
+			"queue": info.Queue, "paused": info.Paused, "size": info.Size,
+			"active": info.Active, "pending": info.Pending, "scheduled": info.Scheduled,
+			"retry": info.Retry, "archived": info.Archived, "completed": info.Completed,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": rows})
+}
+
+// adminJobsHandler serves GET /admin/jobs?queue=default&state=pending&limit=50.
+func adminJobsHandler(c echo.Context) error {
+	queue, state, limit := "default", "pending", 50
+	err := echo.QueryParamsBinder(c).String("queue", &queue).String("state", &state).Int("limit", &limit).BindError()
+	if err != nil || limit < 1 || limit > adminListMaxLimit {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", adminListMaxLimit)})
+	}
+	tasks, err := listTasks(queue, state, limit)
+	if errors.Is(err, errUnknownTaskState) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil && !errors.Is(err, asynq.ErrQueueNotFound) {
+		log.Printf("ERROR: could not list jobs: %v", err)
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "could not list jobs"})
+	}
+	rows := make([]map[string]interface{}, 0, len(tasks))
+	for _, t := range tasks {
+		rows = append(rows, map[string]interface{}{
+			"id": t.ID, "type": t.Type, "queue": t.Queue, "state": t.State.String(),
+			"retried": t.Retried, "max_retry": t.MaxRetry, "last_error": t.LastErr,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": rows})
+}
+
+func adminUsersHandler(c echo.Context) error {
+	dbMutex.RLock()
+	users := make([]User, 0, len(mockUsers))
+	for _, u := range mockUsers {
+		users = append(users, u)
+	}
+	dbMutex.RUnlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": users})
+}
+
 // --- Task Handlers (Functional Style) ---
 
 func handleSendWelcomeEmail(ctx context.Context, t *asynq.Task) error {
@@ -169,7 +1432,9 @@ func handleSendWelcomeEmail(ctx context.Context, t *asynq.Task) error {
 	}
 
 	log.Printf("Sending welcome email to %s", user.Email)
-	time.Sleep(2 * time.Second) // Simulate network latency
+	if err := sleepWithHeartbeat(ctx, 2*time.Second); err != nil { // Simulate network latency
+		return err
+	}
 	log.Printf("-> Welcome email sent to %s", user.Email)
 	return nil
 }
@@ -181,7 +1446,9 @@ func handleImagePipeline(ctx context.Context, t *asynq.Task) error {
 	}
 
 	log.Printf("Starting image processing for post %s (resizing...)", p.PostID)
-	time.Sleep(5 * time.Second) // Simulate resize
+	if err := sleepWithHeartbeat(ctx, 5*time.Second); err != nil { // Simulate resize
+		return err
+	}
 	log.Printf("-> Image resized for post %s", p.PostID)
 
 	// Chain the next task
@@ -200,14 +1467,18 @@ func handleAddWatermark(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("json.Unmarshal failed: %v", err)
 	}
 	log.Printf("Adding watermark to image for post %s", p.PostID)
-	time.Sleep(3 * time.Second) // Simulate watermarking
+	if err := sleepWithHeartbeat(ctx, 3*time.Second); err != nil { // Simulate watermarking
+		return err
+	}
 	log.Printf("-> Watermark added for post %s. Pipeline complete.", p.PostID)
 	return nil
 }
 
 func handleGenerateReport(ctx context.Context, t *asynq.Task) error {
 	log.Printf("Periodic task: Generating daily user report...")
-	time.Sleep(10 * time.Second) // Simulate heavy query
+	if err := sleepWithHeartbeat(ctx, 10*time.Second); err != nil { // Simulate heavy query
+		return err
+	}
 	dbMutex.RLock()
 	userCount := len(mockUsers)
 	dbMutex.RUnlock()
@@ -223,6 +1494,16 @@ func main() {
 	asynqClient = asynq.NewClient(redisOpt)
 	defer asynqClient.Close()
 	asynqInspector = asynq.NewInspector(redisOpt)
+	redisClient = redis.NewClient(&redis.Options{Addr: redisConnection})
+	defer redisClient.Close()
+	retryAdvisor = NewRetryAdvisor(asynqInspector, 0.3, minRetryAfter, maxRetryAfter)
+
+	// `go run . drain [-queues default,low] [-timeout 10m] [-stop]` drains
+	// queues ahead of a deploy instead of starting the service.
+	if len(os.Args) > 1 && os.Args[1] == "drain" {
+		runDrainCommand(os.Args[2:])
+		return
+	}
 
 	// Setup Asynq worker server
 	srv := asynq.NewServer(
@@ -237,10 +1518,12 @@ func main() {
 	)
 
 	mux := asynq.NewServeMux()
+	mux.Use(heartbeatMiddleware)
 	mux.HandleFunc(TypeEmailWelcome, handleSendWelcomeEmail)
 	mux.HandleFunc(TypeImageProcess, handleImagePipeline)
 	mux.HandleFunc(TypeImageWatermark, handleAddWatermark)
 	mux.HandleFunc(TypeReportDaily, handleGenerateReport)
+	mux.HandleFunc(TypeStuckWatchdog, handleStuckTaskWatchdog)
 
 	// Setup Asynq scheduler for periodic tasks
 	scheduler := asynq.NewScheduler(redisOpt, nil)
@@ -250,15 +1533,46 @@ func main() {
 	if err != nil {
 		log.Fatalf("could not register periodic task: %v", err)
 	}
+	if _, err := scheduler.Register(watchdogSchedule, asynq.NewTask(TypeStuckWatchdog, nil, asynq.MaxRetry(0))); err != nil {
+		log.Fatalf("could not register stuck task watchdog: %v", err)
+	}
 
 	// Setup Echo web server
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.POST("/users", createUserHandler)
-	e.POST("/posts/:id/publish", publishPostHandler)
+	e.Use(maintenanceMiddleware)
+	e.GET("/healthz", healthHandler)
+	e.POST("/users", createUserHandler, enqueueAdmission("default"))
+	e.POST("/posts/:id/publish", publishPostHandler, enqueueAdmission("default"))
 	e.GET("/jobs/:id", getJobStatusHandler)
 
+	admin := e.Group("/admin", adminTokenMiddleware)
+	admin.GET("/maintenance", getMaintenanceHandler)
+	admin.PUT("/maintenance", setMaintenanceHandler)
+	admin.GET("/load", getLoadHandler)
+	admin.GET("/stuck-tasks", listStuckTasksHandler)
+	admin.DELETE("/stuck-tasks/:id", clearStuckTaskHandler)
+	admin.GET("/drain", getDrainHandler)
+	admin.POST("/drain", startDrainHandler)
+	admin.DELETE("/drain", stopDrainHandler)
+
+	panelFiles, _ := fs.Sub(adminPanelFiles, "admin_panel")
+	panel, err := buildAdminPanel(panelFiles)
+	if err != nil {
+		log.Fatalf("could not build admin panel: %v", err)
+	}
+	seedAdminUser()
+	adminUI := e.Group("/admin", adminUserMiddleware())
+	adminUI.GET("/panel/*", panel.handler)
+	adminUI.GET("/queues", adminQueuesHandler)
+	adminUI.GET("/jobs", adminJobsHandler)
+	adminUI.GET("/users", adminUsersHandler)
+
 	// Start services
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	defer stopSync()
+	go runMaintenanceSync(syncCtx)
+	go retryAdvisor.Run(syncCtx, loadSampleInterval)
 	go func() {
 		if err := srv.Run(mux); err != nil {
 			log.Fatalf("could not run asynq worker: %v", err)
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -16,6 +24,7 @@ import (
 	"github.com/hibiken/asynq"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
 )
 
 // This code requires a running Redis instance.
@@ -56,18 +65,574 @@ type Post struct {
 // --- Mock Datastore ---
 
 type Datastore struct {
-	users map[uuid.UUID]*User
-	posts map[uuid.UUID]*Post
-	mu    sync.RWMutex
+	users      map[uuid.UUID]*User
+	posts      map[uuid.UUID]*Post
+	lineage    map[string]*TaskLineage
+	audit      []AuditEntry
+	outbox     []*OutboxEntry
+	deliveries []*DeliveryRecord
+	mu         sync.RWMutex
 }
 
 func NewDatastore() *Datastore {
 	return &Datastore{
-		users: make(map[uuid.UUID]*User),
-		posts: make(map[uuid.UUID]*Post),
+		users:   make(map[uuid.UUID]*User),
+		posts:   make(map[uuid.UUID]*Post),
+		lineage: make(map[string]*TaskLineage),
 	}
 }
 
+// TaskLineage links a manually retried task back to the task it replaces.
+// RootTaskID stays the same across repeated retries of the same job.
+type TaskLineage struct {
+	TaskID         string    `json:"task_id"`
+	OriginalTaskID string    `json:"original_task_id"`
+	RootTaskID     string    `json:"root_task_id"`
+	Queue          string    `json:"queue"`
+	ManualRetry    int       `json:"manual_retry"`
+	PayloadPatched bool      `json:"payload_patched"`
+	RetriedBy      string    `json:"retried_by"`
+	RetriedAt      time.Time `json:"retried_at"`
+}
+
+type AuditEntry struct {
+	ID              uuid.UUID       `json:"id"`
+	At              time.Time       `json:"at"`
+	Actor           string          `json:"actor"`
+	Action          string          `json:"action"`
+	TaskID          string          `json:"task_id"`
+	NewTaskID       string          `json:"new_task_id,omitempty"`
+	DeliveryID      string          `json:"delivery_id,omitempty"`
+	EventID         string          `json:"event_id,omitempty"`
+	Reason          string          `json:"reason"`
+	PreviousPayload json.RawMessage `json:"previous_payload,omitempty"`
+	NewPayload      json.RawMessage `json:"new_payload,omitempty"`
+}
+
+func (d *Datastore) RecordRetry(l *TaskLineage, entry AuditEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lineage[l.TaskID] = l
+	d.audit = append(d.audit, entry)
+}
+
+func (d *Datastore) Lineage(taskID string) (*TaskLineage, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	l, ok := d.lineage[taskID]
+	return l, ok
+}
+
+func (d *Datastore) AuditLog() []AuditEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]AuditEntry(nil), d.audit...)
+}
+
+// CreateUser stores the user and its domain events under one lock, so an
+// event is recorded if and only if the write it describes happened.
+func (d *Datastore) CreateUser(u *User, events ...CloudEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users[u.ID] = u
+	d.appendOutbox(events)
+}
+
+// AdminByCredentials returns the active ADMIN user with this email and
+// password.
+func (d *Datastore) AdminByCredentials(email, password string) (*User, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, u := range d.users {
+		if u.Role == RoleAdmin && u.IsActive && strings.EqualFold(u.Email, email) &&
+			subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte(hashPassword(password))) == 1 {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Datastore) AppendOutbox(events ...CloudEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.appendOutbox(events)
+}
+
+// appendOutbox must be called with d.mu held.
+func (d *Datastore) appendOutbox(events []CloudEvent) {
+	now := time.Now()
+	for _, ev := range events {
+		pending := make(map[string]bool, len(eventSinkNames))
+		for _, name := range eventSinkNames {
+			pending[name] = true
+		}
+		d.outbox = append(d.outbox, &OutboxEntry{Event: ev, Pending: pending, NextAttempt: now})
+	}
+}
+
+func (d *Datastore) AppendAudit(entry AuditEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.audit = append(d.audit, entry)
+}
+
+// --- Domain Events (CloudEvents v1.0) ---
+
+const (
+	EventUserRegistered = "com.example.user.registered"
+	EventPostPublished  = "com.example.post.published"
+	EventJobCompleted   = "com.example.job.completed"
+
+	eventSource = "/services/jobs-api"
+)
+
+// eventTypeInfo is the registry entry for an event type. Events of
+// unregistered types, or whose data does not decode into Data, are rejected
+// before they reach the outbox.
+type eventTypeInfo struct {
+	DataSchema string
+	Data       func() interface{}
+}
+
+var eventTypes = map[string]eventTypeInfo{
+	EventUserRegistered: {DataSchema: "/schemas/user.registered/v1", Data: func() interface{} { return &UserRegisteredData{} }},
+	EventPostPublished:  {DataSchema: "/schemas/post.published/v1", Data: func() interface{} { return &PostPublishedData{} }},
+	EventJobCompleted:   {DataSchema: "/schemas/job.completed/v1", Data: func() interface{} { return &JobCompletedData{} }},
+}
+
+type UserRegisteredData struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+}
+
+type PostPublishedData struct {
+	PostID uuid.UUID `json:"post_id"`
+	TaskID string    `json:"task_id"`
+}
+
+type JobCompletedData struct {
+	TaskID   string `json:"task_id"`
+	TaskType string `json:"task_type"`
+	Queue    string `json:"queue"`
+}
+
+// CloudEvent is the structured-mode JSON encoding of a CloudEvents v1.0 event.
+// ReplayOf and ReplaySeq are extension attributes set only on admin replays:
+// the ID of the first delivery replayed and how many replays led here. The
+// event ID never changes, so receivers that dedupe on it stay correct.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema"`
+	Data            json.RawMessage `json:"data"`
+	ReplayOf        string          `json:"replayof,omitempty"`
+	ReplaySeq       int             `json:"replayseq,omitempty"`
+}
+
+func NewCloudEvent(eventType, subject string, data interface{}) (CloudEvent, error) {
+	info, ok := eventTypes[eventType]
+	if !ok {
+		return CloudEvent{}, fmt.Errorf("event type %s is not registered", eventType)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(info.Data()); err != nil {
+		return CloudEvent{}, fmt.Errorf("data does not match %s: %w", info.DataSchema, err)
+	}
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          eventSource,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		DataSchema:      info.DataSchema,
+		Data:            raw,
+	}, nil
+}
+
+// --- Event Sinks & Outbox Relay ---
+
+// EventSink delivers one event. Delivery is at-least-once: a sink may see
+// the same event ID again after a timeout, so consumers dedupe on ID.
+type EventSink interface {
+	Name() string
+	Send(ctx context.Context, ev CloudEvent) error
+}
+
+// HTTPSink POSTs events in structured mode. Any non-2xx reply is a failure.
+// With a Secret, every request is signed when it is sent, as
+// X-Event-Signature: t=<unix>,v1=<hex HMAC-SHA256 of "<t>." + body>.
+// Nothing signed is stored, so a replay is signed with the current secret.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+	Secret func() ([]byte, error)
+}
+
+func (s *HTTPSink) Name() string { return "http" }
+
+func (s *HTTPSink) Send(ctx context.Context, ev CloudEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	if s.Secret != nil {
+		secret, err := s.Secret()
+		if err != nil {
+			return fmt.Errorf("load signing secret: %w", err)
+		}
+		ts := time.Now().Unix()
+		mac := hmac.New(sha256.New, secret)
+		fmt.Fprintf(mac, "%d.", ts)
+		mac.Write(body)
+		req.Header.Set("X-Event-Signature", fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil))))
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sink replied %s", resp.Status)
+	}
+	return nil
+}
+
+// RedisStreamSink appends each event to a Redis stream as a single
+// "event" field holding the structured JSON.
+type RedisStreamSink struct {
+	rdb    *redis.Client
+	Stream string
+}
+
+func (s *RedisStreamSink) Name() string { return "redis" }
+
+func (s *RedisStreamSink) Send(ctx context.Context, ev CloudEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.Stream,
+		MaxLen: 100000,
+		Approx: true,
+		Values: map[string]interface{}{"id": ev.ID, "type": ev.Type, "event": body},
+	}).Err()
+}
+
+// OutboxEntry tracks delivery of one event to every configured sink.
+// Sinks are retried independently; the entry is dropped once none are pending.
+// A sink still failing after outboxMaxAttempts is given up on and archived as
+// a failed delivery for an admin to replay.
+type OutboxEntry struct {
+	Event       CloudEvent      `json:"event"`
+	Pending     map[string]bool `json:"pending"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// eventSinkNames is fixed at startup by configureEventSinks, before any
+// request can append to the outbox.
+var eventSinkNames []string
+
+// configureEventSinks builds the sinks from CLOUDEVENTS_SINK_URL and
+// CLOUDEVENTS_STREAM. Either, both or neither may be set.
+func configureEventSinks() []EventSink {
+	var sinks []EventSink
+	if url := os.Getenv("CLOUDEVENTS_SINK_URL"); url != "" {
+		sinks = append(sinks, &HTTPSink{URL: url, Client: &http.Client{Timeout: 5 * time.Second}, Secret: signingSecretFromEnv()})
+	}
+	if stream := os.Getenv("CLOUDEVENTS_STREAM"); stream != "" {
+		sinks = append(sinks, &RedisStreamSink{rdb: redis.NewClient(&redis.Options{Addr: redisDSN}), Stream: stream})
+	}
+	if len(sinks) == 0 {
+		log.Println("WARN: no CloudEvents sink configured; domain events will be discarded")
+	}
+	eventSinkNames = eventSinkNames[:0]
+	for _, s := range sinks {
+		eventSinkNames = append(eventSinkNames, s.Name())
+	}
+	return sinks
+}
+
+// signingSecretFromEnv prefers CLOUDEVENTS_SIGNING_SECRET_FILE, which is read
+// on every send so a rotated secret takes effect without a restart, over a
+// fixed CLOUDEVENTS_SIGNING_SECRET. With neither, events go out unsigned.
+func signingSecretFromEnv() func() ([]byte, error) {
+	if path := os.Getenv("CLOUDEVENTS_SIGNING_SECRET_FILE"); path != "" {
+		return func() ([]byte, error) {
+			secret, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if secret = bytes.TrimSpace(secret); len(secret) == 0 {
+				return nil, fmt.Errorf("%s is empty", path)
+			}
+			return secret, nil
+		}
+	}
+	if secret := os.Getenv("CLOUDEVENTS_SIGNING_SECRET"); secret != "" {
+		return func() ([]byte, error) { return []byte(secret), nil }
+	}
+	return nil
+}
+
+const (
+	outboxPollInterval = time.Second
+	outboxMaxBackoff   = 5 * time.Minute
+	outboxBatchSize    = 100
+	outboxMaxAttempts  = 12
+)
+
+// OutboxRelay drains the outbox. Entries stay in the outbox until every
+// sink has accepted them, so a sink that is down only delays delivery.
+type OutboxRelay struct {
+	db    *Datastore
+	sinks []EventSink
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.deliverDue(ctx)
+		}
+	}
+}
+
+func (r *OutboxRelay) deliverDue(ctx context.Context) {
+	now := time.Now()
+	r.db.mu.RLock()
+	var due []*OutboxEntry
+	for _, e := range r.db.outbox {
+		if len(due) == outboxBatchSize {
+			break
+		}
+		if !e.NextAttempt.After(now) {
+			due = append(due, e)
+		}
+	}
+	r.db.mu.RUnlock()
+
+	for _, e := range due {
+		// Entries are only mutated by the relay goroutine; the lock keeps
+		// readers of the outbox consistent.
+		var failures []string
+		failed := make(map[string]string)
+		for _, sink := range r.sinks {
+			r.db.mu.RLock()
+			pending := e.Pending[sink.Name()]
+			r.db.mu.RUnlock()
+			if !pending {
+				continue
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			err := sink.Send(sendCtx, e.Event)
+			cancel()
+			r.db.mu.Lock()
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", sink.Name(), err))
+				failed[sink.Name()] = err.Error()
+			} else {
+				delete(e.Pending, sink.Name())
+				r.db.archiveDelivery(e, sink.Name(), DeliveryDelivered, e.Attempts+1, "")
+			}
+			r.db.mu.Unlock()
+		}
+
+		r.db.mu.Lock()
+		if len(failures) > 0 {
+			e.Attempts++
+			e.LastError = failures[0]
+			e.NextAttempt = time.Now().Add(outboxBackoff(e.Attempts))
+			log.Printf("WARN: event %s (%s) delivery attempt %d failed: %v", e.Event.ID, e.Event.Type, e.Attempts, failures)
+			if e.Attempts >= outboxMaxAttempts {
+				for sink, msg := range failed {
+					delete(e.Pending, sink)
+					r.db.archiveDelivery(e, sink, DeliveryFailed, e.Attempts, msg)
+				}
+				log.Printf("ERROR: giving up on event %s (%s) after %d attempts; replay it via /admin/events/deliveries", e.Event.ID, e.Event.Type, e.Attempts)
+			}
+		}
+		r.db.mu.Unlock()
+	}
+	r.compact()
+}
+
+// compact drops fully delivered entries and archived deliveries older than
+// deliveryRetention.
+func (r *OutboxRelay) compact() {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+	kept := r.db.outbox[:0]
+	for _, e := range r.db.outbox {
+		if len(e.Pending) > 0 {
+			kept = append(kept, e)
+		}
+	}
+	for i := len(kept); i < len(r.db.outbox); i++ {
+		r.db.outbox[i] = nil
+	}
+	r.db.outbox = kept
+
+	cutoff := time.Now().Add(-deliveryRetention)
+	expired := 0
+	for expired < len(r.db.deliveries) && r.db.deliveries[expired].CompletedAt.Before(cutoff) {
+		expired++
+	}
+	if expired > 0 {
+		r.db.deliveries = append(r.db.deliveries[:0:0], r.db.deliveries[expired:]...)
+	}
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	d := time.Second << uint(attempts-1)
+	if attempts > 20 || d > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return d
+}
+
+// --- Delivery Archive & Replay ---
+// Every finished delivery, to each sink, is archived with the full event for
+// deliveryRetention so admins can see what failed and send it again. A replay
+// goes back through the outbox to that one sink, so it gets the usual retries
+// and is archived in turn.
+
+type DeliveryStatus string
+
+const (
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// deliveryRetention is set from DELIVERY_RETENTION in main.
+var deliveryRetention = 7 * 24 * time.Hour
+
+var (
+	ErrDeliveryNotFound  = errors.New("delivery not found")
+	ErrSinkNotConfigured = errors.New("delivery's sink is no longer configured")
+)
+
+type DeliveryRecord struct {
+	ID          string         `json:"id"`
+	Sink        string         `json:"sink"`
+	Event       CloudEvent     `json:"event"`
+	Status      DeliveryStatus `json:"status"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"last_error,omitempty"`
+	CompletedAt time.Time      `json:"completed_at"`
+	ReplayedBy  string         `json:"replayed_by,omitempty"`
+	ReplayedAt  *time.Time     `json:"replayed_at,omitempty"`
+}
+
+// archiveDelivery must be called with d.mu held. Records are appended in
+// completion order, which compact relies on.
+func (d *Datastore) archiveDelivery(e *OutboxEntry, sink string, status DeliveryStatus, attempts int, lastErr string) {
+	d.deliveries = append(d.deliveries, &DeliveryRecord{
+		ID:          uuid.NewString(),
+		Sink:        sink,
+		Event:       e.Event,
+		Status:      status,
+		Attempts:    attempts,
+		LastError:   lastErr,
+		CompletedAt: time.Now(),
+	})
+}
+
+// Deliveries returns up to limit archived deliveries matching match, newest
+// first.
+func (d *Datastore) Deliveries(match func(*DeliveryRecord) bool, limit int) []DeliveryRecord {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := []DeliveryRecord{}
+	for i := len(d.deliveries) - 1; i >= 0 && len(out) < limit; i-- {
+		if match(d.deliveries[i]) {
+			out = append(out, *d.deliveries[i])
+		}
+	}
+	return out
+}
+
+// ReplayDelivery queues the archived delivery's event for its sink again,
+// tagged with replay lineage, and marks the record as replayed.
+func (d *Datastore) ReplayDelivery(id, actor string) (CloudEvent, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var rec *DeliveryRecord
+	for _, r := range d.deliveries {
+		if r.ID == id {
+			rec = r
+			break
+		}
+	}
+	if rec == nil {
+		return CloudEvent{}, ErrDeliveryNotFound
+	}
+	configured := false
+	for _, name := range eventSinkNames {
+		configured = configured || name == rec.Sink
+	}
+	if !configured {
+		return CloudEvent{}, ErrSinkNotConfigured
+	}
+
+	ev := rec.Event
+	if ev.ReplayOf == "" {
+		ev.ReplayOf = rec.ID
+	}
+	ev.ReplaySeq++
+	now := time.Now().UTC()
+	d.outbox = append(d.outbox, &OutboxEntry{Event: ev, Pending: map[string]bool{rec.Sink: true}, NextAttempt: now})
+	rec.ReplayedBy, rec.ReplayedAt = actor, &now
+	return ev, nil
+}
+
+// emit records events in the outbox. A malformed event is a programming
+// error, so it is logged rather than failing the request that caused it.
+func (app *Application) emit(eventType, subject string, data interface{}) {
+	ev, err := NewCloudEvent(eventType, subject, data)
+	if err != nil {
+		log.Printf("ERROR: dropping %s event: %v", eventType, err)
+		return
+	}
+	app.db.AppendOutbox(ev)
+}
+
+// jobCompletedMiddleware emits JobCompleted after a task handler succeeds.
+func (app *Application) jobCompletedMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		if err := next.ProcessTask(ctx, t); err != nil {
+			return err
+		}
+		taskID, _ := asynq.GetTaskID(ctx)
+		queue, _ := asynq.GetQueueName(ctx)
+		app.emit(EventJobCompleted, "jobs/"+taskID, JobCompletedData{TaskID: taskID, TaskType: t.Type(), Queue: queue})
+		return nil
+	})
+}
+
 // --- Application Context ---
 
 type AppContext struct {
@@ -87,6 +652,221 @@ func (c *AppContext) JobInspector() *asynq.Inspector {
 	return c.app.asynqInspector
 }
 
+// Admin is the ADMIN user authenticated by adminUserMiddleware.
+func (c *AppContext) Admin() *User {
+	u, _ := c.Get("admin").(*User)
+	return u
+}
+
+// --- Lifecycle ---
+
+// Component is one long-running part of the process. Start must return once
+// the component is up; background work runs in its own goroutine and
+// reports a fatal error through Lifecycle.Fail. Stop gets a context bounded
+// by StopTimeout.
+type Component struct {
+	Name        string
+	DependsOn   []string // started before this component and stopped after it
+	Start       func(ctx context.Context) error
+	Stop        func(ctx context.Context) error
+	StopTimeout time.Duration
+}
+
+// Exit codes returned by Lifecycle.Run.
+const (
+	ExitOK                 = 0
+	ExitStartFailed        = 1 // a component failed to start; the rest were stopped
+	ExitComponentFailed    = 2 // a component failed while running; shutdown completed
+	ExitShutdownIncomplete = 3 // a Stop hook failed or ran over its budget
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+// StopResult is how one component's Stop went.
+type StopResult struct {
+	Name     string
+	Took     time.Duration
+	Budget   time.Duration
+	TimedOut bool
+	Err      error
+}
+
+// Lifecycle starts components in dependency order and stops them in the
+// reverse order, each within its own budget.
+type Lifecycle struct {
+	components map[string]*Component
+	registered []string
+	started    []*Component
+	failed     chan error
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{components: make(map[string]*Component), failed: make(chan error, 1)}
+}
+
+// Register adds a component. Its StopTimeout can be overridden with
+// SHUTDOWN_TIMEOUT_<NAME>, e.g. SHUTDOWN_TIMEOUT_ASYNQ_SERVER=30s.
+func (l *Lifecycle) Register(c Component) {
+	env := "SHUTDOWN_TIMEOUT_" + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(c.Name))
+	if v := os.Getenv(env); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			c.StopTimeout = d
+		} else {
+			log.Printf("WARN: ignoring %s=%q: not a positive duration", env, v)
+		}
+	}
+	if c.StopTimeout <= 0 {
+		c.StopTimeout = defaultStopTimeout
+	}
+	if c.Stop == nil {
+		c.Stop = func(context.Context) error { return nil }
+	}
+	l.components[c.Name] = &c
+	l.registered = append(l.registered, c.Name)
+}
+
+// Fail reports that a running component has died. Only the first failure
+// is kept; it triggers shutdown in Run.
+func (l *Lifecycle) Fail(name string, err error) {
+	select {
+	case l.failed <- fmt.Errorf("%s: %w", name, err):
+	default:
+	}
+}
+
+// order sorts components so each comes after its dependencies, keeping
+// registration order otherwise.
+func (l *Lifecycle) order() ([]*Component, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var out []*Component
+	var visit func(name, from string) error
+	visit = func(name, from string) error {
+		c, ok := l.components[name]
+		if !ok {
+			return fmt.Errorf("%s depends on unknown component %q", from, name)
+		}
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through %q", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range c.DependsOn {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		out = append(out, c)
+		return nil
+	}
+	for _, name := range l.registered {
+		if err := visit(name, name); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Start starts every component. If one fails, those already started are
+// stopped again before the error is returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	ordered, err := l.order()
+	if err != nil {
+		return err
+	}
+	for _, c := range ordered {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				l.Stop(context.Background())
+				return fmt.Errorf("start %s: %w", c.Name, err)
+			}
+		}
+		l.started = append(l.started, c)
+		log.Printf("Started %s", c.Name)
+	}
+	return nil
+}
+
+// Stop stops started components in reverse start order. A component that
+// overruns its budget is reported and left behind so the others still get
+// their turn. ctx bounds the shutdown as a whole.
+func (l *Lifecycle) Stop(ctx context.Context) []StopResult {
+	var results []StopResult
+	for i := len(l.started) - 1; i >= 0; i-- {
+		results = append(results, l.stopOne(ctx, l.started[i]))
+	}
+	l.started = nil
+	return results
+}
+
+func (l *Lifecycle) stopOne(ctx context.Context, c *Component) StopResult {
+	res := StopResult{Name: c.Name, Budget: c.StopTimeout}
+	if ctx.Err() != nil {
+		res.TimedOut = true
+		log.Printf("ERROR: %s not stopped: the shutdown deadline has passed", c.Name)
+		return res
+	}
+	stopCtx, cancel := context.WithTimeout(ctx, c.StopTimeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.Stop(stopCtx) }()
+	select {
+	case res.Err = <-done:
+		res.TimedOut = errors.Is(res.Err, context.DeadlineExceeded)
+	case <-stopCtx.Done():
+		res.TimedOut = true
+	}
+	res.Took = time.Since(start)
+	switch {
+	case res.TimedOut:
+		log.Printf("ERROR: %s exceeded its %s stop budget (gave up after %s)", c.Name, c.StopTimeout, res.Took.Round(time.Millisecond))
+	case res.Err != nil:
+		log.Printf("ERROR: stopping %s failed after %s: %v", c.Name, res.Took.Round(time.Millisecond), res.Err)
+	default:
+		log.Printf("Stopped %s in %s", c.Name, res.Took.Round(time.Millisecond))
+	}
+	return res
+}
+
+// Run starts the components, waits for SIGINT/SIGTERM or a component
+// failure, stops everything within shutdownTimeout and returns the exit code.
+func (l *Lifecycle) Run(shutdownTimeout time.Duration) int {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	if err := l.Start(context.Background()); err != nil {
+		log.Printf("FATAL: %v", err)
+		return ExitStartFailed
+	}
+	code := ExitOK
+	select {
+	case sig := <-quit:
+		log.Printf("Received %s, shutting down...", sig)
+	case err := <-l.failed:
+		log.Printf("ERROR: %v; shutting down...", err)
+		code = ExitComponentFailed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, r := range l.Stop(ctx) {
+		if r.TimedOut || r.Err != nil {
+			code = ExitShutdownIncomplete
+		}
+	}
+	log.Printf("Shutdown complete (exit %d).", code)
+	return code
+}
+
 // --- Application Container ---
 
 type Application struct {
@@ -96,8 +876,13 @@ type Application struct {
 	asynqServer    *asynq.Server
 	asynqScheduler *asynq.Scheduler
 	asynqInspector *asynq.Inspector
+	outboxRelay    *OutboxRelay
 }
 
+// workerDrainTimeout is how long asynq lets in-flight tasks finish on
+// shutdown before handing them back to the queue.
+const workerDrainTimeout = 15 * time.Second
+
 func NewApplication() *Application {
 	redisOpt := asynq.RedisClientOpt{Addr: redisDSN}
 	
@@ -108,10 +893,12 @@ func NewApplication() *Application {
 		asynqInspector: asynq.NewInspector(redisOpt),
 		asynqScheduler: asynq.NewScheduler(redisOpt, &asynq.SchedulerOpts{}),
 		asynqServer: asynq.NewServer(redisOpt, asynq.Config{
-			Concurrency:    20,
-			RetryDelayFunc: asynq.DefaultRetryDelayFunc, // Exponential backoff
+			Concurrency:     20,
+			RetryDelayFunc:  asynq.DefaultRetryDelayFunc, // Exponential backoff
+			ShutdownTimeout: workerDrainTimeout,
 		}),
 	}
+	app.outboxRelay = &OutboxRelay{db: app.db, sinks: configureEventSinks()}
 
 	app.echo.Use(middleware.Logger())
 	app.echo.Use(func(h echo.HandlerFunc) echo.HandlerFunc {
@@ -124,54 +911,108 @@ func NewApplication() *Application {
 	return app
 }
 
-func (app *Application) Start() {
+// Lifecycle registers routes and task handlers and returns the components to
+// run. They stop in reverse: the HTTP server and scheduler stop taking new
+// work first, the asynq server drains in-flight tasks, and the outbox relay
+// goes last so that events emitted while draining are still delivered.
+func (app *Application) Lifecycle() *Lifecycle {
 	// Register API routes
 	apiHandlers := &APIHandler{app: app}
 	app.echo.POST("/users", apiHandlers.HandleCreateUser)
 	app.echo.POST("/posts/:id/publish", apiHandlers.HandlePublishPost)
 	app.echo.GET("/jobs/:id", apiHandlers.HandleGetJobStatus)
 
+	admin := app.echo.Group("/admin", adminUserMiddleware(app.db))
+	admin.POST("/jobs/:id/retry", apiHandlers.HandleRetryJob)
+	admin.GET("/jobs/:id/lineage", apiHandlers.HandleGetJobLineage)
+	admin.GET("/audit", apiHandlers.HandleGetAuditLog)
+	admin.GET("/events/outbox", apiHandlers.HandleGetOutbox)
+	admin.GET("/events/deliveries", apiHandlers.HandleListDeliveries)
+	admin.POST("/events/deliveries/replay", apiHandlers.HandleReplayFailedDeliveries)
+	admin.POST("/events/deliveries/:id/replay", apiHandlers.HandleReplayDelivery)
+
 	// Register Task handlers
 	taskHandlers := &TaskHandler{app: app}
 	mux := asynq.NewServeMux()
+	mux.Use(app.jobCompletedMiddleware)
 	mux.Handle(TaskSendWelcomeEmail, taskHandlers)
 	mux.Handle(TaskProcessImage, taskHandlers)
 	mux.Handle(TaskWatermarkImage, taskHandlers)
 	mux.Handle(TaskGenerateReport, taskHandlers)
 
-	// Register Periodic tasks
-	_, err := app.asynqScheduler.Register("@hourly", NewGenerateReportTask())
-	if err != nil {
-		log.Fatalf("FATAL: could not register periodic task: %v", err)
-	}
+	lc := NewLifecycle()
+	lc.Register(Component{
+		Name: "asynq-client",
+		Stop: func(context.Context) error {
+			app.asynqInspector.Close()
+			return app.asynqClient.Close()
+		},
+	})
 
-	// Start services in goroutines
-	go func() {
-		if err := app.asynqServer.Run(mux); err != nil {
-			log.Fatalf("FATAL: asynq server error: %v", err)
-		}
-	}()
-	go func() {
-		if err := app.asynqScheduler.Run(); err != nil {
-			log.Fatalf("FATAL: asynq scheduler error: %v", err)
-		}
-	}()
-	go func() {
-		if err := app.echo.Start(":8080"); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("FATAL: echo server error: %v", err)
-		}
-	}()
-}
+	relayDone := make(chan struct{})
+	var stopRelay context.CancelFunc
+	lc.Register(Component{
+		Name: "outbox-relay",
+		Start: func(context.Context) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			stopRelay = cancel
+			go func() {
+				defer close(relayDone)
+				app.outboxRelay.Run(ctx)
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopRelay()
+			<-relayDone
+			// One last pass for events emitted during shutdown.
+			app.outboxRelay.deliverDue(ctx)
+			return ctx.Err()
+		},
+		StopTimeout: 15 * time.Second,
+	})
 
-func (app *Application) Shutdown(ctx context.Context) {
-	log.Println("Shutting down application...")
-	app.asynqScheduler.Shutdown()
-	app.asynqServer.Shutdown()
-	if err := app.echo.Shutdown(ctx); err != nil {
-		log.Printf("WARN: echo shutdown error: %v", err)
-	}
-	app.asynqClient.Close()
-	log.Println("Shutdown complete.")
+	// Task handlers chain follow-up tasks and emit JobCompleted events.
+	lc.Register(Component{
+		Name:      "asynq-server",
+		DependsOn: []string{"asynq-client", "outbox-relay"},
+		Start:     func(context.Context) error { return app.asynqServer.Start(mux) },
+		Stop: func(context.Context) error {
+			app.asynqServer.Shutdown()
+			return nil
+		},
+		StopTimeout: workerDrainTimeout + 5*time.Second,
+	})
+
+	lc.Register(Component{
+		Name:      "scheduler",
+		DependsOn: []string{"asynq-server"},
+		Start: func(context.Context) error {
+			if _, err := app.asynqScheduler.Register("@hourly", NewGenerateReportTask()); err != nil {
+				return fmt.Errorf("register periodic task: %w", err)
+			}
+			return app.asynqScheduler.Start()
+		},
+		Stop: func(context.Context) error {
+			app.asynqScheduler.Shutdown()
+			return nil
+		},
+	})
+
+	lc.Register(Component{
+		Name:      "http",
+		DependsOn: []string{"asynq-client", "outbox-relay"},
+		Start: func(context.Context) error {
+			go func() {
+				if err := app.echo.Start(":8080"); err != nil && err != http.ErrServerClosed {
+					lc.Fail("http", err)
+				}
+			}()
+			return nil
+		},
+		Stop: app.echo.Shutdown,
+	})
+	return lc
 }
 
 // --- API Handlers ---
@@ -187,10 +1028,12 @@ func (h *APIHandler) HandleCreateUser(c echo.Context) error {
 		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
 	}
 
-	user := &User{ID: uuid.New(), Email: body.Email, CreatedAt: time.Now()}
-	cc.DB().mu.Lock()
-	cc.DB().users[user.ID] = user
-	cc.DB().mu.Unlock()
+	user := &User{ID: uuid.New(), Email: body.Email, PasswordHash: hashPassword(body.Password), Role: RoleUser, IsActive: true, CreatedAt: time.Now()}
+	registered, err := NewCloudEvent(EventUserRegistered, "users/"+user.ID.String(), UserRegisteredData{UserID: user.ID, Email: user.Email})
+	if err != nil {
+		return cc.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to build event"})
+	}
+	cc.DB().CreateUser(user, registered)
 
 	task := NewWelcomeEmailTask(user.ID)
 	info, err := cc.JobQueue().Enqueue(task, asynq.MaxRetry(5), asynq.Timeout(time.Minute))
@@ -213,6 +1056,7 @@ func (h *APIHandler) HandlePublishPost(c echo.Context) error {
 	if err != nil {
 		return cc.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to enqueue job"})
 	}
+	h.app.emit(EventPostPublished, "posts/"+postID.String(), PostPublishedData{PostID: postID, TaskID: info.ID})
 
 	return cc.JSON(http.StatusAccepted, echo.Map{"message": "image processing started", "task_id": info.ID})
 }
@@ -227,6 +1071,285 @@ func (h *APIHandler) HandleGetJobStatus(c echo.Context) error {
 	return cc.JSON(http.StatusOK, info)
 }
 
+// --- Admin: Manual Retry ---
+
+func hashPassword(password string) string {
+	return "hashed:" + password
+}
+
+// adminUserMiddleware admits HTTP Basic credentials of an active ADMIN user
+// and keeps that user for AppContext.Admin.
+func adminUserMiddleware(db *Datastore) echo.MiddlewareFunc {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "admin",
+		Validator: func(email, password string, c echo.Context) (bool, error) {
+			admin, ok := db.AdminByCredentials(email, password)
+			if ok {
+				c.Set("admin", admin)
+			}
+			return ok, nil
+		},
+	})
+}
+
+// seedAdminUser creates the ADMIN user named by ADMIN_EMAIL and
+// ADMIN_PASSWORD, if both are set.
+func seedAdminUser(db *Datastore) {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; admin API disabled")
+		return
+	}
+	db.CreateUser(&User{ID: uuid.New(), Email: email, PasswordHash: hashPassword(password), Role: RoleAdmin, IsActive: true, CreatedAt: time.Now()})
+}
+
+// HandleRetryJob re-enqueues a failed task, optionally with a patched
+// payload. Only archived tasks and tasks waiting to retry can be retried; a
+// task still waiting to retry is archived first so it cannot run twice.
+//
+//	POST /admin/jobs/:id/retry?queue=default
+//	{"reason": "fix bad post id", "payload": {"post_id": "..."}}
+func (h *APIHandler) HandleRetryJob(c echo.Context) error {
+	cc := c.(*AppContext)
+	taskID := cc.Param("id")
+	queue := cc.QueryParam("queue")
+	if queue == "" {
+		queue = "default"
+	}
+	var body struct {
+		Reason  string          `json:"reason"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := cc.Bind(&body); err != nil {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	if body.Reason == "" {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "reason is required"})
+	}
+	actor := cc.Admin().ID.String()
+
+	info, err := cc.JobInspector().GetTaskInfo(queue, taskID)
+	if err != nil {
+		return cc.JSON(http.StatusNotFound, echo.Map{"error": "job not found"})
+	}
+	if info.State != asynq.TaskStateArchived && info.State != asynq.TaskStateRetry {
+		return cc.JSON(http.StatusConflict, echo.Map{"error": fmt.Sprintf("job is %s; only failed jobs can be retried", info.State)})
+	}
+
+	payload := info.Payload
+	patched := len(body.Payload) > 0 && string(body.Payload) != "null"
+	if patched {
+		payload = body.Payload
+	}
+	payload, err = validateTaskPayload(info.Type, payload)
+	if err != nil {
+		return cc.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+	}
+
+	if info.State == asynq.TaskStateRetry {
+		if err := cc.JobInspector().ArchiveTask(queue, taskID); err != nil {
+			return cc.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to archive original job"})
+		}
+	}
+
+	lineage := &TaskLineage{
+		TaskID:         uuid.NewString(),
+		OriginalTaskID: taskID,
+		RootTaskID:     taskID,
+		Queue:          queue,
+		ManualRetry:    1,
+		PayloadPatched: patched,
+		RetriedBy:      actor,
+		RetriedAt:      time.Now().UTC(),
+	}
+	if parent, ok := cc.DB().Lineage(taskID); ok {
+		lineage.RootTaskID = parent.RootTaskID
+		lineage.ManualRetry = parent.ManualRetry + 1
+	}
+
+	newInfo, err := cc.JobQueue().Enqueue(asynq.NewTask(info.Type, payload),
+		asynq.TaskID(lineage.TaskID),
+		asynq.Queue(queue),
+		asynq.MaxRetry(info.MaxRetry),
+		asynq.Timeout(info.Timeout),
+	)
+	if err != nil {
+		return cc.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to enqueue job"})
+	}
+
+	entry := AuditEntry{
+		ID:        uuid.New(),
+		At:        lineage.RetriedAt,
+		Actor:     actor,
+		Action:    "job.manual_retry",
+		TaskID:    taskID,
+		NewTaskID: newInfo.ID,
+		Reason:    body.Reason,
+	}
+	if patched {
+		entry.PreviousPayload = json.RawMessage(info.Payload)
+		entry.NewPayload = json.RawMessage(payload)
+	}
+	cc.DB().RecordRetry(lineage, entry)
+	log.Printf("AUDIT: %s manually retried task %s as %s (patched=%t): %s", actor, taskID, newInfo.ID, patched, body.Reason)
+
+	return cc.JSON(http.StatusAccepted, echo.Map{"task_id": newInfo.ID, "lineage": lineage})
+}
+
+func (h *APIHandler) HandleGetJobLineage(c echo.Context) error {
+	cc := c.(*AppContext)
+	lineage, ok := cc.DB().Lineage(cc.Param("id"))
+	if !ok {
+		return cc.JSON(http.StatusNotFound, echo.Map{"error": "job has no retry lineage"})
+	}
+	return cc.JSON(http.StatusOK, lineage)
+}
+
+func (h *APIHandler) HandleGetAuditLog(c echo.Context) error {
+	cc := c.(*AppContext)
+	return cc.JSON(http.StatusOK, cc.DB().AuditLog())
+}
+
+// HandleGetOutbox lists events not yet accepted by every sink.
+func (h *APIHandler) HandleGetOutbox(c echo.Context) error {
+	cc := c.(*AppContext)
+	db := cc.DB()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	entries := make([]OutboxEntry, 0, len(db.outbox))
+	for _, e := range db.outbox {
+		copied := *e
+		copied.Pending = make(map[string]bool, len(e.Pending))
+		for k, v := range e.Pending {
+			copied.Pending[k] = v
+		}
+		entries = append(entries, copied)
+	}
+	cc.Response().Header().Set("X-Outbox-Size", strconv.Itoa(len(entries)))
+	return cc.JSON(http.StatusOK, echo.Map{"sinks": eventSinkNames, "entries": entries})
+}
+
+// --- Admin: Event Delivery Replay ---
+
+const maxDeliveryPage = 500
+
+func deliveryLimit(c echo.Context, def int) (int, bool) {
+	v := c.QueryParam("limit")
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n >= 1 && n <= maxDeliveryPage
+}
+
+// HandleListDeliveries lists archived deliveries, newest first.
+//
+//	GET /admin/events/deliveries?status=failed&sink=http&limit=50
+func (h *APIHandler) HandleListDeliveries(c echo.Context) error {
+	cc := c.(*AppContext)
+	status := DeliveryStatus(cc.QueryParam("status"))
+	if status != "" && status != DeliveryDelivered && status != DeliveryFailed {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "status must be delivered or failed"})
+	}
+	limit, ok := deliveryLimit(cc, 50)
+	if !ok {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeliveryPage)})
+	}
+	sink := cc.QueryParam("sink")
+	records := cc.DB().Deliveries(func(r *DeliveryRecord) bool {
+		return (status == "" || r.Status == status) && (sink == "" || r.Sink == sink)
+	}, limit)
+	return cc.JSON(http.StatusOK, echo.Map{"retention": deliveryRetention.String(), "deliveries": records})
+}
+
+type replayRequest struct {
+	Reason string `json:"reason"`
+	Sink   string `json:"sink"`
+	Limit  int    `json:"limit"`
+}
+
+// replay queues one delivery again and audits it.
+func (h *APIHandler) replay(cc *AppContext, id, actor, reason string) (CloudEvent, error) {
+	ev, err := cc.DB().ReplayDelivery(id, actor)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+	cc.DB().AppendAudit(AuditEntry{
+		ID:         uuid.New(),
+		At:         time.Now().UTC(),
+		Actor:      actor,
+		Action:     "event.replay",
+		DeliveryID: id,
+		EventID:    ev.ID,
+		Reason:     reason,
+	})
+	log.Printf("AUDIT: %s replayed delivery %s of event %s (replay %d): %s", actor, id, ev.ID, ev.ReplaySeq, reason)
+	return ev, nil
+}
+
+// HandleReplayDelivery replays one archived delivery, failed or not.
+//
+//	POST /admin/events/deliveries/:id/replay
+//	{"reason": "receiver lost its data"}
+func (h *APIHandler) HandleReplayDelivery(c echo.Context) error {
+	cc := c.(*AppContext)
+	var body replayRequest
+	if err := cc.Bind(&body); err != nil {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	if body.Reason == "" {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "reason is required"})
+	}
+	ev, err := h.replay(cc, cc.Param("id"), cc.Admin().ID.String(), body.Reason)
+	switch {
+	case errors.Is(err, ErrDeliveryNotFound):
+		return cc.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+	case errors.Is(err, ErrSinkNotConfigured):
+		return cc.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	case err != nil:
+		return cc.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to replay delivery"})
+	}
+	return cc.JSON(http.StatusAccepted, echo.Map{"event": ev})
+}
+
+// HandleReplayFailedDeliveries replays failed deliveries that have not been
+// replayed yet, oldest first, optionally for one sink.
+//
+//	POST /admin/events/deliveries/replay
+//	{"reason": "receiver back after outage", "sink": "http", "limit": 100}
+func (h *APIHandler) HandleReplayFailedDeliveries(c echo.Context) error {
+	cc := c.(*AppContext)
+	var body replayRequest
+	if err := cc.Bind(&body); err != nil {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	if body.Reason == "" {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": "reason is required"})
+	}
+	if body.Limit == 0 {
+		body.Limit = 100
+	}
+	if body.Limit < 1 || body.Limit > maxDeliveryPage {
+		return cc.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxDeliveryPage)})
+	}
+	candidates := cc.DB().Deliveries(func(r *DeliveryRecord) bool {
+		return r.Status == DeliveryFailed && r.ReplayedAt == nil && (body.Sink == "" || r.Sink == body.Sink)
+	}, body.Limit)
+
+	actor := cc.Admin().ID.String()
+	replayed := []string{}
+	skipped := map[string]string{}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		id := candidates[i].ID
+		if _, err := h.replay(cc, id, actor, body.Reason); err != nil {
+			skipped[id] = err.Error()
+			continue
+		}
+		replayed = append(replayed, id)
+	}
+	return cc.JSON(http.StatusAccepted, echo.Map{"replayed": replayed, "skipped": skipped})
+}
+
 // --- Task Definitions & Handlers ---
 
 const (
@@ -255,6 +1378,62 @@ func NewGenerateReportTask() *asynq.Task {
 	return asynq.NewTask(TaskGenerateReport, nil)
 }
 
+// Payload schemas, used to validate payloads patched in by an admin.
+
+type userTaskPayload struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (p *userTaskPayload) validate() error {
+	if p.UserID == uuid.Nil {
+		return errors.New("user_id is required")
+	}
+	return nil
+}
+
+type postTaskPayload struct {
+	PostID uuid.UUID `json:"post_id"`
+}
+
+func (p *postTaskPayload) validate() error {
+	if p.PostID == uuid.Nil {
+		return errors.New("post_id is required")
+	}
+	return nil
+}
+
+// validateTaskPayload strictly decodes raw against the schema for taskType
+// and returns it re-encoded, so unknown or mistyped fields never reach a
+// worker.
+func validateTaskPayload(taskType string, raw []byte) ([]byte, error) {
+	var schema interface{ validate() error }
+	switch taskType {
+	case TaskSendWelcomeEmail:
+		schema = &userTaskPayload{}
+	case TaskProcessImage, TaskWatermarkImage:
+		schema = &postTaskPayload{}
+	case TaskGenerateReport:
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || string(trimmed) == "null" || string(trimmed) == "{}" {
+			return nil, nil
+		}
+		return nil, errors.New("task:report:generate takes no payload")
+	default:
+		return nil, fmt.Errorf("no payload schema for task type %s", taskType)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(schema); err != nil {
+		return nil, fmt.Errorf("payload does not match %s schema: %w", taskType, err)
+	}
+	if dec.More() {
+		return nil, errors.New("payload has trailing data")
+	}
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(schema)
+}
+
 type TaskHandler struct {
 	app *Application
 }
@@ -293,15 +1472,25 @@ func (h *TaskHandler) ProcessTask(ctx context.Context, t *asynq.Task) error {
 
 // --- Main Execution ---
 
+// SHUTDOWN_TIMEOUT bounds the whole shutdown (default 30s); see
+// Lifecycle.Register for per-component budgets.
 func main() {
+	shutdownTimeout := 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("FATAL: SHUTDOWN_TIMEOUT must be a positive duration, got %q", v)
+		}
+		shutdownTimeout = d
+	}
+	if v := os.Getenv("DELIVERY_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("FATAL: DELIVERY_RETENTION must be a positive duration, got %q", v)
+		}
+		deliveryRetention = d
+	}
 	app := NewApplication()
-	app.Start()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	app.Shutdown(ctx)
+	seedAdminUser(app.db)
+	os.Exit(app.Lifecycle().Run(shutdownTimeout))
 }
\ No newline at end of file
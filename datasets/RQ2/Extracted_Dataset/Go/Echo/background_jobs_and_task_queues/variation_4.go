@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -33,13 +39,88 @@ var (
 
 // --- Domain ---
 type User struct {
-	ID    uuid.UUID `json:"id"`
-	Email string    `json:"email"`
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
 }
 type Post struct {
-	ID     uuid.UUID `json:"id"`
-	UserID uuid.UUID `json:"user_id"`
-	Title  string    `json:"title"`
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Title     string    `json:"title"`
+	Published bool      `json:"published"`
+}
+
+func hashPassword(pw string) string {
+	sum := sha256.Sum256([]byte(pw)) // demo only, use bcrypt in production
+	return hex.EncodeToString(sum[:])
+}
+
+// --- Events ---
+// Every domain event is appended to an in-process audit log, indexed by user.
+// Snippets are denormalized at publish time so the feed needs no lookups.
+const (
+	EVT_USER_REGISTERED = "user.registered"
+	EVT_USER_LOGIN      = "user.login"
+	EVT_POST_CREATED    = "post.created"
+	EVT_POST_PUBLISHED  = "post.published"
+	EVT_IMAGE_PROCESSED = "image.processed"
+)
+
+type Event struct {
+	ID      uuid.UUID              `json:"id"`
+	Type    string                 `json:"type"`
+	UserID  uuid.UUID              `json:"user_id"`
+	At      time.Time              `json:"at"`
+	Snippet map[string]interface{} `json:"snippet"`
+}
+
+var events = struct {
+	sync.RWMutex
+	byUser map[uuid.UUID][]Event // append-only, oldest first
+}{
+	byUser: make(map[uuid.UUID][]Event),
+}
+
+func publish(typ string, userID uuid.UUID, snippet map[string]interface{}) {
+	ev := Event{ID: uuid.New(), Type: typ, UserID: userID, At: time.Now().UTC(), Snippet: snippet}
+	events.Lock()
+	events.byUser[userID] = append(events.byUser[userID], ev)
+	events.Unlock()
+}
+
+// activityPage walks a user's events newest first. The cursor is the log
+// position to continue below, which stays valid because the log only grows.
+func activityPage(userID uuid.UUID, types map[string]bool, before, limit int) ([]Event, int) {
+	events.RLock()
+	defer events.RUnlock()
+	userEvents := events.byUser[userID]
+	if before < 0 || before > len(userEvents) {
+		before = len(userEvents)
+	}
+	page := []Event{}
+	i := before - 1
+	for ; i >= 0 && len(page) < limit; i-- {
+		if len(types) == 0 || types[userEvents[i].Type] {
+			page = append(page, userEvents[i])
+		}
+	}
+	if i < 0 {
+		return page, -1 // no more pages
+	}
+	return page, i + 1
+}
+
+func encodeCursor(pos int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(pos)))
+}
+
+func decodeCursor(cursor string) (int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	pos, err := strconv.Atoi(string(raw))
+	return pos, err == nil && pos >= 0
 }
 
 // --- Task Definitions ---
@@ -91,6 +172,13 @@ func main() {
 		json.Unmarshal(t.Payload(), &p)
 		log.Printf("TASK: Watermarking image for post %v", p.PostID)
 		time.Sleep(2 * time.Second)
+		// Watermarking is the last step, so the image is now fully processed
+		db.RLock()
+		post, ok := db.posts[p.PostID]
+		db.RUnlock()
+		if ok {
+			publish(EVT_IMAGE_PROCESSED, post.UserID, map[string]interface{}{"post_id": post.ID, "post_title": post.Title})
+		}
 		return nil
 	})
 	mux.HandleFunc(TASK_SYS_CLEANUP, func(ctx context.Context, t *asynq.Task) error {
@@ -107,12 +195,13 @@ func main() {
 	// --- Web Server ---
 	e := echo.New()
 	e.POST("/users", func(c echo.Context) error {
-		var req struct{ Email string }
+		var req struct{ Email, Password string }
 		c.Bind(&req)
-		u := User{ID: uuid.New(), Email: req.Email}
+		u := User{ID: uuid.New(), Email: req.Email, PasswordHash: hashPassword(req.Password)}
 		db.Lock()
 		db.users[u.ID] = u
 		db.Unlock()
+		publish(EVT_USER_REGISTERED, u.ID, map[string]interface{}{"email": u.Email})
 
 		payload, _ := json.Marshal(EmailPayload{UserID: u.ID})
 		task := asynq.NewTask(TASK_EMAIL_WELCOME, payload, asynq.MaxRetry(10))
@@ -122,6 +211,98 @@ func main() {
 		}
 		return c.JSON(201, map[string]interface{}{"user": u, "taskId": info.ID})
 	})
+	e.POST("/login", func(c echo.Context) error {
+		var req struct{ Email, Password string }
+		c.Bind(&req)
+		var found *User
+		db.RLock()
+		for _, u := range db.users {
+			if u.Email == req.Email {
+				u := u
+				found = &u
+				break
+			}
+		}
+		db.RUnlock()
+		if found == nil || subtle.ConstantTimeCompare([]byte(found.PasswordHash), []byte(hashPassword(req.Password))) != 1 {
+			return c.JSON(401, map[string]string{"err": "invalid credentials"})
+		}
+		publish(EVT_USER_LOGIN, found.ID, map[string]interface{}{"ip": c.RealIP(), "user_agent": c.Request().UserAgent()})
+		return c.JSON(200, map[string]interface{}{"user": found})
+	})
+	e.POST("/posts", func(c echo.Context) error {
+		var req struct {
+			UserID uuid.UUID `json:"user_id"`
+			Title  string    `json:"title"`
+		}
+		if err := c.Bind(&req); err != nil || req.Title == "" {
+			return c.JSON(400, map[string]string{"err": "user_id and title are required"})
+		}
+		db.Lock()
+		if _, ok := db.users[req.UserID]; !ok {
+			db.Unlock()
+			return c.JSON(404, map[string]string{"err": "user not found"})
+		}
+		p := Post{ID: uuid.New(), UserID: req.UserID, Title: req.Title}
+		db.posts[p.ID] = p
+		db.Unlock()
+		publish(EVT_POST_CREATED, p.UserID, map[string]interface{}{"post_id": p.ID, "post_title": p.Title})
+		return c.JSON(201, p)
+	})
+	e.POST("/posts/:id/publish", func(c echo.Context) error {
+		id, _ := uuid.Parse(c.Param("id"))
+		db.Lock()
+		p, ok := db.posts[id]
+		if !ok {
+			db.Unlock()
+			return c.JSON(404, map[string]string{"err": "post not found"})
+		}
+		alreadyPublished := p.Published
+		p.Published = true
+		db.posts[id] = p
+		db.Unlock()
+		if !alreadyPublished {
+			publish(EVT_POST_PUBLISHED, p.UserID, map[string]interface{}{"post_id": p.ID, "post_title": p.Title})
+		}
+		return c.JSON(200, p)
+	})
+	// Query: ?types=post.created,user.login&limit=20&cursor=<next_cursor>
+	e.GET("/users/:id/activity", func(c echo.Context) error {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return c.JSON(400, map[string]string{"err": "invalid user id"})
+		}
+		db.RLock()
+		_, ok := db.users[id]
+		db.RUnlock()
+		if !ok {
+			return c.JSON(404, map[string]string{"err": "user not found"})
+		}
+
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+		before := -1
+		if cur := c.QueryParam("cursor"); cur != "" {
+			if before, ok = decodeCursor(cur); !ok {
+				return c.JSON(400, map[string]string{"err": "invalid cursor"})
+			}
+		}
+		types := map[string]bool{}
+		for _, t := range strings.Split(c.QueryParam("types"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types[t] = true
+			}
+		}
+
+		page, next := activityPage(id, types, before, limit)
+		resp := map[string]interface{}{"events": page, "next_cursor": nil}
+		if next >= 0 {
+			resp["next_cursor"] = encodeCursor(next)
+		}
+		return c.JSON(200, resp)
+	})
 	e.POST("/posts/:id/process", func(c echo.Context) error {
 		id, _ := uuid.Parse(c.Param("id"))
 		payload, _ := json.Marshal(ImgPayload{PostID: id})
@@ -2,9 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
 	"time"
 
 	"github.com/google/uuid"
@@ -46,13 +56,68 @@ type Role struct {
 	Name RoleName `gorm:"uniqueIndex;not null"`
 }
 
+// Post listings read idx_posts_org_created in order; see orderBy.
 type Post struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primary_key;"`
-	UserID    uuid.UUID  `gorm:"type:uuid;not null"`
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;index:idx_posts_org_created,priority:3"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null"`                               // author
+	OrgID     *uuid.UUID `gorm:"type:uuid;index:idx_posts_org_created,priority:1"` // set when an organization owns the post
 	Title     string     `gorm:"not null"`
 	Content   string
 	Status    PostStatus `gorm:"default:'DRAFT'"`
-	CreatedAt time.Time
+	CreatedAt time.Time  `gorm:"index:idx_posts_org_created,priority:2"`
+	// CommentCount is denormalized and refreshed by the CommentCountRefresher.
+	CommentCount int `gorm:"default:0"`
+}
+
+type Comment struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;index:idx_comments_post_created,priority:3"`
+	PostID    uuid.UUID  `gorm:"type:uuid;not null;index:idx_comments_post_created,priority:1"`
+	ParentID  *uuid.UUID `gorm:"type:uuid;index"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null"`
+	Body      string     `gorm:"not null"`
+	CreatedAt time.Time  `gorm:"index:idx_comments_post_created,priority:2"`
+	Depth     int        `gorm:"->;-:migration" json:"depth"` // populated by FindThread only
+	Replies   []*Comment `gorm:"-" json:"replies,omitempty"`
+}
+
+// OrgRole is a member's role within one organization. Owners manage the
+// organization and its members; editors manage its posts; viewers can read
+// its drafts.
+type OrgRole string
+
+const (
+	OrgOwner  OrgRole = "OWNER"
+	OrgEditor OrgRole = "EDITOR"
+	OrgViewer OrgRole = "VIEWER"
+)
+
+var orgRoleRank = map[OrgRole]int{OrgViewer: 1, OrgEditor: 2, OrgOwner: 3}
+
+// AtLeast reports whether r grants everything min does.
+func (r OrgRole) AtLeast(min OrgRole) bool {
+	return orgRoleRank[r] >= orgRoleRank[min]
+}
+
+type Organization struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
+	Name        string    `gorm:"uniqueIndex;not null"`
+	CreatedAt   time.Time
+	Memberships []Membership `gorm:"foreignKey:OrgID"`
+}
+
+// Membership links a user to an organization. An invited member has no
+// AcceptedAt and no rights until they accept.
+type Membership struct {
+	OrgID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Role       OrgRole   `gorm:"not null"`
+	InvitedBy  uuid.UUID `gorm:"type:uuid"`
+	CreatedAt  time.Time
+	AcceptedAt *time.Time
+}
+
+func (m *Membership) Active() bool {
+	return m != nil && m.AcceptedAt != nil
 }
 
 // GORM hook to generate UUID before creating a record
@@ -66,6 +131,223 @@ func (p *Post) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+func (c *Comment) BeforeCreate(tx *gorm.DB) (err error) {
+	c.ID = uuid.New()
+	return
+}
+
+func (o *Organization) BeforeCreate(tx *gorm.DB) (err error) {
+	o.ID = uuid.New()
+	return
+}
+
+// --- 1a. ROW-LEVEL SECURITY ---
+
+// Principal is who a repository call acts for. The principal middleware
+// attaches one to every request, anonymous when the caller sent no
+// credentials; background work runs as the system principal, which no policy
+// restricts.
+type Principal struct {
+	UserID uuid.UUID
+	System bool
+}
+
+type principalKey struct{}
+
+var ErrNoPrincipal = errors.New("no principal in context")
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// SystemContext runs ctx on behalf of the application itself.
+func SystemContext(ctx context.Context) context.Context {
+	return WithPrincipal(ctx, Principal{System: true})
+}
+
+// PrincipalFrom fails closed: a repository reached without a principal
+// returns ErrNoPrincipal rather than unfiltered rows.
+func PrincipalFrom(ctx context.Context) (Principal, error) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	if !ok {
+		return Principal{}, ErrNoPrincipal
+	}
+	return p, nil
+}
+
+// RowPolicy decides which rows of one table a principal may see and change.
+// Organizations are the tenants; memberships are what policies are evaluated
+// against, so that table is left to OrgService.
+type RowPolicy interface {
+	// ReadScope narrows a query to the rows p may read.
+	ReadScope(db *gorm.DB, p Principal) *gorm.DB
+	// WriteScope narrows an update or delete to the rows p may change.
+	WriteScope(db *gorm.DB, p Principal) *gorm.DB
+	// CheckCreate rejects a new row p may not insert.
+	CheckCreate(db *gorm.DB, p Principal, row interface{}) error
+}
+
+// memberOrgs selects the organizations where userID holds at least min.
+func memberOrgs(db *gorm.DB, userID uuid.UUID, min OrgRole) *gorm.DB {
+	var roles []OrgRole
+	for role := range orgRoleRank {
+		if role.AtLeast(min) {
+			roles = append(roles, role)
+		}
+	}
+	return db.Session(&gorm.Session{NewDB: true}).Model(&Membership{}).Select("org_id").
+		Where("user_id = ? AND accepted_at IS NOT NULL AND role IN ?", userID, roles)
+}
+
+// PostPolicy: published posts are public. Drafts are visible to the author of
+// a personal post or to the members of the owning organization, and only the
+// author or the organization's editors may change a post.
+type PostPolicy struct{}
+
+func (PostPolicy) ReadScope(db *gorm.DB, p Principal) *gorm.DB {
+	return db.Where("(posts.status = ? OR (posts.org_id IS NULL AND posts.user_id = ?) OR posts.org_id IN (?))",
+		PublishedStatus, p.UserID, memberOrgs(db, p.UserID, OrgViewer))
+}
+
+func (PostPolicy) WriteScope(db *gorm.DB, p Principal) *gorm.DB {
+	return db.Where("((posts.org_id IS NULL AND posts.user_id = ?) OR posts.org_id IN (?))",
+		p.UserID, memberOrgs(db, p.UserID, OrgEditor))
+}
+
+func (PostPolicy) CheckCreate(db *gorm.DB, p Principal, row interface{}) error {
+	post := row.(*Post)
+	if post.UserID != p.UserID {
+		return fmt.Errorf("%w: posts are created by their author", ErrForbidden)
+	}
+	if post.OrgID == nil {
+		return nil
+	}
+	var n int64
+	if err := memberOrgs(db, p.UserID, OrgEditor).Where("org_id = ?", *post.OrgID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: requires %s role in organization", ErrForbidden, OrgEditor)
+	}
+	return nil
+}
+
+// CommentPolicy inherits visibility from the post. A comment may be deleted
+// by whoever wrote it or by anyone who may change its post.
+type CommentPolicy struct {
+	posts RowPolicy
+}
+
+func (cp CommentPolicy) postIDs(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&Post{}).Select("posts.id")
+}
+
+func (cp CommentPolicy) ReadScope(db *gorm.DB, p Principal) *gorm.DB {
+	return db.Where("comments.post_id IN (?)", cp.posts.ReadScope(cp.postIDs(db), p))
+}
+
+func (cp CommentPolicy) WriteScope(db *gorm.DB, p Principal) *gorm.DB {
+	return db.Where("(comments.user_id = ? OR comments.post_id IN (?))", p.UserID, cp.posts.WriteScope(cp.postIDs(db), p))
+}
+
+func (cp CommentPolicy) CheckCreate(db *gorm.DB, p Principal, row interface{}) error {
+	comment := row.(*Comment)
+	if comment.UserID != p.UserID {
+		return fmt.Errorf("%w: comments are created by their author", ErrForbidden)
+	}
+	var n int64
+	if err := cp.posts.ReadScope(cp.postIDs(db), p).Where("posts.id = ?", comment.PostID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// OrgPolicy shows an organization to its members and lets its owners change
+// it. Anyone may create one.
+type OrgPolicy struct{}
+
+func (OrgPolicy) ReadScope(db *gorm.DB, p Principal) *gorm.DB {
+	return db.Where("organizations.id IN (?)", memberOrgs(db, p.UserID, OrgViewer))
+}
+
+func (OrgPolicy) WriteScope(db *gorm.DB, p Principal) *gorm.DB {
+	return db.Where("organizations.id IN (?)", memberOrgs(db, p.UserID, OrgOwner))
+}
+
+func (OrgPolicy) CheckCreate(db *gorm.DB, p Principal, row interface{}) error {
+	if p.UserID == uuid.Nil {
+		return fmt.Errorf("%w: sign in to create an organization", ErrForbidden)
+	}
+	return nil
+}
+
+// scoped binds db to ctx and applies the policy's read or write scope for the
+// principal in ctx.
+func scoped(ctx context.Context, db *gorm.DB, policy RowPolicy, write bool) (*gorm.DB, error) {
+	p, err := PrincipalFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db = db.WithContext(ctx)
+	switch {
+	case p.System:
+		return db, nil
+	case write:
+		return policy.WriteScope(db, p), nil
+	default:
+		return policy.ReadScope(db, p), nil
+	}
+}
+
+func checkCreate(ctx context.Context, db *gorm.DB, policy RowPolicy, row interface{}) error {
+	p, err := PrincipalFrom(ctx)
+	if err != nil || p.System {
+		return err
+	}
+	return policy.CheckCreate(db.WithContext(ctx), p, row)
+}
+
+// requireSystem guards raw statements that no policy can scope.
+func requireSystem(ctx context.Context) error {
+	p, err := PrincipalFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.System {
+		return fmt.Errorf("%w: system principal required", ErrForbidden)
+	}
+	return nil
+}
+
+// denied explains why a write scope matched nothing. A row the principal can
+// read is forbidden; anything else reports as not found, so rows of other
+// tenants are indistinguishable from missing ones.
+func denied(ctx context.Context, db *gorm.DB, policy RowPolicy, model interface{}, id uuid.UUID) error {
+	read, err := scoped(ctx, db, policy, false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if err := read.Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: not permitted by row policy", ErrForbidden)
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// writeResult returns denied when a scoped update or delete matched no row.
+func writeResult(ctx context.Context, db *gorm.DB, policy RowPolicy, model interface{}, id uuid.UUID, res *gorm.DB) error {
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return denied(ctx, db, policy, model, id)
+}
+
 // --- 2. REPOSITORY (Data Access Layer) ---
 
 type UserRepository struct {
@@ -82,7 +364,7 @@ func (r *UserRepository) FindAll(ctx context.Context, filters map[string]interfa
 	if isActive, ok := filters["is_active"]; ok {
 		query = query.Where("is_active = ?", isActive)
 	}
-	err := query.Find(&users).Error
+	err := query.Order("created_at, id").Find(&users).Error
 	return users, err
 }
 
@@ -105,18 +387,375 @@ func (r *UserRepository) FindRoleByName(ctx context.Context, name RoleName) (*Ro
 	return &role, err
 }
 
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 type PostRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	policy RowPolicy
 }
 
-func NewPostRepository(db *gorm.DB) *PostRepository {
-	return &PostRepository{db: db}
+func NewPostRepository(db *gorm.DB, policy RowPolicy) *PostRepository {
+	return &PostRepository{db: db, policy: policy}
 }
 
 func (r *PostRepository) Create(ctx context.Context, post *Post) error {
+	if err := checkCreate(ctx, r.db, r.policy, post); err != nil {
+		return err
+	}
 	return r.db.WithContext(ctx).Create(post).Error
 }
 
+func (r *PostRepository) FindByID(ctx context.Context, id uuid.UUID) (*Post, error) {
+	query, err := scoped(ctx, r.db, r.policy, false)
+	if err != nil {
+		return nil, err
+	}
+	var post Post
+	if err := query.First(&post, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *PostRepository) Update(ctx context.Context, post *Post) error {
+	query, err := scoped(ctx, r.db, r.policy, true)
+	if err != nil {
+		return err
+	}
+	res := query.Model(post).Select("Title", "Content", "Status").Updates(post)
+	return writeResult(ctx, r.db, r.policy, &Post{}, post.ID, res)
+}
+
+func (r *PostRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query, err := scoped(ctx, r.db, r.policy, true)
+	if err != nil {
+		return err
+	}
+	return writeResult(ctx, r.db, r.policy, &Post{}, id, query.Delete(&Post{}, "id = ?", id))
+}
+
+// FindByOrg lists the organization's posts the principal may read in the
+// given order, DefaultPostSort when empty: drafts appear for members only.
+func (r *PostRepository) FindByOrg(ctx context.Context, orgID uuid.UUID, order []SortKey, limit, offset int) ([]Post, error) {
+	query, err := scoped(ctx, r.db, r.policy, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) == 0 {
+		order = DefaultPostSort
+	}
+	var posts []Post
+	err = query.Where("org_id = ?", orgID).Order(orderBy(order)).Limit(limit).Offset(offset).Find(&posts).Error
+	return posts, err
+}
+
+type OrgRepository struct {
+	db     *gorm.DB
+	policy RowPolicy
+}
+
+func NewOrgRepository(db *gorm.DB, policy RowPolicy) *OrgRepository {
+	return &OrgRepository{db: db, policy: policy}
+}
+
+func (r *OrgRepository) CreateInTx(ctx context.Context, tx *gorm.DB, org *Organization) error {
+	if err := checkCreate(ctx, tx, r.policy, org); err != nil {
+		return err
+	}
+	return tx.WithContext(ctx).Create(org).Error
+}
+
+func (r *OrgRepository) FindByID(ctx context.Context, id uuid.UUID) (*Organization, error) {
+	query, err := scoped(ctx, r.db, r.policy, false)
+	if err != nil {
+		return nil, err
+	}
+	var org Organization
+	if err := query.Preload("Memberships").First(&org, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// FindAll lists the organizations the principal is an accepted member of.
+func (r *OrgRepository) FindAll(ctx context.Context) ([]Organization, error) {
+	query, err := scoped(ctx, r.db, r.policy, false)
+	if err != nil {
+		return nil, err
+	}
+	var orgs []Organization
+	err = query.Order("organizations.name").Find(&orgs).Error
+	return orgs, err
+}
+
+func (r *OrgRepository) Rename(ctx context.Context, id uuid.UUID, name string) error {
+	query, err := scoped(ctx, r.db, r.policy, true)
+	if err != nil {
+		return err
+	}
+	res := query.Model(&Organization{}).Where("id = ?", id).Update("name", name)
+	return writeResult(ctx, r.db, r.policy, &Organization{}, id, res)
+}
+
+// DeleteInTx removes the organization and its memberships. Its posts fall
+// back to being owned by their authors.
+func (r *OrgRepository) DeleteInTx(ctx context.Context, tx *gorm.DB, id uuid.UUID) error {
+	query, err := scoped(ctx, tx, r.policy, true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if err := query.Model(&Organization{}).Where("id = ?", id).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return denied(ctx, tx, r.policy, &Organization{}, id)
+	}
+	tx = tx.WithContext(ctx)
+	if err := tx.Model(&Post{}).Where("org_id = ?", id).Update("org_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("org_id = ?", id).Delete(&Membership{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&Organization{}, "id = ?", id).Error
+}
+
+func (r *OrgRepository) FindMembership(ctx context.Context, orgID, userID uuid.UUID) (*Membership, error) {
+	var m Membership
+	err := r.db.WithContext(ctx).First(&m, "org_id = ? AND user_id = ?", orgID, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *OrgRepository) SaveMembership(ctx context.Context, tx *gorm.DB, m *Membership) error {
+	return tx.WithContext(ctx).Save(m).Error
+}
+
+func (r *OrgRepository) DeleteMembership(ctx context.Context, tx *gorm.DB, orgID, userID uuid.UUID) error {
+	return tx.WithContext(ctx).Delete(&Membership{}, "org_id = ? AND user_id = ?", orgID, userID).Error
+}
+
+func (r *OrgRepository) CountOwnersInTx(ctx context.Context, tx *gorm.DB, orgID uuid.UUID) (int64, error) {
+	var n int64
+	err := tx.WithContext(ctx).Model(&Membership{}).
+		Where("org_id = ? AND role = ? AND accepted_at IS NOT NULL", orgID, OrgOwner).Count(&n).Error
+	return n, err
+}
+
+// RefreshCommentCounts spans tenants and is reserved for the system principal.
+func (r *PostRepository) RefreshCommentCounts(ctx context.Context, postIDs []uuid.UUID) error {
+	if err := requireSystem(ctx); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Exec(
+		`UPDATE posts SET comment_count = (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id) WHERE id IN ?`,
+		postIDs,
+	).Error
+}
+
+type CommentRepository struct {
+	db     *gorm.DB
+	policy CommentPolicy
+}
+
+func NewCommentRepository(db *gorm.DB, policy CommentPolicy) *CommentRepository {
+	return &CommentRepository{db: db, policy: policy}
+}
+
+// Create inserts the comment in the same transaction that finds its post, so
+// a comment never points at a missing post and the denormalized count cannot
+// drift. A missing post is gorm.ErrRecordNotFound.
+func (r *CommentRepository) Create(ctx context.Context, comment *Comment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&Post{}).Where("id = ?", comment.PostID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := checkCreate(ctx, tx, r.policy, comment); err != nil {
+			return err
+		}
+		return tx.Create(comment).Error
+	})
+}
+
+func (r *CommentRepository) FindByID(ctx context.Context, id uuid.UUID) (*Comment, error) {
+	query, err := scoped(ctx, r.db, r.policy, false)
+	if err != nil {
+		return nil, err
+	}
+	var comment Comment
+	if err := query.First(&comment, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// FindThread pages over the top-level comments of a post and pulls in their
+// replies up to maxDepth levels below them with a recursive CTE. The CTE
+// cannot carry the policy, but a thread never leaves its post, so the post is
+// checked against the principal's read scope first.
+func (r *CommentRepository) FindThread(ctx context.Context, postID uuid.UUID, maxDepth, limit, offset int) ([]*Comment, error) {
+	posts, err := scoped(ctx, r.db, r.policy.posts, false)
+	if err != nil {
+		return nil, err
+	}
+	var visible int64
+	if err := posts.Model(&Post{}).Where("id = ?", postID).Count(&visible).Error; err != nil {
+		return nil, err
+	}
+	if visible == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var rows []Comment
+	err = r.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE thread AS (
+			SELECT * FROM (
+				SELECT id, post_id, parent_id, user_id, body, created_at, 0 AS depth
+				FROM comments
+				WHERE post_id = ? AND parent_id IS NULL
+				ORDER BY created_at, id
+				LIMIT ? OFFSET ?
+			)
+			UNION ALL
+			SELECT c.id, c.post_id, c.parent_id, c.user_id, c.body, c.created_at, t.depth + 1
+			FROM comments c JOIN thread t ON c.parent_id = t.id
+			WHERE t.depth < ?
+		)
+		SELECT * FROM thread ORDER BY depth, created_at, id`,
+		postID, limit, offset, maxDepth,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows arrive ordered by depth, so every parent is indexed before its replies.
+	byID := make(map[uuid.UUID]*Comment, len(rows))
+	var roots []*Comment
+	for i := range rows {
+		comment := &rows[i]
+		byID[comment.ID] = comment
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+	return roots, nil
+}
+
+// DeleteSubtree removes a comment together with all of its replies, once the
+// principal's write scope admits the comment itself.
+func (r *CommentRepository) DeleteSubtree(ctx context.Context, id uuid.UUID) (int64, error) {
+	query, err := scoped(ctx, r.db, r.policy, true)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if err := query.Model(&Comment{}).Where("id = ?", id).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, denied(ctx, r.db, r.policy, &Comment{}, id)
+	}
+	res := r.db.WithContext(ctx).Exec(`
+		DELETE FROM comments WHERE id IN (
+			WITH RECURSIVE subtree(id) AS (
+				SELECT ?
+				UNION ALL
+				SELECT c.id FROM comments c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree
+		)`, id)
+	return res.RowsAffected, res.Error
+}
+
+// --- 2a. LIST ORDERING ---
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// SortKey orders a listing by one field, descending when Desc is set.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// postSortColumns maps the fields ?sort= accepts on post listings to columns.
+var postSortColumns = map[string]string{
+	"created_at": "created_at",
+	"title":      "title",
+	"status":     "status",
+}
+
+// DefaultPostSort lists posts newest first.
+var DefaultPostSort = []SortKey{{Field: "created_at", Desc: true}}
+
+// ParsePostSort reads a comma-separated list such as "status,-created_at",
+// where a leading "-" sorts that field descending. An empty string yields
+// DefaultPostSort.
+func ParsePostSort(s string) ([]SortKey, error) {
+	if s == "" {
+		return DefaultPostSort, nil
+	}
+	var keys []SortKey
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		key := SortKey{Field: strings.TrimSpace(part)}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field, key.Desc = key.Field[1:], true
+		}
+		if _, ok := postSortColumns[key.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, key.Field)
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("%w: %q given twice", ErrInvalidSort, key.Field)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// orderBy renders keys as an ORDER BY clause that always ends in id. Posts
+// created in the same instant otherwise come back in whatever order the
+// planner picks, and OFFSET pages repeat some of them and skip others.
+//
+// id takes the direction of the last key, so the default order, and plain
+// created_at, are read straight off idx_posts_org_created with no sort step.
+// Orders led by title or status are sorted per request; if one becomes
+// common, give it its own (org_id, <field>, created_at, id) index.
+func orderBy(keys []SortKey) string {
+	parts := make([]string, 0, len(keys)+1)
+	dir := ""
+	for _, key := range keys {
+		column, ok := postSortColumns[key.Field]
+		if !ok {
+			continue
+		}
+		dir = ""
+		if key.Desc {
+			dir = " DESC"
+		}
+		parts = append(parts, column+dir)
+	}
+	return strings.Join(append(parts, "id"+dir), ", ")
+}
+
 // --- 3. SERVICE (Business Logic Layer) ---
 
 type UserService struct {
@@ -140,7 +779,7 @@ func (s *UserService) CreateUserWithRole(ctx context.Context, email, password st
 		// Create the user
 		newUser := &User{
 			Email:        email,
-			PasswordHash: "hashed_" + password, // In real app, use bcrypt
+			PasswordHash: hashPassword(password),
 			IsActive:     true,
 			Roles:        []*Role{role},
 		}
@@ -160,33 +799,366 @@ func (s *UserService) CreateUserWithRole(ctx context.Context, email, password st
 	return user, nil
 }
 
-// --- 4. HANDLER (Presentation Layer) ---
-
-type UserHandler struct {
-	userService    *UserService
-	userRepository *UserRepository
-}
-
-func NewUserHandler(userService *UserService, userRepo *UserRepository) *UserHandler {
-	return &UserHandler{userService: userService, userRepository: userRepo}
+// hashPassword stands in for bcrypt, which a production build would use.
+func hashPassword(password string) string {
+	return "hashed_" + password
 }
 
-func (h *UserHandler) CreateUser(c echo.Context) error {
-	type request struct {
-		Email    string   `json:"email"`
-		Password string   `json:"password"`
-		Role     RoleName `json:"role"`
+// Authenticate checks email and password against the stored hash. Unknown
+// emails, wrong passwords and inactive accounts all fail the same way.
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
 	}
-	req := new(request)
-	if err := c.Bind(req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	if subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte(hashPassword(password))) != 1 || !user.IsActive {
+		return nil, ErrInvalidCredentials
 	}
+	return user, nil
+}
 
-	user, err := h.userService.CreateUserWithRole(c.Request().Context(), req.Email, req.Password, req.Role)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-	return c.JSON(http.StatusCreated, user)
+type CommentService struct {
+	commentRepository *CommentRepository
+	counter           *CommentCountRefresher
+}
+
+func NewCommentService(commentRepo *CommentRepository, counter *CommentCountRefresher) *CommentService {
+	return &CommentService{commentRepository: commentRepo, counter: counter}
+}
+
+func (s *CommentService) AddComment(ctx context.Context, postID, userID uuid.UUID, parentID *uuid.UUID, body string) (*Comment, error) {
+	if parentID != nil {
+		parent, err := s.commentRepository.FindByID(ctx, *parentID)
+		if err != nil {
+			return nil, fmt.Errorf("parent comment not found: %w", err)
+		}
+		if parent.PostID != postID {
+			return nil, fmt.Errorf("parent comment belongs to a different post")
+		}
+	}
+
+	comment := &Comment{PostID: postID, UserID: userID, ParentID: parentID, Body: body}
+	if err := s.commentRepository.Create(ctx, comment); err != nil {
+		return nil, err
+	}
+	s.counter.MarkDirty(postID)
+	return comment, nil
+}
+
+func (s *CommentService) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	comment, err := s.commentRepository.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.commentRepository.DeleteSubtree(ctx, id); err != nil {
+		return err
+	}
+	s.counter.MarkDirty(comment.PostID)
+	return nil
+}
+
+var (
+	ErrForbidden          = errors.New("forbidden")
+	ErrConflict           = errors.New("conflict")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// OrgService owns organization lifecycle and membership rules. Membership
+// changes check the actor's role here; the organization rows themselves are
+// guarded by OrgPolicy in the repository.
+type OrgService struct {
+	db             *gorm.DB
+	orgRepository  *OrgRepository
+	userRepository *UserRepository
+}
+
+func NewOrgService(db *gorm.DB, orgRepo *OrgRepository, userRepo *UserRepository) *OrgService {
+	return &OrgService{db: db, orgRepository: orgRepo, userRepository: userRepo}
+}
+
+// requireRole returns the actor's membership if it is active and at least min.
+func (s *OrgService) requireRole(ctx context.Context, orgID, actorID uuid.UUID, min OrgRole) (*Membership, error) {
+	m, err := s.orgRepository.FindMembership(ctx, orgID, actorID)
+	if err == gorm.ErrRecordNotFound || (err == nil && !(m.Active() && m.Role.AtLeast(min))) {
+		return nil, fmt.Errorf("%w: requires %s role in organization", ErrForbidden, min)
+	}
+	return m, err
+}
+
+// CreateOrg creates the organization with the creator as its first owner.
+func (s *OrgService) CreateOrg(ctx context.Context, actorID uuid.UUID, name string) (*Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrConflict)
+	}
+	org := &Organization{Name: name}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.orgRepository.CreateInTx(ctx, tx, org); errors.Is(err, ErrForbidden) || errors.Is(err, ErrNoPrincipal) {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("%w: organization name taken", ErrConflict)
+		}
+		now := time.Now()
+		owner := &Membership{OrgID: org.ID, UserID: actorID, Role: OrgOwner, InvitedBy: actorID, AcceptedAt: &now}
+		if err := s.orgRepository.SaveMembership(ctx, tx, owner); err != nil {
+			return err
+		}
+		org.Memberships = []Membership{*owner}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (s *OrgService) RenameOrg(ctx context.Context, orgID uuid.UUID, name string) (*Organization, error) {
+	err := s.orgRepository.Rename(ctx, orgID, strings.TrimSpace(name))
+	if errors.Is(err, ErrForbidden) || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrNoPrincipal) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: organization name taken", ErrConflict)
+	}
+	return s.orgRepository.FindByID(ctx, orgID)
+}
+
+func (s *OrgService) DeleteOrg(ctx context.Context, orgID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.orgRepository.DeleteInTx(ctx, tx, orgID)
+	})
+}
+
+// InviteMember invites an existing user by email, or changes the role of
+// someone already invited or a member.
+func (s *OrgService) InviteMember(ctx context.Context, actorID, orgID uuid.UUID, email string, role OrgRole) (*Membership, error) {
+	if _, ok := orgRoleRank[role]; !ok {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrConflict, role)
+	}
+	if _, err := s.requireRole(ctx, orgID, actorID, OrgOwner); err != nil {
+		return nil, err
+	}
+	invitee, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	var m *Membership
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		existing, err := s.orgRepository.FindMembership(ctx, orgID, invitee.ID)
+		if err == gorm.ErrRecordNotFound {
+			existing = &Membership{OrgID: orgID, UserID: invitee.ID, InvitedBy: actorID}
+		} else if err != nil {
+			return err
+		}
+		if existing.Active() && existing.Role == OrgOwner && role != OrgOwner {
+			if err := s.ensureAnotherOwner(ctx, tx, orgID); err != nil {
+				return err
+			}
+		}
+		existing.Role = role
+		m = existing
+		return s.orgRepository.SaveMembership(ctx, tx, existing)
+	})
+	return m, err
+}
+
+func (s *OrgService) AcceptInvitation(ctx context.Context, actorID, orgID uuid.UUID) (*Membership, error) {
+	m, err := s.orgRepository.FindMembership(ctx, orgID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Active() {
+		return m, nil
+	}
+	now := time.Now()
+	m.AcceptedAt = &now
+	if err := s.orgRepository.SaveMembership(ctx, s.db, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RemoveMember removes a member or revokes an invitation. Owners may remove
+// anyone and members may remove themselves, but never the last owner.
+func (s *OrgService) RemoveMember(ctx context.Context, actorID, orgID, userID uuid.UUID) error {
+	if actorID != userID {
+		if _, err := s.requireRole(ctx, orgID, actorID, OrgOwner); err != nil {
+			return err
+		}
+	}
+	target, err := s.orgRepository.FindMembership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if target.Active() && target.Role == OrgOwner {
+			if err := s.ensureAnotherOwner(ctx, tx, orgID); err != nil {
+				return err
+			}
+		}
+		return s.orgRepository.DeleteMembership(ctx, tx, orgID, userID)
+	})
+}
+
+func (s *OrgService) ensureAnotherOwner(ctx context.Context, tx *gorm.DB, orgID uuid.UUID) error {
+	owners, err := s.orgRepository.CountOwnersInTx(ctx, tx, orgID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return fmt.Errorf("%w: an organization must keep at least one owner", ErrConflict)
+	}
+	return nil
+}
+
+// PostService edits posts; who may see or change which post is PostPolicy's
+// decision, enforced by the repository.
+type PostService struct {
+	postRepository *PostRepository
+}
+
+func NewPostService(postRepo *PostRepository) *PostService {
+	return &PostService{postRepository: postRepo}
+}
+
+func (s *PostService) CreatePost(ctx context.Context, actorID uuid.UUID, orgID *uuid.UUID, title, content string) (*Post, error) {
+	post := &Post{UserID: actorID, OrgID: orgID, Title: title, Content: content, Status: DraftStatus}
+	if err := s.postRepository.Create(ctx, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+type PostUpdate struct {
+	Title   *string     `json:"title"`
+	Content *string     `json:"content"`
+	Status  *PostStatus `json:"status"`
+}
+
+func (s *PostService) UpdatePost(ctx context.Context, postID uuid.UUID, update PostUpdate) (*Post, error) {
+	post, err := s.postRepository.FindByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if update.Title != nil {
+		post.Title = *update.Title
+	}
+	if update.Content != nil {
+		post.Content = *update.Content
+	}
+	if update.Status != nil {
+		if *update.Status != DraftStatus && *update.Status != PublishedStatus {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrConflict, *update.Status)
+		}
+		post.Status = *update.Status
+	}
+	if err := s.postRepository.Update(ctx, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (s *PostService) DeletePost(ctx context.Context, postID uuid.UUID) error {
+	return s.postRepository.Delete(ctx, postID)
+}
+
+func (s *PostService) ListOrgPosts(ctx context.Context, orgID uuid.UUID, order []SortKey, limit, offset int) ([]Post, error) {
+	return s.postRepository.FindByOrg(ctx, orgID, order, limit, offset)
+}
+
+// --- 3a. BACKGROUND TASKS ---
+
+// CommentCountRefresher keeps Post.CommentCount fresh without touching the
+// posts table on every comment write: writers mark posts dirty and a ticker
+// recomputes their counts in one batch.
+type CommentCountRefresher struct {
+	postRepository *PostRepository
+	interval       time.Duration
+
+	mu    sync.Mutex
+	dirty map[uuid.UUID]struct{}
+}
+
+func NewCommentCountRefresher(postRepo *PostRepository, interval time.Duration) *CommentCountRefresher {
+	return &CommentCountRefresher{
+		postRepository: postRepo,
+		interval:       interval,
+		dirty:          make(map[uuid.UUID]struct{}),
+	}
+}
+
+func (r *CommentCountRefresher) MarkDirty(postID uuid.UUID) {
+	r.mu.Lock()
+	r.dirty[postID] = struct{}{}
+	r.mu.Unlock()
+}
+
+func (r *CommentCountRefresher) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.flush(ctx)
+			}
+		}
+	}()
+}
+
+func (r *CommentCountRefresher) flush(ctx context.Context) {
+	r.mu.Lock()
+	if len(r.dirty) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	postIDs := make([]uuid.UUID, 0, len(r.dirty))
+	for id := range r.dirty {
+		postIDs = append(postIDs, id)
+	}
+	r.dirty = make(map[uuid.UUID]struct{})
+	r.mu.Unlock()
+
+	if err := r.postRepository.RefreshCommentCounts(SystemContext(ctx), postIDs); err != nil {
+		log.Printf("Failed to refresh comment counts: %v", err)
+		// Re-queue so the next tick retries.
+		for _, id := range postIDs {
+			r.MarkDirty(id)
+		}
+	}
+}
+
+// --- 4. HANDLER (Presentation Layer) ---
+
+type UserHandler struct {
+	userService    *UserService
+	userRepository *UserRepository
+}
+
+func NewUserHandler(userService *UserService, userRepo *UserRepository) *UserHandler {
+	return &UserHandler{userService: userService, userRepository: userRepo}
+}
+
+func (h *UserHandler) CreateUser(c echo.Context) error {
+	type request struct {
+		Email    string   `json:"email"`
+		Password string   `json:"password"`
+		Role     RoleName `json:"role"`
+	}
+	req := new(request)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	user, err := h.userService.CreateUserWithRole(c.Request().Context(), req.Email, req.Password, req.Role)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, user)
 }
 
 func (h *UserHandler) GetUsers(c echo.Context) error {
@@ -218,9 +1190,745 @@ func (h *UserHandler) GetUserByID(c echo.Context) error {
 	return c.JSON(http.StatusOK, user)
 }
 
+// principalMiddleware authenticates the caller from HTTP Basic credentials
+// (email and password) and attaches them as the request's principal.
+// Requests without credentials get an anonymous principal that only sees
+// public rows; wrong credentials are rejected rather than downgraded.
+func principalMiddleware(users *UserService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			var principal Principal
+			if email, password, ok := req.BasicAuth(); ok {
+				user, err := users.Authenticate(req.Context(), email, password)
+				if errors.Is(err, ErrInvalidCredentials) {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="api"`)
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+				} else if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not authenticate"})
+				}
+				principal.UserID = user.ID
+			}
+			c.SetRequest(req.WithContext(WithPrincipal(req.Context(), principal)))
+			return next(c)
+		}
+	}
+}
+
+// actorID returns the authenticated caller that principalMiddleware
+// attached; anonymous requests get a 401.
+func actorID(c echo.Context) (uuid.UUID, error) {
+	p, err := PrincipalFrom(c.Request().Context())
+	if err != nil || p.UserID == uuid.Nil {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="api"`)
+		return uuid.Nil, echo.NewHTTPError(http.StatusUnauthorized, "authentication required")
+	}
+	return p.UserID, nil
+}
+
+// serviceError maps service and repository errors onto responses.
+func serviceError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrForbidden):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Not found"})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+type OrgHandler struct {
+	orgService    *OrgService
+	orgRepository *OrgRepository
+	postService   *PostService
+}
+
+func NewOrgHandler(orgService *OrgService, orgRepo *OrgRepository, postService *PostService) *OrgHandler {
+	return &OrgHandler{orgService: orgService, orgRepository: orgRepo, postService: postService}
+}
+
+// idRequest resolves the caller and the :id path parameter.
+func idRequest(c echo.Context) (actor, id uuid.UUID, err error) {
+	if actor, err = actorID(c); err != nil {
+		return
+	}
+	if id, err = uuid.Parse(c.Param("id")); err != nil {
+		err = echo.NewHTTPError(http.StatusBadRequest, "Invalid UUID format")
+	}
+	return
+}
+
+func (h *OrgHandler) CreateOrg(c echo.Context) error {
+	actor, err := actorID(c)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	org, err := h.orgService.CreateOrg(c.Request().Context(), actor, req.Name)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, org)
+}
+
+func (h *OrgHandler) ListMyOrgs(c echo.Context) error {
+	if _, err := actorID(c); err != nil {
+		return err
+	}
+	orgs, err := h.orgRepository.FindAll(c.Request().Context())
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, orgs)
+}
+
+func (h *OrgHandler) GetOrg(c echo.Context) error {
+	_, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	org, err := h.orgRepository.FindByID(c.Request().Context(), orgID)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, org)
+}
+
+func (h *OrgHandler) RenameOrg(c echo.Context) error {
+	_, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	org, err := h.orgService.RenameOrg(c.Request().Context(), orgID, req.Name)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, org)
+}
+
+func (h *OrgHandler) DeleteOrg(c echo.Context) error {
+	_, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	if err := h.orgService.DeleteOrg(c.Request().Context(), orgID); err != nil {
+		return serviceError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *OrgHandler) InviteMember(c echo.Context) error {
+	actor, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Email string  `json:"email"`
+		Role  OrgRole `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Role == "" {
+		req.Role = OrgViewer
+	}
+	m, err := h.orgService.InviteMember(c.Request().Context(), actor, orgID, req.Email, req.Role)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, m)
+}
+
+func (h *OrgHandler) AcceptInvitation(c echo.Context) error {
+	actor, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	m, err := h.orgService.AcceptInvitation(c.Request().Context(), actor, orgID)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, m)
+}
+
+func (h *OrgHandler) RemoveMember(c echo.Context) error {
+	actor, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid UUID format"})
+	}
+	if err := h.orgService.RemoveMember(c.Request().Context(), actor, orgID, userID); err != nil {
+		return serviceError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *OrgHandler) ListOrgPosts(c echo.Context) error {
+	_, orgID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	order, err := ParsePostSort(c.QueryParam("sort"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	page := queryInt(c, "page", 1, 1, math.MaxInt32)
+	pageSize := queryInt(c, "page_size", defaultPostPageSize, 1, maxPostPageSize)
+	posts, err := h.postService.ListOrgPosts(c.Request().Context(), orgID, order, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"data": posts, "page": page, "page_size": pageSize})
+}
+
+const (
+	defaultPostPageSize = 20
+	maxPostPageSize     = 100
+)
+
+type PostHandler struct {
+	postService *PostService
+}
+
+func NewPostHandler(postService *PostService) *PostHandler {
+	return &PostHandler{postService: postService}
+}
+
+func (h *PostHandler) CreatePost(c echo.Context) error {
+	actor, err := actorID(c)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Title   string     `json:"title"`
+		Content string     `json:"content"`
+		OrgID   *uuid.UUID `json:"org_id"`
+	}
+	if err := c.Bind(&req); err != nil || req.Title == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	post, err := h.postService.CreatePost(c.Request().Context(), actor, req.OrgID, req.Title, req.Content)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, post)
+}
+
+func (h *PostHandler) UpdatePost(c echo.Context) error {
+	_, postID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	var update PostUpdate
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	post, err := h.postService.UpdatePost(c.Request().Context(), postID, update)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, post)
+}
+
+func (h *PostHandler) DeletePost(c echo.Context) error {
+	_, postID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+	if err := h.postService.DeletePost(c.Request().Context(), postID); err != nil {
+		return serviceError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type CommentHandler struct {
+	commentService    *CommentService
+	commentRepository *CommentRepository
+}
+
+func NewCommentHandler(commentService *CommentService, commentRepo *CommentRepository) *CommentHandler {
+	return &CommentHandler{commentService: commentService, commentRepository: commentRepo}
+}
+
+const (
+	defaultCommentDepth    = 3
+	maxCommentDepth        = 10
+	defaultCommentPageSize = 20
+	maxCommentPageSize     = 100
+)
+
+// queryInt reads an integer query parameter, falling back to def and clamping to [lo, hi].
+func queryInt(c echo.Context, name string, def, lo, hi int) int {
+	v, err := strconv.Atoi(c.QueryParam(name))
+	if err != nil {
+		return def
+	}
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func (h *CommentHandler) CreateComment(c echo.Context) error {
+	actor, postID, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+
+	type request struct {
+		UserID   uuid.UUID  `json:"user_id"`
+		ParentID *uuid.UUID `json:"parent_id"`
+		Body     string     `json:"body"`
+	}
+	req := new(request)
+	if err := c.Bind(req); err != nil || req.Body == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.UserID == uuid.Nil {
+		req.UserID = actor
+	}
+
+	comment, err := h.commentService.AddComment(c.Request().Context(), postID, req.UserID, req.ParentID, req.Body)
+	if errors.Is(err, ErrForbidden) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return serviceError(c, err)
+	} else if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, comment)
+}
+
+func (h *CommentHandler) ListComments(c echo.Context) error {
+	postID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid UUID format"})
+	}
+
+	depth := queryInt(c, "depth", defaultCommentDepth, 0, maxCommentDepth)
+	page := queryInt(c, "page", 1, 1, math.MaxInt32)
+	pageSize := queryInt(c, "page_size", defaultCommentPageSize, 1, maxCommentPageSize)
+
+	comments, err := h.commentRepository.FindThread(c.Request().Context(), postID, depth, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":      comments,
+		"page":      page,
+		"page_size": pageSize,
+		"depth":     depth,
+	})
+}
+
+func (h *CommentHandler) DeleteComment(c echo.Context) error {
+	_, id, err := idRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.commentService.DeleteComment(c.Request().Context(), id); err != nil {
+		return serviceError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// --- 4a. ROW POLICY TESTS ---
+// Run with: go run . selftest -test.v
+
+// rlsFixture holds two tenants, each an organization with one owner and a
+// draft post, plus a published post in tenant A.
+type rlsFixture struct {
+	db        *gorm.DB
+	posts     *PostRepository
+	comments  *CommentRepository
+	orgs      *OrgRepository
+	alice     context.Context // owner of org A
+	bob       context.Context // owner of org B
+	orgA      *Organization
+	orgB      *Organization
+	draftA    *Post
+	draftB    *Post
+	publicA   *Post
+	commentA  *Comment
+	bobUserID uuid.UUID
+}
+
+func newRLSFixture(t *testing.T) *rlsFixture {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&User{}, &Post{}, &Role{}, &Comment{}, &Organization{}, &Membership{}); err != nil {
+		t.Fatal(err)
+	}
+	postPolicy := PostPolicy{}
+	f := &rlsFixture{
+		db:       db,
+		posts:    NewPostRepository(db, postPolicy),
+		comments: NewCommentRepository(db, CommentPolicy{posts: postPolicy}),
+		orgs:     NewOrgRepository(db, OrgPolicy{}),
+	}
+	sys := SystemContext(context.Background())
+	aliceID, bobID := uuid.New(), uuid.New()
+	f.bobUserID = bobID
+	f.alice = WithPrincipal(context.Background(), Principal{UserID: aliceID})
+	f.bob = WithPrincipal(context.Background(), Principal{UserID: bobID})
+
+	now := time.Now()
+	f.orgA, f.orgB = &Organization{Name: "tenant-a"}, &Organization{Name: "tenant-b"}
+	for _, o := range []struct {
+		org   *Organization
+		owner uuid.UUID
+	}{{f.orgA, aliceID}, {f.orgB, bobID}} {
+		if err := f.orgs.CreateInTx(sys, db, o.org); err != nil {
+			t.Fatal(err)
+		}
+		m := &Membership{OrgID: o.org.ID, UserID: o.owner, Role: OrgOwner, InvitedBy: o.owner, AcceptedAt: &now}
+		if err := f.orgs.SaveMembership(sys, db, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.draftA = &Post{UserID: aliceID, OrgID: &f.orgA.ID, Title: "a draft", Status: DraftStatus}
+	f.publicA = &Post{UserID: aliceID, OrgID: &f.orgA.ID, Title: "a public", Status: PublishedStatus}
+	f.draftB = &Post{UserID: bobID, OrgID: &f.orgB.ID, Title: "b draft", Status: DraftStatus}
+	for _, p := range []*Post{f.draftA, f.publicA, f.draftB} {
+		if err := f.posts.Create(sys, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.commentA = &Comment{PostID: f.draftA.ID, UserID: aliceID, Body: "internal"}
+	if err := f.comments.Create(sys, f.commentA); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func wantErr(t *testing.T, what string, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func testPostsDoNotLeakAcrossTenants(t *testing.T) {
+	f := newRLSFixture(t)
+	_, err := f.posts.FindByID(f.bob, f.draftA.ID)
+	wantErr(t, "read other tenant's draft", err, gorm.ErrRecordNotFound)
+
+	posts, err := f.posts.FindByOrg(f.bob, f.orgA.ID, nil, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].ID != f.publicA.ID {
+		t.Errorf("listing other tenant: got %d posts, want only the published one", len(posts))
+	}
+
+	draft := *f.draftA
+	draft.Title = "defaced"
+	wantErr(t, "update other tenant's draft", f.posts.Update(f.bob, &draft), gorm.ErrRecordNotFound)
+	wantErr(t, "delete other tenant's draft", f.posts.Delete(f.bob, f.draftA.ID), gorm.ErrRecordNotFound)
+	wantErr(t, "delete other tenant's published post", f.posts.Delete(f.bob, f.publicA.ID), ErrForbidden)
+
+	planted := &Post{UserID: f.bobUserID, OrgID: &f.orgA.ID, Title: "planted"}
+	wantErr(t, "create in other tenant", f.posts.Create(f.bob, planted), ErrForbidden)
+
+	stored, err := f.posts.FindByID(f.alice, f.draftA.ID)
+	if err != nil || stored.Title != f.draftA.Title {
+		t.Errorf("owner's draft after cross-tenant writes: %+v, %v", stored, err)
+	}
+}
+
+func testCommentsDoNotLeakAcrossTenants(t *testing.T) {
+	f := newRLSFixture(t)
+	_, err := f.comments.FindThread(f.bob, f.draftA.ID, maxCommentDepth, 100, 0)
+	wantErr(t, "thread of other tenant's draft", err, gorm.ErrRecordNotFound)
+	_, err = f.comments.FindByID(f.bob, f.commentA.ID)
+	wantErr(t, "read other tenant's comment", err, gorm.ErrRecordNotFound)
+	_, err = f.comments.DeleteSubtree(f.bob, f.commentA.ID)
+	wantErr(t, "delete other tenant's comment", err, gorm.ErrRecordNotFound)
+
+	reply := &Comment{PostID: f.draftA.ID, UserID: f.bobUserID, Body: "hi"}
+	wantErr(t, "comment on other tenant's draft", f.comments.Create(f.bob, reply), gorm.ErrRecordNotFound)
+	spoofed := &Comment{PostID: f.publicA.ID, UserID: f.commentA.UserID, Body: "as alice"}
+	wantErr(t, "comment as someone else", f.comments.Create(f.bob, spoofed), ErrForbidden)
+
+	thread, err := f.comments.FindThread(f.alice, f.draftA.ID, maxCommentDepth, 100, 0)
+	if err != nil || len(thread) != 1 {
+		t.Errorf("owner's thread: %d comments, %v", len(thread), err)
+	}
+}
+
+func testOrgsDoNotLeakAcrossTenants(t *testing.T) {
+	f := newRLSFixture(t)
+	orgs, err := f.orgs.FindAll(f.bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0].ID != f.orgB.ID {
+		t.Errorf("FindAll: got %d organizations, want only tenant B", len(orgs))
+	}
+	_, err = f.orgs.FindByID(f.bob, f.orgA.ID)
+	wantErr(t, "read other tenant", err, gorm.ErrRecordNotFound)
+	wantErr(t, "rename other tenant", f.orgs.Rename(f.bob, f.orgA.ID, "mine"), gorm.ErrRecordNotFound)
+	err = f.db.Transaction(func(tx *gorm.DB) error { return f.orgs.DeleteInTx(f.bob, tx, f.orgA.ID) })
+	wantErr(t, "delete other tenant", err, gorm.ErrRecordNotFound)
+
+	if org, err := f.orgs.FindByID(f.alice, f.orgA.ID); err != nil || org.Name != "tenant-a" {
+		t.Errorf("tenant A after cross-tenant writes: %+v, %v", org, err)
+	}
+}
+
+func testViewerReadsButCannotWrite(t *testing.T) {
+	f := newRLSFixture(t)
+	now := time.Now()
+	viewer := &Membership{OrgID: f.orgA.ID, UserID: f.bobUserID, Role: OrgViewer, AcceptedAt: &now}
+	if err := f.orgs.SaveMembership(SystemContext(context.Background()), f.db, viewer); err != nil {
+		t.Fatal(err)
+	}
+	post, err := f.posts.FindByID(f.bob, f.draftA.ID)
+	if err != nil {
+		t.Fatalf("viewer reading draft: %v", err)
+	}
+	post.Title = "edited"
+	wantErr(t, "viewer updating draft", f.posts.Update(f.bob, post), ErrForbidden)
+	wantErr(t, "viewer renaming org", f.orgs.Rename(f.bob, f.orgA.ID, "mine"), ErrForbidden)
+}
+
+func testMissingPrincipalFailsClosed(t *testing.T) {
+	f := newRLSFixture(t)
+	ctx := context.Background()
+	_, err := f.posts.FindByID(ctx, f.publicA.ID)
+	wantErr(t, "post read", err, ErrNoPrincipal)
+	_, err = f.orgs.FindAll(ctx)
+	wantErr(t, "org list", err, ErrNoPrincipal)
+	_, err = f.comments.FindThread(ctx, f.publicA.ID, 1, 10, 0)
+	wantErr(t, "thread", err, ErrNoPrincipal)
+	wantErr(t, "post create", f.posts.Create(ctx, &Post{Title: "x"}), ErrNoPrincipal)
+}
+
+func testSystemPrincipalBypassesPolicies(t *testing.T) {
+	f := newRLSFixture(t)
+	sys := SystemContext(context.Background())
+	if _, err := f.posts.FindByID(sys, f.draftB.ID); err != nil {
+		t.Errorf("system reading a draft: %v", err)
+	}
+	ids := []uuid.UUID{f.draftA.ID, f.draftB.ID}
+	if err := f.posts.RefreshCommentCounts(sys, ids); err != nil {
+		t.Errorf("system refresh: %v", err)
+	}
+	wantErr(t, "user refresh", f.posts.RefreshCommentCounts(f.alice, ids), ErrForbidden)
+}
+
+// testOrgPostPagesAreStable pages through posts that share one timestamp and
+// checks every order yields each post exactly once, ties broken by id.
+func testOrgPostPagesAreStable(t *testing.T) {
+	f := newRLSFixture(t)
+	sys := SystemContext(context.Background())
+	at := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 9; i++ {
+		status := DraftStatus
+		if i%2 == 0 {
+			status = PublishedStatus
+		}
+		p := &Post{UserID: f.draftA.UserID, OrgID: &f.orgA.ID, Title: fmt.Sprintf("title %d", i%3), Status: status, CreatedAt: at}
+		if err := f.posts.Create(sys, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, s := range []string{"", "created_at", "status,-created_at", "-title"} {
+		order, err := ParsePostSort(s)
+		if err != nil {
+			t.Fatalf("ParsePostSort(%q): %v", s, err)
+		}
+		all, err := f.posts.FindByOrg(f.alice, f.orgA.ID, order, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want, got []string
+		for _, p := range all {
+			want = append(want, p.ID.String())
+		}
+		for offset := 0; offset < len(all); offset += 4 {
+			page, err := f.posts.FindByOrg(f.alice, f.orgA.ID, order, 4, offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range page {
+				got = append(got, p.ID.String())
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("sort=%q: pages %v differ from full listing %v", s, got, want)
+		}
+
+		last := order[len(order)-1]
+		for i := 1; i < len(all); i++ {
+			a, b := all[i-1], all[i]
+			if a.CreatedAt.Equal(b.CreatedAt) && a.Title == b.Title && a.Status == b.Status {
+				if (a.ID.String() < b.ID.String()) == last.Desc {
+					t.Errorf("sort=%q: tie between %s and %s not broken by id", s, a.ID, b.ID)
+				}
+			}
+		}
+	}
+
+	if !f.db.Migrator().HasIndex(&Post{}, "idx_posts_org_created") {
+		t.Error("idx_posts_org_created was not created")
+	}
+	for _, bad := range []string{"content", "title,,status", "-", "title,-title"} {
+		if _, err := ParsePostSort(bad); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("ParsePostSort(%q) error = %v, want ErrInvalidSort", bad, err)
+		}
+	}
+}
+
+// newRLSServer signs up alice@example.com and bob@example.com as the owners
+// of tenants A and B, with "<email>-pass" as their passwords, and serves the
+// API routes the tests need. It returns the users' IDs by email.
+func newRLSServer(t *testing.T, f *rlsFixture) (*echo.Echo, map[string]uuid.UUID) {
+	sys := SystemContext(context.Background())
+	now := time.Now()
+	accounts := map[string]*Organization{"alice@example.com": f.orgA, "bob@example.com": f.orgB}
+	ids := make(map[string]uuid.UUID)
+	for email, org := range accounts {
+		u := &User{Email: email, PasswordHash: hashPassword(email + "-pass"), IsActive: true}
+		if err := f.db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids[email] = u.ID
+		m := &Membership{OrgID: org.ID, UserID: u.ID, Role: OrgOwner, InvitedBy: u.ID, AcceptedAt: &now}
+		if err := f.orgs.SaveMembership(sys, f.db, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := echo.New()
+	e.Use(principalMiddleware(NewUserService(f.db, NewUserRepository(f.db))))
+	e.GET("/posts/:id/comments", NewCommentHandler(nil, f.comments).ListComments)
+	e.POST("/posts", NewPostHandler(NewPostService(f.posts)).CreatePost)
+	return e, ids
+}
+
+// testSpoofedHeaderCannotReadOtherTenant: the principal comes from
+// credentials, so naming another user in X-User-ID reads nothing of theirs.
+func testSpoofedHeaderCannotReadOtherTenant(t *testing.T) {
+	f := newRLSFixture(t)
+	e, ids := newRLSServer(t, f)
+	for _, tc := range []struct {
+		name  string
+		setup func(*http.Request)
+		want  int
+	}{
+		{"claimed ID only", func(r *http.Request) { r.Header.Set("X-User-ID", ids["alice@example.com"].String()) }, http.StatusNotFound},
+		{"claimed ID with own credentials", func(r *http.Request) {
+			r.Header.Set("X-User-ID", ids["alice@example.com"].String())
+			r.SetBasicAuth("bob@example.com", "bob@example.com-pass")
+		}, http.StatusNotFound},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("alice@example.com", "guess") }, http.StatusUnauthorized},
+		{"tenant member", func(r *http.Request) { r.SetBasicAuth("alice@example.com", "alice@example.com-pass") }, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/posts/"+f.draftA.ID.String()+"/comments", nil)
+		tc.setup(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+// testSpoofedHeaderCannotActAsOrgEditor: creating an org-owned post needs
+// the editor's own credentials, not their ID.
+func testSpoofedHeaderCannotActAsOrgEditor(t *testing.T) {
+	f := newRLSFixture(t)
+	e, ids := newRLSServer(t, f)
+	body := `{"title":"planted","org_id":"` + f.orgA.ID.String() + `"}`
+	for _, tc := range []struct {
+		name  string
+		setup func(*http.Request)
+		want  int
+	}{
+		{"claimed editor ID only", func(r *http.Request) { r.Header.Set("X-User-ID", ids["alice@example.com"].String()) }, http.StatusUnauthorized},
+		{"claimed editor ID with own credentials", func(r *http.Request) {
+			r.Header.Set("X-User-ID", ids["alice@example.com"].String())
+			r.SetBasicAuth("bob@example.com", "bob@example.com-pass")
+		}, http.StatusForbidden},
+		{"editor", func(r *http.Request) { r.SetBasicAuth("alice@example.com", "alice@example.com-pass") }, http.StatusCreated},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		tc.setup(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+// testCommentOnMissingPostIsNotFound holds even for the system principal,
+// which no policy checks.
+func testCommentOnMissingPostIsNotFound(t *testing.T) {
+	f := newRLSFixture(t)
+	svc := NewCommentService(f.comments, NewCommentCountRefresher(f.posts, time.Hour))
+	_, err := svc.AddComment(SystemContext(context.Background()), uuid.New(), f.bobUserID, nil, "orphan")
+	wantErr(t, "comment on missing post", err, gorm.ErrRecordNotFound)
+	var n int64
+	f.db.Model(&Comment{}).Where("body = ?", "orphan").Count(&n)
+	if n != 0 {
+		t.Errorf("comment on missing post was stored")
+	}
+}
+
+// runSelftest runs the row policy and list ordering checks. Standard test flags such as
+// -test.v and -test.run are accepted.
+func runSelftest(args []string) {
+	os.Args = append([]string{os.Args[0]}, args...)
+	testing.Init()
+	testing.Main(regexp.MatchString, []testing.InternalTest{
+		{Name: "PostsDoNotLeakAcrossTenants", F: testPostsDoNotLeakAcrossTenants},
+		{Name: "CommentsDoNotLeakAcrossTenants", F: testCommentsDoNotLeakAcrossTenants},
+		{Name: "OrgsDoNotLeakAcrossTenants", F: testOrgsDoNotLeakAcrossTenants},
+		{Name: "ViewerReadsButCannotWrite", F: testViewerReadsButCannotWrite},
+		{Name: "MissingPrincipalFailsClosed", F: testMissingPrincipalFailsClosed},
+		{Name: "SystemPrincipalBypassesPolicies", F: testSystemPrincipalBypassesPolicies},
+		{Name: "OrgPostPagesAreStable", F: testOrgPostPagesAreStable},
+		{Name: "SpoofedHeaderCannotReadOtherTenant", F: testSpoofedHeaderCannotReadOtherTenant},
+		{Name: "SpoofedHeaderCannotActAsOrgEditor", F: testSpoofedHeaderCannotActAsOrgEditor},
+		{Name: "CommentOnMissingPostIsNotFound", F: testCommentOnMissingPostIsNotFound},
+	}, nil, nil)
+}
+
 // --- 5. MAIN (Application Setup) ---
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		runSelftest(os.Args[2:])
+		return
+	}
+
 	// --- Database Setup ---
 	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
@@ -231,7 +1939,7 @@ func main() {
 
 	// --- Migrations ---
 	log.Println("Running database migrations...")
-	db.AutoMigrate(&User{}, &Post{}, &Role{})
+	db.AutoMigrate(&User{}, &Post{}, &Role{}, &Comment{}, &Organization{}, &Membership{})
 
 	// --- Seed Data ---
 	log.Println("Seeding data...")
@@ -239,24 +1947,57 @@ func main() {
 	db.Create(&roles)
 
 	// --- Dependency Injection ---
+	postPolicy := PostPolicy{}
 	userRepo := NewUserRepository(db)
-	postRepo := NewPostRepository(db)
+	postRepo := NewPostRepository(db, postPolicy)
 	userService := NewUserService(db, userRepo)
 	userHandler := NewUserHandler(userService, userRepo)
-	// Post handler would be set up similarly
-	_ = postRepo // To avoid unused variable error
+	commentRepo := NewCommentRepository(db, CommentPolicy{posts: postPolicy})
+	commentCounter := NewCommentCountRefresher(postRepo, 5*time.Second)
+	commentService := NewCommentService(commentRepo, commentCounter)
+	commentHandler := NewCommentHandler(commentService, commentRepo)
+	orgRepo := NewOrgRepository(db, OrgPolicy{})
+	orgService := NewOrgService(db, orgRepo, userRepo)
+	postService := NewPostService(postRepo)
+	orgHandler := NewOrgHandler(orgService, orgRepo, postService)
+	postHandler := NewPostHandler(postService)
+
+	// --- Background Tasks ---
+	bgCtx, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+	commentCounter.Start(bgCtx)
 
 	// --- Echo Setup ---
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	e.Use(principalMiddleware(userService))
 
 	// --- Routing ---
 	userGroup := e.Group("/users")
 	userGroup.POST("", userHandler.CreateUser)
 	userGroup.GET("", userHandler.GetUsers)
 	userGroup.GET("/:id", userHandler.GetUserByID)
-	// Other CRUD routes (PUT, DELETE) and Post routes would be added here
+	// Other CRUD routes (PUT, DELETE) would be added here
+
+	e.POST("/posts", postHandler.CreatePost)
+	e.PATCH("/posts/:id", postHandler.UpdatePost)
+	e.DELETE("/posts/:id", postHandler.DeletePost)
+
+	orgGroup := e.Group("/orgs")
+	orgGroup.POST("", orgHandler.CreateOrg)
+	orgGroup.GET("", orgHandler.ListMyOrgs)
+	orgGroup.GET("/:id", orgHandler.GetOrg)
+	orgGroup.PATCH("/:id", orgHandler.RenameOrg)
+	orgGroup.DELETE("/:id", orgHandler.DeleteOrg)
+	orgGroup.POST("/:id/members", orgHandler.InviteMember)
+	orgGroup.DELETE("/:id/members/:userId", orgHandler.RemoveMember)
+	orgGroup.POST("/:id/invitation/accept", orgHandler.AcceptInvitation)
+	orgGroup.GET("/:id/posts", orgHandler.ListOrgPosts)
+
+	e.POST("/posts/:id/comments", commentHandler.CreateComment)
+	e.GET("/posts/:id/comments", commentHandler.ListComments)
+	e.DELETE("/comments/:id", commentHandler.DeleteComment)
 
 	log.Println("Starting server on :8080")
 	e.Start(":8080")
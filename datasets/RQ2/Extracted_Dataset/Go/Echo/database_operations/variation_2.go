@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/base64"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -49,6 +53,15 @@ type Post struct {
 	Content   string     `json:"content"`
 	Status    PostStatus `gorm:"default:'DRAFT'" json:"status"`
 	CreatedAt time.Time  `json:"created_at"`
+	Tags      []*Tag     `gorm:"many2many:post_tags;" json:"tags"`
+}
+
+// Tag.PostCount is maintained incrementally by every write that changes
+// post_tags, so popularity listings never need to aggregate the join table.
+type Tag struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Name      string `gorm:"uniqueIndex;not null" json:"name"`
+	PostCount int    `gorm:"not null;default:0" json:"post_count"`
 }
 
 // GORM Hooks
@@ -162,6 +175,427 @@ func (ur *UserResource) deleteUser(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// --- TAG HELPERS ---
+
+const maxTagLength = 50
+
+var (
+	errInvalidTag = errors.New("tag names must be 1-50 characters")
+	errTagExists  = errors.New("tag already exists")
+)
+
+func normalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// resolveTags finds or creates a tag for each distinct normalized name.
+func resolveTags(tx *gorm.DB, names []string) ([]*Tag, error) {
+	seen := make(map[string]bool, len(names))
+	tags := make([]*Tag, 0, len(names))
+	for _, raw := range names {
+		name := normalizeTagName(raw)
+		if name == "" || len(name) > maxTagLength {
+			return nil, errInvalidTag
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		tag := &Tag{}
+		if err := tx.Where(Tag{Name: name}).FirstOrCreate(tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// adjustTagCounts adds delta to the popularity count of every given tag.
+func adjustTagCounts(tx *gorm.DB, tags []*Tag, delta int) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(tags))
+	for i, t := range tags {
+		ids[i] = t.ID
+	}
+	return tx.Model(&Tag{}).Where("id IN ?", ids).
+		UpdateColumn("post_count", gorm.Expr("post_count + ?", delta)).Error
+}
+
+// diffTags returns the tags in next but not prev, and in prev but not next.
+func diffTags(prev, next []*Tag) (added, removed []*Tag) {
+	inPrev := make(map[uint]bool, len(prev))
+	for _, t := range prev {
+		inPrev[t.ID] = true
+	}
+	inNext := make(map[uint]bool, len(next))
+	for _, t := range next {
+		inNext[t.ID] = true
+		if !inPrev[t.ID] {
+			added = append(added, t)
+		}
+	}
+	for _, t := range prev {
+		if !inNext[t.ID] {
+			removed = append(removed, t)
+		}
+	}
+	return added, removed
+}
+
+// --- POST RESOURCE ---
+
+type PostResource struct {
+	DB *gorm.DB
+}
+
+func (pr *PostResource) createPost(c echo.Context) error {
+	var payload struct {
+		UserID  uuid.UUID  `json:"user_id"`
+		Title   string     `json:"title"`
+		Content string     `json:"content"`
+		Status  PostStatus `json:"status"`
+		Tags    []string   `json:"tags"`
+	}
+	if err := c.Bind(&payload); err != nil || payload.Title == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid input"})
+	}
+	if payload.Status == "" {
+		payload.Status = StatusDraft
+	}
+
+	var post Post
+	err := pr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&User{}, "id = ?", payload.UserID).Error; err != nil {
+			return err
+		}
+		tags, err := resolveTags(tx, payload.Tags)
+		if err != nil {
+			return err
+		}
+		post = Post{
+			UserID:  payload.UserID,
+			Title:   payload.Title,
+			Content: payload.Content,
+			Status:  payload.Status,
+			Tags:    tags,
+		}
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return adjustTagCounts(tx, tags, 1)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "User not found"})
+	case errors.Is(err, errInvalidTag):
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": err.Error()})
+	case err != nil:
+		log.Printf("Transaction failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Could not create post"})
+	}
+	return c.JSON(http.StatusCreated, post)
+}
+
+func (pr *PostResource) updatePost(c echo.Context) error {
+	postID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid post ID"})
+	}
+	// Nil fields are left unchanged; a non-nil empty tag list clears all tags.
+	var payload struct {
+		Title   *string     `json:"title"`
+		Content *string     `json:"content"`
+		Status  *PostStatus `json:"status"`
+		Tags    *[]string   `json:"tags"`
+	}
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid input"})
+	}
+
+	var post Post
+	err = pr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Tags").First(&post, "id = ?", postID).Error; err != nil {
+			return err
+		}
+		if payload.Title != nil {
+			post.Title = *payload.Title
+		}
+		if payload.Content != nil {
+			post.Content = *payload.Content
+		}
+		if payload.Status != nil {
+			post.Status = *payload.Status
+		}
+		if err := tx.Model(&post).Select("Title", "Content", "Status").Updates(&post).Error; err != nil {
+			return err
+		}
+		if payload.Tags == nil {
+			return nil
+		}
+
+		tags, err := resolveTags(tx, *payload.Tags)
+		if err != nil {
+			return err
+		}
+		added, removed := diffTags(post.Tags, tags)
+		if err := tx.Model(&post).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		if err := adjustTagCounts(tx, added, 1); err != nil {
+			return err
+		}
+		post.Tags = tags
+		return adjustTagCounts(tx, removed, -1)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "Post not found"})
+	case errors.Is(err, errInvalidTag):
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": err.Error()})
+	case err != nil:
+		log.Printf("Transaction failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Could not update post"})
+	}
+	return c.JSON(http.StatusOK, post)
+}
+
+const (
+	defaultPostPageSize = 20
+	maxPostPageSize     = 100
+)
+
+// postCursor is the position of the last post on a page. Posts are listed
+// newest first, with the ID breaking ties between equal timestamps.
+type postCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (cur postCursor) encode() string {
+	raw := strconv.FormatInt(cur.CreatedAt.UnixNano(), 10) + "." + cur.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostCursor(cursor string) (postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return postCursor{}, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return postCursor{}, errors.New("malformed post cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return postCursor{}, err
+	}
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return postCursor{}, err
+	}
+	return postCursor{CreatedAt: time.Unix(0, n), ID: uid}, nil
+}
+
+// postPage is one page of listPosts. NextCursor is empty on the last page.
+type postPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listPosts filters by ?tags=a,b. match=all (default) requires every tag,
+// match=any requires at least one. Results come in pages of ?limit posts
+// (default 20, at most 100); pass next_cursor back as ?cursor for the next.
+func (pr *PostResource) listPosts(c echo.Context) error {
+	limit := defaultPostPageSize
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPostPageSize {
+			return c.JSON(http.StatusBadRequest, echo.Map{"message": "limit must be between 1 and 100"})
+		}
+		limit = n
+	}
+	query := pr.DB.Model(&Post{}).Preload("Tags").Order("created_at DESC, id DESC")
+	if v := c.QueryParam("cursor"); v != "" {
+		after, err := decodePostCursor(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid cursor"})
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	var names []string
+	for _, raw := range strings.Split(c.QueryParam("tags"), ",") {
+		if name := normalizeTagName(raw); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		match := c.QueryParam("match")
+		if match == "" {
+			match = "all"
+		}
+		if match != "all" && match != "any" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"message": "match must be all or any"})
+		}
+		matching := pr.DB.Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.name IN ?", names).
+			Group("post_tags.post_id")
+		if match == "all" {
+			matching = matching.Having("COUNT(DISTINCT tags.id) = ?", len(names))
+		}
+		query = query.Where("id IN (?)", matching)
+	}
+
+	// One extra row tells us whether another page follows.
+	var posts []Post
+	if err := query.Limit(limit + 1).Find(&posts).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Failed to fetch posts"})
+	}
+	page := postPage{Posts: posts}
+	if len(posts) > limit {
+		page.Posts = posts[:limit]
+		last := page.Posts[limit-1]
+		page.NextCursor = postCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// --- TAG RESOURCE ---
+
+type TagResource struct {
+	DB *gorm.DB
+}
+
+// listTags returns tags ordered by popularity.
+func (tr *TagResource) listTags(c echo.Context) error {
+	var tags []Tag
+	if err := tr.DB.Order("post_count DESC, name").Find(&tags).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Failed to fetch tags"})
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+func (tr *TagResource) createTag(c echo.Context) error {
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid input"})
+	}
+	name := normalizeTagName(payload.Name)
+	if name == "" || len(name) > maxTagLength {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": errInvalidTag.Error()})
+	}
+
+	tag := Tag{Name: name}
+	result := tr.DB.Where(Tag{Name: name}).FirstOrCreate(&tag)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Could not create tag"})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusConflict, echo.Map{"message": errTagExists.Error(), "tag": tag})
+	}
+	return c.JSON(http.StatusCreated, tag)
+}
+
+func (tr *TagResource) renameTag(c echo.Context) error {
+	var payload struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid input"})
+	}
+	name := normalizeTagName(payload.Name)
+	if name == "" || len(name) > maxTagLength {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": errInvalidTag.Error()})
+	}
+
+	var tag Tag
+	err := tr.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&tag, c.Param("id")).Error; err != nil {
+			return err
+		}
+		var taken int64
+		if err := tx.Model(&Tag{}).Where("name = ? AND id <> ?", name, tag.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errTagExists
+		}
+		tag.Name = name
+		return tx.Model(&tag).Update("name", name).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "Tag not found"})
+	case errors.Is(err, errTagExists):
+		return c.JSON(http.StatusConflict, echo.Map{"message": "Use merge to combine existing tags"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Could not rename tag"})
+	}
+	return c.JSON(http.StatusOK, tag)
+}
+
+// mergeTag moves every post from the source tag onto the target and deletes
+// the source, all in one transaction. Posts that already carry both tags
+// simply lose the source association.
+func (tr *TagResource) mergeTag(c echo.Context) error {
+	var payload struct {
+		Into uint `json:"into"`
+	}
+	if err := c.Bind(&payload); err != nil || payload.Into == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "into must name the target tag ID"})
+	}
+
+	var target Tag
+	err := tr.DB.Transaction(func(tx *gorm.DB) error {
+		var source Tag
+		if err := tx.First(&source, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&target, payload.Into).Error; err != nil {
+			return err
+		}
+		if source.ID == target.ID {
+			return errTagExists
+		}
+
+		moved := tx.Exec(`UPDATE post_tags SET tag_id = ? WHERE tag_id = ?
+			AND post_id NOT IN (SELECT post_id FROM post_tags WHERE tag_id = ?)`,
+			target.ID, source.ID, target.ID)
+		if moved.Error != nil {
+			return moved.Error
+		}
+		if err := tx.Exec("DELETE FROM post_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&source).Error; err != nil {
+			return err
+		}
+		target.PostCount += int(moved.RowsAffected)
+		return tx.Model(&target).
+			UpdateColumn("post_count", gorm.Expr("post_count + ?", moved.RowsAffected)).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "Tag not found"})
+	case errors.Is(err, errTagExists):
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Cannot merge a tag into itself"})
+	case err != nil:
+		log.Printf("Tag merge failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Could not merge tags"})
+	}
+	return c.JSON(http.StatusOK, target)
+}
+
 // --- MAIN ---
 
 func main() {
@@ -175,7 +609,7 @@ func main() {
 
 	// --- Migrations ---
 	log.Println("Migrating database schema...")
-	if err := db.AutoMigrate(&User{}, &Post{}, &Role{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &Post{}, &Role{}, &Tag{}); err != nil {
 		log.Fatalf("Migration failed: %v", err)
 	}
 
@@ -186,7 +620,8 @@ func main() {
 
 	// --- Resource and Echo Setup ---
 	userRes := &UserResource{DB: db}
-	// A PostResource would be similarly instantiated
+	postRes := &PostResource{DB: db}
+	tagRes := &TagResource{DB: db}
 
 	e := echo.New()
 	e.Use(middleware.Recover())
@@ -200,7 +635,13 @@ func main() {
 	api.GET("/users", userRes.listUsers)
 	api.GET("/users/:id", userRes.getUser)
 	api.DELETE("/users/:id", userRes.deleteUser)
-	// Other CRUD routes (PUT) and Post routes would be added here
+	api.POST("/posts", postRes.createPost)
+	api.GET("/posts", postRes.listPosts)
+	api.PUT("/posts/:id", postRes.updatePost)
+	api.GET("/tags", tagRes.listTags)
+	api.POST("/tags", tagRes.createTag)
+	api.PATCH("/tags/:id", tagRes.renameTag)
+	api.POST("/tags/:id/merge", tagRes.mergeTag)
 
 	log.Println("Server starting on http://localhost:8080")
 	if err := e.Start(":8080"); err != nil {
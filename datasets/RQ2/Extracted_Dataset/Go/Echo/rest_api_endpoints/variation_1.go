@@ -1,7 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -53,6 +60,192 @@ var (
 	mu    = &sync.RWMutex{}
 )
 
+// --- Response Compression ---
+
+// compressResponses buffers each response, then gzip- or deflate-encodes it
+// when the client accepts that, the content type is textual and the body is
+// at least minBytes.
+func compressResponses(minBytes int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+			res := c.Response()
+			buffered := &bufferedWriter{ResponseWriter: res.Writer, status: http.StatusOK}
+			res.Writer = buffered
+			err := next(c)
+			res.Writer = buffered.ResponseWriter
+			if err != nil && !res.Committed {
+				return err // let the error handler write through the real writer
+			}
+			body := encodeBody(res.Header(), c.Request().Header.Get("Accept-Encoding"), buffered.buf.Bytes(), minBytes)
+			buffered.ResponseWriter.WriteHeader(buffered.status)
+			_, werr := buffered.ResponseWriter.Write(body)
+			return werr
+		}
+	}
+}
+
+type bufferedWriter struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) WriteHeader(code int)        { w.status = code }
+func (w *bufferedWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+// encodeBody returns body, compressed if worthwhile, and sets the matching
+// Content-Encoding, Content-Length and Vary headers.
+func encodeBody(h http.Header, acceptEncoding string, body []byte, minBytes int) []byte {
+	if len(body) == 0 || h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return body
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if enc := negotiateEncoding(acceptEncoding); enc != "" && len(body) >= minBytes {
+		if z, err := compressBody(enc, body); err == nil {
+			h.Set("Content-Encoding", enc)
+			body = z
+		}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	return body
+}
+
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasPrefix(ct, "text/") || ct == "application/json" ||
+		ct == "application/xml" || ct == "application/javascript" || strings.HasSuffix(ct, "+json")
+}
+
+// negotiateEncoding prefers gzip over deflate and honours q=0 refusals.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressBody encodes body; HTTP's "deflate" is the zlib format.
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// --- List Guards ---
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+	// maxListOffset stops clients paging through the whole table over HTTP.
+	maxListOffset = 10000
+)
+
+var errUnboundedList = errors.New("unbounded listings are not served over HTTP")
+
+// exportURL is where clients are sent for full listings: the async export API.
+var exportURL = envOr("USERS_EXPORT_URL", "/exports/users")
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// parsePageSize caps pageSize at maxPageSize; "all", 0 or a negative size
+// asks for everything and is refused.
+func parsePageSize(raw string) (int, error) {
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+	if strings.EqualFold(raw, "all") {
+		return 0, errUnboundedList
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("pageSize must be an integer")
+	}
+	if n < 1 {
+		return 0, errUnboundedList
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
+
+func unboundedListError(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, map[string]interface{}{
+		"message":    errUnboundedList.Error() + "; request an export instead",
+		"export_url": exportURL,
+		"max_size":   maxPageSize,
+	})
+}
+
+// countCache keeps list totals per filter so paging does not recount on every
+// request. Writes invalidate it; the TTL bounds staleness otherwise. Against
+// the in-memory map the count is cheap, but a database COUNT is not.
+type countCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]countEntry
+}
+
+type countEntry struct {
+	n  int
+	at time.Time
+}
+
+func newCountCache(ttl time.Duration) *countCache {
+	return &countCache{ttl: ttl, entries: make(map[string]countEntry)}
+}
+
+func (cc *countCache) get(key string, count func() int) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if e, ok := cc.entries[key]; ok && time.Since(e.at) < cc.ttl {
+		return e.n
+	}
+	n := count()
+	cc.entries[key] = countEntry{n: n, at: time.Now()}
+	return n
+}
+
+func (cc *countCache) invalidate() {
+	cc.mu.Lock()
+	cc.entries = make(map[string]countEntry)
+	cc.mu.Unlock()
+}
+
+var userCounts = newCountCache(30 * time.Second)
+
 // --- API Handlers (Functional Style) ---
 
 func createUser(c echo.Context) error {
@@ -93,6 +286,7 @@ func createUser(c echo.Context) error {
 	}
 
 	users[newUser.ID] = newUser
+	userCounts.invalidate()
 	return c.JSON(http.StatusCreated, newUser)
 }
 
@@ -148,6 +342,7 @@ func updateUser(c echo.Context) error {
 	}
 
 	users[id] = user
+	userCounts.invalidate()
 	return c.JSON(http.StatusOK, user)
 }
 
@@ -165,6 +360,7 @@ func deleteUser(c echo.Context) error {
 	}
 
 	delete(users, id)
+	userCounts.invalidate()
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -173,6 +369,22 @@ func listUsers(c echo.Context) error {
 	roleFilter := c.QueryParam("role")
 	isActiveFilter := c.QueryParam("is_active")
 
+	// Pagination
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, err := parsePageSize(c.QueryParam("pageSize"))
+	if errors.Is(err, errUnboundedList) {
+		return unboundedListError(c)
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	offset := (page - 1) * pageSize
+	if offset > maxListOffset {
+		return unboundedListError(c)
+	}
+
 	mu.RLock()
 	allUsers := make([]User, 0, len(users))
 	for _, user := range users {
@@ -195,17 +407,9 @@ func listUsers(c echo.Context) error {
 		return allUsers[i].CreatedAt.Before(allUsers[j].CreatedAt)
 	})
 
-	// Pagination
-	page, _ := strconv.Atoi(c.QueryParam("page"))
-	if page < 1 {
-		page = 1
-	}
-	pageSize, _ := strconv.Atoi(c.QueryParam("pageSize"))
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
-	}
+	total := userCounts.get(strings.ToUpper(roleFilter)+"|"+isActiveFilter, func() int { return len(allUsers) })
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(total))
 
-	offset := (page - 1) * pageSize
 	if offset >= len(allUsers) {
 		return c.JSON(http.StatusOK, []User{})
 	}
@@ -242,6 +446,11 @@ func main() {
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	minBytes, err := strconv.Atoi(envOr("COMPRESS_MIN_BYTES", "1024"))
+	if err != nil || minBytes < 0 {
+		e.Logger.Fatalf("COMPRESS_MIN_BYTES must be a non-negative integer")
+	}
+	e.Use(compressResponses(minBytes))
 
 	// Routes
 	userGroup := e.Group("/users")
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -49,8 +57,9 @@ type Post struct {
 }
 
 var (
-	ErrNotFound      = errors.New("resource not found")
-	ErrAlreadyExists = errors.New("resource already exists")
+	ErrNotFound           = errors.New("resource not found")
+	ErrAlreadyExists      = errors.New("resource already exists")
+	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
 // --- Repository Layer ---
@@ -58,6 +67,7 @@ var (
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	List(ctx context.Context, params ListUserParams) ([]User, error)
@@ -79,7 +89,13 @@ func NewMemoryUserRepository() UserRepository {
 	return &memoryUserRepository{users: make(map[uuid.UUID]User)}
 }
 
+// The memory repository stands in for a database driver, which would abandon
+// a query once ctx is done; it checks ctx before doing any work.
+
 func (r *memoryUserRepository) Create(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	for _, u := range r.users {
@@ -92,6 +108,9 @@ func (r *memoryUserRepository) Create(ctx context.Context, user *User) error {
 }
 
 func (r *memoryUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	user, ok := r.users[id]
@@ -101,7 +120,24 @@ func (r *memoryUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*User
 	return &user, nil
 }
 
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
 func (r *memoryUserRepository) Update(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, ok := r.users[user.ID]; !ok {
@@ -112,6 +148,9 @@ func (r *memoryUserRepository) Update(ctx context.Context, user *User) error {
 }
 
 func (r *memoryUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, ok := r.users[id]; !ok {
@@ -125,7 +164,14 @@ func (r *memoryUserRepository) List(ctx context.Context, params ListUserParams)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	var result []User
+	scanned := 0
 	for _, user := range r.users {
+		// Large scans give up as soon as the budget runs out.
+		if scanned++; scanned%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
 		if params.Role != nil && user.Role != *params.Role {
 			continue
 		}
@@ -147,11 +193,52 @@ func (r *memoryUserRepository) List(ctx context.Context, params ListUserParams)
 	return result[params.Offset:end], nil
 }
 
+// --- Outbound Notifications ---
+
+// UserEventNotifier posts user events to USER_WEBHOOK_URL, if set.
+type UserEventNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewUserEventNotifier(url string) *UserEventNotifier {
+	return &UserEventNotifier{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// minOutboundBudget is the least time worth starting an outbound call with.
+const minOutboundBudget = 50 * time.Millisecond
+
+// Notify is best effort: it is skipped when the request budget is nearly
+// spent, and is cut off when the budget runs out.
+func (n *UserEventNotifier) Notify(ctx context.Context, event string, user *User) {
+	if n == nil || n.url == "" {
+		return
+	}
+	if left, ok := BudgetRemaining(ctx); ok && left < minOutboundBudget {
+		log.Printf("skipping %s webhook for user %s: only %s of budget left", event, user.ID, left)
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{"event": event, "user_id": user.ID, "at": time.Now().UTC()})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("building %s webhook: %v", event, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		log.Printf("%s webhook for user %s failed: %v", event, user.ID, err)
+		return
+	}
+	resp.Body.Close()
+}
+
 // --- Service Layer ---
 
 type UserService interface {
 	Create(ctx context.Context, email, password string, role Role) (*User, error)
 	Get(ctx context.Context, id uuid.UUID) (*User, error)
+	Authenticate(ctx context.Context, email, password string) (*User, error)
 	Update(ctx context.Context, id uuid.UUID, email *string, role *Role, isActive *bool) (*User, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 	List(ctx context.Context, params ListUserParams) ([]User, error)
@@ -159,17 +246,18 @@ type UserService interface {
 
 type userService struct {
 	userRepo UserRepository
+	notifier *UserEventNotifier
 }
 
-func NewUserService(repo UserRepository) UserService {
-	return &userService{userRepo: repo}
+func NewUserService(repo UserRepository, notifier *UserEventNotifier) UserService {
+	return &userService{userRepo: repo, notifier: notifier}
 }
 
 func (s *userService) Create(ctx context.Context, email, password string, role Role) (*User, error) {
 	newUser := &User{
 		ID:           uuid.New(),
 		Email:        email,
-		PasswordHash: "hashed_" + password, // Use bcrypt in production
+		PasswordHash: hashPassword(password),
 		Role:         role,
 		IsActive:     true,
 		CreatedAt:    time.Now().UTC(),
@@ -177,13 +265,34 @@ func (s *userService) Create(ctx context.Context, email, password string, role R
 	if err := s.userRepo.Create(ctx, newUser); err != nil {
 		return nil, err
 	}
+	s.notifier.Notify(ctx, "user.created", newUser)
 	return newUser, nil
 }
 
+// hashPassword stands in for bcrypt, which a production build would use.
+func hashPassword(password string) string {
+	return "hashed_" + password
+}
+
 func (s *userService) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	return s.userRepo.GetByID(ctx, id)
 }
 
+// Authenticate checks email and password against the stored hash. Unknown
+// emails, wrong passwords and inactive accounts all fail the same way.
+func (s *userService) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte(hashPassword(password))) != 1 || !user.IsActive {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
 func (s *userService) Update(ctx context.Context, id uuid.UUID, email *string, role *Role, isActive *bool) (*User, error) {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
@@ -212,6 +321,234 @@ func (s *userService) List(ctx context.Context, params ListUserParams) ([]User,
 	return s.userRepo.List(ctx, params)
 }
 
+// --- Deadline Budget ---
+// Every request gets an overall time budget. Handlers and everything they
+// call see a context whose deadline is the budget minus a reserve, so that
+// once the work gives up there is still time to write the response.
+
+type BudgetConfig struct {
+	Default time.Duration
+	// Routes overrides Default per "METHOD /route/pattern".
+	Routes map[string]time.Duration
+	// Reserve is kept back from the work for serializing the response.
+	Reserve time.Duration
+}
+
+// LoadBudgetConfig reads REQUEST_BUDGET and REQUEST_BUDGET_RESERVE.
+func LoadBudgetConfig(routes map[string]time.Duration) BudgetConfig {
+	cfg := BudgetConfig{Default: 2 * time.Second, Routes: routes, Reserve: 50 * time.Millisecond}
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_BUDGET")); err == nil && d > 0 {
+		cfg.Default = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_BUDGET_RESERVE")); err == nil && d >= 0 {
+		cfg.Reserve = d
+	}
+	return cfg
+}
+
+type budgetCtxKey struct{}
+
+type requestBudget struct {
+	total    time.Duration
+	deadline time.Time
+}
+
+// BudgetRemaining reports how long the work for this request may still take.
+func BudgetRemaining(ctx context.Context) (time.Duration, bool) {
+	b, ok := ctx.Value(budgetCtxKey{}).(requestBudget)
+	if !ok {
+		return 0, false
+	}
+	return time.Until(b.deadline), true
+}
+
+// DeadlineBudget applies the route's budget. Clients may ask for less, never
+// more, with an X-Request-Timeout duration header.
+func DeadlineBudget(cfg BudgetConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			total := cfg.Default
+			if d, ok := cfg.Routes[c.Request().Method+" "+c.Path()]; ok {
+				total = d
+			}
+			if d, err := time.ParseDuration(c.Request().Header.Get("X-Request-Timeout")); err == nil && d > 0 && d < total {
+				total = d
+			}
+			work := total - cfg.Reserve
+			if work <= 0 {
+				work = total
+			}
+			deadline := time.Now().Add(work)
+			ctx, cancel := context.WithDeadline(c.Request().Context(), deadline)
+			defer cancel()
+			ctx = context.WithValue(ctx, budgetCtxKey{}, requestBudget{total: total, deadline: deadline})
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+			if err != nil && errors.Is(err, context.DeadlineExceeded) && !c.Response().Committed {
+				return budgetExceeded(c, nil)
+			}
+			return err
+		}
+	}
+}
+
+func isBudgetExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// budgetExceeded answers 504, with hints on how a retry could fit.
+func budgetExceeded(c echo.Context, hints map[string]interface{}) error {
+	body := map[string]interface{}{"message": "Request deadline exceeded"}
+	if b, ok := c.Request().Context().Value(budgetCtxKey{}).(requestBudget); ok {
+		body["budget"] = b.total.String()
+	}
+	for k, v := range hints {
+		body[k] = v
+	}
+	return c.JSON(http.StatusGatewayTimeout, body)
+}
+
+// --- Response DTOs ---
+// Handlers never serialize domain structs. Each redaction profile has its own
+// DTO type, and a DTO can only be built by its mapping function, which copies
+// fields one by one: a field added to User stays private until a mapping
+// names it, and a DTO has nowhere to put PasswordHash.
+
+type Profile string
+
+const (
+	ProfilePublic Profile = "public"
+	ProfileOwner  Profile = "owner"
+	ProfileAdmin  Profile = "admin"
+)
+
+// UserView is implemented only by the user DTOs below.
+type UserView interface {
+	userView()
+}
+
+type PublicUserDTO struct {
+	ID        uuid.UUID `json:"id"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OwnerUserDTO struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AdminUserDTO struct {
+	ID          uuid.UUID `json:"id"`
+	Email       string    `json:"email"`
+	Role        Role      `json:"role"`
+	IsActive    bool      `json:"is_active"`
+	HasPassword bool      `json:"has_password"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (PublicUserDTO) userView() {}
+func (OwnerUserDTO) userView()  {}
+func (AdminUserDTO) userView()  {}
+
+func toPublicUser(u *User) PublicUserDTO {
+	return PublicUserDTO{ID: u.ID, Role: u.Role, CreatedAt: u.CreatedAt}
+}
+
+func toOwnerUser(u *User) OwnerUserDTO {
+	return OwnerUserDTO{ID: u.ID, Email: u.Email, Role: u.Role, IsActive: u.IsActive, CreatedAt: u.CreatedAt}
+}
+
+func toAdminUser(u *User) AdminUserDTO {
+	return AdminUserDTO{
+		ID:          u.ID,
+		Email:       u.Email,
+		Role:        u.Role,
+		IsActive:    u.IsActive,
+		HasPassword: u.PasswordHash != "",
+		CreatedAt:   u.CreatedAt,
+	}
+}
+
+// userMappers is checked by the compiler: every entry must map *User to a UserView.
+var userMappers = map[Profile]func(*User) UserView{
+	ProfilePublic: func(u *User) UserView { return toPublicUser(u) },
+	ProfileOwner:  func(u *User) UserView { return toOwnerUser(u) },
+	ProfileAdmin:  func(u *User) UserView { return toAdminUser(u) },
+}
+
+// profileFor picks what caller (nil when anonymous) may see of subject.
+func profileFor(caller, subject *User) Profile {
+	switch {
+	case caller != nil && caller.Role == RoleAdmin:
+		return ProfileAdmin
+	case caller != nil && caller.ID == subject.ID:
+		return ProfileOwner
+	default:
+		return ProfilePublic
+	}
+}
+
+func viewUser(caller, subject *User) UserView {
+	return userMappers[profileFor(caller, subject)](subject)
+}
+
+// sensitiveUserFields must not appear in any DTO field name or JSON tag.
+var sensitiveUserFields = []string{"password", "hash"}
+
+// checkUserDTOs backs the selftest command: no DTO type declares a sensitive
+// field, and no rendered profile contains the password hash.
+func checkUserDTOs() error {
+	for profile, mapper := range userMappers {
+		probe := &User{ID: uuid.New(), Email: "probe@example.com", PasswordHash: "hashed_s3cret-probe", Role: RoleUser, IsActive: true}
+		view := mapper(probe)
+		t := reflect.TypeOf(view)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "HasPassword" {
+				continue // a flag, not the secret
+			}
+			name, tag := strings.ToLower(f.Name), strings.ToLower(f.Tag.Get("json"))
+			for _, s := range sensitiveUserFields {
+				if strings.Contains(name, s) || strings.Contains(tag, s) {
+					return fmt.Errorf("%s profile: field %s looks sensitive", profile, f.Name)
+				}
+			}
+		}
+		body, err := json.Marshal(view)
+		if err != nil {
+			return fmt.Errorf("%s profile: %w", profile, err)
+		}
+		if bytes.Contains(body, []byte("s3cret-probe")) {
+			return fmt.Errorf("%s profile leaks the password hash: %s", profile, body)
+		}
+		if profile == ProfilePublic && bytes.Contains(body, []byte(probe.Email)) {
+			return fmt.Errorf("public profile leaks the email: %s", body)
+		}
+	}
+	caller := &User{ID: uuid.New(), Role: RoleUser}
+	other := &User{ID: uuid.New(), Role: RoleUser}
+	admin := &User{ID: uuid.New(), Role: RoleAdmin}
+	for _, tc := range []struct {
+		caller, subject *User
+		want            Profile
+	}{
+		{nil, other, ProfilePublic},
+		{caller, other, ProfilePublic},
+		{caller, caller, ProfileOwner},
+		{admin, other, ProfileAdmin},
+	} {
+		if got := profileFor(tc.caller, tc.subject); got != tc.want {
+			return fmt.Errorf("profileFor: got %s, want %s", got, tc.want)
+		}
+	}
+	return nil
+}
+
 // --- Controller/Handler Layer ---
 
 type UserController struct {
@@ -222,7 +559,36 @@ func NewUserController(svc UserService) *UserController {
 	return &UserController{userService: svc}
 }
 
+// identify authenticates the caller from HTTP Basic credentials (email and
+// password). Requests without credentials are served as anonymous; wrong
+// credentials are rejected rather than downgraded.
+func (ctrl *UserController) identify(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, password, ok := c.Request().BasicAuth()
+		if !ok {
+			return next(c)
+		}
+		caller, err := ctrl.userService.Authenticate(c.Request().Context(), email, password)
+		if isBudgetExceeded(err) {
+			return budgetExceeded(c, nil)
+		} else if errors.Is(err, ErrInvalidCredentials) {
+			c.Response().Header().Set("WWW-Authenticate", `Basic realm="users"`)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid credentials"})
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not authenticate"})
+		}
+		c.Set("caller", caller)
+		return next(c)
+	}
+}
+
+func callerOf(c echo.Context) *User {
+	caller, _ := c.Get("caller").(*User)
+	return caller
+}
+
 func (ctrl *UserController) RegisterRoutes(g *echo.Group) {
+	g.Use(ctrl.identify)
 	g.POST("", ctrl.Create)
 	g.GET("/:id", ctrl.Get)
 	g.PUT("/:id", ctrl.Update)
@@ -240,12 +606,19 @@ func (ctrl *UserController) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
 	}
 	user, err := ctrl.userService.Create(c.Request().Context(), req.Email, req.Password, req.Role)
-	if errors.Is(err, ErrAlreadyExists) {
+	if isBudgetExceeded(err) {
+		return budgetExceeded(c, nil)
+	} else if errors.Is(err, ErrAlreadyExists) {
 		return c.JSON(http.StatusConflict, map[string]string{"message": "Email already in use"})
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not create user"})
 	}
-	return c.JSON(http.StatusCreated, user)
+	// Whoever created the account chose its credentials, so they see at
+	// least the owner view of it.
+	if caller := callerOf(c); caller != nil && caller.Role == RoleAdmin {
+		return c.JSON(http.StatusCreated, toAdminUser(user))
+	}
+	return c.JSON(http.StatusCreated, toOwnerUser(user))
 }
 
 func (ctrl *UserController) Get(c echo.Context) error {
@@ -254,12 +627,14 @@ func (ctrl *UserController) Get(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid ID"})
 	}
 	user, err := ctrl.userService.Get(c.Request().Context(), id)
-	if errors.Is(err, ErrNotFound) {
+	if isBudgetExceeded(err) {
+		return budgetExceeded(c, nil)
+	} else if errors.Is(err, ErrNotFound) {
 		return c.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not retrieve user"})
 	}
-	return c.JSON(http.StatusOK, user)
+	return c.JSON(http.StatusOK, viewUser(callerOf(c), user))
 }
 
 func (ctrl *UserController) Update(c echo.Context) error {
@@ -276,12 +651,14 @@ func (ctrl *UserController) Update(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
 	}
 	user, err := ctrl.userService.Update(c.Request().Context(), id, req.Email, req.Role, req.IsActive)
-	if errors.Is(err, ErrNotFound) {
+	if isBudgetExceeded(err) {
+		return budgetExceeded(c, nil)
+	} else if errors.Is(err, ErrNotFound) {
 		return c.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not update user"})
 	}
-	return c.JSON(http.StatusOK, user)
+	return c.JSON(http.StatusOK, viewUser(callerOf(c), user))
 }
 
 func (ctrl *UserController) Delete(c echo.Context) error {
@@ -290,7 +667,9 @@ func (ctrl *UserController) Delete(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid ID"})
 	}
 	err = ctrl.userService.Delete(c.Request().Context(), id)
-	if errors.Is(err, ErrNotFound) {
+	if isBudgetExceeded(err) {
+		return budgetExceeded(c, nil)
+	} else if errors.Is(err, ErrNotFound) {
 		return c.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not delete user"})
@@ -322,20 +701,97 @@ func (ctrl *UserController) List(c echo.Context) error {
 	params.Offset = offset
 
 	users, err := ctrl.userService.List(c.Request().Context(), params)
+	if isBudgetExceeded(err) {
+		// A smaller page or a narrower filter may fit in the budget.
+		hints := map[string]interface{}{"hint": "retry with a smaller limit or add role/is_active filters"}
+		if limit > 1 {
+			hints["retry_limit"] = limit / 2
+		}
+		return budgetExceeded(c, hints)
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Could not list users"})
 	}
-	return c.JSON(http.StatusOK, users)
+	caller := callerOf(c)
+	views := make([]UserView, len(users))
+	for i := range users {
+		views[i] = viewUser(caller, &users[i])
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+// checkIdentify backs the selftest command: only real credentials raise
+// the redaction profile, and a claimed user ID counts for nothing.
+func checkIdentify() error {
+	ctx := context.Background()
+	svc := NewUserService(NewMemoryUserRepository(), nil)
+	admin, err := svc.Create(ctx, "admin@example.com", "adminpass", RoleAdmin)
+	if err != nil {
+		return err
+	}
+	user, err := svc.Create(ctx, "user@example.com", "userpass", RoleUser)
+	if err != nil {
+		return err
+	}
+	e := echo.New()
+	NewUserController(svc).RegisterRoutes(e.Group("/users"))
+
+	get := func(setup func(*http.Request)) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, "/users/"+user.ID.String(), nil)
+		setup(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var body map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+	for _, tc := range []struct {
+		name      string
+		setup     func(*http.Request)
+		wantCode  int
+		wantEmail bool
+	}{
+		{"anonymous", func(*http.Request) {}, http.StatusOK, false},
+		{"claimed admin ID", func(r *http.Request) { r.Header.Set("X-User-ID", admin.ID.String()) }, http.StatusOK, false},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("admin@example.com", "guess") }, http.StatusUnauthorized, false},
+		{"admin", func(r *http.Request) { r.SetBasicAuth("admin@example.com", "adminpass") }, http.StatusOK, true},
+		{"owner", func(r *http.Request) { r.SetBasicAuth("user@example.com", "userpass") }, http.StatusOK, true},
+	} {
+		code, body := get(tc.setup)
+		if code != tc.wantCode {
+			return fmt.Errorf("identify %s: got status %d, want %d", tc.name, code, tc.wantCode)
+		}
+		if _, hasEmail := body["email"]; code == http.StatusOK && hasEmail != tc.wantEmail {
+			return fmt.Errorf("identify %s: email shown = %v, want %v", tc.name, hasEmail, tc.wantEmail)
+		}
+	}
+	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		if err := checkUserDTOs(); err != nil {
+			log.Fatalf("selftest: %v", err)
+		}
+		if err := checkIdentify(); err != nil {
+			log.Fatalf("selftest: %v", err)
+		}
+		log.Println("selftest: ok")
+		return
+	}
+
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	budgets := LoadBudgetConfig(map[string]time.Duration{
+		"GET /users": 3 * time.Second,
+	})
+	e.Use(DeadlineBudget(budgets))
+	log.Printf("Request budget %s (reserve %s)", budgets.Default, budgets.Reserve)
 
 	// Dependency Injection
 	userRepo := NewMemoryUserRepository()
-	userService := NewUserService(userRepo)
+	userService := NewUserService(userRepo, NewUserEventNotifier(os.Getenv("USER_WEBHOOK_URL")))
 	userController := NewUserController(userService)
 
 	// Seed data
@@ -2,8 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +30,9 @@ type AppConfig struct {
 	JWTSecret    string
 	OAuthConfig  *oauth2.Config
 	SessionStore *session.Store
+	// OpenRegistration lets anyone register; otherwise an invite code is
+	// required. Set OPEN_REGISTRATION=true to enable.
+	OpenRegistration bool
 }
 
 func LoadConfig() *AppConfig {
@@ -34,7 +45,8 @@ func LoadConfig() *AppConfig {
 			Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email"},
 			Endpoint:     google.Endpoint,
 		},
-		SessionStore: session.New(),
+		SessionStore:     session.New(),
+		OpenRegistration: os.Getenv("OPEN_REGISTRATION") == "true",
 	}
 }
 
@@ -68,22 +80,104 @@ type Post struct {
 	Status  Status    `json:"status"`
 }
 
+// Invite lets someone register while open registration is off. An invite
+// bound to Email can only be redeemed for that address. Only a hash of the
+// code is kept; the code itself is shown once, when the invite is created.
+type Invite struct {
+	ID          uuid.UUID          `json:"id"`
+	CodeHash    string             `json:"-"`
+	Email       string             `json:"email,omitempty"`
+	Role        Role               `json:"role"`
+	MaxUses     int                `json:"max_uses"`
+	Uses        int                `json:"uses"`
+	ExpiresAt   time.Time          `json:"expires_at"`
+	CreatedBy   uuid.UUID          `json:"created_by"`
+	CreatedAt   time.Time          `json:"created_at"`
+	RevokedAt   *time.Time         `json:"revoked_at,omitempty"`
+	Redemptions []InviteRedemption `json:"redemptions"`
+}
+
+type InviteRedemption struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	At     time.Time `json:"at"`
+}
+
+func (inv *Invite) Status(now time.Time) string {
+	switch {
+	case inv.RevokedAt != nil:
+		return "revoked"
+	case !now.Before(inv.ExpiresAt):
+		return "expired"
+	case inv.Uses >= inv.MaxUses:
+		return "exhausted"
+	}
+	return "active"
+}
+
 // --- package: store ---
 type DataStore struct {
-	mu    sync.RWMutex
-	Users map[string]*User
-	Posts map[uuid.UUID]*Post
+	mu      sync.RWMutex
+	Users   map[string]*User
+	Posts   map[uuid.UUID]*Post
+	Invites map[uuid.UUID]*Invite
 }
 
 func NewDataStore() *DataStore {
 	ds := &DataStore{
-		Users: make(map[string]*User),
-		Posts: make(map[uuid.UUID]*Post),
+		Users:   make(map[string]*User),
+		Posts:   make(map[uuid.UUID]*Post),
+		Invites: make(map[uuid.UUID]*Invite),
 	}
 	ds.init()
 	return ds
 }
 
+var (
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrInviteInvalid       = errors.New("invite code is invalid or has expired")
+	ErrInviteEmailMismatch = errors.New("invite is for a different email address")
+)
+
+func hashInviteCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateUser registers user, redeeming inviteCode when it is non-empty. The
+// invite checks, the user insert and the use count all happen under one
+// lock, so an invite can never be redeemed more than MaxUses times and a
+// failed registration never consumes a use.
+func (ds *DataStore) CreateUser(user *User, inviteCode string, now time.Time) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if _, exists := ds.Users[user.Email]; exists {
+		return ErrEmailTaken
+	}
+
+	var invite *Invite
+	if inviteCode != "" {
+		hash := hashInviteCode(inviteCode)
+		for _, inv := range ds.Invites {
+			if inv.CodeHash == hash {
+				invite = inv
+				break
+			}
+		}
+		if invite == nil || invite.Status(now) != "active" {
+			return ErrInviteInvalid
+		}
+		if invite.Email != "" && !strings.EqualFold(invite.Email, user.Email) {
+			return ErrInviteEmailMismatch
+		}
+		user.Role = invite.Role
+		invite.Uses++
+		invite.Redemptions = append(invite.Redemptions, InviteRedemption{UserID: user.ID, Email: user.Email, At: now})
+	}
+	ds.Users[user.Email] = user
+	return nil
+}
+
 func (ds *DataStore) init() {
 	adminPass, _ := bcrypt.GenerateFromPassword([]byte("admin!@#"), bcrypt.DefaultCost)
 	ds.Users["admin@domain.com"] = &User{ID: uuid.New(), Email: "admin@domain.com", PasswordHash: string(adminPass), Role: ADMIN, IsActive: true}
@@ -155,6 +249,41 @@ func (m *AuthModule) Login(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"token": signedToken})
 }
 
+// Register creates a USER account, or one with the invite's role when an
+// invite code is given. Without open registration an invite is required.
+func (m *AuthModule) Register(c *fiber.Ctx) error {
+	var body struct {
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request"})
+	}
+	body.Email = strings.ToLower(strings.TrimSpace(body.Email))
+	if !strings.Contains(body.Email, "@") || len(body.Password) < 8 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "A valid email and a password of at least 8 characters are required"})
+	}
+	if body.InviteCode == "" && !m.Cfg.OpenRegistration {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Registration requires an invite code"})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not create account"})
+	}
+	user := &User{ID: uuid.New(), Email: body.Email, PasswordHash: string(hash), Role: USER, IsActive: true, CreatedAt: time.Now().UTC()}
+	switch err := m.DB.CreateUser(user, body.InviteCode, time.Now().UTC()); {
+	case errors.Is(err, ErrEmailTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, ErrInviteInvalid), errors.Is(err, ErrInviteEmailMismatch):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not create account"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
+
 func (m *AuthModule) OAuthRedirect(c *fiber.Ctx) error {
 	sess, _ := m.Cfg.SessionStore.Get(c)
 	defer sess.Save()
@@ -174,6 +303,11 @@ func (m *AuthModule) OAuthCallback(c *fiber.Ctx) error {
 	oauthEmail := "oauth.user.v3@example.com"
 	m.DB.mu.Lock()
 	user, exists := m.DB.Users[oauthEmail]
+	if !exists && !m.Cfg.OpenRegistration {
+		// New accounts need an invite; OAuth must not be a way around that.
+		m.DB.mu.Unlock()
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Registration requires an invite code"})
+	}
 	if !exists {
 		user = &User{ID: uuid.New(), Email: oauthEmail, Role: USER, IsActive: true}
 		m.DB.Users[oauthEmail] = user
@@ -188,10 +322,147 @@ func (m *AuthModule) OAuthCallback(c *fiber.Ctx) error {
 
 func (m *AuthModule) RegisterRoutes(router fiber.Router) {
 	router.Post("/login", m.Login)
+	router.Post("/register", m.Register)
 	router.Get("/redirect", m.OAuthRedirect)
 	router.Get("/callback", m.OAuthCallback)
 }
 
+// --- package: invite ---
+type InviteModule struct {
+	DB *DataStore
+}
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 90 * 24 * time.Hour
+)
+
+func newInviteCode() (string, error) {
+	b := make([]byte, 15)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// CreateInvite makes an invite. Email-bound invites are single-use; open
+// invites default to one use unless max_uses says otherwise.
+func (m *InviteModule) CreateInvite(c *fiber.Ctx) error {
+	var body struct {
+		Email          string `json:"email"`
+		Role           Role   `json:"role"`
+		MaxUses        int    `json:"max_uses"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request"})
+	}
+	body.Email = strings.ToLower(strings.TrimSpace(body.Email))
+	if body.Role == "" {
+		body.Role = USER
+	}
+	if body.Role != USER && body.Role != ADMIN {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "role must be USER or ADMIN"})
+	}
+	if body.MaxUses == 0 {
+		body.MaxUses = 1
+	}
+	if body.MaxUses < 1 || (body.Email != "" && body.MaxUses != 1) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "max_uses must be positive, and 1 for email-bound invites"})
+	}
+	ttl := defaultInviteTTL
+	if body.ExpiresInHours != 0 {
+		ttl = time.Duration(body.ExpiresInHours) * time.Hour
+	}
+	if ttl <= 0 || ttl > maxInviteTTL {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "expires_in_hours must be between 1 and 2160"})
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not create invite"})
+	}
+	claims := c.Locals("jwt").(*jwt.Token).Claims.(jwt.MapClaims)
+	createdBy, _ := uuid.Parse(claims["uid"].(string))
+	now := time.Now().UTC()
+	invite := &Invite{
+		ID:          uuid.New(),
+		CodeHash:    hashInviteCode(code),
+		Email:       body.Email,
+		Role:        body.Role,
+		MaxUses:     body.MaxUses,
+		ExpiresAt:   now.Add(ttl),
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		Redemptions: []InviteRedemption{},
+	}
+	m.DB.mu.Lock()
+	m.DB.Invites[invite.ID] = invite
+	m.DB.mu.Unlock()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"invite": invite, "code": code})
+}
+
+// ListInvites returns every invite with its status and usage, newest first.
+// ?status=active|expired|exhausted|revoked filters the list.
+func (m *InviteModule) ListInvites(c *fiber.Ctx) error {
+	type inviteView struct {
+		Invite
+		Status    string `json:"status"`
+		Remaining int    `json:"remaining_uses"`
+	}
+	now := time.Now().UTC()
+	want := c.Query("status")
+	stats := map[string]int{"active": 0, "expired": 0, "exhausted": 0, "revoked": 0}
+	totalUses := 0
+
+	m.DB.mu.RLock()
+	views := make([]inviteView, 0, len(m.DB.Invites))
+	for _, inv := range m.DB.Invites {
+		status := inv.Status(now)
+		stats[status]++
+		totalUses += inv.Uses
+		if want != "" && status != want {
+			continue
+		}
+		v := inviteView{Invite: *inv, Status: status}
+		v.Redemptions = append([]InviteRedemption{}, inv.Redemptions...)
+		if status == "active" {
+			v.Remaining = inv.MaxUses - inv.Uses
+		}
+		views = append(views, v)
+	}
+	m.DB.mu.RUnlock()
+
+	sort.Slice(views, func(i, j int) bool { return views[i].CreatedAt.After(views[j].CreatedAt) })
+	return c.JSON(fiber.Map{"invites": views, "by_status": stats, "total_redemptions": totalUses})
+}
+
+// RevokeInvite stops further use. Accounts already created stay as they are.
+func (m *InviteModule) RevokeInvite(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid invite ID"})
+	}
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	invite, ok := m.DB.Invites[id]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Invite not found"})
+	}
+	if invite.RevokedAt == nil {
+		now := time.Now().UTC()
+		invite.RevokedAt = &now
+	}
+	return c.JSON(invite)
+}
+
+func (m *InviteModule) RegisterRoutes(router fiber.Router) {
+	router.Post("/invites", m.CreateInvite)
+	router.Get("/invites", m.ListInvites)
+	router.Delete("/invites/:id", m.RevokeInvite)
+}
+
 // --- package: post ---
 type PostModule struct {
 	DB *DataStore
@@ -233,6 +504,7 @@ func main() {
 	// Module Instantiation
 	authModule := &AuthModule{DB: dataStore, Cfg: config}
 	postModule := &PostModule{DB: dataStore}
+	inviteModule := &InviteModule{DB: dataStore}
 
 	// Route Registration
 	authRouter := app.Group("/auth")
@@ -242,6 +514,7 @@ func main() {
 	postModule.RegisterRoutes(apiRouter)
 
 	adminRouter := apiRouter.Group("/admin", RBAC(ADMIN))
+	inviteModule.RegisterRoutes(adminRouter)
 	adminRouter.Get("/stats", func(c *fiber.Ctx) error {
 		dataStore.mu.RLock()
 		defer dataStore.mu.RUnlock()
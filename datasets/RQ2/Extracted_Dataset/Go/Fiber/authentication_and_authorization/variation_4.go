@@ -5,8 +5,12 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -70,13 +74,198 @@ func seedData() {
 	usersByEmail[user.Email] = user
 }
 
+// --- i18n: Message Catalogs ---
+
+// MessageCode is the machine-readable part of every error response. Codes are
+// stable across languages; only the accompanying message is translated.
+type MessageCode string
+const (
+	ERR_INVALID_TOKEN       MessageCode = "AUTH_INVALID_TOKEN"
+	ERR_INVALID_CLAIMS      MessageCode = "AUTH_INVALID_CLAIMS"
+	ERR_MALFORMED_USER_ID   MessageCode = "AUTH_MALFORMED_USER_ID"
+	ERR_USER_INACTIVE       MessageCode = "AUTH_USER_INACTIVE"
+	ERR_INVALID_CREDENTIALS MessageCode = "AUTH_INVALID_CREDENTIALS"
+	ERR_INVALID_STATE       MessageCode = "AUTH_INVALID_OAUTH_STATE"
+	ERR_FORBIDDEN           MessageCode = "AUTH_INSUFFICIENT_PERMISSIONS"
+	ERR_USER_CONTEXT        MessageCode = "INTERNAL_USER_CONTEXT_MISSING"
+	ERR_TOKEN_CREATION      MessageCode = "INTERNAL_TOKEN_CREATION_FAILED"
+	ERR_BAD_REQUEST         MessageCode = "REQUEST_UNPARSABLE"
+	ERR_VALIDATION          MessageCode = "VALIDATION_FAILED"
+	VAL_REQUIRED            MessageCode = "VALIDATION_REQUIRED"
+	VAL_MAX_LENGTH          MessageCode = "VALIDATION_MAX_LENGTH"
+)
+
+const DEFAULT_LANGUAGE = "en"
+
+// Placeholders like {field} are filled from the params passed to translate.
+var messageCatalogs = map[string]map[MessageCode]string{
+	"en": {
+		ERR_INVALID_TOKEN:       "Invalid or expired token",
+		ERR_INVALID_CLAIMS:      "Invalid token claims",
+		ERR_MALFORMED_USER_ID:   "Malformed user ID in token",
+		ERR_USER_INACTIVE:       "User not found or inactive",
+		ERR_INVALID_CREDENTIALS: "Invalid email or password",
+		ERR_INVALID_STATE:       "Invalid state",
+		ERR_FORBIDDEN:           "Insufficient permissions",
+		ERR_USER_CONTEXT:        "User context not found",
+		ERR_TOKEN_CREATION:      "Failed to create token",
+		ERR_BAD_REQUEST:         "Cannot parse request",
+		ERR_VALIDATION:          "The request contains invalid fields",
+		VAL_REQUIRED:            "{field} is required",
+		VAL_MAX_LENGTH:          "{field} must be at most {max} characters",
+	},
+	"es": {
+		ERR_INVALID_TOKEN:       "Token inválido o expirado",
+		ERR_INVALID_CLAIMS:      "Claims del token inválidos",
+		ERR_MALFORMED_USER_ID:   "ID de usuario mal formado en el token",
+		ERR_USER_INACTIVE:       "Usuario no encontrado o inactivo",
+		ERR_INVALID_CREDENTIALS: "Correo electrónico o contraseña inválidos",
+		ERR_INVALID_STATE:       "Estado inválido",
+		ERR_FORBIDDEN:           "Permisos insuficientes",
+		ERR_USER_CONTEXT:        "No se encontró el contexto del usuario",
+		ERR_TOKEN_CREATION:      "No se pudo crear el token",
+		ERR_BAD_REQUEST:         "No se puede procesar la solicitud",
+		ERR_VALIDATION:          "La solicitud contiene campos inválidos",
+		VAL_REQUIRED:            "{field} es obligatorio",
+		VAL_MAX_LENGTH:          "{field} debe tener como máximo {max} caracteres",
+	},
+	"hi": {
+		ERR_INVALID_TOKEN:       "टोकन अमान्य है या उसकी समय-सीमा समाप्त हो गई है",
+		ERR_INVALID_CLAIMS:      "टोकन के क्लेम अमान्य हैं",
+		ERR_MALFORMED_USER_ID:   "टोकन में उपयोगकर्ता आईडी गलत है",
+		ERR_USER_INACTIVE:       "उपयोगकर्ता नहीं मिला या निष्क्रिय है",
+		ERR_INVALID_CREDENTIALS: "ईमेल या पासवर्ड अमान्य है",
+		ERR_INVALID_STATE:       "अमान्य स्थिति",
+		ERR_FORBIDDEN:           "अपर्याप्त अनुमतियाँ",
+		ERR_USER_CONTEXT:        "उपयोगकर्ता संदर्भ नहीं मिला",
+		ERR_TOKEN_CREATION:      "टोकन नहीं बनाया जा सका",
+		ERR_BAD_REQUEST:         "अनुरोध को पढ़ा नहीं जा सका",
+		ERR_VALIDATION:          "अनुरोध में अमान्य फ़ील्ड हैं",
+		VAL_REQUIRED:            "{field} आवश्यक है",
+		VAL_MAX_LENGTH:          "{field} अधिकतम {max} अक्षरों का होना चाहिए",
+	},
+}
+
+// languageFallbacks returns the lookup chain for a tag: "es-MX" -> "es-MX", "es", "en".
+func languageFallbacks(tag string) []string {
+	chain := []string{tag}
+	if base, _, found := strings.Cut(tag, "-"); found {
+		chain = append(chain, base)
+	}
+	if tag != DEFAULT_LANGUAGE {
+		chain = append(chain, DEFAULT_LANGUAGE)
+	}
+	return chain
+}
+
+// translate walks the fallback chain and, if no catalog knows the code,
+// returns the code itself so clients still get something actionable.
+func translate(lang string, code MessageCode, params map[string]string) string {
+	msg := string(code)
+	for _, l := range languageFallbacks(lang) {
+		if m, ok := messageCatalogs[l][code]; ok {
+			msg = m
+			break
+		}
+	}
+	for k, v := range params {
+		msg = strings.ReplaceAll(msg, "{"+k+"}", v)
+	}
+	return msg
+}
+
+type languagePreference struct {
+	tag     string
+	quality float64
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header sorted by q-value.
+func parseAcceptLanguage(header string) []string {
+	var prefs []languagePreference
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, languagePreference{tag: strings.ToLower(tag), quality: q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].quality > prefs[j].quality })
+	tags := make([]string, len(prefs))
+	for i, p := range prefs {
+		tags[i] = p.tag
+	}
+	return tags
+}
+
+// 0. Language Negotiation Middleware
+func negotiateLanguage(c *fiber.Ctx) error {
+	lang := DEFAULT_LANGUAGE
+	for _, tag := range parseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage)) {
+		if _, ok := messageCatalogs[tag]; ok {
+			lang = tag
+			break
+		}
+		if base, _, _ := strings.Cut(tag, "-"); messageCatalogs[base] != nil {
+			lang = base
+			break
+		}
+	}
+	c.Locals("lang", lang)
+	c.Set(fiber.HeaderContentLanguage, lang)
+	return c.Next()
+}
+
+func requestLanguage(c *fiber.Ctx) string {
+	if lang, ok := c.Locals("lang").(string); ok {
+		return lang
+	}
+	return DEFAULT_LANGUAGE
+}
+
+// errorResponse renders the standard error body with a localized message.
+func errorResponse(c *fiber.Ctx, status int, code MessageCode) error {
+	return c.Status(status).JSON(fiber.Map{"status": "error", "code": code, "message": translate(requestLanguage(c), code, nil)})
+}
+
+type FieldError struct {
+	Field  string
+	Code   MessageCode
+	Params map[string]string
+}
+
+func validationErrorResponse(c *fiber.Ctx, fieldErrors []FieldError) error {
+	lang := requestLanguage(c)
+	details := make([]fiber.Map, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		params := map[string]string{"field": fe.Field}
+		for k, v := range fe.Params {
+			params[k] = v
+		}
+		details[i] = fiber.Map{"field": fe.Field, "code": fe.Code, "message": translate(lang, fe.Code, params)}
+	}
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"status":  "error",
+		"code":    ERR_VALIDATION,
+		"message": translate(lang, ERR_VALIDATION, nil),
+		"errors":  details,
+	})
+}
+
 // --- Middleware Chain ---
 
 // 1. JWT Validator Middleware
 var jwtMiddleware = jwtware.New(jwtware.Config{
 	SigningKey: jwtSecret,
 	ErrorHandler: func(c *fiber.Ctx, err error) error {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid or expired token"})
+		return errorResponse(c, fiber.StatusUnauthorized, ERR_INVALID_TOKEN)
 	},
 })
 
@@ -86,12 +275,12 @@ func loadUserFromJWT(c *fiber.Ctx) error {
 	claims := token.Claims.(jwt.MapClaims)
 	userIDStr, ok := claims["sub"].(string)
 	if !ok {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Invalid token claims"})
+		return errorResponse(c, fiber.StatusForbidden, ERR_INVALID_CLAIMS)
 	}
 
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Malformed user ID in token"})
+		return errorResponse(c, fiber.StatusForbidden, ERR_MALFORMED_USER_ID)
 	}
 
 	dbMutex.RLock()
@@ -99,7 +288,7 @@ func loadUserFromJWT(c *fiber.Ctx) error {
 	dbMutex.RUnlock()
 
 	if !exists || !user.IsActive {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "User not found or inactive"})
+		return errorResponse(c, fiber.StatusForbidden, ERR_USER_INACTIVE)
 	}
 
 	c.Locals("currentUser", user)
@@ -111,11 +300,11 @@ func requireRole(r Role) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		currentUser, ok := c.Locals("currentUser").(*User)
 		if !ok {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "User context not found"})
+			return errorResponse(c, fiber.StatusInternalServerError, ERR_USER_CONTEXT)
 		}
 
 		if currentUser.Role != r {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Insufficient permissions"})
+			return errorResponse(c, fiber.StatusForbidden, ERR_FORBIDDEN)
 		}
 		return c.Next()
 	}
@@ -129,7 +318,7 @@ func loginHandler(c *fiber.Ctx) error {
 		Password string `json:"password"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Cannot parse request"})
+		return errorResponse(c, fiber.StatusBadRequest, ERR_BAD_REQUEST)
 	}
 
 	dbMutex.RLock()
@@ -137,7 +326,7 @@ func loginHandler(c *fiber.Ctx) error {
 	dbMutex.RUnlock()
 
 	if !exists || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid email or password"})
+		return errorResponse(c, fiber.StatusUnauthorized, ERR_INVALID_CREDENTIALS)
 	}
 
 	claims := jwt.MapClaims{
@@ -150,7 +339,7 @@ func loginHandler(c *fiber.Ctx) error {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, err := token.SignedString(jwtSecret)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to create token"})
+		return errorResponse(c, fiber.StatusInternalServerError, ERR_TOKEN_CREATION)
 	}
 
 	return c.JSON(fiber.Map{"status": "success", "token": signedToken})
@@ -163,7 +352,10 @@ func createPostHandler(c *fiber.Ctx) error {
 		Content string `json:"content"`
 	}
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid post format"})
+		return errorResponse(c, fiber.StatusBadRequest, ERR_BAD_REQUEST)
+	}
+	if fieldErrors := validatePostInput(req.Title, req.Content); len(fieldErrors) > 0 {
+		return validationErrorResponse(c, fieldErrors)
 	}
 
 	postID := uuid.New()
@@ -182,6 +374,21 @@ func createPostHandler(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(newPost)
 }
 
+const MAX_TITLE_LENGTH = 200
+
+func validatePostInput(title, content string) []FieldError {
+	var errs []FieldError
+	if strings.TrimSpace(title) == "" {
+		errs = append(errs, FieldError{Field: "title", Code: VAL_REQUIRED})
+	} else if utf8.RuneCountInString(title) > MAX_TITLE_LENGTH {
+		errs = append(errs, FieldError{Field: "title", Code: VAL_MAX_LENGTH, Params: map[string]string{"max": strconv.Itoa(MAX_TITLE_LENGTH)}})
+	}
+	if strings.TrimSpace(content) == "" {
+		errs = append(errs, FieldError{Field: "content", Code: VAL_REQUIRED})
+	}
+	return errs
+}
+
 func adminDashboardHandler(c *fiber.Ctx) error {
 	currentUser := c.Locals("currentUser").(*User)
 	dbMutex.RLock()
@@ -202,6 +409,7 @@ func main() {
 	seedData()
 	app := fiber.New()
 	app.Use(logger.New())
+	app.Use(negotiateLanguage)
 
 	sessionStore := session.New()
 	oauthCfg := &oauth2.Config{
@@ -228,7 +436,7 @@ func main() {
 		sess, _ := sessionStore.Get(c)
 		defer sess.Save()
 		if c.Query("state") != sess.Get("state") {
-			return c.Status(http.StatusUnauthorized).SendString("Invalid state")
+			return errorResponse(c, http.StatusUnauthorized, ERR_INVALID_STATE)
 		}
 		// Mock user creation/login after successful OAuth
 		oauthEmail := "oauth.user.v4@example.com"
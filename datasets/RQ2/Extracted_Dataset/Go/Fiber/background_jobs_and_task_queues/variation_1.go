@@ -1,22 +1,35 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
-	"math/rand"
+	mrand "math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/robfig/cron/v3"
 )
 
 // --- go.mod ---
@@ -27,6 +40,7 @@ import (
 // 	github.com/gofiber/fiber/v2 v2.52.4
 // 	github.com/google/uuid v1.6.0
 // 	github.com/hibiken/asynq v0.24.1
+// 	github.com/robfig/cron/v3 v3.0.1
 // )
 // ---
 
@@ -39,12 +53,15 @@ const (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         UserRole  `json:"role"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           uuid.UUID  `json:"id"`
+	Email        string     `json:"email"`
+	Name         string     `json:"name,omitempty"`
+	PasswordHash string     `json:"-"`
+	Role         UserRole   `json:"role"`
+	IsActive     bool       `json:"is_active"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastActiveAt time.Time  `json:"last_active_at"`
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
 }
 
 type PostStatus string
@@ -75,6 +92,7 @@ const (
 	TypeImageResize       = "image:resize"
 	TypeImageWatermark    = "image:watermark"
 	TypePeriodicCleanup   = "task:cleanup:inactive_users"
+	TypeAdminBulkUsers    = "admin:bulk_users"
 )
 
 type WelcomeEmailPayload struct {
@@ -87,7 +105,11 @@ type ImageProcessingPayload struct {
 }
 
 type CleanupPayload struct {
-	CutoffDate time.Time `json:"cutoff_date"`
+	ScheduleID string `json:"schedule_id"`
+}
+
+type BulkUsersPayload struct {
+	JobID string `json:"job_id"`
 }
 
 // --- Task Dispatcher (tasks/dispatcher.go) ---
@@ -106,7 +128,12 @@ func (d *TaskDispatcher) DispatchWelcomeEmail(ctx context.Context, userID uuid.U
 		return nil, err
 	}
 	task := asynq.NewTask(TypeEmailWelcome, payload, asynq.MaxRetry(5), asynq.Timeout(2*time.Minute))
-	return d.client.EnqueueContext(ctx, task)
+	info, err := d.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	recordLineage(info.ID, info.Type, info.Queue, "")
+	return info, nil
 }
 
 func (d *TaskDispatcher) DispatchImageProcessingPipeline(ctx context.Context, postID uuid.UUID, imageURL string) (*asynq.TaskInfo, error) {
@@ -114,11 +141,35 @@ func (d *TaskDispatcher) DispatchImageProcessingPipeline(ctx context.Context, po
 	if err != nil {
 		return nil, err
 	}
+	// The continuation gets its ID now so the chain's lineage is complete
+	// before the resize has run.
+	watermarkID := uuid.NewString()
 	resizeTask := asynq.NewTask(TypeImageResize, resizePayload, asynq.MaxRetry(3))
-	watermarkTask := asynq.NewTask(TypeImageWatermark, resizePayload, asynq.MaxRetry(3))
+	watermarkTask := asynq.NewTask(TypeImageWatermark, resizePayload, asynq.MaxRetry(3), asynq.TaskID(watermarkID))
 
 	// Chain tasks: watermark runs after resize is successful
-	return d.client.EnqueueContext(ctx, resizeTask, asynq.ContinueWith(watermarkTask))
+	info, err := d.client.EnqueueContext(ctx, resizeTask, asynq.ContinueWith(watermarkTask))
+	if err != nil {
+		return nil, err
+	}
+	recordLineage(info.ID, info.Type, info.Queue, "")
+	recordLineage(watermarkID, TypeImageWatermark, "default", info.ID)
+	return info, nil
+}
+
+func (d *TaskDispatcher) DispatchBulkUsers(ctx context.Context, jobID string) (*asynq.TaskInfo, error) {
+	payload, err := json.Marshal(BulkUsersPayload{JobID: jobID})
+	if err != nil {
+		return nil, err
+	}
+	// Retries resume from the last finished chunk, see HandleBulkUsersTask.
+	task := asynq.NewTask(TypeAdminBulkUsers, payload, asynq.Queue("low"), asynq.MaxRetry(3), asynq.Timeout(30*time.Minute))
+	info, err := d.client.EnqueueContext(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	recordLineage(info.ID, info.Type, info.Queue, "")
+	return info, nil
 }
 
 func (d *TaskDispatcher) Close() error {
@@ -157,10 +208,12 @@ func NewTaskProcessor(redisOpt asynq.RedisClientOpt) *TaskProcessor {
 
 func (p *TaskProcessor) Start() error {
 	mux := asynq.NewServeMux()
+	mux.Use(lineageMiddleware)
 	mux.HandleFunc(TypeEmailWelcome, HandleWelcomeEmailTask)
 	mux.HandleFunc(TypeImageResize, HandleImageResizeTask)
 	mux.HandleFunc(TypeImageWatermark, HandleImageWatermarkTask)
 	mux.HandleFunc(TypePeriodicCleanup, HandleCleanupTask)
+	mux.HandleFunc(TypeAdminBulkUsers, HandleBulkUsersTask)
 
 	return p.server.Run(mux)
 }
@@ -198,7 +251,7 @@ func HandleImageResizeTask(ctx context.Context, t *asynq.Task) error {
 	}
 	log.Printf("Processing image for PostID: %s. Step 1: Resizing image %s", p.PostID, p.ImageURL)
 	// Simulate a potentially failing operation
-	if rand.Intn(10) < 3 { // 30% chance of failure
+	if mrand.Intn(10) < 3 { // 30% chance of failure
 		log.Printf("Error resizing image for PostID: %s. Retrying...", p.PostID)
 		return fmt.Errorf("failed to connect to image processing service")
 	}
@@ -223,13 +276,849 @@ func HandleCleanupTask(ctx context.Context, t *asynq.Task) error {
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
-	log.Printf("Running periodic cleanup task for users created before %s", p.CutoffDate.Format(time.RFC3339))
-	// In a real app, you would query the DB and delete/deactivate users.
-	time.Sleep(500 * time.Millisecond)
-	log.Println("Periodic cleanup task finished.")
+	taskID, _ := asynq.GetTaskID(ctx)
+	run, ok := startScheduleRun(p.ScheduleID, taskID)
+	if !ok {
+		log.Printf("Skipping cleanup run %s: %s", taskID, run.Reason)
+		return nil
+	}
+	log.Printf("Running periodic cleanup: warning users inactive for %s, anonymizing after %s more", anonymizationCfg.InactiveAfter, anonymizationCfg.Grace)
+	warned, anonymized, err := runAnonymization(ctx, anonymizationCfg, time.Now())
+	finishScheduleRun(run.ID, err)
+	if err != nil {
+		return err
+	}
+	log.Printf("Periodic cleanup task finished: %d warned, %d anonymized.", warned, anonymized)
+	return nil
+}
+
+func HandleBulkUsersTask(ctx context.Context, t *asynq.Task) error {
+	var p BulkUsersPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	bulkMu.Lock()
+	job, ok := bulkJobs[p.JobID]
+	if !ok {
+		bulkMu.Unlock()
+		return fmt.Errorf("bulk job %s not found: %w", p.JobID, asynq.SkipRetry)
+	}
+	// The targets are fixed on the first attempt so a retry finishes the same set.
+	if job.targets == nil {
+		match, err := parseUserFilter(job.Filter)
+		if err != nil {
+			job.Status = BulkFailed
+			bulkMu.Unlock()
+			return fmt.Errorf("bulk job %s: %v: %w", job.ID, err, asynq.SkipRetry)
+		}
+		job.targets = matchingUserIDs(match)
+		job.Total = len(job.targets)
+	}
+	job.Status = BulkRunning
+	bulkMu.Unlock()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bulkMu.Lock()
+		start := job.Processed
+		end := start + bulkChunkSize
+		if end > len(job.targets) {
+			end = len(job.targets)
+		}
+		chunk := job.targets[start:end]
+		bulkMu.Unlock()
+		if len(chunk) == 0 {
+			break
+		}
+
+		results := make([]BulkResult, 0, len(chunk))
+		var rows [][]string
+		mu.Lock()
+		for _, id := range chunk {
+			user, err := applyBulkOperation(job.Operation, job.Role, id)
+			res := BulkResult{UserID: id, Email: user.Email, OK: err == nil}
+			if err != nil {
+				res.Error = err.Error()
+			} else if job.Operation == BulkExport {
+				rows = append(rows, []string{user.ID.String(), user.Email, string(user.Role), fmt.Sprint(user.IsActive), user.CreatedAt.Format(time.RFC3339)})
+			}
+			results = append(results, res)
+		}
+		mu.Unlock()
+
+		bulkMu.Lock()
+		for _, r := range results {
+			if r.OK {
+				job.Succeeded++
+			} else {
+				job.Failed++
+			}
+		}
+		job.Results = append(job.Results, results...)
+		job.exportRows = append(job.exportRows, rows...)
+		job.Processed = end
+		bulkMu.Unlock()
+	}
+
+	bulkMu.Lock()
+	job.Status = BulkCompleted
+	now := time.Now()
+	job.FinishedAt = &now
+	log.Printf("Bulk %s job %s finished: %d succeeded, %d failed", job.Operation, job.ID, job.Succeeded, job.Failed)
+	bulkMu.Unlock()
 	return nil
 }
 
+// --- Task Lineage (tasks/lineage.go) ---
+// Each task the dispatcher enqueues gets a lineage node keyed by task ID,
+// linked to the task that continues into it. Nodes are written at enqueue
+// time and timed by lineageMiddleware; the queue state itself is looked up
+// from asynq when a chain is requested.
+
+const lineageRetention = 24 * time.Hour
+
+type LineageNode struct {
+	TaskID     string     `json:"id"`
+	Type       string     `json:"type"`
+	Queue      string     `json:"queue"`
+	ParentID   string     `json:"parent_id,omitempty"`
+	Children   []string   `json:"children,omitempty"`
+	EnqueuedAt time.Time  `json:"enqueued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Attempts   int        `json:"attempts"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+var (
+	lineage   = make(map[string]*LineageNode)
+	lineageMu sync.Mutex
+)
+
+// recordLineage adds a node under parentID ("" for a root) and forgets nodes
+// enqueued more than lineageRetention ago.
+func recordLineage(taskID, taskType, queue, parentID string) {
+	now := time.Now()
+	lineageMu.Lock()
+	defer lineageMu.Unlock()
+	for id, n := range lineage {
+		if now.Sub(n.EnqueuedAt) > lineageRetention {
+			delete(lineage, id)
+		}
+	}
+	lineage[taskID] = &LineageNode{TaskID: taskID, Type: taskType, Queue: queue, ParentID: parentID, EnqueuedAt: now}
+	if parent, ok := lineage[parentID]; ok {
+		parent.Children = append(parent.Children, taskID)
+	}
+}
+
+// lineageMiddleware records when each attempt of a tracked task starts and
+// finishes. Untracked tasks, such as scheduled cleanups, pass straight through.
+func lineageMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		taskID, _ := asynq.GetTaskID(ctx)
+		lineageMu.Lock()
+		if n, ok := lineage[taskID]; ok {
+			now := time.Now()
+			if n.StartedAt == nil {
+				n.StartedAt = &now
+			}
+			n.FinishedAt = nil
+			n.Attempts++
+		}
+		lineageMu.Unlock()
+
+		err := next.ProcessTask(ctx, t)
+
+		lineageMu.Lock()
+		if n, ok := lineage[taskID]; ok {
+			now := time.Now()
+			n.FinishedAt, n.LastError = &now, ""
+			if err != nil {
+				n.LastError = err.Error()
+			}
+		}
+		lineageMu.Unlock()
+		return err
+	})
+}
+
+// ChainNode is a lineage node with its current state for GET /jobs/:id/chain.
+type ChainNode struct {
+	LineageNode
+	State      string `json:"state"`
+	DurationMs *int64 `json:"duration_ms,omitempty"`
+}
+
+type ChainEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// chainOf copies the ancestors of taskID (root first), the task itself and
+// all of its descendants (breadth first), so parents always precede children.
+func chainOf(taskID string) ([]LineageNode, bool) {
+	lineageMu.Lock()
+	defer lineageMu.Unlock()
+	start, ok := lineage[taskID]
+	if !ok {
+		return nil, false
+	}
+	var ancestors []LineageNode
+	for id := start.ParentID; id != ""; {
+		n, ok := lineage[id]
+		if !ok {
+			break
+		}
+		ancestors = append([]LineageNode{*n}, ancestors...)
+		id = n.ParentID
+	}
+	nodes := ancestors
+	for queue := []string{taskID}; len(queue) > 0; queue = queue[1:] {
+		n, ok := lineage[queue[0]]
+		if !ok {
+			continue
+		}
+		nodes = append(nodes, *n)
+		queue = append(queue, n.Children...)
+	}
+	return nodes, true
+}
+
+// chainNodeState prefers asynq's view of the task. Without one, the task has
+// either been cleaned up after running, or is a continuation whose parent has
+// not completed yet and so has not been enqueued.
+func chainNodeState(info *asynq.TaskInfo, n LineageNode, parentState string) string {
+	switch {
+	case info != nil:
+		return info.State.String()
+	case n.FinishedAt != nil && n.LastError == "":
+		return "completed"
+	case n.FinishedAt != nil:
+		return "failed"
+	case n.StartedAt != nil:
+		return "active"
+	case n.ParentID != "" && parentState != "completed":
+		return "awaiting_parent"
+	default:
+		return "unknown"
+	}
+}
+
+// --- Schedule Runs (tasks/schedule_runs.go) ---
+// Periodic tasks must not overlap. The scheduler enqueues cleanups with a
+// uniqueness TTL of one period, and because asynq drops that lock once a run
+// finishes or the TTL passes, handlers also refuse to start while an earlier
+// run of the same schedule is still going. Every run, including skipped
+// ones, is kept in scheduleRuns.
+
+const (
+	CleanupScheduleID  = "cleanup-inactive-users"
+	scheduleRunHistory = 200
+)
+
+type ScheduleRunStatus string
+
+const (
+	RunRunning   ScheduleRunStatus = "running"
+	RunSucceeded ScheduleRunStatus = "succeeded"
+	RunFailed    ScheduleRunStatus = "failed"
+	RunSkipped   ScheduleRunStatus = "skipped"
+)
+
+type ScheduleRun struct {
+	ID         uuid.UUID         `json:"id"`
+	ScheduleID string            `json:"schedule_id"`
+	TaskID     string            `json:"task_id,omitempty"`
+	Status     ScheduleRunStatus `json:"status"`
+	Reason     string            `json:"reason,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+var (
+	scheduleRuns = make(map[string][]*ScheduleRun)
+	runsMu       sync.Mutex
+)
+
+// recordScheduleRun appends a run, dropping the oldest beyond the history
+// limit. The caller holds runsMu.
+func recordScheduleRun(run *ScheduleRun) {
+	runs := append(scheduleRuns[run.ScheduleID], run)
+	if len(runs) > scheduleRunHistory {
+		runs = runs[len(runs)-scheduleRunHistory:]
+	}
+	scheduleRuns[run.ScheduleID] = runs
+}
+
+// startScheduleRun records a run as started, or as skipped when another run
+// of the schedule has not finished; ok reports which.
+func startScheduleRun(scheduleID, taskID string) (run *ScheduleRun, ok bool) {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+	run = &ScheduleRun{ID: uuid.New(), ScheduleID: scheduleID, TaskID: taskID, Status: RunRunning, StartedAt: time.Now()}
+	for _, prev := range scheduleRuns[scheduleID] {
+		if prev.Status == RunRunning {
+			run.Status = RunSkipped
+			run.Reason = fmt.Sprintf("run %s started at %s is still in progress", prev.ID, prev.StartedAt.Format(time.RFC3339))
+			run.FinishedAt = &run.StartedAt
+			break
+		}
+	}
+	recordScheduleRun(run)
+	return run, run.Status == RunRunning
+}
+
+func finishScheduleRun(runID uuid.UUID, err error) {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+	now := time.Now()
+	for _, runs := range scheduleRuns {
+		for _, run := range runs {
+			if run.ID != runID {
+				continue
+			}
+			run.FinishedAt = &now
+			run.Status = RunSucceeded
+			if err != nil {
+				run.Status, run.Reason = RunFailed, err.Error()
+			}
+			return
+		}
+	}
+}
+
+// recordSkippedEnqueue is the scheduler's PostEnqueueFunc. Only the cleanup
+// schedule is enqueued as unique, so a duplicate is always one of its runs.
+func recordSkippedEnqueue(info *asynq.TaskInfo, err error) {
+	if !errors.Is(err, asynq.ErrDuplicateTask) {
+		if err != nil {
+			log.Printf("scheduler could not enqueue task: %v", err)
+		}
+		return
+	}
+	now := time.Now()
+	run := &ScheduleRun{
+		ID:         uuid.New(),
+		ScheduleID: CleanupScheduleID,
+		Status:     RunSkipped,
+		Reason:     "previous run still holds the uniqueness lock",
+		StartedAt:  now,
+		FinishedAt: &now,
+	}
+	runsMu.Lock()
+	recordScheduleRun(run)
+	runsMu.Unlock()
+	log.Printf("Skipped enqueueing %s: %s", CleanupScheduleID, run.Reason)
+}
+
+// GetScheduleRuns lists a schedule's runs, newest first (?limit, default 50).
+func GetScheduleRuns(c *fiber.Ctx) error {
+	scheduleID := c.Params("id")
+	schedulesMu.Lock()
+	entry, ok := schedules[scheduleID]
+	schedulesMu.Unlock()
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "schedule not found"})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 || limit > scheduleRunHistory {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", scheduleRunHistory)})
+	}
+
+	runsMu.Lock()
+	runs := scheduleRuns[scheduleID]
+	out := make([]ScheduleRun, 0, limit)
+	for i := len(runs) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, *runs[i])
+	}
+	runsMu.Unlock()
+
+	return c.JSON(fiber.Map{"schedule_id": scheduleID, "spec": entry.Spec, "runs": out})
+}
+
+// --- Schedule Config (tasks/schedule_config.go) ---
+// Periodic jobs are configuration, not code. The full set of schedule
+// entries exports as a versioned JSON document, and importing one brings the
+// scheduler in line with it: entries that already match are left alone, so
+// the same file can be applied on every boot (SCHEDULES_FILE) and promoted
+// unchanged between environments. The document is the whole configuration;
+// an entry missing from it is removed.
+
+const scheduleDocumentVersion = 1
+
+// scheduleIDPlaceholder in a payload template is replaced with the entry's
+// ID when the task is built, so a copied entry reports runs under its own ID.
+const scheduleIDPlaceholder = "{{schedule_id}}"
+
+type ScheduleEntry struct {
+	ID       string          `json:"id"`
+	Spec     string          `json:"spec"`
+	TaskType string          `json:"task_type"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Queue    string          `json:"queue"`
+	Enabled  bool            `json:"enabled"`
+}
+
+type ScheduleDocument struct {
+	Version   int             `json:"version"`
+	Schedules []ScheduleEntry `json:"schedules"`
+}
+
+type ScheduleChangeAction string
+
+const (
+	ScheduleAdd    ScheduleChangeAction = "add"
+	ScheduleUpdate ScheduleChangeAction = "update"
+	ScheduleRemove ScheduleChangeAction = "remove"
+)
+
+type ScheduleChange struct {
+	ID     string               `json:"id"`
+	Action ScheduleChangeAction `json:"action"`
+	Before *ScheduleEntry       `json:"before,omitempty"`
+	After  *ScheduleEntry       `json:"after,omitempty"`
+}
+
+var (
+	schedules        = make(map[string]ScheduleEntry)
+	scheduleEntryIDs = make(map[string]string) // schedule ID -> asynq entry ID, enabled entries only
+	schedulesMu      sync.Mutex
+)
+
+// schedulableTypes are the task types the task processor has handlers for.
+var schedulableTypes = map[string]bool{
+	TypeEmailWelcome:    true,
+	TypeImageResize:     true,
+	TypeImageWatermark:  true,
+	TypePeriodicCleanup: true,
+	TypeAdminBulkUsers:  true,
+}
+
+func defaultScheduleDocument() ScheduleDocument {
+	return ScheduleDocument{Version: scheduleDocumentVersion, Schedules: []ScheduleEntry{{
+		ID:       CleanupScheduleID,
+		Spec:     "@every 5m",
+		TaskType: TypePeriodicCleanup,
+		Payload:  json.RawMessage(`{"schedule_id":"` + scheduleIDPlaceholder + `"}`),
+		Queue:    "default",
+		Enabled:  true,
+	}}}
+}
+
+// validScheduleID keeps IDs safe to splice into a JSON string and a URL path.
+func validScheduleID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeScheduleDocument validates every entry and returns them in a
+// canonical form (compact payload, explicit queue) sorted by ID, so two
+// documents that mean the same thing compare equal.
+func normalizeScheduleDocument(doc ScheduleDocument) ([]ScheduleEntry, error) {
+	if doc.Version != scheduleDocumentVersion {
+		return nil, fmt.Errorf("unsupported schedule document version %d, want %d", doc.Version, scheduleDocumentVersion)
+	}
+	seen := make(map[string]bool, len(doc.Schedules))
+	out := make([]ScheduleEntry, 0, len(doc.Schedules))
+	for i, e := range doc.Schedules {
+		switch {
+		case !validScheduleID(e.ID):
+			return nil, fmt.Errorf("schedules[%d]: id must be 1-64 letters, digits, '-', '_' or '.'", i)
+		case seen[e.ID]:
+			return nil, fmt.Errorf("schedules[%d]: duplicate id %q", i, e.ID)
+		case !schedulableTypes[e.TaskType]:
+			return nil, fmt.Errorf("schedule %s: unknown task type %q", e.ID, e.TaskType)
+		}
+		seen[e.ID] = true
+		if _, err := cron.ParseStandard(e.Spec); err != nil {
+			return nil, fmt.Errorf("schedule %s: invalid spec %q: %v", e.ID, e.Spec, err)
+		}
+		if len(e.Payload) > 0 {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, e.Payload); err != nil {
+				return nil, fmt.Errorf("schedule %s: payload is not valid JSON: %v", e.ID, err)
+			}
+			e.Payload = buf.Bytes()
+		}
+		if e.Queue == "" {
+			e.Queue = "default"
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func sameScheduleEntry(a, b ScheduleEntry) bool {
+	return a.Spec == b.Spec && a.TaskType == b.TaskType && bytes.Equal(a.Payload, b.Payload) && a.Queue == b.Queue && a.Enabled == b.Enabled
+}
+
+// diffSchedules lists what applying desired to current would change, by ID.
+func diffSchedules(current map[string]ScheduleEntry, desired []ScheduleEntry) []ScheduleChange {
+	changes := []ScheduleChange{}
+	wanted := make(map[string]bool, len(desired))
+	for i := range desired {
+		after := &desired[i]
+		wanted[after.ID] = true
+		before, ok := current[after.ID]
+		switch {
+		case !ok:
+			changes = append(changes, ScheduleChange{ID: after.ID, Action: ScheduleAdd, After: after})
+		case !sameScheduleEntry(before, *after):
+			changes = append(changes, ScheduleChange{ID: after.ID, Action: ScheduleUpdate, Before: &before, After: after})
+		}
+	}
+	for id, before := range current {
+		if !wanted[id] {
+			before := before
+			changes = append(changes, ScheduleChange{ID: id, Action: ScheduleRemove, Before: &before})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes
+}
+
+func registerSchedule(scheduler *asynq.Scheduler, e ScheduleEntry) (string, error) {
+	payload := bytes.ReplaceAll(e.Payload, []byte(scheduleIDPlaceholder), []byte(e.ID))
+	opts := []asynq.Option{asynq.Queue(e.Queue)}
+	if e.TaskType == TypePeriodicCleanup {
+		// Hold the uniqueness lock for one period so a cleanup is not
+		// enqueued while the last one is still queued or running.
+		sched, err := cron.ParseStandard(e.Spec)
+		if err != nil {
+			return "", err
+		}
+		next := sched.Next(time.Now())
+		opts = append(opts, asynq.Unique(sched.Next(next).Sub(next)))
+	}
+	return scheduler.Register(e.Spec, asynq.NewTask(e.TaskType, payload), opts...)
+}
+
+// applyScheduleDocument brings the scheduler in line with doc and returns
+// the changes. With dryRun set it only computes them. Entries are validated
+// up front, so a failure part way through can only come from the scheduler
+// itself; changes applied before it stay in place.
+func applyScheduleDocument(scheduler *asynq.Scheduler, doc ScheduleDocument, dryRun bool) ([]ScheduleChange, error) {
+	desired, err := normalizeScheduleDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	changes := diffSchedules(schedules, desired)
+	if dryRun {
+		return changes, nil
+	}
+	for _, ch := range changes {
+		if entryID, ok := scheduleEntryIDs[ch.ID]; ok {
+			if err := scheduler.Unregister(entryID); err != nil {
+				return nil, fmt.Errorf("unregister schedule %s: %w", ch.ID, err)
+			}
+			delete(scheduleEntryIDs, ch.ID)
+		}
+		if ch.After == nil {
+			delete(schedules, ch.ID)
+			continue
+		}
+		if ch.After.Enabled {
+			entryID, err := registerSchedule(scheduler, *ch.After)
+			if err != nil {
+				delete(schedules, ch.ID)
+				return nil, fmt.Errorf("register schedule %s: %w", ch.ID, err)
+			}
+			scheduleEntryIDs[ch.ID] = entryID
+		}
+		schedules[ch.ID] = *ch.After
+	}
+	return changes, nil
+}
+
+// loadScheduleDocument reads SCHEDULES_FILE, falling back to the built-in
+// defaults when it is unset.
+func loadScheduleDocument() (ScheduleDocument, error) {
+	path := os.Getenv("SCHEDULES_FILE")
+	if path == "" {
+		return defaultScheduleDocument(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ScheduleDocument{}, err
+	}
+	var doc ScheduleDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ScheduleDocument{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// ExportSchedules returns every schedule entry as an importable document.
+func ExportSchedules(c *fiber.Ctx) error {
+	schedulesMu.Lock()
+	doc := ScheduleDocument{Version: scheduleDocumentVersion, Schedules: make([]ScheduleEntry, 0, len(schedules))}
+	for _, e := range schedules {
+		doc.Schedules = append(doc.Schedules, e)
+	}
+	schedulesMu.Unlock()
+	sort.Slice(doc.Schedules, func(i, j int) bool { return doc.Schedules[i].ID < doc.Schedules[j].ID })
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="schedules.json"`)
+	return c.Send(append(data, '\n'))
+}
+
+// ImportSchedules previews (the default) or, with ?dry_run=false, applies a
+// schedule document posted as the request body.
+func ImportSchedules(scheduler *asynq.Scheduler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		dryRun, err := strconv.ParseBool(c.Query("dry_run", "true"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "dry_run must be true or false"})
+		}
+		var doc ScheduleDocument
+		if err := json.Unmarshal(c.Body(), &doc); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid schedule document: " + err.Error()})
+		}
+		changes, err := applyScheduleDocument(scheduler, doc, dryRun)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !dryRun && len(changes) > 0 {
+			log.Printf("Schedule import applied %d change(s)", len(changes))
+		}
+		return c.JSON(fiber.Map{"dry_run": dryRun, "changes": changes})
+	}
+}
+
+// --- Inactive Account Anonymization (tasks/anonymization.go) ---
+// Each cleanup run moves inactive users through two steps: users inactive for
+// InactiveAfter are warned, and users still inactive Grace after the warning
+// are anonymized. Progress is kept per user in anonymizations, so a run that
+// dies part way is simply continued by the next one. Anonymized users keep
+// their ID, so their posts stay attached.
+
+type AnonymizationConfig struct {
+	InactiveAfter time.Duration
+	Grace         time.Duration
+	// Key makes email hashes unguessable; without ANONYMIZATION_KEY a random
+	// key is used and hashes cannot be linked across restarts.
+	Key []byte
+}
+
+func LoadAnonymizationConfig() AnonymizationConfig {
+	cfg := AnonymizationConfig{InactiveAfter: 365 * 24 * time.Hour, Grace: 30 * 24 * time.Hour}
+	if d, err := time.ParseDuration(os.Getenv("ANONYMIZE_INACTIVE_AFTER")); err == nil && d > 0 {
+		cfg.InactiveAfter = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ANONYMIZE_GRACE")); err == nil && d > 0 {
+		cfg.Grace = d
+	}
+	cfg.Key = []byte(os.Getenv("ANONYMIZATION_KEY"))
+	if len(cfg.Key) == 0 {
+		cfg.Key = make([]byte, 32)
+		rand.Read(cfg.Key)
+	}
+	return cfg
+}
+
+var anonymizationCfg = LoadAnonymizationConfig()
+
+type AnonymizationStatus string
+
+const (
+	AnonymizationWarned    AnonymizationStatus = "warned"
+	AnonymizationCancelled AnonymizationStatus = "cancelled"
+	AnonymizationDone      AnonymizationStatus = "anonymized"
+)
+
+type AnonymizationState struct {
+	UserID         uuid.UUID           `json:"user_id"`
+	Status         AnonymizationStatus `json:"status"`
+	WarnedAt       time.Time           `json:"warned_at"`
+	AnonymizeAfter time.Time           `json:"anonymize_after"`
+	CompletedAt    *time.Time          `json:"completed_at,omitempty"`
+}
+
+var (
+	anonymizations = make(map[uuid.UUID]*AnonymizationState)
+	anonMu         sync.Mutex
+)
+
+// notifyInactiveUser stands in for the mailer.
+func notifyInactiveUser(user User, deadline time.Time) {
+	log.Printf("Notify %s: account inactive, personal data will be anonymized on %s unless you sign in", user.Email, deadline.Format("2006-01-02"))
+}
+
+func anonymizedEmail(key []byte, email string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(email)))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil)[:12]) + "@anonymized.invalid"
+}
+
+// anonymizeUser scrubs the user's PII. The caller holds mu.
+func anonymizeUser(cfg AnonymizationConfig, id uuid.UUID, now time.Time) {
+	user := users[id]
+	user.Email = anonymizedEmail(cfg.Key, user.Email)
+	user.Name = ""
+	user.PasswordHash = ""
+	user.IsActive = false
+	user.AnonymizedAt = &now
+	users[id] = user
+}
+
+func runAnonymization(ctx context.Context, cfg AnonymizationConfig, now time.Time) (warned, anonymized int, err error) {
+	mu.RLock()
+	candidates := make([]User, 0)
+	for _, u := range users {
+		if u.AnonymizedAt == nil && u.Role != AdminRole {
+			candidates = append(candidates, u)
+		}
+	}
+	mu.RUnlock()
+
+	for _, u := range candidates {
+		if err := ctx.Err(); err != nil {
+			return warned, anonymized, err
+		}
+		anonMu.Lock()
+		state := anonymizations[u.ID]
+		switch {
+		case state == nil || state.Status == AnonymizationCancelled:
+			if now.Sub(u.LastActiveAt) < cfg.InactiveAfter {
+				break
+			}
+			state = &AnonymizationState{UserID: u.ID, Status: AnonymizationWarned, WarnedAt: now, AnonymizeAfter: now.Add(cfg.Grace)}
+			anonymizations[u.ID] = state
+			notifyInactiveUser(u, state.AnonymizeAfter)
+			warned++
+		case state.Status == AnonymizationWarned && now.After(state.AnonymizeAfter):
+			mu.Lock()
+			current, ok := users[u.ID]
+			// Signing in after the warning calls the anonymization off.
+			if ok && current.LastActiveAt.After(state.WarnedAt) {
+				state.Status = AnonymizationCancelled
+			} else if ok {
+				anonymizeUser(cfg, u.ID, now)
+				state.Status = AnonymizationDone
+				state.CompletedAt = &now
+				anonymized++
+			}
+			mu.Unlock()
+		}
+		anonMu.Unlock()
+	}
+	return warned, anonymized, nil
+}
+
+// GetUserAnonymization shows where a user stands in the anonymization flow.
+func GetUserAnonymization(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user ID"})
+	}
+	anonMu.Lock()
+	defer anonMu.Unlock()
+	state, ok := anonymizations[id]
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "user has no anonymization state"})
+	}
+	return c.JSON(state)
+}
+
+const activityResolution = time.Minute
+
+// authenticate returns the active user with this email and password.
+func authenticate(email, password string) (User, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, u := range users {
+		if u.IsActive && strings.EqualFold(u.Email, email) &&
+			subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte("hashed_"+password)) == 1 {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// optionalUserAuth checks HTTP Basic credentials when a request sends them.
+// Requests without them pass through as anonymous.
+func optionalUserAuth() fiber.Handler {
+	return basicauth.New(basicauth.Config{
+		Next:  func(c *fiber.Ctx) bool { return c.Get(fiber.HeaderAuthorization) == "" },
+		Realm: "api",
+		Authorizer: func(email, password string) bool {
+			_, ok := authenticate(email, password)
+			return ok
+		},
+	})
+}
+
+// adminAuth admits HTTP Basic credentials of an active ADMIN user.
+func adminAuth() fiber.Handler {
+	return basicauth.New(basicauth.Config{
+		Realm: "admin",
+		Authorizer: func(email, password string) bool {
+			u, ok := authenticate(email, password)
+			return ok && u.Role == AdminRole
+		},
+	})
+}
+
+// currentUser is the user whose credentials basicauth accepted; ok is false
+// for anonymous requests.
+func currentUser(c *fiber.Ctx) (User, bool) {
+	email, _ := c.Locals("username").(string)
+	password, _ := c.Locals("password").(string)
+	if email == "" {
+		return User{}, false
+	}
+	return authenticate(email, password)
+}
+
+// activityMiddleware records that the authenticated caller was active, which
+// resets the inactivity clock. It must run after optionalUserAuth.
+func activityMiddleware(c *fiber.Ctx) error {
+	if user, ok := currentUser(c); ok {
+		now := time.Now()
+		mu.Lock()
+		if u, ok := users[user.ID]; ok && u.AnonymizedAt == nil && now.Sub(u.LastActiveAt) > activityResolution {
+			u.LastActiveAt = now
+			users[user.ID] = u
+		}
+		mu.Unlock()
+	}
+	return c.Next()
+}
+
+// seedAdminUser creates the ADMIN user named by ADMIN_EMAIL and
+// ADMIN_PASSWORD, if both are set.
+func seedAdminUser() {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; admin routes disabled")
+		return
+	}
+	now := time.Now()
+	mu.Lock()
+	defer mu.Unlock()
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: "hashed_" + password, Role: AdminRole, IsActive: true, CreatedAt: now, LastActiveAt: now}
+	users[admin.ID] = admin
+}
+
 // --- Services (services/user_service.go) ---
 
 type UserService struct {
@@ -240,17 +1129,20 @@ func NewUserService(td *TaskDispatcher) *UserService {
 	return &UserService{taskDispatcher: td}
 }
 
-func (s *UserService) RegisterUser(ctx context.Context, email, password string) (*User, error) {
+func (s *UserService) RegisterUser(ctx context.Context, email, name, password string) (*User, error) {
 	mu.Lock()
 	defer mu.Unlock()
 
+	now := time.Now()
 	newUser := User{
 		ID:           uuid.New(),
 		Email:        email,
+		Name:         name,
 		PasswordHash: "hashed_" + password, // In real app, use bcrypt
 		Role:         UserRoleDefault,
 		IsActive:     true,
-		CreatedAt:    time.Now(),
+		CreatedAt:    now,
+		LastActiveAt: now,
 	}
 	users[newUser.ID] = newUser
 
@@ -266,6 +1158,356 @@ func (s *UserService) RegisterUser(ctx context.Context, email, password string)
 	return &newUser, nil
 }
 
+// --- Admin Bulk Operations (services/bulk_service.go) ---
+// Bulk operations select users with a filter expression. Every operation
+// must be previewed first: a dry run returns the affected count, a sample
+// and a plan ID, and only that plan can be executed. Execution runs as a
+// background task in chunks and records a result per user.
+
+type BulkOperation string
+
+const (
+	BulkDeactivate BulkOperation = "deactivate"
+	BulkDelete     BulkOperation = "delete"
+	BulkAssignRole BulkOperation = "assign-role"
+	BulkExport     BulkOperation = "export"
+)
+
+type BulkStatus string
+
+const (
+	BulkQueued    BulkStatus = "queued"
+	BulkRunning   BulkStatus = "running"
+	BulkCompleted BulkStatus = "completed"
+	BulkFailed    BulkStatus = "failed"
+)
+
+const (
+	bulkChunkSize  = 100
+	bulkSampleSize = 10
+	bulkPlanTTL    = 15 * time.Minute
+)
+
+type BulkResult struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email,omitempty"`
+	OK     bool      `json:"ok"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type BulkJob struct {
+	ID         string        `json:"id"`
+	Operation  BulkOperation `json:"operation"`
+	Filter     string        `json:"filter"`
+	Role       UserRole      `json:"role,omitempty"`
+	Status     BulkStatus    `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Succeeded  int           `json:"succeeded"`
+	Failed     int           `json:"failed"`
+	Results    []BulkResult  `json:"results"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+
+	targets    []uuid.UUID
+	exportRows [][]string
+}
+
+// bulkPlan is what a dry run approved; executing it must repeat the request.
+type bulkPlan struct {
+	Operation BulkOperation
+	Filter    string
+	Role      UserRole
+	ExpiresAt time.Time
+}
+
+var (
+	bulkJobs  = make(map[string]*BulkJob)
+	bulkPlans = make(map[string]bulkPlan)
+	bulkMu    sync.Mutex
+)
+
+type userPredicate func(User) bool
+
+// parseUserFilter parses clauses joined by "and", e.g.
+// `role = USER and is_active = true and email ~ @example.com`.
+// Fields: role, email, is_active, created_at. Operators: = and != on all
+// fields, ~ (contains) on email, < and > on created_at (RFC 3339 or
+// YYYY-MM-DD). Values cannot contain spaces.
+func parseUserFilter(expr string) (userPredicate, error) {
+	tokens := strings.Fields(expr)
+	if len(tokens) == 0 {
+		return nil, errors.New("filter is required")
+	}
+	var clauses []userPredicate
+	for i := 0; i < len(tokens); i += 4 {
+		if i+3 > len(tokens) || (i+3 < len(tokens) && !strings.EqualFold(tokens[i+3], "and")) {
+			return nil, fmt.Errorf("expected `field op value [and ...]` near %q", strings.Join(tokens[i:], " "))
+		}
+		if i+3 == len(tokens)-1 {
+			return nil, errors.New("filter ends with a dangling 'and'")
+		}
+		clause, err := parseUserClause(tokens[i], tokens[i+1], tokens[i+2])
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return func(u User) bool {
+		for _, c := range clauses {
+			if !c(u) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func parseUserClause(field, op, value string) (userPredicate, error) {
+	negate := func(p userPredicate) userPredicate { return func(u User) bool { return !p(u) } }
+	switch field {
+	case "role":
+		p := func(u User) bool { return strings.EqualFold(string(u.Role), value) }
+		switch op {
+		case "=":
+			return p, nil
+		case "!=":
+			return negate(p), nil
+		}
+	case "email":
+		value = strings.ToLower(value)
+		switch op {
+		case "=":
+			return func(u User) bool { return strings.ToLower(u.Email) == value }, nil
+		case "!=":
+			return func(u User) bool { return strings.ToLower(u.Email) != value }, nil
+		case "~":
+			return func(u User) bool { return strings.Contains(strings.ToLower(u.Email), value) }, nil
+		}
+	case "is_active":
+		var want bool
+		switch value {
+		case "true":
+			want = true
+		case "false":
+		default:
+			return nil, fmt.Errorf("is_active must be true or false, got %q", value)
+		}
+		p := func(u User) bool { return u.IsActive == want }
+		switch op {
+		case "=":
+			return p, nil
+		case "!=":
+			return negate(p), nil
+		}
+	case "created_at":
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if at, err = time.Parse("2006-01-02", value); err != nil {
+				return nil, fmt.Errorf("created_at must be RFC 3339 or YYYY-MM-DD, got %q", value)
+			}
+		}
+		switch op {
+		case "<":
+			return func(u User) bool { return u.CreatedAt.Before(at) }, nil
+		case ">":
+			return func(u User) bool { return u.CreatedAt.After(at) }, nil
+		case "=":
+			return func(u User) bool { return u.CreatedAt.Equal(at) }, nil
+		case "!=":
+			return func(u User) bool { return !u.CreatedAt.Equal(at) }, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown filter field %q", field)
+	}
+	return nil, fmt.Errorf("operator %q is not supported for %s", op, field)
+}
+
+// matchingUserIDs returns the matching users, oldest first.
+func matchingUserIDs(match userPredicate) []uuid.UUID {
+	mu.RLock()
+	matched := make([]User, 0)
+	for _, u := range users {
+		if match(u) {
+			matched = append(matched, u)
+		}
+	}
+	mu.RUnlock()
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+		}
+		return matched[i].ID.String() < matched[j].ID.String()
+	})
+	ids := make([]uuid.UUID, len(matched))
+	for i, u := range matched {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+// applyBulkOperation changes one user. The caller holds mu. Admin accounts
+// are only ever exported, so a bad filter cannot lock every admin out.
+func applyBulkOperation(op BulkOperation, role UserRole, id uuid.UUID) (User, error) {
+	user, ok := users[id]
+	if !ok {
+		return User{}, errors.New("user no longer exists")
+	}
+	if op != BulkExport && user.Role == AdminRole {
+		return user, errors.New("admin accounts cannot be changed in bulk")
+	}
+	switch op {
+	case BulkDeactivate:
+		user.IsActive = false
+		users[id] = user
+	case BulkDelete:
+		delete(users, id)
+		for postID, post := range posts {
+			if post.UserID == id {
+				delete(posts, postID)
+			}
+		}
+	case BulkAssignRole:
+		user.Role = role
+		users[id] = user
+	}
+	return user, nil
+}
+
+type BulkHandler struct {
+	taskDispatcher *TaskDispatcher
+}
+
+func NewBulkHandler(td *TaskDispatcher) *BulkHandler {
+	return &BulkHandler{taskDispatcher: td}
+}
+
+// Submit previews a bulk operation (the default) or, with dry_run false and
+// the plan_id of a matching preview, queues it.
+func (h *BulkHandler) Submit(c *fiber.Ctx) error {
+	var req struct {
+		Operation BulkOperation `json:"operation"`
+		Filter    string        `json:"filter"`
+		Role      UserRole      `json:"role"`
+		DryRun    *bool         `json:"dry_run"`
+		PlanID    string        `json:"plan_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
+	}
+	switch req.Operation {
+	case BulkDeactivate, BulkDelete, BulkExport:
+		req.Role = ""
+	case BulkAssignRole:
+		if req.Role != AdminRole && req.Role != UserRoleDefault {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "assign-role needs role ADMIN or USER"})
+		}
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "operation must be deactivate, delete, assign-role or export"})
+	}
+	match, err := parseUserFilter(req.Filter)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if req.DryRun == nil || *req.DryRun {
+		ids := matchingUserIDs(match)
+		sample := make([]User, 0, bulkSampleSize)
+		mu.RLock()
+		for _, id := range ids {
+			if len(sample) == bulkSampleSize {
+				break
+			}
+			sample = append(sample, users[id])
+		}
+		mu.RUnlock()
+
+		planID := uuid.NewString()
+		bulkMu.Lock()
+		for id, plan := range bulkPlans {
+			if time.Now().After(plan.ExpiresAt) {
+				delete(bulkPlans, id)
+			}
+		}
+		bulkPlans[planID] = bulkPlan{Operation: req.Operation, Filter: req.Filter, Role: req.Role, ExpiresAt: time.Now().Add(bulkPlanTTL)}
+		bulkMu.Unlock()
+
+		return c.JSON(fiber.Map{
+			"dry_run":         true,
+			"plan_id":         planID,
+			"plan_expires_in": bulkPlanTTL.String(),
+			"affected":        len(ids),
+			"sample":          sample,
+		})
+	}
+
+	bulkMu.Lock()
+	plan, ok := bulkPlans[req.PlanID]
+	if !ok || time.Now().After(plan.ExpiresAt) || plan.Operation != req.Operation || plan.Filter != req.Filter || plan.Role != req.Role {
+		bulkMu.Unlock()
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "run a dry run of this exact operation first and pass its plan_id"})
+	}
+	delete(bulkPlans, req.PlanID)
+	job := &BulkJob{
+		ID:        uuid.NewString(),
+		Operation: req.Operation,
+		Filter:    req.Filter,
+		Role:      req.Role,
+		Status:    BulkQueued,
+		Results:   []BulkResult{},
+		CreatedAt: time.Now(),
+	}
+	bulkJobs[job.ID] = job
+	bulkMu.Unlock()
+
+	if _, err := h.taskDispatcher.DispatchBulkUsers(c.Context(), job.ID); err != nil {
+		bulkMu.Lock()
+		delete(bulkJobs, job.ID)
+		bulkMu.Unlock()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "could not enqueue bulk operation"})
+	}
+	log.Printf("Queued bulk %s job %s for filter %q", job.Operation, job.ID, job.Filter)
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"report_url": "/admin/users/bulk/" + job.ID,
+	})
+}
+
+// Report returns the job's progress and, once done, its per-user results.
+func (h *BulkHandler) Report(c *fiber.Ctx) error {
+	bulkMu.Lock()
+	defer bulkMu.Unlock()
+	job, ok := bulkJobs[c.Params("id")]
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "bulk job not found"})
+	}
+	return c.JSON(job)
+}
+
+// Export serves the CSV produced by a finished export job.
+func (h *BulkHandler) Export(c *fiber.Ctx) error {
+	bulkMu.Lock()
+	job, ok := bulkJobs[c.Params("id")]
+	if !ok || job.Operation != BulkExport {
+		bulkMu.Unlock()
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "export not found"})
+	}
+	if job.Status != BulkCompleted {
+		bulkMu.Unlock()
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "export is not finished yet"})
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "email", "role", "is_active", "created_at"})
+	w.WriteAll(job.exportRows)
+	bulkMu.Unlock()
+
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users-%s.csv"`, job.ID))
+	return c.Send(buf.Bytes())
+}
+
 // --- API Handlers (handlers/user_handler.go, handlers/job_handler.go) ---
 
 type UserHandler struct {
@@ -279,13 +1521,14 @@ func NewUserHandler(us *UserService) *UserHandler {
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	var req struct {
 		Email    string `json:"email"`
+		Name     string `json:"name"`
 		Password string `json:"password"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request"})
 	}
 
-	user, err := h.userService.RegisterUser(c.Context(), req.Email, req.Password)
+	user, err := h.userService.RegisterUser(c.Context(), req.Email, req.Name, req.Password)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "could not create user"})
 	}
@@ -354,11 +1597,50 @@ func (h *JobHandler) GetJobStatus(c *fiber.Ctx) error {
 	})
 }
 
+// GetJobChain returns the pipeline around a job as a graph: its ancestors,
+// the job and its descendants, each with state and timings, plus the
+// parent-to-child edges between them.
+func (h *JobHandler) GetJobChain(c *fiber.Ctx) error {
+	jobID := c.Params("id")
+	nodes, ok := chainOf(jobID)
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no lineage recorded for job"})
+	}
+
+	states := make(map[string]string, len(nodes))
+	out := make([]ChainNode, 0, len(nodes))
+	edges := make([]ChainEdge, 0, len(nodes))
+	for _, n := range nodes {
+		var info *asynq.TaskInfo
+		if ti, err := h.inspector.GetTaskInfo(n.Queue, n.TaskID); err == nil {
+			info = ti
+		}
+		node := ChainNode{LineageNode: n, State: chainNodeState(info, n, states[n.ParentID])}
+		if n.StartedAt != nil && n.FinishedAt != nil {
+			ms := n.FinishedAt.Sub(*n.StartedAt).Milliseconds()
+			node.DurationMs = &ms
+		}
+		if _, ok := states[n.ParentID]; ok {
+			edges = append(edges, ChainEdge{From: n.ParentID, To: n.TaskID})
+		}
+		states[n.TaskID] = node.State
+		out = append(out, node)
+	}
+
+	return c.JSON(fiber.Map{
+		"job_id": jobID,
+		"root":   nodes[0].TaskID,
+		"nodes":  out,
+		"edges":  edges,
+	})
+}
+
 // --- Main Application (main.go) ---
 
 func main() {
 	// Assumes Redis is running on localhost:6379
 	redisConnection := asynq.RedisClientOpt{Addr: "localhost:6379"}
+	seedAdminUser()
 
 	// Setup Task Processor (Worker)
 	processor := NewTaskProcessor(redisConnection)
@@ -371,14 +1653,16 @@ func main() {
 	defer processor.Stop()
 
 	// Setup Periodic Task Scheduler
-	scheduler := asynq.NewScheduler(redisConnection, &asynq.SchedulerOpts{})
-	payload, _ := json.Marshal(CleanupPayload{CutoffDate: time.Now().Add(-30 * 24 * time.Hour)})
-	// Every 5 minutes, enqueue a cleanup task.
-	entryID, err := scheduler.Register("@every 5m", asynq.NewTask(TypePeriodicCleanup, payload))
+	scheduler := asynq.NewScheduler(redisConnection, &asynq.SchedulerOpts{PostEnqueueFunc: recordSkippedEnqueue})
+	scheduleDoc, err := loadScheduleDocument()
+	if err != nil {
+		log.Fatalf("could not load schedules: %v", err)
+	}
+	changes, err := applyScheduleDocument(scheduler, scheduleDoc, false)
 	if err != nil {
-		log.Fatalf("could not register scheduler entry: %v", err)
+		log.Fatalf("could not register schedules: %v", err)
 	}
-	log.Printf("registered periodic task with entry ID: %s", entryID)
+	log.Printf("loaded %d periodic task schedule(s)", len(changes))
 
 	go func() {
 		log.Println("Starting Periodic Task Scheduler...")
@@ -398,12 +1682,23 @@ func main() {
 	userHandler := NewUserHandler(userService)
 	postHandler := NewPostHandler(taskDispatcher)
 	jobHandler := NewJobHandler(redisConnection)
+	bulkHandler := NewBulkHandler(taskDispatcher)
 
 	// Routes
-	api := app.Group("/api")
+	api := app.Group("/api", optionalUserAuth(), activityMiddleware)
 	api.Post("/users", userHandler.CreateUser)
 	api.Post("/posts/:id/process-image", postHandler.ProcessImage)
 	api.Get("/jobs/:id", jobHandler.GetJobStatus)
+	api.Get("/jobs/:id/chain", jobHandler.GetJobChain)
+
+	admin := app.Group("/admin", adminAuth())
+	admin.Post("/users/bulk", bulkHandler.Submit)
+	admin.Get("/users/bulk/:id", bulkHandler.Report)
+	admin.Get("/users/bulk/:id/export", bulkHandler.Export)
+	admin.Get("/schedules/export", ExportSchedules)
+	admin.Post("/schedules/import", ImportSchedules(scheduler))
+	admin.Get("/schedules/:id/runs", GetScheduleRuns)
+	admin.Get("/users/:id/anonymization", GetUserAnonymization)
 
 	// Graceful Shutdown
 	go func() {
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -74,57 +79,460 @@ const (
 	TaskTypePeriodicReport = "report:generate_daily"
 )
 
+// TenantID, TenantPlan and UserRole are carried in payloads so routing rules
+// can inspect them; handlers ignore them.
 type WelcomeEmailJobPayload struct {
-	Email string    `json:"email"`
-	UserID uuid.UUID `json:"user_id"`
+	Email      string    `json:"email"`
+	UserID     uuid.UUID `json:"user_id"`
+	UserRole   UserRole  `json:"user_role"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	TenantPlan string    `json:"tenant_plan,omitempty"`
 }
 
 type ImageJobPayload struct {
-	PostID uuid.UUID `json:"post_id"`
+	PostID         uuid.UUID `json:"post_id"`
+	ImageSizeBytes int64     `json:"image_size_bytes,omitempty"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	TenantPlan     string    `json:"tenant_plan,omitempty"`
+}
+
+// Mock tenant directory; unknown tenants are on the free plan.
+var tenantPlans = map[string]string{
+	"acme":    "premium",
+	"initech": "standard",
+}
+
+func tenantPlan(tenantID string) string {
+	if plan, ok := tenantPlans[tenantID]; ok {
+		return plan
+	}
+	return "free"
 }
 
 // --- Task Creation (Functional Style) ---
-func newWelcomeEmailTask(userID uuid.UUID, email string) (*asynq.Task, error) {
-	payload, err := json.Marshal(WelcomeEmailJobPayload{UserID: userID, Email: email})
+func newWelcomeEmailTask(p WelcomeEmailJobPayload) (*asynq.Task, error) {
+	payload, err := json.Marshal(p)
 	if err != nil {
 		return nil, err
 	}
 	// This task is critical, retry up to 10 times with a 5 minute timeout.
-	return asynq.NewTask(TaskTypeWelcomeEmail, payload, asynq.MaxRetry(10), asynq.Timeout(5*time.Minute), asynq.Queue("critical")), nil
+	return asynq.NewTask(TaskTypeWelcomeEmail, payload, asynq.MaxRetry(10), asynq.Timeout(5*time.Minute)), nil
 }
 
-func newImageProcessingTasks(postID uuid.UUID) (resizeTask *asynq.Task, watermarkTask *asynq.Task, err error) {
-	payload, err := json.Marshal(ImageJobPayload{PostID: postID})
+func newImageProcessingTasks(p ImageJobPayload, opts ...asynq.Option) (resizeTask *asynq.Task, watermarkTask *asynq.Task, err error) {
+	payload, err := json.Marshal(p)
 	if err != nil {
 		return nil, nil, err
 	}
-	resizeTask = asynq.NewTask(TaskTypeResizeImage, payload, asynq.MaxRetry(3))
-	watermarkTask = asynq.NewTask(TaskTypeWatermarkImage, payload, asynq.MaxRetry(3))
+	resizeTask = asynq.NewTask(TaskTypeResizeImage, payload, append([]asynq.Option{asynq.MaxRetry(3)}, opts...)...)
+	watermarkTask = asynq.NewTask(TaskTypeWatermarkImage, payload, append([]asynq.Option{asynq.MaxRetry(3)}, opts...)...)
 	return resizeTask, watermarkTask, nil
 }
 
+// --- Queue Routing Rules ---
+
+// Queue weights served by the worker. Rules may only target these queues.
+var workerQueues = map[string]int{"critical": 10, "default": 5, "bulk": 1}
+
+// Queue used when no rule matches, by task type.
+var defaultQueueByType = map[string]string{
+	TaskTypeWelcomeEmail:   "critical",
+	TaskTypeResizeImage:    "default",
+	TaskTypeWatermarkImage: "default",
+	TaskTypePeriodicReport: "default",
+}
+
+// Condition compares one payload attribute. Numeric operators treat both
+// sides as numbers; "in" expects a list value.
+type Condition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// RoutingRule sends matching tasks to Queue. Rules are tried in ascending
+// Priority order (ties keep their configured order) and the first match wins.
+type RoutingRule struct {
+	Name       string      `json:"name"`
+	Priority   int         `json:"priority"`
+	TaskTypes  []string    `json:"task_types,omitempty"` // empty matches every type
+	Conditions []Condition `json:"conditions"`           // all must hold
+	Queue      string      `json:"queue"`
+}
+
+var defaultRoutingRules = []RoutingRule{
+	{Name: "admins-critical", Priority: 10, Conditions: []Condition{{Field: "user_role", Op: "eq", Value: string(RoleAdmin)}}, Queue: "critical"},
+	{Name: "premium-tenants-critical", Priority: 20, Conditions: []Condition{{Field: "tenant_plan", Op: "eq", Value: "premium"}}, Queue: "critical"},
+	{Name: "large-images-bulk", Priority: 30, TaskTypes: []string{TaskTypeResizeImage}, Conditions: []Condition{{Field: "image_size_bytes", Op: "gte", Value: 10 << 20}}, Queue: "bulk"},
+	{Name: "free-tier-email-default", Priority: 100, TaskTypes: []string{TaskTypeWelcomeEmail}, Conditions: []Condition{{Field: "tenant_plan", Op: "eq", Value: "free"}}, Queue: "default"},
+}
+
+var validOps = map[string]bool{"eq": true, "neq": true, "in": true, "gt": true, "gte": true, "lt": true, "lte": true, "exists": true}
+
+func validateRules(rules []RoutingRule) error {
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+		seen[r.Name] = true
+		if _, ok := workerQueues[r.Queue]; !ok {
+			return fmt.Errorf("rule %q: unknown queue %q", r.Name, r.Queue)
+		}
+		for _, c := range r.Conditions {
+			if c.Field == "" || !validOps[c.Op] {
+				return fmt.Errorf("rule %q: invalid condition on %q with op %q", r.Name, c.Field, c.Op)
+			}
+			if c.Op == "in" {
+				if _, ok := c.Value.([]interface{}); !ok {
+					return fmt.Errorf("rule %q: op in needs a list value", r.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sortRules orders rules by precedence without disturbing equal priorities.
+func sortRules(rules []RoutingRule) []RoutingRule {
+	sorted := append([]RoutingRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+	return sorted
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func (c Condition) matches(attrs map[string]interface{}) bool {
+	actual, present := attrs[c.Field]
+	switch c.Op {
+	case "exists":
+		return present
+	case "eq":
+		return present && fmt.Sprint(actual) == fmt.Sprint(c.Value)
+	case "neq":
+		return !present || fmt.Sprint(actual) != fmt.Sprint(c.Value)
+	case "in":
+		list, _ := c.Value.([]interface{})
+		for _, v := range list {
+			if present && fmt.Sprint(actual) == fmt.Sprint(v) {
+				return true
+			}
+		}
+		return false
+	}
+	a, ok1 := toFloat(actual)
+	b, ok2 := toFloat(c.Value)
+	if !present || !ok1 || !ok2 {
+		return false
+	}
+	switch c.Op {
+	case "gt":
+		return a > b
+	case "gte":
+		return a >= b
+	case "lt":
+		return a < b
+	case "lte":
+		return a <= b
+	}
+	return false
+}
+
+func (r RoutingRule) appliesTo(taskType string) bool {
+	if len(r.TaskTypes) == 0 {
+		return true
+	}
+	for _, t := range r.TaskTypes {
+		if t == taskType {
+			return true
+		}
+	}
+	return false
+}
+
+type RuleTrace struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Skipped bool   `json:"skipped,omitempty"` // rule does not apply to the task type
+}
+
+type RoutingDecision struct {
+	Queue       string      `json:"queue"`
+	MatchedRule string      `json:"matched_rule,omitempty"`
+	Trace       []RuleTrace `json:"trace"`
+}
+
+func evaluateRules(rules []RoutingRule, taskType string, payload []byte) (RoutingDecision, error) {
+	decision := RoutingDecision{Queue: defaultQueueByType[taskType]}
+	if decision.Queue == "" {
+		decision.Queue = "default"
+	}
+	attrs := map[string]interface{}{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &attrs); err != nil {
+			return decision, fmt.Errorf("payload is not a JSON object: %v", err)
+		}
+	}
+
+	for _, r := range rules {
+		if !r.appliesTo(taskType) {
+			decision.Trace = append(decision.Trace, RuleTrace{Rule: r.Name, Skipped: true})
+			continue
+		}
+		matched := true
+		for _, c := range r.Conditions {
+			if !c.matches(attrs) {
+				matched = false
+				break
+			}
+		}
+		decision.Trace = append(decision.Trace, RuleTrace{Rule: r.Name, Matched: matched})
+		if matched {
+			decision.Queue = r.Queue
+			decision.MatchedRule = r.Name
+			break
+		}
+	}
+	return decision, nil
+}
+
+// TaskRouter holds the active rule set, kept sorted by precedence.
+type TaskRouter struct {
+	mu    sync.RWMutex
+	rules []RoutingRule
+}
+
+func NewTaskRouter(rules []RoutingRule) (*TaskRouter, error) {
+	router := &TaskRouter{}
+	if err := router.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// loadRoutingRules reads rules from ROUTING_RULES_PATH, or falls back to the
+// built-in defaults when the variable is unset.
+func loadRoutingRules() ([]RoutingRule, error) {
+	path := os.Getenv("ROUTING_RULES_PATH")
+	if path == "" {
+		return defaultRoutingRules, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RoutingRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+func (r *TaskRouter) SetRules(rules []RoutingRule) error {
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+	sorted := sortRules(rules)
+	r.mu.Lock()
+	r.rules = sorted
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *TaskRouter) Rules() []RoutingRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RoutingRule(nil), r.rules...)
+}
+
+func (r *TaskRouter) Route(taskType string, payload []byte) (RoutingDecision, error) {
+	return evaluateRules(r.Rules(), taskType, payload)
+}
+
+// Enqueue places the task on the queue chosen by the rules.
+func (r *TaskRouter) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	decision, err := r.Route(task.Type(), task.Payload())
+	if err != nil {
+		return nil, err
+	}
+	return taskClient.Enqueue(task, append(opts, asynq.Queue(decision.Queue))...)
+}
+
+// adminTokenMiddleware guards admin routes with the ADMIN_TOKEN env var.
+// With no token configured, admin routes are disabled.
+func adminTokenMiddleware(c *fiber.Ctx) error {
+	token := os.Getenv("ADMIN_TOKEN")
+	given := c.Get("X-Admin-Token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	return c.Next()
+}
+
+// --- Error Classification ---
+// Handlers wrap their errors with Permanent or Transient so the worker
+// server knows whether and when to retry. Unclassified errors get asynq's
+// default backoff.
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Unwrap exposes asynq.SkipRetry so asynq archives the task immediately.
+func (e *permanentError) Unwrap() []error { return []error{e.err, asynq.SkipRetry} }
+
+// Permanent marks err as one that retrying cannot fix, e.g. a malformed
+// payload or a record that no longer exists.
+func Permanent(err error) error { return &permanentError{err: err} }
+
+type transientError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks err as temporary. A positive retryAfter replaces the
+// default backoff for the next attempt, e.g. with an upstream Retry-After.
+func Transient(err error, retryAfter time.Duration) error {
+	return &transientError{err: err, retryAfter: retryAfter}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+func classifyTaskError(err error) string {
+	var t *transientError
+	switch {
+	case IsPermanent(err):
+		return "permanent"
+	case errors.As(err, &t):
+		return "transient"
+	default:
+		return "unclassified"
+	}
+}
+
+func taskRetryDelay(n int, err error, task *asynq.Task) time.Duration {
+	var t *transientError
+	if errors.As(err, &t) && t.retryAfter > 0 {
+		return t.retryAfter
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, task)
+}
+
+// taskIsFailure keeps throttling out of the failure counts: an upstream
+// that told us when to come back has not failed.
+func taskIsFailure(err error) bool {
+	var t *transientError
+	return !(errors.As(err, &t) && t.retryAfter > 0)
+}
+
+func logTaskError(ctx context.Context, task *asynq.Task, err error) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	log.Printf("[TASK-FAIL] %s (%s, attempt %d/%d): %v", task.Type(), classifyTaskError(err), retried+1, maxRetry+1, err)
+}
+
+// upstreamError classifies a non-2xx response from a dependency: 429 and
+// 5xx are transient, honouring Retry-After; anything else is our fault.
+func upstreamError(service string, resp *http.Response) error {
+	err := fmt.Errorf("%s returned %s", service, resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		var after time.Duration
+		if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && secs > 0 {
+			after = time.Duration(secs) * time.Second
+		}
+		return Transient(err, after)
+	}
+	return Permanent(err)
+}
+
 // --- Task Handlers (Functional Style) ---
 func handleWelcomeEmailTask(ctx context.Context, t *asynq.Task) error {
 	var p WelcomeEmailJobPayload
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		return fmt.Errorf("could not unmarshal payload: %v", err)
+		return Permanent(fmt.Errorf("could not unmarshal payload: %v", err))
+	}
+	dbMutex.RLock()
+	_, ok := userStore[p.UserID]
+	dbMutex.RUnlock()
+	if !ok {
+		return Permanent(fmt.Errorf("user %s no longer exists", p.UserID))
 	}
 	log.Printf("[TASK] Sending Welcome Email to %s (User ID: %s)", p.Email, p.UserID)
-	time.Sleep(1 * time.Second) // Simulate network latency
+	if err := sendWelcomeEmail(ctx, p); err != nil {
+		return err
+	}
 	log.Printf("[TASK] Welcome Email successfully sent to %s", p.Email)
 	return nil
 }
 
-func handleResizeImageTask(ctx context.Context, t *asynq.Task) error {
+// sendWelcomeEmail posts to the mail provider at EMAIL_API_URL, or only
+// simulates the latency when it is unset.
+func sendWelcomeEmail(ctx context.Context, p WelcomeEmailJobPayload) error {
+	url := os.Getenv("EMAIL_API_URL")
+	if url == "" {
+		time.Sleep(1 * time.Second) // Simulate network latency
+		return nil
+	}
+	body, _ := json.Marshal(map[string]string{"to": p.Email, "template": "welcome"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Transient(err, 0)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return upstreamError("mail provider", resp)
+	}
+	return nil
+}
+
+func loadImagePost(t *asynq.Task) (ImageJobPayload, error) {
 	var p ImageJobPayload
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		return fmt.Errorf("could not unmarshal payload: %v", err)
+		return p, Permanent(fmt.Errorf("could not unmarshal payload: %v", err))
+	}
+	dbMutex.RLock()
+	_, ok := postStore[p.PostID]
+	dbMutex.RUnlock()
+	if !ok {
+		return p, Permanent(fmt.Errorf("post %s no longer exists", p.PostID))
+	}
+	return p, nil
+}
+
+func handleResizeImageTask(ctx context.Context, t *asynq.Task) error {
+	p, err := loadImagePost(t)
+	if err != nil {
+		return err
 	}
 	log.Printf("[TASK] Resizing image for post %s", p.PostID)
-	// Simulate a task that might fail and needs retrying with backoff
+	// Simulate an image service that is sometimes unavailable
 	if rand.Intn(2) == 0 { // 50% failure rate
-		log.Printf("[TASK-FAIL] Failed to resize image for post %s. Will retry.", p.PostID)
-		return fmt.Errorf("image service is temporarily unavailable")
+		return Transient(errors.New("image service returned 503 Service Unavailable"), 0)
 	}
 	time.Sleep(4 * time.Second)
 	log.Printf("[TASK] Image resized for post %s", p.PostID)
@@ -132,9 +540,9 @@ func handleResizeImageTask(ctx context.Context, t *asynq.Task) error {
 }
 
 func handleWatermarkImageTask(ctx context.Context, t *asynq.Task) error {
-	var p ImageJobPayload
-	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		return fmt.Errorf("could not unmarshal payload: %v", err)
+	p, err := loadImagePost(t)
+	if err != nil {
+		return err
 	}
 	log.Printf("[TASK] Watermarking image for post %s", p.PostID)
 	time.Sleep(2 * time.Second)
@@ -161,11 +569,23 @@ func main() {
 	taskClient = asynq.NewClient(redisOpt)
 	defer taskClient.Close()
 
+	rules, err := loadRoutingRules()
+	if err != nil {
+		log.Fatalf("Could not load routing rules: %v", err)
+	}
+	router, err := NewTaskRouter(rules)
+	if err != nil {
+		log.Fatalf("Invalid routing rules: %v", err)
+	}
+
 	// --- Worker Goroutine ---
 	go func() {
 		srv := asynq.NewServer(redisOpt, asynq.Config{
-			Concurrency: 20,
-			Queues: map[string]int{"critical": 10, "default": 5},
+			Concurrency:    20,
+			Queues:         workerQueues,
+			RetryDelayFunc: taskRetryDelay,
+			IsFailure:      taskIsFailure,
+			ErrorHandler:   asynq.ErrorHandlerFunc(logTaskError),
 		})
 		mux := asynq.NewServeMux()
 		mux.HandleFunc(TaskTypeWelcomeEmail, handleWelcomeEmailTask)
@@ -221,18 +641,25 @@ func main() {
 		userStore[newUser.ID] = newUser
 		dbMutex.Unlock()
 
-		task, err := newWelcomeEmailTask(newUser.ID, newUser.Email)
+		tenantID := c.Get("X-Tenant-ID")
+		task, err := newWelcomeEmailTask(WelcomeEmailJobPayload{
+			UserID:     newUser.ID,
+			Email:      newUser.Email,
+			UserRole:   newUser.Role,
+			TenantID:   tenantID,
+			TenantPlan: tenantPlan(tenantID),
+		})
 		if err != nil {
 			log.Printf("Error creating welcome email task: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
 		}
 
-		info, err := taskClient.Enqueue(task)
+		info, err := router.Enqueue(task)
 		if err != nil {
 			log.Printf("Error enqueuing welcome email task: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
 		}
-		log.Printf("Enqueued welcome email task %s for user %s", info.ID, newUser.ID)
+		log.Printf("Enqueued welcome email task %s on queue %s for user %s", info.ID, info.Queue, newUser.ID)
 
 		return c.Status(fiber.StatusCreated).JSON(newUser)
 	})
@@ -243,13 +670,32 @@ func main() {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid post ID"})
 		}
 
+		var req struct {
+			ImageSizeBytes int64 `json:"image_size_bytes"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON"})
+			}
+		}
+
 		dbMutex.Lock()
 		if _, ok := postStore[postID]; !ok {
 			postStore[postID] = Post{ID: postID, Title: "A new post"}
 		}
 		dbMutex.Unlock()
 
-		resizeTask, watermarkTask, err := newImageProcessingTasks(postID)
+		tenantID := c.Get("X-Tenant-ID")
+		jobPayload := ImageJobPayload{PostID: postID, ImageSizeBytes: req.ImageSizeBytes, TenantID: tenantID, TenantPlan: tenantPlan(tenantID)}
+		raw, _ := json.Marshal(jobPayload)
+		decision, err := router.Route(TaskTypeResizeImage, raw)
+		if err != nil {
+			log.Printf("Error routing image processing tasks: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// The watermark step follows the resize step onto the same queue.
+		resizeTask, watermarkTask, err := newImageProcessingTasks(jobPayload, asynq.Queue(decision.Queue))
 		if err != nil {
 			log.Printf("Error creating image processing tasks: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
@@ -291,6 +737,53 @@ func main() {
 		})
 	})
 
+	// --- Routing Rule Admin ---
+	admin := app.Group("/admin", adminTokenMiddleware)
+
+	admin.Get("/routing-rules", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"rules": router.Rules()})
+	})
+
+	admin.Put("/routing-rules", func(c *fiber.Ctx) error {
+		var rules []RoutingRule
+		if err := json.Unmarshal(c.Body(), &rules); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON"})
+		}
+		if err := router.SetRules(rules); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Printf("Routing rules replaced (%d rules)", len(rules))
+		return c.JSON(fiber.Map{"rules": router.Rules()})
+	})
+
+	// Dry run: report where a task would go without enqueueing it. Candidate
+	// rules may be supplied to try them before they are installed.
+	admin.Post("/routing-rules/evaluate", func(c *fiber.Ctx) error {
+		var req struct {
+			TaskType string          `json:"task_type"`
+			Payload  json.RawMessage `json:"payload"`
+			Rules    []RoutingRule   `json:"rules"`
+		}
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON"})
+		}
+		if _, ok := defaultQueueByType[req.TaskType]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown task_type"})
+		}
+		rules := router.Rules()
+		if req.Rules != nil {
+			if err := validateRules(req.Rules); err != nil {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+			}
+			rules = sortRules(req.Rules)
+		}
+		decision, err := evaluateRules(rules, req.TaskType, req.Payload)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(decision)
+	})
+
 	// --- Graceful Shutdown ---
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
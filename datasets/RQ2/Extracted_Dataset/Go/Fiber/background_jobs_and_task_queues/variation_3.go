@@ -1,20 +1,36 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io/fs"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 )
@@ -24,6 +40,7 @@ import (
 // go 1.21
 //
 // require (
+// 	github.com/go-playground/validator/v10 v10.19.0
 // 	github.com/gofiber/fiber/v2 v2.52.4
 // 	github.com/google/uuid v1.6.0
 // 	github.com/hibiken/asynq v0.24.1
@@ -84,18 +101,351 @@ type ITaskProcessor interface {
 }
 
 type IUserService interface {
-	Create(ctx context.Context, email string) (*User, error)
+	Create(ctx context.Context, email, password string) (*User, error)
 }
 
-// --- Asynq Implementation of Interfaces ---
+// --- Task Registry ---
+// Every task is declared exactly once below: its type string, payload struct and
+// default options. Producers enqueue through the declaration and consumers are
+// registered against it, so the two sides cannot drift apart. The payload's
+// `validate` tags are its schema: New refuses to build a task that breaks
+// them, so a bad payload is rejected at the call site instead of burning
+// retries on a worker.
+
+type TaskDef[P any] struct {
+	Type     string
+	Defaults []asynq.Option
+}
+
+var declaredTasks = map[string]bool{}
+
+var payloadValidator = newPayloadValidator()
+
+// newPayloadValidator reports fields by their JSON name, which is what the
+// API client and the task payload both see.
+func newPayloadValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// ErrInvalidPayload is wrapped by every *PayloadError.
+var ErrInvalidPayload = errors.New("invalid task payload")
+
+type FieldViolation struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// PayloadError lists every rule a payload broke for the given task type.
+type PayloadError struct {
+	TaskType   string           `json:"task_type"`
+	Violations []FieldViolation `json:"violations"`
+}
+
+func (e *PayloadError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.Field + " failed " + v.Rule
+	}
+	return fmt.Sprintf("%s payload: %s", e.TaskType, strings.Join(parts, ", "))
+}
+
+func (e *PayloadError) Unwrap() error { return ErrInvalidPayload }
+
+func declareTask[P any](taskType string, defaults ...asynq.Option) TaskDef[P] {
+	if declaredTasks[taskType] {
+		panic("task type declared twice: " + taskType)
+	}
+	declaredTasks[taskType] = true
+	return TaskDef[P]{Type: taskType, Defaults: defaults}
+}
+
+// Validate checks payload against its validate tags. Payload types without
+// tags always pass.
+func (d TaskDef[P]) Validate(payload P) error {
+	err := payloadValidator.Struct(payload)
+	var fieldErrs validator.ValidationErrors
+	if err == nil || !errors.As(err, &fieldErrs) {
+		return err
+	}
+	pe := &PayloadError{TaskType: d.Type}
+	for _, fe := range fieldErrs {
+		pe.Violations = append(pe.Violations, FieldViolation{Field: fe.Field(), Rule: fe.Tag(), Param: fe.Param()})
+	}
+	return pe
+}
+
+// New builds a task from a typed payload; opts are applied after the defaults.
+func (d TaskDef[P]) New(payload P, opts ...asynq.Option) (*asynq.Task, error) {
+	if err := d.Validate(payload); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s payload: %w", d.Type, err)
+	}
+	return asynq.NewTask(d.Type, data, append(append([]asynq.Option{}, d.Defaults...), opts...)...), nil
+}
+
+func (d TaskDef[P]) Enqueue(ctx context.Context, client *asynq.Client, payload P, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	task, err := d.New(payload, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return client.EnqueueContext(ctx, task)
+}
+
+// Handler decodes and validates the payload before calling fn. A payload that
+// fails either step will never succeed, so it is not retried; this still
+// matters for tasks enqueued before a rule existed or by another producer.
+func (d TaskDef[P]) Handler(fn func(ctx context.Context, payload P) error) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		var payload P
+		if len(t.Payload()) > 0 {
+			if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+				return fmt.Errorf("decode %s payload: %v: %w", d.Type, err, asynq.SkipRetry)
+			}
+		}
+		if err := d.Validate(payload); err != nil {
+			return fmt.Errorf("%v: %w", err, asynq.SkipRetry)
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// TaskRegistry collects the consumer side and refuses to build a mux while any
+// declared task is missing a handler.
+type TaskRegistry struct {
+	handlers map[string]asynq.Handler
+}
+
+func NewTaskRegistry() *TaskRegistry {
+	return &TaskRegistry{handlers: make(map[string]asynq.Handler)}
+}
+
+// Handle is a function rather than a method because Go methods cannot take type parameters.
+func Handle[P any](r *TaskRegistry, def TaskDef[P], fn func(ctx context.Context, payload P) error) {
+	if _, exists := r.handlers[def.Type]; exists {
+		panic("handler registered twice for task type: " + def.Type)
+	}
+	r.handlers[def.Type] = def.Handler(fn)
+}
+
+func (r *TaskRegistry) Mux() (*asynq.ServeMux, error) {
+	for taskType := range declaredTasks {
+		if _, ok := r.handlers[taskType]; !ok {
+			return nil, fmt.Errorf("no handler registered for declared task %q", taskType)
+		}
+	}
+	mux := asynq.NewServeMux()
+	for taskType, h := range r.handlers {
+		mux.Handle(taskType, h)
+	}
+	return mux, nil
+}
+
+type WelcomeEmailPayload struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+	Email  string    `json:"email" validate:"required,email,max=254"`
+}
+
+type ImagePayload struct {
+	PostID uuid.UUID `json:"post_id" validate:"required"`
+}
+
+type CleanupPayload struct{}
+
+var (
+	WelcomeEmailTask    = declareTask[WelcomeEmailPayload]("task:welcome_email", asynq.MaxRetry(5), asynq.Queue("default"))
+	ImageResizeTask     = declareTask[ImagePayload]("task:image_resize", asynq.MaxRetry(3))
+	ImageWatermarkTask  = declareTask[ImagePayload]("task:image_watermark", asynq.MaxRetry(3))
+	PeriodicCleanupTask = declareTask[CleanupPayload]("task:periodic_cleanup")
+)
+
+// --- Panic Budget & Quarantine ---
+// A handler that keeps panicking burns worker slots and retries for nothing.
+// PanicGuard recovers panics per task type and, once a type exceeds its
+// budget within the window, quarantines it: its tasks are parked in the retry
+// set without running and without spending their retry allowance, until an
+// operator lifts the quarantine.
+
+var errQuarantined = errors.New("task type is quarantined")
 
 const (
-	TaskWelcomeEmail = "task:welcome_email"
-	TaskImageResize  = "task:image_resize"
-	TaskImageWatermark = "task:image_watermark"
-	TaskPeriodicCleanup = "task:periodic_cleanup"
+	quarantineRecheck = time.Minute
+	panicStacksKept   = 5
 )
 
+type PanicRecord struct {
+	TaskType string    `json:"task_type"`
+	TaskID   string    `json:"task_id"`
+	Value    string    `json:"value"`
+	Stack    string    `json:"stack"`
+	At       time.Time `json:"at"`
+}
+
+type panicState struct {
+	recent           []time.Time // panics inside the window
+	stacks           []PanicRecord
+	quarantinedSince *time.Time
+}
+
+// Alerter tells operators about quarantines.
+type Alerter interface {
+	Alert(subject, detail string)
+}
+
+type logAlerter struct{}
+
+func (logAlerter) Alert(subject, detail string) {
+	log.Printf("ALERT: %s\n%s", subject, detail)
+}
+
+type PanicGuard struct {
+	Budget  int
+	Window  time.Duration
+	Alerter Alerter
+
+	mu    sync.Mutex
+	types map[string]*panicState
+}
+
+func NewPanicGuard(budget int, window time.Duration, alerter Alerter) *PanicGuard {
+	return &PanicGuard{Budget: budget, Window: window, Alerter: alerter, types: make(map[string]*panicState)}
+}
+
+func (g *PanicGuard) state(taskType string) *panicState {
+	st, ok := g.types[taskType]
+	if !ok {
+		st = &panicState{}
+		g.types[taskType] = st
+	}
+	return st
+}
+
+func (g *PanicGuard) Quarantined(taskType string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, ok := g.types[taskType]
+	return ok && st.quarantinedSince != nil
+}
+
+// record stores the panic and reports whether it tipped the type into quarantine.
+func (g *PanicGuard) record(rec PanicRecord) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st := g.state(rec.TaskType)
+	cutoff := rec.At.Add(-g.Window)
+	kept := st.recent[:0]
+	for _, at := range st.recent {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	st.recent = append(kept, rec.At)
+	st.stacks = append(st.stacks, rec)
+	if len(st.stacks) > panicStacksKept {
+		st.stacks = st.stacks[len(st.stacks)-panicStacksKept:]
+	}
+	if st.quarantinedSince != nil || len(st.recent) <= g.Budget {
+		return false
+	}
+	since := rec.At
+	st.quarantinedSince = &since
+	return true
+}
+
+// Release lifts a quarantine and forgets the panics that caused it, so the
+// type starts again with a full budget.
+func (g *PanicGuard) Release(taskType string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, ok := g.types[taskType]
+	if !ok || st.quarantinedSince == nil {
+		return false
+	}
+	st.quarantinedSince = nil
+	st.recent = nil
+	return true
+}
+
+func (g *PanicGuard) Middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) (err error) {
+		if g.Quarantined(t.Type()) {
+			return errQuarantined
+		}
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			taskID, _ := asynq.GetTaskID(ctx)
+			rec := PanicRecord{TaskType: t.Type(), TaskID: taskID, Value: fmt.Sprint(r), Stack: string(debug.Stack()), At: time.Now().UTC()}
+			log.Printf("PANIC in %s task %s: %v", rec.TaskType, taskID, r)
+			if g.record(rec) {
+				g.Alerter.Alert(
+					fmt.Sprintf("Task type %s quarantined", rec.TaskType),
+					fmt.Sprintf("More than %d panics in %s; last: %s\n%s", g.Budget, g.Window, rec.Value, rec.Stack))
+			}
+			err = fmt.Errorf("panic in %s: %v", rec.TaskType, r)
+		}()
+		return next.ProcessTask(ctx, t)
+	})
+}
+
+// IsFailure and RetryDelay plug into asynq.Config so parked tasks keep their
+// retry count and are rechecked at a steady pace.
+func (g *PanicGuard) IsFailure(err error) bool {
+	return !errors.Is(err, errQuarantined)
+}
+
+func (g *PanicGuard) RetryDelay(n int, err error, t *asynq.Task) time.Duration {
+	if errors.Is(err, errQuarantined) {
+		return quarantineRecheck
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, t)
+}
+
+type PanicReport struct {
+	TaskType         string        `json:"task_type"`
+	PanicsInWindow   int           `json:"panics_in_window"`
+	QuarantinedSince *time.Time    `json:"quarantined_since,omitempty"`
+	RecentPanics     []PanicRecord `json:"recent_panics"`
+}
+
+func (g *PanicGuard) Report() []PanicReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cutoff := time.Now().Add(-g.Window)
+	out := make([]PanicReport, 0, len(g.types))
+	for taskType, st := range g.types {
+		n := 0
+		for _, at := range st.recent {
+			if at.After(cutoff) {
+				n++
+			}
+		}
+		out = append(out, PanicReport{
+			TaskType:         taskType,
+			PanicsInWindow:   n,
+			QuarantinedSince: st.quarantinedSince,
+			RecentPanics:     append([]PanicRecord(nil), st.stacks...),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TaskType < out[j].TaskType })
+	return out
+}
+
+// --- Asynq Implementation of Interfaces ---
+
 type AsynqJobDispatcher struct {
 	client *asynq.Client
 }
@@ -105,16 +455,16 @@ func NewAsynqJobDispatcher(opt asynq.RedisClientOpt) *AsynqJobDispatcher {
 }
 
 func (d *AsynqJobDispatcher) DispatchWelcomeEmail(ctx context.Context, userID uuid.UUID, email string) (*asynq.TaskInfo, error) {
-	payload, _ := json.Marshal(map[string]interface{}{"user_id": userID, "email": email})
-	task := asynq.NewTask(TaskWelcomeEmail, payload, asynq.MaxRetry(5))
-	return d.client.EnqueueContext(ctx, task, asynq.Queue("default"))
+	return WelcomeEmailTask.Enqueue(ctx, d.client, WelcomeEmailPayload{UserID: userID, Email: email})
 }
 
 func (d *AsynqJobDispatcher) DispatchImagePipeline(ctx context.Context, postID uuid.UUID) (*asynq.TaskInfo, error) {
-	payload, _ := json.Marshal(map[string]interface{}{"post_id": postID})
-	resize := asynq.NewTask(TaskImageResize, payload, asynq.MaxRetry(3))
-	watermark := asynq.NewTask(TaskImageWatermark, payload, asynq.MaxRetry(3))
-	return d.client.EnqueueContext(ctx, resize, asynq.ContinueWith(watermark))
+	payload := ImagePayload{PostID: postID}
+	watermark, err := ImageWatermarkTask.New(payload)
+	if err != nil {
+		return nil, err
+	}
+	return ImageResizeTask.Enqueue(ctx, d.client, payload, asynq.ContinueWith(watermark))
 }
 
 type AsynqJobStatusChecker struct {
@@ -131,19 +481,30 @@ func (c *AsynqJobStatusChecker) CheckStatus(queue, id string) (*asynq.TaskInfo,
 
 type AsynqTaskProcessor struct {
 	server *asynq.Server
+	guard  *PanicGuard
 }
 
-func NewAsynqTaskProcessor(opt asynq.RedisClientOpt) *AsynqTaskProcessor {
-	srv := asynq.NewServer(opt, asynq.Config{Concurrency: 10})
-	return &AsynqTaskProcessor{server: srv}
+func NewAsynqTaskProcessor(opt asynq.RedisClientOpt, guard *PanicGuard) *AsynqTaskProcessor {
+	srv := asynq.NewServer(opt, asynq.Config{
+		Concurrency:    10,
+		IsFailure:      guard.IsFailure,
+		RetryDelayFunc: guard.RetryDelay,
+	})
+	return &AsynqTaskProcessor{server: srv, guard: guard}
 }
 
 func (p *AsynqTaskProcessor) Register() *asynq.ServeMux {
-	mux := asynq.NewServeMux()
-	mux.HandleFunc(TaskWelcomeEmail, p.handleWelcomeEmail)
-	mux.HandleFunc(TaskImageResize, p.handleImageResize)
-	mux.HandleFunc(TaskImageWatermark, p.handleImageWatermark)
-	mux.HandleFunc(TaskPeriodicCleanup, p.handlePeriodicCleanup)
+	registry := NewTaskRegistry()
+	Handle(registry, WelcomeEmailTask, p.handleWelcomeEmail)
+	Handle(registry, ImageResizeTask, p.handleImageResize)
+	Handle(registry, ImageWatermarkTask, p.handleImageWatermark)
+	Handle(registry, PeriodicCleanupTask, p.handlePeriodicCleanup)
+
+	mux, err := registry.Mux()
+	if err != nil {
+		log.Fatalf("task registry incomplete: %v", err)
+	}
+	mux.Use(p.guard.Middleware)
 	return mux
 }
 
@@ -159,18 +520,14 @@ func (p *AsynqTaskProcessor) Stop() {
 }
 
 // Task Handlers as methods
-func (p *AsynqTaskProcessor) handleWelcomeEmail(ctx context.Context, t *asynq.Task) error {
-	var payload map[string]string
-	json.Unmarshal(t.Payload(), &payload)
-	log.Printf("HANDLER: Sending welcome email to %s", payload["email"])
+func (p *AsynqTaskProcessor) handleWelcomeEmail(ctx context.Context, payload WelcomeEmailPayload) error {
+	log.Printf("HANDLER: Sending welcome email to %s", payload.Email)
 	time.Sleep(500 * time.Millisecond)
 	return nil
 }
 
-func (p *AsynqTaskProcessor) handleImageResize(ctx context.Context, t *asynq.Task) error {
-	var payload map[string]string
-	json.Unmarshal(t.Payload(), &payload)
-	log.Printf("HANDLER: Resizing image for post %s", payload["post_id"])
+func (p *AsynqTaskProcessor) handleImageResize(ctx context.Context, payload ImagePayload) error {
+	log.Printf("HANDLER: Resizing image for post %s", payload.PostID)
 	if rand.Intn(10) > 6 { // 30% chance of failure
 		return errors.New("transient error in image resizing service")
 	}
@@ -178,15 +535,13 @@ func (p *AsynqTaskProcessor) handleImageResize(ctx context.Context, t *asynq.Tas
 	return nil
 }
 
-func (p *AsynqTaskProcessor) handleImageWatermark(ctx context.Context, t *asynq.Task) error {
-	var payload map[string]string
-	json.Unmarshal(t.Payload(), &payload)
-	log.Printf("HANDLER: Watermarking image for post %s", payload["post_id"])
+func (p *AsynqTaskProcessor) handleImageWatermark(ctx context.Context, payload ImagePayload) error {
+	log.Printf("HANDLER: Watermarking image for post %s", payload.PostID)
 	time.Sleep(1 * time.Second)
 	return nil
 }
 
-func (p *AsynqTaskProcessor) handlePeriodicCleanup(ctx context.Context, t *asynq.Task) error {
+func (p *AsynqTaskProcessor) handlePeriodicCleanup(ctx context.Context, _ CleanupPayload) error {
 	log.Printf("HANDLER: Running periodic cleanup job")
 	return nil
 }
@@ -201,13 +556,17 @@ func NewUserService(d IJobDispatcher) *UserService {
 	return &UserService{dispatcher: d}
 }
 
-func (s *UserService) Create(ctx context.Context, email string) (*User, error) {
+func (s *UserService) Create(ctx context.Context, email, password string) (*User, error) {
 	newUser := &User{
-		ID: uuid.New(), Email: email, Role: USER, IsActive: true, CreatedAt: time.Now(),
+		ID: uuid.New(), Email: email, PasswordHash: hashPassword(password), Role: USER, IsActive: true, CreatedAt: time.Now(),
 	}
 	users.Store(newUser.ID, *newUser)
 	
 	_, err := s.dispatcher.DispatchWelcomeEmail(ctx, newUser.ID, newUser.Email)
+	if errors.Is(err, ErrInvalidPayload) {
+		users.Delete(newUser.ID)
+		return nil, err
+	}
 	if err != nil {
 		// In a real app, you might want to handle this failure more gracefully
 		log.Printf("WARN: User %s created, but failed to dispatch welcome email: %v", newUser.ID, err)
@@ -227,14 +586,30 @@ func NewAPI(u IUserService, d IJobDispatcher, s IJobStatusChecker) *API {
 	return &API{userService: u, dispatcher: d, statusChecker: s}
 }
 
+// dispatchFailed maps a dispatch error to a response. Payload violations are
+// the caller's fault and are reported field by field.
+func dispatchFailed(c *fiber.Ctx, err error, fallback string) error {
+	var pe *PayloadError
+	if errors.As(err, &pe) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": ErrInvalidPayload.Error(), "task_type": pe.TaskType, "violations": pe.Violations})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
+
 func (a *API) RegisterUser(c *fiber.Ctx) error {
-	var body struct{ Email string `json:"email"` }
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
 	}
-	user, err := a.userService.Create(c.Context(), body.Email)
+	if len(body.Password) < 8 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password must be at least 8 characters"})
+	}
+	user, err := a.userService.Create(c.Context(), body.Email, body.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return dispatchFailed(c, err, err.Error())
 	}
 	return c.Status(fiber.StatusCreated).JSON(user)
 }
@@ -248,7 +623,7 @@ func (a *API) ProcessPostImage(c *fiber.Ctx) error {
 	
 	info, err := a.dispatcher.DispatchImagePipeline(c.Context(), id)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start job"})
+		return dispatchFailed(c, err, "could not start job")
 	}
 	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"job_id": info.ID, "queue": info.Queue})
 }
@@ -263,17 +638,292 @@ func (a *API) GetJobStatus(c *fiber.Ctx) error {
 	return c.JSON(info)
 }
 
+func hashPassword(password string) string {
+	return "hashed_" + password
+}
+
+// authenticate returns the active user with this email and password.
+func authenticate(email, password string) (User, bool) {
+	var found User
+	ok := false
+	users.Range(func(_, v interface{}) bool {
+		u := v.(User)
+		if u.IsActive && strings.EqualFold(u.Email, email) &&
+			subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte(hashPassword(password))) == 1 {
+			found, ok = u, true
+			return false
+		}
+		return true
+	})
+	return found, ok
+}
+
+// adminAuth guards /admin with HTTP Basic credentials (email and password)
+// of an active ADMIN user. A browser opening the admin panel is challenged
+// for them; scripts send them up front.
+func adminAuth() fiber.Handler {
+	return basicauth.New(basicauth.Config{
+		Realm: "admin",
+		Authorizer: func(email, password string) bool {
+			u, ok := authenticate(email, password)
+			return ok && u.Role == ADMIN
+		},
+	})
+}
+
+// seedAdminUser creates the ADMIN user named by ADMIN_EMAIL and
+// ADMIN_PASSWORD, if both are set.
+func seedAdminUser() {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; admin routes disabled")
+		return
+	}
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: hashPassword(password), Role: ADMIN, IsActive: true, CreatedAt: time.Now()}
+	users.Store(admin.ID, admin)
+}
+
+// PanicAdmin exposes the panic guard to operators.
+type PanicAdmin struct {
+	guard *PanicGuard
+}
+
+func (a *PanicAdmin) List(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"budget": a.guard.Budget, "window": a.guard.Window.String(), "task_types": a.guard.Report()})
+}
+
+// Release lifts the quarantine on the task type given as ?type=, since
+// task types contain colons.
+func (a *PanicAdmin) Release(c *fiber.Ctx) error {
+	taskType := c.Query("type")
+	if !declaredTasks[taskType] {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown task type"})
+	}
+	if !a.guard.Release(taskType) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "task type is not quarantined"})
+	}
+	log.Printf("AUDIT: quarantine on %s lifted by %s", taskType, c.IP())
+	return c.JSON(fiber.Map{"task_type": taskType, "quarantined": false})
+}
+
+// --- Admin Panel ---
+// GET /admin/panel/ renders the queue, job and user APIs below. Assets are
+// gzipped once at startup and served under content-hashed names; only
+// index.html is revalidated, by ETag.
+
+const (
+	adminPanelPrefix  = "/admin/panel/"
+	adminListMaxLimit = 100
+)
+
+//go:embed admin_panel
+var adminPanelFiles embed.FS
+
+type panelAsset struct {
+	body    []byte
+	gzipped []byte // nil when compression does not pay off
+	ext     string
+	etag    string
+	maxAge  int // seconds; 0 means revalidate every time
+}
+
+type AdminPanel struct {
+	assets map[string]*panelAsset
+}
+
+func newPanelAsset(name string, body []byte, maxAge int) *panelAsset {
+	sum := sha256.Sum256(body)
+	a := &panelAsset{body: body, ext: path.Ext(name), etag: `"` + hex.EncodeToString(sum[:6]) + `"`, maxAge: maxAge}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(body)
+	zw.Close()
+	if buf.Len() < len(body) {
+		a.gzipped = buf.Bytes()
+	}
+	return a
+}
+
+// NewAdminPanel serves every file but index.html as name.<hash>.ext.
+// index.html is a template in which {{asset "app.js"}} expands to that URL.
+func NewAdminPanel(files fs.FS) (*AdminPanel, error) {
+	p := &AdminPanel{assets: make(map[string]*panelAsset)}
+	urls := make(map[string]string)
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == "index.html" {
+			return err
+		}
+		body, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		a := newPanelAsset(name, body, 365*24*60*60)
+		hashed := strings.TrimSuffix(name, a.ext) + "." + strings.Trim(a.etag, `"`) + a.ext
+		p.assets[hashed] = a
+		urls[name] = adminPanelPrefix + hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
+		"asset": func(name string) (string, error) {
+			if u, ok := urls[name]; ok {
+				return u, nil
+			}
+			return "", fmt.Errorf("admin panel: no asset %q", name)
+		},
+	}).ParseFS(files, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	var index bytes.Buffer
+	if err := tmpl.Execute(&index, nil); err != nil {
+		return nil, err
+	}
+	p.assets["index.html"] = newPanelAsset("index.html", index.Bytes(), 0)
+	return p, nil
+}
+
+func (p *AdminPanel) Handler(c *fiber.Ctx) error {
+	name := c.Params("*")
+	if name == "" {
+		name = "index.html"
+	}
+	a, ok := p.assets[name]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	c.Set(fiber.HeaderETag, a.etag)
+	c.Vary(fiber.HeaderAcceptEncoding)
+	if a.maxAge > 0 {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d, immutable", a.maxAge))
+	} else {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Type(a.ext)
+	if a.gzipped != nil && c.AcceptsEncodings("gzip") == "gzip" {
+		c.Set(fiber.HeaderContentEncoding, "gzip")
+		return c.Send(a.gzipped)
+	}
+	return c.Send(a.body)
+}
+
+var errUnknownTaskState = errors.New("state must be pending, active, scheduled, retry, archived or completed")
+
+// QueueAdmin exposes queues, jobs and users to operators.
+type QueueAdmin struct {
+	inspector *asynq.Inspector
+}
+
+// listTasks returns up to limit tasks of queue in the given state.
+func (a *QueueAdmin) listTasks(queue, state string, limit int) ([]*asynq.TaskInfo, error) {
+	page := asynq.PageSize(limit)
+	switch state {
+	case "pending":
+		return a.inspector.ListPendingTasks(queue, page)
+	case "active":
+		return a.inspector.ListActiveTasks(queue, page)
+	case "scheduled":
+		return a.inspector.ListScheduledTasks(queue, page)
+	case "retry":
+		return a.inspector.ListRetryTasks(queue, page)
+	case "archived":
+		return a.inspector.ListArchivedTasks(queue, page)
+	case "completed":
+		return a.inspector.ListCompletedTasks(queue, page)
+	}
+	return nil, errUnknownTaskState
+}
+
+func (a *QueueAdmin) Queues(c *fiber.Ctx) error {
+	queues, err := a.inspector.Queues()
+	if err != nil {
+		log.Printf("ERROR: could not list queues: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "could not list queues"})
+	}
+	sort.Strings(queues)
+	rows := make([]fiber.Map, 0, len(queues))
+	for _, queue := range queues {
+		info, err := a.inspector.GetQueueInfo(queue)
+		if err != nil {
+			continue
+		}
+		rows = append(rows, fiber.Map{
+			"queue": info.Queue, "paused": info.Paused, "size": info.Size,
+			"active": info.Active, "pending": info.Pending, "scheduled": info.Scheduled,
+			"retry": info.Retry, "archived": info.Archived, "completed": info.Completed,
+		})
+	}
+	return c.JSON(fiber.Map{"data": rows})
+}
+
+// Jobs serves GET /admin/jobs?queue=default&state=pending&limit=50.
+func (a *QueueAdmin) Jobs(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > adminListMaxLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", adminListMaxLimit)})
+	}
+	tasks, err := a.listTasks(c.Query("queue", "default"), c.Query("state", "pending"), limit)
+	if errors.Is(err, errUnknownTaskState) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil && !errors.Is(err, asynq.ErrQueueNotFound) {
+		log.Printf("ERROR: could not list jobs: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "could not list jobs"})
+	}
+	rows := make([]fiber.Map, 0, len(tasks))
+	for _, t := range tasks {
+		rows = append(rows, fiber.Map{
+			"id": t.ID, "type": t.Type, "queue": t.Queue, "state": t.State.String(),
+			"retried": t.Retried, "max_retry": t.MaxRetry, "last_error": t.LastErr,
+		})
+	}
+	return c.JSON(fiber.Map{"data": rows})
+}
+
+func (a *QueueAdmin) Users(c *fiber.Ctx) error {
+	list := []User{}
+	users.Range(func(_, v interface{}) bool {
+		list = append(list, v.(User))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return c.JSON(fiber.Map{"data": list})
+}
+
 // --- Main ---
 func main() {
 	// Assumes Redis is running on localhost:6379
 	redisOpt := asynq.RedisClientOpt{Addr: "localhost:6379"}
+	seedAdminUser()
 
 	// --- Dependency Injection ---
 	dispatcher := NewAsynqJobDispatcher(redisOpt)
 	statusChecker := NewAsynqJobStatusChecker(redisOpt)
 	userService := NewUserService(dispatcher)
 	api := NewAPI(userService, dispatcher, statusChecker)
-	processor := NewAsynqTaskProcessor(redisOpt)
+	panicBudget, panicWindow := 5, 5*time.Minute
+	if v := os.Getenv("PANIC_BUDGET"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("PANIC_BUDGET must be a non-negative integer, got %q", v)
+		}
+		panicBudget = n
+	}
+	if v := os.Getenv("PANIC_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("PANIC_WINDOW must be a positive duration, got %q", v)
+		}
+		panicWindow = d
+	}
+	guard := NewPanicGuard(panicBudget, panicWindow, logAlerter{})
+	processor := NewAsynqTaskProcessor(redisOpt, guard)
 
 	// --- Start Worker ---
 	go func() {
@@ -287,7 +937,8 @@ func main() {
 	go func() {
 		log.Println("Starting scheduler...")
 		// Every 2 minutes
-		scheduler.Register("*/2 * * * *", asynq.NewTask(TaskPeriodicCleanup, nil))
+		cleanup, _ := PeriodicCleanupTask.New(CleanupPayload{})
+		scheduler.Register("*/2 * * * *", cleanup)
 		if err := scheduler.Run(); err != nil {
 			log.Fatalf("could not run scheduler: %v", err)
 		}
@@ -300,6 +951,22 @@ func main() {
 	app.Post("/posts/:id/process-image", api.ProcessPostImage)
 	app.Get("/jobs/:id", api.GetJobStatus)
 
+	panelFiles, _ := fs.Sub(adminPanelFiles, "admin_panel")
+	panel, err := NewAdminPanel(panelFiles)
+	if err != nil {
+		log.Fatalf("could not build admin panel: %v", err)
+	}
+
+	panicAdmin := &PanicAdmin{guard: guard}
+	queueAdmin := &QueueAdmin{inspector: asynq.NewInspector(redisOpt)}
+	admin := app.Group("/admin", adminAuth())
+	admin.Get("/panics", panicAdmin.List)
+	admin.Post("/panics/release", panicAdmin.Release)
+	admin.Get("/queues", queueAdmin.Queues)
+	admin.Get("/jobs", queueAdmin.Jobs)
+	admin.Get("/users", queueAdmin.Users)
+	admin.Get("/panel/*", panel.Handler)
+
 	// --- Graceful Shutdown ---
 	go func() {
 		if err := app.Listen(":3000"); err != nil && err != http.ErrServerClosed {
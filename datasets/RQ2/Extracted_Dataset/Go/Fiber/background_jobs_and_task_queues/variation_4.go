@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -16,6 +22,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 )
 
 // --- go.mod ---
@@ -26,6 +33,7 @@ import (
 // 	github.com/gofiber/fiber/v2 v2.52.4
 // 	github.com/google/uuid v1.6.0
 // 	github.com/hibiken/asynq v0.24.1
+// 	github.com/redis/go-redis/v9 v9.0.3
 // )
 // ---
 
@@ -72,8 +80,483 @@ var (
 	g_AsynqClient *asynq.Client
 	// Global Asynq inspector for checking job status
 	g_AsynqInspector *asynq.Inspector
+	// Redis client backing state shared by every worker instance
+	g_RedisClient *redis.Client
+	// Circuit breaker guarding the flaky image processing service
+	g_ImageServiceBreaker *CircuitBreaker
+	// Per-user allowance for jobs sent to the critical queue
+	g_ExpediteLimiter *ExpediteLimiter
+	// Fault injection for resilience testing; nil unless CHAOS_CONFIG is set
+	g_FaultInjector *FaultInjector
 )
 
+// --- Circuit Breaker (state shared across workers via Redis) ---
+type BreakerState string
+const (
+	BREAKER_CLOSED    BreakerState = "closed"
+	BREAKER_OPEN      BreakerState = "open"
+	BREAKER_HALF_OPEN BreakerState = "half-open"
+)
+
+// CircuitOpenError is returned instead of calling the dependency while the breaker is open.
+// It is not counted as a task failure; the task is retried after RetryAfter.
+type CircuitOpenError struct {
+	Breaker    string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %q is open, retry in %s", e.Breaker, e.RetryAfter)
+}
+
+type CircuitBreaker struct {
+	rdb                  *redis.Client
+	name                 string
+	failureRateThreshold float64       // open when failures/total reaches this ratio
+	minRequests          int64         // ...and at least this many calls were seen in the window
+	window               time.Duration // length of the fixed counting window
+	probeInterval        time.Duration // time spent open before a single probe is let through
+}
+
+func NewCircuitBreaker(rdb *redis.Client, name string, failureRateThreshold float64, minRequests int64, window, probeInterval time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		rdb:                  rdb,
+		name:                 name,
+		failureRateThreshold: failureRateThreshold,
+		minRequests:          minRequests,
+		window:               window,
+		probeInterval:        probeInterval,
+	}
+}
+
+func (cb *CircuitBreaker) key(suffix string) string {
+	return "breaker:" + cb.name + ":" + suffix
+}
+
+// State reads the current breaker state; a missing key means closed.
+func (cb *CircuitBreaker) State(ctx context.Context) (BreakerState, error) {
+	state, err := cb.rdb.Get(ctx, cb.key("state")).Result()
+	if errors.Is(err, redis.Nil) {
+		return BREAKER_CLOSED, nil
+	}
+	return BreakerState(state), err
+}
+
+// Allow decides whether a call may go through. In half-open state only the
+// worker that wins the probe lock is allowed; everyone else keeps waiting.
+func (cb *CircuitBreaker) Allow(ctx context.Context) (probe bool, err error) {
+	state, err := cb.State(ctx)
+	if err != nil {
+		// Fail open: Redis trouble must not stop all image processing.
+		log.Printf("[BREAKER-WARN] %s: could not read state: %v", cb.name, err)
+		return false, nil
+	}
+	if state == BREAKER_CLOSED {
+		return false, nil
+	}
+
+	acquired, err := cb.rdb.SetNX(ctx, cb.key("probe"), "1", cb.probeInterval).Result()
+	if err != nil || !acquired {
+		ttl, _ := cb.rdb.PTTL(ctx, cb.key("probe")).Result()
+		if ttl <= 0 {
+			ttl = cb.probeInterval
+		}
+		return false, &CircuitOpenError{Breaker: cb.name, RetryAfter: ttl}
+	}
+	if err := cb.rdb.Set(ctx, cb.key("state"), string(BREAKER_HALF_OPEN), 0).Err(); err != nil {
+		return false, err
+	}
+	log.Printf("[BREAKER] %s: half-open, letting a probe through", cb.name)
+	return true, nil
+}
+
+// Open trips the breaker. The probe lock doubles as the open timer, so the
+// first probe is allowed once it expires.
+func (cb *CircuitBreaker) Open(ctx context.Context) {
+	_, err := cb.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, cb.key("state"), string(BREAKER_OPEN), 0)
+		pipe.Set(ctx, cb.key("opened_at"), time.Now().Unix(), 0)
+		pipe.Set(ctx, cb.key("probe"), "1", cb.probeInterval)
+		pipe.Del(ctx, cb.key("total"), cb.key("failures"))
+		return nil
+	})
+	if err != nil {
+		log.Printf("[BREAKER-WARN] %s: could not open: %v", cb.name, err)
+		return
+	}
+	log.Printf("[BREAKER] %s: OPEN for %s", cb.name, cb.probeInterval)
+}
+
+func (cb *CircuitBreaker) Close(ctx context.Context) {
+	if err := cb.rdb.Del(ctx, cb.key("state"), cb.key("opened_at"), cb.key("probe"), cb.key("total"), cb.key("failures")).Err(); err != nil {
+		log.Printf("[BREAKER-WARN] %s: could not close: %v", cb.name, err)
+		return
+	}
+	log.Printf("[BREAKER] %s: CLOSED", cb.name)
+}
+
+// Record reports the outcome of a call that Allow let through.
+func (cb *CircuitBreaker) Record(ctx context.Context, probe bool, callErr error) {
+	if probe {
+		if callErr != nil {
+			cb.Open(ctx)
+		} else {
+			cb.Close(ctx)
+		}
+		return
+	}
+
+	pipe := cb.rdb.TxPipeline()
+	total := pipe.Incr(ctx, cb.key("total"))
+	var failures *redis.IntCmd
+	if callErr != nil {
+		failures = pipe.Incr(ctx, cb.key("failures"))
+	} else {
+		failures = pipe.IncrBy(ctx, cb.key("failures"), 0)
+	}
+	pipe.ExpireNX(ctx, cb.key("total"), cb.window)
+	pipe.ExpireNX(ctx, cb.key("failures"), cb.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[BREAKER-WARN] %s: could not record outcome: %v", cb.name, err)
+		return
+	}
+
+	t, f := total.Val(), failures.Val()
+	if t >= cb.minRequests && float64(f)/float64(t) >= cb.failureRateThreshold {
+		cb.Open(ctx)
+	}
+}
+
+// Snapshot returns the state and current window counters for metrics/health output.
+func (cb *CircuitBreaker) Snapshot(ctx context.Context) (fiber.Map, error) {
+	state, err := cb.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := cb.rdb.MGet(ctx, cb.key("total"), cb.key("failures"), cb.key("opened_at")).Result()
+	if err != nil {
+		return nil, err
+	}
+	toInt := func(v interface{}) int64 {
+		s, _ := v.(string)
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n
+	}
+	snapshot := fiber.Map{
+		"name":                   cb.name,
+		"state":                  state,
+		"window_requests":        toInt(vals[0]),
+		"window_failures":        toInt(vals[1]),
+		"failure_rate_threshold": cb.failureRateThreshold,
+		"probe_interval_seconds": cb.probeInterval.Seconds(),
+	}
+	if openedAt := toInt(vals[2]); openedAt > 0 {
+		snapshot["opened_at"] = time.Unix(openedAt, 0).UTC()
+	}
+	return snapshot, nil
+}
+
+// --- Expedite Credits (per-user fairness via Redis) ---
+
+const (
+	PRIORITY_NORMAL   = "normal"
+	PRIORITY_EXPEDITE = "expedite"
+	QUEUE_CRITICAL    = "critical"
+)
+
+// ExpediteLimiter lets each user send at most limit jobs to the critical
+// queue per rolling window. Grants are kept in a sorted set per user ID,
+// scored by grant time, so every instance sees the same count.
+type ExpediteLimiter struct {
+	rdb    *redis.Client
+	limit  int64
+	window time.Duration
+}
+
+type ExpediteCredits struct {
+	Limit     int64      `json:"limit"`
+	Remaining int64      `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"` // when the oldest grant in the window expires
+}
+
+// expediteTakeScript trims grants older than the window, then adds one if
+// the user is under the limit. Returns {granted, used, oldest grant ms}.
+var expediteTakeScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local used = redis.call('ZCARD', KEYS[1])
+local granted = 0
+if used < tonumber(ARGV[3]) then
+  redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  used = used + 1
+  granted = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {granted, used, tonumber(oldest[2] or 0)}
+`)
+
+func NewExpediteLimiter(rdb *redis.Client, limit int64, window time.Duration) *ExpediteLimiter {
+	return &ExpediteLimiter{rdb: rdb, limit: limit, window: window}
+}
+
+func (l *ExpediteLimiter) key(userId uuid.UUID) string {
+	return "expedite:" + userId.String()
+}
+
+func (l *ExpediteLimiter) credits(used, oldestMs int64) ExpediteCredits {
+	credits := ExpediteCredits{Limit: l.limit, Remaining: l.limit - used}
+	if credits.Remaining < 0 {
+		credits.Remaining = 0
+	}
+	if oldestMs > 0 {
+		resetsAt := time.UnixMilli(oldestMs).Add(l.window).UTC()
+		credits.ResetsAt = &resetsAt
+	}
+	return credits
+}
+
+// Take spends one credit if any are left. grant identifies the credit for Refund.
+func (l *ExpediteLimiter) Take(ctx context.Context, userId uuid.UUID) (credits ExpediteCredits, grant string, err error) {
+	now := time.Now().UnixMilli()
+	grant = fmt.Sprintf("%d-%s", now, uuid.NewString())
+	res, err := expediteTakeScript.Run(ctx, l.rdb, []string{l.key(userId)}, now, l.window.Milliseconds(), l.limit, grant).Int64Slice()
+	if err != nil {
+		return ExpediteCredits{}, "", err
+	}
+	if res[0] == 0 {
+		grant = ""
+	}
+	return l.credits(res[1], res[2]), grant, nil
+}
+
+// Refund returns a credit whose job could not be enqueued.
+func (l *ExpediteLimiter) Refund(ctx context.Context, userId uuid.UUID, grant string) {
+	if err := l.rdb.ZRem(ctx, l.key(userId), grant).Err(); err != nil {
+		log.Printf("ERROR: Could not refund expedite credit for user %s: %v", userId, err)
+	}
+}
+
+// Peek reports the user's credits without spending one.
+func (l *ExpediteLimiter) Peek(ctx context.Context, userId uuid.UUID) (ExpediteCredits, error) {
+	min := strconv.FormatInt(time.Now().Add(-l.window).UnixMilli(), 10)
+	oldest, err := l.rdb.ZRangeByScoreWithScores(ctx, l.key(userId), &redis.ZRangeBy{Min: "(" + min, Max: "+inf"}).Result()
+	if err != nil {
+		return ExpediteCredits{}, err
+	}
+	if len(oldest) == 0 {
+		return l.credits(0, 0), nil
+	}
+	return l.credits(int64(len(oldest)), int64(oldest[0].Score)), nil
+}
+
+// --- Fault Injection (opt-in via CHAOS_CONFIG) ---
+// CHAOS_CONFIG holds a JSON ChaosConfig. Without it no middleware is
+// installed at all. Percentages are 0-100 and rolled independently per
+// request or delivery, e.g.
+//
+//	{"http": [{"path_prefix": "/posts/", "error_percent": 10}],
+//	 "tasks": [{"type": "image:resize", "failure_percent": 20, "duplicate_percent": 5}],
+//	 "dependencies": [{"name": "image-processing", "failure_percent": 60}]}
+
+type HTTPFaultRule struct {
+	Method         string  `json:"method"` // empty matches any method
+	PathPrefix     string  `json:"path_prefix"`
+	LatencyPercent float64 `json:"latency_percent"`
+	LatencyMs      int     `json:"latency_ms"`
+	ErrorPercent   float64 `json:"error_percent"`
+	ErrorStatus    int     `json:"error_status"` // defaults to 503
+	ResetPercent   float64 `json:"reset_percent"`
+}
+
+// TaskFaultRule injects failures into handlers of Type (empty matches any).
+// With FailAfterHandler the handler runs to completion before the failure is
+// reported, so the retry repeats work that already happened.
+type TaskFaultRule struct {
+	Type             string  `json:"type"`
+	FailurePercent   float64 `json:"failure_percent"`
+	FailAfterHandler bool    `json:"fail_after_handler"`
+	DuplicatePercent float64 `json:"duplicate_percent"`
+}
+
+// DependencyFaultRule fails calls to a remote dependency behind a circuit
+// breaker, named as the breaker is, so the breaker sees the failures.
+type DependencyFaultRule struct {
+	Name           string  `json:"name"`
+	FailurePercent float64 `json:"failure_percent"`
+}
+
+type ChaosConfig struct {
+	HTTP         []HTTPFaultRule       `json:"http"`
+	Tasks        []TaskFaultRule       `json:"tasks"`
+	Dependencies []DependencyFaultRule `json:"dependencies"`
+}
+
+var ErrInjectedFault = errors.New("chaos: injected handler failure")
+
+// Duplicates are enqueued under the original task ID plus this suffix, which
+// also keeps a duplicate from being duplicated again.
+const CHAOS_DUPLICATE_SUFFIX = ":chaos-dup"
+
+type FaultInjector struct {
+	config   ChaosConfig
+	mu       sync.Mutex
+	injected map[string]int64 // "http:latency", "task:failure", ... -> count
+}
+
+// LoadFaultInjector returns nil when CHAOS_CONFIG is unset.
+func LoadFaultInjector() *FaultInjector {
+	raw := os.Getenv("CHAOS_CONFIG")
+	if raw == "" {
+		return nil
+	}
+	var config ChaosConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		log.Fatalf("FATAL: CHAOS_CONFIG is not valid JSON: %v", err)
+	}
+	validPercent := func(p float64) bool { return p >= 0 && p <= 100 }
+	for i, r := range config.HTTP {
+		if !validPercent(r.LatencyPercent) || !validPercent(r.ErrorPercent) || !validPercent(r.ResetPercent) {
+			log.Fatalf("FATAL: CHAOS_CONFIG http rule %d: percentages must be between 0 and 100", i)
+		}
+		if r.ErrorStatus == 0 {
+			config.HTTP[i].ErrorStatus = http.StatusServiceUnavailable
+		}
+	}
+	for i, r := range config.Tasks {
+		if !validPercent(r.FailurePercent) || !validPercent(r.DuplicatePercent) {
+			log.Fatalf("FATAL: CHAOS_CONFIG task rule %d: percentages must be between 0 and 100", i)
+		}
+	}
+	for i, r := range config.Dependencies {
+		if !validPercent(r.FailurePercent) {
+			log.Fatalf("FATAL: CHAOS_CONFIG dependency rule %d: percentages must be between 0 and 100", i)
+		}
+	}
+	log.Printf("WARNING: Fault injection enabled with %d HTTP, %d task and %d dependency rules",
+		len(config.HTTP), len(config.Tasks), len(config.Dependencies))
+	return &FaultInjector{config: config, injected: make(map[string]int64)}
+}
+
+func chaosRoll(percent float64) bool {
+	return percent > 0 && rand.Float64()*100 < percent
+}
+
+func (f *FaultInjector) count(kind string) {
+	f.mu.Lock()
+	f.injected[kind]++
+	f.mu.Unlock()
+}
+
+// Snapshot returns how many faults of each kind have been injected.
+func (f *FaultInjector) Snapshot() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string]int64, len(f.injected))
+	for k, v := range f.injected {
+		out[k] = v
+	}
+	return out
+}
+
+// DependencyFault returns an error when a call to the named dependency should
+// fail. It is safe to call on a nil FaultInjector.
+func (f *FaultInjector) DependencyFault(name string) error {
+	if f == nil {
+		return nil
+	}
+	for _, r := range f.config.Dependencies {
+		if r.Name == name && chaosRoll(r.FailurePercent) {
+			f.count("dependency:" + name)
+			return fmt.Errorf("chaos: injected %s failure", name)
+		}
+	}
+	return nil
+}
+
+// HTTPMiddleware applies the first rule matching the request. Latency is
+// added before any error or reset, so both can hit the same request.
+func (f *FaultInjector) HTTPMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var rule *HTTPFaultRule
+		for i, r := range f.config.HTTP {
+			if (r.Method == "" || strings.EqualFold(r.Method, c.Method())) && strings.HasPrefix(c.Path(), r.PathPrefix) {
+				rule = &f.config.HTTP[i]
+				break
+			}
+		}
+		if rule == nil {
+			return c.Next()
+		}
+		if chaosRoll(rule.LatencyPercent) {
+			f.count("http:latency")
+			time.Sleep(time.Duration(rule.LatencyMs) * time.Millisecond)
+		}
+		if chaosRoll(rule.ResetPercent) {
+			f.count("http:reset")
+			// Drop the connection without a response; linger 0 makes the
+			// close send a RST instead of a FIN.
+			c.Context().HijackSetNoResponse(true)
+			c.Context().Hijack(func(conn net.Conn) {
+				if tcp, ok := conn.(*net.TCPConn); ok {
+					tcp.SetLinger(0)
+				}
+			})
+			return nil
+		}
+		if chaosRoll(rule.ErrorPercent) {
+			f.count("http:error")
+			c.Set("X-Chaos-Fault", "error")
+			return c.Status(rule.ErrorStatus).JSON(fiber.Map{"status": "error", "message": "Injected fault"})
+		}
+		return c.Next()
+	}
+}
+
+// TaskMiddleware fails deliveries and enqueues duplicates of successful ones
+// according to the first rule matching the task type.
+func (f *FaultInjector) TaskMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+		var rule *TaskFaultRule
+		for i, r := range f.config.Tasks {
+			if r.Type == "" || r.Type == task.Type() {
+				rule = &f.config.Tasks[i]
+				break
+			}
+		}
+		if rule == nil {
+			return next.ProcessTask(ctx, task)
+		}
+
+		fail := chaosRoll(rule.FailurePercent)
+		if fail && !rule.FailAfterHandler {
+			f.count("task:failure")
+			log.Printf("[CHAOS] Failing %s before its handler runs", task.Type())
+			return ErrInjectedFault
+		}
+		if err := next.ProcessTask(ctx, task); err != nil {
+			return err
+		}
+		if fail {
+			f.count("task:failure_after_handler")
+			log.Printf("[CHAOS] Failing %s after its handler succeeded", task.Type())
+			return ErrInjectedFault
+		}
+
+		taskId, _ := asynq.GetTaskID(ctx)
+		queue, _ := asynq.GetQueueName(ctx)
+		if !strings.HasSuffix(taskId, CHAOS_DUPLICATE_SUFFIX) && chaosRoll(rule.DuplicatePercent) {
+			dup := asynq.NewTask(task.Type(), task.Payload())
+			if _, err := g_AsynqClient.EnqueueContext(ctx, dup, asynq.Queue(queue), asynq.TaskID(taskId+CHAOS_DUPLICATE_SUFFIX)); err != nil {
+				log.Printf("[CHAOS] Could not enqueue duplicate of %s: %v", taskId, err)
+			} else {
+				f.count("task:duplicate")
+				log.Printf("[CHAOS] Enqueued a duplicate delivery of %s %s", task.Type(), taskId)
+			}
+		}
+		return nil
+	})
+}
+
 // --- Task Types and Payloads ---
 const (
 	TASK_SEND_WELCOME_EMAIL      = "email:welcome"
@@ -119,15 +602,33 @@ func HandleImageResize(ctx context.Context, task *asynq.Task) error {
 		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
 	}
 
+	probe, err := g_ImageServiceBreaker.Allow(ctx)
+	if err != nil {
+		log.Printf("[TASK-SKIP] Image service breaker open for post %s: %v", payload.PostId, err)
+		return err
+	}
+
+	err = callImageResizeService(payload)
+	g_ImageServiceBreaker.Record(ctx, probe, err)
+	if err != nil {
+		log.Printf("[TASK-FAIL] %s. Will retry.", err)
+		return err
+	}
+	log.Printf("[TASK-DONE] Image resized for post %s", payload.PostId)
+	return nil
+}
+
+// callImageResizeService stands in for the remote image processing dependency.
+func callImageResizeService(payload ImageProcessingTaskPayload) error {
 	log.Printf("[TASK-EXEC] Resizing image '%s' for post %s", payload.Source, payload.PostId)
+	if err := g_FaultInjector.DependencyFault("image-processing"); err != nil {
+		return err
+	}
 	// Simulate a flaky service with exponential backoff retry
 	if rand.Float32() < 0.4 { // 40% chance of failure
-		errMsg := "image processing service unavailable"
-		log.Printf("[TASK-FAIL] %s. Will retry.", errMsg)
-		return fmt.Errorf(errMsg)
+		return errors.New("image processing service unavailable")
 	}
 	time.Sleep(3 * time.Second)
-	log.Printf("[TASK-DONE] Image resized for post %s", payload.PostId)
 	return nil
 }
 
@@ -152,6 +653,57 @@ func HandlePeriodicAuditLog(ctx context.Context, task *asynq.Task) error {
 	return nil
 }
 
+// --- Authentication ---
+// Requests may carry HTTP Basic credentials (email and password). Requests
+// without them are anonymous; wrong ones are rejected.
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+func AuthenticateUser(email, password string) (User, error) {
+	g_DataMutex.RLock()
+	defer g_DataMutex.RUnlock()
+	for _, user := range g_UsersData {
+		if strings.EqualFold(user.Email, email) && user.IsActive &&
+			subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte(fmt.Sprintf("hashed(%s)", password))) == 1 {
+			return user, nil
+		}
+	}
+	return User{}, ErrInvalidCredentials
+}
+
+func AuthMiddleware(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderAuthorization)
+	if header == "" {
+		return c.Next()
+	}
+	email, password, ok := BasicCredentials(header)
+	user, err := AuthenticateUser(email, password)
+	if !ok || err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="api"`)
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": ErrInvalidCredentials.Error()})
+	}
+	c.Locals("currentUser", user)
+	return c.Next()
+}
+
+func BasicCredentials(header string) (email, password string, ok bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// CurrentUser returns the authenticated user; ok is false for anonymous requests.
+func CurrentUser(c *fiber.Ctx) (User, bool) {
+	user, ok := c.Locals("currentUser").(User)
+	return user, ok
+}
+
 // --- Fiber HTTP Handler Functions ---
 func CreateUserEndpoint(c *fiber.Ctx) error {
 	type CreateUserRequest struct {
@@ -190,12 +742,59 @@ func CreateUserEndpoint(c *fiber.Ctx) error {
 	return c.Status(http.StatusCreated).JSON(newUser)
 }
 
+// ProcessImageEndpoint accepts an optional {"priority": "expedite"} body.
+// Expedited jobs go to the critical queue and spend one of the authenticated
+// user's expedite credits; anonymous callers and users with none left are refused.
 func ProcessImageEndpoint(c *fiber.Ctx) error {
 	postIdParam := c.Params("id")
 	postId, err := uuid.Parse(postIdParam)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid post ID format"})
 	}
+	var req struct {
+		Priority string `json:"priority"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body"})
+		}
+	}
+	if req.Priority == "" {
+		req.Priority = PRIORITY_NORMAL
+	}
+	if req.Priority != PRIORITY_NORMAL && req.Priority != PRIORITY_EXPEDITE {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "priority must be normal or expedite"})
+	}
+	user, authenticated := CurrentUser(c)
+
+	var credits *ExpediteCredits
+	grant := ""
+	if req.Priority == PRIORITY_EXPEDITE {
+		if !authenticated {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="api"`)
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Expedited jobs require authentication"})
+		}
+		taken, g, err := g_ExpediteLimiter.Take(c.Context(), user.Id)
+		if err != nil {
+			log.Printf("ERROR: Could not check expedite credits: %v", err)
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "message": "Could not check expedite credits"})
+		}
+		if g == "" {
+			if taken.ResetsAt != nil {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(time.Until(*taken.ResetsAt).Seconds())+1))
+			}
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+				"status":           "error",
+				"message":          "No expedite credits left; retry later or submit with normal priority",
+				"expedite_credits": taken,
+			})
+		}
+		credits, grant = &taken, g
+	} else if authenticated {
+		if peeked, err := g_ExpediteLimiter.Peek(c.Context(), user.Id); err == nil {
+			credits = &peeked
+		}
+	}
 
 	// Create a mock post if it doesn't exist
 	g_DataMutex.Lock()
@@ -210,18 +809,30 @@ func ProcessImageEndpoint(c *fiber.Ctx) error {
 	watermarkTask := asynq.NewTask(TASK_PROCESS_IMAGE_WATERMARK, imgPayload)
 
 	// Enqueue the first task, with the second one chained to execute upon success
-	info, err := g_AsynqClient.Enqueue(resizeTask, asynq.ContinueWith(watermarkTask))
+	opts := []asynq.Option{asynq.ContinueWith(watermarkTask)}
+	if grant != "" {
+		opts = append(opts, asynq.Queue(QUEUE_CRITICAL))
+	}
+	info, err := g_AsynqClient.Enqueue(resizeTask, opts...)
 	if err != nil {
 		log.Printf("ERROR: Could not enqueue image processing pipeline: %v", err)
+		if grant != "" {
+			g_ExpediteLimiter.Refund(c.Context(), user.Id, grant)
+		}
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to start processing job"})
 	}
 
-	return c.Status(http.StatusAccepted).JSON(fiber.Map{
-		"status":  "success",
-		"message": "Image processing pipeline initiated",
-		"job_id":  info.ID,
-		"queue":   info.Queue,
-	})
+	resp := fiber.Map{
+		"status":   "success",
+		"message":  "Image processing pipeline initiated",
+		"job_id":   info.ID,
+		"queue":    info.Queue,
+		"priority": req.Priority,
+	}
+	if credits != nil {
+		resp["expedite_credits"] = credits
+	}
+	return c.Status(http.StatusAccepted).JSON(resp)
 }
 
 func GetJobStatusEndpoint(c *fiber.Ctx) error {
@@ -243,6 +854,41 @@ func GetJobStatusEndpoint(c *fiber.Ctx) error {
 	})
 }
 
+func MetricsEndpoint(c *fiber.Ctx) error {
+	breaker, err := g_ImageServiceBreaker.Snapshot(c.Context())
+	if err != nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "message": "Could not read breaker state"})
+	}
+	resp := fiber.Map{
+		"circuit_breakers": []fiber.Map{breaker},
+	}
+	if g_FaultInjector != nil {
+		resp["injected_faults"] = g_FaultInjector.Snapshot()
+	}
+	return c.JSON(resp)
+}
+
+func HealthEndpoint(c *fiber.Ctx) error {
+	if err := g_RedisClient.Ping(c.Context()).Err(); err != nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"status": "down", "redis": err.Error()})
+	}
+	state, err := g_ImageServiceBreaker.State(c.Context())
+	if err != nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"status": "down", "redis": err.Error()})
+	}
+	// An open breaker degrades image processing but the service itself stays up.
+	status := "ok"
+	if state != BREAKER_CLOSED {
+		status = "degraded"
+	}
+	return c.JSON(fiber.Map{
+		"status": status,
+		"dependencies": fiber.Map{
+			"image_processing_service": state,
+		},
+	})
+}
+
 // --- Main Function ---
 func main() {
 	log.Println("Application starting...")
@@ -252,6 +898,20 @@ func main() {
 	g_AsynqClient = asynq.NewClient(redisConnectionOpt)
 	defer g_AsynqClient.Close()
 	g_AsynqInspector = asynq.NewInspector(redisConnectionOpt)
+	g_RedisClient = redis.NewClient(&redis.Options{Addr: RedisAddress})
+	defer g_RedisClient.Close()
+	// Trip at a 50% failure rate over at least 10 calls per minute; probe every 30s while open.
+	g_ImageServiceBreaker = NewCircuitBreaker(g_RedisClient, "image-processing", 0.5, 10, time.Minute, 30*time.Second)
+	expeditePerHour := int64(5)
+	if v := os.Getenv("EXPEDITE_JOBS_PER_HOUR"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			log.Fatalf("FATAL: EXPEDITE_JOBS_PER_HOUR must be a non-negative integer, got %q", v)
+		}
+		expeditePerHour = n
+	}
+	g_ExpediteLimiter = NewExpediteLimiter(g_RedisClient, expeditePerHour, time.Hour)
+	g_FaultInjector = LoadFaultInjector()
 
 	// --- Start Asynq Worker Server in a Goroutine ---
 	go func() {
@@ -265,10 +925,26 @@ func main() {
 					"default":  3,
 					"low":      1,
 				},
+				// Short-circuited tasks wait for the breaker instead of the usual backoff...
+				RetryDelayFunc: func(n int, err error, task *asynq.Task) time.Duration {
+					var openErr *CircuitOpenError
+					if errors.As(err, &openErr) {
+						return openErr.RetryAfter + time.Duration(rand.Intn(5))*time.Second
+					}
+					return asynq.DefaultRetryDelayFunc(n, err, task)
+				},
+				// ...and do not use up their retry budget while they wait.
+				IsFailure: func(err error) bool {
+					var openErr *CircuitOpenError
+					return !errors.As(err, &openErr)
+				},
 			},
 		)
 
 		taskMux := asynq.NewServeMux()
+		if g_FaultInjector != nil {
+			taskMux.Use(g_FaultInjector.TaskMiddleware)
+		}
 		taskMux.HandleFunc(TASK_SEND_WELCOME_EMAIL, HandleSendWelcomeEmail)
 		taskMux.HandleFunc(TASK_PROCESS_IMAGE_RESIZE, HandleImageResize)
 		taskMux.HandleFunc(TASK_PROCESS_IMAGE_WATERMARK, HandleImageWatermark)
@@ -297,9 +973,15 @@ func main() {
 
 	// --- Setup and Start Fiber Web Server ---
 	webApp := fiber.New()
+	if g_FaultInjector != nil {
+		webApp.Use(g_FaultInjector.HTTPMiddleware())
+	}
+	webApp.Use(AuthMiddleware)
 	webApp.Post("/users", CreateUserEndpoint)
 	webApp.Post("/posts/:id/process-image", ProcessImageEndpoint)
 	webApp.Get("/jobs/:id", GetJobStatusEndpoint)
+	webApp.Get("/metrics", MetricsEndpoint)
+	webApp.Get("/health", HealthEndpoint)
 
 	// --- Graceful Shutdown Handling ---
 	quitChannel := make(chan os.Signal, 1)
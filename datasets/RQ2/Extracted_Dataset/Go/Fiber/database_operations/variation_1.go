@@ -1,14 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -102,6 +105,16 @@ func main() {
 	// Transactional Route
 	app.Post("/users/onboarding", onboardUserWithPost(db))
 
+	// Role Management Routes
+	app.Post("/users/:id/roles", assignUserRole(db))
+	app.Delete("/users/:id/roles/:roleId", unassignUserRole(db))
+	admin := app.Group("/admin")
+	admin.Post("/roles", createRole(db))
+	admin.Get("/roles", listRoles(db))
+	admin.Post("/roles/:id/assign", bulkAssignRole(db))
+	admin.Post("/roles/:id/unassign", bulkUnassignRole(db))
+	admin.Get("/roles/:id/users", listRoleUsers(db))
+
 	// In a real app, you would run:
 	// log.Fatal(app.Listen(":3000"))
 	fmt.Println("Server routes are configured. This is a runnable example.")
@@ -279,4 +292,263 @@ func onboardUserWithPost(db *gorm.DB) fiber.Handler {
 		db.Preload("Posts").Preload("Roles").First(&user, "id = ?", user.ID)
 		return c.Status(fiber.StatusCreated).JSON(user)
 	}
-}
\ No newline at end of file
+}
+
+// --- Role Management Handlers ---
+
+// maxBulkRoleUsers bounds a single bulk request so one transaction stays short.
+const maxBulkRoleUsers = 1000
+
+// userRoleRow maps directly onto the user_roles join table created for User.Roles.
+type userRoleRow struct {
+	UserID uuid.UUID `gorm:"column:user_id"`
+	RoleID uuid.UUID `gorm:"column:role_id"`
+}
+
+// createRole adds a new role; names are stored upper-case like the seeded ones.
+func createRole(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := new(struct {
+			Name string `json:"name"`
+		})
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON"})
+		}
+		name := strings.ToUpper(strings.TrimSpace(req.Name))
+		if name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role name is required"})
+		}
+
+		var existing int64
+		db.Model(&Role{}).Where("name = ?", name).Count(&existing)
+		if existing > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role already exists"})
+		}
+
+		role := Role{Name: name}
+		if err := db.Create(&role).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create role"})
+		}
+		return c.Status(fiber.StatusCreated).JSON(role)
+	}
+}
+
+// listRoles returns every role along with how many users hold it.
+func listRoles(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var roles []struct {
+			ID        uuid.UUID `json:"id"`
+			Name      string    `json:"name"`
+			UserCount int64     `json:"user_count"`
+		}
+		err := db.Model(&Role{}).
+			Select("roles.id, roles.name, COUNT(user_roles.user_id) AS user_count").
+			Joins("LEFT JOIN user_roles ON user_roles.role_id = roles.id").
+			Group("roles.id, roles.name").
+			Order("roles.name").
+			Scan(&roles).Error
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not fetch roles"})
+		}
+		return c.JSON(roles)
+	}
+}
+
+// assignUserRole gives a single user a role. Assigning a role twice is a no-op.
+func assignUserRole(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		}
+		req := new(struct {
+			RoleID string `json:"role_id"`
+		})
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse JSON"})
+		}
+		roleID, err := uuid.Parse(req.RoleID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid role id"})
+		}
+
+		var user User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+		}
+		var role Role
+		if err := db.First(&role, "id = ?", roleID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		}
+
+		row := userRoleRow{UserID: user.ID, RoleID: role.ID}
+		if err := db.Table("user_roles").Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not assign role"})
+		}
+
+		db.Preload("Roles").First(&user, "id = ?", user.ID)
+		return c.JSON(user)
+	}
+}
+
+// unassignUserRole removes a role from a single user.
+func unassignUserRole(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		result := db.Table("user_roles").
+			Where("user_id = ? AND role_id = ?", c.Params("id"), c.Params("roleId")).
+			Delete(&userRoleRow{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": result.Error.Error()})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user does not have this role"})
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// parseBulkUserIDs reads {"user_ids": [...]} and rejects malformed or oversized lists.
+func parseBulkUserIDs(c *fiber.Ctx) ([]uuid.UUID, error) {
+	req := new(struct {
+		UserIDs []string `json:"user_ids"`
+	})
+	if err := c.BodyParser(req); err != nil {
+		return nil, errors.New("cannot parse JSON")
+	}
+	if len(req.UserIDs) == 0 {
+		return nil, errors.New("user_ids must not be empty")
+	}
+	if len(req.UserIDs) > maxBulkRoleUsers {
+		return nil, fmt.Errorf("at most %d user_ids per request", maxBulkRoleUsers)
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.UserIDs))
+	ids := make([]uuid.UUID, 0, len(req.UserIDs))
+	for _, raw := range req.UserIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id %q", raw)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// bulkAssignRole assigns a role to many users in one transaction: if any user
+// does not exist, nothing is assigned.
+func bulkAssignRole(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var role Role
+		if err := db.First(&role, "id = ?", c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		}
+		userIDs, err := parseBulkUserIDs(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		var assigned, alreadyAssigned int64
+		var missing []uuid.UUID
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var found []uuid.UUID
+			if err := tx.Model(&User{}).Where("id IN ?", userIDs).Pluck("id", &found).Error; err != nil {
+				return err
+			}
+			if len(found) != len(userIDs) {
+				exists := make(map[uuid.UUID]bool, len(found))
+				for _, id := range found {
+					exists[id] = true
+				}
+				for _, id := range userIDs {
+					if !exists[id] {
+						missing = append(missing, id)
+					}
+				}
+				return gorm.ErrRecordNotFound // Rollback
+			}
+
+			rows := make([]userRoleRow, len(userIDs))
+			for i, id := range userIDs {
+				rows[i] = userRoleRow{UserID: id, RoleID: role.ID}
+			}
+			result := tx.Table("user_roles").Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+			if result.Error != nil {
+				return result.Error // Rollback
+			}
+			assigned = result.RowsAffected
+			alreadyAssigned = int64(len(userIDs)) - assigned
+			return nil // Commit
+		})
+
+		if len(missing) > 0 {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "some users do not exist", "missing_user_ids": missing})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "transaction failed: " + err.Error()})
+		}
+		return c.JSON(fiber.Map{"role_id": role.ID, "assigned": assigned, "already_assigned": alreadyAssigned})
+	}
+}
+
+// bulkUnassignRole removes a role from many users in one statement.
+func bulkUnassignRole(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var role Role
+		if err := db.First(&role, "id = ?", c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		}
+		userIDs, err := parseBulkUserIDs(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		result := db.Table("user_roles").Where("role_id = ? AND user_id IN ?", role.ID, userIDs).Delete(&userRoleRow{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": result.Error.Error()})
+		}
+		return c.JSON(fiber.Map{"role_id": role.ID, "unassigned": result.RowsAffected})
+	}
+}
+
+// listRoleUsers pages through the users holding a role, oldest first.
+func listRoleUsers(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var role Role
+		if err := db.First(&role, "id = ?", c.Params("id")).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		}
+
+		page := c.QueryInt("page", 1)
+		if page < 1 {
+			page = 1
+		}
+		pageSize := c.QueryInt("page_size", 20)
+		if pageSize < 1 || pageSize > 100 {
+			pageSize = 20
+		}
+
+		query := db.Model(&User{}).
+			Joins("JOIN user_roles ON user_roles.user_id = users.id").
+			Where("user_roles.role_id = ?", role.ID)
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not count users"})
+		}
+		var users []User
+		if err := query.Order("users.created_at, users.id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not fetch users"})
+		}
+
+		return c.JSON(fiber.Map{
+			"role":      role,
+			"data":      users,
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		})
+	}
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -34,14 +42,30 @@ type PostStatus string
 const (
 	Draft     PostStatus = "DRAFT"
 	Published PostStatus = "PUBLISHED"
+	Archived  PostStatus = "ARCHIVED"
 )
 
 type Post struct {
-	ID      uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
-	UserID  uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"`
-	Title   string     `gorm:"not null" json:"title"`
-	Content string     `gorm:"type:text" json:"content"`
-	Status  PostStatus `gorm:"type:varchar(20);default:'DRAFT'" json:"status"`
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"`
+	Title     string     `gorm:"not null" json:"title"`
+	Content   string     `gorm:"type:text" json:"content"`
+	Status    PostStatus `gorm:"type:varchar(20);default:'DRAFT'" json:"status"`
+	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// ArchivedPost is a post moved out of the hot posts table. Archived rows live
+// in their own table, clustered by author and archive time, so the hot
+// listing's scans and indexes only ever cover live posts.
+type ArchivedPost struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index:idx_archived_user_time,priority:1" json:"user_id"`
+	Title          string     `gorm:"not null" json:"title"`
+	Content        string     `gorm:"type:text" json:"content"`
+	Status         PostStatus `gorm:"type:varchar(20);default:'ARCHIVED'" json:"status"`
+	PreviousStatus PostStatus `gorm:"type:varchar(20)" json:"previous_status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ArchivedAt     time.Time  `gorm:"not null;index;index:idx_archived_user_time,priority:2" json:"archived_at"`
 }
 
 // GORM Hooks
@@ -50,7 +74,9 @@ func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 func (p *Post) BeforeCreate(tx *gorm.DB) (err error) {
-	p.ID = uuid.New()
+	if p.ID == uuid.Nil { // restored posts keep their ID
+		p.ID = uuid.New()
+	}
 	return
 }
 func (r *Role) BeforeCreate(tx *gorm.DB) (err error) {
@@ -58,6 +84,38 @@ func (r *Role) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "PENDING"
+	ExportRunning ExportStatus = "RUNNING"
+	ExportReady   ExportStatus = "READY"
+	ExportFailed  ExportStatus = "FAILED"
+)
+
+// ExportJob tracks a background post export. Cursor, ChunksDone and
+// RowsExported are checkpointed after every chunk so an interrupted export
+// resumes where it stopped.
+type ExportJob struct {
+	ID           uuid.UUID    `gorm:"type:uuid;primary_key;" json:"id"`
+	RequestedBy  string       `gorm:"not null" json:"requested_by"`
+	Filter       string       `gorm:"type:text" json:"-"`
+	ChunkSize    int          `json:"chunk_size"`
+	Status       ExportStatus `gorm:"type:varchar(20);index" json:"status"`
+	Cursor       string       `json:"-"`
+	ChunksDone   int          `json:"chunks_done"`
+	RowsExported int64        `json:"rows_exported"`
+	FilePath     string       `json:"-"`
+	Error        string       `json:"error,omitempty"`
+	CreatedAt    time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	CompletedAt  *time.Time   `json:"completed_at,omitempty"`
+}
+
+func (j *ExportJob) BeforeCreate(tx *gorm.DB) (err error) {
+	j.ID = uuid.New()
+	return
+}
+
 // --- Data Store ---
 
 type DataStore struct {
@@ -73,7 +131,7 @@ func NewDataStore() (*DataStore, error) {
 	}
 
 	// Migration
-	err = db.AutoMigrate(&User{}, &Post{}, &Role{})
+	err = db.AutoMigrate(&User{}, &Post{}, &ArchivedPost{}, &Role{}, &ExportJob{})
 	if err != nil {
 		return nil, fmt.Errorf("database migration failed: %w", err)
 	}
@@ -86,6 +144,271 @@ func NewDataStore() (*DataStore, error) {
 	return &DataStore{DB: db}, nil
 }
 
+// ArchivePosts moves the given posts into archived_posts and reports how many
+// were moved. IDs that are not live posts are skipped.
+func (s *DataStore) ArchivePosts(ids []uuid.UUID, now time.Time) (int64, error) {
+	var moved int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var posts []Post
+		if err := tx.Where("id IN ?", ids).Find(&posts).Error; err != nil {
+			return err
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+		rows := make([]ArchivedPost, len(posts))
+		for i, p := range posts {
+			rows[i] = ArchivedPost{
+				ID:             p.ID,
+				UserID:         p.UserID,
+				Title:          p.Title,
+				Content:        p.Content,
+				Status:         Archived,
+				PreviousStatus: p.Status,
+				CreatedAt:      p.CreatedAt,
+				ArchivedAt:     now,
+			}
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+		res := tx.Where("id IN ?", ids).Delete(&Post{})
+		moved = res.RowsAffected
+		return res.Error
+	})
+	return moved, err
+}
+
+// RestorePost moves an archived post back into the posts table with the
+// status it had when it was archived.
+func (s *DataStore) RestorePost(id uuid.UUID) (*Post, error) {
+	var post Post
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var archived ArchivedPost
+		if err := tx.First(&archived, "id = ?", id).Error; err != nil {
+			return err
+		}
+		post = Post{
+			ID:        archived.ID,
+			UserID:    archived.UserID,
+			Title:     archived.Title,
+			Content:   archived.Content,
+			Status:    archived.PreviousStatus,
+			CreatedAt: archived.CreatedAt,
+		}
+		if post.Status == "" {
+			post.Status = Draft
+		}
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&archived).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// --- Auto-Archival ---
+
+// PostArchiver periodically archives posts created more than MaxAge ago,
+// BatchSize at a time so no single transaction grows unbounded.
+type PostArchiver struct {
+	Store     *DataStore
+	MaxAge    time.Duration
+	Interval  time.Duration
+	BatchSize int
+}
+
+func (a *PostArchiver) Start() {
+	go func() {
+		ticker := time.NewTicker(a.Interval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if n, err := a.RunOnce(time.Now()); err != nil {
+				log.Printf("post archival failed after %d posts: %v", n, err)
+			} else if n > 0 {
+				log.Printf("archived %d posts older than %s", n, a.MaxAge)
+			}
+		}
+	}()
+}
+
+func (a *PostArchiver) RunOnce(now time.Time) (int64, error) {
+	cutoff := now.Add(-a.MaxAge)
+	var total int64
+	for {
+		var ids []uuid.UUID
+		if err := a.Store.DB.Model(&Post{}).Where("created_at < ?", cutoff).
+			Order("created_at").Limit(a.BatchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		n, err := a.Store.ArchivePosts(ids, now)
+		total += n
+		if err != nil || len(ids) < a.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// --- Parameter Binding ---
+
+type ParamSource string
+
+const (
+	InPath  ParamSource = "path"
+	InQuery ParamSource = "query"
+)
+
+type ParamKind int
+
+const (
+	ParamString ParamKind = iota
+	ParamInt
+	ParamBool
+	ParamUUID
+	ParamEnum
+)
+
+// ParamSpec declares one path or query parameter. Path parameters are always
+// required. Max of zero leaves an int unbounded above; Hint is appended to
+// the reason when a value is rejected.
+type ParamSpec struct {
+	Name     string
+	In       ParamSource
+	Kind     ParamKind
+	Required bool
+	Default  string
+	Min, Max int
+	Enum     []string
+	Hint     string
+}
+
+type ParamError struct {
+	Name   string      `json:"name"`
+	In     ParamSource `json:"in"`
+	Value  string      `json:"value,omitempty"`
+	Reason string      `json:"reason"`
+}
+
+type ParamErrors []ParamError
+
+func (e ParamErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, pe := range e {
+		parts[i] = fmt.Sprintf("%s %s", pe.Name, pe.Reason)
+	}
+	return "invalid parameters: " + strings.Join(parts, "; ")
+}
+
+// Params holds bound values, typed according to their spec. Optional
+// parameters that were absent and have no default are not present.
+type Params map[string]interface{}
+
+func (p Params) Has(name string) bool       { _, ok := p[name]; return ok }
+func (p Params) String(name string) string  { s, _ := p[name].(string); return s }
+func (p Params) Int(name string) int        { n, _ := p[name].(int); return n }
+func (p Params) Bool(name string) bool      { b, _ := p[name].(bool); return b }
+func (p Params) UUID(name string) uuid.UUID { id, _ := p[name].(uuid.UUID); return id }
+
+// bindParams reads and validates every spec, collecting all failures rather
+// than stopping at the first.
+func bindParams(c *fiber.Ctx, specs ...ParamSpec) (Params, error) {
+	params := make(Params, len(specs))
+	var errs ParamErrors
+	for _, spec := range specs {
+		raw := c.Query(spec.Name)
+		if spec.In == InPath {
+			raw = c.Params(spec.Name)
+		}
+		if raw == "" {
+			if spec.Required || spec.In == InPath {
+				errs = append(errs, ParamError{Name: spec.Name, In: spec.In, Reason: "is required"})
+				continue
+			}
+			if spec.Default == "" {
+				continue
+			}
+			raw = spec.Default
+		}
+		v, reason := spec.convert(raw)
+		if reason != "" {
+			if spec.Hint != "" {
+				reason += " (" + spec.Hint + ")"
+			}
+			errs = append(errs, ParamError{Name: spec.Name, In: spec.In, Value: raw, Reason: reason})
+			continue
+		}
+		params[spec.Name] = v
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return params, nil
+}
+
+func (spec ParamSpec) convert(raw string) (interface{}, string) {
+	switch spec.Kind {
+	case ParamInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, "must be an integer"
+		}
+		if n < spec.Min || (spec.Max != 0 && n > spec.Max) {
+			if spec.Max == 0 {
+				return nil, fmt.Sprintf("must be at least %d", spec.Min)
+			}
+			return nil, fmt.Sprintf("must be between %d and %d", spec.Min, spec.Max)
+		}
+		return n, ""
+	case ParamBool:
+		if raw != "true" && raw != "false" {
+			return nil, "must be true or false"
+		}
+		return raw == "true", ""
+	case ParamUUID:
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, "must be a UUID"
+		}
+		return id, ""
+	case ParamEnum:
+		for _, allowed := range spec.Enum {
+			if raw == allowed {
+				return raw, ""
+			}
+		}
+		return nil, "must be one of " + strings.Join(spec.Enum, ", ")
+	default:
+		return raw, ""
+	}
+}
+
+// paramError writes the 400 for a failed bindParams.
+func paramError(c *fiber.Ctx, err error) error {
+	var errs ParamErrors
+	if !errors.As(err, &errs) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid parameters", "params": errs})
+}
+
+var (
+	pageParams = []ParamSpec{
+		{Name: "limit", In: InQuery, Kind: ParamInt, Default: "100", Min: 1, Max: 1000},
+		{Name: "offset", In: InQuery, Kind: ParamInt, Default: "0", Min: 0},
+	}
+	idPathParam = ParamSpec{Name: "id", In: InPath, Kind: ParamUUID}
+)
+
+func withPage(specs ...ParamSpec) []ParamSpec {
+	return append(specs, pageParams...)
+}
+
 // --- Modular Route Handlers ---
 
 // UserModule encapsulates all user-related handlers and dependencies.
@@ -116,24 +439,33 @@ func (m *UserModule) createUser(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
+var listUsersParams = withPage(
+	ParamSpec{Name: "is_active", In: InQuery, Kind: ParamBool},
+	ParamSpec{Name: "role", In: InQuery, Kind: ParamString},
+)
+
 func (m *UserModule) findUsersWithQueryBuilder(c *fiber.Ctx) error {
+	p, err := bindParams(c, listUsersParams...)
+	if err != nil {
+		return paramError(c, err)
+	}
 	var users []User
 	
 	// Dynamic Query Building
 	query := m.Store.DB.Model(&User{})
 	
-	if isActive := c.Query("is_active"); isActive != "" {
-		query = query.Where("is_active = ?", isActive == "true")
+	if p.Has("is_active") {
+		query = query.Where("is_active = ?", p.Bool("is_active"))
 	}
 	
-	if roleName := c.Query("role"); roleName != "" {
+	if roleName := p.String("role"); roleName != "" {
 		// Subquery to filter users by role name
 		query = query.Joins("JOIN user_roles on user_roles.user_id = users.id").
 			Joins("JOIN roles on roles.id = user_roles.role_id").
 			Where("roles.name = ?", roleName)
 	}
 
-	if err := query.Preload("Roles").Distinct().Find(&users).Error; err != nil {
+	if err := query.Preload("Roles").Distinct().Order("users.id").Limit(p.Int("limit")).Offset(p.Int("offset")).Find(&users).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	
@@ -217,6 +549,401 @@ func (m *UserModule) assignRoleToUser(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// PostFilter is the filter spec shared by the post list endpoint (as query
+// params) and the export endpoint (as JSON).
+type PostFilter struct {
+	Status        PostStatus `query:"status" json:"status,omitempty"`
+	UserID        string     `query:"user_id" json:"user_id,omitempty"`
+	TitleContains string     `query:"q" json:"q,omitempty"`
+	AuthorActive  string     `query:"author_active" json:"author_active,omitempty"`
+	AuthorRole    string     `query:"author_role" json:"author_role,omitempty"`
+}
+
+func (f PostFilter) Validate() error {
+	if f.Status == Archived {
+		return fmt.Errorf("archived posts are listed at /posts/archived")
+	}
+	if f.Status != "" && f.Status != Draft && f.Status != Published {
+		return fmt.Errorf("status must be %s or %s", Draft, Published)
+	}
+	if f.UserID != "" {
+		if _, err := uuid.Parse(f.UserID); err != nil {
+			return fmt.Errorf("user_id must be a UUID")
+		}
+	}
+	if f.AuthorActive != "" && f.AuthorActive != "true" && f.AuthorActive != "false" {
+		return fmt.Errorf("author_active must be true or false")
+	}
+	return nil
+}
+
+// Apply adds the filter's conditions to a query on the posts table.
+func (f PostFilter) Apply(query *gorm.DB) *gorm.DB {
+	if f.Status != "" {
+		query = query.Where("posts.status = ?", f.Status)
+	}
+	if f.UserID != "" {
+		query = query.Where("posts.user_id = ?", f.UserID)
+	}
+	if f.TitleContains != "" {
+		query = query.Where("posts.title LIKE ?", "%"+f.TitleContains+"%")
+	}
+	if f.AuthorActive != "" || f.AuthorRole != "" {
+		query = query.Joins("JOIN users on users.id = posts.user_id")
+	}
+	if f.AuthorActive != "" {
+		query = query.Where("users.is_active = ?", f.AuthorActive == "true")
+	}
+	if f.AuthorRole != "" {
+		query = query.Joins("JOIN user_roles on user_roles.user_id = users.id").
+			Joins("JOIN roles on roles.id = user_roles.role_id").
+			Where("roles.name = ?", f.AuthorRole)
+	}
+	return query
+}
+
+// PostModule encapsulates post listing and export handlers.
+type PostModule struct {
+	Store    *DataStore
+	Exporter *PostExporter
+}
+
+func (m *PostModule) Register(router fiber.Router) {
+	router.Get("/", m.findPostsWithQueryBuilder)
+	router.Post("/export", m.createExport)
+	router.Get("/exports/:id", m.getExport)
+	router.Get("/exports/:id/download", m.downloadExport)
+	router.Post("/:id/archive", m.archivePost)
+	router.Get("/archived", m.listArchivedPosts)
+	router.Post("/archived/:id/restore", m.restorePost)
+}
+
+func (m *PostModule) archivePost(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid post ID"})
+	}
+	moved, err := m.Store.ArchivePosts([]uuid.UUID{id}, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if moved == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "post not found or already archived"})
+	}
+	var archived ArchivedPost
+	m.Store.DB.First(&archived, "id = ?", id)
+	return c.JSON(archived)
+}
+
+func (m *PostModule) restorePost(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid post ID"})
+	}
+	post, err := m.Store.RestorePost(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "archived post not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(post)
+}
+
+var listArchivedParams = withPage(ParamSpec{Name: "user_id", In: InQuery, Kind: ParamUUID})
+
+// listArchivedPosts reads only archived_posts, newest archive first.
+func (m *PostModule) listArchivedPosts(c *fiber.Ctx) error {
+	p, err := bindParams(c, listArchivedParams...)
+	if err != nil {
+		return paramError(c, err)
+	}
+	query := m.Store.DB.Model(&ArchivedPost{})
+	if p.Has("user_id") {
+		query = query.Where("user_id = ?", p.UUID("user_id"))
+	}
+	var posts []ArchivedPost
+	if err := query.Order("archived_at DESC, id").Limit(p.Int("limit")).Offset(p.Int("offset")).Find(&posts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(posts)
+}
+
+// listPostsParams mirrors PostFilter's query tags.
+var listPostsParams = withPage(
+	ParamSpec{Name: "status", In: InQuery, Kind: ParamEnum, Enum: []string{string(Draft), string(Published)},
+		Hint: "archived posts are listed at /posts/archived"},
+	ParamSpec{Name: "user_id", In: InQuery, Kind: ParamUUID},
+	ParamSpec{Name: "q", In: InQuery, Kind: ParamString},
+	ParamSpec{Name: "author_active", In: InQuery, Kind: ParamBool},
+	ParamSpec{Name: "author_role", In: InQuery, Kind: ParamString},
+)
+
+func (m *PostModule) findPostsWithQueryBuilder(c *fiber.Ctx) error {
+	p, err := bindParams(c, listPostsParams...)
+	if err != nil {
+		return paramError(c, err)
+	}
+	filter := PostFilter{
+		Status:        PostStatus(p.String("status")),
+		TitleContains: p.String("q"),
+		AuthorRole:    p.String("author_role"),
+	}
+	if p.Has("user_id") {
+		filter.UserID = p.UUID("user_id").String()
+	}
+	if p.Has("author_active") {
+		filter.AuthorActive = strconv.FormatBool(p.Bool("author_active"))
+	}
+
+	var posts []Post
+	query := filter.Apply(m.Store.DB.Model(&Post{})).Select("posts.*")
+	if err := query.Order("posts.id").Limit(p.Int("limit")).Offset(p.Int("offset")).Find(&posts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(posts)
+}
+
+func (m *PostModule) createExport(c *fiber.Ctx) error {
+	var input struct {
+		Filter      PostFilter `json:"filter"`
+		RequestedBy string     `json:"requested_by"`
+		ChunkSize   int        `json:"chunk_size"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+	}
+	if input.RequestedBy == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "requested_by is required"})
+	}
+	if err := input.Filter.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.ChunkSize <= 0 {
+		input.ChunkSize = 1000
+	} else if input.ChunkSize > 10000 {
+		input.ChunkSize = 10000
+	}
+
+	filter, _ := json.Marshal(input.Filter)
+	job := ExportJob{
+		RequestedBy: input.RequestedBy,
+		Filter:      string(filter),
+		ChunkSize:   input.ChunkSize,
+		Status:      ExportPending,
+	}
+	if err := m.Store.DB.Create(&job).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	m.Exporter.Enqueue(job.ID)
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func (m *PostModule) getExport(c *fiber.Ctx) error {
+	p, err := bindParams(c, idPathParam)
+	if err != nil {
+		return paramError(c, err)
+	}
+	var job ExportJob
+	if err := m.Store.DB.First(&job, "id = ?", p.UUID("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "export not found"})
+	}
+	return c.JSON(job)
+}
+
+func (m *PostModule) downloadExport(c *fiber.Ctx) error {
+	p, err := bindParams(c, idPathParam)
+	if err != nil {
+		return paramError(c, err)
+	}
+	var job ExportJob
+	if err := m.Store.DB.First(&job, "id = ?", p.UUID("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "export not found"})
+	}
+	if job.Status != ExportReady {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "export is " + string(job.Status)})
+	}
+	return c.Download(job.FilePath, "posts-"+job.ID.String()+".csv")
+}
+
+// --- Background Export ---
+
+// Notifier tells the requester an export has finished.
+type Notifier interface {
+	Notify(recipient, subject, body string) error
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(recipient, subject, body string) error {
+	log.Printf("NOTIFY %s: %s - %s", recipient, subject, body)
+	return nil
+}
+
+var exportCSVHeader = []string{"id", "user_id", "title", "content", "status"}
+
+// PostExporter runs export jobs on a fixed pool of workers. Each job pages
+// through the filtered posts by id, writes every page to its own chunk file,
+// and concatenates the chunks once the last page is written.
+type PostExporter struct {
+	Store    *DataStore
+	Dir      string
+	Notifier Notifier
+	queue    chan uuid.UUID
+}
+
+func NewPostExporter(store *DataStore, dir string, notifier Notifier, workers int) (*PostExporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create export dir: %w", err)
+	}
+	e := &PostExporter{Store: store, Dir: dir, Notifier: notifier, queue: make(chan uuid.UUID, 100)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for id := range e.queue {
+				e.run(id)
+			}
+		}()
+	}
+	return e, nil
+}
+
+func (e *PostExporter) Enqueue(id uuid.UUID) {
+	e.queue <- id
+}
+
+// Resume re-enqueues exports that were pending or mid-way when the process
+// last stopped.
+func (e *PostExporter) Resume() {
+	var jobs []ExportJob
+	e.Store.DB.Where("status IN ?", []ExportStatus{ExportPending, ExportRunning}).Order("created_at").Find(&jobs)
+	for _, job := range jobs {
+		log.Printf("Resuming export %s at chunk %d", job.ID, job.ChunksDone+1)
+		e.Enqueue(job.ID)
+	}
+}
+
+func (e *PostExporter) run(id uuid.UUID) {
+	var job ExportJob
+	if err := e.Store.DB.First(&job, "id = ?", id).Error; err != nil {
+		log.Printf("Export %s: %v", id, err)
+		return
+	}
+	if err := e.export(&job); err != nil {
+		job.Status, job.Error = ExportFailed, err.Error()
+		e.Store.DB.Model(&job).Select("Status", "Error").Updates(&job)
+		e.Notifier.Notify(job.RequestedBy, "Your post export failed", err.Error())
+		return
+	}
+	e.Notifier.Notify(job.RequestedBy, "Your post export is ready",
+		fmt.Sprintf("%d posts exported. Download: /api/v1/posts/exports/%s/download", job.RowsExported, job.ID))
+}
+
+func (e *PostExporter) export(job *ExportJob) error {
+	var filter PostFilter
+	if err := json.Unmarshal([]byte(job.Filter), &filter); err != nil {
+		return fmt.Errorf("decode filter: %w", err)
+	}
+	job.Status = ExportRunning
+	if err := e.Store.DB.Model(job).Update("status", job.Status).Error; err != nil {
+		return err
+	}
+
+	chunkDir := filepath.Join(e.Dir, job.ID.String())
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		return err
+	}
+	for {
+		var posts []Post
+		query := filter.Apply(e.Store.DB.Model(&Post{})).Select("posts.*")
+		if job.Cursor != "" {
+			query = query.Where("posts.id > ?", job.Cursor)
+		}
+		if err := query.Order("posts.id").Limit(job.ChunkSize).Find(&posts).Error; err != nil {
+			return fmt.Errorf("read chunk %d: %w", job.ChunksDone+1, err)
+		}
+		if len(posts) == 0 {
+			break
+		}
+		// A chunk written before a crash but not checkpointed is simply
+		// rewritten under the same name.
+		if err := writeChunk(filepath.Join(chunkDir, chunkName(job.ChunksDone+1)), posts); err != nil {
+			return err
+		}
+		job.Cursor = posts[len(posts)-1].ID.String()
+		job.ChunksDone++
+		job.RowsExported += int64(len(posts))
+		if err := e.Store.DB.Model(job).Select("Cursor", "ChunksDone", "RowsExported").Updates(job).Error; err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+
+	path := filepath.Join(e.Dir, job.ID.String()+".csv")
+	if err := assembleChunks(path, chunkDir, job.ChunksDone); err != nil {
+		return err
+	}
+	os.RemoveAll(chunkDir)
+
+	now := time.Now()
+	job.Status, job.FilePath, job.CompletedAt = ExportReady, path, &now
+	return e.Store.DB.Model(job).Select("Status", "FilePath", "CompletedAt").Updates(job).Error
+}
+
+func chunkName(n int) string {
+	return fmt.Sprintf("chunk-%06d.csv", n)
+}
+
+func writeChunk(path string, posts []Post) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	for _, p := range posts {
+		w.Write([]string{p.ID.String(), p.UserID.String(), p.Title, p.Content, string(p.Status)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// assembleChunks writes the header and then every chunk, in order, to path.
+func assembleChunks(path, chunkDir string, chunks int) error {
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := csv.NewWriter(out)
+	w.Write(exportCSVHeader)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	for i := 1; i <= chunks; i++ {
+		in, err := os.Open(filepath.Join(chunkDir, chunkName(i)))
+		if err != nil {
+			return fmt.Errorf("open chunk %d: %w", i, err)
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("copy chunk %d: %w", i, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
 // --- Main Application Setup ---
 
 func main() {
@@ -226,8 +953,36 @@ func main() {
 		log.Fatalf("Initialization failed: %v", err)
 	}
 
+	exportDir := os.Getenv("EXPORT_DIR")
+	if exportDir == "" {
+		exportDir = filepath.Join(os.TempDir(), "post-exports")
+	}
+	workers, _ := strconv.Atoi(os.Getenv("EXPORT_WORKERS"))
+	if workers <= 0 {
+		workers = 2
+	}
+	exporter, err := NewPostExporter(store, exportDir, logNotifier{}, workers)
+	if err != nil {
+		log.Fatalf("Initialization failed: %v", err)
+	}
+	exporter.Resume()
+
+	archiver := &PostArchiver{Store: store, MaxAge: 90 * 24 * time.Hour, Interval: time.Hour, BatchSize: 500}
+	if v := os.Getenv("POST_ARCHIVE_AFTER"); v != "" {
+		if archiver.MaxAge, err = time.ParseDuration(v); err != nil || archiver.MaxAge <= 0 {
+			log.Fatalf("POST_ARCHIVE_AFTER must be a positive duration, got %q", v)
+		}
+	}
+	if v := os.Getenv("POST_ARCHIVE_INTERVAL"); v != "" {
+		if archiver.Interval, err = time.ParseDuration(v); err != nil || archiver.Interval <= 0 {
+			log.Fatalf("POST_ARCHIVE_INTERVAL must be a positive duration, got %q", v)
+		}
+	}
+	archiver.Start()
+
 	// Initialize modules
 	userModule := &UserModule{Store: store}
+	postModule := &PostModule{Store: store, Exporter: exporter}
 
 	// Setup Fiber app and routing
 	app := fiber.New()
@@ -236,6 +991,7 @@ func main() {
 	
 	// Register modules to route groups
 	userModule.Register(apiV1.Group("/users"))
+	postModule.Register(apiV1.Group("/posts"))
 
 	fmt.Println("Server routes are configured. This is a runnable example.")
 	// In a real app, you would run:
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"io"
 	"log"
 	"mime/multipart"
+	"net/mail"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -80,35 +86,268 @@ func NewFileService(db *Datastore) *FileService {
 	return &FileService{db: db}
 }
 
-func (s *FileService) ProcessUserCSV(file io.Reader) ([]User, error) {
+// --- User Import ---
+// Imports follow a template: the header row names the columns, in any order.
+// Rows are matched to existing users by email; a matching row updates that
+// user, any other row creates one.
+
+var importTemplate = []string{"email", "password_hash", "role", "is_active"}
+
+const (
+	importMaxRows    = 10000
+	importPreviewTTL = 15 * time.Minute
+)
+
+var (
+	ErrPreviewNotFound = errors.New("preview not found or expired")
+	ErrPreviewStale    = errors.New("users changed since the preview was made")
+)
+
+type ImportRow struct {
+	Line     int       `json:"line"`
+	Email    string    `json:"email"`
+	Role     UserRole  `json:"role"`
+	IsActive bool      `json:"is_active"`
+	UserID   uuid.UUID `json:"user_id,omitempty"`
+	Changes  []string  `json:"changes,omitempty"`
+
+	passwordHash string
+	// before is the user as the preview saw it, to detect later edits.
+	before *User
+}
+
+type ImportIssue struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email,omitempty"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportPlan is what an import would do. Only a plan without conflicts or
+// errors can be applied.
+type ImportPlan struct {
+	Create    []ImportRow   `json:"create"`
+	Update    []ImportRow   `json:"update"`
+	Unchanged int           `json:"unchanged"`
+	Conflicts []ImportIssue `json:"conflicts"`
+	Errors    []ImportIssue `json:"errors"`
+}
+
+func (p *ImportPlan) Applicable() bool {
+	return len(p.Conflicts) == 0 && len(p.Errors) == 0
+}
+
+// PlanUserImport validates the CSV and compares it with the datastore
+// without writing anything.
+func (s *FileService) PlanUserImport(file io.Reader) (*ImportPlan, error) {
 	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		return nil, fmt.Errorf("failed to parse CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("CSV header must include an email column (template: %s)", strings.Join(importTemplate, ","))
+	}
+	for name := range columns {
+		if !containsString(importTemplate, name) {
+			return nil, fmt.Errorf("unknown column %q (template: %s)", name, strings.Join(importTemplate, ","))
+		}
+	}
+
+	plan := &ImportPlan{Create: []ImportRow{}, Update: []ImportRow{}, Conflicts: []ImportIssue{}, Errors: []ImportIssue{}}
+	firstLine := make(map[string]int)
+
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	byEmail := make(map[string]User, len(s.db.Users))
+	for _, u := range s.db.Users {
+		byEmail[strings.ToLower(u.Email)] = u
 	}
-	if len(records) < 2 {
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		if line-1 > importMaxRows {
+			return nil, fmt.Errorf("CSV has more than %d rows", importMaxRows)
+		}
+		field := func(name string) (string, bool) {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return "", false
+			}
+			return strings.TrimSpace(record[i]), true
+		}
+
+		email, _ := field("email")
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			plan.Errors = append(plan.Errors, ImportIssue{Line: line, Email: email, Column: "email", Error: "not a valid email address"})
+			continue
+		}
+		key := strings.ToLower(email)
+		if first, seen := firstLine[key]; seen {
+			plan.Conflicts = append(plan.Conflicts, ImportIssue{Line: line, Email: email, Error: fmt.Sprintf("email also appears on line %d", first)})
+			continue
+		}
+		firstLine[key] = line
+
+		existing, exists := byEmail[key]
+		row := ImportRow{Line: line, Email: email, Role: USER, IsActive: true}
+		if exists {
+			row.Role, row.IsActive, row.UserID = existing.Role, existing.IsActive, existing.ID
+		}
+		var rowErr *ImportIssue
+		if v, ok := field("role"); ok && v != "" {
+			role := UserRole(strings.ToUpper(v))
+			if role != ADMIN && role != USER {
+				rowErr = &ImportIssue{Line: line, Email: email, Column: "role", Error: "role must be ADMIN or USER"}
+			}
+			row.Role = role
+		}
+		if v, ok := field("is_active"); ok && v != "" {
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				rowErr = &ImportIssue{Line: line, Email: email, Column: "is_active", Error: "is_active must be true or false"}
+			}
+			row.IsActive = active
+		}
+		row.passwordHash, _ = field("password_hash")
+		if !exists && row.passwordHash == "" {
+			rowErr = &ImportIssue{Line: line, Email: email, Column: "password_hash", Error: "required for new users"}
+		}
+		if rowErr != nil {
+			plan.Errors = append(plan.Errors, *rowErr)
+			continue
+		}
+
+		if !exists {
+			plan.Create = append(plan.Create, row)
+			continue
+		}
+		if existing.Role == ADMIN && row.Role != ADMIN {
+			plan.Conflicts = append(plan.Conflicts, ImportIssue{Line: line, Email: email, Column: "role", Error: "imports cannot demote an admin"})
+			continue
+		}
+		if row.Role != existing.Role {
+			row.Changes = append(row.Changes, "role")
+		}
+		if row.IsActive != existing.IsActive {
+			row.Changes = append(row.Changes, "is_active")
+		}
+		if row.passwordHash != "" && row.passwordHash != existing.PasswordHash {
+			row.Changes = append(row.Changes, "password_hash")
+		}
+		if len(row.Changes) == 0 {
+			plan.Unchanged++
+			continue
+		}
+		before := existing
+		row.before = &before
+		plan.Update = append(plan.Update, row)
+	}
+	if len(firstLine) == 0 && len(plan.Errors) == 0 {
 		return nil, fmt.Errorf("CSV must contain a header and at least one record")
 	}
+	return plan, nil
+}
 
-	var createdUsers []User
+// ApplyUserImport writes an applicable plan. It fails with ErrPreviewStale,
+// writing nothing, if a user the plan touches changed after planning.
+func (s *FileService) ApplyUserImport(plan *ImportPlan) (created, updated int, err error) {
 	s.db.mu.Lock()
 	defer s.db.mu.Unlock()
 
-	for i, record := range records {
-		if i == 0 { continue } // Skip header
-		isActive, _ := strconv.ParseBool(record[3])
-		newUser := User{
-			ID:           uuid.New(),
-			Email:        record[0],
-			PasswordHash: record[1],
-			Role:         UserRole(record[2]),
-			IsActive:     isActive,
-			CreatedAt:    time.Now(),
+	taken := make(map[string]bool, len(s.db.Users))
+	for _, u := range s.db.Users {
+		taken[strings.ToLower(u.Email)] = true
+	}
+	for _, row := range plan.Create {
+		if taken[strings.ToLower(row.Email)] {
+			return 0, 0, ErrPreviewStale
+		}
+	}
+	for _, row := range plan.Update {
+		if current, ok := s.db.Users[row.UserID]; !ok || current != *row.before {
+			return 0, 0, ErrPreviewStale
+		}
+	}
+
+	for _, row := range plan.Create {
+		u := User{ID: uuid.New(), Email: row.Email, PasswordHash: row.passwordHash, Role: row.Role, IsActive: row.IsActive, CreatedAt: time.Now()}
+		s.db.Users[u.ID] = u
+	}
+	for _, row := range plan.Update {
+		u := s.db.Users[row.UserID]
+		u.Role, u.IsActive = row.Role, row.IsActive
+		if row.passwordHash != "" {
+			u.PasswordHash = row.passwordHash
+		}
+		s.db.Users[u.ID] = u
+	}
+	return len(plan.Create), len(plan.Update), nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// importPreviews holds previewed plans so the import can skip re-validation.
+// Each token is used at most once.
+type importPreviews struct {
+	mu    sync.Mutex
+	plans map[string]importPreview
+}
+
+type importPreview struct {
+	plan      *ImportPlan
+	expiresAt time.Time
+}
+
+func newImportPreviews() *importPreviews {
+	return &importPreviews{plans: make(map[string]importPreview)}
+}
+
+func (p *importPreviews) Put(plan *ImportPlan) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for t, prev := range p.plans {
+		if time.Now().After(prev.expiresAt) {
+			delete(p.plans, t)
 		}
-		s.db.Users[newUser.ID] = newUser
-		createdUsers = append(createdUsers, newUser)
 	}
-	return createdUsers, nil
+	p.plans[token] = importPreview{plan: plan, expiresAt: time.Now().Add(importPreviewTTL)}
+	return token, nil
+}
+
+func (p *importPreviews) Take(token string) (*ImportPlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev, ok := p.plans[token]
+	delete(p.plans, token)
+	if !ok || time.Now().After(prev.expiresAt) {
+		return nil, ErrPreviewNotFound
+	}
+	return prev.plan, nil
 }
 
 func (s *FileService) ResizePostImage(postID uuid.UUID, file io.Reader) (string, error) {
@@ -163,39 +402,107 @@ func (s *FileService) GeneratePostsCSV(writer io.Writer) error {
 // --- Handler/Controller Layer ---
 
 type FileHandler struct {
-	fileSvc *FileService
+	fileSvc  *FileService
+	previews *importPreviews
 }
 
 func NewFileHandler(fs *FileService) *FileHandler {
-	return &FileHandler{fileSvc: fs}
+	return &FileHandler{fileSvc: fs, previews: newImportPreviews()}
 }
 
-func (h *FileHandler) UploadUsers(c *fiber.Ctx) error {
+// planUpload builds an import plan from the 'user_data' form file. On
+// failure it has already written the response and returns nil.
+func (h *FileHandler) planUpload(c *fiber.Ctx) (*ImportPlan, error) {
 	fileHeader, err := c.FormFile("user_data")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "form file 'user_data' is required"})
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "form file 'user_data' is required"})
 	}
 
 	if filepath.Ext(fileHeader.Filename) != ".csv" {
-		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "file must be a .csv"})
+		return nil, c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "file must be a .csv"})
 	}
 
 	file, err := fileHeader.Open()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not open uploaded file"})
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not open uploaded file"})
 	}
 	defer file.Close()
 
-	users, err := h.fileSvc.ProcessUserCSV(file)
+	plan, err := h.fileSvc.PlanUserImport(file)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return plan, nil
+}
+
+// PreviewUsersImport reports what importing the file would do. Applicable
+// previews come with a token that POST /users/import accepts instead of the
+// file.
+func (h *FileHandler) PreviewUsersImport(c *fiber.Ctx) error {
+	plan, err := h.planUpload(c)
+	if plan == nil {
+		return err
+	}
+	resp := fiber.Map{"preview": plan, "applicable": plan.Applicable()}
+	if plan.Applicable() {
+		token, err := h.previews.Put(plan)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store preview"})
+		}
+		resp["preview_token"] = token
+		resp["expires_in"] = importPreviewTTL.String()
+	}
+	return c.JSON(resp)
+}
+
+// UploadUsers imports either a previewed plan (form field 'preview_token')
+// or a freshly uploaded file, which must validate cleanly.
+func (h *FileHandler) UploadUsers(c *fiber.Ctx) error {
+	var plan *ImportPlan
+	if token := c.FormValue("preview_token"); token != "" {
+		p, err := h.previews.Take(token)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		plan = p
+	} else {
+		p, err := h.planUpload(c)
+		if p == nil {
+			return err
+		}
+		if !p.Applicable() {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "import has conflicts or invalid rows", "preview": p})
+		}
+		plan = p
+	}
+
+	created, updated, err := h.fileSvc.ApplyUserImport(plan)
+	if errors.Is(err, ErrPreviewStale) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error() + "; preview the file again"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "import failed"})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": fmt.Sprintf("Successfully imported %d users", len(users)),
+		"message": fmt.Sprintf("Successfully imported %d users", created+updated),
+		"created": created,
+		"updated": updated,
 	})
 }
 
+// DownloadUsersTemplate serves an empty import file with an example row.
+func (h *FileHandler) DownloadUsersTemplate(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="users_import_template.csv"`)
+	var buf bytes.Buffer
+	csvWriter := csv.NewWriter(&buf)
+	csvWriter.Write(importTemplate)
+	csvWriter.Write([]string{"jane@example.com", "<password hash>", string(USER), "true"})
+	csvWriter.Flush()
+	return c.Send(buf.Bytes())
+}
+
 func (h *FileHandler) UploadPostImage(c *fiber.Ctx) error {
 	postID, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -244,6 +551,8 @@ func main() {
 	app := fiber.New()
 
 	app.Post("/users/import", fileHandler.UploadUsers)
+	app.Post("/users/import/preview", fileHandler.PreviewUsersImport)
+	app.Get("/users/import/template", fileHandler.DownloadUsersTemplate)
 	app.Post("/posts/:id/image", fileHandler.UploadPostImage)
 	app.Get("/posts/export", fileHandler.DownloadPostsReport)
 
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -56,6 +61,18 @@ func main() {
 
 	app := fiber.New()
 	app.Use(logger.New())
+	minBytes := 1024
+	if v := os.Getenv("COMPRESS_MIN_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("COMPRESS_MIN_BYTES must be a non-negative integer, got %q", v)
+		}
+		minBytes = n
+	}
+	app.Use(compressResponses(minBytes))
+	if url := os.Getenv("USERS_EXPORT_URL"); url != "" {
+		exportURL = url
+	}
 
 	// --- Route Definitions ---
 	app.Post("/users", createUser)
@@ -112,6 +129,7 @@ func createUser(c *fiber.Ctx) error {
 		}
 	}
 	userStore[newUser.ID] = newUser
+	userCounts.invalidate()
 
 	return c.Status(fiber.StatusCreated).JSON(newUser)
 }
@@ -120,8 +138,21 @@ func listUsers(c *fiber.Ctx) error {
 	// 1. Parse query parameters for filtering and pagination
 	roleFilter := c.Query("role")
 	isActiveFilter := c.Query("is_active")
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	limit, bounded, err := parseLimit(c.Query("limit"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+	if !bounded || offset > maxListOffset {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      "listing every user is not supported over HTTP; request an export",
+			"export_url": exportURL,
+			"max_limit":  maxLimit,
+		})
+	}
 
 	storeMutex.RLock()
 	defer storeMutex.RUnlock()
@@ -144,6 +175,8 @@ func listUsers(c *fiber.Ctx) error {
 		}
 	}
 
+	total := userCounts.get(strings.ToUpper(roleFilter)+"|"+isActiveFilter, func() int { return len(filteredUsers) })
+
 	// 3. Apply pagination
 	start := offset
 	end := offset + limit
@@ -157,7 +190,7 @@ func listUsers(c *fiber.Ctx) error {
 	paginatedUsers := filteredUsers[start:end]
 
 	return c.JSON(fiber.Map{
-		"total": len(filteredUsers),
+		"total": total,
 		"limit": limit,
 		"offset": offset,
 		"data": paginatedUsers,
@@ -210,6 +243,7 @@ func updateUser(c *fiber.Ctx) error { // PUT - full update
 	user.Role = req.Role
 	user.IsActive = req.IsActive
 	userStore[id] = user
+	userCounts.invalidate()
 
 	return c.JSON(user)
 }
@@ -245,6 +279,7 @@ func patchUser(c *fiber.Ctx) error { // PATCH - partial update
 	}
 
 	userStore[id] = user
+	userCounts.invalidate()
 	return c.JSON(user)
 }
 
@@ -262,9 +297,149 @@ func deleteUser(c *fiber.Ctx) error {
 	}
 
 	delete(userStore, id)
+	userCounts.invalidate()
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// --- Compression ---
+
+// compressResponses encodes the finished response body with gzip or deflate
+// when the client accepts it, the body is textual and at least minBytes long.
+func compressResponses(minBytes int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		res := c.Response()
+		body := res.Body()
+		if c.Method() == fiber.MethodHead || len(body) == 0 ||
+			len(res.Header.Peek(fiber.HeaderContentEncoding)) > 0 || !compressible(string(res.Header.ContentType())) {
+			return nil
+		}
+		c.Vary(fiber.HeaderAcceptEncoding)
+		enc := negotiateEncoding(c.Get(fiber.HeaderAcceptEncoding))
+		if enc == "" || len(body) < minBytes {
+			return nil
+		}
+		z, err := compressBody(enc, body)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentEncoding, enc)
+		res.SetBody(z)
+		return nil
+	}
+}
+
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasPrefix(ct, "text/") || ct == "application/json" ||
+		ct == "application/xml" || ct == "application/javascript" || strings.HasSuffix(ct, "+json")
+}
+
+// negotiateEncoding prefers gzip to deflate; a q=0 entry rules a coding out.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressBody emits zlib framing for "deflate", per the HTTP spec.
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// --- Pagination Guards ---
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+	// Offsets past this mean the client is walking the whole store.
+	maxListOffset = 10000
+)
+
+// exportURL is the async export API that serves complete listings.
+var exportURL = "/exports/users"
+
+// parseLimit caps limit at maxLimit; bounded is false for limit=all, 0 or a
+// negative value.
+func parseLimit(raw string) (limit int, bounded bool, err error) {
+	if raw == "" {
+		return defaultLimit, true, nil
+	}
+	if strings.EqualFold(raw, "all") {
+		return 0, false, nil
+	}
+	if limit, err = strconv.Atoi(raw); err != nil {
+		return 0, false, fmt.Errorf("limit must be an integer")
+	}
+	if limit < 1 {
+		return 0, false, nil
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, true, nil
+}
+
+// countCache stores per-filter totals for ttl; writes clear it.
+type countCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]countEntry
+}
+
+type countEntry struct {
+	n  int
+	at time.Time
+}
+
+func (cc *countCache) get(key string, count func() int) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if e, ok := cc.entries[key]; ok && time.Since(e.at) < cc.ttl {
+		return e.n
+	}
+	n := count()
+	cc.entries[key] = countEntry{n: n, at: time.Now()}
+	return n
+}
+
+func (cc *countCache) invalidate() {
+	cc.mu.Lock()
+	cc.entries = make(map[string]countEntry)
+	cc.mu.Unlock()
+}
+
+var userCounts = &countCache{ttl: 30 * time.Second, entries: make(map[string]countEntry)}
+
 // --- Helper Functions ---
 
 func seedData() {
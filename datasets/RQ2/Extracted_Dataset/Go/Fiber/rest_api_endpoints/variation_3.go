@@ -1,13 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"net/http/httptest"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -41,6 +52,112 @@ type Post struct {
 	Status  string // DRAFT, PUBLISHED
 }
 
+// --- Domain Errors ---
+
+// ErrorKind classifies a domain error independently of the transport. The
+// app's ErrorHandler picks the status code from the kind alone, never from
+// the message text.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindConflict
+	KindInvalid
+	KindForbidden
+	KindUnavailable
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	case KindInvalid:
+		return "invalid"
+	case KindForbidden:
+		return "forbidden"
+	case KindUnavailable:
+		return "unavailable"
+	default:
+		return "internal"
+	}
+}
+
+// DomainError carries a kind plus optional metadata about what failed.
+type DomainError struct {
+	Kind     ErrorKind
+	Resource string
+	Field    string
+	Message  string
+	Err      error
+}
+
+func (e *DomainError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = strings.ReplaceAll(e.Kind.String(), "_", " ")
+		if e.Resource != "" {
+			msg = e.Resource + " " + msg
+		}
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *DomainError) Unwrap() error { return e.Err }
+
+// Is makes errors.Is(err, ErrNotFound) match any DomainError of the same
+// kind, whatever its resource or field.
+func (e *DomainError) Is(target error) bool {
+	t, ok := target.(*DomainError)
+	if !ok {
+		return false
+	}
+	return t.Kind == e.Kind && t.Resource == "" && t.Field == "" && t.Message == ""
+}
+
+// ErrNotFound is the sentinel for errors.Is checks on missing records.
+var ErrNotFound = &DomainError{Kind: KindNotFound}
+
+func NotFound(resource string) error {
+	return &DomainError{Kind: KindNotFound, Resource: resource}
+}
+
+func Conflict(resource, field, message string) error {
+	return &DomainError{Kind: KindConflict, Resource: resource, Field: field, Message: message}
+}
+
+func Invalid(field, message string) error {
+	return &DomainError{Kind: KindInvalid, Field: field, Message: message}
+}
+
+// KindOf reports the kind of the first DomainError in err's chain. Anything
+// unclassified is internal.
+func KindOf(err error) ErrorKind {
+	var de *DomainError
+	if errors.As(err, &de) {
+		return de.Kind
+	}
+	return KindInternal
+}
+
+var httpStatusByKind = map[ErrorKind]int{
+	KindInternal:    fiber.StatusInternalServerError,
+	KindNotFound:    fiber.StatusNotFound,
+	KindConflict:    fiber.StatusConflict,
+	KindInvalid:     fiber.StatusUnprocessableEntity,
+	KindForbidden:   fiber.StatusForbidden,
+	KindUnavailable: fiber.StatusServiceUnavailable,
+}
+
+func HTTPStatus(err error) int {
+	return httpStatusByKind[KindOf(err)]
+}
+
 // --- DTOs (Data Transfer Objects) ---
 
 type CreateUserRequest struct {
@@ -73,60 +190,299 @@ func toUserResponse(user *User) UserResponse {
 	}
 }
 
+// UserListResponse keeps the original data/total keys and adds the paging
+// position and links; the links are also sent as a Link header.
+type UserListResponse struct {
+	Data []UserResponse `json:"data"`
+	OffsetPage
+}
+
+type OffsetPage struct {
+	Total  int       `json:"total"`
+	Offset int       `json:"offset"`
+	Limit  int       `json:"limit"`
+	Links  PageLinks `json:"links"`
+}
+
+// PageLinks are host-relative URLs. Prev and Next are left out at either end.
+type PageLinks struct {
+	First string `json:"first"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last"`
+}
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// newOffsetPage builds links for the list at rawURL by rewriting its offset
+// and limit, so filters in the query string survive.
+func newOffsetPage(rawURL string, total, offset, limit int) OffsetPage {
+	p := OffsetPage{Total: total, Offset: offset, Limit: limit}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		u = &url.URL{}
+	}
+	link := func(at int) string {
+		q := u.Query()
+		q.Set("offset", strconv.Itoa(at))
+		q.Set("limit", strconv.Itoa(limit))
+		return u.Path + "?" + q.Encode()
+	}
+	last := 0
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+	p.Links.First = link(0)
+	p.Links.Last = link(last)
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		if prev > last {
+			prev = last
+		}
+		p.Links.Prev = link(prev)
+	}
+	if offset+limit < total {
+		p.Links.Next = link(offset + limit)
+	}
+	return p
+}
+
+// LinkHeader is the RFC 5988 form of the links.
+func (p OffsetPage) LinkHeader() string {
+	var parts []string
+	for _, l := range []struct{ rel, url string }{
+		{"first", p.Links.First}, {"prev", p.Links.Prev}, {"next", p.Links.Next}, {"last", p.Links.Last},
+	} {
+		if l.url != "" {
+			parts = append(parts, "<"+l.url+`>; rel="`+l.rel+`"`)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 // --- Repository Layer ---
 
 type UserRepository interface {
 	Save(ctx context.Context, user *User) error
 	FindByID(ctx context.Context, id uuid.UUID) (*User, error)
 	FindByEmail(ctx context.Context, email string) (*User, error)
+	// FindAll pages through users ordered by CreatedAt, then ID.
 	FindAll(ctx context.Context, offset, limit int, filters map[string]interface{}) ([]*User, int, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
-type memoryUserRepository struct {
-	users map[uuid.UUID]*User
-	mu    sync.RWMutex
+// userShardCount must be a power of two so the shard index is a mask.
+const userShardCount = 32
+
+// shard is one slice of a sharded map. Lookups only take the shard's read
+// lock, so readers never block each other and writers only block the 1/N of
+// keys that hash to the same shard.
+type shard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+	_  [40]byte // keep neighbouring shards on separate cache lines
+}
+
+// shardedUserRepository spreads users over userShardCount shards by ID, with
+// a second set of shards indexing email -> ID. The index is updated after the
+// primary write rather than atomically with it, so FindByEmail re-checks the
+// user it resolves; a stale index entry therefore only costs a miss.
+//
+// Users are copied on the way in and out so callers can never mutate a stored
+// value outside its shard lock.
+type shardedUserRepository struct {
+	byID    [userShardCount]shard[uuid.UUID, *User]
+	byEmail [userShardCount]shard[string, uuid.UUID]
 }
 
 func NewMemoryUserRepository() UserRepository {
-	repo := &memoryUserRepository{users: make(map[uuid.UUID]*User)}
+	repo := newShardedUserRepository()
 	// Seed
-	admin := &User{ID: uuid.New(), Email: "admin@example.com", PasswordHash: "hash1", Role: RoleAdmin, IsActive: true, CreatedAt: time.Now()}
-	user := &User{ID: uuid.New(), Email: "user@example.com", PasswordHash: "hash2", Role: RoleUser, IsActive: false, CreatedAt: time.Now()}
-	repo.users[admin.ID] = admin
-	repo.users[user.ID] = user
+	ctx := context.Background()
+	repo.Save(ctx, &User{ID: uuid.New(), Email: "admin@example.com", PasswordHash: "hash1", Role: RoleAdmin, IsActive: true, CreatedAt: time.Now()})
+	repo.Save(ctx, &User{ID: uuid.New(), Email: "user@example.com", PasswordHash: "hash2", Role: RoleUser, IsActive: false, CreatedAt: time.Now()})
 	return repo
 }
 
-func (r *memoryUserRepository) Save(ctx context.Context, user *User) error {
+func newShardedUserRepository() *shardedUserRepository {
+	r := &shardedUserRepository{}
+	for i := 0; i < userShardCount; i++ {
+		r.byID[i].m = make(map[uuid.UUID]*User)
+		r.byEmail[i].m = make(map[string]uuid.UUID)
+	}
+	return r
+}
+
+func (r *shardedUserRepository) idShard(id uuid.UUID) *shard[uuid.UUID, *User] {
+	// UUIDs are already uniformly random; the last byte is a good enough hash.
+	return &r.byID[int(id[15])&(userShardCount-1)]
+}
+
+func (r *shardedUserRepository) emailShard(email string) *shard[string, uuid.UUID] {
+	h := fnv.New32a()
+	h.Write([]byte(email))
+	return &r.byEmail[int(h.Sum32())&(userShardCount-1)]
+}
+
+func cloneUser(u *User) *User {
+	c := *u
+	return &c
+}
+
+// sortUsers puts users in FindAll order. Map iteration order changes from
+// call to call, so without it an offset would not name the same user twice.
+func sortUsers(users []*User) {
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return bytes.Compare(users[i].ID[:], users[j].ID[:]) < 0
+	})
+}
+
+func (r *shardedUserRepository) Save(ctx context.Context, user *User) error {
+	u := cloneUser(user)
+	s := r.idShard(u.ID)
+	s.mu.Lock()
+	prev, existed := s.m[u.ID]
+	s.m[u.ID] = u
+	s.mu.Unlock()
+
+	if existed && prev.Email != u.Email {
+		r.unindexEmail(prev.Email, u.ID)
+	}
+	es := r.emailShard(u.Email)
+	es.mu.Lock()
+	es.m[u.Email] = u.ID
+	es.mu.Unlock()
+	return nil
+}
+
+func (r *shardedUserRepository) unindexEmail(email string, id uuid.UUID) {
+	es := r.emailShard(email)
+	es.mu.Lock()
+	if es.m[email] == id {
+		delete(es.m, email)
+	}
+	es.mu.Unlock()
+}
+
+func (r *shardedUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	s := r.idShard(id)
+	s.mu.RLock()
+	user, ok := s.m[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, NotFound("user")
+	}
+	return cloneUser(user), nil
+}
+
+func (r *shardedUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	es := r.emailShard(email)
+	es.mu.RLock()
+	id, ok := es.m[email]
+	es.mu.RUnlock()
+	if !ok {
+		return nil, NotFound("user")
+	}
+	user, err := r.FindByID(ctx, id)
+	if err != nil || user.Email != email {
+		return nil, NotFound("user")
+	}
+	return user, nil
+}
+
+func (r *shardedUserRepository) FindAll(ctx context.Context, offset, limit int, filters map[string]interface{}) ([]*User, int, error) {
+	var filteredUsers []*User
+	for i := range r.byID {
+		s := &r.byID[i]
+		s.mu.RLock()
+		for _, user := range s.m {
+			if role, ok := filters["role"].(Role); ok && user.Role != role {
+				continue
+			}
+			if isActive, ok := filters["is_active"].(bool); ok && user.IsActive != isActive {
+				continue
+			}
+			filteredUsers = append(filteredUsers, cloneUser(user))
+		}
+		s.mu.RUnlock()
+	}
+	sortUsers(filteredUsers)
+
+	total := len(filteredUsers)
+	start := offset
+	end := offset + limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return filteredUsers[start:end], total, nil
+}
+
+func (r *shardedUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	s := r.idShard(id)
+	s.mu.Lock()
+	user, ok := s.m[id]
+	delete(s.m, id)
+	s.mu.Unlock()
+	if !ok {
+		return NotFound("user")
+	}
+	r.unindexEmail(user.Email, id)
+	return nil
+}
+
+// singleLockUserRepository is the previous design: one map behind one
+// RWMutex. It is kept as the baseline for the repository benchmarks, and
+// copies users like the sharded version so only the locking differs.
+type singleLockUserRepository struct {
+	users map[uuid.UUID]*User
+	mu    sync.RWMutex
+}
+
+func newSingleLockUserRepository() *singleLockUserRepository {
+	return &singleLockUserRepository{users: make(map[uuid.UUID]*User)}
+}
+
+func (r *singleLockUserRepository) Save(ctx context.Context, user *User) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.users[user.ID] = user
+	r.users[user.ID] = cloneUser(user)
 	return nil
 }
 
-func (r *memoryUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*User, error) {
+func (r *singleLockUserRepository) FindByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	user, ok := r.users[id]
 	if !ok {
-		return nil, errors.New("user not found")
+		return nil, NotFound("user")
 	}
-	return user, nil
+	return cloneUser(user), nil
 }
 
-func (r *memoryUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+func (r *singleLockUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	for _, u := range r.users {
 		if u.Email == email {
-			return u, nil
+			return cloneUser(u), nil
 		}
 	}
-	return nil, errors.New("user not found")
+	return nil, NotFound("user")
 }
 
-func (r *memoryUserRepository) FindAll(ctx context.Context, offset, limit int, filters map[string]interface{}) ([]*User, int, error) {
+func (r *singleLockUserRepository) FindAll(ctx context.Context, offset, limit int, filters map[string]interface{}) ([]*User, int, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	
@@ -149,6 +505,7 @@ func (r *memoryUserRepository) FindAll(ctx context.Context, offset, limit int, f
 			filteredUsers = append(filteredUsers, user)
 		}
 	}
+	sortUsers(filteredUsers)
 
 	total := len(filteredUsers)
 	start := offset
@@ -159,11 +516,11 @@ func (r *memoryUserRepository) FindAll(ctx context.Context, offset, limit int, f
 	return filteredUsers[start:end], total, nil
 }
 
-func (r *memoryUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+func (r *singleLockUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, ok := r.users[id]; !ok {
-		return errors.New("user not found")
+		return NotFound("user")
 	}
 	delete(r.users, id)
 	return nil
@@ -188,8 +545,13 @@ func NewUserService(repo UserRepository) UserService {
 }
 
 func (s *userService) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	if req.Email == "" {
+		return nil, Invalid("email", "email is required")
+	}
 	if _, err := s.repo.FindByEmail(ctx, req.Email); err == nil {
-		return nil, errors.New("email is already taken")
+		return nil, Conflict("user", "email", "email is already taken")
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
 	}
 
 	user := &User{
@@ -243,6 +605,31 @@ type UserHandler struct {
 	service UserService
 }
 
+// errorHandler is the app's ErrorHandler, so handlers just return service
+// errors. Fiber's own errors, such as an unknown route, keep their status.
+func errorHandler(c *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(fiber.Map{"error": fe.Message})
+	}
+	status := HTTPStatus(err)
+	body := fiber.Map{"error": err.Error(), "kind": KindOf(err).String()}
+	var de *DomainError
+	if errors.As(err, &de) {
+		if de.Resource != "" {
+			body["resource"] = de.Resource
+		}
+		if de.Field != "" {
+			body["field"] = de.Field
+		}
+	}
+	if status == fiber.StatusInternalServerError {
+		log.Printf("internal error: %v", err)
+		body["error"] = "internal server error"
+	}
+	return c.Status(status).JSON(body)
+}
+
 func NewUserHandler(service UserService) *UserHandler {
 	return &UserHandler{service: service}
 }
@@ -264,7 +651,7 @@ func (h *UserHandler) handleCreateUser(c *fiber.Ctx) error {
 	}
 	user, err := h.service.CreateUser(c.Context(), req)
 	if err != nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 	return c.Status(fiber.StatusCreated).JSON(toUserResponse(user))
 }
@@ -276,15 +663,24 @@ func (h *UserHandler) handleGetUser(c *fiber.Ctx) error {
 	}
 	user, err := h.service.GetUser(c.Context(), id)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 	return c.JSON(toUserResponse(user))
 }
 
 func (h *UserHandler) handleListUsers(c *fiber.Ctx) error {
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	limit, _ := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultListLimit)))
+	if limit < 1 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
 	offset, _ := strconv.Atoi(c.Query("offset", "0"))
-	
+	if offset < 0 {
+		offset = 0
+	}
+
 	filters := make(map[string]interface{})
 	if role := c.Query("role"); role != "" {
 		filters["role"] = Role(strings.ToUpper(role))
@@ -297,15 +693,16 @@ func (h *UserHandler) handleListUsers(c *fiber.Ctx) error {
 
 	users, total, err := h.service.ListUsers(c.Context(), offset, limit, filters)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not fetch users"})
+		return err
 	}
 	
-	respUsers := make([]UserResponse, len(users))
+	resp := UserListResponse{Data: make([]UserResponse, len(users)), OffsetPage: newOffsetPage(c.OriginalURL(), total, offset, limit)}
 	for i, u := range users {
-		respUsers[i] = toUserResponse(u)
+		resp.Data[i] = toUserResponse(u)
 	}
-
-	return c.JSON(fiber.Map{"data": respUsers, "total": total})
+	c.Set(fiber.HeaderLink, resp.LinkHeader())
+	c.Set("X-Total-Count", strconv.Itoa(total))
+	return c.JSON(resp)
 }
 
 func (h *UserHandler) handleUpdateUser(c *fiber.Ctx) error {
@@ -319,7 +716,7 @@ func (h *UserHandler) handleUpdateUser(c *fiber.Ctx) error {
 	}
 	user, err := h.service.UpdateUser(c.Context(), id, req)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 	return c.JSON(toUserResponse(user))
 }
@@ -330,20 +727,148 @@ func (h *UserHandler) handleDeleteUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
 	}
 	if err := h.service.DeleteUser(c.Context(), id); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 // --- Main ---
 
+// --- Repository Benchmarks ---
+
+// benchmarkRepository measures a FindByID/Save mix from at least
+// benchGoroutines concurrent goroutines against a repository of benchUsers.
+const (
+	benchUsers      = 10000
+	benchGoroutines = 128
+)
+
+func benchmarkRepository(newRepo func() UserRepository, writePercent int) testing.BenchmarkResult {
+	return testing.Benchmark(func(b *testing.B) {
+		ctx := context.Background()
+		repo := newRepo()
+		ids := make([]uuid.UUID, benchUsers)
+		for i := range ids {
+			ids[i] = uuid.New()
+			repo.Save(ctx, &User{ID: ids[i], Email: fmt.Sprintf("user%d@example.com", i), Role: RoleUser, IsActive: true, CreatedAt: time.Now()})
+		}
+
+		procs := runtime.GOMAXPROCS(0)
+		b.SetParallelism((benchGoroutines + procs - 1) / procs)
+		var seed int64
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			rng := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+			for pb.Next() {
+				id := ids[rng.Intn(len(ids))]
+				if rng.Intn(100) < writePercent {
+					u, err := repo.FindByID(ctx, id)
+					if err == nil {
+						u.IsActive = !u.IsActive
+						repo.Save(ctx, u)
+					}
+					continue
+				}
+				repo.FindByID(ctx, id)
+			}
+		})
+	})
+}
+
+// checkStablePagination backs the selftest command: walking GET /users by
+// its next links returns every user exactly once, in FindAll order, even when
+// many users share a CreatedAt and live in different shards.
+func checkStablePagination() error {
+	ctx := context.Background()
+	repo := newShardedUserRepository()
+	created := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 250; i++ {
+		// Ten users per timestamp, so the ID tiebreak decides most of the order.
+		at := created.Add(time.Duration(i/10) * time.Second)
+		repo.Save(ctx, &User{ID: uuid.New(), Email: fmt.Sprintf("user%d@example.com", i), Role: RoleUser, IsActive: true, CreatedAt: at})
+	}
+	want, _, err := repo.FindAll(ctx, 0, 250, nil)
+	if err != nil {
+		return err
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+	NewUserHandler(NewUserService(repo)).RegisterRoutes(app)
+	var got []uuid.UUID
+	for next := "/users?limit=7"; next != ""; {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, next, nil))
+		if err != nil {
+			return err
+		}
+		var page UserListResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("GET %s: %w", next, err)
+		}
+		for _, u := range page.Data {
+			got = append(got, u.ID)
+		}
+		next = page.Links.Next
+	}
+
+	if len(got) != len(want) {
+		return fmt.Errorf("pages returned %d users, want %d", len(got), len(want))
+	}
+	for i, u := range want {
+		if got[i] != u.ID {
+			return fmt.Errorf("position %d: got user %s, want %s", i, got[i], u.ID)
+		}
+		if i > 0 {
+			prev := want[i-1]
+			if u.CreatedAt.Before(prev.CreatedAt) || (u.CreatedAt.Equal(prev.CreatedAt) && bytes.Compare(prev.ID[:], u.ID[:]) >= 0) {
+				return fmt.Errorf("position %d: user %s is out of order", i, u.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// runRepositoryBenchmarks compares the sharded repository with the single-lock
+// baseline. Run with `go run . bench`.
+func runRepositoryBenchmarks() {
+	impls := []struct {
+		name string
+		new  func() UserRepository
+	}{
+		{"single-lock", func() UserRepository { return newSingleLockUserRepository() }},
+		{"sharded", func() UserRepository { return newShardedUserRepository() }},
+	}
+	fmt.Printf("%d users, >=%d goroutines, GOMAXPROCS=%d\n", benchUsers, benchGoroutines, runtime.GOMAXPROCS(0))
+	for _, writePercent := range []int{1, 10, 50} {
+		for _, impl := range impls {
+			res := benchmarkRepository(impl.new, writePercent)
+			opsPerSec := float64(res.N) / res.T.Seconds()
+			fmt.Printf("writes=%2d%%  %-12s %10d ops  %8d ns/op  %12.0f ops/s\n",
+				writePercent, impl.name, res.N, res.NsPerOp(), opsPerSec)
+		}
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runRepositoryBenchmarks()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		if err := checkStablePagination(); err != nil {
+			log.Fatalf("selftest: %v", err)
+		}
+		log.Println("selftest: ok")
+		return
+	}
+
 	// Dependency Injection
 	userRepo := NewMemoryUserRepository()
 	userService := NewUserService(userRepo)
 	userHandler := NewUserHandler(userService)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
 	app.Use(logger.New())
 
 	// Register routes
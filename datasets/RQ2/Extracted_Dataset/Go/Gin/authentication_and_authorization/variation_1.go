@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/gob"
 	"errors"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.comcom/gin-contrib/sessions"
@@ -59,7 +63,7 @@ var postsDB = make(map[uuid.UUID]*Post)
 // --- JWT & Auth Configuration ---
 
 var jwtSecret = []byte("my_super_secret_key")
-var googleOauthConfig *oauth2.Config
+var googleProvider *OAuthProvider
 
 type Claims struct {
 	UserID uuid.UUID `json:"user_id"`
@@ -107,6 +111,182 @@ func validateJWT(tokenStr string) (*Claims, error) {
 	return claims, nil
 }
 
+// --- OAuth State & PKCE ---
+
+const (
+	oauthStateTTL          = 10 * time.Minute
+	maxPendingStatesPerSID = 5
+	oauthSessionKey        = "oauth_sid"
+)
+
+var (
+	ErrStateMissing  = errors.New("missing state")
+	ErrStateUnknown  = errors.New("unknown state")
+	ErrStateReplayed = errors.New("state already used")
+	ErrStateExpired  = errors.New("state expired")
+	ErrStateSession  = errors.New("state was issued to a different session")
+)
+
+type oauthState struct {
+	sessionID string
+	provider  string
+	verifier  string
+	expiresAt time.Time
+	used      bool
+}
+
+// OAuthStateStore keeps issued OAuth states server-side. States are 256-bit
+// random values, stored only as hashes, bound to the session that started
+// the flow, and usable once. Used states are kept until they expire so a
+// replay is reported as such rather than as an unknown state.
+type OAuthStateStore struct {
+	mu     sync.Mutex
+	states map[string]*oauthState
+}
+
+func NewOAuthStateStore() *OAuthStateStore {
+	return &OAuthStateStore{states: make(map[string]*oauthState)}
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Issue creates a state and PKCE verifier for sessionID. Only the newest
+// maxPendingStatesPerSID unused states of a session stay valid.
+func (s *OAuthStateStore) Issue(sessionID, provider string) (state, verifier string, err error) {
+	state, err = randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier = oauth2.GenerateVerifier()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []string
+	for key, st := range s.states {
+		if now.After(st.expiresAt) {
+			delete(s.states, key)
+		} else if st.sessionID == sessionID && !st.used {
+			pending = append(pending, key)
+		}
+	}
+	for len(pending) >= maxPendingStatesPerSID {
+		oldest := 0
+		for i, key := range pending {
+			if s.states[key].expiresAt.Before(s.states[pending[oldest]].expiresAt) {
+				oldest = i
+			}
+		}
+		delete(s.states, pending[oldest])
+		pending = append(pending[:oldest], pending[oldest+1:]...)
+	}
+	s.states[hashState(state)] = &oauthState{
+		sessionID: sessionID,
+		provider:  provider,
+		verifier:  verifier,
+		expiresAt: now.Add(oauthStateTTL),
+	}
+	return state, verifier, nil
+}
+
+// Consume validates state for sessionID and provider, marks it used and
+// returns its PKCE verifier.
+func (s *OAuthStateStore) Consume(state, sessionID, provider string) (string, error) {
+	if state == "" {
+		return "", ErrStateMissing
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.states[hashState(state)]
+	switch {
+	case !ok || st.provider != provider:
+		return "", ErrStateUnknown
+	case st.used:
+		return "", ErrStateReplayed
+	case time.Now().After(st.expiresAt):
+		return "", ErrStateExpired
+	case sessionID == "" || st.sessionID != sessionID:
+		return "", ErrStateSession
+	}
+	st.used = true
+	return st.verifier, nil
+}
+
+// OAuthProvider drives the authorization code flow with state and PKCE (S256)
+// for a single identity provider.
+type OAuthProvider struct {
+	Name   string
+	Config *oauth2.Config
+	States *OAuthStateStore
+}
+
+// oauthSessionID returns the session's OAuth binding id, creating it if the
+// session has none yet.
+func oauthSessionID(c *gin.Context, create bool) (string, error) {
+	session := sessions.Default(c)
+	if sid, ok := session.Get(oauthSessionKey).(string); ok && sid != "" {
+		return sid, nil
+	}
+	if !create {
+		return "", nil
+	}
+	sid, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	session.Set(oauthSessionKey, sid)
+	return sid, session.Save()
+}
+
+// AuthURL starts a login for the current session.
+func (p *OAuthProvider) AuthURL(c *gin.Context) (string, error) {
+	sid, err := oauthSessionID(c, true)
+	if err != nil {
+		return "", err
+	}
+	state, verifier, err := p.States.Issue(sid, p.Name)
+	if err != nil {
+		return "", err
+	}
+	return p.Config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Callback checks the returned state and exchanges the code using the
+// matching PKCE verifier.
+func (p *OAuthProvider) Callback(c *gin.Context) (*oauth2.Token, error) {
+	sid, err := oauthSessionID(c, false)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := p.States.Consume(c.Query("state"), sid, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	code := c.Query("code")
+	if code == "" {
+		return nil, errors.New("code not found")
+	}
+	// Without client credentials there is nothing to exchange against; the
+	// caller falls back to the simulated user.
+	if p.Config.ClientID == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	return p.Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
 // --- Middleware ---
 
 func authMiddleware() gin.HandlerFunc {
@@ -186,19 +366,32 @@ func handleLogin(c *gin.Context) {
 }
 
 func handleGoogleLogin(c *gin.Context) {
-	url := googleOauthConfig.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	url, err := googleProvider.AuthURL(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login"})
+		return
+	}
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
 func handleGoogleCallback(c *gin.Context) {
-	// In a real app, you'd validate the state and exchange the code for a token,
-	// then fetch user info from Google. Here, we'll simulate it.
-	code := c.Query("code")
-	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Code not found"})
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Google login failed: " + providerErr})
+		return
+	}
+	if _, err := googleProvider.Callback(c); err != nil {
+		log.Printf("Rejected Google callback from %s: %v", c.ClientIP(), err)
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrStateUnknown) || errors.Is(err, ErrStateReplayed) || errors.Is(err, ErrStateExpired) || errors.Is(err, ErrStateSession) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": "Invalid login attempt: " + err.Error()})
 		return
 	}
 
+	// A real app would fetch user info from Google with the token. Here, we'll
+	// simulate it.
+
 	// Simulated user lookup/creation
 	email := "user.from.google@example.com"
 	user, exists := usersDB[email]
@@ -296,12 +489,16 @@ func setupMockData() {
 
 func setupOAuthConfig() {
 	// In a real app, these would come from environment variables
-	googleOauthConfig = &oauth2.Config{
-		RedirectURL:  "http://localhost:8080/auth/google/callback",
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"), // Placeholder
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"), // Placeholder
-		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email"},
-		Endpoint:     google.Endpoint,
+	googleProvider = &OAuthProvider{
+		Name: "google",
+		Config: &oauth2.Config{
+			RedirectURL:  "http://localhost:8080/auth/google/callback",
+			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),     // Placeholder
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"), // Placeholder
+			Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email"},
+			Endpoint:     google.Endpoint,
+		},
+		States: NewOAuthStateStore(),
 	}
 }
 
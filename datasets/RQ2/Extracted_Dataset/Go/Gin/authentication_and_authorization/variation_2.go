@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/gob"
 	"errors"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/sessions"
@@ -75,15 +79,93 @@ type JWTClaims struct {
 	jwt.RegisteredClaims
 }
 
+// --- OAuth State & PKCE ---
+
+// OAuthProvider is the part of an OAuth2 client the handlers use;
+// *oauth2.Config satisfies it.
+type OAuthProvider interface {
+	AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string
+	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
+}
+
+var (
+	errStateInvalid  = errors.New("invalid state")
+	errStateReplayed = errors.New("state already used")
+	errStateExpired  = errors.New("state expired")
+)
+
+type pendingState struct {
+	binding   string
+	verifier  string
+	expiresAt time.Time
+	usedAt    time.Time
+}
+
+// pendingStates holds issued states keyed by their SHA-256. Each state is
+// bound to a random id stored in the user's session, so a state captured
+// from another browser is useless, and is single-use.
+type pendingStates struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[[32]byte]*pendingState
+}
+
+func newPendingStates(ttl time.Duration) *pendingStates {
+	return &pendingStates{ttl: ttl, items: make(map[[32]byte]*pendingState)}
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *pendingStates) issue(binding string) (state, verifier string, err error) {
+	if state, err = randomString(32); err != nil {
+		return "", "", err
+	}
+	verifier = oauth2.GenerateVerifier()
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, s := range p.items {
+		if now.After(s.expiresAt) {
+			delete(p.items, k)
+		}
+	}
+	p.items[sha256.Sum256([]byte(state))] = &pendingState{binding: binding, verifier: verifier, expiresAt: now.Add(p.ttl)}
+	return state, verifier, nil
+}
+
+func (p *pendingStates) consume(state, binding string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.items[sha256.Sum256([]byte(state))]
+	if !ok || state == "" || binding == "" || s.binding != binding {
+		return "", errStateInvalid
+	}
+	if !s.usedAt.IsZero() {
+		return "", errStateReplayed
+	}
+	if time.Now().After(s.expiresAt) {
+		return "", errStateExpired
+	}
+	s.usedAt = time.Now()
+	return s.verifier, nil
+}
+
 // --- Handlers (OOP Style) ---
 
 type AuthHandler struct {
-	db                *MockDataStore
-	googleOauthConfig *oauth2.Config
+	db          *MockDataStore
+	google      OAuthProvider
+	oauthStates *pendingStates
 }
 
-func NewAuthHandler(db *MockDataStore, oauthConfig *oauth2.Config) *AuthHandler {
-	return &AuthHandler{db: db, googleOauthConfig: oauthConfig}
+func NewAuthHandler(db *MockDataStore, google OAuthProvider) *AuthHandler {
+	return &AuthHandler{db: db, google: google, oauthStates: newPendingStates(10 * time.Minute)}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -119,11 +201,52 @@ func (h *AuthHandler) Login(c *gin.Context) {
 }
 
 func (h *AuthHandler) GoogleLogin(c *gin.Context) {
-	url := h.googleOauthConfig.AuthCodeURL("random-state")
+	session := sessions.Default(c)
+	binding, _ := session.Get("oauth_binding").(string)
+	if binding == "" {
+		var err error
+		if binding, err = randomString(16); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start login"})
+			return
+		}
+		session.Set("oauth_binding", binding)
+		if err := session.Save(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save session"})
+			return
+		}
+	}
+
+	state, verifier, err := h.oauthStates.issue(binding)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not start login"})
+		return
+	}
+	url := h.google.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
 func (h *AuthHandler) GoogleCallback(c *gin.Context) {
+	binding, _ := sessions.Default(c).Get("oauth_binding").(string)
+	verifier, err := h.oauthStates.consume(c.Query("state"), binding)
+	if err != nil {
+		log.Printf("rejected oauth callback from %s: %v", c.ClientIP(), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing code"})
+		return
+	}
+	if os.Getenv("GOOGLE_CLIENT_ID") != "" {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		if _, err := h.google.Exchange(ctx, code, oauth2.VerifierOption(verifier)); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "code exchange failed"})
+			return
+		}
+	}
+
 	// Simulate fetching user from Google and creating/finding them in our DB
 	simulatedEmail := "oauth.user@example.com"
 	user, exists := h.db.users[simulatedEmail]
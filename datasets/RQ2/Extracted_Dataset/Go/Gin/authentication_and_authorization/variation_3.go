@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/gob"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-contrib/sessions"
@@ -68,35 +74,258 @@ func (r *UserRepository) FindByEmail(email string) (*User, error) {
 	}
 	return user, nil
 }
+func (r *UserRepository) FindByID(id uuid.UUID) (*User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
 func (r *UserRepository) Save(user *User) {
 	r.users[user.Email] = user
 }
 
+// APIKey is stored by the SHA-256 of the key; the key itself is only shown
+// once, when it is created.
+type APIKey struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	UserEmail string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{keys: make(map[string]*APIKey)}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a new key for the user and returns it with its record.
+func (r *APIKeyRepository) Create(userEmail, name string) (string, *APIKey, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	key := "ak_" + hex.EncodeToString(b)
+	record := &APIKey{ID: uuid.New(), Name: name, UserEmail: userEmail, CreatedAt: time.Now()}
+	r.mu.Lock()
+	r.keys[hashAPIKey(key)] = record
+	r.mu.Unlock()
+	return key, record, nil
+}
+
+func (r *APIKeyRepository) Find(key string) (*APIKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	record, ok := r.keys[hashAPIKey(key)]
+	return record, ok
+}
+
+// DeviceSession is one signed-in device: a JWT (ID = its jti) or a cookie
+// session (ID = the "sid" stored in the cookie). Revoking it blacklists the
+// token or invalidates the cookie.
+type DeviceSession struct {
+	ID          string     `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Kind        string     `json:"kind"`
+	Device      string     `json:"device"`
+	Fingerprint string     `json:"device_fingerprint"`
+	IP          string     `json:"ip"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"-"`
+}
+
+const (
+	jwtSessionTTL    = 1 * time.Hour
+	cookieSessionTTL = 30 * 24 * time.Hour // the cookie store's default MaxAge
+)
+
+// DeviceInfo is what a login records about the client.
+type DeviceInfo struct {
+	UserAgent      string
+	AcceptLanguage string
+	IP             string
+}
+
+func deviceInfo(c *gin.Context) DeviceInfo {
+	return DeviceInfo{UserAgent: c.Request.UserAgent(), AcceptLanguage: c.GetHeader("Accept-Language"), IP: c.ClientIP()}
+}
+
+// fingerprint groups sessions from the same browser or client. It is a hint
+// for the user, not a security control.
+func (d DeviceInfo) fingerprint() string {
+	sum := sha256.Sum256([]byte(d.UserAgent + "|" + d.AcceptLanguage))
+	return hex.EncodeToString(sum[:8])
+}
+
+type SessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[string]*DeviceSession
+}
+
+func NewSessionRegistry() *SessionRegistry {
+	return &SessionRegistry{sessions: make(map[string]*DeviceSession)}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (r *SessionRegistry) Register(kind string, userID uuid.UUID, device DeviceInfo, ttl time.Duration) (*DeviceSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	label := device.UserAgent
+	if len(label) > 120 {
+		label = label[:120]
+	}
+	now := time.Now()
+	s := &DeviceSession{
+		ID:          id,
+		UserID:      userID,
+		Kind:        kind,
+		Device:      label,
+		Fingerprint: device.fingerprint(),
+		IP:          device.IP,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	r.mu.Lock()
+	r.sessions[id] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+// Touch records use of a session and reports whether it is still valid.
+// Unknown IDs are invalid, so tokens and cookies issued before a restart
+// must sign in again.
+func (r *SessionRegistry) Touch(id string, userID uuid.UUID, ip string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	now := time.Now()
+	if !ok || s.UserID != userID || s.RevokedAt != nil || now.After(s.ExpiresAt) {
+		return false
+	}
+	s.LastSeenAt, s.IP = now, ip
+	return true
+}
+
+// Active lists the user's live sessions, most recently used first.
+func (r *SessionRegistry) Active(userID uuid.UUID) []DeviceSession {
+	r.mu.RLock()
+	now := time.Now()
+	var out []DeviceSession
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil && now.Before(s.ExpiresAt) {
+			out = append(out, *s)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeenAt.After(out[j].LastSeenAt) })
+	return out
+}
+
+// Revoke ends one of the user's sessions and reports whether it existed.
+func (r *SessionRegistry) Revoke(userID uuid.UUID, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[id]
+	if !ok || s.UserID != userID || s.RevokedAt != nil {
+		return false
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	return true
+}
+
+// RevokeOthers ends every session of the user except keepID.
+func (r *SessionRegistry) RevokeOthers(userID uuid.UUID, keepID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for id, s := range r.sessions {
+		if s.UserID == userID && id != keepID && s.RevokedAt == nil && now.Before(s.ExpiresAt) {
+			s.RevokedAt = &now
+			count++
+		}
+	}
+	return count
+}
+
+// StartPruner forgets sessions once they have expired; revoked ones are
+// kept until then so their tokens stay blacklisted.
+func (r *SessionRegistry) StartPruner(interval time.Duration) {
+	go func() {
+		for now := range time.Tick(interval) {
+			r.mu.Lock()
+			for id, s := range r.sessions {
+				if now.After(s.ExpiresAt) {
+					delete(r.sessions, id)
+				}
+			}
+			r.mu.Unlock()
+		}
+	}()
+}
+
 // --- Service Layer (Business Logic) ---
 
 type AuthService struct {
 	userRepo *UserRepository
+	sessions *SessionRegistry
 	jwtKey   []byte
 }
 
-func NewAuthService(userRepo *UserRepository, jwtKey []byte) *AuthService {
-	return &AuthService{userRepo: userRepo, jwtKey: jwtKey}
+func NewAuthService(userRepo *UserRepository, sessions *SessionRegistry, jwtKey []byte) *AuthService {
+	return &AuthService{userRepo: userRepo, sessions: sessions, jwtKey: jwtKey}
 }
 
-func (s *AuthService) Login(email, password string) (string, error) {
+// CheckPassword returns the active user with these credentials.
+func (s *AuthService) CheckPassword(email, password string) (*User, error) {
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil || !user.IsActive {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
+	}
+	return user, nil
+}
+
+func (s *AuthService) Login(email, password string, device DeviceInfo) (string, error) {
+	user, err := s.CheckPassword(email, password)
+	if err != nil {
+		return "", err
+	}
+	session, err := s.sessions.Register("jwt", user.ID, device, jwtSessionTTL)
+	if err != nil {
+		return "", err
 	}
 
-	expirationTime := time.Now().Add(1 * time.Hour)
 	claims := &jwt.MapClaims{
-		"exp":     expirationTime.Unix(),
-		"iat":     time.Now().Unix(),
+		"exp":     session.ExpiresAt.Unix(),
+		"iat":     session.CreatedAt.Unix(),
+		"jti":     session.ID,
 		"user_id": user.ID,
 		"role":    user.Role,
 	}
@@ -122,15 +351,238 @@ func (s *AuthService) ValidateToken(tokenString string) (*jwt.MapClaims, error)
 	return nil, errors.New("invalid token")
 }
 
+// --- Authentication Strategies ---
+
+// Principal is the authenticated caller, whichever strategy vouched for it.
+type Principal struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Email    string    `json:"email"`
+	Role     Role      `json:"role"`
+	Strategy string    `json:"strategy"`
+	// SessionID is the DeviceSession behind a jwt or session login.
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// ErrNoCredentials means the request carries nothing for this strategy, so
+// the chain should try the next one.
+var ErrNoCredentials = errors.New("no credentials for this strategy")
+
+type AuthStrategy interface {
+	Name() string
+	// Authenticate returns ErrNoCredentials if the request has none of this
+	// strategy's credentials; any other error rejects the request.
+	Authenticate(c *gin.Context) (*Principal, error)
+}
+
+func principalFor(user *User, strategy string) (*Principal, error) {
+	if !user.IsActive {
+		return nil, errors.New("account is inactive")
+	}
+	return &Principal{UserID: user.ID, Email: user.Email, Role: user.Role, Strategy: strategy}, nil
+}
+
+// JWTStrategy accepts "Authorization: Bearer <token>".
+type JWTStrategy struct {
+	authService *AuthService
+}
+
+func (s *JWTStrategy) Name() string { return "jwt" }
+
+func (s *JWTStrategy) Authenticate(c *gin.Context) (*Principal, error) {
+	authHeader := c.GetHeader("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	claims, err := s.authService.ValidateToken(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
+	rawID, _ := (*claims)["user_id"].(string)
+	userID, err := uuid.Parse(rawID)
+	if err != nil {
+		return nil, errors.New("invalid token subject")
+	}
+	user, err := s.authService.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("invalid token subject")
+	}
+	jti, _ := (*claims)["jti"].(string)
+	if !s.authService.sessions.Touch(jti, user.ID, c.ClientIP()) {
+		return nil, errors.New("token has been revoked")
+	}
+	p, err := principalFor(user, s.Name())
+	if err != nil {
+		return nil, err
+	}
+	p.SessionID = jti
+	return p, nil
+}
+
+// APIKeyStrategy accepts "X-API-Key: <key>".
+type APIKeyStrategy struct {
+	keys     *APIKeyRepository
+	userRepo *UserRepository
+}
+
+func (s *APIKeyStrategy) Name() string { return "api_key" }
+
+func (s *APIKeyStrategy) Authenticate(c *gin.Context) (*Principal, error) {
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	record, ok := s.keys.Find(key)
+	if !ok {
+		return nil, errors.New("invalid API key")
+	}
+	user, err := s.userRepo.FindByEmail(record.UserEmail)
+	if err != nil {
+		return nil, errors.New("invalid API key")
+	}
+	return principalFor(user, s.Name())
+}
+
+// SessionStrategy accepts the session cookie set by POST /auth/session.
+// Unsafe methods must echo the session's CSRF token in X-CSRF-Token, since
+// browsers attach the cookie to cross-site requests too.
+type SessionStrategy struct {
+	userRepo *UserRepository
+	sessions *SessionRegistry
+}
+
+func (s *SessionStrategy) Name() string { return "session" }
+
+func (s *SessionStrategy) Authenticate(c *gin.Context) (*Principal, error) {
+	session := sessions.Default(c)
+	email, _ := session.Get("user_email").(string)
+	if email == "" {
+		return nil, ErrNoCredentials
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		want, _ := session.Get("csrf_token").(string)
+		if want == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("X-CSRF-Token")), []byte(want)) != 1 {
+			return nil, errors.New("missing or invalid CSRF token")
+		}
+	}
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return nil, errors.New("session user no longer exists")
+	}
+	sid, _ := session.Get("sid").(string)
+	if !s.sessions.Touch(sid, user.ID, c.ClientIP()) {
+		return nil, errors.New("session has been revoked")
+	}
+	p, err := principalFor(user, s.Name())
+	if err != nil {
+		return nil, err
+	}
+	p.SessionID = sid
+	return p, nil
+}
+
+// BasicAuthStrategy accepts HTTP Basic credentials (email and password),
+// meant for internal tools that cannot hold a token.
+type BasicAuthStrategy struct {
+	authService *AuthService
+}
+
+func (s *BasicAuthStrategy) Name() string { return "basic" }
+
+func (s *BasicAuthStrategy) Authenticate(c *gin.Context) (*Principal, error) {
+	email, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	user, err := s.authService.CheckPassword(email, password)
+	if err != nil {
+		return nil, err
+	}
+	return principalFor(user, s.Name())
+}
+
+// StrategyChain tries its strategies in order; the first one that finds
+// credentials decides.
+type StrategyChain struct {
+	strategies []AuthStrategy
+}
+
+func NewStrategyChain(strategies ...AuthStrategy) *StrategyChain {
+	return &StrategyChain{strategies: strategies}
+}
+
+type principalCtxKey struct{}
+
+// Middleware authenticates with the named strategies only, or with all of
+// them when none are named. The Principal is stored in the gin context and
+// in the request context. Nested under another chain middleware, it only
+// re-authenticates if the outer one used a strategy it does not allow.
+func (ch *StrategyChain) Middleware(allowed ...string) gin.HandlerFunc {
+	var active []AuthStrategy
+	for _, s := range ch.strategies {
+		if len(allowed) == 0 || containsString(allowed, s.Name()) {
+			active = append(active, s)
+		}
+	}
+	challenge := `Bearer`
+	for _, s := range active {
+		if s.Name() == "basic" {
+			challenge += `, Basic realm="internal"`
+		}
+	}
+	return func(c *gin.Context) {
+		if p, ok := PrincipalFrom(c.Request.Context()); ok && (len(allowed) == 0 || containsString(allowed, p.Strategy)) {
+			c.Next()
+			return
+		}
+		for _, s := range active {
+			p, err := s.Authenticate(c)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				c.Header("WWW-Authenticate", challenge)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set("principal", p)
+			c.Set("userID", p.UserID)
+			c.Set("userRole", string(p.Role))
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), principalCtxKey{}, p))
+			c.Next()
+			return
+		}
+		c.Header("WWW-Authenticate", challenge)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+	}
+}
+
+// PrincipalFrom returns the caller set by StrategyChain.Middleware.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(*Principal)
+	return p, ok
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
 // --- Handler Layer (HTTP Interface) ---
 
 type AuthHandler struct {
 	authService       *AuthService
+	apiKeys           *APIKeyRepository
 	googleOauthConfig *oauth2.Config
 }
 
-func NewAuthHandler(authSvc *AuthService, oauthCfg *oauth2.Config) *AuthHandler {
-	return &AuthHandler{authService: authSvc, googleOauthConfig: oauthCfg}
+func NewAuthHandler(authSvc *AuthService, apiKeys *APIKeyRepository, oauthCfg *oauth2.Config) *AuthHandler {
+	return &AuthHandler{authService: authSvc, apiKeys: apiKeys, googleOauthConfig: oauthCfg}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -143,7 +595,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Login(loginRequest.Email, loginRequest.Password)
+	token, err := h.authService.Login(loginRequest.Email, loginRequest.Password, deviceInfo(c))
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -151,6 +603,110 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
+// SessionLogin starts a cookie session and returns the CSRF token that
+// unsafe requests in that session must send.
+func (h *AuthHandler) SessionLogin(c *gin.Context) {
+	var loginRequest struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&loginRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.authService.CheckPassword(loginRequest.Email, loginRequest.Password)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	csrfToken := hex.EncodeToString(b)
+	device, err := h.authService.sessions.Register("cookie", user.ID, deviceInfo(c), cookieSessionTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	session := sessions.Default(c)
+	session.Clear()
+	session.Set("user_email", user.Email)
+	session.Set("sid", device.ID)
+	session.Set("csrf_token", csrfToken)
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"csrf_token": csrfToken})
+}
+
+func (h *AuthHandler) SessionLogout(c *gin.Context) {
+	session := sessions.Default(c)
+	if email, ok := session.Get("user_email").(string); ok {
+		if user, err := h.authService.userRepo.FindByEmail(email); err == nil {
+			sid, _ := session.Get("sid").(string)
+			h.authService.sessions.Revoke(user.ID, sid)
+		}
+	}
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
+	if err := session.Save(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear session"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateAPIKey issues an API key for the caller. The key is only returned
+// here.
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required,max=64"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, _ := PrincipalFrom(c.Request.Context())
+	key, record, err := h.apiKeys.Create(p.Email, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"key": key, "api_key": record})
+}
+
+// ListSessions shows the caller's signed-in devices.
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	p, _ := PrincipalFrom(c.Request.Context())
+	list := h.authService.sessions.Active(p.UserID)
+	out := make([]gin.H, 0, len(list))
+	for _, s := range list {
+		out = append(out, gin.H{"session": s, "current": s.ID == p.SessionID})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+// RevokeSession signs one device out.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	p, _ := PrincipalFrom(c.Request.Context())
+	if !h.authService.sessions.Revoke(p.UserID, c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out everywhere except the current device.
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	p, _ := PrincipalFrom(c.Request.Context())
+	n := h.authService.sessions.RevokeOthers(p.UserID, p.SessionID)
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
+
 func (h *AuthHandler) HandleGoogleLogin(c *gin.Context) {
 	url := h.googleOauthConfig.AuthCodeURL("pseudo-random")
 	c.Redirect(http.StatusTemporaryRedirect, url)
@@ -172,25 +728,6 @@ func (h *AuthHandler) HandleGoogleCallback(c *gin.Context) {
 
 // --- Middleware ---
 
-func AuthMiddleware(authService *AuthService) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			return
-		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := authService.ValidateToken(tokenString)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			return
-		}
-		c.Set("userID", (*claims)["user_id"])
-		c.Set("userRole", (*claims)["role"])
-		c.Next()
-	}
-}
-
 func RoleMiddleware(requiredRole Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("userRole")
@@ -213,7 +750,10 @@ func main() {
 
 	// --- Dependency Injection ---
 	userRepo := NewUserRepository()
-	authService := NewAuthService(userRepo, []byte("service_layer_secret"))
+	apiKeyRepo := NewAPIKeyRepository()
+	sessionRegistry := NewSessionRegistry()
+	sessionRegistry.StartPruner(10 * time.Minute)
+	authService := NewAuthService(userRepo, sessionRegistry, []byte("service_layer_secret"))
 	googleOauthConfig := &oauth2.Config{
 		RedirectURL:  "http://localhost:8080/auth/google/callback",
 		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
@@ -221,7 +761,13 @@ func main() {
 		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.profile"},
 		Endpoint:     google.Endpoint,
 	}
-	authHandler := NewAuthHandler(authService, googleOauthConfig)
+	authHandler := NewAuthHandler(authService, apiKeyRepo, googleOauthConfig)
+	authChain := NewStrategyChain(
+		&JWTStrategy{authService: authService},
+		&APIKeyStrategy{keys: apiKeyRepo, userRepo: userRepo},
+		&SessionStrategy{userRepo: userRepo, sessions: sessionRegistry},
+		&BasicAuthStrategy{authService: authService},
+	)
 
 	// --- Seed Data ---
 	adminPass, _ := bcrypt.GenerateFromPassword([]byte("secureadmin"), 12)
@@ -241,12 +787,15 @@ func main() {
 	authRoutes := r.Group("/auth")
 	{
 		authRoutes.POST("/login", authHandler.Login)
+		authRoutes.POST("/session", authHandler.SessionLogin)
+		authRoutes.DELETE("/session", authHandler.SessionLogout)
 		authRoutes.GET("/google/login", authHandler.HandleGoogleLogin)
 		authRoutes.GET("/google/callback", authHandler.HandleGoogleCallback)
 	}
 
+	// Basic auth is for internal tools only, so the public API leaves it out.
 	api := r.Group("/api")
-	api.Use(AuthMiddleware(authService))
+	api.Use(authChain.Middleware("jwt", "api_key", "session"))
 	{
 		api.GET("/posts", func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"message": "List of posts for any authenticated user"})
@@ -255,9 +804,20 @@ func main() {
 			userID, _ := c.Get("userID")
 			c.JSON(http.StatusCreated, gin.H{"message": "Post created successfully", "creator_id": userID})
 		})
+		api.GET("/me", func(c *gin.Context) {
+			p, _ := PrincipalFrom(c.Request.Context())
+			c.JSON(http.StatusOK, p)
+		})
+		// An API key cannot mint further keys.
+		api.POST("/keys", authChain.Middleware("jwt", "session"), authHandler.CreateAPIKey)
+
+		mySessions := api.Group("/users/me/sessions", authChain.Middleware("jwt", "session"))
+		mySessions.GET("", authHandler.ListSessions)
+		mySessions.DELETE("", authHandler.RevokeOtherSessions)
+		mySessions.DELETE("/:id", authHandler.RevokeSession)
 
 		adminApi := api.Group("/admin")
-		adminApi.Use(RoleMiddleware(ADMIN))
+		adminApi.Use(authChain.Middleware("jwt", "session"), RoleMiddleware(ADMIN))
 		{
 			adminApi.GET("/users", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "List of all users for admin"})
@@ -265,6 +825,14 @@ func main() {
 		}
 	}
 
+	internal := r.Group("/internal")
+	internal.Use(authChain.Middleware("basic"), RoleMiddleware(ADMIN))
+	{
+		internal.GET("/status", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		})
+	}
+
 	log.Println("Server with Service Layer pattern is running on port 8080")
 	if err := r.Run(":8080"); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
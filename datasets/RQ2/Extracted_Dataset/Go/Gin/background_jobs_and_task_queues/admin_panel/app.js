@@ -0,0 +1,69 @@
+// Each section names the admin JSON API it renders. The browser already
+// holds the Basic credentials it used to load this page and sends them with
+// every API call.
+(function () {
+  "use strict";
+
+  function rowsOf(payload) {
+    if (Array.isArray(payload)) return payload;
+    if (payload && Array.isArray(payload.data)) return payload.data;
+    if (payload && payload.data && typeof payload.data === "object") return [payload.data];
+    return payload && typeof payload === "object" ? [payload] : [];
+  }
+
+  function cell(value) {
+    if (value === null || value === undefined) return "";
+    return typeof value === "object" ? JSON.stringify(value) : String(value);
+  }
+
+  function table(rows) {
+    if (rows.length === 0) {
+      var empty = document.createElement("p");
+      empty.className = "muted";
+      empty.textContent = "Nothing to show.";
+      return empty;
+    }
+    var columns = Object.keys(rows[0]);
+    var t = document.createElement("table");
+    var head = t.createTHead().insertRow();
+    columns.forEach(function (c) {
+      var th = document.createElement("th");
+      th.textContent = c;
+      head.appendChild(th);
+    });
+    var body = t.createTBody();
+    rows.forEach(function (r) {
+      var tr = body.insertRow();
+      columns.forEach(function (c) {
+        tr.insertCell().textContent = cell(r[c]);
+      });
+    });
+    return t;
+  }
+
+  function load(section) {
+    var target = section.querySelector(".body");
+    return fetch(section.dataset.source, { credentials: "same-origin", headers: { Accept: "application/json" } })
+      .then(function (res) {
+        if (res.status === 401 || res.status === 403) throw new Error("admin access required");
+        if (!res.ok) throw new Error("HTTP " + res.status);
+        return res.json();
+      })
+      .then(function (payload) {
+        target.replaceChildren(table(rowsOf(payload)));
+      })
+      .catch(function (err) {
+        var p = document.createElement("p");
+        p.className = "muted";
+        p.textContent = "Unavailable: " + err.message;
+        target.replaceChildren(p);
+      });
+  }
+
+  function refresh() {
+    document.querySelectorAll("section[data-source]").forEach(load);
+  }
+
+  document.getElementById("refresh").addEventListener("click", refresh);
+  refresh();
+})();
@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -82,6 +87,176 @@ type ReportGenerationPayload struct {
 	ReportDate string `json:"report_date"`
 }
 
+// --- SHADOW MIRRORING ---
+
+// QueueShadow receives mirrored copies of production enqueues. Its tasks run
+// through shadowMiddleware so they never cause real side effects.
+const QueueShadow = "shadow"
+
+type ShadowMode string
+
+const (
+	ShadowModeNoop   ShadowMode = "noop"    // acknowledge without calling the handler
+	ShadowModeDryRun ShadowMode = "dry-run" // call the handler with IsDryRun(ctx) == true
+)
+
+type ShadowConfig struct {
+	Enabled bool
+	Percent int // 0-100 share of enqueues that are mirrored
+	Mode    ShadowMode
+}
+
+// loadShadowConfig reads SHADOW_PERCENT and SHADOW_MODE; mirroring stays off unless
+// a positive percentage is given.
+func loadShadowConfig() ShadowConfig {
+	cfg := ShadowConfig{Mode: ShadowModeDryRun}
+	if pct, err := strconv.Atoi(os.Getenv("SHADOW_PERCENT")); err == nil && pct > 0 {
+		if pct > 100 {
+			pct = 100
+		}
+		cfg.Enabled = true
+		cfg.Percent = pct
+	}
+	if mode := ShadowMode(os.Getenv("SHADOW_MODE")); mode == ShadowModeNoop || mode == ShadowModeDryRun {
+		cfg.Mode = mode
+	}
+	return cfg
+}
+
+type dryRunKey struct{}
+
+// IsDryRun reports whether the handler is executing a shadow copy and must skip side effects.
+func IsDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunKey{}).(bool)
+	return v
+}
+
+// ShadowingClient wraps asynq.Client and mirrors a sample of enqueues into QueueShadow.
+type ShadowingClient struct {
+	*asynq.Client
+	cfg ShadowConfig
+}
+
+func NewShadowingClient(client *asynq.Client, cfg ShadowConfig) *ShadowingClient {
+	return &ShadowingClient{Client: client, cfg: cfg}
+}
+
+func (c *ShadowingClient) Enqueue(task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	info, err := c.Client.Enqueue(task, opts...)
+	if err != nil || !c.cfg.Enabled || rand.Intn(100) >= c.cfg.Percent {
+		return info, err
+	}
+
+	// The shadow copy must never fail the primary request, and must not retry,
+	// so it is enqueued with its own minimal options.
+	shadow := asynq.NewTask(task.Type(), task.Payload())
+	if _, serr := c.Client.Enqueue(shadow, asynq.Queue(QueueShadow), asynq.MaxRetry(0)); serr != nil {
+		log.Printf("shadow: failed to mirror %s task %s: %v", task.Type(), info.ID, serr)
+	}
+	return info, nil
+}
+
+type outcomeStats struct {
+	Processed     int64         `json:"processed"`
+	Failed        int64         `json:"failed"`
+	TotalDuration time.Duration `json:"-"`
+}
+
+func (o outcomeStats) summary() gin.H {
+	h := gin.H{"processed": o.Processed, "failed": o.Failed}
+	if o.Processed > 0 {
+		h["failure_rate"] = float64(o.Failed) / float64(o.Processed)
+		h["avg_duration_ms"] = float64(o.TotalDuration.Milliseconds()) / float64(o.Processed)
+	}
+	return h
+}
+
+// ShadowMetrics compares primary and shadow outcomes per task type.
+type ShadowMetrics struct {
+	mu      sync.Mutex
+	primary map[string]*outcomeStats
+	shadow  map[string]*outcomeStats
+}
+
+func NewShadowMetrics() *ShadowMetrics {
+	return &ShadowMetrics{
+		primary: make(map[string]*outcomeStats),
+		shadow:  make(map[string]*outcomeStats),
+	}
+}
+
+func (m *ShadowMetrics) record(shadow bool, taskType string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket := m.primary
+	if shadow {
+		bucket = m.shadow
+	}
+	stats, ok := bucket[taskType]
+	if !ok {
+		stats = &outcomeStats{}
+		bucket[taskType] = stats
+	}
+	stats.Processed++
+	stats.TotalDuration += d
+	if err != nil {
+		stats.Failed++
+	}
+}
+
+func (m *ShadowMetrics) Snapshot() gin.H {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	types := make(map[string]struct{})
+	for t := range m.primary {
+		types[t] = struct{}{}
+	}
+	for t := range m.shadow {
+		types[t] = struct{}{}
+	}
+	out := gin.H{}
+	for t := range types {
+		var primary, shadow outcomeStats
+		if s, ok := m.primary[t]; ok {
+			primary = *s
+		}
+		if s, ok := m.shadow[t]; ok {
+			shadow = *s
+		}
+		out[t] = gin.H{"primary": primary.summary(), "shadow": shadow.summary()}
+	}
+	return out
+}
+
+// shadowMiddleware routes tasks from QueueShadow to a no-op or dry-run execution
+// and records the outcome of every task for the primary/shadow comparison.
+func shadowMiddleware(cfg ShadowConfig, metrics *ShadowMetrics) asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			queue, _ := asynq.GetQueueName(ctx)
+			isShadow := queue == QueueShadow
+
+			start := time.Now()
+			var err error
+			switch {
+			case isShadow && cfg.Mode == ShadowModeNoop:
+				// Nothing to do: only the arrival rate is measured.
+			case isShadow:
+				err = next.ProcessTask(context.WithValue(ctx, dryRunKey{}, true), t)
+			default:
+				err = next.ProcessTask(ctx, t)
+			}
+			metrics.record(isShadow, t.Type(), time.Since(start), err)
+
+			if isShadow && err != nil {
+				// Shadow failures are only interesting as metrics; never retry them.
+				return fmt.Errorf("shadow run failed: %v: %w", err, asynq.SkipRetry)
+			}
+			return err
+		})
+	}
+}
+
 // --- TASK HANDLERS (WORKERS) ---
 
 func HandleWelcomeEmailTask(ctx context.Context, t *asynq.Task) error {
@@ -97,6 +272,12 @@ func HandleWelcomeEmailTask(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("user not found: %s", p.UserID)
 	}
 
+	if IsDryRun(ctx) {
+		log.Printf("[dry-run] Would send welcome email to %s", user.Email)
+		time.Sleep(2 * time.Second)
+		return nil
+	}
+
 	log.Printf("Sending welcome email to %s (User ID: %s)", user.Email, user.ID)
 	// Simulate email sending
 	time.Sleep(2 * time.Second)
@@ -105,6 +286,10 @@ func HandleWelcomeEmailTask(ctx context.Context, t *asynq.Task) error {
 }
 
 func HandleImageProcessTask(ctx context.Context, t *asynq.Task) error {
+	if IsDryRun(ctx) {
+		return dryRunImageProcess(t)
+	}
+
 	taskInfo := asynq.GetTaskInfo(ctx)
 	jobID := taskInfo.ID
 	
@@ -138,6 +323,20 @@ func HandleImageProcessTask(ctx context.Context, t *asynq.Task) error {
 	return nil
 }
 
+// dryRunImageProcess exercises the same work as HandleImageProcessTask without
+// touching jobStatus, so shadow copies do not overwrite the real job's state.
+func dryRunImageProcess(t *asynq.Task) error {
+	var p ImageProcessPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	time.Sleep(5 * time.Second)
+	if rand.Intn(10) < 3 {
+		return fmt.Errorf("simulated image processing failure")
+	}
+	return nil
+}
+
 func HandleReportGenerationTask(ctx context.Context, t *asynq.Task) error {
 	var p ReportGenerationPayload
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
@@ -149,17 +348,86 @@ func HandleReportGenerationTask(ctx context.Context, t *asynq.Task) error {
 	return nil
 }
 
+// --- AUTHENTICATION ---
+// Requests may carry HTTP Basic credentials (email and password). Requests
+// without them are anonymous; wrong ones are rejected.
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+const currentUserKey = "currentUser"
+
+func authenticate(email, password string) (User, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, user := range users {
+		if strings.EqualFold(user.Email, email) && user.IsActive &&
+			subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte("hashed_"+password)) == 1 {
+			return user, nil
+		}
+	}
+	return User{}, errInvalidCredentials
+}
+
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if email, password, ok := c.Request.BasicAuth(); ok {
+			user, err := authenticate(email, password)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Basic realm="api"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set(currentUserKey, user)
+		}
+		c.Next()
+	}
+}
+
+// requireRole lets only authenticated users with role through. Anonymous
+// requests are challenged, so a browser asks for credentials.
+func requireRole(role UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(currentUserKey)
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if user, _ := v.(User); user.Role != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// seedAdmin creates an ADMIN user from ADMIN_EMAIL and ADMIN_PASSWORD. Without
+// both there is no admin, and the admin routes are closed.
+func seedAdmin() {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; no admin user")
+		return
+	}
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: "hashed_" + password, Role: AdminRole, IsActive: true, CreatedAt: time.Now()}
+	mu.Lock()
+	users[admin.ID] = admin
+	mu.Unlock()
+}
+
 // --- API SERVICE LAYER ---
 
 type APIService struct {
-	JobClient *asynq.Client
+	JobClient *ShadowingClient
 	JobInspector *asynq.Inspector
+	ShadowMetrics *ShadowMetrics
 }
 
-func NewAPIService(redisOpt asynq.RedisClientOpt) *APIService {
+func NewAPIService(redisOpt asynq.RedisClientOpt, shadowCfg ShadowConfig, shadowMetrics *ShadowMetrics) *APIService {
 	return &APIService{
-		JobClient: asynq.NewClient(redisOpt),
+		JobClient: NewShadowingClient(asynq.NewClient(redisOpt), shadowCfg),
 		JobInspector: asynq.NewInspector(redisOpt),
+		ShadowMetrics: shadowMetrics,
 	}
 }
 
@@ -260,11 +528,22 @@ func (s *APIService) GetJobStatusHandler(c *gin.Context) {
 	})
 }
 
+func (s *APIService) ShadowMetricsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":      s.JobClient.cfg.Enabled,
+		"percent":      s.JobClient.cfg.Percent,
+		"mode":         s.JobClient.cfg.Mode,
+		"task_metrics": s.ShadowMetrics.Snapshot(),
+	})
+}
+
 // --- MAIN APPLICATION ---
 
 func main() {
 	// NOTE: Requires a running Redis server on localhost:6379
 	redisOpt := asynq.RedisClientOpt{Addr: "localhost:6379"}
+	shadowCfg := loadShadowConfig()
+	shadowMetrics := NewShadowMetrics()
 
 	// Start the background worker server
 	go func() {
@@ -276,6 +555,7 @@ func main() {
 					"critical": 6,
 					"emails":   3,
 					"images":   1,
+					QueueShadow: 1,
 				},
 				// Custom retry delay: 10s, 40s, 90s for 3 retries
 				RetryDelayFunc: func(n int, e error, t *asynq.Task) time.Duration {
@@ -285,6 +565,7 @@ func main() {
 		)
 
 		mux := asynq.NewServeMux()
+		mux.Use(shadowMiddleware(shadowCfg, shadowMetrics))
 		mux.HandleFunc(TypeEmailWelcome, HandleWelcomeEmailTask)
 		mux.HandleFunc(TypeImageProcess, HandleImageProcessTask)
 		mux.HandleFunc(TypeReportGenerate, HandleReportGenerationTask)
@@ -310,8 +591,10 @@ func main() {
 	}()
 
 	// Setup Gin HTTP server
-	service := NewAPIService(redisOpt)
+	seedAdmin()
+	service := NewAPIService(redisOpt, shadowCfg, shadowMetrics)
 	router := gin.Default()
+	router.Use(authMiddleware())
 	
 	api := router.Group("/api")
 	{
@@ -319,6 +602,10 @@ func main() {
 		api.POST("/posts/:id/image", service.ProcessImageHandler)
 		api.GET("/jobs/:id", service.GetJobStatusHandler)
 	}
+	admin := api.Group("/admin", requireRole(AdminRole))
+	{
+		admin.GET("/shadow/metrics", service.ShadowMetricsHandler)
+	}
 
 	log.Println("Starting Gin server on :8080")
 	if err := router.Run(":8080"); err != nil {
@@ -1,24 +1,42 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io/fs"
 	"log"
-	"math/rand"
+	"mime"
 	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 )
 
 // --- DEPENDENCIES ---
 // go get github.com/gin-gonic/gin
 // go get github.com/google/uuid
 // go get github.com/hibiken/asynq
+// go get github.com/redis/go-redis/v9
 
 // --- DOMAIN & MOCKS ---
 
@@ -63,6 +81,519 @@ const (
 	TaskCleanupOldDrafts = "task:cleanup_old_drafts"
 )
 
+// --- BATCH ENQUEUE ---
+// A batch is all-or-nothing. Its tasks are enqueued with IDs "batch:<id>:<n>"
+// while a Redis marker says "staging"; the marker flips to "committed" only
+// after every enqueue succeeded. batchGuardMiddleware holds staged tasks back
+// and drops tasks of aborted batches. Each member run pushes the committed
+// marker's expiry out again; a task whose marker is gone fails its attempt
+// rather than being dropped, so it ends up archived where it can be seen.
+
+const (
+	maxBatchSize        = 100
+	batchStateStaging   = "staging"
+	batchStateCommitted = "committed"
+	batchStateAborted   = "aborted"
+	batchStagingTTL     = 10 * time.Minute
+	batchStateTTL       = 24 * time.Hour
+)
+
+// Task types clients may submit through the batch API.
+var batchableTasks = map[string]bool{
+	TaskSendWelcomeEmail: true,
+	TaskProcessPostImage: true,
+}
+
+var (
+	errBatchNotCommitted = errors.New("batch not committed yet")
+	errBatchStateMissing = errors.New("batch state missing")
+)
+
+type BatchTaskRequest struct {
+	Type             string          `json:"type" binding:"required"`
+	Payload          json.RawMessage `json:"payload"`
+	Queue            string          `json:"queue"`
+	MaxRetry         *int            `json:"max_retry"`
+	ProcessInSeconds int             `json:"process_in_seconds"`
+}
+
+func batchStateKey(batchID string) string {
+	return "batch:" + batchID + ":state"
+}
+
+func batchTaskID(batchID string, n int) string {
+	return fmt.Sprintf("batch:%s:%d", batchID, n)
+}
+
+// batchIDFromTaskID returns the batch a task belongs to, if any.
+func batchIDFromTaskID(taskID string) (string, bool) {
+	parts := strings.Split(taskID, ":")
+	if len(parts) != 3 || parts[0] != "batch" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+type enqueuedTask struct {
+	queue string
+	id    string
+}
+
+// --- FEATURE FLAGS ---
+// Flags live in the Redis hash "flags" (field = flag key, value = JSON) and
+// every change is announced on "flags:changed". Each process keeps all flags
+// in memory and reloads a flag when told it changed, so evaluation never
+// touches Redis. A full reload every flagRefreshInterval covers missed
+// notifications.
+
+const (
+	flagsHashKey        = "flags"
+	flagsChannel        = "flags:changed"
+	flagRefreshInterval = 30 * time.Second
+)
+
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// FlagRule targets subjects by attribute. Empty lists match everything; a
+// subject must match every non-empty list. Percentage of the matching
+// subjects get the flag (0 excludes them outright).
+type FlagRule struct {
+	Roles        []UserRole `json:"roles,omitempty"`
+	Tenants      []string   `json:"tenants,omitempty"`
+	EmailDomains []string   `json:"email_domains,omitempty"`
+	Percentage   int        `json:"percentage"`
+}
+
+// Flag is off for everyone while Enabled is false. Otherwise the first
+// matching rule decides, and subjects no rule matches fall back to
+// Percentage; a plain boolean flag is Enabled with Percentage 100.
+type Flag struct {
+	Key         string     `json:"key"`
+	Description string     `json:"description,omitempty"`
+	Enabled     bool       `json:"enabled"`
+	Percentage  int        `json:"percentage"`
+	Rules       []FlagRule `json:"rules,omitempty"`
+	Version     int        `json:"version"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (f *Flag) Validate() error {
+	if !flagKeyPattern.MatchString(f.Key) {
+		return errors.New("key must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return errors.New("percentage must be between 0 and 100")
+	}
+	for i, r := range f.Rules {
+		if r.Percentage < 0 || r.Percentage > 100 {
+			return fmt.Errorf("rules[%d]: percentage must be between 0 and 100", i)
+		}
+	}
+	return nil
+}
+
+// FlagSubject is who a flag is evaluated for.
+type FlagSubject struct {
+	UserID string
+	Role   UserRole
+	Tenant string
+	Email  string
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r FlagRule) matches(s FlagSubject) bool {
+	if len(r.Roles) > 0 {
+		found := false
+		for _, role := range r.Roles {
+			found = found || role == s.Role
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Tenants) > 0 && !containsFold(r.Tenants, s.Tenant) {
+		return false
+	}
+	if len(r.EmailDomains) > 0 {
+		at := strings.LastIndex(s.Email, "@")
+		if at < 0 || !containsFold(r.EmailDomains, s.Email[at+1:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// inRollout buckets a subject into 0-99, stable per flag, so raising a
+// percentage only ever adds subjects. Anonymous subjects only get full
+// rollouts.
+func inRollout(flagKey, userID string, percentage int) bool {
+	if percentage >= 100 {
+		return true
+	}
+	if percentage <= 0 || userID == "" {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(flagKey + ":" + userID))
+	return int(h.Sum32()%100) < percentage
+}
+
+func (f *Flag) Evaluate(s FlagSubject) bool {
+	if !f.Enabled {
+		return false
+	}
+	for _, r := range f.Rules {
+		if r.matches(s) {
+			return inRollout(f.Key, s.UserID, r.Percentage)
+		}
+	}
+	return inRollout(f.Key, s.UserID, f.Percentage)
+}
+
+type FlagStore struct {
+	rdb   *redis.Client
+	mu    sync.RWMutex
+	flags map[string]*Flag
+}
+
+func NewFlagStore(rdb *redis.Client) *FlagStore {
+	return &FlagStore{rdb: rdb, flags: make(map[string]*Flag)}
+}
+
+func (s *FlagStore) reloadAll(ctx context.Context) error {
+	raw, err := s.rdb.HGetAll(ctx, flagsHashKey).Result()
+	if err != nil {
+		return err
+	}
+	flags := make(map[string]*Flag, len(raw))
+	for key, value := range raw {
+		var f Flag
+		if err := json.Unmarshal([]byte(value), &f); err != nil {
+			log.Printf("WARN: ignoring malformed flag %s: %v", key, err)
+			continue
+		}
+		flags[key] = &f
+	}
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *FlagStore) reload(ctx context.Context, key string) error {
+	value, err := s.rdb.HGet(ctx, flagsHashKey, key).Result()
+	if errors.Is(err, redis.Nil) {
+		s.mu.Lock()
+		delete(s.flags, key)
+		s.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f Flag
+	if err := json.Unmarshal([]byte(value), &f); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.flags[key] = &f
+	s.mu.Unlock()
+	return nil
+}
+
+// Start loads every flag, then keeps the cache current until ctx ends.
+func (s *FlagStore) Start(ctx context.Context) error {
+	if err := s.reloadAll(ctx); err != nil {
+		return err
+	}
+	sub := s.rdb.Subscribe(ctx, flagsChannel)
+	go func() {
+		defer sub.Close()
+		ticker := time.NewTicker(flagRefreshInterval)
+		defer ticker.Stop()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if err := s.reload(ctx, msg.Payload); err != nil {
+					log.Printf("WARN: could not reload flag %s: %v", msg.Payload, err)
+				}
+			case <-ticker.C:
+				if err := s.reloadAll(ctx); err != nil {
+					log.Printf("WARN: could not refresh flags: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *FlagStore) Get(key string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[key]
+	if !ok {
+		return Flag{}, false
+	}
+	return *f, true
+}
+
+func (s *FlagStore) List() []Flag {
+	s.mu.RLock()
+	out := make([]Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		out = append(out, *f)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Put stores f and notifies every process, this one included.
+func (s *FlagStore) Put(ctx context.Context, f Flag) (Flag, error) {
+	if prev, ok := s.Get(f.Key); ok {
+		f.Version = prev.Version + 1
+	} else {
+		f.Version = 1
+	}
+	f.UpdatedAt = time.Now().UTC()
+	value, err := json.Marshal(f)
+	if err != nil {
+		return f, err
+	}
+	if err := s.rdb.HSet(ctx, flagsHashKey, f.Key, value).Err(); err != nil {
+		return f, err
+	}
+	s.mu.Lock()
+	s.flags[f.Key] = &f
+	s.mu.Unlock()
+	return f, s.rdb.Publish(ctx, flagsChannel, f.Key).Err()
+}
+
+func (s *FlagStore) Delete(ctx context.Context, key string) (bool, error) {
+	n, err := s.rdb.HDel(ctx, flagsHashKey, key).Result()
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	delete(s.flags, key)
+	s.mu.Unlock()
+	return n > 0, s.rdb.Publish(ctx, flagsChannel, key).Err()
+}
+
+// Flags evaluates flags for one subject. Handlers get it with FlagsFrom.
+type Flags struct {
+	store   *FlagStore
+	subject FlagSubject
+}
+
+// Enabled reports whether key is on for the subject; def is returned when
+// the flag does not exist, so code can ship before its flag.
+func (f Flags) Enabled(key string, def bool) bool {
+	if f.store == nil {
+		return def
+	}
+	flag, ok := f.store.Get(key)
+	if !ok {
+		return def
+	}
+	return flag.Evaluate(f.subject)
+}
+
+type flagsCtxKey struct{}
+
+func WithFlags(ctx context.Context, f Flags) context.Context {
+	return context.WithValue(ctx, flagsCtxKey{}, f)
+}
+
+// FlagsFrom never fails: without flags in ctx every flag takes its default.
+func FlagsFrom(ctx context.Context) Flags {
+	f, _ := ctx.Value(flagsCtxKey{}).(Flags)
+	return f
+}
+
+// --- AUTHENTICATION ---
+// Requests may carry HTTP Basic credentials (email and password). Requests
+// without them are anonymous; wrong ones are rejected.
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+const currentUserKey = "currentUser"
+
+func authenticate(email, password string) (User, error) {
+	storeMutex.RLock()
+	defer storeMutex.RUnlock()
+	for _, user := range userStore {
+		if strings.EqualFold(user.Email, email) && user.IsActive &&
+			subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte("hashed:"+password)) == 1 {
+			return user, nil
+		}
+	}
+	return User{}, errInvalidCredentials
+}
+
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if email, password, ok := c.Request.BasicAuth(); ok {
+			user, err := authenticate(email, password)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Basic realm="api"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set(currentUserKey, user)
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the authenticated user; ok is false for anonymous
+// requests.
+func currentUser(c *gin.Context) (User, bool) {
+	v, ok := c.Get(currentUserKey)
+	user, _ := v.(User)
+	return user, ok
+}
+
+// requireRole lets only authenticated users with role through. Anonymous
+// requests are challenged, so a browser asks for credentials.
+func requireRole(role UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if user.Role != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// seedAdmin creates an ADMIN user from ADMIN_EMAIL and ADMIN_PASSWORD. Without
+// both there is no admin, and the ADMIN routes are closed.
+func seedAdmin() {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; no admin user")
+		return
+	}
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: "hashed:" + password, Role: ADMIN, IsActive: true, CreatedAt: time.Now().UTC()}
+	storeMutex.Lock()
+	userStore[admin.ID] = admin
+	storeMutex.Unlock()
+}
+
+// flagsMiddleware evaluates flags for the authenticated user. Anonymous
+// requests get an empty subject. Users have no tenant, so rules that target
+// tenants never match here.
+func flagsMiddleware(store *FlagStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var subject FlagSubject
+		if user, ok := currentUser(c); ok {
+			subject = FlagSubject{UserID: user.ID.String(), Role: user.Role, Email: user.Email}
+		}
+		c.Request = c.Request.WithContext(WithFlags(c.Request.Context(), Flags{store: store, subject: subject}))
+		c.Next()
+	}
+}
+
+// flagsTaskMiddleware evaluates flags for the user a task is about, taken
+// from a "user_id" field in the payload when there is one.
+func flagsTaskMiddleware(store *FlagStore) asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			var subject FlagSubject
+			var payload struct {
+				UserID string `json:"user_id"`
+			}
+			if json.Unmarshal(t.Payload(), &payload) == nil && payload.UserID != "" {
+				subject.UserID = payload.UserID
+				if id, err := uuid.Parse(payload.UserID); err == nil {
+					storeMutex.RLock()
+					if user, ok := userStore[id]; ok {
+						subject.Role, subject.Email = user.Role, user.Email
+					}
+					storeMutex.RUnlock()
+				}
+			}
+			return next.ProcessTask(WithFlags(ctx, Flags{store: store, subject: subject}), t)
+		})
+	}
+}
+
+func listFlagsHandler(store *FlagStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"flags": store.List()})
+	}
+}
+
+func getFlagHandler(store *FlagStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		flag, ok := store.Get(c.Param("key"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "flag not found"})
+			return
+		}
+		c.JSON(http.StatusOK, flag)
+	}
+}
+
+// putFlagHandler creates or replaces a flag.
+func putFlagHandler(store *FlagStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var flag Flag
+		if err := c.ShouldBindJSON(&flag); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		flag.Key = c.Param("key")
+		if err := flag.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		saved, err := store.Put(c.Request.Context(), flag)
+		if err != nil {
+			log.Printf("ERROR: could not save flag %s: %v", flag.Key, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not save flag"})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+func deleteFlagHandler(store *FlagStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		found, err := store.Delete(c.Request.Context(), c.Param("key"))
+		if err != nil {
+			log.Printf("ERROR: could not delete flag %s: %v", c.Param("key"), err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not delete flag"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "flag not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
 // --- FUNCTIONAL HANDLERS ---
 
 func createUserHandler(client *asynq.Client) gin.HandlerFunc {
@@ -89,11 +620,13 @@ func createUserHandler(client *asynq.Client) gin.HandlerFunc {
 		userStore[newUser.ID] = newUser
 		storeMutex.Unlock()
 
-		payload, _ := json.Marshal(gin.H{"user_id": newUser.ID.String()})
-		task := asynq.NewTask(TaskSendWelcomeEmail, payload)
-		if _, err := client.Enqueue(task); err != nil {
-			log.Printf("ERROR: could not enqueue welcome email task: %v", err)
-			// Non-fatal, user is already created
+		if FlagsFrom(c.Request.Context()).Enabled("welcome-email", true) {
+			payload, _ := json.Marshal(gin.H{"user_id": newUser.ID.String()})
+			task := asynq.NewTask(TaskSendWelcomeEmail, payload)
+			if _, err := client.Enqueue(task); err != nil {
+				log.Printf("ERROR: could not enqueue welcome email task: %v", err)
+				// Non-fatal, user is already created
+			}
 		}
 
 		c.JSON(http.StatusCreated, newUser)
@@ -112,7 +645,7 @@ func processImageHandler(client *asynq.Client) gin.HandlerFunc {
 		task := asynq.NewTask(TaskProcessPostImage, payload)
 		
 		// Retry up to 3 times with default exponential backoff
-		info, err := client.Enqueue(task, asynq.MaxRetry(3), asynq.Timeout(2*time.Minute))
+		info, err := client.Enqueue(task, asynq.MaxRetry(3), asynq.Timeout(2*time.Minute), asynq.Retention(jobRetention))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to schedule image processing"})
 			return
@@ -126,34 +659,803 @@ func processImageHandler(client *asynq.Client) gin.HandlerFunc {
 	}
 }
 
+func batchEnqueueHandler(client *asynq.Client, inspector *asynq.Inspector, rdb *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Tasks []BatchTaskRequest `json:"tasks" binding:"required,dive"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.Tasks) == 0 || len(input.Tasks) > maxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch must contain between 1 and %d tasks", maxBatchSize)})
+			return
+		}
+		for i, t := range input.Tasks {
+			if !batchableTasks[t.Type] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tasks[%d]: unsupported task type %q", i, t.Type)})
+				return
+			}
+			if len(t.Payload) > 0 && !json.Valid(t.Payload) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("tasks[%d]: payload is not valid JSON", i)})
+				return
+			}
+		}
+
+		ctx := c.Request.Context()
+		batchID := uuid.NewString()
+		if err := rdb.Set(ctx, batchStateKey(batchID), batchStateStaging, batchStagingTTL).Err(); err != nil {
+			log.Printf("ERROR: could not stage batch %s: %v", batchID, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not start batch"})
+			return
+		}
+
+		// A delayed member must still find the marker when it first runs.
+		stateTTL := batchStateTTL
+		enqueued := make([]enqueuedTask, 0, len(input.Tasks))
+		abort := func(cause error) {
+			// Mark first so a worker that already picked up a task drops it.
+			if err := rdb.Set(context.Background(), batchStateKey(batchID), batchStateAborted, batchStateTTL).Err(); err != nil {
+				log.Printf("ERROR: could not mark batch %s aborted (staging marker will expire): %v", batchID, err)
+			}
+			for _, t := range enqueued {
+				if err := inspector.DeleteTask(t.queue, t.id); err != nil {
+					log.Printf("WARN: could not delete task %s of aborted batch %s: %v", t.id, batchID, err)
+				}
+			}
+			log.Printf("ERROR: batch %s aborted: %v", batchID, cause)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "batch could not be enqueued; no tasks will run", "batch_id": batchID})
+		}
+
+		for i, t := range input.Tasks {
+			queue := t.Queue
+			if queue == "" {
+				queue = "default"
+			}
+			opts := []asynq.Option{asynq.Queue(queue), asynq.TaskID(batchTaskID(batchID, i)), asynq.Retention(jobRetention)}
+			if t.MaxRetry != nil {
+				opts = append(opts, asynq.MaxRetry(*t.MaxRetry))
+			}
+			if t.ProcessInSeconds > 0 {
+				delay := time.Duration(t.ProcessInSeconds) * time.Second
+				opts = append(opts, asynq.ProcessIn(delay))
+				if batchStateTTL+delay > stateTTL {
+					stateTTL = batchStateTTL + delay
+				}
+			}
+			info, err := client.EnqueueContext(ctx, asynq.NewTask(t.Type, t.Payload), opts...)
+			if err != nil {
+				abort(fmt.Errorf("tasks[%d]: %w", i, err))
+				return
+			}
+			enqueued = append(enqueued, enqueuedTask{queue: info.Queue, id: info.ID})
+		}
+
+		if err := rdb.Set(ctx, batchStateKey(batchID), batchStateCommitted, stateTTL).Err(); err != nil {
+			abort(fmt.Errorf("commit: %w", err))
+			return
+		}
+
+		taskIDs := make([]string, len(enqueued))
+		storeMutex.Lock()
+		for i, t := range enqueued {
+			taskIDs[i] = t.id
+			jobStatusStore[t.id] = "queued"
+		}
+		storeMutex.Unlock()
+		c.JSON(http.StatusAccepted, gin.H{"batch_id": batchID, "task_ids": taskIDs})
+	}
+}
+
+// batchGuardMiddleware only lets batch tasks run once their batch committed.
+// Tasks outside any batch pass straight through.
+func batchGuardMiddleware(rdb *redis.Client) asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			taskID, _ := asynq.GetTaskID(ctx)
+			batchID, ok := batchIDFromTaskID(taskID)
+			if !ok {
+				return next.ProcessTask(ctx, t)
+			}
+
+			state, err := rdb.Get(ctx, batchStateKey(batchID)).Result()
+			switch {
+			case errors.Is(err, redis.Nil):
+				// Either the API died mid-batch or the batch outlived its
+				// marker; neither is grounds to drop the task silently.
+				return fmt.Errorf("task %s: %w: %s", taskID, errBatchStateMissing, batchID)
+			case err != nil:
+				return fmt.Errorf("checking batch %s: %w", batchID, err)
+			case state == batchStateStaging:
+				return errBatchNotCommitted
+			case state == batchStateAborted:
+				log.Printf("WORKER: dropping task %s of aborted batch %s", taskID, batchID)
+				return nil
+			}
+			err = next.ProcessTask(ctx, t)
+			// Keep the marker alive while members are still running or retrying;
+			// GT never shortens the longer TTL a delayed member needs.
+			if err := rdb.ExpireGT(context.Background(), batchStateKey(batchID), batchStateTTL).Err(); err != nil {
+				log.Printf("WARN: could not refresh state of batch %s: %v", batchID, err)
+			}
+			return err
+		})
+	}
+}
+
+// jobRetention keeps finished tasks readable through the inspector, so a
+// status poll after completion still finds the job.
+const jobRetention = 24 * time.Hour
+
+// lookupJobStatus prefers the live local status and falls back to asynq
+// once the job has finished or was never tracked here. A finished job that
+// asynq no longer holds keeps its local terminal status.
+func lookupJobStatus(inspector *asynq.Inspector, jobID string) (gin.H, bool) {
+	storeMutex.RLock()
+	status, found := jobStatusStore[jobID]
+	storeMutex.RUnlock()
+
+	if found && status != "completed" && status != "failed" {
+		return gin.H{"job_id": jobID, "status": status}, true
+	}
+
+	info, err := inspector.GetTaskInfo("default", jobID)
+	if err != nil {
+		if found {
+			return gin.H{"job_id": jobID, "status": status}, true
+		}
+		return nil, false
+	}
+	return gin.H{
+		"job_id":     jobID,
+		"status":     info.State.String(),
+		"retries":    info.Retried,
+		"last_error": info.LastErr,
+	}, true
+}
+
+func isTerminalJobStatus(status interface{}) bool {
+	switch status {
+	case "completed", "failed", "archived":
+		return true
+	}
+	return false
+}
+
 func getJobStatusHandler(inspector *asynq.Inspector) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		jobID := c.Param("id")
+		status, found := lookupJobStatus(inspector, c.Param("id"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// --- LONG POLLING ---
+// Workers publish every job state change on "jobs:events"; each API process
+// holds one subscription and wakes the requests waiting on that job. Clients
+// that cannot hold a WebSocket call GET /api/jobs/:id/wait in a loop.
+
+const (
+	jobEventsChannel       = "jobs:events"
+	defaultLongPollTimeout = 30 * time.Second
+	maxLongPollTimeout     = 60 * time.Second
+	defaultLongPollWaiters = 1000
+)
+
+type JobEvent struct {
+	JobID string `json:"job_id"`
+	State string `json:"state"`
+}
+
+// jobEventsMiddleware publishes the state a task moves into. It runs inside
+// batchGuardMiddleware, so tasks held back for their batch stay quiet.
+func jobEventsMiddleware(rdb *redis.Client) asynq.MiddlewareFunc {
+	publish := func(jobID, state string) {
+		ev, _ := json.Marshal(JobEvent{JobID: jobID, State: state})
+		// The task's own context may already be done; the event must still go out.
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := rdb.Publish(ctx, jobEventsChannel, ev).Err(); err != nil {
+			log.Printf("WARN: could not publish event for job %s: %v", jobID, err)
+		}
+	}
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			jobID, _ := asynq.GetTaskID(ctx)
+			publish(jobID, "active")
+			err := next.ProcessTask(ctx, t)
+			if err == nil {
+				publish(jobID, "completed")
+				return nil
+			}
+			retried, _ := asynq.GetRetryCount(ctx)
+			maxRetry, _ := asynq.GetMaxRetry(ctx)
+			if retried >= maxRetry || errors.Is(err, asynq.SkipRetry) {
+				publish(jobID, "archived")
+			} else {
+				publish(jobID, "retry")
+			}
+			return err
+		})
+	}
+}
+
+// JobWatcher fans job events out to waiting requests and caps how many
+// requests may wait at once.
+type JobWatcher struct {
+	rdb     *redis.Client
+	slots   chan struct{}
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
 
-		storeMutex.RLock()
-		status, found := jobStatusStore[jobID]
-		storeMutex.RUnlock()
+func NewJobWatcher(rdb *redis.Client, maxWaiters int) *JobWatcher {
+	return &JobWatcher{
+		rdb:     rdb,
+		slots:   make(chan struct{}, maxWaiters),
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
 
-		if found && status != "completed" && status != "failed" {
-			c.JSON(http.StatusOK, gin.H{"job_id": jobID, "status": status})
+func (w *JobWatcher) Start(ctx context.Context) {
+	sub := w.rdb.Subscribe(ctx, jobEventsChannel)
+	go func() {
+		defer sub.Close()
+		for msg := range sub.Channel() {
+			var ev JobEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				continue
+			}
+			w.notify(ev.JobID)
+		}
+	}()
+}
+
+func (w *JobWatcher) notify(jobID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.waiters[jobID] {
+		select {
+		case ch <- struct{}{}:
+		default: // already signalled
+		}
+	}
+}
+
+// watch registers interest in jobID. Callers must call the returned cancel.
+func (w *JobWatcher) watch(jobID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	if w.waiters[jobID] == nil {
+		w.waiters[jobID] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[jobID][ch] = struct{}{}
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.waiters[jobID], ch)
+		if len(w.waiters[jobID]) == 0 {
+			delete(w.waiters, jobID)
+		}
+		w.mu.Unlock()
+	}
+}
+
+func (w *JobWatcher) tryAcquire() bool {
+	select {
+	case w.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *JobWatcher) release() { <-w.slots }
+
+// Waiters reports how many long-poll slots are in use, and how many exist.
+func (w *JobWatcher) Waiters() (int, int) { return len(w.slots), cap(w.slots) }
+
+// waitJobHandler answers at once for finished jobs; otherwise it holds the
+// request until the job changes state, the timeout passes, or the client
+// goes away. "changed" tells the client whether to poll again right away.
+func waitJobHandler(inspector *asynq.Inspector, watcher *JobWatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("id")
+		timeout := defaultLongPollTimeout
+		if raw := c.Query("timeout"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must be a positive duration such as 30s"})
+				return
+			}
+			if d > maxLongPollTimeout {
+				d = maxLongPollTimeout
+			}
+			timeout = d
+		}
+
+		if !watcher.tryAcquire() {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many waiting requests"})
 			return
 		}
+		defer watcher.release()
 
-		info, err := inspector.GetTaskInfo("default", jobID)
-		if err != nil {
+		// Watch before reading the status so a change in between is not lost.
+		changed, stop := watcher.watch(jobID)
+		defer stop()
+
+		status, found := lookupJobStatus(inspector, jobID)
+		if !found {
 			c.JSON(http.StatusNotFound, gin.H{"error": "job not found or expired"})
 			return
 		}
+		if isTerminalJobStatus(status["status"]) {
+			status["changed"] = false
+			c.JSON(http.StatusOK, status)
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-c.Request.Context().Done():
+			// Client disconnected; nobody is left to answer.
+			return
+		case <-timer.C:
+			status["changed"] = false
+		case <-changed:
+			if latest, ok := lookupJobStatus(inspector, jobID); ok {
+				status = latest
+			}
+			status["changed"] = true
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+func longPollWaiterLimit() int {
+	if n, err := strconv.Atoi(os.Getenv("LONGPOLL_MAX_WAITERS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultLongPollWaiters
+}
+
+// --- ADMIN OVERVIEW ---
+// GET /admin/overview composes one document from every subsystem. Each
+// section is collected concurrently under its own timeout; a slow or failing
+// collector only marks its own section as "timeout" or "error".
+
+const httpMetricsWindow = 60 // seconds
+
+type httpBucket struct {
+	second   int64
+	requests int64
+	errors   int64 // 5xx
+	rejected int64 // 4xx
+}
+
+// HTTPMetrics counts requests in per-second buckets over the last minute.
+type HTTPMetrics struct {
+	mu      sync.Mutex
+	buckets [httpMetricsWindow]httpBucket
+}
+
+func (m *HTTPMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		now := time.Now().Unix()
+		status := c.Writer.Status()
+		m.mu.Lock()
+		b := &m.buckets[now%httpMetricsWindow]
+		if b.second != now {
+			*b = httpBucket{second: now}
+		}
+		b.requests++
+		if status >= 500 {
+			b.errors++
+		} else if status >= 400 {
+			b.rejected++
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *HTTPMetrics) Snapshot() gin.H {
+	cutoff := time.Now().Unix() - httpMetricsWindow
+	var requests, failed, rejected int64
+	m.mu.Lock()
+	for _, b := range m.buckets {
+		if b.second > cutoff {
+			requests, failed, rejected = requests+b.requests, failed+b.errors, rejected+b.rejected
+		}
+	}
+	m.mu.Unlock()
+	return gin.H{
+		"window_seconds":    httpMetricsWindow,
+		"requests":          requests,
+		"rps":               float64(requests) / httpMetricsWindow,
+		"error_rate":        ratio(failed, requests),
+		"client_error_rate": ratio(rejected, requests),
+	}
+}
 
+func ratio(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// redisInfo returns the fields of the given INFO sections.
+func redisInfo(ctx context.Context, rdb *redis.Client, sections ...string) (map[string]string, error) {
+	raw, err := rdb.Info(ctx, sections...).Result()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(raw, "\r\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(k, "#") {
+			fields[k] = v
+		}
+	}
+	return fields, nil
+}
+
+type OverviewSection struct {
+	Status string      `json:"status"` // ok, error or timeout
+	TookMs int64       `json:"took_ms"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type overviewCollector func(ctx context.Context) (interface{}, error)
+
+func overviewCollectors(metrics *HTTPMetrics, inspector *asynq.Inspector, rdb *redis.Client, flags *FlagStore, watcher *JobWatcher) map[string]overviewCollector {
+	return map[string]overviewCollector{
+		"http": func(ctx context.Context) (interface{}, error) {
+			return metrics.Snapshot(), nil
+		},
+		// The inspector takes no context; on timeout its call is abandoned.
+		"queues": func(ctx context.Context) (interface{}, error) {
+			names, err := inspector.Queues()
+			if err != nil {
+				return nil, err
+			}
+			queues := make(map[string]gin.H, len(names))
+			for _, name := range names {
+				info, err := inspector.GetQueueInfo(name)
+				if err != nil {
+					return nil, fmt.Errorf("queue %s: %w", name, err)
+				}
+				queues[name] = gin.H{
+					"size":            info.Size,
+					"pending":         info.Pending,
+					"active":          info.Active,
+					"retry":           info.Retry,
+					"archived":        info.Archived,
+					"paused":          info.Paused,
+					"latency_ms":      info.Latency.Milliseconds(),
+					"processed_today": info.Processed,
+					"failed_today":    info.Failed,
+					"failure_rate":    ratio(int64(info.Failed), int64(info.Processed)),
+				}
+			}
+			return queues, nil
+		},
+		"redis_pool": func(ctx context.Context) (interface{}, error) {
+			s := rdb.PoolStats()
+			return gin.H{
+				"total_conns": s.TotalConns,
+				"idle_conns":  s.IdleConns,
+				"stale_conns": s.StaleConns,
+				"timeouts":    s.Timeouts,
+				"reuse_ratio": ratio(int64(s.Hits), int64(s.Hits)+int64(s.Misses)),
+			}, nil
+		},
+		"cache": func(ctx context.Context) (interface{}, error) {
+			info, err := redisInfo(ctx, rdb, "stats")
+			if err != nil {
+				return nil, err
+			}
+			hits, _ := strconv.ParseInt(info["keyspace_hits"], 10, 64)
+			misses, _ := strconv.ParseInt(info["keyspace_misses"], 10, 64)
+			return gin.H{"keyspace_hits": hits, "keyspace_misses": misses, "hit_ratio": ratio(hits, hits+misses)}, nil
+		},
+		"storage": func(ctx context.Context) (interface{}, error) {
+			info, err := redisInfo(ctx, rdb, "memory")
+			if err != nil {
+				return nil, err
+			}
+			used, _ := strconv.ParseInt(info["used_memory"], 10, 64)
+			max, _ := strconv.ParseInt(info["maxmemory"], 10, 64)
+			return gin.H{"redis_used_bytes": used, "redis_max_bytes": max, "redis_used_human": info["used_memory_human"]}, nil
+		},
+		"flags": func(ctx context.Context) (interface{}, error) {
+			all := flags.List()
+			enabled := []string{}
+			for _, f := range all {
+				if f.Enabled {
+					enabled = append(enabled, f.Key)
+				}
+			}
+			return gin.H{"total": len(all), "enabled": enabled}, nil
+		},
+		"long_poll": func(ctx context.Context) (interface{}, error) {
+			inUse, limit := watcher.Waiters()
+			return gin.H{"waiters": inUse, "limit": limit}, nil
+		},
+	}
+}
+
+func collectOverview(ctx context.Context, collectors map[string]overviewCollector, timeout time.Duration) map[string]OverviewSection {
+	sections := make(map[string]OverviewSection, len(collectors))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, collect := range collectors {
+		wg.Add(1)
+		go func(name string, collect overviewCollector) {
+			defer wg.Done()
+			sctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			done := make(chan OverviewSection, 1)
+			go func() {
+				data, err := collect(sctx)
+				if err != nil {
+					done <- OverviewSection{Status: "error", Error: err.Error()}
+					return
+				}
+				done <- OverviewSection{Status: "ok", Data: data}
+			}()
+			var s OverviewSection
+			select {
+			case s = <-done:
+			case <-sctx.Done():
+				s = OverviewSection{Status: "timeout"}
+			}
+			s.TookMs = time.Since(start).Milliseconds()
+			mu.Lock()
+			sections[name] = s
+			mu.Unlock()
+		}(name, collect)
+	}
+	wg.Wait()
+	return sections
+}
+
+// overviewSectionTimeout reads OVERVIEW_SECTION_TIMEOUT (default 500ms).
+func overviewSectionTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("OVERVIEW_SECTION_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 500 * time.Millisecond
+}
+
+func overviewHandler(collectors map[string]overviewCollector, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"job_id":     jobID,
-			"status":     info.State.String(),
-			"retries":    info.Retried,
-			"last_error": info.LastErr,
+			"generated_at": time.Now().UTC(),
+			"sections":     collectOverview(c.Request.Context(), collectors, timeout),
 		})
 	}
 }
 
+// --- ADMIN PANEL ---
+// GET /admin/panel/ is an embedded page for ADMIN users that renders the
+// admin JSON APIs below. Assets are gzipped once at startup and served under
+// content-hashed names, so only index.html needs revalidating.
+
+const (
+	adminPanelPrefix  = "/admin/panel/"
+	adminListMaxLimit = 100
+)
+
+//go:embed admin_panel
+var adminPanelFiles embed.FS
+
+type panelAsset struct {
+	body        []byte
+	gzipped     []byte // nil when compression does not pay off
+	contentType string
+	etag        string
+	immutable   bool
+}
+
+// AdminPanel holds the panel's assets by the name they are served under.
+type AdminPanel struct {
+	assets map[string]*panelAsset
+}
+
+// NewAdminPanel bundles files. index.html is a template in which
+// {{asset "app.js"}} expands to the hashed URL of app.js.
+func NewAdminPanel(files fs.FS) (*AdminPanel, error) {
+	p := &AdminPanel{assets: make(map[string]*panelAsset)}
+	urls := make(map[string]string)
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == "index.html" {
+			return err
+		}
+		body, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		a := newPanelAsset(body, path.Ext(name), true)
+		hashed := strings.TrimSuffix(name, path.Ext(name)) + "." + strings.Trim(a.etag, `"`) + path.Ext(name)
+		p.assets[hashed] = a
+		urls[name] = adminPanelPrefix + hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
+		"asset": func(name string) (string, error) {
+			if u, ok := urls[name]; ok {
+				return u, nil
+			}
+			return "", fmt.Errorf("admin panel: no asset %q", name)
+		},
+	}).ParseFS(files, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	var index bytes.Buffer
+	if err := tmpl.Execute(&index, nil); err != nil {
+		return nil, err
+	}
+	p.assets[""] = newPanelAsset(index.Bytes(), ".html", false)
+	return p, nil
+}
+
+func newPanelAsset(body []byte, ext string, immutable bool) *panelAsset {
+	sum := sha256.Sum256(body)
+	a := &panelAsset{body: body, contentType: mime.TypeByExtension(ext), etag: `"` + hex.EncodeToString(sum[:6]) + `"`, immutable: immutable}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(body)
+	zw.Close()
+	if buf.Len() < len(body) {
+		a.gzipped = buf.Bytes()
+	}
+	return a
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		return q > 0
+	}
+	return false
+}
+
+// Register adds one GET route per asset to g, which must be mounted at
+// adminPanelPrefix.
+func (p *AdminPanel) Register(g *gin.RouterGroup) {
+	for name, a := range p.assets {
+		g.GET("/"+name, a.serve)
+	}
+}
+
+func (a *panelAsset) serve(c *gin.Context) {
+	c.Header("ETag", a.etag)
+	c.Header("Vary", "Accept-Encoding")
+	if a.immutable {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	if c.GetHeader("If-None-Match") == a.etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if a.gzipped != nil && acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, a.contentType, a.gzipped)
+		return
+	}
+	c.Data(http.StatusOK, a.contentType, a.body)
+}
+
+var errUnknownTaskState = errors.New("state must be pending, active, scheduled, retry, archived or completed")
+
+// listTasks returns up to limit tasks of queue in the given state.
+func listTasks(inspector *asynq.Inspector, queue, state string, limit int) ([]*asynq.TaskInfo, error) {
+	page := asynq.PageSize(limit)
+	switch state {
+	case "pending":
+		return inspector.ListPendingTasks(queue, page)
+	case "active":
+		return inspector.ListActiveTasks(queue, page)
+	case "scheduled":
+		return inspector.ListScheduledTasks(queue, page)
+	case "retry":
+		return inspector.ListRetryTasks(queue, page)
+	case "archived":
+		return inspector.ListArchivedTasks(queue, page)
+	case "completed":
+		return inspector.ListCompletedTasks(queue, page)
+	}
+	return nil, errUnknownTaskState
+}
+
+func adminQueuesHandler(inspector *asynq.Inspector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		queues, err := inspector.Queues()
+		if err != nil {
+			log.Printf("ERROR: could not list queues: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not list queues"})
+			return
+		}
+		sort.Strings(queues)
+		rows := make([]gin.H, 0, len(queues))
+		for _, queue := range queues {
+			info, err := inspector.GetQueueInfo(queue)
+			if err != nil {
+				continue
+			}
+			rows = append(rows, gin.H{
+				"queue": info.Queue, "paused": info.Paused, "size": info.Size,
+				"active": info.Active, "pending": info.Pending, "scheduled": info.Scheduled,
+				"retry": info.Retry, "archived": info.Archived, "completed": info.Completed,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"data": rows})
+	}
+}
+
+// adminJobsHandler serves GET /admin/jobs?queue=default&state=pending&limit=50.
+func adminJobsHandler(inspector *asynq.Inspector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > adminListMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", adminListMaxLimit)})
+			return
+		}
+		tasks, err := listTasks(inspector, c.DefaultQuery("queue", "default"), c.DefaultQuery("state", "pending"), limit)
+		if errors.Is(err, errUnknownTaskState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil && !errors.Is(err, asynq.ErrQueueNotFound) {
+			log.Printf("ERROR: could not list jobs: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "could not list jobs"})
+			return
+		}
+		rows := make([]gin.H, 0, len(tasks))
+		for _, t := range tasks {
+			rows = append(rows, gin.H{
+				"id": t.ID, "type": t.Type, "queue": t.Queue, "state": t.State.String(),
+				"retried": t.Retried, "max_retry": t.MaxRetry, "last_error": t.LastErr,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"data": rows})
+	}
+}
+
+func adminUsersHandler(c *gin.Context) {
+	storeMutex.RLock()
+	users := make([]User, 0, len(userStore))
+	for _, u := range userStore {
+		users = append(users, u)
+	}
+	storeMutex.RUnlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
+
 // --- TASK WORKER FUNCTIONS ---
 
 func handleSendWelcomeEmail(ctx context.Context, t *asynq.Task) error {
@@ -171,42 +1473,47 @@ func handleSendWelcomeEmail(ctx context.Context, t *asynq.Task) error {
 		return fmt.Errorf("user %s not found for welcome email", userID)
 	}
 
-	log.Printf("WORKER: Sending welcome email to %s", user.Email)
+	template := "welcome-v1"
+	if FlagsFrom(ctx).Enabled("welcome-email-v2", false) {
+		template = "welcome-v2"
+	}
+	log.Printf("WORKER: Sending welcome email (%s) to %s", template, user.Email)
 	time.Sleep(1 * time.Second) // Simulate network latency
 	log.Printf("WORKER: Welcome email sent to %s", user.Email)
 	return nil
 }
 
 func handleProcessPostImage(ctx context.Context, t *asynq.Task) error {
-	info := asynq.GetTaskInfo(ctx)
+	taskID, _ := asynq.GetTaskID(ctx)
+	retried, _ := asynq.GetRetryCount(ctx)
 	
 	storeMutex.Lock()
-	jobStatusStore[info.ID] = "processing"
+	jobStatusStore[taskID] = "processing"
 	storeMutex.Unlock()
 
 	var payload map[string]string
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		storeMutex.Lock()
-		jobStatusStore[info.ID] = "failed"
+		jobStatusStore[taskID] = "failed"
 		storeMutex.Unlock()
 		return err
 	}
 
-	log.Printf("WORKER: Processing image for post %s. Attempt %d.", payload["post_id"], info.Retried+1)
+	log.Printf("WORKER: Processing image for post %s. Attempt %d.", payload["post_id"], retried+1)
 	time.Sleep(3 * time.Second) // Simulate processing time
 
 	// Simulate failure to test retry logic
-	if info.Retried < 2 {
+	if retried < 2 {
 		log.Printf("WORKER: Failed to process image for post %s. Retrying...", payload["post_id"])
 		storeMutex.Lock()
-		jobStatusStore[info.ID] = fmt.Sprintf("failed_attempt_%d", info.Retried+1)
+		jobStatusStore[taskID] = fmt.Sprintf("failed_attempt_%d", retried+1)
 		storeMutex.Unlock()
 		return fmt.Errorf("simulated processing error")
 	}
 
 	log.Printf("WORKER: Successfully processed image for post %s", payload["post_id"])
 	storeMutex.Lock()
-	jobStatusStore[info.ID] = "completed"
+	jobStatusStore[taskID] = "completed"
 	storeMutex.Unlock()
 	return nil
 }
@@ -227,14 +1534,39 @@ func main() {
 	defer client.Close()
 
 	inspector := asynq.NewInspector(redisConnection)
+	rdb := redis.NewClient(&redis.Options{Addr: redisConnection.Addr})
+	defer rdb.Close()
+
+	seedAdmin()
+
+	flagStore := NewFlagStore(rdb)
+	if err := flagStore.Start(context.Background()); err != nil {
+		log.Fatalf("could not load feature flags: %v", err)
+	}
+
+	watcher := NewJobWatcher(rdb, longPollWaiterLimit())
+	watcher.Start(context.Background())
 	
 	// --- WORKER SETUP ---
 	go func() {
 		srv := asynq.NewServer(redisConnection, asynq.Config{
 			Concurrency: 20,
-			// Exponential backoff is the default
+			// Exponential backoff is the default; staged batch tasks are polled quickly instead.
+			RetryDelayFunc: func(n int, err error, t *asynq.Task) time.Duration {
+				if errors.Is(err, errBatchNotCommitted) {
+					return time.Second
+				}
+				return asynq.DefaultRetryDelayFunc(n, err, t)
+			},
+			// Waiting for a batch commit must not use up the task's retries.
+			IsFailure: func(err error) bool {
+				return !errors.Is(err, errBatchNotCommitted)
+			},
 		})
 		mux := asynq.NewServeMux()
+		mux.Use(batchGuardMiddleware(rdb))
+		mux.Use(flagsTaskMiddleware(flagStore))
+		mux.Use(jobEventsMiddleware(rdb))
 		mux.HandleFunc(TaskSendWelcomeEmail, handleSendWelcomeEmail)
 		mux.HandleFunc(TaskProcessPostImage, handleProcessPostImage)
 		mux.HandleFunc(TaskCleanupOldDrafts, handleCleanupOldDrafts)
@@ -258,12 +1590,33 @@ func main() {
 	}()
 
 	// --- GIN ROUTER SETUP ---
+	httpMetrics := &HTTPMetrics{}
 	r := gin.New()
-	r.Use(gin.Logger(), gin.Recovery())
+	r.Use(gin.Logger(), gin.Recovery(), httpMetrics.Middleware(), authMiddleware(), flagsMiddleware(flagStore))
 
 	r.POST("/users", createUserHandler(client))
 	r.POST("/posts/:id/image", processImageHandler(client))
 	r.GET("/jobs/:id", getJobStatusHandler(inspector))
+	r.GET("/api/jobs/:id/wait", waitJobHandler(inspector, watcher))
+	r.POST("/api/jobs/batch", batchEnqueueHandler(client, inspector, rdb))
+
+	flags := r.Group("/api/flags", requireRole(ADMIN))
+	flags.GET("", listFlagsHandler(flagStore))
+	flags.GET("/:key", getFlagHandler(flagStore))
+	flags.PUT("/:key", putFlagHandler(flagStore))
+	flags.DELETE("/:key", deleteFlagHandler(flagStore))
+
+	panelFiles, _ := fs.Sub(adminPanelFiles, "admin_panel")
+	panel, err := NewAdminPanel(panelFiles)
+	if err != nil {
+		log.Fatalf("could not build admin panel: %v", err)
+	}
+	admin := r.Group("/admin", requireRole(ADMIN))
+	admin.GET("/overview", overviewHandler(overviewCollectors(httpMetrics, inspector, rdb, flagStore, watcher), overviewSectionTimeout()))
+	panel.Register(admin.Group("/panel"))
+	admin.GET("/queues", adminQueuesHandler(inspector))
+	admin.GET("/jobs", adminJobsHandler(inspector))
+	admin.GET("/users", adminUsersHandler)
 
 	log.Println("Starting HTTP server on port 9090")
 	if err := r.Run(":9090"); err != nil {
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -55,7 +60,27 @@ type Post struct {
 
 type ITaskDispatcher interface {
 	DispatchWelcomeEmail(ctx context.Context, userID uuid.UUID) error
-	DispatchImageProcessing(ctx context.Context, postID uuid.UUID) (string, error)
+	DispatchImageProcessing(ctx context.Context, postID uuid.UUID) (DispatchResult, error)
+}
+
+// DispatchResult reports where a task went; Degraded means it was admitted
+// to the low-priority queue because its own queue was backed up.
+type DispatchResult struct {
+	JobID    string
+	Queue    string
+	Degraded bool
+}
+
+// QueueSaturatedError is returned when admission control refuses a task.
+type QueueSaturatedError struct {
+	Queue      string
+	Depth      int
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *QueueSaturatedError) Error() string {
+	return fmt.Sprintf("queue %s saturated: depth %d >= limit %d", e.Queue, e.Depth, e.Limit)
 }
 
 type IJobTracker interface {
@@ -64,30 +89,499 @@ type IJobTracker interface {
 
 // --- INFRASTRUCTURE (CONCRETE IMPLEMENTATIONS) ---
 
+// --- ADMISSION CONTROL ---
+
+const LowPriorityQueue = "low"
+
+// QueueLimit bounds a queue's backlog. Above Soft, non-critical tasks are
+// downgraded to LowPriorityQueue; above Hard, tasks are rejected.
+type QueueLimit struct {
+	Soft int
+	Hard int
+}
+
+var defaultQueueLimits = map[string]QueueLimit{
+	"notifications":  {Soft: 5000, Hard: 20000},
+	"processing":     {Soft: 500, Hard: 2000},
+	LowPriorityQueue: {Soft: 2000, Hard: 2000},
+}
+
+type depthSample struct {
+	depth     int
+	sampledAt time.Time
+}
+
+// QueueDepthSampler caches Inspector lookups so admission checks do not hit
+// Redis on every request.
+type QueueDepthSampler struct {
+	inspector *asynq.Inspector
+	maxAge    time.Duration
+	mu        sync.Mutex
+	samples   map[string]depthSample
+}
+
+func NewQueueDepthSampler(inspector *asynq.Inspector, maxAge time.Duration) *QueueDepthSampler {
+	return &QueueDepthSampler{inspector: inspector, maxAge: maxAge, samples: make(map[string]depthSample)}
+}
+
+// Depth is the backlog still to be worked: pending, scheduled, retrying and active tasks.
+func (s *QueueDepthSampler) Depth(queue string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sample, ok := s.samples[queue]; ok && time.Since(sample.sampledAt) < s.maxAge {
+		return sample.depth, nil
+	}
+	info, err := s.inspector.GetQueueInfo(queue)
+	if err != nil {
+		if errors.Is(err, asynq.ErrQueueNotFound) {
+			// Nothing has been enqueued yet.
+			s.samples[queue] = depthSample{depth: 0, sampledAt: time.Now()}
+			return 0, nil
+		}
+		return 0, err
+	}
+	depth := info.Pending + info.Scheduled + info.Retry + info.Active
+	s.samples[queue] = depthSample{depth: depth, sampledAt: time.Now()}
+	return depth, nil
+}
+
+type QueueLevel int
+
+const (
+	LevelNormal QueueLevel = iota
+	LevelSoft
+	LevelHard
+)
+
+func (l QueueLevel) String() string {
+	return [...]string{"normal", "soft_limit", "hard_limit"}[l]
+}
+
+type queueCounters struct {
+	Admitted  int64      `json:"admitted"`
+	Degraded  int64      `json:"degraded"`
+	Rejected  int64      `json:"rejected"`
+	LastDepth int        `json:"last_depth"`
+	Level     QueueLevel `json:"-"`
+	LevelName string     `json:"level"`
+}
+
+// SaturationMetrics counts admission decisions per queue and logs an alert
+// whenever a queue moves between limit levels.
+type SaturationMetrics struct {
+	mu     sync.Mutex
+	queues map[string]*queueCounters
+}
+
+func NewSaturationMetrics() *SaturationMetrics {
+	return &SaturationMetrics{queues: make(map[string]*queueCounters)}
+}
+
+func (m *SaturationMetrics) record(queue string, depth int, level QueueLevel, decision string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.queues[queue]
+	if !ok {
+		c = &queueCounters{}
+		m.queues[queue] = c
+	}
+	switch decision {
+	case "admitted":
+		c.Admitted++
+	case "degraded":
+		c.Degraded++
+	case "rejected":
+		c.Rejected++
+	}
+	c.LastDepth = depth
+	if c.Level != level {
+		if level > c.Level {
+			log.Printf("ALERT: queue %s reached %s (depth %d)", queue, level, depth)
+		} else {
+			log.Printf("RECOVERED: queue %s back to %s (depth %d)", queue, level, depth)
+		}
+		c.Level = level
+	}
+	c.LevelName = c.Level.String()
+}
+
+func (m *SaturationMetrics) Snapshot() map[string]queueCounters {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]queueCounters, len(m.queues))
+	for q, c := range m.queues {
+		cc := *c
+		cc.LevelName = cc.Level.String()
+		out[q] = cc
+	}
+	return out
+}
+
+// AdmissionController decides whether a task may join its queue.
+type AdmissionController struct {
+	sampler *QueueDepthSampler
+	limits  map[string]QueueLimit
+	metrics *SaturationMetrics
+}
+
+func NewAdmissionController(sampler *QueueDepthSampler, limits map[string]QueueLimit, metrics *SaturationMetrics) *AdmissionController {
+	return &AdmissionController{sampler: sampler, limits: limits, metrics: metrics}
+}
+
+func (a *AdmissionController) level(queue string) (QueueLevel, int, QueueLimit, error) {
+	limit, ok := a.limits[queue]
+	if !ok {
+		return LevelNormal, 0, limit, nil
+	}
+	depth, err := a.sampler.Depth(queue)
+	if err != nil {
+		return LevelNormal, 0, limit, err
+	}
+	switch {
+	case depth >= limit.Hard:
+		return LevelHard, depth, limit, nil
+	case depth >= limit.Soft:
+		return LevelSoft, depth, limit, nil
+	}
+	return LevelNormal, depth, limit, nil
+}
+
+// Admit returns the queue to enqueue into. Critical tasks are only refused
+// at the hard limit; non-critical tasks are downgraded at the soft limit.
+// If depth cannot be sampled the task is admitted, so a Redis hiccup on the
+// Inspector does not block all writes.
+func (a *AdmissionController) Admit(queue string, critical bool) (string, bool, error) {
+	level, depth, limit, err := a.level(queue)
+	if err != nil {
+		log.Printf("WARN: could not sample depth of queue %s: %v", queue, err)
+		return queue, false, nil
+	}
+
+	switch {
+	case level == LevelHard:
+		a.metrics.record(queue, depth, level, "rejected")
+		return "", false, &QueueSaturatedError{Queue: queue, Depth: depth, Limit: limit.Hard, RetryAfter: 30 * time.Second}
+	case level == LevelSoft && !critical:
+		lowLevel, lowDepth, lowLimit, err := a.level(LowPriorityQueue)
+		if err == nil && lowLevel != LevelNormal {
+			a.metrics.record(queue, depth, level, "rejected")
+			a.metrics.record(LowPriorityQueue, lowDepth, lowLevel, "")
+			return "", false, &QueueSaturatedError{Queue: LowPriorityQueue, Depth: lowDepth, Limit: lowLimit.Soft, RetryAfter: time.Minute}
+		}
+		a.metrics.record(queue, depth, level, "degraded")
+		return LowPriorityQueue, true, nil
+	}
+	a.metrics.record(queue, depth, level, "admitted")
+	return queue, false, nil
+}
+
+// --- AUTOSCALING SIGNALS ---
+
+// ThroughputMetrics tracks how fast tasks arrive on each queue and how long
+// they take to run. Both are smoothed with an EWMA so a short burst or one
+// slow task does not swing the scaling signal.
+type ThroughputMetrics struct {
+	mu     sync.Mutex
+	alpha  float64
+	queues map[string]*queueThroughput
+}
+
+type queueThroughput struct {
+	arrivals    int64   // since lastTick
+	arrivalRate float64 // tasks per second, smoothed
+	avgDuration float64 // seconds, smoothed
+	completed   int64
+	lastTick    time.Time
+}
+
+func NewThroughputMetrics(alpha float64) *ThroughputMetrics {
+	return &ThroughputMetrics{alpha: alpha, queues: make(map[string]*queueThroughput)}
+}
+
+// queue must be called with m.mu held.
+func (m *ThroughputMetrics) queue(name string) *queueThroughput {
+	q, ok := m.queues[name]
+	if !ok {
+		q = &queueThroughput{lastTick: time.Now()}
+		m.queues[name] = q
+	}
+	return q
+}
+
+func (m *ThroughputMetrics) RecordArrival(queue string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue(queue).arrivals++
+}
+
+func (m *ThroughputMetrics) RecordDuration(queue string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.queue(queue)
+	if q.completed == 0 {
+		q.avgDuration = d.Seconds()
+	} else {
+		q.avgDuration = m.alpha*d.Seconds() + (1-m.alpha)*q.avgDuration
+	}
+	q.completed++
+}
+
+// tick folds the arrivals counted since the last tick into the arrival rate.
+func (m *ThroughputMetrics) tick(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, q := range m.queues {
+		elapsed := now.Sub(q.lastTick).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		q.arrivalRate = m.alpha*(float64(q.arrivals)/elapsed) + (1-m.alpha)*q.arrivalRate
+		q.arrivals = 0
+		q.lastTick = now
+	}
+}
+
+func (m *ThroughputMetrics) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.tick(now)
+		}
+	}
+}
+
+// Stats returns the smoothed arrival rate, the smoothed task duration in
+// seconds and how many completions the duration is based on.
+func (m *ThroughputMetrics) Stats(queue string) (float64, float64, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[queue]
+	if !ok {
+		return 0, 0, 0
+	}
+	return q.arrivalRate, q.avgDuration, q.completed
+}
+
+// Middleware times every task, failed ones included, since both occupy a
+// worker slot.
+func (m *ThroughputMetrics) Middleware() asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			start := time.Now()
+			err := next.ProcessTask(ctx, t)
+			if queue, ok := asynq.GetQueueName(ctx); ok {
+				m.RecordDuration(queue, time.Since(start))
+			}
+			return err
+		})
+	}
+}
+
+// ScalingTarget is the service level a queue's workers are sized for:
+// steady-state arrivals should keep workers at TargetUtilization, and any
+// backlog should clear within MaxDrainTime.
+type ScalingTarget struct {
+	MaxDrainTime      time.Duration
+	TargetUtilization float64
+	MinReplicas       int
+	MaxReplicas       int
+}
+
+var defaultScalingTargets = map[string]ScalingTarget{
+	"notifications":  {MaxDrainTime: 2 * time.Minute, TargetUtilization: 0.7, MinReplicas: 1, MaxReplicas: 10},
+	"processing":     {MaxDrainTime: 5 * time.Minute, TargetUtilization: 0.8, MinReplicas: 1, MaxReplicas: 20},
+	LowPriorityQueue: {MaxDrainTime: 30 * time.Minute, TargetUtilization: 0.9, MinReplicas: 0, MaxReplicas: 5},
+}
+
+// Used until a queue has completed a task, so a backlog on a fresh deploy
+// still produces a signal.
+const fallbackTaskDuration = time.Second
+
+type QueueScalingSignal struct {
+	Queue               string  `json:"queue"`
+	Depth               int     `json:"depth"`
+	ArrivalRate         float64 `json:"arrival_rate_per_sec"`
+	AvgDurationSec      float64 `json:"avg_task_duration_sec"`
+	DurationEstimated   bool    `json:"avg_task_duration_estimated,omitempty"`
+	RequiredConcurrency float64 `json:"required_concurrency"`
+	DesiredReplicas     int     `json:"desired_replicas"`
+	RecommendedReplicas int     `json:"recommended_replicas"`
+	Action              string  `json:"action"`
+	Error               string  `json:"error,omitempty"`
+}
+
+type replicaSample struct {
+	at       time.Time
+	replicas int
+}
+
+// ScalingPlanner turns queue depth and throughput into replica counts.
+// Scale-ups apply immediately; a scale-down is only recommended once the
+// lower count has held for the whole stabilization window, so the signal
+// does not flap as a queue drains and refills.
+type ScalingPlanner struct {
+	sampler       *QueueDepthSampler
+	throughput    *ThroughputMetrics
+	targets       map[string]ScalingTarget
+	concurrency   int
+	stabilization time.Duration
+
+	mu      sync.Mutex
+	history map[string][]replicaSample
+	last    map[string]int
+}
+
+func NewScalingPlanner(sampler *QueueDepthSampler, throughput *ThroughputMetrics, targets map[string]ScalingTarget, concurrency int, stabilization time.Duration) *ScalingPlanner {
+	return &ScalingPlanner{
+		sampler:       sampler,
+		throughput:    throughput,
+		targets:       targets,
+		concurrency:   concurrency,
+		stabilization: stabilization,
+		history:       make(map[string][]replicaSample),
+		last:          make(map[string]int),
+	}
+}
+
+// stabilize records desired for key and returns the recommendation and the
+// action it implies relative to the previous recommendation.
+func (p *ScalingPlanner) stabilize(key string, desired int, now time.Time) (int, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hist := append(p.history[key], replicaSample{at: now, replicas: desired})
+	cutoff := now.Add(-p.stabilization)
+	for len(hist) > 1 && hist[0].at.Before(cutoff) {
+		hist = hist[1:]
+	}
+	p.history[key] = hist
+
+	recommended := desired
+	for _, s := range hist {
+		if s.replicas > recommended {
+			recommended = s.replicas
+		}
+	}
+	prev, seen := p.last[key]
+	p.last[key] = recommended
+	switch {
+	case !seen || recommended == prev:
+		if recommended > desired {
+			return recommended, "hold"
+		}
+		return recommended, "steady"
+	case recommended > prev:
+		return recommended, "scale_up"
+	}
+	return recommended, "scale_down"
+}
+
+func (p *ScalingPlanner) replicasFor(required float64, min, max int) int {
+	n := int(math.Ceil(required / float64(p.concurrency)))
+	if n < min {
+		n = min
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	return n
+}
+
+// Evaluate computes the signal for every queue with a target, plus the
+// total for a worker fleet that serves all of them.
+func (p *ScalingPlanner) Evaluate(now time.Time) ([]QueueScalingSignal, QueueScalingSignal) {
+	names := make([]string, 0, len(p.targets))
+	for q := range p.targets {
+		names = append(names, q)
+	}
+	sort.Strings(names)
+
+	signals := make([]QueueScalingSignal, 0, len(names))
+	total := QueueScalingSignal{Queue: "*"}
+	minTotal := 0
+	for _, name := range names {
+		target := p.targets[name]
+		sig := QueueScalingSignal{Queue: name}
+		if target.MinReplicas > minTotal {
+			minTotal = target.MinReplicas
+		}
+
+		depth, err := p.sampler.Depth(name)
+		if err != nil {
+			// Keep the last recommendation rather than scaling on a blind spot.
+			sig.Error = err.Error()
+			p.mu.Lock()
+			sig.RecommendedReplicas = p.last[name]
+			p.mu.Unlock()
+			sig.Action = "hold"
+			signals = append(signals, sig)
+			continue
+		}
+		rate, avg, completed := p.throughput.Stats(name)
+		if completed == 0 {
+			avg, sig.DurationEstimated = fallbackTaskDuration.Seconds(), true
+		}
+		sig.Depth, sig.ArrivalRate, sig.AvgDurationSec = depth, rate, avg
+
+		// Little's law for the steady state, plus enough extra workers to
+		// clear the current backlog within the drain target.
+		sig.RequiredConcurrency = rate*avg/target.TargetUtilization + float64(depth)*avg/target.MaxDrainTime.Seconds()
+		sig.DesiredReplicas = p.replicasFor(sig.RequiredConcurrency, target.MinReplicas, target.MaxReplicas)
+		sig.RecommendedReplicas, sig.Action = p.stabilize(name, sig.DesiredReplicas, now)
+
+		total.Depth += depth
+		total.ArrivalRate += rate
+		total.RequiredConcurrency += sig.RequiredConcurrency
+		signals = append(signals, sig)
+	}
+	total.DesiredReplicas = p.replicasFor(total.RequiredConcurrency, minTotal, 0)
+	total.RecommendedReplicas, total.Action = p.stabilize(total.Queue, total.DesiredReplicas, now)
+	return signals, total
+}
+
 // AsynqTaskDispatcher implements ITaskDispatcher
 type AsynqTaskDispatcher struct {
-	client *asynq.Client
+	client     *asynq.Client
+	admission  *AdmissionController
+	throughput *ThroughputMetrics
 }
 
-func NewAsynqTaskDispatcher(opt asynq.RedisClientOpt) *AsynqTaskDispatcher {
-	return &AsynqTaskDispatcher{client: asynq.NewClient(opt)}
+func NewAsynqTaskDispatcher(opt asynq.RedisClientOpt, admission *AdmissionController, throughput *ThroughputMetrics) *AsynqTaskDispatcher {
+	return &AsynqTaskDispatcher{client: asynq.NewClient(opt), admission: admission, throughput: throughput}
 }
 
+// DispatchWelcomeEmail is critical: the user already exists, so the email is
+// only refused once the notifications queue hits its hard limit.
 func (d *AsynqTaskDispatcher) DispatchWelcomeEmail(ctx context.Context, userID uuid.UUID) error {
+	queue, _, err := d.admission.Admit("notifications", true)
+	if err != nil {
+		return err
+	}
 	payload, _ := json.Marshal(map[string]interface{}{"user_id": userID})
 	task := asynq.NewTask("email:welcome", payload)
-	_, err := d.client.EnqueueContext(ctx, task, asynq.Queue("notifications"))
-	return err
+	if _, err = d.client.EnqueueContext(ctx, task, asynq.Queue(queue)); err != nil {
+		return err
+	}
+	d.throughput.RecordArrival(queue)
+	return nil
 }
 
-func (d *AsynqTaskDispatcher) DispatchImageProcessing(ctx context.Context, postID uuid.UUID) (string, error) {
+func (d *AsynqTaskDispatcher) DispatchImageProcessing(ctx context.Context, postID uuid.UUID) (DispatchResult, error) {
+	queue, degraded, err := d.admission.Admit("processing", false)
+	if err != nil {
+		return DispatchResult{}, err
+	}
 	payload, _ := json.Marshal(map[string]interface{}{"post_id": postID})
 	task := asynq.NewTask("image:process", payload)
-	info, err := d.client.EnqueueContext(ctx, task, asynq.MaxRetry(4), asynq.Queue("processing"))
+	info, err := d.client.EnqueueContext(ctx, task, asynq.MaxRetry(4), asynq.Queue(queue))
 	if err != nil {
-		return "", err
+		return DispatchResult{}, err
 	}
-	return info.ID, nil
+	d.throughput.RecordArrival(queue)
+	return DispatchResult{JobID: info.ID, Queue: queue, Degraded: degraded}, nil
 }
 
 // AsynqJobTracker implements IJobTracker
@@ -101,7 +595,7 @@ func NewAsynqJobTracker(opt asynq.RedisClientOpt) *AsynqJobTracker {
 
 func (t *AsynqJobTracker) GetJobStatus(ctx context.Context, jobID string) (string, error) {
 	// Check multiple queues if necessary
-	queues := []string{"processing", "notifications", "default"}
+	queues := []string{"processing", "notifications", LowPriorityQueue, "default"}
 	for _, q := range queues {
 		info, err := t.inspector.GetTaskInfo(q, jobID)
 		if err == nil {
@@ -175,12 +669,22 @@ func (ctrl *PostController) ProcessImage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
 		return
 	}
-	jobID, err := ctrl.dispatcher.DispatchImageProcessing(c.Request.Context(), postID)
+	result, err := ctrl.dispatcher.DispatchImageProcessing(c.Request.Context(), postID)
 	if err != nil {
+		var saturated *QueueSaturatedError
+		if errors.As(err, &saturated) {
+			c.Header("Retry-After", strconv.Itoa(int(saturated.RetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "job queue is saturated, try again later"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not schedule job"})
 		return
 	}
-	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "status": "queued"})
+	status := "queued"
+	if result.Degraded {
+		status = "accepted-degraded"
+	}
+	c.JSON(http.StatusAccepted, gin.H{"job_id": result.JobID, "status": status, "queue": result.Queue})
 }
 
 type JobController struct {
@@ -201,6 +705,119 @@ func (ctrl *JobController) GetStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"job_id": jobID, "status": status})
 }
 
+type MetricsController struct {
+	metrics *SaturationMetrics
+}
+
+func NewMetricsController(metrics *SaturationMetrics) *MetricsController {
+	return &MetricsController{metrics: metrics}
+}
+
+func (ctrl *MetricsController) QueueSaturation(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"queues": ctrl.metrics.Snapshot()})
+}
+
+type ScalingController struct {
+	planner *ScalingPlanner
+}
+
+func NewScalingController(planner *ScalingPlanner) *ScalingController {
+	return &ScalingController{planner: planner}
+}
+
+// Signals is meant to be polled by an external autoscaler; recommended
+// replicas already include hysteresis, so it can be applied as-is.
+func (ctrl *ScalingController) Signals(c *gin.Context) {
+	now := time.Now()
+	queues, total := ctrl.planner.Evaluate(now)
+	c.JSON(http.StatusOK, gin.H{
+		"generated_at":             now.UTC(),
+		"worker_concurrency":       ctrl.planner.concurrency,
+		"stabilization_window_sec": ctrl.planner.stabilization.Seconds(),
+		"queues":                   queues,
+		"total":                    total,
+	})
+}
+
+func adminOnly() gin.HandlerFunc {
+	token := os.Getenv("ADMIN_TOKEN")
+	return func(c *gin.Context) {
+		given := c.GetHeader("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// --- TASK ERRORS ---
+
+// ErrorKind classifies why a task failed. retryPolicy decides from the kind
+// whether asynq should try the task again.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindInvalid
+	KindUnavailable
+)
+
+// DomainError is a task failure with a kind and the resource it concerns.
+type DomainError struct {
+	Kind     ErrorKind
+	Resource string
+	Err      error
+}
+
+func (e *DomainError) Error() string {
+	if e.Resource == "" {
+		return e.Err.Error()
+	}
+	return e.Resource + ": " + e.Err.Error()
+}
+
+func (e *DomainError) Unwrap() error { return e.Err }
+
+// KindOf reports the kind of the first DomainError in err's chain. Anything
+// unclassified is internal.
+func KindOf(err error) ErrorKind {
+	var de *DomainError
+	if errors.As(err, &de) {
+		return de.Kind
+	}
+	return KindInternal
+}
+
+// retryableByKind says which failures can succeed on a later attempt. A
+// missing record or a malformed payload will fail the same way every time.
+var retryableByKind = map[ErrorKind]bool{
+	KindInternal:    true,
+	KindNotFound:    false,
+	KindInvalid:     false,
+	KindUnavailable: true,
+}
+
+func Retryable(err error) bool {
+	return retryableByKind[KindOf(err)]
+}
+
+// retryPolicy marks failures that cannot succeed on retry with
+// asynq.SkipRetry, so they are archived at once instead of using up the
+// task's retries.
+func retryPolicy() asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+			err := next.ProcessTask(ctx, t)
+			if err != nil && !Retryable(err) {
+				return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+			}
+			return err
+		})
+	}
+}
+
 // --- WORKER IMPLEMENTATION ---
 
 type TaskProcessor struct {
@@ -213,10 +830,12 @@ func NewTaskProcessor(userDB *InMemoryUserStore) *TaskProcessor {
 
 func (p *TaskProcessor) ProcessWelcomeEmail(ctx context.Context, t *asynq.Task) error {
 	var payload map[string]uuid.UUID
-	json.Unmarshal(t.Payload(), &payload)
+	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+		return &DomainError{Kind: KindInvalid, Resource: "payload", Err: err}
+	}
 	user, ok := p.userDB.Find(payload["user_id"])
 	if !ok {
-		return fmt.Errorf("user not found: %s", payload["user_id"])
+		return &DomainError{Kind: KindNotFound, Resource: "user", Err: fmt.Errorf("user not found: %s", payload["user_id"])}
 	}
 	log.Printf("Processing welcome email for %s", user.Email)
 	time.Sleep(1 * time.Second)
@@ -228,7 +847,7 @@ func (p *TaskProcessor) ProcessImage(ctx context.Context, t *asynq.Task) error {
 	time.Sleep(3 * time.Second)
 	// Simulate exponential backoff test
 	if asynq.GetTaskInfo(ctx).Retried < 3 {
-		return errors.New("simulated network error during image fetch")
+		return &DomainError{Kind: KindUnavailable, Resource: "image", Err: errors.New("simulated network error during image fetch")}
 	}
 	log.Printf("Image task ID %s completed successfully", asynq.GetTaskInfo(ctx).ID)
 	return nil
@@ -248,11 +867,13 @@ type Application struct {
 	// other dependencies
 }
 
-func NewApplication(userCtrl *UserController, postCtrl *PostController, jobCtrl *JobController) *Application {
+func NewApplication(userCtrl *UserController, postCtrl *PostController, jobCtrl *JobController, metricsCtrl *MetricsController, scalingCtrl *ScalingController) *Application {
 	r := gin.Default()
 	r.POST("/users", userCtrl.Register)
 	r.POST("/posts/:id/image", postCtrl.ProcessImage)
 	r.GET("/jobs/:id", jobCtrl.GetStatus)
+	r.GET("/metrics/queues", metricsCtrl.QueueSaturation)
+	r.GET("/admin/scaling", adminOnly(), scalingCtrl.Signals)
 	return &Application{Router: r}
 }
 
@@ -266,20 +887,36 @@ func main() {
 
 	// --- DEPENDENCY INJECTION ---
 	userDB := NewInMemoryUserStore()
-	dispatcher := NewAsynqTaskDispatcher(redisOpt)
 	tracker := NewAsynqJobTracker(redisOpt)
+	saturation := NewSaturationMetrics()
+	sampler := NewQueueDepthSampler(tracker.inspector, 2*time.Second)
+	admission := NewAdmissionController(sampler, defaultQueueLimits, saturation)
+	throughput := NewThroughputMetrics(0.3)
+	go throughput.Run(context.Background(), 10*time.Second)
+	dispatcher := NewAsynqTaskDispatcher(redisOpt, admission, throughput)
+
+	// Concurrency of a single worker replica; the scaling signal is in units of these.
+	workerConcurrency := 10
+	if v, err := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY")); err == nil && v > 0 {
+		workerConcurrency = v
+	}
+	planner := NewScalingPlanner(sampler, throughput, defaultScalingTargets, workerConcurrency, 5*time.Minute)
 	
 	userController := NewUserController(userDB, dispatcher)
 	postController := NewPostController(dispatcher)
 	jobController := NewJobController(tracker)
+	metricsController := NewMetricsController(saturation)
+	scalingController := NewScalingController(planner)
 
 	// --- WORKER AND SCHEDULER ---
 	go func() {
 		processor := NewTaskProcessor(userDB)
 		srv := asynq.NewServer(redisOpt, asynq.Config{
-			Queues: map[string]int{"notifications": 2, "processing": 1},
+			Concurrency: workerConcurrency,
+			Queues:      map[string]int{"notifications": 4, "processing": 2, LowPriorityQueue: 1},
 		})
 		mux := asynq.NewServeMux()
+		mux.Use(throughput.Middleware(), retryPolicy())
 		mux.HandleFunc("email:welcome", processor.ProcessWelcomeEmail)
 		mux.HandleFunc("image:process", processor.ProcessImage)
 		mux.HandleFunc("system:cleanup", processor.ProcessPeriodicCleanup)
@@ -300,7 +937,7 @@ func main() {
 	}()
 
 	// --- HTTP SERVER ---
-	app := NewApplication(userController, postController, jobController)
+	app := NewApplication(userController, postController, jobController, metricsController, scalingController)
 	log.Println("Starting server on http://localhost:8000")
 	if err := app.Start(":8000"); err != nil {
 		log.Fatalf("Server start error: %v", err)
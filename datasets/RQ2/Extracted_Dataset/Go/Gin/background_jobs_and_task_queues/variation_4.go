@@ -7,18 +7,30 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // --- DEPENDENCIES ---
 // go get github.com/gin-gonic/gin
 // go get github.com/google/uuid
 // go get github.com/hibiken/asynq
+// go get go.opentelemetry.io/otel go.opentelemetry.io/otel/sdk
+// go get go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc
 
 // --- GLOBAL STATE & CONFIG ---
 
@@ -57,6 +69,167 @@ var (
 	jobStates = &sync.Map{}
 )
 
+// --- TRACING ---
+
+const serviceName = "gin-jobs-api"
+
+var tracer = otel.Tracer(serviceName)
+
+// initTracing installs an OTLP/gRPC exporter when OTEL_EXPORTER_OTLP_ENDPOINT
+// is set (e.g. "localhost:4317"); otherwise spans are created but dropped.
+// TRACE_SAMPLE_RATIO (0..1, default 1) samples new traces; requests that
+// arrive with a sampled parent are always kept so traces stay whole.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if os.Getenv("OTEL_EXPORTER_OTLP_INSECURE") == "true" {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	ratio := 1.0
+	if v, err := strconv.ParseFloat(os.Getenv("TRACE_SAMPLE_RATIO"), 64); err == nil && v >= 0 && v <= 1 {
+		ratio = v
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	log.Printf("Tracing enabled: exporting to %s, sample ratio %.2f", endpoint, ratio)
+	return tp.Shutdown, nil
+}
+
+// tracingMiddleware continues the caller's W3C trace (traceparent/tracestate)
+// or starts a new one, and echoes the context on the response so clients can
+// find their request in the tracing backend.
+func tracingMiddleware() gin.HandlerFunc {
+	propagator := otel.GetTextMapPropagator()
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		propagator.Inject(ctx, propagation.HeaderCarrier(c.Writer.Header()))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// enqueueTraced wraps the enqueue in a producer span and carries its context
+// to the worker in the task headers.
+func enqueueTraced(ctx context.Context, taskType string, payload []byte, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	ctx, span := tracer.Start(ctx, "enqueue "+taskType,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.system", "asynq"), attribute.String("asynq.task_type", taskType)),
+	)
+	defer span.End()
+
+	headers := make(map[string]string)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+	info, err := taskClient.EnqueueContext(ctx, asynq.NewTaskWithHeaders(taskType, payload, headers), opts...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "enqueue failed")
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("asynq.task_id", info.ID), attribute.String("asynq.queue", info.Queue))
+	return info, nil
+}
+
+// workerTracingMiddleware starts a consumer span for every task attempt, as a
+// child of the producer span when the task carries trace headers. Scheduled
+// tasks have none and start their own trace.
+func workerTracingMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, t *asynq.Task) error {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(t.Headers()))
+		attrs := []attribute.KeyValue{
+			attribute.String("messaging.system", "asynq"),
+			attribute.String("asynq.task_type", t.Type()),
+		}
+		if id, ok := asynq.GetTaskID(ctx); ok {
+			attrs = append(attrs, attribute.String("asynq.task_id", id))
+		}
+		if n, ok := asynq.GetRetryCount(ctx); ok {
+			attrs = append(attrs, attribute.Int("asynq.retry_count", n))
+		}
+		ctx, span := tracer.Start(ctx, "process "+t.Type(), trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		err := next.ProcessTask(ctx, t)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	})
+}
+
+// --- REPOSITORY ---
+// Thin wrappers over the in-memory maps so every storage access shows up as
+// a span, the way a real database client would be instrumented.
+
+func repoSpan(ctx context.Context, op, store string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "repo."+store+"."+op, trace.WithAttributes(
+		attribute.String("db.system", "memory"),
+		attribute.String("db.operation", op),
+		attribute.String("db.collection.name", store),
+	))
+}
+
+func saveUser(ctx context.Context, u User) {
+	_, span := repoSpan(ctx, "save", "users")
+	defer span.End()
+	users.Store(u.ID, u)
+}
+
+func setJobState(ctx context.Context, jobID, state string) {
+	_, span := repoSpan(ctx, "save", "job_states")
+	defer span.End()
+	span.SetAttributes(attribute.String("job.state", state))
+	jobStates.Store(jobID, state)
+}
+
+func getJobState(ctx context.Context, jobID string) (interface{}, bool) {
+	_, span := repoSpan(ctx, "load", "job_states")
+	defer span.End()
+	state, ok := jobStates.Load(jobID)
+	span.SetAttributes(attribute.Bool("db.found", ok))
+	return state, ok
+}
+
 // --- TASK PAYLOADS & TYPES ---
 
 const (
@@ -94,12 +267,12 @@ func handleCreateUser(c *gin.Context) {
 		IsActive:     true,
 		CreatedAt:    time.Now(),
 	}
-	users.Store(newUser.ID, newUser)
+	ctx := c.Request.Context()
+	saveUser(ctx, newUser)
 
 	// Dispatch background job
 	payload, _ := json.Marshal(WelcomeEmailJob{Email: newUser.Email, UserID: newUser.ID})
-	task := asynq.NewTask(TypeWelcomeEmail, payload)
-	if _, err := taskClient.Enqueue(task); err != nil {
+	if _, err := enqueueTraced(ctx, TypeWelcomeEmail, payload); err != nil {
 		log.Printf("ERROR: could not enqueue welcome email: %v", err)
 	}
 
@@ -113,17 +286,17 @@ func handleProcessImage(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
 	payload, _ := json.Marshal(ProcessImageJob{PostID: postID})
-	task := asynq.NewTask(TypeProcessImage, payload)
-	
+
 	// Retry with exponential backoff (default), timeout after 5 mins
-	info, err := taskClient.Enqueue(task, asynq.MaxRetry(5), asynq.Timeout(5*time.Minute))
+	info, err := enqueueTraced(ctx, TypeProcessImage, payload, asynq.MaxRetry(5), asynq.Timeout(5*time.Minute))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"msg": "could not start job"})
 		return
 	}
 
-	jobStates.Store(info.ID, "queued")
+	setJobState(ctx, info.ID, "queued")
 	c.JSON(http.StatusAccepted, gin.H{"job_id": info.ID})
 }
 
@@ -131,7 +304,7 @@ func handleGetJobStatus(c *gin.Context) {
 	jobID := c.Param("id")
 	
 	// Check our simple cache first
-	if status, ok := jobStates.Load(jobID); ok {
+	if status, ok := getJobState(c.Request.Context(), jobID); ok {
 		c.JSON(http.StatusOK, gin.H{"status": status})
 		return
 	}
@@ -160,11 +333,11 @@ func processWelcomeEmail(ctx context.Context, t *asynq.Task) error {
 
 func processImage(ctx context.Context, t *asynq.Task) error {
 	info := asynq.GetTaskInfo(ctx)
-	jobStates.Store(info.ID, "processing")
+	setJobState(ctx, info.ID, "processing")
 
 	var p ProcessImageJob
 	if err := json.Unmarshal(t.Payload(), &p); err != nil {
-		jobStates.Store(info.ID, "failed")
+		setJobState(ctx, info.ID, "failed")
 		return fmt.Errorf("bad payload: %w", err)
 	}
 
@@ -173,12 +346,12 @@ func processImage(ctx context.Context, t *asynq.Task) error {
 
 	// Simulate a flaky process
 	if rand.Float32() < 0.5 {
-		jobStates.Store(info.ID, "retrying")
+		setJobState(ctx, info.ID, "retrying")
 		return fmt.Errorf("simulated failure: could not connect to image service")
 	}
 
 	log.Printf("Image for post %s processed successfully", p.PostID)
-	jobStates.Store(info.ID, "completed")
+	setJobState(ctx, info.ID, "completed")
 	return nil
 }
 
@@ -196,6 +369,16 @@ func main() {
 	// NOTE: Requires a running Redis server on localhost:6379
 	redisOpt := asynq.RedisClientOpt{Addr: redisAddr}
 
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		log.Fatalf("FATAL: could not set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+
 	// Initialize global clients
 	taskClient = asynq.NewClient(redisOpt)
 	defer taskClient.Close()
@@ -205,6 +388,7 @@ func main() {
 	go func() {
 		srv := asynq.NewServer(redisOpt, asynq.Config{Concurrency: 10})
 		mux := asynq.NewServeMux()
+		mux.Use(workerTracingMiddleware)
 		mux.HandleFunc(TypeWelcomeEmail, processWelcomeEmail)
 		mux.HandleFunc(TypeProcessImage, processImage)
 		mux.HandleFunc(TypeNightlyCleanup, runNightlyCleanup)
@@ -227,6 +411,7 @@ func main() {
 
 	// Setup and run Gin server
 	router := gin.Default()
+	router.Use(tracingMiddleware())
 	router.POST("/user", handleCreateUser)
 	router.POST("/post/:id/image", handleProcessImage)
 	router.GET("/job/:id", handleGetJobStatus)
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -47,6 +51,156 @@ type Role struct {
 	Name string    `gorm:"uniqueIndex;not null"`
 }
 
+// Preferences lives in its own table keyed by user. Nullable columns mean
+// "not set by the user" so defaults can be merged in at read time.
+type Preferences struct {
+	UserID             uuid.UUID `gorm:"type:uuid;primary_key;"`
+	DisplayName        *string
+	Locale             *string
+	EmailNotifications *bool
+	PushNotifications  *bool
+	Settings           string `gorm:"type:text"` // JSON object validated against the "user.settings" schema
+	UpdatedAt          time.Time
+}
+
+// --- 1a. JSON SCHEMA VALIDATION ---
+
+// JSONSchema is the subset of JSON Schema needed to validate preference blobs.
+type JSONSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+}
+
+var schemaRegistry = make(map[string]*JSONSchema)
+
+func RegisterSchema(name, raw string) error {
+	var schema JSONSchema
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return fmt.Errorf("invalid schema %q: %w", name, err)
+	}
+	schemaRegistry[name] = &schema
+	return nil
+}
+
+func LookupSchema(name string) (*JSONSchema, error) {
+	schema, ok := schemaRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("schema %q is not registered", name)
+	}
+	return schema, nil
+}
+
+// Validate returns one message per violation, prefixed with the JSON path.
+func (s *JSONSchema) Validate(path string, value interface{}) []string {
+	var errs []string
+	if !s.matchesType(value) {
+		return []string{fmt.Sprintf("%s: expected %s", path, s.Type)}
+	}
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, e := range s.Enum {
+			if e == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			errs = append(errs, fmt.Sprintf("%s: must be one of %v", path, s.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: must be >= %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			errs = append(errs, fmt.Sprintf("%s: must be <= %v", path, *s.Maximum))
+		}
+	case string:
+		if s.MaxLength != nil && len(v) > *s.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s: must be at most %d characters", path, *s.MaxLength))
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, fmt.Sprintf("%s.%s: unknown property", path, k))
+				}
+				continue
+			}
+			errs = append(errs, prop.Validate(path+"."+k, v[k])...)
+		}
+	}
+	return errs
+}
+
+func (s *JSONSchema) matchesType(value interface{}) bool {
+	switch s.Type {
+	case "", "any":
+		return true
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+// Defaults builds an object from the "default" of every top-level property.
+func (s *JSONSchema) Defaults() map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for name, prop := range s.Properties {
+		if prop.Default != nil {
+			defaults[name] = prop.Default
+		}
+	}
+	return defaults
+}
+
+const userSettingsSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"theme":          {"type": "string", "enum": ["light", "dark", "system"], "default": "system"},
+		"items_per_page": {"type": "integer", "minimum": 5, "maximum": 100, "default": 20},
+		"timezone":       {"type": "string", "maxLength": 64, "default": "UTC"},
+		"digest":         {"type": "string", "enum": ["none", "daily", "weekly"], "default": "weekly"}
+	}
+}`
+
 // --- 2. REPOSITORY LAYER (Data Access) ---
 
 type UserRepository interface {
@@ -88,6 +242,33 @@ func (r *gormUserRepository) AssignRole(ctx context.Context, user *User, role *R
 	return r.db.WithContext(ctx).Model(user).Association("Roles").Append(role)
 }
 
+type PreferencesRepository interface {
+	FindByUserID(ctx context.Context, userID uuid.UUID) (*Preferences, error)
+	Save(ctx context.Context, prefs *Preferences) error
+}
+
+type gormPreferencesRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPreferencesRepository(db *gorm.DB) PreferencesRepository {
+	return &gormPreferencesRepository{db: db}
+}
+
+func (r *gormPreferencesRepository) FindByUserID(ctx context.Context, userID uuid.UUID) (*Preferences, error) {
+	var prefs Preferences
+	err := r.db.WithContext(ctx).First(&prefs, "user_id = ?", userID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// Save inserts or replaces the preferences row for prefs.UserID.
+func (r *gormPreferencesRepository) Save(ctx context.Context, prefs *Preferences) error {
+	return r.db.WithContext(ctx).Save(prefs).Error
+}
+
 // --- 3. SERVICE LAYER (Business Logic) ---
 
 type UserService interface {
@@ -156,6 +337,160 @@ func (s *userService) ListUsers(ctx context.Context, isActive *bool) ([]User, er
 	return s.userRepository.FindWithFilters(ctx, isActive)
 }
 
+// PreferencesView is the effective preferences of a user after defaults are merged.
+type PreferencesView struct {
+	UserID        uuid.UUID              `json:"user_id"`
+	DisplayName   string                 `json:"display_name"`
+	Locale        string                 `json:"locale"`
+	Notifications NotificationSettings   `json:"notifications"`
+	Settings      map[string]interface{} `json:"settings"`
+	UpdatedAt     *time.Time             `json:"updated_at,omitempty"`
+}
+
+type NotificationSettings struct {
+	Email *bool `json:"email"`
+	Push  *bool `json:"push"`
+}
+
+type PreferencesUpdate struct {
+	DisplayName   *string                `json:"display_name"`
+	Locale        *string                `json:"locale"`
+	Notifications *NotificationSettings  `json:"notifications"`
+	Settings      map[string]interface{} `json:"settings"`
+}
+
+// ValidationError carries every schema violation so the handler can report them together.
+type ValidationError struct {
+	Details []string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed: " + strings.Join(e.Details, "; ")
+}
+
+const (
+	defaultLocale             = "en-US"
+	defaultEmailNotifications = true
+	defaultPushNotifications  = false
+)
+
+type PreferencesService interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*PreferencesView, error)
+	UpdatePreferences(ctx context.Context, userID uuid.UUID, update PreferencesUpdate) (*PreferencesView, error)
+}
+
+type preferencesService struct {
+	userRepository  UserRepository
+	prefsRepository PreferencesRepository
+	settingsSchema  *JSONSchema
+}
+
+func NewPreferencesService(userRepo UserRepository, prefsRepo PreferencesRepository, settingsSchema *JSONSchema) PreferencesService {
+	return &preferencesService{userRepository: userRepo, prefsRepository: prefsRepo, settingsSchema: settingsSchema}
+}
+
+func (s *preferencesService) GetPreferences(ctx context.Context, userID uuid.UUID) (*PreferencesView, error) {
+	user, err := s.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := s.prefsRepository.FindByUserID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		prefs = &Preferences{UserID: userID}
+	} else if err != nil {
+		return nil, err
+	}
+	return s.mergeDefaults(user, prefs)
+}
+
+func (s *preferencesService) UpdatePreferences(ctx context.Context, userID uuid.UUID, update PreferencesUpdate) (*PreferencesView, error) {
+	user, err := s.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := s.prefsRepository.FindByUserID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		prefs = &Preferences{UserID: userID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if update.DisplayName != nil {
+		prefs.DisplayName = update.DisplayName
+	}
+	if update.Locale != nil {
+		prefs.Locale = update.Locale
+	}
+	if update.Notifications != nil {
+		if update.Notifications.Email != nil {
+			prefs.EmailNotifications = update.Notifications.Email
+		}
+		if update.Notifications.Push != nil {
+			prefs.PushNotifications = update.Notifications.Push
+		}
+	}
+	if update.Settings != nil {
+		// Round-trip through JSON so numbers are float64, as the validator expects.
+		raw, err := json.Marshal(update.Settings)
+		if err != nil {
+			return nil, err
+		}
+		var settings interface{}
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, err
+		}
+		if details := s.settingsSchema.Validate("settings", settings); len(details) > 0 {
+			return nil, &ValidationError{Details: details}
+		}
+		prefs.Settings = string(raw)
+	}
+
+	if err := s.prefsRepository.Save(ctx, prefs); err != nil {
+		return nil, err
+	}
+	return s.mergeDefaults(user, prefs)
+}
+
+// mergeDefaults fills every unset field; stored rows never contain defaults,
+// so changing a default takes effect for all users who have not overridden it.
+func (s *preferencesService) mergeDefaults(user *User, prefs *Preferences) (*PreferencesView, error) {
+	view := &PreferencesView{
+		UserID:      prefs.UserID,
+		DisplayName: strings.SplitN(user.Email, "@", 2)[0],
+		Locale:      defaultLocale,
+		Settings:    s.settingsSchema.Defaults(),
+	}
+	email, push := defaultEmailNotifications, defaultPushNotifications
+	view.Notifications = NotificationSettings{Email: &email, Push: &push}
+
+	if prefs.DisplayName != nil {
+		view.DisplayName = *prefs.DisplayName
+	}
+	if prefs.Locale != nil {
+		view.Locale = *prefs.Locale
+	}
+	if prefs.EmailNotifications != nil {
+		view.Notifications.Email = prefs.EmailNotifications
+	}
+	if prefs.PushNotifications != nil {
+		view.Notifications.Push = prefs.PushNotifications
+	}
+	if prefs.Settings != "" {
+		var stored map[string]interface{}
+		if err := json.Unmarshal([]byte(prefs.Settings), &stored); err != nil {
+			return nil, fmt.Errorf("corrupt settings for user %s: %w", prefs.UserID, err)
+		}
+		for k, v := range stored {
+			view.Settings[k] = v
+		}
+	}
+	if !prefs.UpdatedAt.IsZero() {
+		view.UpdatedAt = &prefs.UpdatedAt
+	}
+	return view, nil
+}
+
 // --- 4. HANDLER LAYER (API) ---
 
 type UserHandler struct {
@@ -215,6 +550,59 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
+type PreferencesHandler struct {
+	prefsService PreferencesService
+}
+
+func NewPreferencesHandler(prefsService PreferencesService) *PreferencesHandler {
+	return &PreferencesHandler{prefsService: prefsService}
+}
+
+func (h *PreferencesHandler) GetPreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID"})
+		return
+	}
+	prefs, err := h.prefsService.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		h.renderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func (h *PreferencesHandler) UpdatePreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID"})
+		return
+	}
+	var req PreferencesUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	prefs, err := h.prefsService.UpdatePreferences(c.Request.Context(), userID, req)
+	if err != nil {
+		h.renderError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func (h *PreferencesHandler) renderError(c *gin.Context, err error) {
+	var vErr *ValidationError
+	switch {
+	case errors.As(err, &vErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid settings", "details": vErr.Details})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // --- 5. MAIN (Setup and Routing) ---
 
 func main() {
@@ -227,7 +615,16 @@ func main() {
 	}
 
 	// Migrations
-	db.AutoMigrate(&User{}, &Post{}, &Role{})
+	db.AutoMigrate(&User{}, &Post{}, &Role{}, &Preferences{})
+
+	// Schemas
+	if err := RegisterSchema("user.settings", userSettingsSchema); err != nil {
+		log.Fatal(err)
+	}
+	settingsSchema, err := LookupSchema("user.settings")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Seeding Data
 	adminRole := &Role{ID: uuid.New(), Name: "ADMIN"}
@@ -239,6 +636,9 @@ func main() {
 	userRepo := NewGormUserRepository(db)
 	userService := NewUserService(db, userRepo)
 	userHandler := NewUserHandler(userService)
+	prefsRepo := NewGormPreferencesRepository(db)
+	prefsService := NewPreferencesService(userRepo, prefsRepo, settingsSchema)
+	prefsHandler := NewPreferencesHandler(prefsService)
 
 	// Gin Router
 	r := gin.Default()
@@ -248,6 +648,8 @@ func main() {
 		userRoutes.POST("", userHandler.CreateUser)
 		userRoutes.GET("", userHandler.ListUsers)
 		userRoutes.GET("/:id", userHandler.GetUser)
+		userRoutes.GET("/:id/preferences", prefsHandler.GetPreferences)
+		userRoutes.PUT("/:id/preferences", prefsHandler.UpdatePreferences)
 	}
 
 	log.Println("Server starting on port 8080")
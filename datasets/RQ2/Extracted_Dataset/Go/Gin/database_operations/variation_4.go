@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/subtle"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -9,6 +11,7 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -36,8 +39,31 @@ type Post struct {
 	Title   string    `gorm:"not null"`
 	Content string
 	Status  string `gorm:"default:'DRAFT'"`
+	// Denormalized from reactions; only ever changed with relative updates.
+	LikeCount     int64 `gorm:"not null;default:0"`
+	BookmarkCount int64 `gorm:"not null;default:0"`
 }
 
+// Reaction is one user's reaction of one type on a post. The composite key
+// makes adding the same reaction twice a no-op.
+type Reaction struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	PostID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Type      string    `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+// reactionCounters maps each reaction type to its counter column on posts.
+var reactionCounters = map[string]string{
+	"like":     "like_count",
+	"bookmark": "bookmark_count",
+}
+
+var (
+	errPostNotFound       = errors.New("post not found")
+	errInvalidCredentials = errors.New("invalid credentials")
+)
+
 type Role struct {
 	ID   uuid.UUID `gorm:"type:uuid;primary_key;"`
 	Name string    `gorm:"uniqueIndex;not null"`
@@ -62,7 +88,7 @@ func NewServer(db *gorm.DB) *Server {
 
 // setupRoutes defines all the API endpoints for the application.
 func (s *Server) setupRoutes() {
-	api := s.router.Group("/api")
+	api := s.router.Group("/api", s.authMiddleware())
 	{
 		api.POST("/users", s.handleCreateUser)
 		api.GET("/users", s.handleListUsers)
@@ -70,6 +96,10 @@ func (s *Server) setupRoutes() {
 		api.PUT("/users/:id", s.handleUpdateUser)
 		api.DELETE("/users/:id", s.handleDeleteUser)
 		api.POST("/posts/transactional", s.handleCreateUserAndPost) // Transactional endpoint
+		api.GET("/posts", s.handleListPosts)
+		api.GET("/posts/:id", s.handleGetPost)
+		api.PUT("/posts/:id/reactions/:type", s.handleAddReaction)
+		api.DELETE("/posts/:id/reactions/:type", s.handleRemoveReaction)
 	}
 }
 
@@ -204,6 +234,199 @@ func (s *Server) handleCreateUserAndPost(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"user_id": createdUser.ID})
 }
 
+// --- Authentication ---
+// Requests may carry HTTP Basic credentials (email and password). Requests
+// without them are anonymous; wrong ones are rejected.
+
+const viewerKey = "viewer"
+
+func (s *Server) authenticate(email, password string) (User, error) {
+	var user User
+	err := s.db.Where("email = ? AND is_active = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return User{}, errInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(user.PasswordHash), []byte("hashed_"+password)) != 1 {
+		return User{}, errInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if email, password, ok := c.Request.BasicAuth(); ok {
+			user, err := s.authenticate(email, password)
+			if errors.Is(err, errInvalidCredentials) {
+				c.Header("WWW-Authenticate", `Basic realm="api"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+				return
+			}
+			c.Set(viewerKey, user.ID)
+		}
+		c.Next()
+	}
+}
+
+// viewerID returns the authenticated user's ID; uuid.Nil means anonymous.
+func viewerID(c *gin.Context) uuid.UUID {
+	id, _ := c.Get(viewerKey)
+	viewer, _ := id.(uuid.UUID)
+	return viewer
+}
+
+// --- Reactions ---
+
+// viewerReactions returns, per post, the reaction types the viewer has left.
+func (s *Server) viewerReactions(viewer uuid.UUID, postIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	out := make(map[uuid.UUID][]string, len(postIDs))
+	for _, id := range postIDs {
+		out[id] = []string{}
+	}
+	if viewer == uuid.Nil || len(postIDs) == 0 {
+		return out, nil
+	}
+	var reactions []Reaction
+	if err := s.db.Where("user_id = ? AND post_id IN ?", viewer, postIDs).Order("type").Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range reactions {
+		out[r.PostID] = append(out[r.PostID], r.Type)
+	}
+	return out, nil
+}
+
+func postResponse(post Post, reacted []string) gin.H {
+	return gin.H{"post": post, "viewer_reactions": reacted}
+}
+
+func (s *Server) handleListPosts(c *gin.Context) {
+	var posts []Post
+	if err := s.db.Order("title").Find(&posts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list posts"})
+		return
+	}
+	ids := make([]uuid.UUID, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	reacted, err := s.viewerReactions(viewerID(c), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list posts"})
+		return
+	}
+	out := make([]gin.H, len(posts))
+	for i, p := range posts {
+		out[i] = postResponse(p, reacted[p.ID])
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) handleGetPost(c *gin.Context) {
+	var post Post
+	if err := s.db.First(&post, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	reacted, err := s.viewerReactions(viewerID(c), []uuid.UUID{post.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load post"})
+		return
+	}
+	c.JSON(http.StatusOK, postResponse(post, reacted[post.ID]))
+}
+
+func (s *Server) handleAddReaction(c *gin.Context) {
+	s.changeReaction(c, true)
+}
+
+func (s *Server) handleRemoveReaction(c *gin.Context) {
+	s.changeReaction(c, false)
+}
+
+// changeReaction adds or removes a reaction and adjusts the post's counter in
+// the same transaction. The counter only moves when the reaction row was
+// actually inserted or deleted, and it moves with count = count ± 1 rather
+// than a read-modify-write, so concurrent and repeated requests cannot skew it.
+func (s *Server) changeReaction(c *gin.Context, add bool) {
+	viewer := viewerID(c)
+	if viewer == uuid.Nil {
+		c.Header("WWW-Authenticate", `Basic realm="api"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	postID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+	reactionType := c.Param("type")
+	column, ok := reactionCounters[reactionType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reaction type"})
+		return
+	}
+
+	var post Post
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var exists int64
+		if err := tx.Model(&Post{}).Where("id = ?", postID).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists == 0 {
+			return errPostNotFound
+		}
+
+		reaction := Reaction{UserID: viewer, PostID: postID, Type: reactionType}
+		var changed int64
+		if add {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+			if res.Error != nil {
+				return res.Error
+			}
+			changed = res.RowsAffected
+		} else {
+			res := tx.Where("user_id = ? AND post_id = ? AND type = ?", viewer, postID, reactionType).Delete(&Reaction{})
+			if res.Error != nil {
+				return res.Error
+			}
+			changed = res.RowsAffected
+		}
+
+		if changed == 1 {
+			delta := gorm.Expr(column+" + 1")
+			if !add {
+				delta = gorm.Expr(column + " - 1")
+			}
+			if err := tx.Model(&Post{}).Where("id = ?", postID).UpdateColumn(column, delta).Error; err != nil {
+				return err
+			}
+		}
+		return tx.First(&post, "id = ?", postID).Error
+	})
+	if errors.Is(err, errPostNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reaction"})
+		return
+	}
+
+	reacted, err := s.viewerReactions(viewer, []uuid.UUID{postID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load post"})
+		return
+	}
+	c.JSON(http.StatusOK, postResponse(post, reacted[postID]))
+}
+
 // --- Main ---
 func main() {
 	// Database Setup
@@ -215,7 +438,7 @@ func main() {
 	}
 
 	// Migrations
-	if err := db.AutoMigrate(&User{}, &Post{}, &Role{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &Post{}, &Role{}, &Reaction{}); err != nil {
 		log.Fatalf("migration failed: %v", err)
 	}
 
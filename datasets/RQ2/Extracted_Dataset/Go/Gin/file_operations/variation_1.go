@@ -1,41 +1,58 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/jpeg"
-	_ "image/png" // register PNG decoder
+	"image/png"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/nfnt/resize"
 	"github.com/xuri/excelize/v2"
 )
 
 // --- Domain Schema ---
 
-type UserRole string
+type Role string
 
 const (
-	AdminRole UserRole = "ADMIN"
-	UserRole  UserRole = "USER"
+	AdminRole Role = "ADMIN"
+	UserRole  Role = "USER"
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         UserRole  `json:"role"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           uuid.UUID   `json:"id"`
+	Email        string      `json:"email"`
+	PasswordHash string      `json:"-"`
+	Role         Role        `json:"role"`
+	IsActive     bool        `json:"is_active"`
+	CreatedAt    time.Time   `json:"created_at"`
+	Avatar       AvatarState `json:"-"`
 }
 
 type PostStatus string
@@ -61,27 +78,121 @@ var mockPosts = []Post{
 	{ID: uuid.New(), UserID: uuid.New(), Title: "A Draft Post", Content: "This is not yet published.", Status: DraftStatus},
 }
 
+// Attachment is the stored record for an uploaded post image. Metadata holds
+// what was extracted before sensitive tags were stripped, minus those tags.
+// An attachment is only served once Scan.Status is clean.
+type Attachment struct {
+	ID          uuid.UUID     `json:"id"`
+	PostID      uuid.UUID     `json:"post_id"`
+	UploadedBy  uuid.UUID     `json:"uploaded_by"`
+	FileName    string        `json:"file_name"`
+	Original    BlobLocation  `json:"original"`
+	Resized     BlobLocation  `json:"resized"`
+	Rendition   Rendition     `json:"rendition"`
+	AutoRotated bool          `json:"auto_rotated"`
+	Metadata    ImageMetadata `json:"metadata"`
+	Scan        ScanResult    `json:"scan"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+var (
+	attachmentsMu sync.RWMutex
+	attachments   = make(map[uuid.UUID]Attachment)
+	attachmentDir = filepath.Join(os.TempDir(), "post-attachments")
+	quarantineDir = filepath.Join(os.TempDir(), "post-attachments-quarantine")
+
+	hotStore        BlobStore
+	coldStore       BlobStore // nil when no archive is configured
+	quarantineStore BlobStore
+)
+
+const maxImageBytes = 8 << 20
+
 // --- Main Application ---
 
 func main() {
 	// In a real app, you'd use gin.ReleaseMode
 	gin.SetMode(gin.DebugMode)
+	seedAdmin()
 
 	router := gin.Default()
 	// Set a lower memory limit for multipart forms (default is 32 MiB)
 	router.MaxMultipartMemory = 8 << 20 // 8 MiB
 
 	// --- Routes ---
-	api := router.Group("/api/v1")
+	api := router.Group("/api/v1", authMiddleware())
 	{
 		// POST /api/v1/users/import - Upload a CSV or XLSX file to bulk-create users
 		api.POST("/users/import", handleUserImport)
 
+		// GET /api/v1/users/:id - User record with avatar URLs
+		api.GET("/users/:id", handleUserGet)
+
+		// POST /api/v1/users/:id/avatar - Upload an avatar; square renditions are made in the background
+		api.POST("/users/:id/avatar", handleAvatarUpload)
+
+		// GET /api/v1/users/:id/avatar?size=128 - Avatar rendition, or a generated identicon
+		api.GET("/users/:id/avatar", handleAvatarGet)
+
 		// POST /api/v1/posts/:id/image - Upload and resize a cover image for a post
-		api.POST("/posts/:id/image", handlePostImageUpload)
+		api.POST("/posts/:id/image", requireRole(AdminRole, UserRole), handlePostImageUpload)
+
+		// GET /api/v1/attachments?q=&format=&scan_status= - Search image attachments by metadata
+		api.GET("/attachments", handleAttachmentSearch)
+
+		// GET /api/v1/attachments/:id - Attachment record, including its scan status
+		api.GET("/attachments/:id", handleAttachmentGet)
+
+		// GET /api/v1/attachments/:id/rendition - Redirect to the current immutable rendition URL
+		api.GET("/attachments/:id/rendition", handleRenditionRedirect)
+
+		// GET|HEAD /api/v1/attachments/:id/renditions/:sha256.jpg - Cacheable rendition bytes
+		api.GET("/attachments/:id/renditions/:file", handleRenditionServe)
+		api.HEAD("/attachments/:id/renditions/:file", handleRenditionServe)
+
+		// POST /api/v1/attachments/:id/renditions?width=1024 - Regenerate the rendition from the original
+		api.POST("/attachments/:id/renditions", handleRenditionRegenerate)
+
+		// POST /api/v1/attachments/:id/restore?blob=original - Re-hydrate a cold blob in the background
+		api.POST("/attachments/:id/restore", handleAttachmentRestore)
+
+		// GET /api/v1/jobs/:id - Status of a restore job
+		api.GET("/jobs/:id", handleRestoreJobStatus)
 
 		// GET /api/v1/posts/export - Download a CSV report of all posts
 		api.GET("/posts/export", handlePostsExport)
+
+		// GET /api/v1/audit - Security events such as quarantined uploads (ADMIN only)
+		api.GET("/audit", requireRole(AdminRole), handleAuditLog)
+	}
+
+	local, err := NewLocalBlobStore(attachmentDir)
+	if err != nil {
+		log.Fatalf("Failed to create attachment directory: %v", err)
+	}
+	hotStore = local
+	if quarantineStore, err = NewLocalBlobStore(quarantineDir); err != nil {
+		log.Fatalf("Failed to create quarantine directory: %v", err)
+	}
+	if addr := os.Getenv("CLAMD_ADDR"); addr != "" {
+		scanner = &ClamdScanner{Addr: addr, Timeout: 2 * time.Minute}
+	} else {
+		scanner = NoopScanner{}
+		log.Println("CLAMD_ADDR not set; uploads are marked clean without a malware scan")
+	}
+	scanWorkers := 2
+	if n, err := strconv.Atoi(os.Getenv("SCAN_WORKERS")); err == nil && n > 0 {
+		scanWorkers = n
+	}
+	go runScanWorkers(context.Background(), scanWorkers)
+	go runAvatarWorkers(context.Background(), 1)
+	if archive, err := NewS3BlobStoreFromEnv(); err != nil {
+		log.Fatalf("Failed to configure archive storage: %v", err)
+	} else if archive != nil {
+		coldStore = archive
+		go runLifecycleScheduler(context.Background(), loadLifecycleConfig())
+	} else {
+		log.Println("S3_ENDPOINT not set; attachments stay in hot storage")
 	}
 
 	log.Println("Server starting on port 8080...")
@@ -92,7 +203,8 @@ func main() {
 
 // --- Handlers (Functional/Procedural Style) ---
 
-// handleUserImport processes a CSV or Excel file to import users.
+// handleUserImport processes a CSV or Excel file to import users. Columns
+// are email, role, is_active and an optional password.
 func handleUserImport(c *gin.Context) {
 	file, err := c.FormFile("user_data")
 	if err != nil {
@@ -129,15 +241,47 @@ func handleUserImport(c *gin.Context) {
 	}
 
 	log.Printf("Successfully parsed %d users from %s", len(users), file.Filename)
-	// In a real app, you would now save these users to the database.
+	processor := Processor[User]{
+		Workers: importWorkers,
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     100 * time.Millisecond,
+			Retryable:   func(err error) bool { return !errors.Is(err, errInvalidUser) },
+		},
+		OnProgress: func(p Progress) {
+			if p.Completed()%500 == 0 || p.Completed() == p.Total {
+				log.Printf("User import %s: %d/%d done, %d failed", file.Filename, p.Completed(), p.Total, p.Failed)
+			}
+		},
+	}
+	err = processor.Run(c.Request.Context(), users, saveImportedUser)
+
+	// Rows are reported 1-based with the header as row 1.
+	failed := []gin.H{}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		for _, itemErr := range batchErr.Errors {
+			failed = append(failed, gin.H{"row": itemErr.Index + 2, "email": users[itemErr.Index].Email, "error": itemErr.Err.Error()})
+		}
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	imported := len(users) - len(failed)
 	c.JSON(http.StatusOK, gin.H{
-		"message":      fmt.Sprintf("Successfully imported %d users.", len(users)),
-		"imported_ids": len(users),
+		"message":      fmt.Sprintf("Successfully imported %d users.", imported),
+		"imported_ids": imported,
+		"failed":       failed,
 	})
 }
 
-// handlePostImageUpload resizes an uploaded image for a post.
+// handlePostImageUpload extracts metadata from an uploaded image, stores a
+// copy stripped of sensitive tags plus a resized version, and records both as
+// an attachment pending a malware scan. Set the form field auto_rotate=false
+// to keep the pixels as they were shot instead of applying the EXIF
+// orientation. The authenticated caller is recorded as the uploader.
 func handlePostImageUpload(c *gin.Context) {
+	uploader, _ := currentUser(c)
 	postID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
@@ -149,6 +293,7 @@ func handlePostImageUpload(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Image file not provided"})
 		return
 	}
+	autoRotate := c.DefaultPostForm("auto_rotate", "true") != "false"
 
 	// Open the uploaded file
 	src, err := file.Open()
@@ -158,44 +303,127 @@ func handlePostImageUpload(c *gin.Context) {
 	}
 	defer src.Close()
 
+	data, err := io.ReadAll(io.LimitReader(src, maxImageBytes+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded image"})
+		return
+	}
+	if len(data) > maxImageBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large"})
+		return
+	}
+
+	meta, err := extractImageMetadata(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image format"})
+		return
+	}
+	sanitized, err := stripImageMetadata(data, meta.Format, meta.Orientation)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed image"})
+		return
+	}
+
 	// Decode the image
-	img, _, err := image.Decode(src)
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image format"})
 		return
 	}
 
-	// Resize the image to a max width of 1024, maintaining aspect ratio
-	resizedImg := resize.Resize(1024, 0, img, resize.Lanczos3)
+	att := Attachment{
+		ID:         uuid.New(),
+		PostID:     postID,
+		UploadedBy: uploader.ID,
+		FileName:   filepath.Base(file.Filename),
+		Metadata:   meta,
+		Scan:       ScanResult{Status: ScanPending},
+		CreatedAt:  time.Now().UTC(),
+	}
+	if autoRotate && meta.Orientation > 1 {
+		img = applyOrientation(img, meta.Orientation)
+		att.AutoRotated = true
+	}
 
-	// Create a temporary file for the resized image
-	tempFile, err := os.CreateTemp("", "resized-*.jpg")
+	resized, rendition, err := renderRendition(att.ID, img, defaultRenditionWidth)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp file for resized image"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode resized image"})
 		return
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	att.Rendition = rendition
 
-	// Encode the resized image as JPEG
-	if err := jpeg.Encode(tempFile, resizedImg, nil); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode resized image"})
+	ctx := c.Request.Context()
+	att.Original = hotLocation(att.ID.String() + "-original." + meta.Format)
+	if err := hotStore.Put(ctx, att.Original.Key, bytes.NewReader(sanitized)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store original image"})
+		return
+	}
+	att.Resized = hotLocation(rendition.key(att.ID))
+	if err := hotStore.Put(ctx, att.Resized.Key, bytes.NewReader(resized)); err != nil {
+		hotStore.Delete(ctx, att.Original.Key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store resized image"})
 		return
 	}
 
-	log.Printf("Image for post %s resized and saved to %s", postID, tempFile.Name())
-	// In a real app, you would now move this file to permanent storage (e.g., S3)
-	// and update the post record with the image URL.
+	attachmentsMu.Lock()
+	attachments[att.ID] = att
+	attachmentsMu.Unlock()
+	enqueueScan(att.ID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Image uploaded and resized successfully",
-		"post_id":     postID,
-		"temp_path":   tempFile.Name(),
-		"new_width":   resizedImg.Bounds().Dx(),
-		"new_height":  resizedImg.Bounds().Dy(),
+	log.Printf("Image for post %s stored as attachment %s (stripped %d tags)", postID, att.ID, len(meta.StrippedTags))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Image uploaded and resized; it becomes available once the malware scan completes",
+		"attachment": att,
+		"new_width":  rendition.Width,
+		"new_height": rendition.Height,
 	})
 }
 
+func handleAttachmentGet(c *gin.Context) {
+	if att, ok := lookupAttachment(c); ok {
+		c.JSON(http.StatusOK, att)
+	}
+}
+
+// handleAttachmentSearch matches q against the format and extracted tag values.
+func handleAttachmentSearch(c *gin.Context) {
+	q := strings.ToLower(c.Query("q"))
+	format := strings.ToLower(c.Query("format"))
+	scanStatus := ScanStatus(strings.ToLower(c.Query("scan_status")))
+
+	attachmentsMu.RLock()
+	results := make([]Attachment, 0)
+	for _, att := range attachments {
+		if format != "" && att.Metadata.Format != format {
+			continue
+		}
+		if scanStatus != "" && att.Scan.Status != scanStatus {
+			continue
+		}
+		if q != "" && !attachmentMatches(att, q) {
+			continue
+		}
+		results = append(results, att)
+	}
+	attachmentsMu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].CreatedAt.After(results[j].CreatedAt) })
+	c.JSON(http.StatusOK, gin.H{"data": results, "total": len(results)})
+}
+
+func attachmentMatches(att Attachment, q string) bool {
+	if strings.Contains(strings.ToLower(att.FileName), q) {
+		return true
+	}
+	for name, value := range att.Metadata.Tags {
+		if strings.Contains(strings.ToLower(name), q) || strings.Contains(strings.ToLower(value), q) {
+			return true
+		}
+	}
+	return false
+}
+
 // handlePostsExport streams a CSV file of all posts.
 func handlePostsExport(c *gin.Context) {
 	fileName := fmt.Sprintf("posts_export_%s.csv", time.Now().Format("20060102150405"))
@@ -237,68 +465,2097 @@ func handlePostsExport(c *gin.Context) {
 	})
 }
 
-// --- Helper Functions ---
+// --- Image Metadata ---
 
-func parseUsersFromCSV(filePath string) ([]User, error) {
-	file, err := os.Open(filePath)
+type ImageMetadata struct {
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	Format       string            `json:"format"`
+	Orientation  int               `json:"orientation,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	StrippedTags []string          `json:"stripped_tags,omitempty"`
+}
+
+const (
+	exifIFDPointer = 0x8769
+	gpsIFDPointer  = 0x8825
+)
+
+var ifd0TagNames = map[uint16]string{
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+}
+
+var exifTagNames = map[uint16]string{
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x920A: "FocalLength",
+	0xA430: "CameraOwnerName",
+	0xA431: "BodySerialNumber",
+	0xA434: "LensModel",
+	0xA435: "LensSerialNumber",
+}
+
+var gpsTagNames = map[uint16]string{
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+	0x0006: "GPSAltitude",
+	0x001D: "GPSDateStamp",
+}
+
+// sensitiveTags identify the device or the person; every GPS tag is also
+// treated as sensitive.
+var sensitiveTags = map[string]bool{
+	"Make":             true,
+	"Model":            true,
+	"Software":         true,
+	"Artist":           true,
+	"CameraOwnerName":  true,
+	"BodySerialNumber": true,
+	"LensModel":        true,
+	"LensSerialNumber": true,
+}
+
+func isSensitiveTag(name string) bool {
+	return sensitiveTags[name] || strings.HasPrefix(name, "GPS")
+}
+
+// extractImageMetadata reads dimensions and format, and EXIF tags for JPEG
+// and PNG. Sensitive tags are listed in StrippedTags but not kept in Tags.
+func extractImageMetadata(data []byte) (ImageMetadata, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return ImageMetadata{}, err
 	}
-	defer file.Close()
+	meta := ImageMetadata{Width: cfg.Width, Height: cfg.Height, Format: format}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	var tiff []byte
+	switch format {
+	case "jpeg":
+		_, err = walkJPEGSegments(data, func(marker byte, payload []byte) bool {
+			if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				tiff = payload[6:]
+			}
+			return true
+		})
+	case "png":
+		_, err = walkPNGChunks(data, func(typ string, chunk []byte) bool {
+			if typ == "eXIf" {
+				tiff = chunk
+			}
+			return true
+		})
+	}
+	if err != nil || tiff == nil {
+		// Metadata is best effort: a broken EXIF block is simply ignored.
+		return meta, nil
+	}
+
+	tags, err := parseEXIF(tiff)
 	if err != nil {
-		return nil, err
+		return meta, nil
+	}
+	if o, err := strconv.Atoi(tags["Orientation"]); err == nil && o >= 1 && o <= 8 {
+		meta.Orientation = o
+	}
+	meta.Tags = make(map[string]string)
+	for name, value := range tags {
+		if isSensitiveTag(name) {
+			meta.StrippedTags = append(meta.StrippedTags, name)
+			continue
+		}
+		meta.Tags[name] = value
 	}
+	sort.Strings(meta.StrippedTags)
+	return meta, nil
+}
 
-	if len(records) < 2 {
-		return nil, fmt.Errorf("CSV must have a header and at least one data row")
+// stripImageMetadata drops EXIF, XMP and IPTC blocks (JPEG APP1/APP13, PNG
+// eXIf and text chunks) while leaving the image data byte-for-byte intact.
+// The pixels of the original are stored as shot, so an orientation other
+// than 1 is written back as an EXIF block holding only that tag; without it
+// the original would display sideways.
+func stripImageMetadata(data []byte, format string, orientation int) ([]byte, error) {
+	var keep []byte
+	if orientation > 1 && orientation <= 8 {
+		keep = orientationEXIF(orientation)
 	}
+	out := make([]byte, 0, len(data))
+	switch format {
+	case "jpeg":
+		out = append(out, data[:2]...)
+		if keep != nil {
+			payload := append([]byte("Exif\x00\x00"), keep...)
+			out = append(out, 0xFF, 0xE1)
+			out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+			out = append(out, payload...)
+		}
+		rest, err := walkJPEGSegments(data, func(marker byte, payload []byte) bool {
+			if marker == 0xE1 || marker == 0xED {
+				return true
+			}
+			out = append(out, 0xFF, marker)
+			out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+			out = append(out, payload...)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(out, data[rest:]...), nil
+	case "png":
+		out = append(out, data[:8]...)
+		_, err := walkPNGChunks(data, func(typ string, chunk []byte) bool {
+			switch typ {
+			case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+				return true
+			}
+			out = binary.BigEndian.AppendUint32(out, uint32(len(chunk)))
+			start := len(out)
+			out = append(out, typ...)
+			out = append(out, chunk...)
+			// The CRC only covers type and data, so it is recomputed rather than tracked.
+			out = binary.BigEndian.AppendUint32(out, pngCRC(out[start:]))
+			if typ == "IHDR" && keep != nil {
+				// eXIf must come before the image data; right after IHDR is safe.
+				out = binary.BigEndian.AppendUint32(out, uint32(len(keep)))
+				start = len(out)
+				out = append(out, "eXIf"...)
+				out = append(out, keep...)
+				out = binary.BigEndian.AppendUint32(out, pngCRC(out[start:]))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	return data, nil
+}
 
-	var users []User
-	// Skip header row (records[0])
-	for _, record := range records[1:] {
-		isActive, _ := strconv.ParseBool(record[2])
-		user := User{
-			ID:        uuid.New(),
-			Email:     record[0],
-			Role:      UserRole(record[1]),
-			IsActive:  isActive,
-			CreatedAt: time.Now().UTC(),
+// orientationEXIF builds a big-endian TIFF block whose only IFD0 entry is
+// the Orientation tag.
+func orientationEXIF(orientation int) []byte {
+	b := []byte("MM\x00\x2a")
+	b = binary.BigEndian.AppendUint32(b, 8) // IFD0 offset
+	b = binary.BigEndian.AppendUint16(b, 1) // entry count
+	b = binary.BigEndian.AppendUint16(b, 0x0112)
+	b = binary.BigEndian.AppendUint16(b, 3) // SHORT
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(orientation))
+	b = binary.BigEndian.AppendUint16(b, 0) // value padding
+	return binary.BigEndian.AppendUint32(b, 0)
+}
+
+var errMalformedImage = errors.New("malformed image")
+
+// walkJPEGSegments calls fn with each marker segment up to the start of scan
+// and returns the offset where the entropy-coded image data begins.
+func walkJPEGSegments(data []byte, fn func(marker byte, payload []byte) bool) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, errMalformedImage
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0, errMalformedImage
 		}
-		users = append(users, user)
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan / end of image
+			return i, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no length
+			i += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, errMalformedImage
+		}
+		if !fn(marker, data[i+4:i+2+length]) {
+			return i + 2 + length, nil
+		}
+		i += 2 + length
 	}
-	return users, nil
+	return 0, errMalformedImage
 }
 
-func parseUsersFromXLSX(filePath string) ([]User, error) {
-	f, err := excelize.OpenFile(filePath)
-	if err != nil {
+// walkPNGChunks calls fn with each chunk's type and data, stopping after IEND.
+func walkPNGChunks(data []byte, fn func(typ string, chunk []byte) bool) (int, error) {
+	if len(data) < 8 || string(data[:8]) != "\x89PNG\r\n\x1a\n" {
+		return 0, errMalformedImage
+	}
+	i := 8
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return 0, errMalformedImage
+		}
+		typ := string(data[i+4 : i+8])
+		next := i + 12 + length
+		if !fn(typ, data[i+8:i+8+length]) || typ == "IEND" {
+			return next, nil
+		}
+		i = next
+	}
+	return 0, errMalformedImage
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// parseEXIF decodes IFD0 plus the Exif and GPS sub-IFDs of a TIFF block.
+// Only the tags in the name tables are kept, except that unknown GPS tags are
+// named by number so they are still reported as stripped.
+func parseEXIF(tiff []byte) (map[string]string, error) {
+	if len(tiff) < 8 {
+		return nil, errMalformedImage
+	}
+	r := tiffReader{data: tiff}
+	switch string(tiff[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, errMalformedImage
+	}
+	if r.order.Uint16(tiff[2:]) != 42 {
+		return nil, errMalformedImage
+	}
+
+	tags := make(map[string]string)
+	ptrs := r.readIFD(int(r.order.Uint32(tiff[4:])), ifd0TagNames, "", tags)
+	if off, ok := ptrs[exifIFDPointer]; ok {
+		r.readIFD(off, exifTagNames, "", tags)
+	}
+	if off, ok := ptrs[gpsIFDPointer]; ok {
+		r.readIFD(off, gpsTagNames, "GPS", tags)
+	}
+	return tags, nil
+}
+
+// readIFD stores the named entries of one IFD in tags and returns the sub-IFD
+// pointers it contains.
+func (r tiffReader) readIFD(off int, names map[uint16]string, unknownPrefix string, tags map[string]string) map[uint16]int {
+	ptrs := make(map[uint16]int)
+	if off < 0 || off+2 > len(r.data) {
+		return ptrs
+	}
+	n := int(r.order.Uint16(r.data[off:]))
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(r.data) {
+			break
+		}
+		tag := r.order.Uint16(r.data[e:])
+		typ := r.order.Uint16(r.data[e+2:])
+		count := r.order.Uint32(r.data[e+4:])
+		if tag == exifIFDPointer || tag == gpsIFDPointer {
+			ptrs[tag] = int(r.order.Uint32(r.data[e+8:]))
+			continue
+		}
+		name, known := names[tag]
+		if !known {
+			if unknownPrefix == "" {
+				continue
+			}
+			name = fmt.Sprintf("%sTag0x%04X", unknownPrefix, tag)
+		}
+		if v, ok := r.value(e+8, typ, count); ok {
+			tags[name] = v
+		}
+	}
+	return ptrs
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (r tiffReader) value(field int, typ uint16, count uint32) (string, bool) {
+	size := tiffTypeSizes[typ]
+	if size == 0 || count == 0 || count > 1<<16 {
+		return "", false
+	}
+	total := size * int(count)
+	start := field
+	if total > 4 {
+		start = int(r.order.Uint32(r.data[field:]))
+	}
+	if start < 0 || start+total > len(r.data) {
+		return "", false
+	}
+	b := r.data[start : start+total]
+
+	parts := make([]string, 0, count)
+	for i := 0; i < int(count); i++ {
+		switch typ {
+		case 2: // ASCII
+			return strings.TrimRight(string(b), "\x00 "), true
+		case 3:
+			parts = append(parts, strconv.Itoa(int(r.order.Uint16(b[i*2:]))))
+		case 4:
+			parts = append(parts, strconv.FormatUint(uint64(r.order.Uint32(b[i*4:])), 10))
+		case 9:
+			parts = append(parts, strconv.Itoa(int(int32(r.order.Uint32(b[i*4:])))))
+		case 5:
+			parts = append(parts, fmt.Sprintf("%d/%d", r.order.Uint32(b[i*8:]), r.order.Uint32(b[i*8+4:])))
+		case 10:
+			parts = append(parts, fmt.Sprintf("%d/%d", int32(r.order.Uint32(b[i*8:])), int32(r.order.Uint32(b[i*8+4:]))))
+		default: // BYTE, UNDEFINED
+			return fmt.Sprintf("%d bytes", total), true
+		}
+	}
+	return strings.Join(parts, ","), true
+}
+
+func pngCRC(b []byte) uint32 {
+	crc := ^uint32(0)
+	for _, c := range b {
+		crc ^= uint32(c)
+		for k := 0; k < 8; k++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ 0xEDB88320
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+// applyOrientation turns the pixels upright according to the EXIF
+// orientation value (1-8).
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 CW
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 CCW
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// --- Blob Storage ---
+
+type StorageTier string
+
+const (
+	TierHot         StorageTier = "hot"
+	TierCold        StorageTier = "cold"
+	TierRestoring   StorageTier = "restoring"
+	TierQuarantined StorageTier = "quarantined"
+)
+
+// Restore latency classes tell clients how long a blob takes to become readable.
+const (
+	LatencyInstant = "instant"
+	LatencyMinutes = "minutes"
+	LatencyHours   = "hours"
+)
+
+// BlobLocation records where one blob of an attachment currently lives.
+type BlobLocation struct {
+	Tier           StorageTier `json:"tier"`
+	Key            string      `json:"key"`
+	RestoreLatency string      `json:"restore_latency"`
+	MovedAt        *time.Time  `json:"moved_at,omitempty"`
+}
+
+func hotLocation(key string) BlobLocation {
+	return BlobLocation{Tier: TierHot, Key: key, RestoreLatency: LatencyInstant}
+}
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	RestoreLatency() string
+}
+
+// LocalBlobStore keeps blobs as files in a single directory.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return &LocalBlobStore{dir: dir}, nil
+}
 
-	// Get all the rows in the first sheet.
-	rows, err := f.GetRows(f.GetSheetName(0))
+func (s *LocalBlobStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+// Put writes to a temp file first so readers never see a partial blob.
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalBlobStore) RestoreLatency() string { return LatencyInstant }
+
+// S3BlobStore talks to any S3-compatible archive (AWS S3, MinIO, ...).
+type S3BlobStore struct {
+	client       *minio.Client
+	bucket       string
+	storageClass string
+	latency      string
+}
+
+// NewS3BlobStoreFromEnv returns nil when S3_ENDPOINT is unset.
+func NewS3BlobStoreFromEnv() (*S3BlobStore, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return nil, errors.New("S3_BUCKET is required when S3_ENDPOINT is set")
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), ""),
+		Secure: os.Getenv("S3_USE_SSL") != "false",
+	})
 	if err != nil {
 		return nil, err
 	}
+	// Archive classes such as GLACIER need a thaw before reads; standard classes do not.
+	storageClass := os.Getenv("S3_STORAGE_CLASS")
+	latency := LatencyMinutes
+	if strings.HasPrefix(storageClass, "GLACIER") || storageClass == "DEEP_ARCHIVE" {
+		latency = LatencyHours
+	}
+	return &S3BlobStore{client: client, bucket: bucket, storageClass: storageClass, latency: latency}, nil
+}
 
-	if len(rows) < 2 {
-		return nil, fmt.Errorf("XLSX must have a header and at least one data row")
+func (s *S3BlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, -1, minio.PutObjectOptions{StorageClass: s.storageClass})
+	return err
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3BlobStore) RestoreLatency() string { return s.latency }
+
+// Thawer is implemented by archives whose objects must be thawed before
+// Get can read them.
+type Thawer interface {
+	// Thaw requests a readable copy of key if none is pending and reports
+	// whether that copy is ready. Callers poll it until it returns true.
+	Thaw(ctx context.Context, key string) (bool, error)
+}
+
+// Thaw issues a RestoreObject for archive classes and reads the restore
+// status back from the object's metadata. Standard classes are always ready.
+func (s *S3BlobStore) Thaw(ctx context.Context, key string) (bool, error) {
+	if s.latency != LatencyHours {
+		return true, nil
 	}
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	if info.Restore != nil {
+		return !info.Restore.OngoingRestore, nil
+	}
+	req := minio.RestoreRequest{}
+	req.SetDays(restoreDays)
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierStandard})
+	err = s.client.RestoreObject(ctx, s.bucket, key, "", req)
+	if err != nil && minio.ToErrorResponse(err).Code != "RestoreAlreadyInProgress" {
+		return false, err
+	}
+	return false, nil
+}
 
-	var users []User
-	// Skip header row (rows[0])
-	for _, row := range rows[1:] {
-		isActive, _ := strconv.ParseBool(row[2])
-		user := User{
-			ID:        uuid.New(),
-			Email:     row[0],
-			Role:      UserRole(row[1]),
-			IsActive:  isActive,
-			CreatedAt: time.Now().UTC(),
+// copyBlob streams one blob from src to dst under the same key.
+func copyBlob(ctx context.Context, src, dst BlobStore, key string) error {
+	r, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(ctx, key, r)
+}
+
+// --- Storage Lifecycle ---
+
+// LifecycleConfig sets how long each kind of blob stays hot. Originals are
+// rarely read after upload, so they move to the archive much sooner.
+type LifecycleConfig struct {
+	Interval          time.Duration
+	OriginalColdAfter time.Duration
+	ResizedColdAfter  time.Duration
+}
+
+func loadLifecycleConfig() LifecycleConfig {
+	cfg := LifecycleConfig{
+		Interval:          time.Hour,
+		OriginalColdAfter: 30 * 24 * time.Hour,
+		ResizedColdAfter:  180 * 24 * time.Hour,
+	}
+	if d, err := time.ParseDuration(os.Getenv("LIFECYCLE_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if days, err := strconv.Atoi(os.Getenv("ORIGINAL_COLD_AFTER_DAYS")); err == nil && days > 0 {
+		cfg.OriginalColdAfter = time.Duration(days) * 24 * time.Hour
+	}
+	if days, err := strconv.Atoi(os.Getenv("RESIZED_COLD_AFTER_DAYS")); err == nil && days > 0 {
+		cfg.ResizedColdAfter = time.Duration(days) * 24 * time.Hour
+	}
+	return cfg
+}
+
+func runLifecycleScheduler(ctx context.Context, cfg LifecycleConfig) {
+	log.Printf("Storage lifecycle: scanning every %s (originals cold after %s, resized after %s)",
+		cfg.Interval, cfg.OriginalColdAfter, cfg.ResizedColdAfter)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		runLifecycleScan(ctx, cfg, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type blobKind string
+
+const (
+	blobOriginal blobKind = "original"
+	blobResized  blobKind = "resized"
+)
+
+func blobOf(att *Attachment, kind blobKind) *BlobLocation {
+	if kind == blobResized {
+		return &att.Resized
+	}
+	return &att.Original
+}
+
+// runLifecycleScan archives every hot blob past its threshold. Age counts
+// from upload, or from the last restore so a re-hydrated blob is not sent
+// straight back to the archive.
+func runLifecycleScan(ctx context.Context, cfg LifecycleConfig, now time.Time) {
+	type candidate struct {
+		id   uuid.UUID
+		kind blobKind
+	}
+	var due []candidate
+	attachmentsMu.RLock()
+	for id, att := range attachments {
+		if att.Scan.Status != ScanClean {
+			continue
+		}
+		for kind, after := range map[blobKind]time.Duration{blobOriginal: cfg.OriginalColdAfter, blobResized: cfg.ResizedColdAfter} {
+			loc := blobOf(&att, kind)
+			since := att.CreatedAt
+			if loc.MovedAt != nil {
+				since = *loc.MovedAt
+			}
+			if loc.Tier == TierHot && now.Sub(since) >= after {
+				due = append(due, candidate{id: id, kind: kind})
+			}
+		}
+	}
+	attachmentsMu.RUnlock()
+
+	moved := 0
+	for _, c := range due {
+		if err := archiveBlob(ctx, c.id, c.kind); err != nil {
+			log.Printf("Storage lifecycle: failed to archive %s of attachment %s: %v", c.kind, c.id, err)
+			continue
+		}
+		moved++
+	}
+	if len(due) > 0 {
+		log.Printf("Storage lifecycle: archived %d of %d due blobs", moved, len(due))
+	}
+}
+
+// archiveBlob copies a blob to cold storage, switches the record over, and
+// only then deletes the hot copy, so the record never points at a missing blob.
+func archiveBlob(ctx context.Context, id uuid.UUID, kind blobKind) error {
+	attachmentsMu.RLock()
+	att, ok := attachments[id]
+	attachmentsMu.RUnlock()
+	if !ok || blobOf(&att, kind).Tier != TierHot {
+		return nil
+	}
+	key := blobOf(&att, kind).Key
+
+	if err := copyBlob(ctx, hotStore, coldStore, key); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	attachmentsMu.Lock()
+	att, ok = attachments[id]
+	if !ok || blobOf(&att, kind).Tier != TierHot {
+		attachmentsMu.Unlock()
+		// Deleted or changed while copying; drop the now orphaned archive copy.
+		return coldStore.Delete(ctx, key)
+	}
+	*blobOf(&att, kind) = BlobLocation{Tier: TierCold, Key: key, RestoreLatency: coldStore.RestoreLatency(), MovedAt: &now}
+	attachments[id] = att
+	attachmentsMu.Unlock()
+
+	return hotStore.Delete(ctx, key)
+}
+
+type RestoreJob struct {
+	ID           string     `json:"id"`
+	AttachmentID uuid.UUID  `json:"attachment_id"`
+	Blob         blobKind   `json:"blob"`
+	Status       string     `json:"status"` // queued, thawing, running, completed, failed
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+var (
+	restoreJobsMu sync.RWMutex
+	restoreJobs   = make(map[string]*RestoreJob)
+)
+
+// A thawed copy only has to outlive the copy back into hot storage; the
+// archive drops it after restoreDays. Archive restores take hours, so the
+// status is polled sparingly and given up on after restoreTimeout.
+const (
+	restoreDays         = 1
+	restorePollInterval = 5 * time.Minute
+	restoreTimeout      = 48 * time.Hour
+)
+
+func setRestoreJob(job *RestoreJob, status string, err error) {
+	restoreJobsMu.Lock()
+	defer restoreJobsMu.Unlock()
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == "completed" || status == "failed" {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+	}
+}
+
+// handleAttachmentRestore marks a cold blob as restoring and re-hydrates it
+// into hot storage in the background, thawing it in the archive first when
+// its storage class requires that. Poll GET /jobs/:id for the outcome.
+func handleAttachmentRestore(c *gin.Context) {
+	if coldStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Archive storage is not configured"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+	kind := blobKind(c.DefaultQuery("blob", string(blobOriginal)))
+	if kind != blobOriginal && kind != blobResized {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "blob must be 'original' or 'resized'"})
+		return
+	}
+
+	attachmentsMu.Lock()
+	att, ok := attachments[id]
+	if !ok {
+		attachmentsMu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	loc := blobOf(&att, kind)
+	if loc.Tier != TierCold {
+		attachmentsMu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Blob is %s, not cold", loc.Tier)})
+		return
+	}
+	loc.Tier = TierRestoring
+	attachments[id] = att
+	attachmentsMu.Unlock()
+
+	job := &RestoreJob{ID: uuid.NewString(), AttachmentID: id, Blob: kind, Status: "queued", CreatedAt: time.Now().UTC()}
+	restoreJobsMu.Lock()
+	restoreJobs[job.ID] = job
+	restoreJobsMu.Unlock()
+
+	go runRestoreJob(job, loc.Key)
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "status": job.Status, "restore_latency": loc.RestoreLatency})
+}
+
+// waitForThaw blocks until the archive copy of key can be read, issuing the
+// archive restore first when the cold store needs one.
+func waitForThaw(ctx context.Context, job *RestoreJob, key string) error {
+	thawer, ok := coldStore.(Thawer)
+	if !ok {
+		return nil
+	}
+	deadline := time.Now().Add(restoreTimeout)
+	for {
+		ready, err := thawer.Thaw(ctx, key)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("archive restore of %s did not finish within %s", key, restoreTimeout)
+		}
+		setRestoreJob(job, "thawing", nil)
+		time.Sleep(restorePollInterval)
+	}
+}
+
+func runRestoreJob(job *RestoreJob, key string) {
+	ctx := context.Background()
+
+	err := waitForThaw(ctx, job, key)
+	if err == nil {
+		setRestoreJob(job, "running", nil)
+		err = copyBlob(ctx, coldStore, hotStore, key)
+	}
+	if err != nil {
+		// Put the record back to cold so the restore can be retried.
+		attachmentsMu.Lock()
+		if att, ok := attachments[job.AttachmentID]; ok {
+			blobOf(&att, job.Blob).Tier = TierCold
+			attachments[job.AttachmentID] = att
+		}
+		attachmentsMu.Unlock()
+		setRestoreJob(job, "failed", err)
+		log.Printf("Restore job %s failed: %v", job.ID, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	attachmentsMu.Lock()
+	if att, ok := attachments[job.AttachmentID]; ok {
+		loc := hotLocation(key)
+		loc.MovedAt = &now
+		*blobOf(&att, job.Blob) = loc
+		attachments[job.AttachmentID] = att
+	}
+	attachmentsMu.Unlock()
+
+	if err := coldStore.Delete(ctx, key); err != nil {
+		log.Printf("Restore job %s: could not remove archive copy %s: %v", job.ID, key, err)
+	}
+	setRestoreJob(job, "completed", nil)
+}
+
+func handleRestoreJobStatus(c *gin.Context) {
+	restoreJobsMu.RLock()
+	defer restoreJobsMu.RUnlock()
+	job, ok := restoreJobs[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// --- Rendition Caching ---
+// A rendition's URL and blob key both carry the SHA-256 of its bytes, so a
+// URL never changes meaning and a CDN may cache it forever. Regenerating the
+// rendition produces a new hash, and with it a new URL; clients holding the
+// old one are redirected to the current one.
+
+const (
+	defaultRenditionWidth = 1024
+	maxRenditionWidth     = 4096
+	immutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+// Rendition describes the current resized copy of an attachment.
+type Rendition struct {
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	GeneratedAt time.Time `json:"generated_at"`
+	URL         string    `json:"url"`
+}
+
+func (r Rendition) key(id uuid.UUID) string {
+	return fmt.Sprintf("%s-%s.jpg", id, r.SHA256[:16])
+}
+
+func (r Rendition) etag() string {
+	return `"` + r.SHA256 + `"`
+}
+
+// renderRendition resizes img to width, keeping the aspect ratio. The JPEG
+// encoder writes no EXIF, so the rendition carries no metadata.
+func renderRendition(id uuid.UUID, img image.Image, width uint) ([]byte, Rendition, error) {
+	resized := resize.Resize(width, 0, img, resize.Lanczos3)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, nil); err != nil {
+		return nil, Rendition{}, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	r := Rendition{
+		SHA256:      hex.EncodeToString(sum[:]),
+		Size:        int64(buf.Len()),
+		Width:       resized.Bounds().Dx(),
+		Height:      resized.Bounds().Dy(),
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	r.URL = fmt.Sprintf("/api/v1/attachments/%s/renditions/%s.jpg", id, r.SHA256)
+	return buf.Bytes(), r, nil
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// only when the client sent no entity tags (RFC 9110 section 13.2.2).
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.After(since)
+}
+
+func lookupAttachment(c *gin.Context) (Attachment, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return Attachment{}, false
+	}
+	attachmentsMu.RLock()
+	att, ok := attachments[id]
+	attachmentsMu.RUnlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return Attachment{}, false
+	}
+	return att, true
+}
+
+// renditionUnavailable answers for a rendition that cannot be served right
+// now. The response must not be cached, or a CDN would keep serving the error
+// after the scan or restore completes.
+func renditionUnavailable(c *gin.Context, att Attachment) bool {
+	status, body := http.StatusConflict, gin.H{}
+	switch {
+	case att.Scan.Status != ScanClean:
+		body["error"], body["scan_status"] = "Attachment is not available", att.Scan.Status
+	case att.Rendition.SHA256 == "":
+		status, body["error"] = http.StatusNotFound, "Attachment has no rendition"
+	case att.Resized.Tier != TierHot:
+		body["error"] = fmt.Sprintf("Rendition is %s; restore it with ?blob=resized", att.Resized.Tier)
+	default:
+		return false
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, body)
+	return true
+}
+
+// handleRenditionRedirect gives clients a stable address that always leads
+// to the current rendition. The redirect itself is revalidated every time.
+func handleRenditionRedirect(c *gin.Context) {
+	att, ok := lookupAttachment(c)
+	if !ok || renditionUnavailable(c, att) {
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Redirect(http.StatusFound, att.Rendition.URL)
+}
+
+// handleRenditionServe serves rendition bytes with a strong ETag and
+// Last-Modified, answering conditional requests with 304. A hash that is no
+// longer current redirects to the rendition that replaced it.
+func handleRenditionServe(c *gin.Context) {
+	att, ok := lookupAttachment(c)
+	if !ok || renditionUnavailable(c, att) {
+		return
+	}
+	r := att.Rendition
+	if strings.TrimSuffix(c.Param("file"), ".jpg") != r.SHA256 {
+		c.Header("Cache-Control", "no-cache")
+		c.Redirect(http.StatusFound, r.URL)
+		return
+	}
+
+	c.Header("ETag", r.etag())
+	c.Header("Last-Modified", r.GeneratedAt.Format(http.TimeFormat))
+	c.Header("Cache-Control", immutableCacheControl)
+	if notModified(c.Request, r.etag(), r.GeneratedAt) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", "image/jpeg")
+		c.Header("Content-Length", strconv.FormatInt(r.Size, 10))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	blob, err := hotStore.Get(c.Request.Context(), att.Resized.Key)
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read rendition"})
+		return
+	}
+	defer blob.Close()
+	c.DataFromReader(http.StatusOK, r.Size, "image/jpeg", blob, nil)
+}
+
+// handleRenditionRegenerate re-renders the rendition from the stored original,
+// e.g. at a different width. The new rendition gets a new URL, so cached
+// copies of the old one are bypassed rather than purged.
+func handleRenditionRegenerate(c *gin.Context) {
+	att, ok := lookupAttachment(c)
+	if !ok {
+		return
+	}
+	width, err := strconv.Atoi(c.DefaultQuery("width", strconv.Itoa(defaultRenditionWidth)))
+	if err != nil || width < 1 || width > maxRenditionWidth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("width must be between 1 and %d", maxRenditionWidth)})
+		return
+	}
+	if att.Scan.Status != ScanClean {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment is not available", "scan_status": att.Scan.Status})
+		return
+	}
+	if att.Original.Tier != TierHot || (att.Resized.Tier != TierHot && att.Resized.Tier != "") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Original and rendition must both be in hot storage; restore them first"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	src, err := hotStore.Get(ctx, att.Original.Key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read original image"})
+		return
+	}
+	img, _, err := image.Decode(src)
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode original image"})
+		return
+	}
+	if att.AutoRotated {
+		img = applyOrientation(img, att.Metadata.Orientation)
+	}
+	data, rendition, err := renderRendition(att.ID, img, uint(width))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode rendition"})
+		return
+	}
+	if rendition.SHA256 == att.Rendition.SHA256 {
+		c.JSON(http.StatusOK, gin.H{"attachment": att, "changed": false})
+		return
+	}
+	key := rendition.key(att.ID)
+	if err := hotStore.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store rendition"})
+		return
+	}
+
+	attachmentsMu.Lock()
+	current, ok := attachments[att.ID]
+	if !ok || current.Rendition.SHA256 != att.Rendition.SHA256 || current.Resized.Tier != att.Resized.Tier {
+		attachmentsMu.Unlock()
+		// Deleted, quarantined or regenerated while rendering; keep what is there.
+		hotStore.Delete(ctx, key)
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment changed while regenerating; try again"})
+		return
+	}
+	oldKey := current.Resized.Key
+	current.Resized, current.Rendition = hotLocation(key), rendition
+	attachments[att.ID] = current
+	attachmentsMu.Unlock()
+
+	if oldKey != "" {
+		if err := hotStore.Delete(ctx, oldKey); err != nil {
+			log.Printf("Rendition of attachment %s: could not delete replaced blob %s: %v", att.ID, oldKey, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"attachment": current, "changed": true})
+}
+
+// --- Malware Scanning ---
+
+type ScanStatus string
+
+const (
+	ScanPending  ScanStatus = "pending"
+	ScanClean    ScanStatus = "clean"
+	ScanInfected ScanStatus = "infected"
+	ScanFailed   ScanStatus = "failed" // gave up after maxScanAttempts; the file stays unavailable
+)
+
+const (
+	maxScanAttempts = 5
+	scanRetryDelay  = 30 * time.Second
+)
+
+// ScanResult is the scan state of an attachment's original blob. The resized
+// copy is re-encoded from decoded pixels, so it cannot carry a payload of
+// its own.
+type ScanResult struct {
+	Status    ScanStatus `json:"status"`
+	Scanner   string     `json:"scanner,omitempty"`
+	Signature string     `json:"signature,omitempty"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"`
+	ScannedAt *time.Time `json:"scanned_at,omitempty"`
+
+	nextAttempt time.Time
+}
+
+type ScanVerdict struct {
+	Infected  bool
+	Signature string
+}
+
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader) (ScanVerdict, error)
+}
+
+// NoopScanner passes everything. Results record it as the scanner, so files
+// that were never really scanned can be found later.
+type NoopScanner struct{}
+
+func (NoopScanner) Name() string { return "noop" }
+
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (ScanVerdict, error) {
+	return ScanVerdict{}, nil
+}
+
+// ClamdScanner streams data to clamd over TCP using the INSTREAM command.
+type ClamdScanner struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+func (s *ClamdScanner) Name() string { return "clamd" }
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (ScanVerdict, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return ScanVerdict{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanVerdict{}, fmt.Errorf("clamd: %w", err)
+	}
+	// Each chunk is prefixed with its length; a zero length ends the stream.
+	buf := make([]byte, 32<<10)
+	var size [4]byte
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := conn.Write(size[:]); err != nil {
+				return ScanVerdict{}, fmt.Errorf("clamd: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return ScanVerdict{}, fmt.Errorf("clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return ScanVerdict{}, readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := conn.Write(size[:]); err != nil {
+		return ScanVerdict{}, fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return ScanVerdict{}, fmt.Errorf("clamd: %w", err)
+	}
+	// Replies look like "stream: OK", "stream: Eicar-Signature FOUND" or
+	// "INSTREAM size limit exceeded. ERROR".
+	reply = strings.TrimRight(reply, "\x00\n")
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		return ScanVerdict{Infected: true, Signature: strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")}, nil
+	case strings.HasSuffix(reply, " OK"):
+		return ScanVerdict{}, nil
+	}
+	return ScanVerdict{}, fmt.Errorf("clamd: %s", reply)
+}
+
+// Notifier tells a user about something that happened to their content.
+type Notifier interface {
+	Notify(ctx context.Context, userID uuid.UUID, subject, body string) error
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, userID uuid.UUID, subject, body string) error {
+	log.Printf("Notify user %s: %s - %s", userID, subject, body)
+	return nil
+}
+
+type AuditEvent struct {
+	ID           uuid.UUID `json:"id"`
+	Action       string    `json:"action"`
+	AttachmentID uuid.UUID `json:"attachment_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	Detail       string    `json:"detail,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+var (
+	scanner  Scanner
+	notifier Notifier = logNotifier{}
+
+	scanQueue  = make(chan uuid.UUID, 256)
+	scanMu     sync.Mutex
+	scanQueued = make(map[uuid.UUID]bool)
+
+	auditMu  sync.RWMutex
+	auditLog []AuditEvent
+)
+
+func recordAudit(action string, att Attachment, detail string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditLog = append(auditLog, AuditEvent{
+		ID: uuid.New(), Action: action, AttachmentID: att.ID, UserID: att.UploadedBy, Detail: detail, At: time.Now().UTC(),
+	})
+	log.Printf("AUDIT %s attachment=%s user=%s %s", action, att.ID, att.UploadedBy, detail)
+}
+
+func handleAuditLog(c *gin.Context) {
+	auditMu.RLock()
+	defer auditMu.RUnlock()
+	c.JSON(http.StatusOK, gin.H{"data": auditLog, "total": len(auditLog)})
+}
+
+// enqueueScan never blocks an upload; anything that does not fit in the
+// queue is picked up by the sweep in runScanWorkers.
+func enqueueScan(id uuid.UUID) {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	if scanQueued[id] {
+		return
+	}
+	select {
+	case scanQueue <- id:
+		scanQueued[id] = true
+	default:
+		log.Printf("Scan queue full; attachment %s left for the sweep", id)
+	}
+}
+
+func runScanWorkers(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-scanQueue:
+					scanAttachment(ctx, id)
+					scanMu.Lock()
+					delete(scanQueued, id)
+					scanMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	// The sweep retries failed attempts once their delay has passed.
+	ticker := time.NewTicker(scanRetryDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var due []uuid.UUID
+			attachmentsMu.RLock()
+			for id, att := range attachments {
+				if att.Scan.Status == ScanPending && !now.Before(att.Scan.nextAttempt) {
+					due = append(due, id)
+				}
+			}
+			attachmentsMu.RUnlock()
+			for _, id := range due {
+				enqueueScan(id)
+			}
+		}
+	}
+}
+
+func scanAttachment(ctx context.Context, id uuid.UUID) {
+	attachmentsMu.RLock()
+	att, ok := attachments[id]
+	attachmentsMu.RUnlock()
+	if !ok || att.Scan.Status != ScanPending {
+		return
+	}
+
+	verdict, err := scanBlob(ctx, att.Original.Key)
+	if err == nil && verdict.Infected {
+		err = quarantineAttachment(ctx, id, verdict)
+		if err == nil {
+			return
+		}
+	}
+	now := time.Now().UTC()
+
+	attachmentsMu.Lock()
+	att, ok = attachments[id]
+	if !ok || att.Scan.Status != ScanPending {
+		attachmentsMu.Unlock()
+		return
+	}
+	att.Scan.Scanner = scanner.Name()
+	att.Scan.Attempts++
+	if err == nil {
+		att.Scan.Status, att.Scan.Error, att.Scan.ScannedAt = ScanClean, "", &now
+	} else {
+		att.Scan.Error = err.Error()
+		att.Scan.nextAttempt = now.Add(scanRetryDelay * time.Duration(att.Scan.Attempts))
+		if att.Scan.Attempts >= maxScanAttempts {
+			att.Scan.Status = ScanFailed
+		}
+	}
+	attachments[id] = att
+	attachmentsMu.Unlock()
+
+	switch {
+	case att.Scan.Status == ScanFailed:
+		recordAudit("attachment.scan_failed", att, err.Error())
+	case err != nil:
+		log.Printf("Scan of attachment %s failed (attempt %d/%d): %v", id, att.Scan.Attempts, maxScanAttempts, err)
+	}
+}
+
+func scanBlob(ctx context.Context, key string) (ScanVerdict, error) {
+	r, err := hotStore.Get(ctx, key)
+	if err != nil {
+		return ScanVerdict{}, err
+	}
+	defer r.Close()
+	return scanner.Scan(ctx, r)
+}
+
+// quarantineAttachment moves the original out of hot storage, drops the
+// resized copy, and tells the uploader. The record stays so the quarantined
+// file can be inspected and the upload accounted for.
+func quarantineAttachment(ctx context.Context, id uuid.UUID, verdict ScanVerdict) error {
+	attachmentsMu.RLock()
+	att, ok := attachments[id]
+	attachmentsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := copyBlob(ctx, hotStore, quarantineStore, att.Original.Key); err != nil {
+		return fmt.Errorf("quarantine: %w", err)
+	}
+
+	now := time.Now().UTC()
+	attachmentsMu.Lock()
+	att = attachments[id]
+	resized := att.Resized
+	att.Original = BlobLocation{Tier: TierQuarantined, Key: att.Original.Key, MovedAt: &now}
+	att.Resized = BlobLocation{}
+	att.Rendition = Rendition{}
+	att.Scan.Scanner = scanner.Name()
+	att.Scan.Attempts++
+	att.Scan.Status, att.Scan.Signature, att.Scan.Error, att.Scan.ScannedAt = ScanInfected, verdict.Signature, "", &now
+	attachments[id] = att
+	attachmentsMu.Unlock()
+
+	for _, key := range []string{att.Original.Key, resized.Key} {
+		if err := hotStore.Delete(ctx, key); err != nil {
+			log.Printf("Quarantine of attachment %s: could not delete hot blob %s: %v", id, key, err)
+		}
+	}
+	recordAudit("attachment.quarantined", att, "signature="+verdict.Signature)
+
+	if att.UploadedBy == uuid.Nil {
+		log.Printf("Quarantined attachment %s has no known uploader to notify", id)
+		return nil
+	}
+	body := fmt.Sprintf("The file %q you uploaded to post %s was flagged as malicious (%s) and has been removed.",
+		att.FileName, att.PostID, verdict.Signature)
+	if err := notifier.Notify(ctx, att.UploadedBy, "Your upload was blocked", body); err != nil {
+		log.Printf("Could not notify user %s about quarantined attachment %s: %v", att.UploadedBy, id, err)
+	}
+	return nil
+}
+
+// --- Batch Processing ---
+// Processor runs a function over a slice of items with a fixed number of
+// workers. It is shared by anything that works through user-supplied batches,
+// starting with the user import.
+
+// RetryPolicy decides how often a failed item is tried again. Items are tried
+// once when MaxAttempts is below 2; a nil Retryable retries every error.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration // doubled after every attempt
+	Retryable   func(error) bool
+}
+
+type Progress struct {
+	Total     int
+	Succeeded int
+	Failed    int
+}
+
+func (p Progress) Completed() int { return p.Succeeded + p.Failed }
+
+type ItemError struct {
+	Index    int
+	Attempts int
+	Err      error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v (after %d attempts)", e.Index, e.Err, e.Attempts)
+}
+
+func (e ItemError) Unwrap() error { return e.Err }
+
+// BatchError collects every item that failed, ordered by index. Items that
+// were never started because the context ended carry the context's error.
+type BatchError struct {
+	Errors []ItemError
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d items failed, first: %v", len(e.Errors), e.Errors[0])
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, itemErr := range e.Errors {
+		errs[i] = itemErr
+	}
+	return errs
+}
+
+type Processor[T any] struct {
+	Workers    int
+	Retry      RetryPolicy
+	OnProgress func(Progress) // called after each item, never concurrently
+}
+
+// Run calls fn for each item and waits for all of them. It returns nil when
+// every item succeeded and a *BatchError otherwise.
+func (p *Processor[T]) Run(ctx context.Context, items []T, fn func(context.Context, T) error) error {
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		progress = Progress{Total: len(items)}
+		failures []ItemError
+	)
+	record := func(itemErr *ItemError) {
+		mu.Lock()
+		defer mu.Unlock()
+		if itemErr != nil {
+			failures = append(failures, *itemErr)
+			progress.Failed++
+		} else {
+			progress.Succeeded++
+		}
+		if p.OnProgress != nil {
+			p.OnProgress(progress)
+		}
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				record(p.process(ctx, i, items[i], fn))
+			}
+		}()
+	}
+
+	next := 0
+dispatch:
+	for ; next < len(items); next++ {
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	for ; next < len(items); next++ {
+		record(&ItemError{Index: next, Err: ctx.Err()})
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Index < failures[j].Index })
+	return &BatchError{Errors: failures}
+}
+
+func (p *Processor[T]) process(ctx context.Context, index int, item T, fn func(context.Context, T) error) *ItemError {
+	backoff := p.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx, item)
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.Retry.MaxAttempts || (p.Retry.Retryable != nil && !p.Retry.Retryable(err)) {
+			return &ItemError{Index: index, Attempts: attempt, Err: err}
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return &ItemError{Index: index, Attempts: attempt, Err: ctx.Err()}
+		}
+		backoff *= 2
+	}
+}
+
+// --- User Store ---
+
+var (
+	usersMu sync.RWMutex
+	users   = make(map[string]User) // keyed by lower-cased email
+
+	errInvalidUser = errors.New("invalid user")
+	importWorkers  = 4
+)
+
+func init() {
+	if n, err := strconv.Atoi(os.Getenv("IMPORT_WORKERS")); err == nil && n > 0 {
+		importWorkers = n
+	}
+}
+
+// saveImportedUser validates and stores one imported user. Validation
+// failures wrap errInvalidUser so the import does not retry them.
+func saveImportedUser(ctx context.Context, u User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := strings.ToLower(strings.TrimSpace(u.Email))
+	if !strings.Contains(key, "@") {
+		return fmt.Errorf("%w: malformed email %q", errInvalidUser, u.Email)
+	}
+	if u.Role != AdminRole && u.Role != UserRole {
+		return fmt.Errorf("%w: unknown role %q", errInvalidUser, u.Role)
+	}
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	if _, exists := users[key]; exists {
+		return fmt.Errorf("%w: %s already exists", errInvalidUser, u.Email)
+	}
+	u.Email = key
+	users[key] = u
+	return nil
+}
+
+// --- Authentication ---
+// Requests may carry HTTP Basic credentials (email and password). Requests
+// without them are anonymous; wrong ones are rejected. Imported users can
+// sign in only if their row had a password.
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+const currentUserKey = "currentUser"
+
+func hashPassword(password string) string {
+	return "hashed_" + password
+}
+
+func authenticate(email, password string) (User, error) {
+	usersMu.RLock()
+	u, ok := users[strings.ToLower(strings.TrimSpace(email))]
+	usersMu.RUnlock()
+	if !ok || !u.IsActive || u.PasswordHash == "" ||
+		subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte(hashPassword(password))) != 1 {
+		return User{}, errInvalidCredentials
+	}
+	return u, nil
+}
+
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if email, password, ok := c.Request.BasicAuth(); ok {
+			user, err := authenticate(email, password)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Basic realm="api"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set(currentUserKey, user)
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the authenticated user; ok is false for anonymous
+// requests.
+func currentUser(c *gin.Context) (User, bool) {
+	v, ok := c.Get(currentUserKey)
+	user, _ := v.(User)
+	return user, ok
+}
+
+// requireRole lets only authenticated users with one of roles through.
+// Anonymous requests are challenged for credentials.
+func requireRole(roles ...Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
+
+// seedAdmin creates an ADMIN user from ADMIN_EMAIL and ADMIN_PASSWORD.
+// Without both there is no admin until one is imported.
+func seedAdmin() {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; no admin user seeded")
+		return
+	}
+	admin := User{ID: uuid.New(), Email: email, PasswordHash: hashPassword(password), Role: AdminRole, IsActive: true, CreatedAt: time.Now().UTC()}
+	if err := saveImportedUser(context.Background(), admin); err != nil {
+		log.Fatalf("Failed to seed admin user: %v", err)
+	}
+}
+
+// --- User Avatars ---
+// An upload is validated, stored as-is and handed to a background worker,
+// which crops it to a square and stores one JPEG per size in avatarSizes. The
+// upload itself is deleted once the renditions exist. Until then, and for
+// users without an avatar, an identicon derived from the user ID is served.
+
+var avatarSizes = []int{64, 128, 256}
+
+const (
+	defaultAvatarSize = 128
+	maxAvatarBytes    = 4 << 20
+	minAvatarSide     = 64
+	maxAvatarSide     = 4096
+)
+
+type AvatarStatus string
+
+const (
+	AvatarNone       AvatarStatus = "none"
+	AvatarProcessing AvatarStatus = "processing"
+	AvatarReady      AvatarStatus = "ready"
+	AvatarFailed     AvatarStatus = "failed"
+)
+
+// AvatarState is kept on the user record. Version changes with every upload,
+// so a worker finishing an outdated upload can tell and discard its output.
+type AvatarState struct {
+	Status    AvatarStatus
+	Version   string
+	UploadKey string
+	Keys      map[int]string // size -> blob key
+	Error     string
+	UpdatedAt time.Time
+}
+
+type avatarJob struct {
+	UserID    uuid.UUID
+	UserEmail string
+	Version   string
+	UploadKey string
+}
+
+var avatarQueue = make(chan avatarJob, 64)
+
+// userView is the user as returned by the API, with avatar URLs filled in.
+type userView struct {
+	User
+	Avatar gin.H `json:"avatar"`
+}
+
+func avatarURL(u User, size int) string {
+	url := fmt.Sprintf("/api/v1/users/%s/avatar?size=%d", u.ID, size)
+	if u.Avatar.Status == AvatarReady {
+		url += "&v=" + u.Avatar.Version
+	}
+	return url
+}
+
+func viewUser(u User) userView {
+	status := u.Avatar.Status
+	if status == "" {
+		status = AvatarNone
+	}
+	urls := gin.H{}
+	for _, size := range avatarSizes {
+		urls[strconv.Itoa(size)] = avatarURL(u, size)
+	}
+	avatar := gin.H{"status": status, "identicon": status != AvatarReady, "urls": urls}
+	if u.Avatar.Error != "" {
+		avatar["error"] = u.Avatar.Error
+	}
+	return userView{User: u, Avatar: avatar}
+}
+
+// findUser looks a user up by ID; users are stored by email.
+func findUser(c *gin.Context) (User, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return User{}, false
+	}
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for _, u := range users {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	return User{}, false
+}
+
+func handleUserGet(c *gin.Context) {
+	if u, ok := findUser(c); ok {
+		c.JSON(http.StatusOK, viewUser(u))
+	}
+}
+
+// handleAvatarUpload checks the format and dimensions from the image header
+// before anything is decoded, so oversized images are rejected cheaply.
+func handleAvatarUpload(c *gin.Context) {
+	u, ok := findUser(c)
+	if !ok {
+		return
+	}
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar file not provided"})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open uploaded avatar"})
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxAvatarBytes+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded avatar"})
+		return
+	}
+	if len(data) > maxAvatarBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Avatar must be at most %d bytes", maxAvatarBytes)})
+		return
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Avatar must be a JPEG or PNG image"})
+		return
+	}
+	if cfg.Width < minAvatarSide || cfg.Height < minAvatarSide || cfg.Width > maxAvatarSide || cfg.Height > maxAvatarSide {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Avatar sides must be between %d and %d pixels", minAvatarSide, maxAvatarSide)})
+		return
+	}
+
+	version := uuid.NewString()[:8]
+	uploadKey := fmt.Sprintf("avatar-%s-upload-%s.%s", u.ID, version, format)
+	if err := hotStore.Put(c.Request.Context(), uploadKey, bytes.NewReader(data)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store avatar"})
+		return
+	}
+
+	usersMu.Lock()
+	current, ok := users[u.Email]
+	if !ok {
+		usersMu.Unlock()
+		hotStore.Delete(c.Request.Context(), uploadKey)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	previousUpload := current.Avatar.UploadKey
+	current.Avatar.Status, current.Avatar.Version, current.Avatar.UploadKey = AvatarProcessing, version, uploadKey
+	current.Avatar.Error, current.Avatar.UpdatedAt = "", time.Now().UTC()
+	users[u.Email] = current
+	usersMu.Unlock()
+	if previousUpload != "" {
+		// Superseded before it was processed.
+		hotStore.Delete(c.Request.Context(), previousUpload)
+	}
+
+	select {
+	case avatarQueue <- avatarJob{UserID: u.ID, UserEmail: u.Email, Version: version, UploadKey: uploadKey}:
+	default:
+		setAvatarFailed(u.Email, version, "avatar queue is full; upload again later")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Avatar processing is busy; try again later"})
+		return
+	}
+	c.JSON(http.StatusAccepted, viewUser(current))
+}
+
+func setAvatarFailed(email, version, reason string) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	u, ok := users[email]
+	if !ok || u.Avatar.Version != version {
+		return
+	}
+	u.Avatar.Status, u.Avatar.Error, u.Avatar.UploadKey, u.Avatar.UpdatedAt = AvatarFailed, reason, "", time.Now().UTC()
+	users[email] = u
+}
+
+func runAvatarWorkers(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-avatarQueue:
+					if err := processAvatar(ctx, job); err != nil {
+						log.Printf("Avatar %s for %s failed: %v", job.Version, job.UserEmail, err)
+						setAvatarFailed(job.UserEmail, job.Version, err.Error())
+					}
+					hotStore.Delete(ctx, job.UploadKey)
+				}
+			}
+		}()
+	}
+}
+
+// processAvatar renders every size of a queued upload and swaps them in,
+// unless a newer upload replaced this one in the meantime.
+func processAvatar(ctx context.Context, job avatarJob) error {
+	r, err := hotStore.Get(ctx, job.UploadKey)
+	if err != nil {
+		return fmt.Errorf("reading upload: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("reading upload: %w", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.New("image could not be decoded")
+	}
+	if meta, err := extractImageMetadata(data); err == nil {
+		img = applyOrientation(img, meta.Orientation)
+	}
+	square := cropSquare(img)
+
+	keys := make(map[int]string, len(avatarSizes))
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize.Resize(uint(size), uint(size), square, resize.Lanczos3), &jpeg.Options{Quality: 90}); err != nil {
+			return fmt.Errorf("encoding %dpx rendition: %w", size, err)
+		}
+		key := fmt.Sprintf("avatar-%s-%d-%s.jpg", job.UserID, size, job.Version)
+		if err := hotStore.Put(ctx, key, &buf); err != nil {
+			return fmt.Errorf("storing %dpx rendition: %w", size, err)
+		}
+		keys[size] = key
+	}
+
+	usersMu.Lock()
+	u, ok := users[job.UserEmail]
+	if !ok || u.Avatar.Version != job.Version {
+		usersMu.Unlock()
+		for _, key := range keys {
+			hotStore.Delete(ctx, key)
+		}
+		return nil
+	}
+	old := u.Avatar.Keys
+	u.Avatar = AvatarState{Status: AvatarReady, Version: job.Version, Keys: keys, UpdatedAt: time.Now().UTC()}
+	users[job.UserEmail] = u
+	usersMu.Unlock()
+
+	for _, key := range old {
+		hotStore.Delete(ctx, key)
+	}
+	log.Printf("Avatar %s ready for %s", job.Version, job.UserEmail)
+	return nil
+}
+
+// cropSquare keeps the centered square of img.
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0, y0 := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// identicon draws a 5x5 grid, mirrored left to right, whose cells and color
+// come from a hash of the user ID.
+func identicon(id uuid.UUID, size int) image.Image {
+	sum := sha256.Sum256(id[:])
+	fg := color.RGBA{R: sum[0], G: sum[1], B: sum[2], A: 255}
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	cell := size / 6 // five cells plus half a cell of margin on each side
+	margin := (size - 5*cell) / 2
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			if sum[3+row*3+col]%2 == 0 {
+				continue
+			}
+			for _, c := range []int{col, 4 - col} {
+				r := image.Rect(margin+c*cell, margin+row*cell, margin+(c+1)*cell, margin+(row+1)*cell)
+				draw.Draw(img, r, &image.Uniform{C: fg}, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
+
+// handleAvatarGet serves the requested size. A versioned URL (?v=) of the
+// current avatar is immutable; anything else may change with the next upload.
+func handleAvatarGet(c *gin.Context) {
+	u, ok := findUser(c)
+	if !ok {
+		return
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(defaultAvatarSize)))
+	valid := err == nil
+	if valid {
+		valid = false
+		for _, s := range avatarSizes {
+			valid = valid || s == size
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size must be one of %v", avatarSizes)})
+		return
+	}
+
+	if u.Avatar.Status != AvatarReady {
+		etag := fmt.Sprintf(`"identicon-%s-%d"`, u.ID, size)
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "public, max-age=300")
+		if notModified(c.Request, etag, time.Time{}) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, identicon(u.ID, size)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render identicon"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", buf.Bytes())
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, u.Avatar.Version, size)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", u.Avatar.UpdatedAt.Format(http.TimeFormat))
+	if c.Query("v") == u.Avatar.Version {
+		c.Header("Cache-Control", immutableCacheControl)
+	} else {
+		c.Header("Cache-Control", "public, max-age=300")
+	}
+	if notModified(c.Request, etag, u.Avatar.UpdatedAt.Truncate(time.Second)) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	blob, err := hotStore.Get(c.Request.Context(), u.Avatar.Keys[size])
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+	defer blob.Close()
+	c.DataFromReader(http.StatusOK, -1, "image/jpeg", blob, nil)
+}
+
+// --- Helper Functions ---
+
+func parseUsersFromCSV(filePath string) ([]User, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 2 {
+		return nil, fmt.Errorf("CSV must have a header and at least one data row")
+	}
+
+	var users []User
+	// Skip header row (records[0])
+	for _, record := range records[1:] {
+		isActive, _ := strconv.ParseBool(record[2])
+		user := User{
+			ID:        uuid.New(),
+			Email:     record[0],
+			Role:      Role(record[1]),
+			IsActive:  isActive,
+			CreatedAt: time.Now().UTC(),
+		}
+		if len(record) > 3 && record[3] != "" {
+			user.PasswordHash = hashPassword(record[3])
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func parseUsersFromXLSX(filePath string) ([]User, error) {
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Get all the rows in the first sheet.
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("XLSX must have a header and at least one data row")
+	}
+
+	var users []User
+	// Skip header row (rows[0])
+	for _, row := range rows[1:] {
+		isActive, _ := strconv.ParseBool(row[2])
+		user := User{
+			ID:        uuid.New(),
+			Email:     row[0],
+			Role:      Role(row[1]),
+			IsActive:  isActive,
+			CreatedAt: time.Now().UTC(),
+		}
+		if len(row) > 3 && row[3] != "" {
+			user.PasswordHash = hashPassword(row[3])
 		}
 		users = append(users, user)
 	}
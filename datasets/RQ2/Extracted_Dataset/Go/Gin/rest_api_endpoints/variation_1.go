@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -54,6 +60,97 @@ var (
 	userMutex = &sync.RWMutex{}
 )
 
+// --- Response Compression ---
+
+// compressResponses holds back each response body so it can be gzip- or
+// deflate-encoded once its content type and final size are known.
+func compressResponses(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		buffered := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = buffered.ResponseWriter
+		body := encodeBody(c.Writer.Header(), c.GetHeader("Accept-Encoding"), buffered.buf.Bytes(), minBytes)
+		if len(body) > 0 {
+			c.Writer.Write(body)
+		}
+	}
+}
+
+// bufferedWriter collects the body; the status still goes to the wrapped
+// writer, which gin only flushes on the first real Write.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error)       { return w.buf.Write(p) }
+func (w *bufferedWriter) WriteString(s string) (int, error) { return w.buf.WriteString(s) }
+
+func encodeBody(h http.Header, acceptEncoding string, body []byte, minBytes int) []byte {
+	if len(body) == 0 || h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return body
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if enc := negotiateEncoding(acceptEncoding); enc != "" && len(body) >= minBytes {
+		if z, err := compressBody(enc, body); err == nil {
+			h.Set("Content-Encoding", enc)
+			body = z
+		}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	return body
+}
+
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasPrefix(ct, "text/") || ct == "application/json" ||
+		ct == "application/xml" || ct == "application/javascript" || strings.HasSuffix(ct, "+json")
+}
+
+// negotiateEncoding returns "gzip", "deflate" or "" for identity.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressBody writes "deflate" as zlib-wrapped, which is what clients expect.
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // --- Main Application ---
 
 func main() {
@@ -61,6 +158,18 @@ func main() {
 	seedData()
 
 	router := gin.Default()
+	minBytes := 1024
+	if v := os.Getenv("COMPRESS_MIN_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("COMPRESS_MIN_BYTES must be a non-negative integer, got %q", v)
+		}
+		minBytes = n
+	}
+	router.Use(compressResponses(minBytes))
+	if url := os.Getenv("USERS_EXPORT_URL"); url != "" {
+		exportURL = url
+	}
 
 	// Group user routes
 	userRoutes := router.Group("/users")
@@ -145,6 +254,7 @@ func createUser(c *gin.Context) {
 	}
 
 	users = append(users, user)
+	userCounts.invalidate()
 	c.JSON(http.StatusCreated, user)
 }
 
@@ -181,18 +291,28 @@ func listUsers(c *gin.Context) {
 
 	// Pagination
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	if page < 1 {
 		page = 1
 	}
-	if pageSize < 1 {
-		pageSize = 10
+	pageSize, bounded, err := parsePageSize(c.Query("pageSize"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start := (page - 1) * pageSize
+	if !bounded || start > maxListOffset {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":       "Listing all users is not supported over HTTP; request an export instead",
+			"export_url":  exportURL,
+			"maxPageSize": maxPageSize,
+		})
+		return
 	}
 
-	start := (page - 1) * pageSize
+	total := userCounts.get(roleFilter+"|"+activeFilter+"|"+strings.ToLower(searchQuery), func() int { return len(filteredUsers) })
 	end := start + pageSize
 	if start > len(filteredUsers) {
-		c.JSON(http.StatusOK, gin.H{"total": len(filteredUsers), "page": page, "pageSize": pageSize, "data": []User{}})
+		c.JSON(http.StatusOK, gin.H{"total": total, "page": page, "pageSize": pageSize, "data": []User{}})
 		return
 	}
 	if end > len(filteredUsers) {
@@ -202,13 +322,78 @@ func listUsers(c *gin.Context) {
 	paginatedUsers := filteredUsers[start:end]
 
 	c.JSON(http.StatusOK, gin.H{
-		"total":    len(filteredUsers),
+		"total":    total,
 		"page":     page,
 		"pageSize": pageSize,
 		"data":     paginatedUsers,
 	})
 }
 
+// --- Pagination Guards ---
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+	// maxListOffset caps how deep clients may page; walking further is an
+	// export and belongs on the async export API.
+	maxListOffset = 10000
+)
+
+var exportURL = "/exports/users"
+
+// parsePageSize caps pageSize at maxPageSize. bounded is false for requests
+// for everything: pageSize=all, 0 or negative.
+func parsePageSize(raw string) (size int, bounded bool, err error) {
+	if raw == "" {
+		return defaultPageSize, true, nil
+	}
+	if strings.EqualFold(raw, "all") {
+		return 0, false, nil
+	}
+	if size, err = strconv.Atoi(raw); err != nil {
+		return 0, false, errors.New("pageSize must be an integer")
+	}
+	if size < 1 {
+		return 0, false, nil
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return size, true, nil
+}
+
+// countCache remembers each filter's total for ttl so consecutive pages
+// don't recount. Every write to the users slice clears it.
+type countCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]countEntry
+}
+
+type countEntry struct {
+	n  int
+	at time.Time
+}
+
+func (cc *countCache) get(key string, count func() int) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if e, ok := cc.entries[key]; ok && time.Since(e.at) < cc.ttl {
+		return e.n
+	}
+	n := count()
+	cc.entries[key] = countEntry{n: n, at: time.Now()}
+	return n
+}
+
+func (cc *countCache) invalidate() {
+	cc.mu.Lock()
+	cc.entries = make(map[string]countEntry)
+	cc.mu.Unlock()
+}
+
+var userCounts = &countCache{ttl: 30 * time.Second, entries: make(map[string]countEntry)}
+
 // getUserByID handles GET /users/:id
 func getUserByID(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -257,6 +442,7 @@ func updateUser(c *gin.Context) {
 			users[i].Email = updatedUser.Email
 			users[i].Role = updatedUser.Role
 			users[i].IsActive = *updatedUser.IsActive
+			userCounts.invalidate()
 			c.JSON(http.StatusOK, users[i])
 			return
 		}
@@ -279,6 +465,7 @@ func deleteUser(c *gin.Context) {
 	for i, u := range users {
 		if u.ID == id {
 			users = append(users[:i], users[i+1:]...)
+			userCounts.invalidate()
 			c.Status(http.StatusNoContent)
 			return
 		}
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.comcom/google/uuid"
+	"github.com/google/uuid"
 )
 
 // --- Domain Models ---
@@ -47,51 +51,240 @@ type Post struct {
 	Status  PostStatus `json:"status"`
 }
 
+// --- Domain Errors ---
+
+// ErrorKind classifies a service error. Controllers hand errors to
+// errorMiddleware, which picks the status code from the kind.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindConflict
+	KindInvalid
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	case KindInvalid:
+		return "invalid"
+	default:
+		return "internal"
+	}
+}
+
+// DomainError is an error with a kind and, where known, the resource and
+// field it concerns.
+type DomainError struct {
+	Kind     ErrorKind
+	Resource string
+	Field    string
+	Message  string
+}
+
+func (e *DomainError) Error() string { return e.Message }
+
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrEmailAlreadyExists = errors.New("email already exists")
+	ErrUserNotFound       = &DomainError{Kind: KindNotFound, Resource: "user", Message: "user not found"}
+	ErrEmailAlreadyExists = &DomainError{Kind: KindConflict, Resource: "user", Field: "email", Message: "email already exists"}
+	ErrInvalidSort        = &DomainError{Kind: KindInvalid, Field: "sort", Message: "invalid sort"}
 )
 
+var httpStatusByKind = map[ErrorKind]int{
+	KindInternal: http.StatusInternalServerError,
+	KindNotFound: http.StatusNotFound,
+	KindConflict: http.StatusConflict,
+	KindInvalid:  http.StatusBadRequest,
+}
+
+// --- Clock ---
+
+// Clock is the time source for repositories and services, so tests can control timestamps.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+// FakeClock only moves when Advance is called.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// --- Sorting ---
+
+// SortKey orders users by one field, descending when Desc is set.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// userSortFields are the fields ?sort= accepts, each with a three-way
+// comparison.
+var userSortFields = map[string]func(a, b *User) int{
+	"created_at": func(a, b *User) int {
+		switch {
+		case a.CreatedAt.Before(b.CreatedAt):
+			return -1
+		case a.CreatedAt.After(b.CreatedAt):
+			return 1
+		}
+		return 0
+	},
+	"email": func(a, b *User) int { return strings.Compare(a.Email, b.Email) },
+	"role":  func(a, b *User) int { return strings.Compare(string(a.Role), string(b.Role)) },
+	"is_active": func(a, b *User) int {
+		switch {
+		case a.IsActive == b.IsActive:
+			return 0
+		case a.IsActive:
+			return 1
+		}
+		return -1
+	},
+}
+
+// DefaultUserSort is used when a list request names no sort.
+var DefaultUserSort = []SortKey{{Field: "created_at"}}
+
+// ParseUserSort reads a comma-separated list such as "role,-created_at",
+// where a leading "-" sorts that field descending. An empty string yields
+// DefaultUserSort.
+func ParseUserSort(s string) ([]SortKey, error) {
+	if s == "" {
+		return DefaultUserSort, nil
+	}
+	var keys []SortKey
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		key := SortKey{Field: strings.TrimSpace(part)}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field, key.Desc = key.Field[1:], true
+		}
+		if _, ok := userSortFields[key.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, key.Field)
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("%w: %q given twice", ErrInvalidSort, key.Field)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortUsers orders users by keys and then by ID. The ID tie-break is not
+// optional: without it users sharing a timestamp come back in map order, and
+// offset pagination repeats some and skips others.
+func sortUsers(users []*User, keys []SortKey) {
+	if len(keys) == 0 {
+		keys = DefaultUserSort
+	}
+	sort.Slice(users, func(i, j int) bool {
+		for _, key := range keys {
+			c := userSortFields[key.Field](users[i], users[j])
+			if key.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return users[i].ID.String() < users[j].ID.String()
+	})
+}
+
 // --- Repository Layer (Data Access) ---
 
+// UserRepository implementations must all pass RunUserRepositoryTests:
+//   - missing users yield ErrUserNotFound, taken emails ErrEmailAlreadyExists
+//   - Create stamps CreatedAt from the repository clock when it is zero
+//   - FindAll orders users by the given keys (DefaultUserSort when none),
+//     then by ID, so the order is total and repeatable
+//   - returned users are copies; mutating them does not touch stored state
+//
+// A SQL implementation should end every ORDER BY with id and back the
+// default listing with an index on (created_at, id), plus (role, created_at,
+// id) if sort=role,created_at is common, so pages are read in index order
+// rather than sorted per request.
 type UserRepository interface {
 	Create(user *User) error
 	FindByID(id uuid.UUID) (*User, error)
-	FindAll(filters map[string]string) ([]*User, error)
+	FindAll(filters map[string]string, order []SortKey) ([]*User, error)
 	Update(user *User) error
 	Delete(id uuid.UUID) error
 }
 
 type inMemoryUserRepository struct {
-	users map[uuid.UUID]*User
+	users map[uuid.UUID]User
 	mutex *sync.RWMutex
+	clock Clock
 }
 
 func NewInMemoryUserRepository() UserRepository {
-	repo := &inMemoryUserRepository{
-		users: make(map[uuid.UUID]*User),
-		mutex: &sync.RWMutex{},
-	}
+	repo := NewEmptyInMemoryUserRepository(systemClock{})
 	// Seed data
 	usersToSeed := []*User{
-		{ID: uuid.New(), Email: "admin@example.com", PasswordHash: "hash1", Role: RoleAdmin, IsActive: true, CreatedAt: time.Now().UTC()},
-		{ID: uuid.New(), Email: "user1@example.com", PasswordHash: "hash2", Role: RoleUser, IsActive: true, CreatedAt: time.Now().UTC()},
+		{ID: uuid.New(), Email: "admin@example.com", PasswordHash: "hash1", Role: RoleAdmin, IsActive: true},
+		{ID: uuid.New(), Email: "user1@example.com", PasswordHash: "hash2", Role: RoleUser, IsActive: true},
 	}
 	for _, u := range usersToSeed {
-		repo.users[u.ID] = u
+		repo.Create(u)
 	}
 	return repo
 }
 
+func NewEmptyInMemoryUserRepository(clock Clock) UserRepository {
+	return &inMemoryUserRepository{
+		users: make(map[uuid.UUID]User),
+		mutex: &sync.RWMutex{},
+		clock: clock,
+	}
+}
+
+// emailTaken reports whether another user already has the email. Callers hold the lock.
+func (r *inMemoryUserRepository) emailTaken(email string, exceptID uuid.UUID) bool {
+	for _, u := range r.users {
+		if u.Email == email && u.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *inMemoryUserRepository) Create(user *User) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, u := range r.users {
-		if u.Email == user.Email {
-			return ErrEmailAlreadyExists
-		}
+	if r.emailTaken(user.Email, user.ID) {
+		return ErrEmailAlreadyExists
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = r.clock.Now()
 	}
-	r.users[user.ID] = user
+	r.users[user.ID] = *user
 	return nil
 }
 
@@ -102,10 +295,10 @@ func (r *inMemoryUserRepository) FindByID(id uuid.UUID) (*User, error) {
 	if !ok {
 		return nil, ErrUserNotFound
 	}
-	return user, nil
+	return &user, nil
 }
 
-func (r *inMemoryUserRepository) FindAll(filters map[string]string) ([]*User, error) {
+func (r *inMemoryUserRepository) FindAll(filters map[string]string, order []SortKey) ([]*User, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 	
@@ -125,9 +318,11 @@ func (r *inMemoryUserRepository) FindAll(filters map[string]string) ([]*User, er
 			match = false
 		}
 		if match {
-			result = append(result, user)
+			user := user
+			result = append(result, &user)
 		}
 	}
+	sortUsers(result, order)
 	return result, nil
 }
 
@@ -137,7 +332,10 @@ func (r *inMemoryUserRepository) Update(user *User) error {
 	if _, ok := r.users[user.ID]; !ok {
 		return ErrUserNotFound
 	}
-	r.users[user.ID] = user
+	if r.emailTaken(user.Email, user.ID) {
+		return ErrEmailAlreadyExists
+	}
+	r.users[user.ID] = *user
 	return nil
 }
 
@@ -151,22 +349,85 @@ func (r *inMemoryUserRepository) Delete(id uuid.UUID) error {
 	return nil
 }
 
+// FakeUserRepository wraps another repository and can be told to fail the next
+// call to a method, for exercising service and handler error paths. With no
+// failure armed it behaves exactly like the wrapped repository.
+type FakeUserRepository struct {
+	next     UserRepository
+	mutex    sync.Mutex
+	failures map[string]error // method name -> error for its next call
+}
+
+func NewFakeUserRepository(next UserRepository) *FakeUserRepository {
+	return &FakeUserRepository{next: next, failures: make(map[string]error)}
+}
+
+func (f *FakeUserRepository) FailNext(method string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.failures[method] = err
+}
+
+func (f *FakeUserRepository) injected(method string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	err := f.failures[method]
+	delete(f.failures, method)
+	return err
+}
+
+func (f *FakeUserRepository) Create(user *User) error {
+	if err := f.injected("Create"); err != nil {
+		return err
+	}
+	return f.next.Create(user)
+}
+
+func (f *FakeUserRepository) FindByID(id uuid.UUID) (*User, error) {
+	if err := f.injected("FindByID"); err != nil {
+		return nil, err
+	}
+	return f.next.FindByID(id)
+}
+
+func (f *FakeUserRepository) FindAll(filters map[string]string, order []SortKey) ([]*User, error) {
+	if err := f.injected("FindAll"); err != nil {
+		return nil, err
+	}
+	return f.next.FindAll(filters, order)
+}
+
+func (f *FakeUserRepository) Update(user *User) error {
+	if err := f.injected("Update"); err != nil {
+		return err
+	}
+	return f.next.Update(user)
+}
+
+func (f *FakeUserRepository) Delete(id uuid.UUID) error {
+	if err := f.injected("Delete"); err != nil {
+		return err
+	}
+	return f.next.Delete(id)
+}
+
 // --- Service Layer (Business Logic) ---
 
 type UserService interface {
 	CreateUser(email, password string, role Role) (*User, error)
 	GetUser(id uuid.UUID) (*User, error)
-	ListUsers(filters map[string]string, page, pageSize int) ([]*User, int, error)
+	ListUsers(filters map[string]string, order []SortKey, page, pageSize int) ([]*User, int, error)
 	UpdateUser(id uuid.UUID, email string, role Role, isActive bool) (*User, error)
 	DeleteUser(id uuid.UUID) error
 }
 
 type userServiceImpl struct {
-	repo UserRepository
+	repo  UserRepository
+	clock Clock
 }
 
-func NewUserService(repo UserRepository) UserService {
-	return &userServiceImpl{repo: repo}
+func NewUserService(repo UserRepository, clock Clock) UserService {
+	return &userServiceImpl{repo: repo, clock: clock}
 }
 
 func (s *userServiceImpl) CreateUser(email, password string, role Role) (*User, error) {
@@ -176,7 +437,7 @@ func (s *userServiceImpl) CreateUser(email, password string, role Role) (*User,
 		PasswordHash: fmt.Sprintf("hashed_%s", password), // Use bcrypt
 		Role:         role,
 		IsActive:     true,
-		CreatedAt:    time.Now().UTC(),
+		CreatedAt:    s.clock.Now(),
 	}
 	if err := s.repo.Create(user); err != nil {
 		return nil, err
@@ -188,8 +449,8 @@ func (s *userServiceImpl) GetUser(id uuid.UUID) (*User, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *userServiceImpl) ListUsers(filters map[string]string, page, pageSize int) ([]*User, int, error) {
-	users, err := s.repo.FindAll(filters)
+func (s *userServiceImpl) ListUsers(filters map[string]string, order []SortKey, page, pageSize int) ([]*User, int, error) {
+	users, err := s.repo.FindAll(filters, order)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -233,8 +494,35 @@ func NewUserController(service UserService) *UserController {
 	return &UserController{service: service}
 }
 
+// errorMiddleware renders the last error a handler recorded with c.Error,
+// unless the handler already wrote a response. Errors without a kind are
+// logged and reported as internal, without their message.
+func errorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		var de *DomainError
+		if !errors.As(err, &de) || de.Kind == KindInternal {
+			log.Printf("internal error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		body := gin.H{"error": err.Error(), "kind": de.Kind.String()}
+		if de.Resource != "" {
+			body["resource"] = de.Resource
+		}
+		if de.Field != "" {
+			body["field"] = de.Field
+		}
+		c.JSON(httpStatusByKind[de.Kind], body)
+	}
+}
+
 func (ctrl *UserController) RegisterRoutes(router *gin.Engine) {
-	userRoutes := router.Group("/users")
+	userRoutes := router.Group("/users", errorMiddleware())
 	{
 		userRoutes.POST("", ctrl.Create)
 		userRoutes.GET("", ctrl.List)
@@ -256,11 +544,7 @@ func (ctrl *UserController) Create(c *gin.Context) {
 	}
 	user, err := ctrl.service.CreateUser(req.Email, req.Password, req.Role)
 	if err != nil {
-		if errors.Is(err, ErrEmailAlreadyExists) {
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusCreated, user)
@@ -274,11 +558,7 @@ func (ctrl *UserController) Get(c *gin.Context) {
 	}
 	user, err := ctrl.service.GetUser(id)
 	if err != nil {
-		if errors.Is(err, ErrUserNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, user)
@@ -296,12 +576,18 @@ func (ctrl *UserController) List(c *gin.Context) {
 		filters["search"] = search
 	}
 
+	order, err := ParseUserSort(c.Query("sort"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 
-	users, total, err := ctrl.service.ListUsers(filters, page, pageSize)
+	users, total, err := ctrl.service.ListUsers(filters, order, page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": users, "total": total, "page": page, "pageSize": pageSize})
@@ -324,11 +610,7 @@ func (ctrl *UserController) Update(c *gin.Context) {
 	}
 	user, err := ctrl.service.UpdateUser(id, req.Email, req.Role, *req.IsActive)
 	if err != nil {
-		if errors.Is(err, ErrUserNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, user)
@@ -341,22 +623,377 @@ func (ctrl *UserController) Delete(c *gin.Context) {
 		return
 	}
 	if err := ctrl.service.DeleteUser(id); err != nil {
-		if errors.Is(err, ErrUserNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		c.Error(err)
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
+// --- Repository Contract Tests ---
+
+// UserRepositoryFactory returns an empty repository driven by clock.
+type UserRepositoryFactory func(clock Clock) UserRepository
+
+// RunUserRepositoryTests verifies a UserRepository implementation against the
+// behaviour every implementation must share. Pagination is checked through
+// the service, which is where it lives.
+func RunUserRepositoryTests(t *testing.T, newRepo UserRepositoryFactory) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	setup := func() (UserRepository, *FakeClock) {
+		clock := NewFakeClock(start)
+		return newRepo(clock), clock
+	}
+
+	t.Run("CreateThenFindByID", func(t *testing.T) {
+		repo, _ := setup()
+		user := contractUser("alice@example.com", RoleUser, true)
+		mustCreate(t, repo, user)
+		got, err := repo.FindByID(user.ID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		if got.Email != user.Email || got.Role != user.Role || got.IsActive != user.IsActive {
+			t.Errorf("FindByID = %+v, want %+v", got, user)
+		}
+		if !got.CreatedAt.Equal(start) {
+			t.Errorf("CreatedAt = %v, want clock time %v", got.CreatedAt, start)
+		}
+	})
+
+	t.Run("FindByIDMissing", func(t *testing.T) {
+		repo, _ := setup()
+		if _, err := repo.FindByID(uuid.New()); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FindByID(missing) error = %v, want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("ReturnsCopies", func(t *testing.T) {
+		repo, _ := setup()
+		user := contractUser("alice@example.com", RoleUser, true)
+		mustCreate(t, repo, user)
+		user.Email = "changed@example.com"
+		got, _ := repo.FindByID(user.ID)
+		got.Role = RoleAdmin
+		again, _ := repo.FindByID(user.ID)
+		if again.Email != "alice@example.com" || again.Role != RoleUser {
+			t.Errorf("stored user changed through a returned pointer: %+v", again)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo, _ := setup()
+		user := contractUser("alice@example.com", RoleUser, true)
+		mustCreate(t, repo, user)
+		other := contractUser("bob@example.com", RoleUser, true)
+		mustCreate(t, repo, other)
+
+		user.Role, user.IsActive = RoleAdmin, false
+		if err := repo.Update(user); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, _ := repo.FindByID(user.ID)
+		if got.Role != RoleAdmin || got.IsActive {
+			t.Errorf("Update not persisted: %+v", got)
+		}
+
+		user.Email = other.Email
+		if err := repo.Update(user); !errors.Is(err, ErrEmailAlreadyExists) {
+			t.Errorf("Update to taken email error = %v, want ErrEmailAlreadyExists", err)
+		}
+		if err := repo.Update(contractUser("ghost@example.com", RoleUser, true)); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Update(missing) error = %v, want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo, _ := setup()
+		user := contractUser("alice@example.com", RoleUser, true)
+		mustCreate(t, repo, user)
+		if err := repo.Delete(user.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := repo.FindByID(user.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("FindByID after Delete error = %v, want ErrUserNotFound", err)
+		}
+		if err := repo.Delete(user.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("second Delete error = %v, want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		repo, _ := setup()
+		mustCreate(t, repo, contractUser("alice@example.com", RoleUser, true))
+		if err := repo.Create(contractUser("alice@example.com", RoleAdmin, true)); !errors.Is(err, ErrEmailAlreadyExists) {
+			t.Errorf("Create with taken email error = %v, want ErrEmailAlreadyExists", err)
+		}
+		if users, _ := repo.FindAll(nil, nil); len(users) != 1 {
+			t.Errorf("FindAll returned %d users after rejected duplicate, want 1", len(users))
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		repo, clock := setup()
+		for _, u := range []*User{
+			contractUser("alice@corp.com", RoleAdmin, true),
+			contractUser("bob@corp.com", RoleUser, true),
+			contractUser("carol@home.org", RoleUser, false),
+			contractUser("dave@home.org", RoleAdmin, false),
+		} {
+			mustCreate(t, repo, u)
+			clock.Advance(time.Second)
+		}
+		cases := []struct {
+			name    string
+			filters map[string]string
+			want    []string
+		}{
+			{"none", nil, []string{"alice@corp.com", "bob@corp.com", "carol@home.org", "dave@home.org"}},
+			{"role", map[string]string{"role": "ADMIN"}, []string{"alice@corp.com", "dave@home.org"}},
+			{"inactive", map[string]string{"is_active": "false"}, []string{"carol@home.org", "dave@home.org"}},
+			{"search", map[string]string{"search": "corp"}, []string{"alice@corp.com", "bob@corp.com"}},
+			{"combined", map[string]string{"role": "USER", "is_active": "true"}, []string{"bob@corp.com"}},
+			{"no match", map[string]string{"search": "nobody"}, []string{}},
+		}
+		for _, tc := range cases {
+			users, err := repo.FindAll(tc.filters, nil)
+			if err != nil {
+				t.Fatalf("%s: FindAll: %v", tc.name, err)
+			}
+			if got := contractEmails(users); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("%s: FindAll = %v, want %v", tc.name, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("OrderedByCreatedAt", func(t *testing.T) {
+		repo, clock := setup()
+		want := []string{"zoe@example.com", "mia@example.com", "abe@example.com"}
+		for _, email := range want {
+			mustCreate(t, repo, contractUser(email, RoleUser, true))
+			clock.Advance(time.Minute)
+		}
+		users, _ := repo.FindAll(nil, nil)
+		if got := contractEmails(users); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("FindAll order = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("MultiKeySort", func(t *testing.T) {
+		repo, clock := setup()
+		for _, u := range []*User{
+			contractUser("ann@example.com", RoleUser, true),
+			contractUser("ben@example.com", RoleAdmin, true),
+			contractUser("cat@example.com", RoleUser, false),
+			contractUser("dan@example.com", RoleAdmin, false),
+		} {
+			mustCreate(t, repo, u)
+			clock.Advance(time.Second)
+		}
+		cases := []struct {
+			sort string
+			want []string
+		}{
+			{"role,-created_at", []string{"dan@example.com", "ben@example.com", "cat@example.com", "ann@example.com"}},
+			{"-is_active,email", []string{"ann@example.com", "ben@example.com", "cat@example.com", "dan@example.com"}},
+			{"is_active,-role", []string{"cat@example.com", "dan@example.com", "ann@example.com", "ben@example.com"}},
+		}
+		for _, tc := range cases {
+			order, err := ParseUserSort(tc.sort)
+			if err != nil {
+				t.Fatalf("ParseUserSort(%q): %v", tc.sort, err)
+			}
+			users, _ := repo.FindAll(nil, order)
+			if got := contractEmails(users); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("sort=%s: FindAll = %v, want %v", tc.sort, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("TiesBrokenByID", func(t *testing.T) {
+		repo, _ := setup()
+		var ids []string
+		for i := 0; i < 20; i++ {
+			user := contractUser(fmt.Sprintf("same%02d@example.com", i), RoleUser, true)
+			mustCreate(t, repo, user)
+			ids = append(ids, user.ID.String())
+		}
+		sort.Strings(ids)
+		for _, s := range []string{"", "created_at", "-created_at", "role,-created_at"} {
+			order, _ := ParseUserSort(s)
+			users, _ := repo.FindAll(nil, order)
+			got := make([]string, 0, len(users))
+			for _, u := range users {
+				got = append(got, u.ID.String())
+			}
+			if strings.Join(got, ",") != strings.Join(ids, ",") {
+				t.Errorf("sort=%q with one timestamp: not ordered by ID", s)
+			}
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		repo, clock := setup()
+		service := NewUserService(repo, clock)
+		for i := 0; i < 5; i++ {
+			if _, err := service.CreateUser(fmt.Sprintf("user%d@example.com", i), "password", RoleUser); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			clock.Advance(time.Second)
+		}
+		var seen []string
+		for page, wantLen := range []int{2, 2, 1, 0} {
+			users, total, err := service.ListUsers(nil, nil, page+1, 2)
+			if err != nil {
+				t.Fatalf("ListUsers page %d: %v", page+1, err)
+			}
+			if total != 5 || len(users) != wantLen {
+				t.Errorf("page %d: got %d users (total %d), want %d (total 5)", page+1, len(users), total, wantLen)
+			}
+			seen = append(seen, contractEmails(users)...)
+		}
+		all, _ := repo.FindAll(nil, nil)
+		if strings.Join(seen, ",") != strings.Join(contractEmails(all), ",") {
+			t.Errorf("pages %v do not cover FindAll %v exactly once in order", seen, contractEmails(all))
+		}
+	})
+
+	t.Run("StablePaginationWithDuplicateTimestamps", func(t *testing.T) {
+		repo, clock := setup()
+		service := NewUserService(repo, clock)
+		// Three bursts of users sharing a timestamp, split across page edges.
+		for i := 0; i < 12; i++ {
+			role := RoleUser
+			if i%3 == 0 {
+				role = RoleAdmin
+			}
+			if _, err := service.CreateUser(fmt.Sprintf("burst%02d@example.com", i), "password", role); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			if i%4 == 3 {
+				clock.Advance(time.Second)
+			}
+		}
+		for _, s := range []string{"", "-created_at", "role,-created_at"} {
+			order, _ := ParseUserSort(s)
+			for run := 0; run < 5; run++ {
+				var seen []string
+				for page := 1; page <= 5; page++ {
+					users, _, err := service.ListUsers(nil, order, page, 5)
+					if err != nil {
+						t.Fatalf("ListUsers: %v", err)
+					}
+					seen = append(seen, contractEmails(users)...)
+				}
+				all, _ := repo.FindAll(nil, order)
+				if strings.Join(seen, ",") != strings.Join(contractEmails(all), ",") {
+					t.Fatalf("sort=%q run %d: pages %v differ from FindAll %v", s, run, seen, contractEmails(all))
+				}
+			}
+		}
+	})
+
+	t.Run("ConcurrentCreates", func(t *testing.T) {
+		repo, _ := setup()
+		var wg sync.WaitGroup
+		errs := make(chan error, 60)
+		for i := 0; i < 60; i++ {
+			email := fmt.Sprintf("user%d@example.com", i)
+			if i >= 50 {
+				email = "race@example.com"
+			}
+			wg.Add(1)
+			go func(email string) {
+				defer wg.Done()
+				errs <- repo.Create(contractUser(email, RoleUser, true))
+			}(email)
+		}
+		wg.Wait()
+		close(errs)
+
+		created, duplicates := 0, 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, ErrEmailAlreadyExists):
+				duplicates++
+			default:
+				t.Errorf("unexpected Create error: %v", err)
+			}
+		}
+		if created != 51 || duplicates != 9 {
+			t.Errorf("created %d, duplicates %d; want 51 and 9", created, duplicates)
+		}
+		if users, _ := repo.FindAll(nil, nil); len(users) != 51 {
+			t.Errorf("FindAll returned %d users, want 51", len(users))
+		}
+	})
+}
+
+func contractUser(email string, role Role, active bool) *User {
+	return &User{ID: uuid.New(), Email: email, PasswordHash: "hash", Role: role, IsActive: active}
+}
+
+func mustCreate(t *testing.T, repo UserRepository, user *User) {
+	t.Helper()
+	if err := repo.Create(user); err != nil {
+		t.Fatalf("Create(%s): %v", user.Email, err)
+	}
+}
+
+func contractEmails(users []*User) []string {
+	emails := make([]string, 0, len(users))
+	for _, u := range users {
+		emails = append(emails, u.Email)
+	}
+	return emails
+}
+
+func testParseUserSort(t *testing.T) {
+	order, err := ParseUserSort(" role , -created_at")
+	if err != nil || len(order) != 2 || order[0] != (SortKey{Field: "role"}) || order[1] != (SortKey{Field: "created_at", Desc: true}) {
+		t.Errorf("ParseUserSort = %+v, %v", order, err)
+	}
+	if order, _ := ParseUserSort(""); len(order) != 1 || order[0] != DefaultUserSort[0] {
+		t.Errorf("ParseUserSort(\"\") = %+v, want DefaultUserSort", order)
+	}
+	for _, bad := range []string{"password_hash", "role,,email", "-", "role,-role", "id"} {
+		if _, err := ParseUserSort(bad); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("ParseUserSort(%q) error = %v, want ErrInvalidSort", bad, err)
+		}
+	}
+}
+
+// runContractTests runs the contract suite against every implementation in
+// this file. Standard test flags such as -test.v and -test.run are accepted.
+func runContractTests(args []string) {
+	os.Args = append([]string{os.Args[0]}, args...)
+	testing.Init()
+	testing.Main(regexp.MatchString, []testing.InternalTest{
+		{Name: "ParseUserSort", F: testParseUserSort},
+		{Name: "InMemoryUserRepository", F: func(t *testing.T) {
+			RunUserRepositoryTests(t, NewEmptyInMemoryUserRepository)
+		}},
+		{Name: "FakeUserRepository", F: func(t *testing.T) {
+			RunUserRepositoryTests(t, func(clock Clock) UserRepository {
+				return NewFakeUserRepository(NewEmptyInMemoryUserRepository(clock))
+			})
+		}},
+	}, nil, nil)
+}
+
 // --- Main Application ---
 
 func main() {
+	// `go run . contract-test -test.v` runs the repository contract suite instead of the server.
+	if len(os.Args) > 1 && os.Args[1] == "contract-test" {
+		runContractTests(os.Args[2:])
+		return
+	}
+
 	// Dependency Injection Wire-up
 	userRepo := NewInMemoryUserRepository()
-	userService := NewUserService(userRepo)
+	userService := NewUserService(userRepo, systemClock{})
 	userController := NewUserController(userService)
 
 	router := gin.Default()
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -82,17 +85,37 @@ func toUserResponse(user *User) UserResponse {
 
 type UserStore struct {
 	data  map[uuid.UUID]*User
+	index *EmailIndex
 	mutex sync.RWMutex
 }
 
 func NewUserStore() *UserStore {
 	store := &UserStore{
-		data: make(map[uuid.UUID]*User),
+		data:  make(map[uuid.UUID]*User),
+		index: NewEmailIndex(),
 	}
 	store.seed()
 	return store
 }
 
+// insert, setEmail and remove are the only ways users are written, which keeps
+// the email index in sync. Callers hold the write lock.
+func (s *UserStore) insert(u *User) {
+	s.data[u.ID] = u
+	s.index.Insert(u.Email, u.ID)
+}
+
+func (s *UserStore) setEmail(u *User, email string) {
+	s.index.Remove(u.Email, u.ID)
+	u.Email = email
+	s.index.Insert(email, u.ID)
+}
+
+func (s *UserStore) remove(u *User) {
+	s.index.Remove(u.Email, u.ID)
+	delete(s.data, u.ID)
+}
+
 func (s *UserStore) seed() {
 	users := []*User{
 		{ID: uuid.New(), Email: "admin@example.com", PasswordHash: "hash1", Role: RoleAdmin, IsActive: true, CreatedAt: time.Now().UTC()},
@@ -100,10 +123,121 @@ func (s *UserStore) seed() {
 		{ID: uuid.New(), Email: "user2@example.com", PasswordHash: "hash3", Role: RoleUser, IsActive: false, CreatedAt: time.Now().UTC()},
 	}
 	for _, u := range users {
-		s.data[u.ID] = u
+		s.insert(u)
+	}
+}
+
+func hashPassword(password string) string {
+	return "hashed_" + password // Use bcrypt in production
+}
+
+// Authenticate returns the active user with this email and password.
+func (s *UserStore) Authenticate(email, password string) (*User, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, u := range s.data {
+		if u.IsActive && strings.EqualFold(u.Email, email) &&
+			subtle.ConstantTimeCompare([]byte(u.PasswordHash), []byte(hashPassword(password))) == 1 {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// --- package: search ---
+// This section simulates a search package: a case-insensitive prefix trie
+// over emails for typeahead lookups.
+
+type trieNode struct {
+	keys     []byte // sorted, parallel to children
+	children []*trieNode
+	ids      []uuid.UUID // users whose email ends at this node
+}
+
+func (n *trieNode) child(b byte) (*trieNode, int) {
+	i := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= b })
+	if i < len(n.keys) && n.keys[i] == b {
+		return n.children[i], i
+	}
+	return nil, i
+}
+
+type EmailIndex struct {
+	root *trieNode
+}
+
+func NewEmailIndex() *EmailIndex {
+	return &EmailIndex{root: &trieNode{}}
+}
+
+func (ix *EmailIndex) Insert(email string, id uuid.UUID) {
+	n := ix.root
+	for _, b := range []byte(strings.ToLower(email)) {
+		next, i := n.child(b)
+		if next == nil {
+			next = &trieNode{}
+			n.keys = append(n.keys[:i], append([]byte{b}, n.keys[i:]...)...)
+			n.children = append(n.children[:i], append([]*trieNode{next}, n.children[i:]...)...)
+		}
+		n = next
+	}
+	n.ids = append(n.ids, id)
+}
+
+// Remove deletes id under email and prunes branches left empty.
+func (ix *EmailIndex) Remove(email string, id uuid.UUID) {
+	key := []byte(strings.ToLower(email))
+	path := make([]*trieNode, 0, len(key)+1)
+	n := ix.root
+	for _, b := range key {
+		path = append(path, n)
+		if n, _ = n.child(b); n == nil {
+			return
+		}
+	}
+	for i, existing := range n.ids {
+		if existing == id {
+			n.ids = append(n.ids[:i], n.ids[i+1:]...)
+			break
+		}
+	}
+	for depth := len(key) - 1; depth >= 0 && len(n.ids) == 0 && len(n.keys) == 0; depth-- {
+		parent := path[depth]
+		_, i := parent.child(key[depth])
+		parent.keys = append(parent.keys[:i], parent.keys[i+1:]...)
+		parent.children = append(parent.children[:i], parent.children[i+1:]...)
+		n = parent
 	}
 }
 
+// Prefix returns up to limit IDs whose email starts with prefix, in email
+// order. It only visits the matching subtree.
+func (ix *EmailIndex) Prefix(prefix string, limit int) []uuid.UUID {
+	n := ix.root
+	for _, b := range []byte(strings.ToLower(prefix)) {
+		if n, _ = n.child(b); n == nil {
+			return nil
+		}
+	}
+	var ids []uuid.UUID
+	var walk func(n *trieNode) bool
+	walk = func(n *trieNode) bool {
+		for _, id := range n.ids {
+			if ids = append(ids, id); len(ids) == limit {
+				return false
+			}
+		}
+		for _, c := range n.children {
+			if !walk(c) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(n)
+	return ids
+}
+
 // --- package: user (module) ---
 // This section simulates a self-contained user module with its own handlers and route registration.
 
@@ -128,15 +262,20 @@ func (api *UserAPI) CreateUser(c *gin.Context) {
 		}
 	}
 
+	if req.Role == RoleAdmin && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can create admins"})
+		return
+	}
+
 	newUser := &User{
 		ID:           uuid.New(),
 		Email:        req.Email,
-		PasswordHash: "hashed_" + req.Password, // Use bcrypt in production
+		PasswordHash: hashPassword(req.Password),
 		Role:         req.Role,
 		IsActive:     true,
 		CreatedAt:    time.Now().UTC(),
 	}
-	api.Store.data[newUser.ID] = newUser
+	api.Store.insert(newUser)
 
 	c.JSON(http.StatusCreated, toUserResponse(newUser))
 }
@@ -226,6 +365,10 @@ func (api *UserAPI) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Role != nil && *req.Role == RoleAdmin && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can grant the ADMIN role"})
+		return
+	}
 
 	api.Store.mutex.Lock()
 	defer api.Store.mutex.Unlock()
@@ -237,8 +380,8 @@ func (api *UserAPI) UpdateUser(c *gin.Context) {
 	}
 
 	// This logic is for PATCH, but can be used for PUT if all fields are required in the DTO
-	if req.Email != nil {
-		user.Email = *req.Email
+	if req.Email != nil && *req.Email != user.Email {
+		api.Store.setEmail(user, *req.Email)
 	}
 	if req.Role != nil {
 		user.Role = *req.Role
@@ -260,15 +403,124 @@ func (api *UserAPI) DeleteUser(c *gin.Context) {
 	api.Store.mutex.Lock()
 	defer api.Store.mutex.Unlock()
 
-	if _, ok := api.Store.data[userID]; !ok {
+	user, ok := api.Store.data[userID]
+	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
 
-	delete(api.Store.data, userID)
+	api.Store.remove(user)
 	c.Status(http.StatusNoContent)
 }
 
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+// SuggestUsers serves typeahead for the admin UI: users whose email starts
+// with q, in email order, with their role and active state.
+func (api *UserAPI) SuggestUsers(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit := defaultSuggestLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSuggestLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50"})
+			return
+		}
+		limit = n
+	}
+
+	api.Store.mutex.RLock()
+	defer api.Store.mutex.RUnlock()
+
+	ids := api.Store.index.Prefix(q, limit)
+	suggestions := make([]UserResponse, 0, len(ids))
+	for _, id := range ids {
+		suggestions = append(suggestions, toUserResponse(api.Store.data[id]))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": suggestions})
+}
+
+// --- package: auth ---
+// Requests may carry HTTP Basic credentials (email and password). Requests
+// without them are anonymous; wrong ones are rejected.
+
+const currentUserKey = "currentUser"
+
+func authMiddleware(store *UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if email, password, ok := c.Request.BasicAuth(); ok {
+			user, ok := store.Authenticate(email, password)
+			if !ok {
+				c.Header("WWW-Authenticate", `Basic realm="api"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+				return
+			}
+			c.Set(currentUserKey, user)
+		}
+		c.Next()
+	}
+}
+
+// currentUser returns the authenticated user; ok is false for anonymous
+// requests.
+func currentUser(c *gin.Context) (*User, bool) {
+	v, ok := c.Get(currentUserKey)
+	user, _ := v.(*User)
+	return user, ok && user != nil
+}
+
+func isAdmin(c *gin.Context) bool {
+	user, ok := currentUser(c)
+	return ok && user.Role == RoleAdmin
+}
+
+// requireRole lets only authenticated users with one of roles through.
+// Anonymous requests are challenged for credentials.
+func requireRole(roles ...Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
+
+// seedAdmin creates an ADMIN user from ADMIN_EMAIL and ADMIN_PASSWORD.
+// Without both, nobody can use the admin routes.
+func seedAdmin(store *UserStore) {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; no admin can sign in")
+		return
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.insert(&User{ID: uuid.New(), Email: email, PasswordHash: hashPassword(password), Role: RoleAdmin, IsActive: true, CreatedAt: time.Now().UTC()})
+}
+
+// RegisterAdminUserRoutes registers the admin-only user lookups.
+func RegisterAdminUserRoutes(rg *gin.RouterGroup, store *UserStore) {
+	api := &UserAPI{Store: store}
+
+	rg.GET("/suggest", api.SuggestUsers)
+}
+
 // RegisterUserRoutes encapsulates the routing for the user module.
 func RegisterUserRoutes(rg *gin.RouterGroup, store *UserStore) {
 	api := &UserAPI{Store: store}
@@ -287,16 +539,20 @@ func RegisterUserRoutes(rg *gin.RouterGroup, store *UserStore) {
 func main() {
 	// Initialize shared dependencies, like the data store
 	userStore := NewUserStore()
+	seedAdmin(userStore)
 
 	// Setup Gin router
 	router := gin.Default()
 
 	// Create a versioned API group
-	v1 := router.Group("/api/v1")
+	v1 := router.Group("/api/v1", authMiddleware(userStore))
 	{
 		// Register the user module's routes within the v1 group
 		userRoutes := v1.Group("/users")
 		RegisterUserRoutes(userRoutes, userStore)
+
+		adminUserRoutes := v1.Group("/admin/users", requireRole(RoleAdmin))
+		RegisterAdminUserRoutes(adminUserRoutes, userStore)
 	}
 
 	log.Println("Server starting on port 8080...")
@@ -7,15 +7,22 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"testing"
 	"time"
 )
 
@@ -42,11 +49,12 @@ type User struct {
 }
 
 type Post struct {
-	ID      string     `json:"id"`
-	UserID  string     `json:"user_id"`
-	Title   string     `json:"title"`
-	Content string     `json:"content"`
-	Status  PostStatus `json:"status"`
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	Status      PostStatus `json:"status"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
 }
 
 // --- Context Keys ---
@@ -60,31 +68,293 @@ var (
 	storeLock = sync.RWMutex{}
 )
 
+// --- Clock ---
+
+// Clock is the time source for token checks, per-user jobs and the periodic
+// workers. AfterFunc is how anything waits, so a FakeClock can fire it.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+type ClockTimer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) ClockTimer { return time.AfterFunc(d, f) }
+
+// clock is swapped for a FakeClock by the selftest.
+var clock Clock = systemClock{}
+
+// FakeClock only moves when Advance is called. Timers that come due during an
+// Advance run synchronously, in due order, with Now reporting their due time.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	at    time.Time
+	f     func()
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// every calls fn with the current time once per interval until the process
+// exits. It reschedules itself through clock so a FakeClock can drive it.
+func every(interval time.Duration, fn func(now time.Time)) {
+	var tick func()
+	tick = func() {
+		fn(clock.Now())
+		clock.AfterFunc(interval, tick)
+	}
+	clock.AfterFunc(interval, tick)
+}
+
+// --- Activity & Job Run Events ---
+// Raw events the stats rollup aggregates from. They are pruned by the rollup
+// once they fall outside every rollup window.
+type jobRun struct {
+	Name   string
+	At     time.Time
+	Failed bool
+}
+
+var (
+	activeByDay = make(map[string]map[string]struct{}) // "2006-01-02" -> user IDs seen that day
+	jobRuns     []jobRun
+	eventLock   = sync.Mutex{}
+)
+
+func recordActivity(userID string, at time.Time) {
+	day := at.UTC().Format("2006-01-02")
+	eventLock.Lock()
+	defer eventLock.Unlock()
+	if activeByDay[day] == nil {
+		activeByDay[day] = make(map[string]struct{})
+	}
+	activeByDay[day][userID] = struct{}{}
+}
+
+// runJob executes a background job and records its outcome. A panic counts as
+// a failure instead of taking the process down.
+func runJob(name string, fn func() error) {
+	at := clock.Now()
+	var err error
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+		if err != nil {
+			log.Printf("job %s failed: %v", name, err)
+		}
+		eventLock.Lock()
+		jobRuns = append(jobRuns, jobRun{Name: name, At: at, Failed: err != nil})
+		eventLock.Unlock()
+	}()
+	err = fn()
+}
+
 // --- JWT Manager ---
+
+// ClaimsEnricher adds custom claims (tenant, permissions, ...) to a token
+// being issued for user. Returning an error aborts token generation.
+type ClaimsEnricher func(user User, custom map[string]interface{}) error
+
+type JWTConfig struct {
+	Issuer    string
+	Audience  []string      // written to issued tokens; a token must name at least one to be accepted
+	TTL       time.Duration
+	ClockSkew time.Duration // tolerance applied to exp, nbf and iat checks
+	Clock     Clock         // defaults to the package clock
+	Enrichers []ClaimsEnricher
+}
+
 type JWTManager struct {
 	secretKey []byte
-	issuer    string
+	config    JWTConfig
+	registry  *TokenRegistry
 }
 
 type UserClaims struct {
 	UserID string   `json:"uid"`
 	Role   UserRole `json:"rol"`
 	Exp    int64    `json:"exp"`
+	Iat    int64    `json:"iat"`
+	Nbf    int64    `json:"nbf,omitempty"`
 	Iss    string   `json:"iss"`
+	Aud    Audience `json:"aud,omitempty"`
+	JTI    string   `json:"jti"`
+	// Custom holds claims added by enrichers. They are serialized as top-level
+	// claims and cannot shadow the registered ones above.
+	Custom map[string]interface{} `json:"-"`
 }
 
-func NewJWTManager(secret string, issuer string) *JWTManager {
-	return &JWTManager{secretKey: []byte(secret), issuer: issuer}
+// Audience accepts both forms RFC 7519 allows: a single string or an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+type userClaimsAlias UserClaims
+
+var registeredClaims = map[string]bool{"uid": true, "rol": true, "exp": true, "iat": true, "nbf": true, "iss": true, "aud": true, "jti": true}
+
+func (c UserClaims) MarshalJSON() ([]byte, error) {
+	base, err := json.Marshal(userClaimsAlias(c))
+	if err != nil || len(c.Custom) == 0 {
+		return base, err
+	}
+	merged := make(map[string]interface{}, len(c.Custom)+len(registeredClaims))
+	for k, v := range c.Custom {
+		if !registeredClaims[k] {
+			merged[k] = v
+		}
+	}
+	if err := json.Unmarshal(base, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+func (c *UserClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*userClaimsAlias)(c)); err != nil {
+		return err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for k, v := range all {
+		if registeredClaims[k] {
+			continue
+		}
+		if c.Custom == nil {
+			c.Custom = make(map[string]interface{})
+		}
+		c.Custom[k] = v
+	}
+	return nil
+}
+
+// TokenError is the reason a token was rejected. Compare with errors.Is
+// against the Err* values below; Message is safe to show to clients.
+type TokenError struct {
+	Code    string
+	Message string
+}
+
+func (e *TokenError) Error() string { return e.Message }
+
+var (
+	ErrTokenMalformed        = &TokenError{Code: "malformed", Message: "Token is malformed"}
+	ErrTokenSignatureInvalid = &TokenError{Code: "invalid_signature", Message: "Token signature is invalid"}
+	ErrTokenExpired          = &TokenError{Code: "expired", Message: "Token has expired"}
+	ErrTokenNotYetValid      = &TokenError{Code: "not_yet_valid", Message: "Token is not valid yet"}
+	ErrTokenIssuerInvalid    = &TokenError{Code: "invalid_issuer", Message: "Token was issued by an untrusted issuer"}
+	ErrTokenAudienceInvalid  = &TokenError{Code: "invalid_audience", Message: "Token is not intended for this service"}
+	ErrAccountSuspended      = &TokenError{Code: "account_suspended", Message: "Account is suspended"}
+)
+
+func NewJWTManager(secret string, config JWTConfig, registry *TokenRegistry) *JWTManager {
+	if config.TTL == 0 {
+		config.TTL = time.Hour
+	}
+	if config.Clock == nil {
+		config.Clock = clock
+	}
+	return &JWTManager{secretKey: []byte(secret), config: config, registry: registry}
 }
 
 func (m *JWTManager) Generate(user User) (string, error) {
 	header := `{"alg":"HS256","typ":"JWT"}`
+	now := m.config.Clock.Now()
 	claims := UserClaims{
 		UserID: user.ID,
 		Role:   user.Role,
-		Exp:    time.Now().Add(time.Hour * 1).Unix(),
-		Iss:    m.issuer,
+		Exp:    now.Add(m.config.TTL).Unix(),
+		Iat:    now.Unix(),
+		Nbf:    now.Unix(),
+		Iss:    m.config.Issuer,
+		Aud:    Audience(m.config.Audience),
+		JTI:    newUUID(),
 	}
+	if len(m.config.Enrichers) > 0 {
+		claims.Custom = make(map[string]interface{})
+		for _, enrich := range m.config.Enrichers {
+			if err := enrich(user, claims.Custom); err != nil {
+				return "", fmt.Errorf("enriching claims: %w", err)
+			}
+		}
+	}
+	m.registry.Record(claims)
 	
 	headerB64 := base64.RawURLEncoding.EncodeToString([]byte(header))
 	claimsJSON, err := json.Marshal(claims)
@@ -105,7 +375,7 @@ func (m *JWTManager) Generate(user User) (string, error) {
 func (m *JWTManager) Parse(tokenString string) (*UserClaims, error) {
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("malformed token")
+		return nil, ErrTokenMalformed
 	}
 
 	message := parts[0] + "." + parts[1]
@@ -115,33 +385,309 @@ func (m *JWTManager) Parse(tokenString string) (*UserClaims, error) {
 
 	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
 	if err != nil {
-		return nil, fmt.Errorf("invalid signature")
+		return nil, ErrTokenMalformed
 	}
 
 	if !hmac.Equal(signature, expectedMAC) {
-		return nil, fmt.Errorf("invalid signature")
+		return nil, ErrTokenSignatureInvalid
 	}
 
 	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return nil, fmt.Errorf("malformed payload")
+		return nil, ErrTokenMalformed
 	}
 
 	var claims UserClaims
 	if err := json.Unmarshal(payload, &claims); err != nil {
-		return nil, err
+		return nil, ErrTokenMalformed
 	}
 
-	if claims.Exp < time.Now().Unix() {
-		return nil, fmt.Errorf("token is expired")
+	now := m.config.Clock.Now()
+	skew := m.config.ClockSkew
+	if now.After(time.Unix(claims.Exp, 0).Add(skew)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.Nbf != 0 && now.Add(skew).Before(time.Unix(claims.Nbf, 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if now.Add(skew).Before(time.Unix(claims.Iat, 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if claims.Iss != m.config.Issuer {
+		return nil, ErrTokenIssuerInvalid
 	}
-	if claims.Iss != m.issuer {
-		return nil, fmt.Errorf("invalid issuer")
+	if len(m.config.Audience) > 0 && !audienceMatches(claims.Aud, m.config.Audience) {
+		return nil, ErrTokenAudienceInvalid
 	}
 
 	return &claims, nil
 }
 
+func audienceMatches(tokenAud Audience, accepted []string) bool {
+	for _, a := range tokenAud {
+		for _, b := range accepted {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeTokenError answers 401 with the precise rejection reason, mirrored in
+// WWW-Authenticate as RFC 6750 describes.
+func writeTokenError(w http.ResponseWriter, err error) {
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) {
+		tokenErr = ErrTokenMalformed
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, tokenErr.Message))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": tokenErr.Message, "reason": tokenErr.Code})
+}
+
+// permissionsEnricher grants permissions by role; a real system would load them from storage.
+func permissionsEnricher(user User, custom map[string]interface{}) error {
+	permissions := []string{"posts:read", "posts:write"}
+	if user.Role == RoleAdmin {
+		permissions = append(permissions, "admin:stats", "tokens:revoke")
+	}
+	custom["permissions"] = permissions
+	return nil
+}
+
+// --- Token Registry & Revocation ---
+
+// bloomFilter gives a fast "definitely not revoked" answer so the common path
+// never touches the locked revocation map.
+type bloomFilter struct {
+	bits   []uint64
+	hashes uint64
+}
+
+func newBloomFilter(size uint64, hashes uint64) *bloomFilter {
+	return &bloomFilter{bits: make([]uint64, (size+63)/64), hashes: hashes}
+}
+
+func (b *bloomFilter) positions(key string) []uint64 {
+	sum := sha256.Sum256([]byte(key))
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	n := uint64(len(b.bits)) * 64
+	pos := make([]uint64, b.hashes)
+	for i := uint64(0); i < b.hashes; i++ {
+		pos[i] = (h1 + i*h2) % n
+	}
+	return pos
+}
+
+func (b *bloomFilter) Add(key string) {
+	for _, p := range b.positions(key) {
+		b.bits[p/64] |= 1 << (p % 64)
+	}
+}
+
+func (b *bloomFilter) MayContain(key string) bool {
+	for _, p := range b.positions(key) {
+		if b.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type issuedToken struct {
+	UserID    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// TokenRegistry records every issued jti and the subset that has been revoked.
+// Entries are dropped once the token would have expired anyway.
+type TokenRegistry struct {
+	mu      sync.RWMutex
+	issued  map[string]issuedToken
+	revoked map[string]time.Time // jti -> token expiry
+	filter  *bloomFilter
+}
+
+const (
+	bloomBits   = 1 << 16
+	bloomHashes = 4
+)
+
+func NewTokenRegistry() *TokenRegistry {
+	return &TokenRegistry{
+		issued:  make(map[string]issuedToken),
+		revoked: make(map[string]time.Time),
+		filter:  newBloomFilter(bloomBits, bloomHashes),
+	}
+}
+
+func (r *TokenRegistry) Record(claims UserClaims) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.issued[claims.JTI] = issuedToken{
+		UserID:    claims.UserID,
+		IssuedAt:  time.Unix(claims.Iat, 0),
+		ExpiresAt: time.Unix(claims.Exp, 0),
+	}
+}
+
+func (r *TokenRegistry) Revoke(jti string, expiresAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[jti] = expiresAt
+	r.filter.Add(jti)
+}
+
+func (r *TokenRegistry) IsRevoked(jti string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.filter.MayContain(jti) {
+		return false
+	}
+	_, revoked := r.revoked[jti]
+	return revoked
+}
+
+// RevokeUser revokes every unexpired token issued to the user and returns how
+// many were revoked.
+func (r *TokenRegistry) RevokeUser(userID string, now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for jti, t := range r.issued {
+		if t.UserID != userID || now.After(t.ExpiresAt) {
+			continue
+		}
+		if _, done := r.revoked[jti]; done {
+			continue
+		}
+		r.revoked[jti] = t.ExpiresAt
+		r.filter.Add(jti)
+		count++
+	}
+	return count
+}
+
+// Prune forgets expired tokens and rebuilds the bloom filter so it does not fill up over time.
+func (r *TokenRegistry) Prune(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for jti, t := range r.issued {
+		if now.After(t.ExpiresAt) {
+			delete(r.issued, jti)
+		}
+	}
+	r.filter = newBloomFilter(bloomBits, bloomHashes)
+	for jti, exp := range r.revoked {
+		if now.After(exp) {
+			delete(r.revoked, jti)
+			continue
+		}
+		r.filter.Add(jti)
+	}
+}
+
+func (r *TokenRegistry) StartPruner(interval time.Duration) {
+	every(interval, func(now time.Time) {
+		runJob("token_prune", func() error {
+			r.Prune(now)
+			return nil
+		})
+	})
+}
+
+// --- Audit & Notifications ---
+type AuditEvent struct {
+	Seq     int64     `json:"seq"`
+	At      time.Time `json:"at"`
+	ActorID string    `json:"actor_id"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+const maxAuditEvents = 1000
+
+var (
+	auditEvents []AuditEvent
+	auditSeq    int64
+	auditLock   = sync.Mutex{}
+)
+
+// recordAudit keeps the most recent maxAuditEvents events in memory. Seq
+// increases by one per event, so exports can tell when events were dropped.
+func recordAudit(e AuditEvent) {
+	e.At = clock.Now().UTC()
+	auditLock.Lock()
+	auditSeq++
+	e.Seq = auditSeq
+	auditEvents = append(auditEvents, e)
+	if len(auditEvents) > maxAuditEvents {
+		auditEvents = auditEvents[len(auditEvents)-maxAuditEvents:]
+	}
+	auditLock.Unlock()
+	log.Printf("AUDIT: %s by %s on %s %s", e.Action, e.ActorID, e.Target, e.Detail)
+}
+
+// notifyUser stands in for the mailer.
+func notifyUser(user User, subject, body string) {
+	log.Printf("NOTIFY %s: %s - %s", user.Email, subject, body)
+}
+
+// --- Per-User Jobs ---
+// Deferred work owned by a user. It is tracked per user so that suspending
+// the account can cancel everything still waiting to run.
+type userJob struct {
+	ID    string    `json:"id"`
+	Name  string    `json:"name"`
+	RunAt time.Time `json:"run_at"`
+	timer ClockTimer
+}
+
+var (
+	userJobs     = make(map[string]map[string]*userJob) // user ID -> job ID -> job
+	userJobsLock = sync.Mutex{}
+)
+
+func scheduleUserJob(userID, name string, runAt time.Time, fn func() error) string {
+	job := &userJob{ID: newUUID(), Name: name, RunAt: runAt}
+	userJobsLock.Lock()
+	defer userJobsLock.Unlock()
+	if userJobs[userID] == nil {
+		userJobs[userID] = make(map[string]*userJob)
+	}
+	userJobs[userID][job.ID] = job
+	job.timer = clock.AfterFunc(runAt.Sub(clock.Now()), func() {
+		userJobsLock.Lock()
+		_, pending := userJobs[userID][job.ID]
+		delete(userJobs[userID], job.ID)
+		userJobsLock.Unlock()
+		if pending {
+			runJob(name, fn)
+		}
+	})
+	return job.ID
+}
+
+// cancelUserJobs stops every pending job for the user and returns their count.
+func cancelUserJobs(userID string) int {
+	userJobsLock.Lock()
+	defer userJobsLock.Unlock()
+	jobs := userJobs[userID]
+	for _, job := range jobs {
+		job.timer.Stop()
+	}
+	delete(userJobs, userID)
+	return len(jobs)
+}
+
 // --- Password Utils ---
 // NOTE: Using salted SHA512 due to standard library constraints. Use bcrypt in production.
 func hashPassword(password string) (string, error) {
@@ -163,7 +709,7 @@ func verifyPassword(hashedPassword, password string) bool {
 }
 
 // --- Middleware Chain ---
-func authenticate(jwtManager *JWTManager) func(http.Handler) http.Handler {
+func authenticate(jwtManager *JWTManager, registry *TokenRegistry) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := r.Header.Get("Authorization")
@@ -174,9 +720,23 @@ func authenticate(jwtManager *JWTManager) func(http.Handler) http.Handler {
 			token := strings.TrimPrefix(header, "Bearer ")
 			claims, err := jwtManager.Parse(token)
 			if err != nil {
-				http.Error(w, "Token validation failed: "+err.Error(), http.StatusUnauthorized)
+				writeTokenError(w, err)
+				return
+			}
+			if registry.IsRevoked(claims.JTI) {
+				http.Error(w, "Token has been revoked", http.StatusUnauthorized)
 				return
 			}
+			// Suspension revokes tokens, but this also covers any token
+			// issued while the suspension was being applied.
+			storeLock.RLock()
+			user, ok := userStore[claims.UserID]
+			storeLock.RUnlock()
+			if ok && !user.IsActive {
+				writeTokenError(w, ErrAccountSuspended)
+				return
+			}
+			recordActivity(claims.UserID, clock.Now())
 			ctx := context.WithValue(r.Context(), userContextKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -216,10 +776,15 @@ func loginHandler(jwtManager *JWTManager) http.HandlerFunc {
 		}
 		storeLock.RUnlock()
 
-		if !found || !user.IsActive || !verifyPassword(user.PasswordHash, creds.Password) {
+		if !found || !verifyPassword(user.PasswordHash, creds.Password) {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
+		// Only reveal the suspension once the password is proven correct.
+		if !user.IsActive {
+			writeAccountSuspended(w)
+			return
+		}
 
 		token, err := jwtManager.Generate(user)
 		if err != nil {
@@ -230,6 +795,85 @@ func loginHandler(jwtManager *JWTManager) http.HandlerFunc {
 	}
 }
 
+func writeAccountSuspended(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": ErrAccountSuspended.Message, "reason": ErrAccountSuspended.Code})
+}
+
+func logoutHandler(registry *TokenRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		claims := r.Context().Value(userContextKey).(*UserClaims)
+		registry.Revoke(claims.JTI, time.Unix(claims.Exp, 0))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// revokeHandler follows RFC 7009: callers may revoke their own tokens (admins any
+// token), and the response is 200 even for unknown or already-invalid tokens.
+func revokeHandler(jwtManager *JWTManager, registry *TokenRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		caller := r.Context().Value(userContextKey).(*UserClaims)
+		target, err := jwtManager.Parse(r.FormValue("token"))
+		if err != nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if target.UserID != caller.UserID && caller.Role != RoleAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		registry.Revoke(target.JTI, time.Unix(target.Exp, 0))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// --- Token Introspection (RFC 7662) ---
+// Resource servers authenticate with the client credentials in
+// INTROSPECTION_CLIENT_ID and INTROSPECTION_CLIENT_SECRET. The endpoint is not
+// served unless both are set.
+
+func introspectHandler(jwtManager *JWTManager, registry *TokenRegistry, clientID, clientSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, secret, ok := r.BasicAuth()
+		if !ok || !hmac.Equal([]byte(id), []byte(clientID)) || !hmac.Equal([]byte(secret), []byte(clientSecret)) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+			http.Error(w, "Invalid client credentials", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		claims, err := jwtManager.Parse(r.FormValue("token"))
+		if err != nil || registry.IsRevoked(claims.JTI) {
+			// Per the RFC, inactive tokens reveal nothing beyond "active": false.
+			json.NewEncoder(w).Encode(map[string]bool{"active": false})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":     true,
+			"sub":        claims.UserID,
+			"role":       claims.Role,
+			"iss":        claims.Iss,
+			"exp":        claims.Exp,
+			"iat":        claims.Iat,
+			"jti":        claims.JTI,
+			"token_type": "Bearer",
+		})
+	}
+}
+
 func myPostsHandler(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value(userContextKey).(*UserClaims)
 	storeLock.RLock()
@@ -245,12 +889,661 @@ func myPostsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
-func adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+// schedulePublishHandler publishes one of the caller's draft posts at a later time.
+func schedulePublishHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims := r.Context().Value(userContextKey).(*UserClaims)
+	var req struct {
+		PostID    string    `json:"post_id"`
+		PublishAt time.Time `json:"publish_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
 	storeLock.RLock()
-	defer storeLock.RUnlock()
-	stats := map[string]int{"users": len(userStore), "posts": len(postStore)}
+	post, ok := postStore[req.PostID]
+	storeLock.RUnlock()
+	if !ok || post.UserID != claims.UserID {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if post.Status != StatusDraft {
+		http.Error(w, "Only drafts can be scheduled", http.StatusConflict)
+		return
+	}
+
+	jobID := scheduleUserJob(claims.UserID, "publish_post", req.PublishAt, func() error {
+		storeLock.Lock()
+		defer storeLock.Unlock()
+		p, ok := postStore[req.PostID]
+		if !ok {
+			return fmt.Errorf("post %s no longer exists", req.PostID)
+		}
+		now := clock.Now()
+		p.Status, p.PublishedAt = StatusPublished, &now
+		postStore[p.ID] = p
+		return nil
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+}
+
+// adminStatsHandler serves precomputed rollups; it never scans the stores itself.
+// ?period=daily|weekly narrows the response to one series.
+func adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	snap := statsRollups.Snapshot()
+	if snap.ComputedAt.IsZero() {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Statistics have not been computed yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	age := clock.Now().Sub(snap.ComputedAt)
+	resp := map[string]interface{}{
+		"users": snap.TotalUsers,
+		"posts": snap.TotalPosts,
+		"freshness": map[string]interface{}{
+			"computed_at":              snap.ComputedAt,
+			"age_seconds":              int(age.Seconds()),
+			"refresh_interval_seconds": int(rollupInterval.Seconds()),
+			"compute_ms":               snap.ComputeTime.Milliseconds(),
+			"stale":                    age > 2*rollupInterval,
+		},
+	}
+	switch r.URL.Query().Get("period") {
+	case "":
+		resp["daily"], resp["weekly"] = snap.Daily, snap.Weekly
+	case string(PeriodDaily):
+		resp["daily"] = snap.Daily
+	case string(PeriodWeekly):
+		resp["weekly"] = snap.Weekly
+	default:
+		http.Error(w, "period must be daily or weekly", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// --- Admin User Management ---
+
+// adminUsersHandler serves POST /users/{id}/suspend, /users/{id}/reactivate
+// and /users/{id}/force-logout. An optional JSON body carries a "reason".
+func adminUsersHandler(registry *TokenRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		userID, action := parts[0], parts[1]
+		admin := r.Context().Value(userContextKey).(*UserClaims)
+
+		var body struct{ Reason string }
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+		}
+		if userID == admin.UserID && action != "force-logout" {
+			http.Error(w, "Admins cannot change their own account status", http.StatusForbidden)
+			return
+		}
+
+		storeLock.Lock()
+		user, ok := userStore[userID]
+		if !ok {
+			storeLock.Unlock()
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		switch action {
+		case "suspend":
+			if !user.IsActive {
+				storeLock.Unlock()
+				http.Error(w, "User is already suspended", http.StatusConflict)
+				return
+			}
+			user.IsActive = false
+		case "reactivate":
+			if user.IsActive {
+				storeLock.Unlock()
+				http.Error(w, "User is not suspended", http.StatusConflict)
+				return
+			}
+			user.IsActive = true
+		case "force-logout":
+		default:
+			storeLock.Unlock()
+			http.NotFound(w, r)
+			return
+		}
+		userStore[userID] = user
+		storeLock.Unlock()
+
+		resp := map[string]interface{}{"user": user}
+		event := AuditEvent{ActorID: admin.UserID, Target: "user:" + userID, Detail: body.Reason}
+		switch action {
+		case "suspend":
+			revoked := registry.RevokeUser(userID, clock.Now())
+			canceled := cancelUserJobs(userID)
+			resp["revoked_tokens"], resp["canceled_jobs"] = revoked, canceled
+			event.Action = "user.suspended"
+			notifyUser(user, "Your account has been suspended", body.Reason)
+		case "reactivate":
+			event.Action = "user.reactivated"
+			notifyUser(user, "Your account has been reactivated", "You can sign in again.")
+		case "force-logout":
+			resp["revoked_tokens"] = registry.RevokeUser(userID, clock.Now())
+			event.Action = "user.force_logout"
+			notifyUser(user, "You have been signed out", "An administrator signed you out on all devices.")
+		}
+		recordAudit(event)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func adminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	auditLock.Lock()
+	events := append([]AuditEvent(nil), auditEvents...)
+	auditLock.Unlock()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": events})
+}
+
+// --- Audit Export ---
+// GET /audit/export streams audit events oldest first as NDJSON (default) or
+// CSV (format=csv), filtered by from/to (RFC 3339), actor and action. Ranges
+// over auditExportSyncLimit events, or any with async=true, are exported by a
+// background job instead.
+//
+// Each export ends with a manifest signed with AUDIT_EXPORT_KEY: the last
+// NDJSON line, or the X-Export-Manifest and X-Export-Signature trailers for
+// CSV. It holds the SHA-256 of the exported records, so edited or dropped
+// lines are detectable, and a next_checkpoint that a later export passes as
+// checkpoint= to pick up where this one ended.
+
+const auditExportSyncLimit = 500
+
+var auditExportKey = func() []byte {
+	if key := os.Getenv("AUDIT_EXPORT_KEY"); key != "" {
+		return []byte(key)
+	}
+	log.Println("AUDIT_EXPORT_KEY not set; export signatures only verify until restart")
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+type auditFilter struct {
+	After  int64     `json:"after,omitempty"`
+	From   time.Time `json:"from,omitempty"`
+	To     time.Time `json:"to,omitempty"`
+	Actor  string    `json:"actor,omitempty"`
+	Action string    `json:"action,omitempty"`
+}
+
+func (f auditFilter) matches(e AuditEvent) bool {
+	return e.Seq > f.After &&
+		(f.From.IsZero() || !e.At.Before(f.From)) &&
+		(f.To.IsZero() || e.At.Before(f.To)) &&
+		(f.Actor == "" || e.ActorID == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action)
+}
+
+func signAuditExport(data []byte) string {
+	mac := hmac.New(sha256.New, auditExportKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// A checkpoint carries the whole filter, so a resumed export cannot widen it.
+func encodeCheckpoint(f auditFilter) string {
+	raw, _ := json.Marshal(f)
+	return base64.RawURLEncoding.EncodeToString(raw) + "." + signAuditExport(raw)
+}
+
+func decodeCheckpoint(token string) (auditFilter, error) {
+	var f auditFilter
+	payload, sig, ok := strings.Cut(token, ".")
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if !ok || err != nil || !hmac.Equal([]byte(sig), []byte(signAuditExport(raw))) {
+		return f, errors.New("invalid checkpoint")
+	}
+	return f, json.Unmarshal(raw, &f)
+}
+
+func parseAuditFilter(q url.Values) (auditFilter, error) {
+	if token := q.Get("checkpoint"); token != "" {
+		return decodeCheckpoint(token)
+	}
+	f := auditFilter{Actor: q.Get("actor"), Action: q.Get("action")}
+	for param, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+			}
+			*dst = t
+		}
+	}
+	return f, nil
+}
+
+// selectAuditEvents also reports whether events after f.After were already
+// pushed out of the in-memory log.
+func selectAuditEvents(f auditFilter) (events []AuditEvent, gap bool) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	if len(auditEvents) > 0 && f.After > 0 && auditEvents[0].Seq > f.After+1 {
+		gap = true
+	}
+	for _, e := range auditEvents {
+		if f.matches(e) {
+			events = append(events, e)
+		}
+	}
+	return events, gap
+}
+
+type AuditExportManifest struct {
+	Format         string      `json:"format"`
+	Filter         auditFilter `json:"filter"`
+	Count          int         `json:"count"`
+	FirstSeq       int64       `json:"first_seq,omitempty"`
+	LastSeq        int64       `json:"last_seq,omitempty"`
+	Gap            bool        `json:"gap"`
+	SHA256         string      `json:"sha256"`
+	NextCheckpoint string      `json:"next_checkpoint"`
+	ExportedBy     string      `json:"exported_by"`
+	GeneratedAt    time.Time   `json:"generated_at"`
+}
+
+// writeAuditRecords writes the events and returns the SHA-256 of what it wrote.
+func writeAuditRecords(w io.Writer, format string, events []AuditEvent) (string, error) {
+	h := sha256.New()
+	out := io.MultiWriter(w, h)
+	if format == "csv" {
+		cw := csv.NewWriter(out)
+		cw.Write([]string{"seq", "at", "actor_id", "action", "target", "detail"})
+		for _, e := range events {
+			cw.Write([]string{strconv.FormatInt(e.Seq, 10), e.At.Format(time.RFC3339Nano), e.ActorID, e.Action, e.Target, e.Detail})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return "", err
+		}
+	} else {
+		enc := json.NewEncoder(out)
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signedManifest returns the manifest's JSON and the signature over exactly
+// those bytes.
+func signedManifest(format string, f auditFilter, events []AuditEvent, gap bool, digest, exportedBy string) ([]byte, string) {
+	m := AuditExportManifest{Format: format, Filter: f, Count: len(events), Gap: gap, SHA256: digest, ExportedBy: exportedBy, GeneratedAt: clock.Now().UTC()}
+	next := f
+	if len(events) > 0 {
+		m.FirstSeq, m.LastSeq = events[0].Seq, events[len(events)-1].Seq
+		next.After = m.LastSeq
+	}
+	m.NextCheckpoint = encodeCheckpoint(next)
+	raw, _ := json.Marshal(m)
+	return raw, signAuditExport(raw)
+}
+
+func writeNDJSONManifest(w io.Writer, manifest []byte, sig string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"manifest": json.RawMessage(manifest), "signature": sig})
+}
+
+func auditExportContentType(format string) string {
+	if format == "csv" {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+func adminAuditExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin := r.Context().Value(userContextKey).(*UserClaims)
+	// A token carrying an actor claim was issued to someone acting as this
+	// admin; the trail must not be exportable under a borrowed identity.
+	if _, impersonated := admin.Custom["act"]; impersonated {
+		http.Error(w, "Audit exports cannot be made from an impersonated session", http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "ndjson" && format != "csv" {
+		http.Error(w, "format must be ndjson or csv", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseAuditFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, gap := selectAuditEvents(filter)
+	recordAudit(AuditEvent{ActorID: admin.UserID, Action: "audit.exported", Target: "audit", Detail: fmt.Sprintf("format=%s events=%d", format, len(events))})
+
+	if q.Get("async") == "true" || len(events) > auditExportSyncLimit {
+		job := startAuditExportJob(admin.UserID, format, filter, events, gap)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/admin/audit/export/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job.view())
+		return
+	}
+
+	w.Header().Set("Content-Type", auditExportContentType(format))
+	if format == "csv" {
+		w.Header().Set("Trailer", "X-Export-Manifest, X-Export-Signature")
+	}
+	digest, err := writeAuditRecords(w, format, events)
+	if err != nil {
+		log.Printf("audit export failed: %v", err)
+		return
+	}
+	manifest, sig := signedManifest(format, filter, events, gap, digest, admin.UserID)
+	if format == "csv" {
+		w.Header().Set("X-Export-Manifest", string(manifest))
+		w.Header().Set("X-Export-Signature", sig)
+	} else {
+		writeNDJSONManifest(w, manifest, sig)
+	}
+}
+
+type auditExportJob struct {
+	ID        string          `json:"id"`
+	Status    string          `json:"status"` // running, done or failed
+	CreatedBy string          `json:"created_by"`
+	CreatedAt time.Time       `json:"created_at"`
+	Manifest  json.RawMessage `json:"manifest,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	format    string
+	body      []byte
+}
+
+var (
+	auditExportJobs     = make(map[string]*auditExportJob)
+	auditExportJobsLock = sync.Mutex{}
+)
+
+func (j *auditExportJob) view() auditExportJob {
+	auditExportJobsLock.Lock()
+	defer auditExportJobsLock.Unlock()
+	return *j
+}
+
+func startAuditExportJob(adminID, format string, f auditFilter, events []AuditEvent, gap bool) *auditExportJob {
+	job := &auditExportJob{ID: newUUID(), Status: "running", CreatedBy: adminID, CreatedAt: clock.Now().UTC(), format: format}
+	auditExportJobsLock.Lock()
+	auditExportJobs[job.ID] = job
+	auditExportJobsLock.Unlock()
+
+	go runJob("audit_export", func() error {
+		var buf strings.Builder
+		digest, err := writeAuditRecords(&buf, format, events)
+		var manifest []byte
+		var sig string
+		if err == nil {
+			manifest, sig = signedManifest(format, f, events, gap, digest, adminID)
+			if format != "csv" {
+				writeNDJSONManifest(&buf, manifest, sig)
+			}
+		}
+		auditExportJobsLock.Lock()
+		defer auditExportJobsLock.Unlock()
+		if err != nil {
+			job.Status, job.Error = "failed", err.Error()
+			return err
+		}
+		job.Status, job.Manifest, job.Signature, job.body = "done", manifest, sig, []byte(buf.String())
+		return nil
+	})
+	return job
+}
+
+// adminAuditExportJobsHandler serves GET /audit/export/jobs/{id} and
+// /audit/export/jobs/{id}/download. Only the admin who started an export
+// can see or download it.
+func adminAuditExportJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin := r.Context().Value(userContextKey).(*UserClaims)
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/audit/export/jobs/"), "/"), "/")
+	auditExportJobsLock.Lock()
+	job, ok := auditExportJobs[id]
+	auditExportJobsLock.Unlock()
+	if !ok || job.CreatedBy != admin.UserID {
+		http.NotFound(w, r)
+		return
+	}
+	view := job.view()
+
+	switch action {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	case "download":
+		if view.Status != "done" {
+			http.Error(w, "Export is "+view.Status, http.StatusConflict)
+			return
+		}
+		recordAudit(AuditEvent{ActorID: admin.UserID, Action: "audit.export_downloaded", Target: "audit_export:" + id})
+		w.Header().Set("Content-Type", auditExportContentType(view.format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.%s", id, view.format))
+		if view.format == "csv" {
+			w.Header().Set("X-Export-Manifest", string(view.Manifest))
+			w.Header().Set("X-Export-Signature", view.Signature)
+		}
+		w.Write(view.body)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// --- Stats Rollups ---
+// A periodic job aggregates the stores and raw events into fixed daily and
+// weekly buckets so the admin endpoint reads a small precomputed table.
+type RollupPeriod string
+const (
+	PeriodDaily  RollupPeriod = "daily"
+	PeriodWeekly RollupPeriod = "weekly"
+)
+
+const (
+	rollupInterval    = 5 * time.Minute
+	rollupDailyDays   = 30
+	rollupWeeklyWeeks = 12
+)
+
+type StatsRollup struct {
+	Period         RollupPeriod `json:"period"`
+	BucketStart    time.Time    `json:"bucket_start"`
+	Signups        int          `json:"signups"`
+	ActiveUsers    int          `json:"active_users"`
+	PublishedPosts int          `json:"published_posts"`
+	JobRuns        int          `json:"job_runs"`
+	JobFailures    int          `json:"job_failures"`
+	JobFailureRate float64      `json:"job_failure_rate"`
+}
+
+type RollupSnapshot struct {
+	Daily       []StatsRollup
+	Weekly      []StatsRollup
+	TotalUsers  int
+	TotalPosts  int
+	ComputedAt  time.Time
+	ComputeTime time.Duration
+}
+
+// RollupTable holds the latest materialized rollup, swapped in whole by each run.
+type RollupTable struct {
+	mu   sync.RWMutex
+	snap RollupSnapshot
+}
+
+var statsRollups = &RollupTable{}
+
+func (t *RollupTable) Snapshot() RollupSnapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.snap
+}
+
+func (t *RollupTable) Replace(snap RollupSnapshot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.snap = snap
+}
+
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart returns the Monday starting t's ISO week.
+func weekStart(t time.Time) time.Time {
+	d := dayStart(t)
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+type rollupBucket struct {
+	signups, published, runs, failures int
+	active                             map[string]struct{}
+}
+
+func computeStatsRollups(now time.Time) RollupSnapshot {
+	dailyFrom := dayStart(now).AddDate(0, 0, -(rollupDailyDays - 1))
+	weeklyFrom := weekStart(now).AddDate(0, 0, -7*(rollupWeeklyWeeks-1))
+	retainFrom := dailyFrom
+	if weeklyFrom.Before(retainFrom) {
+		retainFrom = weeklyFrom
+	}
+
+	days := make(map[time.Time]*rollupBucket)
+	weeks := make(map[time.Time]*rollupBucket)
+	bucketFor := func(m map[time.Time]*rollupBucket, start time.Time) *rollupBucket {
+		b, ok := m[start]
+		if !ok {
+			b = &rollupBucket{active: make(map[string]struct{})}
+			m[start] = b
+		}
+		return b
+	}
+	add := func(at time.Time, fn func(b *rollupBucket)) {
+		if d := dayStart(at); !d.Before(dailyFrom) {
+			fn(bucketFor(days, d))
+		}
+		if w := weekStart(at); !w.Before(weeklyFrom) {
+			fn(bucketFor(weeks, w))
+		}
+	}
+
+	snap := RollupSnapshot{ComputedAt: now}
+
+	storeLock.RLock()
+	snap.TotalUsers, snap.TotalPosts = len(userStore), len(postStore)
+	for _, u := range userStore {
+		add(u.CreatedAt, func(b *rollupBucket) { b.signups++ })
+	}
+	for _, p := range postStore {
+		if p.Status == StatusPublished && p.PublishedAt != nil {
+			add(*p.PublishedAt, func(b *rollupBucket) { b.published++ })
+		}
+	}
+	storeLock.RUnlock()
+
+	eventLock.Lock()
+	for day, users := range activeByDay {
+		at, err := time.Parse("2006-01-02", day)
+		if err != nil || at.Before(retainFrom) {
+			delete(activeByDay, day)
+			continue
+		}
+		for id := range users {
+			add(at, func(b *rollupBucket) { b.active[id] = struct{}{} })
+		}
+	}
+	kept := jobRuns[:0]
+	for _, run := range jobRuns {
+		if run.At.Before(retainFrom) {
+			continue
+		}
+		kept = append(kept, run)
+		add(run.At, func(b *rollupBucket) {
+			b.runs++
+			if run.Failed {
+				b.failures++
+			}
+		})
+	}
+	jobRuns = kept
+	eventLock.Unlock()
+
+	materialize := func(period RollupPeriod, m map[time.Time]*rollupBucket, from time.Time, n, stepDays int) []StatsRollup {
+		rows := make([]StatsRollup, 0, n)
+		for i := 0; i < n; i++ {
+			start := from.AddDate(0, 0, i*stepDays)
+			row := StatsRollup{Period: period, BucketStart: start}
+			if b, ok := m[start]; ok {
+				row.Signups, row.PublishedPosts = b.signups, b.published
+				row.ActiveUsers = len(b.active)
+				row.JobRuns, row.JobFailures = b.runs, b.failures
+				if b.runs > 0 {
+					row.JobFailureRate = float64(b.failures) / float64(b.runs)
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+	snap.Daily = materialize(PeriodDaily, days, dailyFrom, rollupDailyDays, 1)
+	snap.Weekly = materialize(PeriodWeekly, weeks, weeklyFrom, rollupWeeklyWeeks, 7)
+	return snap
+}
+
+// StartStatsRollupWorker computes a rollup immediately and then every interval.
+func StartStatsRollupWorker(interval time.Duration) {
+	refresh := func(now time.Time) {
+		runJob("stats_rollup", func() error {
+			snap := computeStatsRollups(now)
+			snap.ComputeTime = clock.Now().Sub(now)
+			statsRollups.Replace(snap)
+			return nil
+		})
+	}
+	go refresh(clock.Now())
+	every(interval, refresh)
 }
 
 // --- OAuth2 Client Simulation ---
@@ -310,10 +1603,14 @@ func oauthCallbackHandler(jwtManager *JWTManager) http.HandlerFunc {
 		if !found {
 			// Create a new user for this OAuth login
 			id := newUUID()
-			user = User{ID: id, Email: oauthUserEmail, Role: RoleUser, IsActive: true, CreatedAt: time.Now()}
+			user = User{ID: id, Email: oauthUserEmail, Role: RoleUser, IsActive: true, CreatedAt: clock.Now()}
 			userStore[id] = user
 		}
 		storeLock.Unlock()
+		if !user.IsActive {
+			writeAccountSuspended(w)
+			return
+		}
 
 		appToken, err := jwtManager.Generate(user)
 		if err != nil {
@@ -346,6 +1643,124 @@ func startMockOAuthProvider() {
 	http.ListenAndServe(":9090", mux)
 }
 
+// --- Clock Tests ---
+// Run with: go run . selftest -test.v
+
+var selftestEpoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// useFakeClock swaps the package clock for a FakeClock for the rest of t.
+func useFakeClock(t *testing.T) *FakeClock {
+	fake := NewFakeClock(selftestEpoch)
+	prev := clock
+	clock = fake
+	t.Cleanup(func() { clock = prev })
+	return fake
+}
+
+func newTestJWTManager(c Clock, registry *TokenRegistry) *JWTManager {
+	return NewJWTManager("selftest-secret", JWTConfig{Issuer: "selftest", TTL: time.Hour, ClockSkew: 30 * time.Second, Clock: c}, registry)
+}
+
+func testTokenExpiryBoundary(t *testing.T) {
+	fake := NewFakeClock(selftestEpoch)
+	m := newTestJWTManager(fake, NewTokenRegistry())
+	token, err := m.Generate(User{ID: "u1", Role: RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(time.Hour + 30*time.Second)
+	if _, err := m.Parse(token); err != nil {
+		t.Fatalf("at exp+skew: %v, want valid", err)
+	}
+	fake.Advance(time.Second)
+	if _, err := m.Parse(token); err != ErrTokenExpired {
+		t.Fatalf("past exp+skew: %v, want %v", err, ErrTokenExpired)
+	}
+}
+
+func testTokenNotYetValid(t *testing.T) {
+	issuerClock := NewFakeClock(selftestEpoch.Add(time.Minute))
+	verifierClock := NewFakeClock(selftestEpoch)
+	registry := NewTokenRegistry()
+	token, err := newTestJWTManager(issuerClock, registry).Generate(User{ID: "u1", Role: RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestJWTManager(verifierClock, registry)
+	if _, err := verifier.Parse(token); err != ErrTokenNotYetValid {
+		t.Fatalf("60s early: %v, want %v", err, ErrTokenNotYetValid)
+	}
+	verifierClock.Advance(30 * time.Second)
+	if _, err := verifier.Parse(token); err != nil {
+		t.Fatalf("within skew: %v, want valid", err)
+	}
+}
+
+func testPrunerDropsExpiredRevocations(t *testing.T) {
+	fake := useFakeClock(t)
+	registry := NewTokenRegistry()
+	registry.StartPruner(10 * time.Minute)
+	claims := UserClaims{UserID: "u1", JTI: "jti-1", Iat: fake.Now().Unix(), Exp: fake.Now().Add(15 * time.Minute).Unix()}
+	registry.Record(claims)
+	registry.Revoke(claims.JTI, time.Unix(claims.Exp, 0))
+
+	fake.Advance(10 * time.Minute)
+	if !registry.IsRevoked(claims.JTI) {
+		t.Fatal("revocation pruned before the token expired")
+	}
+	fake.Advance(10 * time.Minute)
+	if registry.IsRevoked(claims.JTI) {
+		t.Fatal("revocation kept after the token expired")
+	}
+}
+
+func testUserJobRunsAtRunAt(t *testing.T) {
+	fake := useFakeClock(t)
+	var ranAt time.Time
+	scheduleUserJob("u1", "selftest", fake.Now().Add(time.Hour), func() error {
+		ranAt = clock.Now()
+		return nil
+	})
+	fake.Advance(time.Hour - time.Nanosecond)
+	if !ranAt.IsZero() {
+		t.Fatal("job ran before its run time")
+	}
+	fake.Advance(time.Nanosecond)
+	if want := selftestEpoch.Add(time.Hour); !ranAt.Equal(want) {
+		t.Fatalf("job ran at %v, want %v", ranAt, want)
+	}
+}
+
+func testCancelledUserJobNeverRuns(t *testing.T) {
+	fake := useFakeClock(t)
+	ran := false
+	scheduleUserJob("u2", "selftest", fake.Now().Add(time.Minute), func() error {
+		ran = true
+		return nil
+	})
+	if n := cancelUserJobs("u2"); n != 1 {
+		t.Fatalf("cancelled %d jobs, want 1", n)
+	}
+	fake.Advance(time.Hour)
+	if ran {
+		t.Fatal("cancelled job ran")
+	}
+}
+
+// runSelftest runs the clock-driven checks. Standard test flags such as
+// -test.v and -test.run are accepted.
+func runSelftest(args []string) {
+	os.Args = append([]string{os.Args[0]}, args...)
+	testing.Init()
+	testing.Main(regexp.MatchString, []testing.InternalTest{
+		{Name: "TokenExpiryBoundary", F: testTokenExpiryBoundary},
+		{Name: "TokenNotYetValid", F: testTokenNotYetValid},
+		{Name: "PrunerDropsExpiredRevocations", F: testPrunerDropsExpiredRevocations},
+		{Name: "UserJobRunsAtRunAt", F: testUserJobRunsAtRunAt},
+		{Name: "CancelledUserJobNeverRuns", F: testCancelledUserJobNeverRuns},
+	}, nil, nil)
+}
+
 // --- Main Setup ---
 func newUUID() string {
 	b := make([]byte, 16); rand.Read(b)
@@ -354,12 +1769,32 @@ func newUUID() string {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		runSelftest(os.Args[2:])
+		return
+	}
+
 	// Seed data
 	adminPass, _ := hashPassword("adminpass")
 	adminID := newUUID()
-	userStore[adminID] = User{ID: adminID, Email: "admin@test.com", PasswordHash: adminPass, Role: RoleAdmin, IsActive: true, CreatedAt: time.Now()}
+	userStore[adminID] = User{ID: adminID, Email: "admin@test.com", PasswordHash: adminPass, Role: RoleAdmin, IsActive: true, CreatedAt: clock.Now()}
 	
-	jwtManager := NewJWTManager("a-very-secure-secret-for-variation-3", "my-app")
+	tokenRegistry := NewTokenRegistry()
+	tokenRegistry.StartPruner(10 * time.Minute)
+	StartStatsRollupWorker(rollupInterval)
+	jwtManager := NewJWTManager("a-very-secure-secret-for-variation-3", JWTConfig{
+		Issuer:    "my-app",
+		Audience:  []string{"my-app-api"},
+		TTL:       time.Hour,
+		ClockSkew: 30 * time.Second,
+		Enrichers: []ClaimsEnricher{
+			permissionsEnricher,
+			func(user User, custom map[string]interface{}) error {
+				custom["tenant"] = "default"
+				return nil
+			},
+		},
+	}, tokenRegistry)
 
 	go startMockOAuthProvider()
 
@@ -368,16 +1803,30 @@ func main() {
 	mainRouter.HandleFunc("/login", loginHandler(jwtManager))
 	mainRouter.HandleFunc("/login/oauth", oauthLoginHandler)
 	mainRouter.HandleFunc("/oauth/callback", oauthCallbackHandler(jwtManager))
+	if clientID, clientSecret := os.Getenv("INTROSPECTION_CLIENT_ID"), os.Getenv("INTROSPECTION_CLIENT_SECRET"); clientID != "" && clientSecret != "" {
+		mainRouter.HandleFunc("/auth/introspect", introspectHandler(jwtManager, tokenRegistry, clientID, clientSecret))
+	} else {
+		log.Println("INTROSPECTION_CLIENT_ID or INTROSPECTION_CLIENT_SECRET not set; /auth/introspect disabled")
+	}
+
+	// Authenticated Token Management Routes
+	mainRouter.Handle("/auth/logout", authenticate(jwtManager, tokenRegistry)(logoutHandler(tokenRegistry)))
+	mainRouter.Handle("/auth/revoke", authenticate(jwtManager, tokenRegistry)(revokeHandler(jwtManager, tokenRegistry)))
 
 	// Authenticated User Routes
 	userAPI := http.NewServeMux()
 	userAPI.HandleFunc("/posts", myPostsHandler)
-	mainRouter.Handle("/api/user/", http.StripPrefix("/api/user", authenticate(jwtManager)(userAPI)))
+	userAPI.HandleFunc("/posts/schedule", schedulePublishHandler)
+	mainRouter.Handle("/api/user/", http.StripPrefix("/api/user", authenticate(jwtManager, tokenRegistry)(userAPI)))
 
 	// Authenticated Admin Routes
 	adminAPI := http.NewServeMux()
 	adminAPI.HandleFunc("/stats", adminStatsHandler)
-	adminChain := authenticate(jwtManager)(requireRole(RoleAdmin)(adminAPI))
+	adminAPI.HandleFunc("/users/", adminUsersHandler(tokenRegistry))
+	adminAPI.HandleFunc("/audit", adminAuditHandler)
+	adminAPI.HandleFunc("/audit/export", adminAuditExportHandler)
+	adminAPI.HandleFunc("/audit/export/jobs/", adminAuditExportJobsHandler)
+	adminChain := authenticate(jwtManager, tokenRegistry)(requireRole(RoleAdmin)(adminAPI))
 	mainRouter.Handle("/api/admin/", http.StripPrefix("/api/admin", adminChain))
 
 	log.Println("Context-based server starting on :8082")
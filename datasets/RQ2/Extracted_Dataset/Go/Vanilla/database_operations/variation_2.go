@@ -1,15 +1,35 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io/fs"
 	"log"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"crypto/rand"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/hibiken/asynq"
+	"github.com/mattn/go-sqlite3"
 )
 
 // --- Domain Models & Enums ---
@@ -47,6 +67,15 @@ type Role struct {
 	Name RoleName
 }
 
+// Attachment is a file on a post; the bytes live in the BlobStore under
+// BlobKey.
+type Attachment struct {
+	ID        string
+	PostID    string
+	BlobKey   string
+	CreatedAt time.Time
+}
+
 // --- UUID Helper ---
 func generateUUID() string {
 	b := make([]byte, 16)
@@ -57,6 +86,268 @@ func generateUUID() string {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
 
+// --- Configuration ---
+
+// DBConfig is read from the environment by LoadDBConfig:
+//
+//	DB_PRIMARY_DSN          primary connection (default: in-memory SQLite)
+//	DB_REPLICA_DSNS         comma-separated replica connections (optional)
+//	DB_MAX_REPLICA_LAG      max staleness a replica may serve reads with (default 5s)
+//	DB_LAG_CHECK_INTERVAL   how often replica lag is measured (default 2s)
+//	DB_REPLICA_LAG_QUERY    query returning replica lag in seconds; when empty,
+//	                        replicas are only health-checked and assumed current
+//	DB_SLOW_QUERY_THRESHOLD statements at least this slow are logged and
+//	                        EXPLAINed (default 100ms)
+//	DB_LOG_QUERIES          set to 1 to log every statement, not just slow ones
+//	DB_TX_MAX_ATTEMPTS      tries per transaction on busy/serialization errors (default 5)
+//	DB_TX_RETRY_BUDGET      total time a transaction may spend backing off (default 2s)
+//	DB_QUERY_TIMEOUT        limit on each repository call (default 5s)
+//	DB_TX_TIMEOUT           limit on each transaction attempt (default 30s)
+//	DB_INTEGRITY_INTERVAL   how often the integrity job scans for orphans (default 1h)
+//	DB_INTEGRITY_REPAIR     set to 1 to delete orphans the job considers safe to drop
+//	ATTACHMENT_BLOB_DIR     where attachment blobs live; when empty, attachments
+//	                        are not checked for missing blobs
+type DBConfig struct {
+	PrimaryDSN         string
+	ReplicaDSNs        []string
+	MaxReplicaLag      time.Duration
+	LagCheckInterval   time.Duration
+	LagQuery           string
+	SlowQueryThreshold time.Duration
+	LogAllQueries      bool
+	TxRetry            TxRetryPolicy
+	Timeouts           StoreTimeouts
+	IntegrityInterval  time.Duration
+	IntegrityRepair    bool
+	BlobDir            string
+}
+
+func LoadDBConfig() (DBConfig, error) {
+	cfg := DBConfig{
+		PrimaryDSN:         ":memory:?_foreign_keys=on",
+		MaxReplicaLag:      5 * time.Second,
+		LagCheckInterval:   2 * time.Second,
+		LagQuery:           os.Getenv("DB_REPLICA_LAG_QUERY"),
+		SlowQueryThreshold: 100 * time.Millisecond,
+		LogAllQueries:      os.Getenv("DB_LOG_QUERIES") == "1",
+		TxRetry:            DefaultTxRetryPolicy(),
+		Timeouts:           DefaultStoreTimeouts(),
+		IntegrityInterval:  time.Hour,
+		IntegrityRepair:    os.Getenv("DB_INTEGRITY_REPAIR") == "1",
+		BlobDir:            os.Getenv("ATTACHMENT_BLOB_DIR"),
+	}
+	if v := os.Getenv("DB_PRIMARY_DSN"); v != "" {
+		cfg.PrimaryDSN = v
+	}
+	for _, dsn := range strings.Split(os.Getenv("DB_REPLICA_DSNS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			cfg.ReplicaDSNs = append(cfg.ReplicaDSNs, dsn)
+		}
+	}
+	for env, dst := range map[string]*time.Duration{
+		"DB_MAX_REPLICA_LAG":      &cfg.MaxReplicaLag,
+		"DB_LAG_CHECK_INTERVAL":   &cfg.LagCheckInterval,
+		"DB_SLOW_QUERY_THRESHOLD": &cfg.SlowQueryThreshold,
+		"DB_TX_RETRY_BUDGET":      &cfg.TxRetry.Budget,
+		"DB_QUERY_TIMEOUT":        &cfg.Timeouts.Query,
+		"DB_TX_TIMEOUT":           &cfg.Timeouts.Tx,
+		"DB_INTEGRITY_INTERVAL":   &cfg.IntegrityInterval,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return cfg, fmt.Errorf("%s must be a positive duration, got %q", env, v)
+			}
+			*dst = d
+		}
+	}
+	if v := os.Getenv("DB_TX_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("DB_TX_MAX_ATTEMPTS must be a positive integer, got %q", v)
+		}
+		cfg.TxRetry.MaxAttempts = n
+	}
+	return cfg, nil
+}
+
+// --- Read/Write Routing ---
+
+type primaryOnlyKey struct{}
+
+// WithPrimary makes reads on ctx go to the primary, for read-your-writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryOnlyKey{}, true)
+}
+
+type replica struct {
+	name string
+	db   *sql.DB
+
+	mu        sync.RWMutex
+	healthy   bool
+	lag       time.Duration
+	checkedAt time.Time
+	lastErr   error
+}
+
+// DBRouter is a Querier that sends writes to the primary and spreads reads
+// over replicas that are healthy and within the configured staleness. When
+// no replica qualifies, reads fall back to the primary.
+type DBRouter struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     uint32
+	cfg      DBConfig
+}
+
+func OpenDBRouter(driver string, cfg DBConfig) (*DBRouter, error) {
+	primary, err := sql.Open(driver, cfg.PrimaryDSN)
+	if err != nil {
+		return nil, fmt.Errorf("open primary: %w", err)
+	}
+	r := &DBRouter{primary: primary, cfg: cfg}
+	for i, dsn := range cfg.ReplicaDSNs {
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("open replica %d: %w", i, err)
+		}
+		r.replicas = append(r.replicas, &replica{name: fmt.Sprintf("replica-%d", i), db: db})
+	}
+	return r, nil
+}
+
+// Primary is the connection transactions and migrations must use.
+func (r *DBRouter) Primary() *sql.DB { return r.primary }
+
+func (r *DBRouter) Close() error {
+	err := r.primary.Close()
+	for _, rep := range r.replicas {
+		if cerr := rep.db.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// isReadOnly reports whether a statement may run on a replica. Anything it
+// does not recognise as a plain SELECT goes to the primary.
+func isReadOnly(query string) bool {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "SELECT") && !strings.Contains(q, "FOR UPDATE") && !strings.Contains(q, "FOR SHARE")
+}
+
+func (rep *replica) usable(maxLag, staleAfter time.Duration) bool {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+	return rep.healthy && rep.lag <= maxLag && time.Since(rep.checkedAt) <= staleAfter
+}
+
+// reader picks the connection for a read, round-robin over usable replicas.
+func (r *DBRouter) reader(ctx context.Context, query string) *sql.DB {
+	if len(r.replicas) == 0 || !isReadOnly(query) {
+		return r.primary
+	}
+	if primaryOnly, _ := ctx.Value(primaryOnlyKey{}).(bool); primaryOnly {
+		return r.primary
+	}
+	// A replica whose last check is this old is treated as unknown.
+	staleAfter := 3 * r.cfg.LagCheckInterval
+	start := atomic.AddUint32(&r.next, 1)
+	for i := 0; i < len(r.replicas); i++ {
+		rep := r.replicas[(int(start)+i)%len(r.replicas)]
+		if rep.usable(r.cfg.MaxReplicaLag, staleAfter) {
+			return rep.db
+		}
+	}
+	return r.primary
+}
+
+func (r *DBRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r *DBRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.reader(ctx, query).QueryContext(ctx, query, args...)
+}
+
+func (r *DBRouter) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.reader(ctx, query).QueryRowContext(ctx, query, args...)
+}
+
+func (r *DBRouter) checkReplica(ctx context.Context, rep *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.LagCheckInterval)
+	defer cancel()
+
+	var lag time.Duration
+	err := rep.db.PingContext(ctx)
+	if err == nil && r.cfg.LagQuery != "" {
+		var seconds float64
+		if err = rep.db.QueryRowContext(ctx, r.cfg.LagQuery).Scan(&seconds); err == nil {
+			lag = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	rep.mu.Lock()
+	wasHealthy := rep.healthy
+	rep.healthy, rep.lag, rep.checkedAt, rep.lastErr = err == nil, lag, time.Now(), err
+	rep.mu.Unlock()
+	if wasHealthy && err != nil {
+		log.Printf("Replica %s removed from rotation: %v", rep.name, err)
+	} else if !wasHealthy && err == nil {
+		log.Printf("Replica %s healthy (lag %s)", rep.name, lag)
+	}
+}
+
+// StartLagMonitor measures every replica now and then every LagCheckInterval
+// until ctx is cancelled.
+func (r *DBRouter) StartLagMonitor(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	check := func() {
+		for _, rep := range r.replicas {
+			r.checkReplica(ctx, rep)
+		}
+	}
+	check()
+	go func() {
+		ticker := time.NewTicker(r.cfg.LagCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+}
+
+type ReplicaStatus struct {
+	Name      string
+	Healthy   bool
+	Lag       time.Duration
+	CheckedAt time.Time
+	LastError string
+}
+
+func (r *DBRouter) ReplicaStatus() []ReplicaStatus {
+	out := make([]ReplicaStatus, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		rep.mu.RLock()
+		s := ReplicaStatus{Name: rep.name, Healthy: rep.healthy, Lag: rep.lag, CheckedAt: rep.checkedAt}
+		if rep.lastErr != nil {
+			s.LastError = rep.lastErr.Error()
+		}
+		rep.mu.RUnlock()
+		out = append(out, s)
+	}
+	return out
+}
+
 // --- Repository Layer ---
 
 type Querier interface {
@@ -69,216 +360,2338 @@ type UserRepository interface {
 	Create(ctx context.Context, q Querier, user *User) error
 	FindByID(ctx context.Context, q Querier, id string) (*User, error)
 	FindByFilter(ctx context.Context, q Querier, filter UserFilter) ([]User, error)
+	EachByFilter(ctx context.Context, q Querier, filter UserFilter, fn func(*User) error) error
 	AssignRole(ctx context.Context, q Querier, userID string, roleID int64) error
 	FindRolesByUserID(ctx context.Context, q Querier, userID string) ([]Role, error)
 }
 
-type PostRepository interface {
-	Create(ctx context.Context, q Querier, post *Post) error
-	FindByUserID(ctx context.Context, q Querier, userID string) ([]Post, error)
-}
+type PostRepository interface {
+	Create(ctx context.Context, q Querier, post *Post) error
+	FindByUserID(ctx context.Context, q Querier, userID string) ([]Post, error)
+}
+
+type RoleRepository interface {
+	FindOrCreateByName(ctx context.Context, q Querier, name RoleName) (*Role, error)
+}
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, q Querier, attachment *Attachment) error
+	FindByPostID(ctx context.Context, q Querier, postID string) ([]Attachment, error)
+}
+
+// --- Concrete Implementations ---
+
+type DBStore struct {
+	router   *DBRouter
+	jobs     TaskDispatcher
+	queries  *QueryLogger
+	Retry    TxRetryPolicy
+	Timeouts StoreTimeouts
+	txStats  txStats
+	UserRepository
+	PostRepository
+	RoleRepository
+	AttachmentRepository AttachmentRepository
+}
+
+// NewDBStore builds the store. queries may be nil to run statements unlogged.
+func NewDBStore(router *DBRouter, jobs TaskDispatcher, queries *QueryLogger) *DBStore {
+	s := &DBStore{
+		router:   router,
+		jobs:     jobs,
+		queries:  queries,
+		Retry:    DefaultTxRetryPolicy(),
+		Timeouts: DefaultStoreTimeouts(),
+	}
+	// The repositories share s.Timeouts, so changing it later applies to them.
+	s.UserRepository = &dbUserRepository{timeouts: &s.Timeouts}
+	s.PostRepository = &dbPostRepository{timeouts: &s.Timeouts}
+	s.RoleRepository = &dbRoleRepository{timeouts: &s.Timeouts}
+	s.AttachmentRepository = &dbAttachmentRepository{timeouts: &s.Timeouts}
+	return s
+}
+
+// DB is the Querier for work outside a transaction; reads may hit a replica.
+func (s *DBStore) DB() Querier { return s.queries.Wrap("db", s.router) }
+
+// WithTransaction provides a managed transaction. Transactions always run on
+// the primary, so reads inside fn see the transaction's own writes.
+//
+// A transaction that fails with a busy, locked or serialization error is
+// rolled back and fn is run again, so fn must do nothing besides its work on
+// q and buffered jobs.Enqueue calls. See TxRetryPolicy.
+//
+// Each attempt is limited to Timeouts.Tx. Once it runs out the transaction
+// is rolled back, its next statement fails and the result is ErrTimeout.
+func (s *DBStore) WithTransaction(ctx context.Context, fn func(q Querier) error) error {
+	return s.WithTransactionJobs(ctx, func(q Querier, _ *TxEnqueuer) error {
+		return fn(q)
+	})
+}
+
+// WithTransactionJobs is WithTransaction for work that also enqueues tasks.
+// Tasks enqueued on jobs are sent to asynq only once the transaction has
+// committed, and are dropped if it rolls back.
+func (s *DBStore) WithTransactionJobs(ctx context.Context, fn func(q Querier, jobs *TxEnqueuer) error) error {
+	atomic.AddInt64(&s.txStats.transactions, 1)
+	policy := s.Retry
+	deadline := time.Now().Add(policy.Budget)
+	delay := policy.BaseDelay
+	for attempt := 1; ; attempt++ {
+		jobs, err := s.runTransaction(ctx, fn)
+		if err == nil || !isRetryableTxError(err) {
+			if err == nil && attempt > 1 {
+				atomic.AddInt64(&s.txStats.recovered, 1)
+			}
+			return err
+		}
+		if jobs.sideEffects {
+			atomic.AddInt64(&s.txStats.unsafe, 1)
+			return fmt.Errorf("transaction not retried because it had side effects: %w", err)
+		}
+		wait := delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+		if attempt >= policy.MaxAttempts || time.Now().Add(wait).After(deadline) {
+			atomic.AddInt64(&s.txStats.exhausted, 1)
+			return fmt.Errorf("transaction failed after %d attempts: %w", attempt, err)
+		}
+		atomic.AddInt64(&s.txStats.retries, 1)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctxError(ctx, err)
+		}
+		if delay *= 2; delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+func (s *DBStore) runTransaction(ctx context.Context, fn func(q Querier, jobs *TxEnqueuer) error) (*TxEnqueuer, error) {
+	jobs := &TxEnqueuer{dispatcher: s.jobs}
+	// database/sql rolls tx back as soon as txCtx ends, whatever context fn
+	// passes to its statements.
+	txCtx, cancel := s.Timeouts.txContext(ctx)
+	defer cancel()
+	tx, err := s.router.Primary().BeginTx(txCtx, nil)
+	if err != nil {
+		return jobs, ctxError(txCtx, err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.queries.Wrap("tx", tx), jobs); err != nil {
+		jobs.discard()
+		return jobs, ctxError(txCtx, err)
+	}
+	if err := tx.Commit(); err != nil {
+		jobs.discard()
+		return jobs, ctxError(txCtx, err)
+	}
+	return jobs, jobs.flush(ctx)
+}
+
+// --- Transaction Retry ---
+
+// TxRetryPolicy bounds how WithTransactionJobs retries. Backoff starts at
+// BaseDelay and doubles up to MaxDelay, each wait jittered to between half
+// and all of it. No retry is started that would end after Budget.
+type TxRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Budget      time.Duration
+}
+
+func DefaultTxRetryPolicy() TxRetryPolicy {
+	return TxRetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 500 * time.Millisecond, Budget: 2 * time.Second}
+}
+
+// isRetryableTxError reports whether err means the transaction lost a race
+// and may succeed if run again: SQLite busy/locked, or a Postgres
+// serialization failure or deadlock. A commit whose enqueues failed is never
+// retried.
+func isRetryableTxError(err error) bool {
+	var enqueueErr *PostCommitEnqueueError
+	if errors.As(err, &enqueueErr) {
+		return false
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	// Both lib/pq and pgx errors expose the SQLSTATE this way.
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		switch pgErr.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+	return false
+}
+
+type txStats struct {
+	transactions int64
+	retries      int64
+	recovered    int64
+	exhausted    int64
+	unsafe       int64
+}
+
+// TxStats counts transactions since startup. Recovered transactions
+// committed after at least one retry; Exhausted ran out of attempts or
+// budget; Unsafe failed with a retryable error but had side effects.
+type TxStats struct {
+	Transactions int64 `json:"transactions"`
+	Retries      int64 `json:"retries"`
+	Recovered    int64 `json:"recovered"`
+	Exhausted    int64 `json:"exhausted"`
+	Unsafe       int64 `json:"unsafe"`
+}
+
+func (s *DBStore) TxStats() TxStats {
+	return TxStats{
+		Transactions: atomic.LoadInt64(&s.txStats.transactions),
+		Retries:      atomic.LoadInt64(&s.txStats.retries),
+		Recovered:    atomic.LoadInt64(&s.txStats.recovered),
+		Exhausted:    atomic.LoadInt64(&s.txStats.exhausted),
+		Unsafe:       atomic.LoadInt64(&s.txStats.unsafe),
+	}
+}
+
+func txStatsHandler(s *DBStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": s.TxStats()})
+	}
+}
+
+// --- Cancellation & Timeouts ---
+
+var (
+	ErrCanceled = errors.New("database operation canceled")
+	ErrTimeout  = errors.New("database operation timed out")
+)
+
+// StatusClientClosedRequest is nginx's status for a client that hung up
+// before the response; net/http has no constant for it.
+const StatusClientClosedRequest = 499
+
+// StoreTimeouts limit how long the store lets work run, on top of whatever
+// deadline the caller's context already has. Query applies to each
+// repository call, including iterating its rows; Tx to each transaction
+// attempt. Zero means no limit.
+type StoreTimeouts struct {
+	Query time.Duration
+	Tx    time.Duration
+}
+
+func DefaultStoreTimeouts() StoreTimeouts {
+	return StoreTimeouts{Query: 5 * time.Second, Tx: 30 * time.Second}
+}
+
+func (t *StoreTimeouts) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t == nil || t.Query <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, t.Query)
+}
+
+func (t *StoreTimeouts) txContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t == nil || t.Tx <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, t.Tx)
+}
+
+// ctxError reports err as ErrCanceled or ErrTimeout when ctx has ended, since
+// drivers surface that as anything from context.Canceled to "interrupted" or
+// sql.ErrTxDone. Other errors are returned unchanged.
+func ctxError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrCanceled) || errors.Is(err, ErrTimeout) {
+		return err
+	}
+	switch ctx.Err() {
+	case context.Canceled:
+		return fmt.Errorf("%w: %v", ErrCanceled, err)
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return err
+}
+
+// writeStoreError answers 499 when the client went away, 504 when a store
+// timeout ran out and 500, logged as "<action> failed", for anything else.
+func writeStoreError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, ErrCanceled):
+		w.WriteHeader(StatusClientClosedRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "request canceled"})
+	case errors.Is(err, ErrTimeout):
+		log.Printf("%s timed out: %v", action, err)
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(map[string]string{"error": "database timeout"})
+	default:
+		log.Printf("%s failed: %v", action, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "internal error"})
+	}
+}
+
+// --- Transactional Enqueue ---
+
+// TaskDispatcher is the part of *asynq.Client the store needs.
+type TaskDispatcher interface {
+	EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error)
+}
+
+type bufferedTask struct {
+	task *asynq.Task
+	opts []asynq.Option
+}
+
+// TxEnqueuer collects tasks enqueued inside a transaction. Options such as
+// asynq.ProcessIn are applied at dispatch time, i.e. relative to the commit.
+type TxEnqueuer struct {
+	dispatcher  TaskDispatcher
+	mu          sync.Mutex
+	pending     []bufferedTask
+	done        bool
+	sideEffects bool
+}
+
+// ErrTxEnqueuerDone is returned by Enqueue once the transaction it belongs to
+// has committed or rolled back, e.g. when a closure kept the enqueuer.
+var ErrTxEnqueuerDone = errors.New("transaction already finished; task not enqueued")
+
+// Enqueue buffers task until the transaction commits.
+func (e *TxEnqueuer) Enqueue(task *asynq.Task, opts ...asynq.Option) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done {
+		return ErrTxEnqueuerDone
+	}
+	e.pending = append(e.pending, bufferedTask{task: task, opts: opts})
+	return nil
+}
+
+// EnqueueNow dispatches task immediately, regardless of whether the
+// transaction later commits. Use it only for tasks that are safe to run
+// against data the transaction may never write, e.g. notifications about
+// the attempt itself. It marks the transaction as having side effects.
+func (e *TxEnqueuer) EnqueueNow(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	e.MarkSideEffect()
+	return e.dispatcher.EnqueueContext(ctx, task, opts...)
+}
+
+// MarkSideEffect records that the transaction did something outside the
+// database that would be repeated if it ran again, which rules out retries.
+func (e *TxEnqueuer) MarkSideEffect() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sideEffects = true
+}
+
+// Pending reports how many tasks are waiting for the commit.
+func (e *TxEnqueuer) Pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.pending)
+}
+
+func (e *TxEnqueuer) discard() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending, e.done = nil, true
+}
+
+// flush dispatches the buffered tasks in order. A failure does not stop the
+// remaining tasks, since the data they refer to is already committed.
+func (e *TxEnqueuer) flush(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.pending
+	e.pending, e.done = nil, true
+	e.mu.Unlock()
+
+	var failed []string
+	var firstErr error
+	for _, p := range pending {
+		if _, err := e.dispatcher.EnqueueContext(ctx, p.task, p.opts...); err != nil {
+			log.Printf("Enqueue of %s after commit failed: %v", p.task.Type(), err)
+			failed = append(failed, p.task.Type())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &PostCommitEnqueueError{TaskTypes: failed, Err: firstErr}
+	}
+	return nil
+}
+
+// PostCommitEnqueueError means the transaction committed but some of its
+// tasks could not be enqueued. Callers must not treat it as a rollback.
+type PostCommitEnqueueError struct {
+	TaskTypes []string
+	Err       error
+}
+
+func (e *PostCommitEnqueueError) Error() string {
+	return fmt.Sprintf("transaction committed but %d task(s) failed to enqueue (%s): %v",
+		len(e.TaskTypes), strings.Join(e.TaskTypes, ", "), e.Err)
+}
+
+func (e *PostCommitEnqueueError) Unwrap() error { return e.Err }
+
+// logDispatcher stands in for an asynq client when REDIS_ADDR is not set.
+type logDispatcher struct{}
+
+func (logDispatcher) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	log.Printf("Enqueued %s %s", task.Type(), task.Payload())
+	return &asynq.TaskInfo{ID: generateUUID(), Type: task.Type(), Payload: task.Payload()}, nil
+}
+
+// --- Query Logging & Slow Query Analysis ---
+
+// QueryStats describes one statement. Rows is rows affected for Exec. For
+// queries it is -1: rows are only known once the caller has iterated them,
+// so Duration also only covers execution up to the first row.
+type QueryStats struct {
+	Target   string
+	Query    string
+	Args     []string // redacted
+	Duration time.Duration
+	Rows     int64
+	Err      error
+}
+
+// redactArgs keeps the shape of bind arguments without their values. Only
+// NULLs, booleans and numbers are shown as-is.
+func redactArgs(args []interface{}) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case nil:
+			out[i] = "NULL"
+		case bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+			out[i] = fmt.Sprint(v)
+		case string:
+			out[i] = fmt.Sprintf("<string len=%d>", len(v))
+		case []byte:
+			out[i] = fmt.Sprintf("<bytes len=%d>", len(v))
+		default:
+			out[i] = fmt.Sprintf("<%T>", v)
+		}
+	}
+	return out
+}
+
+// QueryLogger logs statements run through the Queriers it wraps and hands
+// those at or above Threshold to Analyzer.
+type QueryLogger struct {
+	Threshold time.Duration
+	LogAll    bool
+	Analyzer  *SlowQueryAnalyzer // nil: slow queries are only logged
+}
+
+// Wrap returns q with logging. A nil QueryLogger returns q unchanged.
+func (l *QueryLogger) Wrap(target string, q Querier) Querier {
+	if l == nil {
+		return q
+	}
+	return &loggedQuerier{next: q, target: target, logger: l}
+}
+
+func (l *QueryLogger) observe(target, query string, args []interface{}, start time.Time, rows int64, err error) {
+	s := QueryStats{Target: target, Query: query, Args: redactArgs(args), Duration: time.Since(start), Rows: rows, Err: err}
+	slow := s.Duration >= l.Threshold
+	if slow || l.LogAll {
+		prefix := "SQL"
+		if slow {
+			prefix = "SLOW SQL"
+		}
+		log.Printf("%s [%s] %s rows=%d args=%v err=%v: %s", prefix, s.Target, s.Duration, s.Rows, s.Args, s.Err, strings.Join(strings.Fields(s.Query), " "))
+	}
+	if slow && l.Analyzer != nil {
+		l.Analyzer.submit(s, args)
+	}
+}
+
+type loggedQuerier struct {
+	next   Querier
+	target string
+	logger *QueryLogger
+}
+
+func (q *loggedQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := q.next.ExecContext(ctx, query, args...)
+	rows := int64(-1)
+	if err == nil {
+		if n, rerr := res.RowsAffected(); rerr == nil {
+			rows = n
+		}
+	}
+	q.logger.observe(q.target, query, args, start, rows, err)
+	return res, err
+}
+
+func (q *loggedQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := q.next.QueryContext(ctx, query, args...)
+	q.logger.observe(q.target, query, args, start, -1, err)
+	return rows, err
+}
+
+// QueryRowContext errors surface on Scan, so they are not seen here.
+func (q *loggedQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := q.next.QueryRowContext(ctx, query, args...)
+	q.logger.observe(q.target, query, args, start, -1, nil)
+	return row
+}
+
+type slowQuery struct {
+	stats   QueryStats
+	args    []interface{}
+	flushed chan struct{} // set on Flush markers only
+}
+
+// SlowQueryAnalyzer stores each slow statement in the slow_queries table
+// together with its EXPLAIN QUERY PLAN. It works off a queue on its own
+// goroutine, so a slow statement inside a transaction is analysed after the
+// fact rather than holding the transaction open. A given statement is
+// re-EXPLAINed at most once per cooldown.
+type SlowQueryAnalyzer struct {
+	db       *sql.DB
+	queue    chan slowQuery
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	explained map[string]time.Time
+}
+
+func NewSlowQueryAnalyzer(db *sql.DB, cooldown time.Duration) *SlowQueryAnalyzer {
+	return &SlowQueryAnalyzer{db: db, queue: make(chan slowQuery, 256), cooldown: cooldown, explained: make(map[string]time.Time)}
+}
+
+func (a *SlowQueryAnalyzer) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sq := <-a.queue:
+				if sq.flushed != nil {
+					close(sq.flushed)
+					continue
+				}
+				if err := a.record(ctx, sq); err != nil {
+					log.Printf("Slow query analysis failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// submit drops the sample when the queue is full; diagnostics must never
+// slow the statement being diagnosed.
+func (a *SlowQueryAnalyzer) submit(s QueryStats, args []interface{}) {
+	select {
+	case a.queue <- slowQuery{stats: s, args: args}:
+	default:
+		log.Printf("Slow query queue full; dropped sample for %s", fingerprint(s.Query))
+	}
+}
+
+// Flush waits until everything submitted so far has been recorded.
+func (a *SlowQueryAnalyzer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case a.queue <- slowQuery{flushed: done}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fingerprint identifies a statement independent of whitespace and case.
+// Statements are parameterised, so values never reach it.
+func fingerprint(query string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(query), " "))))
+	return hex.EncodeToString(sum[:8])
+}
+
+func explainable(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "WITH":
+		return true
+	}
+	return false
+}
+
+func (a *SlowQueryAnalyzer) dueForExplain(fp string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.explained[fp]; ok && now.Sub(last) < a.cooldown {
+		return false
+	}
+	a.explained[fp] = now
+	return true
+}
+
+// explain renders SQLite's plan as an indented tree, one step per line.
+func (a *SlowQueryAnalyzer) explain(ctx context.Context, query string, args []interface{}) (string, error) {
+	rows, err := a.db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	depth := map[int]int{0: -1}
+	var b strings.Builder
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return "", ctxError(ctx, err)
+		}
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			return "", err
+		}
+		depth[id] = depth[parent] + 1
+		b.WriteString(strings.Repeat("  ", depth[id]) + detail + "\n")
+	}
+	return b.String(), ctxError(ctx, rows.Err())
+}
+
+func (a *SlowQueryAnalyzer) record(ctx context.Context, sq slowQuery) error {
+	now := time.Now()
+	fp := fingerprint(sq.stats.Query)
+	var plan string
+	if explainable(sq.stats.Query) && a.dueForExplain(fp, now) {
+		p, err := a.explain(ctx, sq.stats.Query, sq.args)
+		if err != nil {
+			plan = "EXPLAIN failed: " + err.Error()
+		} else {
+			plan = p
+		}
+	}
+	args, _ := json.Marshal(sq.stats.Args)
+	_, err := a.db.ExecContext(ctx,
+		"INSERT INTO slow_queries (fingerprint, query, args, target, duration_ms, row_count, plan, occurred_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		fp, sq.stats.Query, string(args), sq.stats.Target, float64(sq.stats.Duration.Microseconds())/1000, sq.stats.Rows, plan, now.UnixMilli())
+	return err
+}
+
+type SlowQuerySummary struct {
+	Fingerprint string    `json:"fingerprint"`
+	Query       string    `json:"query"`
+	Plan        string    `json:"plan"`
+	Count       int       `json:"count"`
+	MaxMs       float64   `json:"max_ms"`
+	AvgMs       float64   `json:"avg_ms"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// TopSlowQueries groups recorded samples by statement, slowest first, with
+// the most recent plan captured for each.
+func (a *SlowQueryAnalyzer) TopSlowQueries(ctx context.Context, limit int) ([]SlowQuerySummary, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT s.fingerprint, MAX(s.query), COUNT(*), MAX(s.duration_ms), AVG(s.duration_ms), MAX(s.occurred_at),
+			COALESCE((SELECT p.plan FROM slow_queries p WHERE p.fingerprint = s.fingerprint AND p.plan != '' ORDER BY p.occurred_at DESC LIMIT 1), '')
+		FROM slow_queries s
+		GROUP BY s.fingerprint
+		ORDER BY MAX(s.duration_ms) DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	defer rows.Close()
+	out := []SlowQuerySummary{}
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		var s SlowQuerySummary
+		var lastSeen int64
+		if err := rows.Scan(&s.Fingerprint, &s.Query, &s.Count, &s.MaxMs, &s.AvgMs, &lastSeen, &s.Plan); err != nil {
+			return nil, err
+		}
+		s.LastSeen = time.UnixMilli(lastSeen).UTC()
+		out = append(out, s)
+	}
+	return out, ctxError(ctx, rows.Err())
+}
+
+// slowQueriesHandler serves GET /admin/db/slow-queries?limit=20.
+func slowQueriesHandler(a *SlowQueryAnalyzer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 100 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "limit must be between 1 and 100"})
+				return
+			}
+			limit = n
+		}
+		top, err := a.TopSlowQueries(r.Context(), limit)
+		if err != nil {
+			writeStoreError(w, "Listing slow queries", err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": top})
+	}
+}
+
+// --- Data Integrity ---
+
+type IntegritySeverity string
+
+const (
+	SeverityInfo    IntegritySeverity = "info"
+	SeverityWarning IntegritySeverity = "warning"
+	SeverityError   IntegritySeverity = "error"
+)
+
+// BlobStore is what the integrity job needs from attachment storage.
+type BlobStore interface {
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// dirBlobStore keeps each blob as a file named by its key under a directory.
+type dirBlobStore string
+
+func (d dirBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(filepath.Join(string(d), filepath.Clean("/"+key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type orphan struct {
+	key    string
+	detail string
+}
+
+// integrityCheck finds one kind of orphan. repair deletes a single orphan by
+// its key and repeats the orphan condition, so a row that gained its parent
+// since the scan is left alone. It is empty where deleting is not safe.
+type integrityCheck struct {
+	name     string
+	severity IntegritySeverity
+	find     func(ctx context.Context) ([]orphan, error)
+	repair   string
+}
+
+// IntegrityChecker scans for rows whose parent is gone. Foreign keys are on
+// for this service's own connections, but not for every SQLite client, so
+// orphans still turn up after manual edits or restores. Findings are kept in
+// integrity_issues, one row per orphan, and are resolved once a later run no
+// longer sees them.
+type IntegrityChecker struct {
+	db         *sql.DB
+	blobs      BlobStore // nil: attachments are not checked
+	AutoRepair bool
+
+	mu   sync.Mutex
+	last *IntegrityReport
+}
+
+func NewIntegrityChecker(db *sql.DB, blobs BlobStore, autoRepair bool) *IntegrityChecker {
+	return &IntegrityChecker{db: db, blobs: blobs, AutoRepair: autoRepair}
+}
+
+type IntegrityReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	AutoRepair bool           `json:"auto_repair"`
+	Found      map[string]int `json:"found"`
+	Repaired   map[string]int `json:"repaired"`
+	Errors     []string       `json:"errors,omitempty"`
+}
+
+// Start runs a scan every interval until ctx is cancelled.
+func (c *IntegrityChecker) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report := c.Run(ctx)
+				log.Printf("Integrity scan: found %v, repaired %v, %d errors", report.Found, report.Repaired, len(report.Errors))
+			}
+		}
+	}()
+}
+
+func (c *IntegrityChecker) checks() []integrityCheck {
+	checks := []integrityCheck{
+		{
+			name:     "post_without_user",
+			severity: SeverityWarning,
+			find: c.findSQL(`SELECT p.id, 'user ' || p.user_id FROM posts p
+				LEFT JOIN users u ON u.id = p.user_id WHERE u.id IS NULL`),
+			repair: `DELETE FROM posts WHERE id = ?
+				AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = posts.user_id)`,
+		},
+		{
+			name:     "user_role_without_role",
+			severity: SeverityInfo,
+			find: c.findSQL(`SELECT ur.user_id || ':' || ur.role_id, 'role ' || ur.role_id FROM user_roles ur
+				LEFT JOIN roles r ON r.id = ur.role_id WHERE r.id IS NULL`),
+			repair: `DELETE FROM user_roles WHERE user_id || ':' || role_id = ?
+				AND NOT EXISTS (SELECT 1 FROM roles r WHERE r.id = user_roles.role_id)`,
+		},
+	}
+	if c.blobs != nil {
+		// The blob may only be unreachable for now, and deleting the row
+		// loses the key needed to restore it, so this one is never repaired.
+		checks = append(checks, integrityCheck{
+			name:     "attachment_without_blob",
+			severity: SeverityError,
+			find:     c.findMissingBlobs,
+		})
+	}
+	return checks
+}
+
+// findSQL returns a finder for a query selecting (row key, detail).
+func (c *IntegrityChecker) findSQL(query string) func(ctx context.Context) ([]orphan, error) {
+	return func(ctx context.Context) ([]orphan, error) {
+		rows, err := c.db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		defer rows.Close()
+		var out []orphan
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				return nil, ctxError(ctx, err)
+			}
+			var o orphan
+			if err := rows.Scan(&o.key, &o.detail); err != nil {
+				return nil, err
+			}
+			out = append(out, o)
+		}
+		return out, ctxError(ctx, rows.Err())
+	}
+}
+
+func (c *IntegrityChecker) findMissingBlobs(ctx context.Context) ([]orphan, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT id, blob_key FROM attachments")
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	var attachments []orphan
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			rows.Close()
+			return nil, ctxError(ctx, err)
+		}
+		var o orphan
+		if err := rows.Scan(&o.key, &o.detail); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attachments = append(attachments, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	// Stat blobs only after the rows are closed, so a slow store does not
+	// hold a connection.
+	var out []orphan
+	for _, a := range attachments {
+		if err := ctx.Err(); err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		ok, err := c.blobs.Exists(ctx, a.detail)
+		if err != nil {
+			return nil, fmt.Errorf("blob %s: %w", a.detail, err)
+		}
+		if !ok {
+			out = append(out, orphan{key: a.key, detail: "blob " + a.detail})
+		}
+	}
+	return out, nil
+}
+
+// Run scans once and records the findings. A check that fails is reported
+// and leaves its existing issues untouched.
+func (c *IntegrityChecker) Run(ctx context.Context) IntegrityReport {
+	report := IntegrityReport{StartedAt: time.Now().UTC(), AutoRepair: c.AutoRepair, Found: map[string]int{}, Repaired: map[string]int{}}
+	for _, check := range c.checks() {
+		found, repaired, err := c.runCheck(ctx, check, report.StartedAt)
+		report.Found[check.name] = found
+		report.Repaired[check.name] = repaired
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", check.name, err))
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+	c.mu.Lock()
+	c.last = &report
+	c.mu.Unlock()
+	return report
+}
+
+func (c *IntegrityChecker) runCheck(ctx context.Context, check integrityCheck, now time.Time) (found, repaired int, err error) {
+	orphans, err := check.find(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	ts := now.UnixMilli()
+	for _, o := range orphans {
+		if err := ctx.Err(); err != nil {
+			return len(orphans), repaired, ctxError(ctx, err)
+		}
+		_, err := c.db.ExecContext(ctx, `
+			INSERT INTO integrity_issues (check_name, severity, row_key, detail, first_seen_at, last_seen_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (check_name, row_key) DO UPDATE SET
+				severity = excluded.severity, detail = excluded.detail, last_seen_at = excluded.last_seen_at,
+				resolved_at = NULL, repaired = 0`,
+			check.name, check.severity, o.key, o.detail, ts, ts)
+		if err != nil {
+			return len(orphans), repaired, err
+		}
+		if !c.AutoRepair || check.repair == "" {
+			continue
+		}
+		res, err := c.db.ExecContext(ctx, check.repair, o.key)
+		if err != nil {
+			return len(orphans), repaired, fmt.Errorf("repair %s: %w", o.key, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			repaired++
+			c.db.ExecContext(ctx, "UPDATE integrity_issues SET repaired = 1, resolved_at = ? WHERE check_name = ? AND row_key = ?", ts, check.name, o.key)
+		}
+	}
+	// Whatever this run did not see again has been fixed some other way.
+	_, err = c.db.ExecContext(ctx, "UPDATE integrity_issues SET resolved_at = ? WHERE check_name = ? AND resolved_at IS NULL AND last_seen_at < ?", ts, check.name, ts)
+	return len(orphans), repaired, err
+}
+
+// LastReport is the most recent scan, or nil before the first one.
+func (c *IntegrityChecker) LastReport() *IntegrityReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+type IntegrityIssue struct {
+	Check      string            `json:"check"`
+	Severity   IntegritySeverity `json:"severity"`
+	RowKey     string            `json:"row_key"`
+	Detail     string            `json:"detail"`
+	FirstSeen  time.Time         `json:"first_seen_at"`
+	LastSeen   time.Time         `json:"last_seen_at"`
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"`
+	Repaired   bool              `json:"repaired"`
+}
+
+// Issues lists recorded issues, newest first. Resolved ones are included
+// only when resolved is true; severity filters when non-empty.
+func (c *IntegrityChecker) Issues(ctx context.Context, severity IntegritySeverity, resolved bool, limit int) ([]IntegrityIssue, error) {
+	query := "SELECT check_name, severity, row_key, detail, first_seen_at, last_seen_at, resolved_at, repaired FROM integrity_issues WHERE 1 = 1"
+	var args []interface{}
+	if !resolved {
+		query += " AND resolved_at IS NULL"
+	}
+	if severity != "" {
+		query += " AND severity = ?"
+		args = append(args, severity)
+	}
+	query += " ORDER BY last_seen_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	defer rows.Close()
+	out := []IntegrityIssue{}
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		var i IntegrityIssue
+		var first, last int64
+		var resolvedAt sql.NullInt64
+		if err := rows.Scan(&i.Check, &i.Severity, &i.RowKey, &i.Detail, &first, &last, &resolvedAt, &i.Repaired); err != nil {
+			return nil, err
+		}
+		i.FirstSeen = time.UnixMilli(first).UTC()
+		i.LastSeen = time.UnixMilli(last).UTC()
+		if resolvedAt.Valid {
+			t := time.UnixMilli(resolvedAt.Int64).UTC()
+			i.ResolvedAt = &t
+		}
+		out = append(out, i)
+	}
+	return out, ctxError(ctx, rows.Err())
+}
+
+// integrityHandler serves GET /admin/integrity?severity=error&resolved=1&limit=50.
+func integrityHandler(c *IntegrityChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		severity := IntegritySeverity(r.URL.Query().Get("severity"))
+		switch severity {
+		case "", SeverityInfo, SeverityWarning, SeverityError:
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "severity must be info, warning or error"})
+			return
+		}
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 500 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "limit must be between 1 and 500"})
+				return
+			}
+			limit = n
+		}
+		issues, err := c.Issues(r.Context(), severity, r.URL.Query().Get("resolved") == "1", limit)
+		if err != nil {
+			writeStoreError(w, "Listing integrity issues", err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"last_run": c.LastReport(), "issues": issues}})
+	}
+}
+
+// --- User Repository ---
+// Repository calls run under Timeouts.Query and check ctx between rows, so a
+// scan stops at the next row once its caller is gone rather than reading to
+// the end. Cancellation and timeouts come back as ErrCanceled / ErrTimeout.
+type dbUserRepository struct{ timeouts *StoreTimeouts }
+
+type UserFilter struct {
+	IsActive  *bool
+	EmailLike *string
+}
+
+func (r *dbUserRepository) Create(ctx context.Context, q Querier, user *User) error {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	user.ID = generateUUID()
+	user.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO users (id, email, password_hash, is_active, created_at) VALUES (?, ?, ?, ?, ?)"
+	_, err := q.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.IsActive, user.CreatedAt)
+	return ctxError(ctx, err)
+}
+
+func (r *dbUserRepository) FindByID(ctx context.Context, q Querier, id string) (*User, error) {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	query := "SELECT id, email, password_hash, is_active, created_at FROM users WHERE id = ?"
+	row := q.QueryRowContext(ctx, query, id)
+	var u User
+	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.IsActive, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user with id %s not found", id)
+	}
+	return &u, ctxError(ctx, err)
+}
+
+func (r *dbUserRepository) FindByFilter(ctx context.Context, q Querier, filter UserFilter) ([]User, error) {
+	var users []User
+	err := r.EachByFilter(ctx, q, filter, func(u *User) error {
+		users = append(users, *u)
+		return nil
+	})
+	return users, err
+}
+
+// EachByFilter streams matching users to fn without holding them all in
+// memory. An error from fn stops the scan and is returned as is.
+func (r *dbUserRepository) EachByFilter(ctx context.Context, q Querier, filter UserFilter, fn func(*User) error) error {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	var args []interface{}
+	var conditions []string
+
+	if filter.IsActive != nil {
+		conditions = append(conditions, "is_active = ?")
+		args = append(args, *filter.IsActive)
+	}
+	if filter.EmailLike != nil {
+		conditions = append(conditions, "email LIKE ?")
+		args = append(args, *filter.EmailLike)
+	}
+
+	query := "SELECT id, email, password_hash, is_active, created_at FROM users"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ctxError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return ctxError(ctx, err)
+		}
+		var u User
+		if err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.IsActive, &u.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(&u); err != nil {
+			return err
+		}
+	}
+	return ctxError(ctx, rows.Err())
+}
+
+func (r *dbUserRepository) AssignRole(ctx context.Context, q Querier, userID string, roleID int64) error {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	query := "INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)"
+	_, err := q.ExecContext(ctx, query, userID, roleID)
+	return ctxError(ctx, err)
+}
+
+func (r *dbUserRepository) FindRolesByUserID(ctx context.Context, q Querier, userID string) ([]Role, error) {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	query := `SELECT r.id, r.name FROM roles r JOIN user_roles ur ON r.id = ur.role_id WHERE ur.user_id = ?`
+	rows, err := q.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	defer rows.Close()
+	var roles []Role
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, ctxError(ctx, rows.Err())
+}
+
+// --- Post Repository ---
+type dbPostRepository struct{ timeouts *StoreTimeouts }
+
+func (r *dbPostRepository) Create(ctx context.Context, q Querier, post *Post) error {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	post.ID = generateUUID()
+	query := "INSERT INTO posts (id, user_id, title, content, status) VALUES (?, ?, ?, ?, ?)"
+	_, err := q.ExecContext(ctx, query, post.ID, post.UserID, post.Title, post.Content, post.Status)
+	return ctxError(ctx, err)
+}
+
+func (r *dbPostRepository) FindByUserID(ctx context.Context, q Querier, userID string) ([]Post, error) {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	query := "SELECT id, user_id, title, content, status FROM posts WHERE user_id = ?"
+	rows, err := q.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		var p Post
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.Status); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, ctxError(ctx, rows.Err())
+}
+
+// --- Role Repository ---
+type dbRoleRepository struct{ timeouts *StoreTimeouts }
+
+func (r *dbRoleRepository) FindOrCreateByName(ctx context.Context, q Querier, name RoleName) (*Role, error) {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	var role Role
+	query := "SELECT id, name FROM roles WHERE name = ?"
+	err := q.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name)
+	if err == sql.ErrNoRows {
+		res, err := q.ExecContext(ctx, "INSERT INTO roles (name) VALUES (?)", name)
+		if err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		id, _ := res.LastInsertId()
+		return &Role{ID: id, Name: name}, nil
+	}
+	return &role, ctxError(ctx, err)
+}
+
+// --- Attachment Repository ---
+type dbAttachmentRepository struct{ timeouts *StoreTimeouts }
+
+// Create records an attachment whose blob is already stored.
+func (r *dbAttachmentRepository) Create(ctx context.Context, q Querier, a *Attachment) error {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	a.ID = generateUUID()
+	a.CreatedAt = time.Now().UTC()
+	query := "INSERT INTO attachments (id, post_id, blob_key, created_at) VALUES (?, ?, ?, ?)"
+	_, err := q.ExecContext(ctx, query, a.ID, a.PostID, a.BlobKey, a.CreatedAt)
+	return ctxError(ctx, err)
+}
+
+func (r *dbAttachmentRepository) FindByPostID(ctx context.Context, q Querier, postID string) ([]Attachment, error) {
+	ctx, cancel := r.timeouts.queryContext(ctx)
+	defer cancel()
+	query := "SELECT id, post_id, blob_key, created_at FROM attachments WHERE post_id = ? ORDER BY created_at, id"
+	rows, err := q.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	defer rows.Close()
+	var out []Attachment
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, ctxError(ctx, err)
+		}
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.PostID, &a.BlobKey, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, ctxError(ctx, rows.Err())
+}
+
+// --- User Provisioning ---
+
+var (
+	ErrInvalidProvisioning = errors.New("invalid user")
+	ErrEmailTaken          = errors.New("email already registered")
+	ErrPrivilegedRole      = errors.New("only an admin may grant the ADMIN role")
+)
+
+// NewUserSpec describes a user to create together with their roles and a
+// first draft post.
+type NewUserSpec struct {
+	Email     string     `json:"email"`
+	Password  string     `json:"password"`
+	Roles     []RoleName `json:"roles"`
+	PostTitle string     `json:"post_title"`
+	PostBody  string     `json:"post_content"`
+}
+
+type FullUser struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+	Roles     []RoleName `json:"roles"`
+	Posts     []FullPost `json:"posts"`
+}
+
+type FullPost struct {
+	ID      string     `json:"id"`
+	Title   string     `json:"title"`
+	Content string     `json:"content"`
+	Status  PostStatus `json:"status"`
+}
+
+func (spec *NewUserSpec) validate() error {
+	spec.Email = strings.ToLower(strings.TrimSpace(spec.Email))
+	if !strings.Contains(spec.Email, "@") {
+		return fmt.Errorf("%w: email is required", ErrInvalidProvisioning)
+	}
+	if len(spec.Password) < 8 {
+		return fmt.Errorf("%w: password must be at least 8 characters", ErrInvalidProvisioning)
+	}
+	if len(spec.Roles) == 0 {
+		spec.Roles = []RoleName{UserRole}
+	}
+	for _, r := range spec.Roles {
+		if r != AdminRole && r != UserRole {
+			return fmt.Errorf("%w: unknown role %q", ErrInvalidProvisioning, r)
+		}
+	}
+	if spec.PostTitle == "" {
+		spec.PostTitle = "My first post"
+	}
+	return nil
+}
+
+func (spec *NewUserSpec) privileged() bool {
+	for _, r := range spec.Roles {
+		if r == AdminRole {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateFullUser creates the user, their roles and a draft post in one
+// transaction and reads the result back inside it. The welcome email is
+// buffered on the TxEnqueuer, so it is only sent if all of it commits.
+// A *PostCommitEnqueueError means the user exists but the email is not
+// queued.
+func (s *DBStore) CreateFullUser(ctx context.Context, spec NewUserSpec) (*FullUser, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(spec.Password)) // use bcrypt in production
+	var full *FullUser
+	err := s.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
+		user := &User{Email: spec.Email, PasswordHash: hex.EncodeToString(sum[:]), IsActive: true}
+		if err := s.UserRepository.Create(ctx, q, user); err != nil {
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+				return ErrEmailTaken
+			}
+			return err
+		}
+		for _, name := range spec.Roles {
+			role, err := s.RoleRepository.FindOrCreateByName(ctx, q, name)
+			if err != nil {
+				return err
+			}
+			if err := s.UserRepository.AssignRole(ctx, q, user.ID, role.ID); err != nil {
+				return err
+			}
+		}
+		post := &Post{UserID: user.ID, Title: spec.PostTitle, Content: spec.PostBody, Status: DraftStatus}
+		if err := s.PostRepository.Create(ctx, q, post); err != nil {
+			return err
+		}
+
+		full = &FullUser{ID: user.ID, Email: user.Email, IsActive: user.IsActive, CreatedAt: user.CreatedAt}
+		roles, err := s.UserRepository.FindRolesByUserID(ctx, q, user.ID)
+		if err != nil {
+			return err
+		}
+		for _, r := range roles {
+			full.Roles = append(full.Roles, r.Name)
+		}
+		posts, err := s.PostRepository.FindByUserID(ctx, q, user.ID)
+		if err != nil {
+			return err
+		}
+		for _, p := range posts {
+			full.Posts = append(full.Posts, FullPost{ID: p.ID, Title: p.Title, Content: p.Content, Status: p.Status})
+		}
+
+		payload, _ := json.Marshal(map[string]string{"user_id": user.ID})
+		return jobs.Enqueue(asynq.NewTask("email:welcome", payload))
+	})
+	var enqueueErr *PostCommitEnqueueError
+	if err != nil && !errors.As(err, &enqueueErr) {
+		return nil, err
+	}
+	return full, err
+}
+
+// adminUser returns the active user named by r's HTTP Basic credentials if
+// they are right and the user holds the ADMIN role, and nil otherwise.
+func adminUser(store *DBStore, r *http.Request) (*User, error) {
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	active := true
+	users, err := store.UserRepository.FindByFilter(r.Context(), store.DB(), UserFilter{IsActive: &active, EmailLike: &email})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(password))
+	hash := hex.EncodeToString(sum[:])
+	for i := range users {
+		// LIKE treats _ and % in the email as wildcards.
+		if users[i].Email != email || subtle.ConstantTimeCompare([]byte(users[i].PasswordHash), []byte(hash)) != 1 {
+			continue
+		}
+		roles, err := store.UserRepository.FindRolesByUserID(r.Context(), store.DB(), users[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			if role.Name == AdminRole {
+				return &users[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// requireAdminUser serves next only to ADMIN users. Others are challenged for
+// HTTP Basic credentials, so a browser opening the admin panel asks for them.
+func requireAdminUser(store *DBStore, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := adminUser(store, r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			writeStoreError(w, "Checking admin credentials", err)
+			return
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// createFullUserHandler serves POST /users/full. Anyone may sign up, but
+// only a caller with ADMIN credentials (see adminUser) may create an ADMIN.
+func createFullUserHandler(store *DBStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		var spec NewUserSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON body"})
+			return
+		}
+		if spec.privileged() {
+			admin, err := adminUser(store, r)
+			if err != nil {
+				writeStoreError(w, "Checking admin credentials", err)
+				return
+			}
+			if admin == nil {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": ErrPrivilegedRole.Error()})
+				return
+			}
+		}
+		full, err := store.CreateFullUser(r.Context(), spec)
+		var enqueueErr *PostCommitEnqueueError
+		switch {
+		case errors.Is(err, ErrInvalidProvisioning):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, ErrEmailTaken):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		case errors.As(err, &enqueueErr):
+			// The user is committed; only the email is missing.
+			log.Printf("User %s created without a welcome email: %v", full.ID, err)
+		case err != nil:
+			writeStoreError(w, "Creating user", err)
+			return
+		}
+		w.Header().Set("Location", "/users/"+full.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": full, "welcome_email_queued": enqueueErr == nil})
+	}
+}
+
+// seedAdminUser creates the ADMIN named by ADMIN_EMAIL and ADMIN_PASSWORD
+// unless that email is taken. Without both, admin routes stay closed until
+// an existing ADMIN creates one.
+func seedAdminUser(ctx context.Context, store *DBStore) {
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set; no admin user seeded")
+		return
+	}
+	_, err := store.CreateFullUser(ctx, NewUserSpec{Email: email, Password: password, Roles: []RoleName{AdminRole}})
+	var enqueueErr *PostCommitEnqueueError
+	switch {
+	case errors.Is(err, ErrEmailTaken):
+		log.Printf("Admin user %s already exists", email)
+	case err != nil && !errors.As(err, &enqueueErr):
+		log.Fatalf("Seeding admin user failed: %v", err)
+	}
+}
+
+// --- Admin Panel ---
+// GET /admin/panel/ is a page for ADMIN users that renders the queue, job and
+// user endpoints below. Its assets are gzipped at startup and renamed after
+// their content hash; http.ServeContent handles revalidation.
+
+const (
+	adminPanelPrefix  = "/admin/panel/"
+	adminListMaxLimit = 100
+)
+
+//go:embed admin_panel
+var adminPanelFiles embed.FS
+
+type panelAsset struct {
+	name         string // picks the Content-Type in http.ServeContent
+	body         []byte
+	gzipped      []byte // nil when compression does not pay off
+	etag         string
+	cacheControl string
+}
+
+type AdminPanel struct {
+	assets map[string]*panelAsset
+}
+
+func newPanelAsset(name string, body []byte, cacheControl string) *panelAsset {
+	sum := sha256.Sum256(body)
+	a := &panelAsset{name: name, body: body, etag: `"` + hex.EncodeToString(sum[:6]) + `"`, cacheControl: cacheControl}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(body)
+	zw.Close()
+	if buf.Len() < len(body) {
+		a.gzipped = buf.Bytes()
+	}
+	return a
+}
+
+// NewAdminPanel serves files under content-hashed names, except index.html,
+// which is a template in which {{asset "app.js"}} expands to the hashed URL.
+func NewAdminPanel(files fs.FS) (*AdminPanel, error) {
+	p := &AdminPanel{assets: make(map[string]*panelAsset)}
+	urls := make(map[string]string)
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == "index.html" {
+			return err
+		}
+		body, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		a := newPanelAsset(name, body, "public, max-age=31536000, immutable")
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + strings.Trim(a.etag, `"`) + ext
+		p.assets[hashed] = a
+		urls[name] = adminPanelPrefix + hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
+		"asset": func(name string) (string, error) {
+			if u, ok := urls[name]; ok {
+				return u, nil
+			}
+			return "", fmt.Errorf("admin panel: no asset %q", name)
+		},
+	}).ParseFS(files, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	var index bytes.Buffer
+	if err := tmpl.Execute(&index, nil); err != nil {
+		return nil, err
+	}
+	p.assets["index.html"] = newPanelAsset("index.html", index.Bytes(), "no-cache")
+	return p, nil
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		return q > 0
+	}
+	return false
+}
+
+func (p *AdminPanel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, adminPanelPrefix)
+	if name == "" {
+		name = "index.html"
+	}
+	a, ok := p.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h := w.Header()
+	h.Set("ETag", a.etag)
+	h.Set("Vary", "Accept-Encoding")
+	h.Set("Cache-Control", a.cacheControl)
+	body := a.body
+	if a.gzipped != nil && acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		h.Set("Content-Encoding", "gzip")
+		body = a.gzipped
+	}
+	http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(body))
+}
+
+var errUnknownTaskState = errors.New("state must be pending, active, scheduled, retry, archived or completed")
+
+// listTasks returns up to limit tasks of queue in the given state.
+func listTasks(inspector *asynq.Inspector, queue, state string, limit int) ([]*asynq.TaskInfo, error) {
+	page := asynq.PageSize(limit)
+	switch state {
+	case "pending":
+		return inspector.ListPendingTasks(queue, page)
+	case "active":
+		return inspector.ListActiveTasks(queue, page)
+	case "scheduled":
+		return inspector.ListScheduledTasks(queue, page)
+	case "retry":
+		return inspector.ListRetryTasks(queue, page)
+	case "archived":
+		return inspector.ListArchivedTasks(queue, page)
+	case "completed":
+		return inspector.ListCompletedTasks(queue, page)
+	}
+	return nil, errUnknownTaskState
+}
+
+// writeNoInspector answers the queue endpoints when REDIS_ADDR is unset and
+// tasks only go to the log.
+func writeNoInspector(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"error": "no task queue configured (set REDIS_ADDR)"})
+}
+
+// adminQueuesHandler serves GET /admin/queues. inspector is nil when no
+// Redis is configured.
+func adminQueuesHandler(inspector *asynq.Inspector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		if inspector == nil {
+			writeNoInspector(w)
+			return
+		}
+		queues, err := inspector.Queues()
+		if err != nil {
+			log.Printf("Listing queues failed: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": "could not list queues"})
+			return
+		}
+		sort.Strings(queues)
+		rows := make([]map[string]interface{}, 0, len(queues))
+		for _, queue := range queues {
+			info, err := inspector.GetQueueInfo(queue)
+			if err != nil {
+				continue
+			}
+			rows = append(rows, map[string]interface{}{
+				"queue": info.Queue, "paused": info.Paused, "size": info.Size,
+				"active": info.Active, "pending": info.Pending, "scheduled": info.Scheduled,
+				"retry": info.Retry, "archived": info.Archived, "completed": info.Completed,
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": rows})
+	}
+}
+
+// adminJobsHandler serves GET /admin/jobs?queue=default&state=pending&limit=50.
+func adminJobsHandler(inspector *asynq.Inspector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > adminListMaxLimit {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", adminListMaxLimit)})
+				return
+			}
+			limit = n
+		}
+		if inspector == nil {
+			writeNoInspector(w)
+			return
+		}
+		queue, state := r.URL.Query().Get("queue"), r.URL.Query().Get("state")
+		if queue == "" {
+			queue = "default"
+		}
+		if state == "" {
+			state = "pending"
+		}
+		tasks, err := listTasks(inspector, queue, state, limit)
+		if errors.Is(err, errUnknownTaskState) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil && !errors.Is(err, asynq.ErrQueueNotFound) {
+			log.Printf("Listing jobs failed: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": "could not list jobs"})
+			return
+		}
+		rows := make([]map[string]interface{}, 0, len(tasks))
+		for _, t := range tasks {
+			rows = append(rows, map[string]interface{}{
+				"id": t.ID, "type": t.Type, "queue": t.Queue, "state": t.State.String(),
+				"retried": t.Retried, "max_retry": t.MaxRetry, "last_error": t.LastErr,
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": rows})
+	}
+}
+
+var errAdminListFull = errors.New("admin list full")
+
+// adminUsersHandler serves GET /admin/users with the first
+// adminListMaxLimit users. Password hashes are never included.
+func adminUsersHandler(store *DBStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "method not allowed"})
+			return
+		}
+		rows := make([]map[string]interface{}, 0)
+		err := store.UserRepository.EachByFilter(r.Context(), store.DB(), UserFilter{}, func(u *User) error {
+			if len(rows) == adminListMaxLimit {
+				return errAdminListFull
+			}
+			rows = append(rows, map[string]interface{}{
+				"id": u.ID, "email": u.Email, "is_active": u.IsActive, "created_at": u.CreatedAt,
+			})
+			return nil
+		})
+		if err != nil && !errors.Is(err, errAdminListFull) {
+			writeStoreError(w, "Listing users", err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": rows})
+	}
+}
+
+// --- Migrations ---
+func applyMigrations(db *sql.DB) error {
+	migrations := []string{
+		`CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL, is_active BOOLEAN NOT NULL, created_at TIMESTAMP NOT NULL);`,
+		`CREATE TABLE IF NOT EXISTS posts (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, title TEXT NOT NULL, content TEXT NOT NULL, status TEXT NOT NULL, FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE);`,
+		`CREATE TABLE IF NOT EXISTS roles (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE NOT NULL);`,
+		`CREATE TABLE IF NOT EXISTS user_roles (user_id TEXT NOT NULL, role_id INTEGER NOT NULL, PRIMARY KEY (user_id, role_id), FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE, FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE);`,
+		`CREATE TABLE IF NOT EXISTS slow_queries (id INTEGER PRIMARY KEY AUTOINCREMENT, fingerprint TEXT NOT NULL, query TEXT NOT NULL, args TEXT NOT NULL, target TEXT NOT NULL, duration_ms REAL NOT NULL, row_count INTEGER NOT NULL, plan TEXT NOT NULL, occurred_at INTEGER NOT NULL);`,
+		`CREATE INDEX IF NOT EXISTS idx_slow_queries_fingerprint ON slow_queries (fingerprint, occurred_at);`,
+		`CREATE TABLE IF NOT EXISTS attachments (id TEXT PRIMARY KEY, post_id TEXT NOT NULL, blob_key TEXT NOT NULL, created_at TIMESTAMP NOT NULL, FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE);`,
+		`CREATE TABLE IF NOT EXISTS integrity_issues (id INTEGER PRIMARY KEY AUTOINCREMENT, check_name TEXT NOT NULL, severity TEXT NOT NULL, row_key TEXT NOT NULL, detail TEXT NOT NULL, first_seen_at INTEGER NOT NULL, last_seen_at INTEGER NOT NULL, resolved_at INTEGER, repaired BOOLEAN NOT NULL DEFAULT 0, UNIQUE (check_name, row_key));`,
+	}
+	for _, m := range migrations {
+		if _, err := db.Exec(m); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// --- Self-test ---
 
-type RoleRepository interface {
-	FindOrCreateByName(ctx context.Context, q Querier, name RoleName) (*Role, error)
+// recordingDispatcher records dispatched task types and fails any type
+// listed in failTypes.
+type recordingDispatcher struct {
+	mu        sync.Mutex
+	sent      []string
+	failTypes map[string]bool
 }
 
-// --- Concrete Implementations ---
+func (d *recordingDispatcher) EnqueueContext(ctx context.Context, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.failTypes[task.Type()] {
+		return nil, errors.New("redis unavailable")
+	}
+	d.sent = append(d.sent, task.Type())
+	return &asynq.TaskInfo{ID: generateUUID(), Type: task.Type()}, nil
+}
 
-type DBStore struct {
-	db *sql.DB
-	UserRepository
-	PostRepository
-	RoleRepository
+func (d *recordingDispatcher) Sent() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.sent...)
 }
 
-func NewDBStore(db *sql.DB) *DBStore {
-	return &DBStore{
-		db:             db,
-		UserRepository: &dbUserRepository{},
-		PostRepository: &dbPostRepository{},
-		RoleRepository: &dbRoleRepository{},
+// runTxEnqueuerChecks covers the commit, rollback and escape-hatch paths of
+// WithTransactionJobs. Run with: go run . selftest
+func runTxEnqueuerChecks(ctx context.Context, router *DBRouter) error {
+	countUsers := func(email string) (n int) {
+		router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&n)
+		return n
+	}
+	newUser := func(email string) *User {
+		return &User{Email: email, PasswordHash: "x", IsActive: true}
 	}
-}
 
-// WithTransaction provides a managed transaction.
-func (s *DBStore) WithTransaction(ctx context.Context, fn func(q Querier) error) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+	// Rollback: buffered tasks are dropped, EnqueueNow tasks still go out.
+	d := &recordingDispatcher{}
+	store := NewDBStore(router, d, nil)
+	rollbackErr := errors.New("rollback")
+	err := store.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
+		if err := store.UserRepository.Create(ctx, q, newUser("rollback@selftest")); err != nil {
+			return err
+		}
+		if err := jobs.Enqueue(asynq.NewTask("buffered", nil)); err != nil {
+			return err
+		}
+		if _, err := jobs.EnqueueNow(ctx, asynq.NewTask("immediate", nil)); err != nil {
+			return err
+		}
+		if sent := d.Sent(); len(sent) != 1 || sent[0] != "immediate" {
+			return fmt.Errorf("before commit: sent %v, want [immediate]", sent)
+		}
+		return rollbackErr
+	})
+	if !errors.Is(err, rollbackErr) {
+		return fmt.Errorf("rollback: got error %v", err)
+	}
+	if sent := d.Sent(); len(sent) != 1 || sent[0] != "immediate" {
+		return fmt.Errorf("rollback: sent %v, want [immediate]", sent)
+	}
+	if n := countUsers("rollback@selftest"); n != 0 {
+		return fmt.Errorf("rollback: %d rows persisted", n)
 	}
-	defer tx.Rollback()
 
-	if err := fn(tx); err != nil {
-		return err
+	// Commit: buffered tasks are dispatched in order after the commit.
+	d = &recordingDispatcher{}
+	store = NewDBStore(router, d, nil)
+	var kept *TxEnqueuer
+	err = store.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
+		kept = jobs
+		if err := store.UserRepository.Create(ctx, q, newUser("commit@selftest")); err != nil {
+			return err
+		}
+		if err := jobs.Enqueue(asynq.NewTask("first", nil)); err != nil {
+			return err
+		}
+		if err := jobs.Enqueue(asynq.NewTask("second", nil)); err != nil {
+			return err
+		}
+		if len(d.Sent()) != 0 {
+			return errors.New("commit: tasks dispatched before commit")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("commit: %v", err)
+	}
+	if sent := d.Sent(); strings.Join(sent, ",") != "first,second" {
+		return fmt.Errorf("commit: sent %v, want [first second]", sent)
+	}
+	if err := kept.Enqueue(asynq.NewTask("late", nil)); !errors.Is(err, ErrTxEnqueuerDone) {
+		return fmt.Errorf("enqueue after commit: got %v, want ErrTxEnqueuerDone", err)
 	}
 
-	return tx.Commit()
+	// Failed dispatch after commit: data stays, the error says so.
+	d = &recordingDispatcher{failTypes: map[string]bool{"flaky": true}}
+	store = NewDBStore(router, d, nil)
+	err = store.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
+		if err := store.UserRepository.Create(ctx, q, newUser("flaky@selftest")); err != nil {
+			return err
+		}
+		if err := jobs.Enqueue(asynq.NewTask("flaky", nil)); err != nil {
+			return err
+		}
+		return jobs.Enqueue(asynq.NewTask("after-flaky", nil))
+	})
+	var postCommit *PostCommitEnqueueError
+	if !errors.As(err, &postCommit) {
+		return fmt.Errorf("post-commit failure: got error %v", err)
+	}
+	if sent := d.Sent(); len(sent) != 1 || sent[0] != "after-flaky" {
+		return fmt.Errorf("post-commit failure: sent %v, want [after-flaky]", sent)
+	}
+	if n := countUsers("flaky@selftest"); n != 1 {
+		return fmt.Errorf("post-commit failure: %d rows persisted, want 1", n)
+	}
+	return nil
 }
 
-// --- User Repository ---
-type dbUserRepository struct{}
+// runTxRetryChecks fakes SQLITE_BUSY to check that transactions are retried
+// until they commit, and are not retried once they have side effects.
+func runTxRetryChecks(ctx context.Context, router *DBRouter) error {
+	store := NewDBStore(router, &recordingDispatcher{}, nil)
+	store.Retry.BaseDelay = time.Millisecond
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
 
-type UserFilter struct {
-	IsActive  *bool
-	EmailLike *string
-}
+	attempts := 0
+	err := store.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
+		attempts++
+		if attempts < 3 {
+			return busy
+		}
+		return store.UserRepository.Create(ctx, q, &User{Email: "retry@selftest", PasswordHash: "x", IsActive: true})
+	})
+	if err != nil || attempts != 3 {
+		return fmt.Errorf("busy retry: err=%v after %d attempts, want success after 3", err, attempts)
+	}
+	var n int
+	router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", "retry@selftest").Scan(&n)
+	if n != 1 {
+		return fmt.Errorf("busy retry: %d rows committed, want 1", n)
+	}
 
-func (r *dbUserRepository) Create(ctx context.Context, q Querier, user *User) error {
-	user.ID = generateUUID()
-	user.CreatedAt = time.Now().UTC()
-	query := "INSERT INTO users (id, email, password_hash, is_active, created_at) VALUES (?, ?, ?, ?, ?)"
-	_, err := q.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.IsActive, user.CreatedAt)
-	return err
-}
+	attempts = 0
+	err = store.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
+		attempts++
+		jobs.EnqueueNow(ctx, asynq.NewTask("immediate", nil))
+		return busy
+	})
+	if !errors.Is(err, busy) || attempts != 1 {
+		return fmt.Errorf("side effects: err=%v after %d attempts, want busy after 1", err, attempts)
+	}
 
-func (r *dbUserRepository) FindByID(ctx context.Context, q Querier, id string) (*User, error) {
-	query := "SELECT id, email, password_hash, is_active, created_at FROM users WHERE id = ?"
-	row := q.QueryRowContext(ctx, query, id)
-	var u User
-	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.IsActive, &u.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user with id %s not found", id)
+	attempts = 0
+	store.Retry.MaxAttempts = 2
+	err = store.WithTransaction(ctx, func(q Querier) error {
+		attempts++
+		return busy
+	})
+	if !errors.Is(err, busy) || attempts != 2 {
+		return fmt.Errorf("exhausted: err=%v after %d attempts, want busy after 2", err, attempts)
+	}
+
+	if stats := store.TxStats(); stats.Retries != 3 || stats.Recovered != 1 || stats.Unsafe != 1 || stats.Exhausted != 1 {
+		return fmt.Errorf("stats %+v, want 3 retries, 1 recovered, 1 unsafe, 1 exhausted", stats)
 	}
-	return &u, err
+	return nil
 }
 
-func (r *dbUserRepository) FindByFilter(ctx context.Context, q Querier, filter UserFilter) ([]User, error) {
-	var args []interface{}
-	var conditions []string
+// runFullUserChecks checks that CreateFullUser either writes the user, roles,
+// post and welcome email together, or none of them.
+func runFullUserChecks(ctx context.Context, router *DBRouter) error {
+	d := &recordingDispatcher{}
+	store := NewDBStore(router, d, nil)
+	spec := NewUserSpec{Email: "full@selftest", Password: "long-enough", Roles: []RoleName{AdminRole, UserRole}}
+	full, err := store.CreateFullUser(ctx, spec)
+	if err != nil {
+		return fmt.Errorf("create: %v", err)
+	}
+	if len(full.Roles) != 2 || len(full.Posts) != 1 || full.Posts[0].Status != DraftStatus {
+		return fmt.Errorf("create: got %+v, want 2 roles and 1 draft post", full)
+	}
+	if sent := d.Sent(); len(sent) != 1 || sent[0] != "email:welcome" {
+		return fmt.Errorf("create: sent %v, want [email:welcome]", sent)
+	}
 
-	if filter.IsActive != nil {
-		conditions = append(conditions, "is_active = ?")
-		args = append(args, *filter.IsActive)
+	var posts int
+	router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM posts").Scan(&posts)
+	if _, err := store.CreateFullUser(ctx, spec); !errors.Is(err, ErrEmailTaken) {
+		return fmt.Errorf("duplicate: err=%v, want ErrEmailTaken", err)
 	}
-	if filter.EmailLike != nil {
-		conditions = append(conditions, "email LIKE ?")
-		args = append(args, *filter.EmailLike)
+	var postsAfter int
+	router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM posts").Scan(&postsAfter)
+	if postsAfter != posts || len(d.Sent()) != 1 {
+		return fmt.Errorf("duplicate: left %d new posts and sent %v", postsAfter-posts, d.Sent())
 	}
+	return runFullUserRoleChecks(ctx, router, store)
+}
 
-	query := "SELECT id, email, password_hash, is_active, created_at FROM users"
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+// runFullUserRoleChecks posts to the handler to check that only an
+// authenticated ADMIN can create another ADMIN, and that only ADMIN users
+// pass requireAdminUser.
+func runFullUserRoleChecks(ctx context.Context, router *DBRouter, store *DBStore) error {
+	if _, err := store.CreateFullUser(ctx, NewUserSpec{Email: "root@selftest", Password: "long-enough", Roles: []RoleName{AdminRole}}); err != nil {
+		return fmt.Errorf("bootstrap admin: %w", err)
 	}
 
-	rows, err := q.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
+	handler := createFullUserHandler(store)
+	post := func(email, role, asEmail, asPassword string) int {
+		body := fmt.Sprintf(`{"email":%q,"password":"long-enough","roles":[%q]}`, email, role)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/users/full", strings.NewReader(body))
+		if asEmail != "" {
+			req.SetBasicAuth(asEmail, asPassword)
+		}
+		rec := &statusRecorder{}
+		handler(rec, req)
+		return rec.status
+	}
+	countUser := func(email string) int {
+		var n int
+		router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&n)
+		return n
 	}
-	defer rows.Close()
 
-	var users []User
-	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.IsActive, &u.CreatedAt); err != nil {
-			return nil, err
+	if status := post("plain@selftest", string(UserRole), "", ""); status != http.StatusCreated {
+		return fmt.Errorf("user role anonymously: status %d, want 201", status)
+	}
+	for _, as := range []struct{ email, password string }{
+		{"", ""},
+		{"plain@selftest", "long-enough"},
+		{"root@selftest", "wrong-password"},
+	} {
+		if status := post("escalate@selftest", string(AdminRole), as.email, as.password); status != http.StatusForbidden {
+			return fmt.Errorf("admin role as %q: status %d, want 403", as.email, status)
 		}
-		users = append(users, u)
 	}
-	return users, rows.Err()
-}
+	if n := countUser("escalate@selftest"); n != 0 {
+		return fmt.Errorf("rejected admin signup left %d rows", n)
+	}
+	if status := post("granted@selftest", string(AdminRole), "root@selftest", "long-enough"); status != http.StatusCreated {
+		return fmt.Errorf("admin role as admin: status %d, want 201", status)
+	}
 
-func (r *dbUserRepository) AssignRole(ctx context.Context, q Querier, userID string, roleID int64) error {
-	query := "INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)"
-	_, err := q.ExecContext(ctx, query, userID, roleID)
-	return err
+	guarded := requireAdminUser(store, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, c := range []struct {
+		email, password string
+		want            int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"plain@selftest", "long-enough", http.StatusUnauthorized},
+		{"granted@selftest", "wrong-password", http.StatusUnauthorized},
+		{"granted@selftest", "long-enough", http.StatusOK},
+	} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/admin/users", nil)
+		if c.email != "" {
+			req.SetBasicAuth(c.email, c.password)
+		}
+		rec := &statusRecorder{}
+		guarded(rec, req)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status != c.want {
+			return fmt.Errorf("admin route as %q: status %d, want %d", c.email, rec.status, c.want)
+		}
+	}
+	return nil
 }
 
-func (r *dbUserRepository) FindRolesByUserID(ctx context.Context, q Querier, userID string) ([]Role, error) {
-	query := `SELECT r.id, r.name FROM roles r JOIN user_roles ur ON r.id = ur.role_id WHERE ur.user_id = ?`
-	rows, err := q.QueryContext(ctx, query, userID)
+// runSlowQueryChecks treats every statement as slow and checks that a
+// sample lands in slow_queries with a plan and without bind values.
+func runSlowQueryChecks(ctx context.Context, router *DBRouter) error {
+	analyzer := NewSlowQueryAnalyzer(router.Primary(), time.Minute)
+	analyzer.Start(ctx)
+	store := NewDBStore(router, logDispatcher{}, &QueryLogger{Threshold: 0, Analyzer: analyzer})
+
+	secret := "needle-in-args@selftest"
+	if _, err := store.UserRepository.FindByFilter(ctx, store.DB(), UserFilter{EmailLike: &secret}); err != nil {
+		return err
+	}
+	if err := analyzer.Flush(ctx); err != nil {
+		return err
+	}
+	top, err := analyzer.TopSlowQueries(ctx, 100)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	var roles []Role
-	for rows.Next() {
-		var role Role
-		if err := rows.Scan(&role.ID, &role.Name); err != nil {
-			return nil, err
+	var found *SlowQuerySummary
+	for i := range top {
+		if strings.Contains(top[i].Query, "email LIKE ?") {
+			found = &top[i]
 		}
-		roles = append(roles, role)
 	}
-	return roles, rows.Err()
+	if found == nil {
+		return fmt.Errorf("slow query not recorded; got %+v", top)
+	}
+	if !strings.Contains(found.Plan, "users") {
+		return fmt.Errorf("plan %q does not mention the users table", found.Plan)
+	}
+	var storedArgs string
+	router.Primary().QueryRowContext(ctx, "SELECT args FROM slow_queries WHERE fingerprint = ?", found.Fingerprint).Scan(&storedArgs)
+	if strings.Contains(storedArgs, secret) {
+		return fmt.Errorf("bind value leaked into slow_queries: %s", storedArgs)
+	}
+	return nil
 }
 
-// --- Post Repository ---
-type dbPostRepository struct{}
+// runIntegrityChecks plants orphans with foreign keys switched off, then
+// checks that a scan reports them and that repair drops only the safe ones.
+func runIntegrityChecks(ctx context.Context, router *DBRouter) error {
+	blobDir, err := os.MkdirTemp("", "blobs")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(blobDir)
+	if err := os.WriteFile(filepath.Join(blobDir, "present"), []byte("x"), 0o600); err != nil {
+		return err
+	}
 
-func (r *dbPostRepository) Create(ctx context.Context, q Querier, post *Post) error {
-	post.ID = generateUUID()
-	query := "INSERT INTO posts (id, user_id, title, content, status) VALUES (?, ?, ?, ?, ?)"
-	_, err := q.ExecContext(ctx, query, post.ID, post.UserID, post.Title, post.Content, post.Status)
-	return err
-}
+	store := NewDBStore(router, &recordingDispatcher{}, nil)
+	owner, err := store.CreateFullUser(ctx, NewUserSpec{Email: "integrity@selftest", Password: "long-enough"})
+	if err != nil {
+		return err
+	}
+	present := &Attachment{PostID: owner.Posts[0].ID, BlobKey: "present"}
+	missing := &Attachment{PostID: owner.Posts[0].ID, BlobKey: "gone"}
+	for _, a := range []*Attachment{present, missing} {
+		if err := store.AttachmentRepository.Create(ctx, store.DB(), a); err != nil {
+			return fmt.Errorf("seed attachment: %v", err)
+		}
+	}
+	if got, err := store.AttachmentRepository.FindByPostID(ctx, store.DB(), owner.Posts[0].ID); err != nil || len(got) != 2 {
+		return fmt.Errorf("attachments of post: %d, %v; want 2", len(got), err)
+	}
+	conn, err := router.Primary().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	seed := []string{
+		"PRAGMA foreign_keys = OFF",
+		"INSERT INTO posts (id, user_id, title, content, status) VALUES ('orphan-post', 'ghost', 't', 'c', 'DRAFT')",
+		"INSERT INTO user_roles (user_id, role_id) VALUES ('" + owner.ID + "', 9999)",
+		"PRAGMA foreign_keys = ON",
+	}
+	for _, stmt := range seed {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return fmt.Errorf("seed: %v", err)
+		}
+	}
+	conn.Close()
 
-func (r *dbPostRepository) FindByUserID(ctx context.Context, q Querier, userID string) ([]Post, error) {
-	query := "SELECT id, user_id, title, content, status FROM posts WHERE user_id = ?"
-	rows, err := q.QueryContext(ctx, query, userID)
+	checker := NewIntegrityChecker(router.Primary(), dirBlobStore(blobDir), false)
+	report := checker.Run(ctx)
+	want := map[string]int{"post_without_user": 1, "user_role_without_role": 1, "attachment_without_blob": 1}
+	for name, n := range want {
+		if report.Found[name] != n || report.Repaired[name] != 0 {
+			return fmt.Errorf("report-only scan: %+v, want one of each and no repairs", report)
+		}
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("report-only scan: %v", report.Errors)
+	}
+	issues, err := checker.Issues(ctx, SeverityError, false, 10)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	var posts []Post
-	for rows.Next() {
-		var p Post
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.Status); err != nil {
-			return nil, err
+	if len(issues) != 1 || issues[0].RowKey != missing.ID {
+		return fmt.Errorf("error issues: %+v, want only %s", issues, missing.ID)
+	}
+
+	checker.AutoRepair = true
+	report = checker.Run(ctx)
+	if report.Repaired["post_without_user"] != 1 || report.Repaired["user_role_without_role"] != 1 || report.Repaired["attachment_without_blob"] != 0 {
+		return fmt.Errorf("repair scan: %+v, want orphan post and role repaired, attachment kept", report)
+	}
+	var posts, attachments int
+	router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM posts WHERE id = 'orphan-post'").Scan(&posts)
+	router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM attachments").Scan(&attachments)
+	if posts != 0 || attachments != 2 {
+		return fmt.Errorf("repair scan: %d orphan posts and %d attachments left, want 0 and 2", posts, attachments)
+	}
+	open, err := checker.Issues(ctx, "", false, 10)
+	if err != nil {
+		return err
+	}
+	if len(open) != 1 || open[0].Check != "attachment_without_blob" {
+		return fmt.Errorf("open issues after repair: %+v", open)
+	}
+	all, err := checker.Issues(ctx, "", true, 10)
+	if err != nil {
+		return err
+	}
+	repaired := 0
+	for _, i := range all {
+		if i.Repaired && i.ResolvedAt != nil {
+			repaired++
 		}
-		posts = append(posts, p)
 	}
-	return posts, rows.Err()
+	if repaired != 2 {
+		return fmt.Errorf("all issues: %+v, want 2 repaired", all)
+	}
+	return nil
 }
 
-// --- Role Repository ---
-type dbRoleRepository struct{}
+// runCancellationChecks cancels a scan from inside its own row loop and lets
+// the query and transaction timeouts run out, checking each surfaces as the
+// typed error the handlers map to 499 or 504.
+func runCancellationChecks(ctx context.Context, router *DBRouter) error {
+	store := NewDBStore(router, &recordingDispatcher{}, nil)
+	err := store.WithTransaction(ctx, func(q Querier) error {
+		for i := 0; i < 200; i++ {
+			u := &User{Email: fmt.Sprintf("scan%03d@cancel.selftest", i), PasswordHash: "x", IsActive: true}
+			if err := store.UserRepository.Create(ctx, q, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("seed: %v", err)
+	}
+	pattern := "%@cancel.selftest"
+	filter := UserFilter{EmailLike: &pattern}
 
-func (r *dbRoleRepository) FindOrCreateByName(ctx context.Context, q Querier, name RoleName) (*Role, error) {
-	var role Role
-	query := "SELECT id, name FROM roles WHERE name = ?"
-	err := q.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name)
-	if err == sql.ErrNoRows {
-		insertQuery := "INSERT INTO roles (name) VALUES (?) RETURNING id"
-		// Note: RETURNING is PostgreSQL specific. For SQLite, we do it in two steps.
-		res, err := q.ExecContext(ctx, "INSERT INTO roles (name) VALUES (?)", name)
-		if err != nil {
-			return nil, err
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	seen := 0
+	err = store.UserRepository.EachByFilter(scanCtx, store.DB(), filter, func(*User) error {
+		if seen++; seen == 10 {
+			cancelScan()
 		}
-		id, _ := res.LastInsertId()
-		return &Role{ID: id, Name: name}, nil
+		return nil
+	})
+	cancelScan()
+	if !errors.Is(err, ErrCanceled) || seen != 10 {
+		return fmt.Errorf("mid-scan cancel: err=%v after %d rows, want ErrCanceled after 10", err, seen)
 	}
-	return &role, err
-}
 
-// --- Migrations ---
-func applyMigrations(db *sql.DB) error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY, email TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL, is_active BOOLEAN NOT NULL, created_at TIMESTAMP NOT NULL);`,
-		`CREATE TABLE IF NOT EXISTS posts (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, title TEXT NOT NULL, content TEXT NOT NULL, status TEXT NOT NULL, FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE);`,
-		`CREATE TABLE IF NOT EXISTS roles (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE NOT NULL);`,
-		`CREATE TABLE IF NOT EXISTS user_roles (user_id TEXT NOT NULL, role_id INTEGER NOT NULL, PRIMARY KEY (user_id, role_id), FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE, FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE);`,
+	users, err := store.UserRepository.FindByFilter(ctx, store.DB(), filter)
+	if err != nil || len(users) != 200 {
+		return fmt.Errorf("uncanceled scan: err=%v, %d rows, want 200", err, len(users))
 	}
-	for _, m := range migrations {
-		if _, err := db.Exec(m); err != nil {
-			return fmt.Errorf("migration failed: %w", err)
+
+	store.Timeouts.Query = time.Nanosecond
+	if _, err := store.UserRepository.FindByFilter(ctx, store.DB(), filter); !errors.Is(err, ErrTimeout) {
+		return fmt.Errorf("query timeout: err=%v, want ErrTimeout", err)
+	}
+	store.Timeouts = DefaultStoreTimeouts()
+
+	store.Timeouts.Tx = 20 * time.Millisecond
+	err = store.WithTransaction(ctx, func(q Querier) error {
+		time.Sleep(50 * time.Millisecond)
+		return store.UserRepository.Create(ctx, q, &User{Email: "late@cancel.selftest", PasswordHash: "x", IsActive: true})
+	})
+	if !errors.Is(err, ErrTimeout) {
+		return fmt.Errorf("tx timeout: err=%v, want ErrTimeout", err)
+	}
+	var n int
+	router.Primary().QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", "late@cancel.selftest").Scan(&n)
+	if n != 0 {
+		return fmt.Errorf("tx timeout: %d rows committed, want 0", n)
+	}
+
+	for err, want := range map[error]int{
+		fmt.Errorf("%w: x", ErrCanceled): StatusClientClosedRequest,
+		fmt.Errorf("%w: x", ErrTimeout):  http.StatusGatewayTimeout,
+		errors.New("x"):                  http.StatusInternalServerError,
+	} {
+		rec := &statusRecorder{}
+		writeStoreError(rec, "selftest", err)
+		if rec.status != want {
+			return fmt.Errorf("writeStoreError(%v) = %d, want %d", err, rec.status, want)
 		}
 	}
 	return nil
 }
 
+// statusRecorder keeps the status written by a handler and discards the body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) Header() http.Header         { return http.Header{} }
+func (r *statusRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (r *statusRecorder) WriteHeader(status int)      { r.status = status }
+
 func main() {
-	ctx := context.Background()
-	db, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg, err := LoadDBConfig()
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	router, err := OpenDBRouter("sqlite3", cfg)
 	if err != nil {
 		log.Fatalf("DB connection error: %v", err)
 	}
-	defer db.Close()
+	defer router.Close()
 
-	if err := applyMigrations(db); err != nil {
+	if err := applyMigrations(router.Primary()); err != nil {
 		log.Fatalf("Migration error: %v", err)
 	}
 	log.Println("Migrations applied.")
+	router.StartLagMonitor(ctx)
+	log.Printf("Replicas: %+v", router.ReplicaStatus())
+
+	var jobs TaskDispatcher = logDispatcher{}
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		client := asynq.NewClient(asynq.RedisClientOpt{Addr: addr})
+		defer client.Close()
+		jobs = client
+	}
+	analyzer := NewSlowQueryAnalyzer(router.Primary(), time.Minute)
+	analyzer.Start(ctx)
+	queries := &QueryLogger{Threshold: cfg.SlowQueryThreshold, LogAll: cfg.LogAllQueries, Analyzer: analyzer}
+	store := NewDBStore(router, jobs, queries)
+	store.Retry = cfg.TxRetry
+	store.Timeouts = cfg.Timeouts
+	db := store.DB()
+	var blobs BlobStore
+	if cfg.BlobDir != "" {
+		blobs = dirBlobStore(cfg.BlobDir)
+	}
+	integrity := NewIntegrityChecker(router.Primary(), blobs, cfg.IntegrityRepair)
+	integrity.Start(ctx, cfg.IntegrityInterval)
 
-	store := NewDBStore(db)
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		if err := runTxEnqueuerChecks(ctx, router); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+		if err := runTxRetryChecks(ctx, router); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+		if err := runFullUserChecks(ctx, router); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+		if err := runSlowQueryChecks(ctx, router); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+		if err := runIntegrityChecks(ctx, router); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+		if err := runCancellationChecks(ctx, router); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
+		log.Println("selftest passed")
+		return
+	}
 
 	// 1. CRUD Demo
 	log.Println("\n--- CRUD Demo ---")
@@ -287,7 +2700,8 @@ func main() {
 		log.Fatalf("Create user failed: %v", err)
 	}
 	log.Printf("Created user: %s", user1.ID)
-	fetchedUser, err := store.UserRepository.FindByID(ctx, db, user1.ID)
+	// Read our own write from the primary; a replica may not have it yet.
+	fetchedUser, err := store.UserRepository.FindByID(WithPrimary(ctx), db, user1.ID)
 	if err != nil {
 		log.Fatalf("Find user failed: %v", err)
 	}
@@ -322,12 +2736,15 @@ func main() {
 
 	// 4. Transaction Demo
 	log.Println("\n--- Transaction Demo ---")
-	err = store.WithTransaction(ctx, func(q Querier) error {
+	err = store.WithTransactionJobs(ctx, func(q Querier, jobs *TxEnqueuer) error {
 		userTx := &User{Email: "tx.user@example.com", PasswordHash: "tx_hash", IsActive: true}
 		if err := store.UserRepository.Create(ctx, q, userTx); err != nil {
 			return err
 		}
-		// Simulate a failure
+		if err := jobs.Enqueue(asynq.NewTask("email:welcome", []byte(`{"user_id":"`+userTx.ID+`"}`))); err != nil {
+			return err
+		}
+		// Simulate a failure; the welcome email is never enqueued.
 		return fmt.Errorf("intentional rollback")
 	})
 	if err != nil {
@@ -344,4 +2761,38 @@ func main() {
 		log.Fatalf("Filter users failed: %v", err)
 	}
 	log.Printf("Found %d users via filter: %+v", len(filteredUsers), filteredUsers)
+
+	// 6. Slow query diagnostics, integrity findings and POST /users/full:
+	// `go run . serve` keeps the process up to expose them.
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		addr := os.Getenv("ADMIN_ADDR")
+		if addr == "" {
+			addr = ":8080"
+		}
+		mux := http.NewServeMux()
+		seedAdminUser(ctx, store)
+		mux.HandleFunc("/admin/db/slow-queries", requireAdminUser(store, slowQueriesHandler(analyzer)))
+		mux.HandleFunc("/admin/db/tx-stats", requireAdminUser(store, txStatsHandler(store)))
+		mux.HandleFunc("/admin/integrity", requireAdminUser(store, integrityHandler(integrity)))
+		mux.HandleFunc("/users/full", createFullUserHandler(store))
+
+		var inspector *asynq.Inspector
+		if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+			inspector = asynq.NewInspector(asynq.RedisClientOpt{Addr: redisAddr})
+			defer inspector.Close()
+		}
+		mux.HandleFunc("/admin/queues", requireAdminUser(store, adminQueuesHandler(inspector)))
+		mux.HandleFunc("/admin/jobs", requireAdminUser(store, adminJobsHandler(inspector)))
+		mux.HandleFunc("/admin/users", requireAdminUser(store, adminUsersHandler(store)))
+		panelFiles, _ := fs.Sub(adminPanelFiles, "admin_panel")
+		panel, err := NewAdminPanel(panelFiles)
+		if err != nil {
+			log.Fatalf("Admin panel error: %v", err)
+		}
+		mux.HandleFunc(adminPanelPrefix, requireAdminUser(store, panel))
+		log.Printf("Serving diagnostics on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Fatalf("Server error: %v", err)
+		}
+	}
 }
\ No newline at end of file
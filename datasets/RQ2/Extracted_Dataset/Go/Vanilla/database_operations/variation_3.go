@@ -3,13 +3,15 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 	"crypto/rand"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // --- Domain Models & Enums ---
@@ -59,14 +61,168 @@ type Querier interface {
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
-type UserDAO struct{}
+// ErrEmailInUse is returned when a write would give two users the same
+// canonical email.
+var ErrEmailInUse = errors.New("email already in use")
 
+var (
+	ErrInvalidEmail  = errors.New("invalid email address")
+	ErrNotDuplicates = errors.New("users do not share a canonical email")
+)
+
+// isUniqueViolation reports whether err is SQLite rejecting a duplicate in
+// the given "table.column".
+func isUniqueViolation(err error, column string) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return false
+	}
+	return strings.Contains(sqliteErr.Error(), column)
+}
+
+// --- Email Canonicalization ---
+
+// DomainPolicy says which provider-specific folding applies to a domain.
+// CanonicalDomain maps an alias domain onto the one it shares mailboxes with.
+type DomainPolicy struct {
+	FoldDots        bool
+	FoldPlusTags    bool
+	CanonicalDomain string
+}
+
+// EmailCanonicalizer turns an address into the form uniqueness is checked
+// on. Every address is trimmed and lowercased; folding beyond that only
+// happens for domains listed in Domains.
+type EmailCanonicalizer struct {
+	Domains map[string]DomainPolicy
+}
+
+// DefaultEmailCanonicalizer folds Gmail addresses, where dots and +tags in
+// the local part do not change the mailbox.
+func DefaultEmailCanonicalizer() *EmailCanonicalizer {
+	return &EmailCanonicalizer{Domains: map[string]DomainPolicy{
+		"gmail.com":      {FoldDots: true, FoldPlusTags: true},
+		"googlemail.com": {FoldDots: true, FoldPlusTags: true, CanonicalDomain: "gmail.com"},
+	}}
+}
+
+func (c *EmailCanonicalizer) Canonical(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+	local, domain := email[:at], email[at+1:]
+	policy := c.Domains[domain]
+	if policy.CanonicalDomain != "" {
+		domain = policy.CanonicalDomain
+	}
+	if i := strings.IndexByte(local, '+'); policy.FoldPlusTags && i >= 0 {
+		local = local[:i]
+	}
+	if policy.FoldDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if local == "" {
+		return "", ErrInvalidEmail
+	}
+	return local + "@" + domain, nil
+}
+
+// DuplicateEmailGroup is a set of users whose emails share a canonical form,
+// oldest first.
+type DuplicateEmailGroup struct {
+	Canonical string
+	Users     []User
+}
+
+type UserDAO struct {
+	canon *EmailCanonicalizer
+}
+
+// Insert checks for the canonical email and inserts in a single statement, so
+// concurrent registrations cannot both pass the check. The unique index on
+// email_canonical backs this up once legacy duplicates have been merged.
 func (d *UserDAO) Insert(ctx context.Context, q Querier, u *User) error {
+	canonical, err := d.canon.Canonical(u.Email)
+	if err != nil {
+		return err
+	}
 	u.Id, _ = createUUID()
+	u.Email = strings.TrimSpace(u.Email)
 	u.CreatedAt = time.Now().UTC()
-	stmt := "INSERT INTO users (id, email, password_hash, is_active, created_at) VALUES (?, ?, ?, ?, ?)"
-	_, err := q.ExecContext(ctx, stmt, u.Id, u.Email, u.PasswordHash, u.IsActive, u.CreatedAt)
-	return err
+	stmt := `INSERT INTO users (id, email, email_canonical, password_hash, is_active, created_at)
+		SELECT ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM users WHERE email_canonical = ?)`
+	res, err := q.ExecContext(ctx, stmt, u.Id, u.Email, canonical, u.PasswordHash, u.IsActive, u.CreatedAt, canonical)
+	if isUniqueViolation(err, "users.email") {
+		return ErrEmailInUse
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrEmailInUse
+	}
+	return nil
+}
+
+// Upsert inserts u or, if a user with the same canonical email exists,
+// updates the oldest such row in place, so re-running an import is harmless.
+// u gets the stored id and creation time; created reports whether a new row
+// was written. Run it inside a transaction.
+func (d *UserDAO) Upsert(ctx context.Context, q Querier, u *User) (created bool, err error) {
+	existing, err := d.GetByEmail(ctx, q, u.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, d.Insert(ctx, q, u)
+	}
+	if err != nil {
+		return false, err
+	}
+	stmt := "UPDATE users SET password_hash = ?, is_active = ? WHERE id = ?"
+	if _, err := q.ExecContext(ctx, stmt, u.PasswordHash, u.IsActive, existing.Id); err != nil {
+		return false, err
+	}
+	u.Id, u.CreatedAt = existing.Id, existing.CreatedAt
+	return false, nil
+}
+
+// GetByEmail finds a user by canonical email. While legacy duplicates remain
+// unmerged, the oldest of them is returned.
+func (d *UserDAO) GetByEmail(ctx context.Context, q Querier, email string) (*User, error) {
+	canonical, err := d.canon.Canonical(email)
+	if err != nil {
+		return nil, err
+	}
+	stmt := `SELECT id, email, password_hash, is_active, created_at FROM users
+		WHERE email_canonical = ? ORDER BY created_at, id LIMIT 1`
+	var u User
+	err = q.QueryRowContext(ctx, stmt, canonical).Scan(&u.Id, &u.Email, &u.PasswordHash, &u.IsActive, &u.CreatedAt)
+	return &u, err
+}
+
+func (d *UserDAO) FindDuplicates(ctx context.Context, q Querier) ([]DuplicateEmailGroup, error) {
+	stmt := `SELECT email_canonical, id, email, password_hash, is_active, created_at FROM users
+		WHERE email_canonical IN (SELECT email_canonical FROM users GROUP BY email_canonical HAVING COUNT(*) > 1)
+		ORDER BY email_canonical, created_at, id`
+	rows, err := q.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups []DuplicateEmailGroup
+	for rows.Next() {
+		var canonical string
+		var u User
+		if err := rows.Scan(&canonical, &u.Id, &u.Email, &u.PasswordHash, &u.IsActive, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(groups) == 0 || groups[len(groups)-1].Canonical != canonical {
+			groups = append(groups, DuplicateEmailGroup{Canonical: canonical})
+		}
+		g := &groups[len(groups)-1]
+		g.Users = append(g.Users, u)
+	}
+	return groups, rows.Err()
 }
 
 func (d *UserDAO) Get(ctx context.Context, q Querier, id string) (*User, error) {
@@ -134,10 +290,10 @@ type UserService struct {
 	roleDAO   *RoleDAO
 }
 
-func NewUserService(dbm *DBManager) *UserService {
+func NewUserService(dbm *DBManager, canon *EmailCanonicalizer) *UserService {
 	return &UserService{
 		dbManager: dbm,
-		userDAO:   &UserDAO{},
+		userDAO:   &UserDAO{canon: canon},
 		roleDAO:   &RoleDAO{},
 	}
 }
@@ -166,10 +322,96 @@ func (s *UserService) RegisterUser(ctx context.Context, email, password string)
 	return user, nil
 }
 
+// ImportUsers upserts users by email in one transaction and returns how many
+// were new.
+func (s *UserService) ImportUsers(ctx context.Context, users []*User) (int, error) {
+	created := 0
+	err := s.dbManager.ExecuteInTransaction(ctx, func(q Querier) error {
+		defaultRoleID, err := s.roleDAO.GetOrCreate(ctx, q, USER)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			isNew, err := s.userDAO.Upsert(ctx, q, u)
+			if err != nil {
+				return fmt.Errorf("importing %s: %w", u.Email, err)
+			}
+			if !isNew {
+				continue
+			}
+			created++
+			if err := s.roleDAO.AssignToUser(ctx, q, u.Id, defaultRoleID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
 func (s *UserService) GetUser(ctx context.Context, id string) (*User, error) {
 	return s.userDAO.Get(ctx, s.dbManager.conn, id)
 }
 
+func (s *UserService) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	return s.userDAO.GetByEmail(ctx, s.dbManager.conn, email)
+}
+
+// FindDuplicateEmails lists the users an admin still has to merge.
+func (s *UserService) FindDuplicateEmails(ctx context.Context) ([]DuplicateEmailGroup, error) {
+	return s.userDAO.FindDuplicates(ctx, s.dbManager.conn)
+}
+
+// MergeUsers folds mergeId into keepId: posts and roles move over, the kept
+// account stays active if either was, and mergeId is deleted and logged in
+// user_merges. Once the last duplicate is gone the canonical email becomes a
+// UNIQUE index.
+func (s *UserService) MergeUsers(ctx context.Context, keepId, mergeId string) error {
+	err := s.dbManager.ExecuteInTransaction(ctx, func(q Querier) error {
+		keep, err := s.userDAO.Get(ctx, q, keepId)
+		if err != nil {
+			return fmt.Errorf("loading user %s: %w", keepId, err)
+		}
+		merged, err := s.userDAO.Get(ctx, q, mergeId)
+		if err != nil {
+			return fmt.Errorf("loading user %s: %w", mergeId, err)
+		}
+		keepCanonical, _ := s.userDAO.canon.Canonical(keep.Email)
+		mergedCanonical, _ := s.userDAO.canon.Canonical(merged.Email)
+		if keepId == mergeId || keepCanonical != mergedCanonical {
+			return ErrNotDuplicates
+		}
+
+		stmts := []struct {
+			query string
+			args  []interface{}
+		}{
+			{"UPDATE posts SET user_id = ? WHERE user_id = ?", []interface{}{keepId, mergeId}},
+			{"INSERT OR IGNORE INTO user_roles (user_id, role_id) SELECT ?, role_id FROM user_roles WHERE user_id = ?", []interface{}{keepId, mergeId}},
+			{"DELETE FROM user_roles WHERE user_id = ?", []interface{}{mergeId}},
+			{"UPDATE users SET is_active = is_active OR ? WHERE id = ?", []interface{}{merged.IsActive, keepId}},
+			{"DELETE FROM users WHERE id = ?", []interface{}{mergeId}},
+			{"INSERT INTO user_merges (merged_id, merged_email, into_id, merged_at) VALUES (?, ?, ?, ?)", []interface{}{mergeId, merged.Email, keepId, time.Now().UTC()}},
+		}
+		for _, st := range stmts {
+			if _, err := q.ExecContext(ctx, st.query, st.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := ensureCanonicalEmailIndex(ctx, s.dbManager.conn, s.userDAO); err != nil {
+		return fmt.Errorf("merged, but could not index canonical emails: %w", err)
+	}
+	return nil
+}
+
 // --- Migration Management ---
 func setupDatabase(db *sql.DB) {
 	log.Println("Setting up database schema...")
@@ -178,6 +420,7 @@ func setupDatabase(db *sql.DB) {
 	CREATE TABLE IF NOT EXISTS posts (id TEXT PRIMARY KEY, user_id TEXT, title TEXT, content TEXT, status TEXT, FOREIGN KEY(user_id) REFERENCES users(id));
 	CREATE TABLE IF NOT EXISTS roles (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT UNIQUE);
 	CREATE TABLE IF NOT EXISTS user_roles (user_id TEXT, role_id INTEGER, PRIMARY KEY (user_id, role_id), FOREIGN KEY(user_id) REFERENCES users(id), FOREIGN KEY(role_id) REFERENCES roles(id));
+	CREATE TABLE IF NOT EXISTS user_merges (merged_id TEXT PRIMARY KEY, merged_email TEXT, into_id TEXT, merged_at TIMESTAMP);
 	`
 	_, err := db.Exec(schema)
 	if err != nil {
@@ -186,6 +429,88 @@ func setupDatabase(db *sql.DB) {
 	log.Println("Schema setup complete.")
 }
 
+const canonicalEmailIndex = "users_email_canonical"
+
+// migrateCanonicalEmails adds and (re)computes users.email_canonical under
+// canon, so it can be re-run after the domain policies change. It returns the
+// users that now collide; the unique index is only created once there are
+// none, and MergeUsers retries it after every merge.
+func migrateCanonicalEmails(ctx context.Context, db *sql.DB, canon *EmailCanonicalizer) ([]DuplicateEmailGroup, error) {
+	var hasColumn int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('users') WHERE name = 'email_canonical'").Scan(&hasColumn); err != nil {
+		return nil, err
+	}
+	if hasColumn == 0 {
+		if _, err := db.ExecContext(ctx, "ALTER TABLE users ADD COLUMN email_canonical TEXT"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Read everything before writing: with one connection, an open result
+	// set would block the updates.
+	rows, err := db.QueryContext(ctx, "SELECT id, email FROM users")
+	if err != nil {
+		return nil, err
+	}
+	type pending struct{ id, canonical string }
+	var updates []pending
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		canonical, err := canon.Canonical(email)
+		if err != nil {
+			log.Printf("User %s has an unparseable email %q; keeping it as-is", id, email)
+			canonical = strings.ToLower(strings.TrimSpace(email))
+		}
+		updates = append(updates, pending{id, canonical})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = NewDBManager(db).ExecuteInTransaction(ctx, func(q Querier) error {
+		if _, err := q.ExecContext(ctx, "DROP INDEX IF EXISTS "+canonicalEmailIndex); err != nil {
+			return err
+		}
+		for _, p := range updates {
+			if _, err := q.ExecContext(ctx, "UPDATE users SET email_canonical = ? WHERE id = ?", p.canonical, p.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dao := &UserDAO{canon: canon}
+	dups, err := dao.FindDuplicates(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(dups) == 0 {
+		if _, err := ensureCanonicalEmailIndex(ctx, db, dao); err != nil {
+			return nil, err
+		}
+	}
+	return dups, nil
+}
+
+// ensureCanonicalEmailIndex creates the unique index on email_canonical
+// unless duplicates still stand in the way; created reports which.
+func ensureCanonicalEmailIndex(ctx context.Context, q Querier, dao *UserDAO) (created bool, err error) {
+	dups, err := dao.FindDuplicates(ctx, q)
+	if err != nil || len(dups) > 0 {
+		return false, err
+	}
+	_, err = q.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS "+canonicalEmailIndex+" ON users(email_canonical)")
+	return err == nil, err
+}
+
 func main() {
 	ctx := context.Background()
 	db, err := sql.Open("sqlite3", ":memory:")
@@ -193,11 +518,30 @@ func main() {
 		log.Fatalf("Cannot open database: %v", err)
 	}
 	defer db.Close()
+	// Every connection to ":memory:" opens its own empty database.
+	db.SetMaxOpenConns(1)
 
 	setupDatabase(db)
 
+	// Rows written before canonicalization existed: both are the same Gmail
+	// mailbox, which the byte-for-byte UNIQUE constraint let through.
+	for _, email := range []string{"Legacy.User@gmail.com", "legacyuser+news@googlemail.com"} {
+		id, _ := createUUID()
+		if _, err := db.ExecContext(ctx, "INSERT INTO users (id, email, password_hash, is_active, created_at) VALUES (?, ?, 'legacy', 1, ?)", id, email, time.Now().UTC()); err != nil {
+			log.Fatalf("Failed to seed legacy user: %v", err)
+		}
+	}
+	canon := DefaultEmailCanonicalizer()
+	dups, err := migrateCanonicalEmails(ctx, db, canon)
+	if err != nil {
+		log.Fatalf("Canonical email migration failed: %v", err)
+	}
+	for _, g := range dups {
+		log.Printf("Duplicate canonical email %s: %d users", g.Canonical, len(g.Users))
+	}
+
 	dbManager := NewDBManager(db)
-	userService := NewUserService(dbManager)
+	userService := NewUserService(dbManager, canon)
 
 	// 1. CRUD and M-M Demo via Service Layer
 	log.Println("\n--- Service Layer Demo (CRUD, M-M, Transaction) ---")
@@ -225,7 +569,7 @@ func main() {
 	// 3. Transaction Rollback Demo
 	log.Println("\n--- Transaction Rollback Demo ---")
 	err = dbManager.ExecuteInTransaction(ctx, func(q Querier) error {
-		userDAO := &UserDAO{}
+		userDAO := &UserDAO{canon: canon}
 		u := &User{Email: "rollback@test.com", PasswordHash: "123", IsActive: false}
 		if err := userDAO.Insert(ctx, q, u); err != nil {
 			return err
@@ -256,4 +600,84 @@ func main() {
 		foundUsers = append(foundUsers, &u)
 	}
 	log.Printf("Found %d users with filter: %+v", len(foundUsers), foundUsers)
+
+	// 5. Duplicate Email Race
+	log.Println("\n--- Duplicate Email Race Demo ---")
+	const racers = 10
+	var wg sync.WaitGroup
+	results := make(chan error, racers)
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := userService.RegisterUser(ctx, "race@example.com", "password123")
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+	succeeded, rejected := 0, 0
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrEmailInUse):
+			rejected++
+		default:
+			log.Fatalf("Unexpected registration error: %v", err)
+		}
+	}
+	if succeeded != 1 || rejected != racers-1 {
+		log.Fatalf("Expected 1 registration and %d rejections, got %d and %d", racers-1, succeeded, rejected)
+	}
+	log.Printf("%d concurrent registrations: 1 succeeded, %d got ErrEmailInUse", racers, rejected)
+
+	// 6. Idempotent Import
+	log.Println("\n--- Idempotent Import Demo ---")
+	batch := func() []*User {
+		return []*User{
+			{Email: "service.user@example.com", PasswordHash: "imported", IsActive: true},
+			{Email: "import.user@example.com", PasswordHash: "imported", IsActive: true},
+		}
+	}
+	for run := 1; run <= 2; run++ {
+		created, err := userService.ImportUsers(ctx, batch())
+		if err != nil {
+			log.Fatalf("Import run %d failed: %v", run, err)
+		}
+		log.Printf("Import run %d created %d new user(s)", run, created)
+	}
+
+	// 7. Canonical Email Uniqueness
+	log.Println("\n--- Canonical Email Demo ---")
+	for _, email := range []string{" Service.User@Example.com ", "legacy.user+promo@gmail.com"} {
+		if _, err := userService.RegisterUser(ctx, email, "password123"); !errors.Is(err, ErrEmailInUse) {
+			log.Fatalf("Registering %q: expected ErrEmailInUse, got %v", email, err)
+		}
+	}
+	found, err := userService.FindUserByEmail(ctx, "SERVICE.USER@example.com")
+	if err != nil {
+		log.Fatalf("Lookup by canonical email failed: %v", err)
+	}
+	log.Printf("Variant spellings are rejected; lookup found %s", found.Email)
+
+	// 8. Merging Legacy Duplicates
+	log.Println("\n--- Duplicate Merge Demo ---")
+	groups, err := userService.FindDuplicateEmails(ctx)
+	if err != nil {
+		log.Fatalf("Duplicate scan failed: %v", err)
+	}
+	for _, g := range groups {
+		keep := g.Users[0]
+		for _, dup := range g.Users[1:] {
+			if err := userService.MergeUsers(ctx, keep.Id, dup.Id); err != nil {
+				log.Fatalf("Merging %s into %s failed: %v", dup.Email, keep.Email, err)
+			}
+			log.Printf("Merged %s into %s", dup.Email, keep.Email)
+		}
+	}
+	if groups, err = userService.FindDuplicateEmails(ctx); err != nil || len(groups) != 0 {
+		log.Fatalf("Expected no duplicates after merging, got %d (%v)", len(groups), err)
+	}
+	log.Println("No duplicates remain; email_canonical is now uniquely indexed")
 }
\ No newline at end of file
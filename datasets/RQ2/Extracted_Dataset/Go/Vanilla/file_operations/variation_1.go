@@ -3,21 +3,34 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
 	"log"
 	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // --- Domain Schema ---
@@ -56,12 +69,19 @@ type Post struct {
 // Mock database
 var mockUsers = make(map[string]User)
 var mockPosts = make(map[string]Post)
-var mockPostAttachments = make(map[string]string) // postID -> filePath
+var mockPostAttachments = make(map[string]string) // postID -> filePath, guarded by attachmentContent.mu
+var mockPostImages = make(map[string]PostImage)     // postID -> uploaded image metadata
+
+type PostImage struct {
+	Title  string
+	Format string
+}
 
 // --- Main Application ---
 
 func main() {
 	// Setup mock data
+	mockUsers["user-456"] = User{ID: "user-456", Email: "author@example.com", UserRole: UserRole, IsActive: true, CreatedAt: time.Now()}
 	mockPosts["post-123"] = Post{ID: "post-123", UserID: "user-456", Title: "My First Post", Content: "Hello World!", Status: PublishedStatus}
 	// Create a dummy file for download
 	tempDir := os.TempDir()
@@ -73,9 +93,28 @@ func main() {
 	mockPostAttachments["post-123"] = dummyFilePath
 	defer os.Remove(dummyFilePath)
 
+	blobDir := os.Getenv("BLOB_DIR")
+	if blobDir == "" {
+		blobDir = filepath.Join(tempDir, "post-blobs")
+	}
+	if attachmentBlobs, err = NewLocalBlobStore(blobDir); err != nil {
+		log.Fatalf("Failed to open blob store: %v", err)
+	}
+	attachmentContent = newContentIndex(attachmentBlobs)
+	if v := os.Getenv("MAX_ATTACHMENT_BYTES"); v != "" {
+		if maxAttachmentBytes, err = strconv.ParseInt(v, 10, 64); err != nil || maxAttachmentBytes <= 0 {
+			log.Fatalf("MAX_ATTACHMENT_BYTES must be a positive integer, got %q", v)
+		}
+	}
+
 	http.HandleFunc("/upload-users-csv", handleUserCsvUpload)
 	http.HandleFunc("/upload-post-image", handlePostImageUpload)
+	http.HandleFunc("/upload-post-attachment", handlePostAttachmentUpload)
+	http.HandleFunc("/delete-post-attachment", handlePostAttachmentDelete)
 	http.HandleFunc("/download-post-attachment", handleFileDownload)
+	http.HandleFunc("/post-attachment-url", handleSignedURLRequest)
+	http.HandleFunc("/admin/rotate-signing-key", handleSigningKeyRotation)
+	http.HandleFunc("/admin/attachment-dedup", handleDedupReport)
 
 	log.Println("Server starting on :8080...")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -91,19 +130,35 @@ func handleUserCsvUpload(responseWriter http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	parsedFiles, err := parseMultipartRequestManually(request)
+	form, err := parseMultipartRequestManually(request)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error parsing multipart form: %v", err), http.StatusBadRequest)
 		return
 	}
-
 	// Clean up all temporary files created during parsing
-	for _, tempFile := range parsedFiles {
-		defer os.Remove(tempFile.Name())
+	defer form.RemoveAll()
+
+	// Optional form fields: default_role fills rows with an empty role column,
+	// active=false imports the users as deactivated.
+	defaultRole := UserRole
+	if value := form.Value("default_role"); value != "" {
+		defaultRole = Role(strings.ToUpper(value))
+		if defaultRole != AdminRole && defaultRole != UserRole {
+			http.Error(responseWriter, "default_role must be ADMIN or USER", http.StatusBadRequest)
+			return
+		}
+	}
+	active := true
+	if value := form.Value("active"); value != "" {
+		active, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(responseWriter, "active must be a boolean", http.StatusBadRequest)
+			return
+		}
 	}
 
 	var usersFile *os.File
-	for _, f := range parsedFiles {
+	for _, f := range form.Files {
 		// In a real app, you'd check the form field name, e.g., from f.FieldName
 		if strings.HasSuffix(f.FileName, ".csv") {
 			usersFile = f.File
@@ -122,7 +177,7 @@ func handleUserCsvUpload(responseWriter http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	users, err := processCsvData(usersFile)
+	users, err := processCsvData(usersFile, defaultRole, active)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error processing CSV: %v", err), http.StatusInternalServerError)
 		return
@@ -144,19 +199,27 @@ func handlePostImageUpload(responseWriter http.ResponseWriter, request *http.Req
 		return
 	}
 
-	parsedFiles, err := parseMultipartRequestManually(request)
+	form, err := parseMultipartRequestManually(request)
 	if err != nil {
 		http.Error(responseWriter, fmt.Sprintf("Error parsing multipart form: %v", err), http.StatusBadRequest)
 		return
 	}
-
 	// Clean up all temporary files
-	for _, tempFile := range parsedFiles {
-		defer os.Remove(tempFile.Name())
+	defer form.RemoveAll()
+
+	postID := form.Value("post_id")
+	if postID == "" {
+		http.Error(responseWriter, "Missing post_id form field", http.StatusBadRequest)
+		return
+	}
+	if _, ok := mockPosts[postID]; !ok {
+		http.Error(responseWriter, "Post not found", http.StatusNotFound)
+		return
 	}
+	title := strings.TrimSpace(form.Value("title"))
 
 	var imageFile *os.File
-	for _, f := range parsedFiles {
+	for _, f := range form.Files {
 		// A simple check for image content types
 		contentType := mime.TypeByExtension(filepath.Ext(f.FileName))
 		if strings.HasPrefix(contentType, "image/") {
@@ -182,24 +245,259 @@ func handlePostImageUpload(responseWriter http.ResponseWriter, request *http.Req
 	}
 
 	// In a real app, you would save this resized image permanently
-	log.Printf("Image successfully resized. Original format: %s", format)
+	_ = resizedImage
+	mockPostImages[postID] = PostImage{Title: title, Format: format}
+	log.Printf("Image for post %s successfully resized. Original format: %s", postID, format)
 
 	responseWriter.WriteHeader(http.StatusOK)
 	fmt.Fprintf(responseWriter, "Image uploaded and resized successfully.")
 }
 
-func handleFileDownload(responseWriter http.ResponseWriter, request *http.Request) {
-	postID := request.URL.Query().Get("post_id")
-	if postID == "" {
-		http.Error(responseWriter, "Missing post_id query parameter", http.StatusBadRequest)
+// handlePostAttachmentUpload streams the file part straight into the blob
+// store instead of spooling it to a temp file first, so a large attachment is
+// written to disk once. Content already stored under the same SHA-256 is
+// shared rather than kept twice. Only the post's author, authenticated by
+// session token, may upload.
+func handlePostAttachmentUpload(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller, err := authenticatedUser(request, time.Now())
+	if err != nil {
+		unauthorized(responseWriter, err)
 		return
 	}
 
-	filePath, ok := mockPostAttachments[postID]
+	form, err := parseMultipartToBlobs(request, attachmentBlobs, maxAttachmentBytes)
+	if errors.Is(err, errBlobTooLarge) {
+		http.Error(responseWriter, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(responseWriter, fmt.Sprintf("Error parsing multipart form: %v", err), http.StatusBadRequest)
+		return
+	}
+	// Blobs are only kept once they are attached below.
+	keep := false
+	defer func() {
+		if !keep {
+			form.discardBlobs()
+		}
+	}()
+
+	post, ok := mockPosts[form.Value("post_id")]
 	if !ok {
+		http.Error(responseWriter, "Post not found", http.StatusNotFound)
+		return
+	}
+	if caller.ID != post.UserID {
+		http.Error(responseWriter, "Only the post author may upload its attachment", http.StatusForbidden)
+		return
+	}
+	if len(form.Blobs) != 1 {
+		http.Error(responseWriter, "Exactly one file part is required", http.StatusBadRequest)
+		return
+	}
+
+	blob, deduplicated := attachmentContent.attach(post.ID, form.Blobs[0])
+	keep = true
+	if deduplicated {
+		log.Printf("Linked %d-byte attachment for post %s to existing blob %s (sha256 %s)", blob.Size, post.ID, blob.Key, blob.SHA256)
+	} else {
+		log.Printf("Stored %d-byte attachment %s for post %s (sha256 %s)", blob.Size, blob.Key, post.ID, blob.SHA256)
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(http.StatusCreated)
+	json.NewEncoder(responseWriter).Encode(struct {
+		StoredBlob
+		Deduplicated bool `json:"deduplicated"`
+	}{blob, deduplicated})
+}
+
+// handlePostAttachmentDelete detaches a post's attachment. The blob itself is
+// only deleted once no other post links to it. Only the post's author,
+// authenticated by session token, may delete.
+func handlePostAttachmentDelete(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller, err := authenticatedUser(request, time.Now())
+	if err != nil {
+		unauthorized(responseWriter, err)
+		return
+	}
+
+	post, ok := mockPosts[request.URL.Query().Get("post_id")]
+	if !ok {
+		http.Error(responseWriter, "Post not found", http.StatusNotFound)
+		return
+	}
+	if caller.ID != post.UserID {
+		http.Error(responseWriter, "Only the post author may delete its attachment", http.StatusForbidden)
+		return
+	}
+	found, err := attachmentContent.detach(post.ID)
+	if !found {
+		http.Error(responseWriter, "Attachment not found for the given post", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Could not delete attachment blob of post %s: %v", post.ID, err)
+	}
+	responseWriter.WriteHeader(http.StatusNoContent)
+}
+
+// handleSignedURLRequest issues a temporary download URL for a post's
+// attachment. Only the post's author, authenticated by session token, may
+// request one.
+func handleSignedURLRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params struct {
+		PostID       string `json:"post_id"`
+		TTLSeconds   int    `json:"ttl_seconds"`
+		BindIP       bool   `json:"bind_ip"`
+		MaxDownloads int    `json:"max_downloads"`
+	}
+	if err := json.NewDecoder(io.LimitReader(request.Body, 4096)).Decode(&params); err != nil {
+		http.Error(responseWriter, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	caller, err := authenticatedUser(request, time.Now())
+	if err != nil {
+		unauthorized(responseWriter, err)
+		return
+	}
+	post, ok := mockPosts[params.PostID]
+	if !ok {
+		http.Error(responseWriter, "Post not found", http.StatusNotFound)
+		return
+	}
+	if caller.ID != post.UserID {
+		http.Error(responseWriter, "Only the post author may share its attachment", http.StatusForbidden)
+		return
+	}
+	filePath, ok := attachmentContent.attachment(params.PostID)
+	if !ok {
+		http.Error(responseWriter, "Attachment not found for the given post", http.StatusNotFound)
+		return
+	}
+
+	ttl := defaultSignedURLTTL
+	if params.TTLSeconds > 0 {
+		ttl = time.Duration(params.TTLSeconds) * time.Second
+	}
+	if ttl > maxSignedURLTTL {
+		http.Error(responseWriter, fmt.Sprintf("ttl_seconds may not exceed %d", int(maxSignedURLTTL.Seconds())), http.StatusBadRequest)
+		return
+	}
+	if params.MaxDownloads < 0 {
+		http.Error(responseWriter, "max_downloads must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	grant := downloadGrant{
+		PostID:       params.PostID,
+		FileName:     filepath.Base(filePath),
+		ExpiresAt:    time.Now().Add(ttl).Unix(),
+		MaxDownloads: params.MaxDownloads,
+	}
+	if params.BindIP {
+		grant.IP = clientIP(request)
+	}
+	query, err := signingKeys.sign(grant)
+	if err != nil {
+		http.Error(responseWriter, "Could not sign URL", http.StatusInternalServerError)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(responseWriter).Encode(map[string]interface{}{
+		"url":        "/download-post-attachment?" + query.Encode(),
+		"expires_at": time.Unix(grant.ExpiresAt, 0).UTC(),
+	})
+}
+
+// handleSigningKeyRotation replaces the signing key, which revokes every
+// signed URL issued so far. Requires the ADMIN_TOKEN in X-Admin-Token.
+func handleSigningKeyRotation(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(request) {
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	kid, err := signingKeys.rotate()
+	if err != nil {
+		http.Error(responseWriter, "Could not rotate key", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Signing key rotated to %s; previously issued URLs are revoked", kid)
+	responseWriter.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(responseWriter).Encode(map[string]string{"key_id": kid})
+}
+
+// handleDedupReport returns the deduplication counters and the content that
+// was uploaded most often. Requires the ADMIN_TOKEN in X-Admin-Token.
+func handleDedupReport(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isAdmin(request) {
+		http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit := 10
+	if v := request.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(responseWriter, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(responseWriter).Encode(map[string]interface{}{
+		"stats":          attachmentContent.stats(),
+		"top_duplicates": attachmentContent.mostDuplicated(limit),
+	})
+}
+
+// isAdmin reports whether the request carries the ADMIN_TOKEN. With no token
+// configured every admin endpoint is closed.
+func isAdmin(request *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	return token != "" && subtle.ConstantTimeCompare([]byte(request.Header.Get("X-Admin-Token")), []byte(token)) == 1
+}
+
+// handleFileDownload serves an attachment only for a valid signed URL.
+func handleFileDownload(responseWriter http.ResponseWriter, request *http.Request) {
+	grant, err := signingKeys.verify(request.URL.Query(), clientIP(request), time.Now())
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	filePath, ok := attachmentContent.attachment(grant.PostID)
+	if !ok || filepath.Base(filePath) != grant.FileName {
+		// The attachment was removed or replaced since the URL was issued.
 		http.Error(responseWriter, "Attachment not found for the given post", http.StatusNotFound)
 		return
 	}
+	if !downloadCounter.take(grant) {
+		http.Error(responseWriter, "Download limit reached for this link", http.StatusGone)
+		return
+	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -226,6 +524,473 @@ func handleFileDownload(responseWriter http.ResponseWriter, request *http.Reques
 	log.Printf("Streamed %d bytes for download.", bytesCopied)
 }
 
+// --- Session Authentication ---
+
+// Session tokens are minted by the auth service, which shares SESSION_SECRET
+// with this one, and sent as "Authorization: Bearer <token>". A token is
+// "<base64url user ID>.<unix expiry>.<base64url HMAC-SHA256 of both>". With
+// no secret configured nobody is authenticated.
+
+var errUnauthenticated = errors.New("a valid session token is required")
+
+// authenticatedUser returns the active user named by the request's session
+// token.
+func authenticatedUser(request *http.Request, now time.Time) (User, error) {
+	secret := os.Getenv("SESSION_SECRET")
+	token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if secret == "" || !ok {
+		return User{}, errUnauthenticated
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(mac([]byte(secret), parts[0]+"."+parts[1]))) {
+		return User{}, errUnauthenticated
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return User{}, errUnauthenticated
+	}
+	id, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return User{}, errUnauthenticated
+	}
+	user, ok := mockUsers[string(id)]
+	if !ok || !user.IsActive {
+		return User{}, errUnauthenticated
+	}
+	return user, nil
+}
+
+func unauthorized(responseWriter http.ResponseWriter, err error) {
+	responseWriter.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(responseWriter, err.Error(), http.StatusUnauthorized)
+}
+
+// --- Signed URLs ---
+
+const (
+	defaultSignedURLTTL = 15 * time.Minute
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+var (
+	errSignatureInvalid = errors.New("invalid or revoked download link")
+	errSignatureExpired = errors.New("download link has expired")
+	errSignatureIP      = errors.New("download link is not valid from this address")
+)
+
+// downloadGrant is everything a signed URL vouches for. MaxDownloads of 0
+// means unlimited; an empty IP means any address.
+type downloadGrant struct {
+	PostID       string
+	FileName     string
+	ExpiresAt    int64
+	IP           string
+	MaxDownloads int
+	Nonce        string
+}
+
+func (g downloadGrant) canonical() string {
+	return strings.Join([]string{g.PostID, g.FileName, strconv.FormatInt(g.ExpiresAt, 10), g.IP, strconv.Itoa(g.MaxDownloads), g.Nonce}, "\n")
+}
+
+// keyRing holds the single active HMAC key. URLs carry its id, so after a
+// rotation old links fail fast as revoked rather than as tampered.
+type keyRing struct {
+	mu  sync.RWMutex
+	kid string
+	key []byte
+}
+
+var signingKeys = mustNewKeyRing()
+
+func mustNewKeyRing() *keyRing {
+	k := &keyRing{}
+	if _, err := k.rotate(); err != nil {
+		log.Fatalf("Failed to create signing key: %v", err)
+	}
+	return k
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (k *keyRing) rotate() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	kid, err := randomHex(4)
+	if err != nil {
+		return "", err
+	}
+	k.mu.Lock()
+	k.kid, k.key = kid, key
+	k.mu.Unlock()
+	return kid, nil
+}
+
+func mac(key []byte, message string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (k *keyRing) sign(g downloadGrant) (url.Values, error) {
+	nonce, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	g.Nonce = nonce
+
+	k.mu.RLock()
+	kid, sig := k.kid, mac(k.key, g.canonical())
+	k.mu.RUnlock()
+
+	q := url.Values{}
+	q.Set("post_id", g.PostID)
+	q.Set("file", g.FileName)
+	q.Set("exp", strconv.FormatInt(g.ExpiresAt, 10))
+	if g.IP != "" {
+		q.Set("ip", g.IP)
+	}
+	if g.MaxDownloads > 0 {
+		q.Set("max", strconv.Itoa(g.MaxDownloads))
+	}
+	q.Set("nonce", g.Nonce)
+	q.Set("kid", kid)
+	q.Set("sig", sig)
+	return q, nil
+}
+
+func (k *keyRing) verify(q url.Values, ip string, now time.Time) (downloadGrant, error) {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return downloadGrant{}, errSignatureInvalid
+	}
+	max := 0
+	if v := q.Get("max"); v != "" {
+		if max, err = strconv.Atoi(v); err != nil {
+			return downloadGrant{}, errSignatureInvalid
+		}
+	}
+	g := downloadGrant{
+		PostID:       q.Get("post_id"),
+		FileName:     q.Get("file"),
+		ExpiresAt:    exp,
+		IP:           q.Get("ip"),
+		MaxDownloads: max,
+		Nonce:        q.Get("nonce"),
+	}
+
+	k.mu.RLock()
+	valid := q.Get("kid") == k.kid && hmac.Equal([]byte(q.Get("sig")), []byte(mac(k.key, g.canonical())))
+	k.mu.RUnlock()
+	switch {
+	case !valid || g.Nonce == "":
+		return downloadGrant{}, errSignatureInvalid
+	case now.Unix() > g.ExpiresAt:
+		return downloadGrant{}, errSignatureExpired
+	case g.IP != "" && g.IP != ip:
+		return downloadGrant{}, errSignatureIP
+	}
+	return g, nil
+}
+
+// downloadCounts tracks uses per link nonce for links with a download cap.
+type downloadCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+	expiry map[string]int64
+}
+
+var downloadCounter = &downloadCounts{counts: make(map[string]int), expiry: make(map[string]int64)}
+
+// take consumes one download from the grant and reports whether one was left.
+func (d *downloadCounts) take(g downloadGrant) bool {
+	if g.MaxDownloads == 0 {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	for nonce, exp := range d.expiry {
+		if now > exp {
+			delete(d.counts, nonce)
+			delete(d.expiry, nonce)
+		}
+	}
+	if d.counts[g.Nonce] >= g.MaxDownloads {
+		return false
+	}
+	d.counts[g.Nonce]++
+	d.expiry[g.Nonce] = g.ExpiresAt
+	return true
+}
+
+// clientIP uses the connection address; forwarding headers are not trusted
+// because they would let a client claim the bound IP.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// --- Blob Storage ---
+
+var (
+	attachmentBlobs    BlobStore
+	maxAttachmentBytes int64 = 100 << 20
+)
+
+var errBlobTooLarge = errors.New("file exceeds size limit")
+
+type BlobStore interface {
+	Put(key string, r io.Reader) (int64, error)
+	Delete(key string) error
+	Path(key string) string
+}
+
+// LocalBlobStore keeps blobs as files in a single directory. Put writes to a
+// temp file beside the target and renames it, so readers never see a
+// partial blob and a failed upload leaves nothing behind.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+func (s *LocalBlobStore) Path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+func (s *LocalBlobStore) Put(key string, r io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(s.dir, ".put-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err := tmp.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), s.Path(key))
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+	err := os.Remove(s.Path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// StoredBlob describes a file part streamed into a BlobStore.
+type StoredBlob struct {
+	FieldName string `json:"field_name"`
+	FileName  string `json:"file_name"`
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// hashingLimitWriter hashes what passes through and fails the write that
+// would take the total past limit, aborting the upload mid-stream.
+type hashingLimitWriter struct {
+	dst     io.Writer
+	hash    hash.Hash
+	written int64
+	limit   int64
+}
+
+func (w *hashingLimitWriter) Write(p []byte) (int, error) {
+	if w.written+int64(len(p)) > w.limit {
+		return 0, errBlobTooLarge
+	}
+	n, err := w.dst.Write(p)
+	w.hash.Write(p[:n])
+	w.written += int64(n)
+	return n, err
+}
+
+// --- Content Deduplication ---
+
+var attachmentContent *contentIndex
+
+// contentRef is one stored blob and the attachments that point at it.
+type contentRef struct {
+	SHA256  string `json:"sha256"`
+	Key     string `json:"key"`
+	Size    int64  `json:"size"`
+	Refs    int    `json:"refs"`    // attachments currently linked
+	Uploads int    `json:"uploads"` // times this content was uploaded, ever
+}
+
+type DedupStats struct {
+	Uploads      int64 `json:"uploads"`
+	Deduplicated int64 `json:"deduplicated"`
+	BytesSaved   int64 `json:"bytes_saved"`
+	UniqueBlobs  int   `json:"unique_blobs"`
+	StoredBytes  int64 `json:"stored_bytes"`
+}
+
+// contentIndex maps SHA-256 digests to blobs so identical uploads share one
+// blob. Each blob is reference counted and deleted from the store when the
+// last attachment linking to it is released. Blobs it has not seen, such as
+// files placed outside the upload path, are never deleted by it. Its mutex
+// also guards mockPostAttachments, so a post's attachment and the blob's
+// reference count always change together.
+type contentIndex struct {
+	mu      sync.Mutex
+	store   BlobStore
+	byHash  map[string]*contentRef
+	byKey   map[string]*contentRef
+	counter DedupStats
+}
+
+func newContentIndex(store BlobStore) *contentIndex {
+	return &contentIndex{
+		store:  store,
+		byHash: make(map[string]*contentRef),
+		byKey:  make(map[string]*contentRef),
+	}
+}
+
+// attach links a freshly stored blob to postID, replacing and releasing any
+// attachment the post already had. If the same content is already stored,
+// the new copy is deleted and the returned blob carries the existing key; the
+// bool reports whether that happened.
+func (c *contentIndex) attach(postID string, blob StoredBlob) (StoredBlob, bool) {
+	var unused []string
+	c.mu.Lock()
+	c.counter.Uploads++
+	ref, deduplicated := c.byHash[blob.SHA256]
+	if !deduplicated || ref.Size != blob.Size {
+		deduplicated = false
+		ref = &contentRef{SHA256: blob.SHA256, Key: blob.Key, Size: blob.Size}
+		c.byHash[blob.SHA256] = ref
+		c.byKey[blob.Key] = ref
+		c.counter.UniqueBlobs++
+		c.counter.StoredBytes += blob.Size
+	} else {
+		c.counter.Deduplicated++
+		c.counter.BytesSaved += blob.Size
+		unused = append(unused, blob.Key)
+		blob.Key = ref.Key
+	}
+	ref.Refs++
+	ref.Uploads++
+	previous, replaced := mockPostAttachments[postID]
+	mockPostAttachments[postID] = c.store.Path(blob.Key)
+	if replaced {
+		if key, ok := c.releaseLocked(filepath.Base(previous)); ok {
+			unused = append(unused, key)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, key := range unused {
+		if err := c.store.Delete(key); err != nil {
+			log.Printf("Could not delete unused blob %s: %v", key, err)
+		}
+	}
+	return blob, deduplicated
+}
+
+// detach removes postID's attachment and deletes its blob once nothing else
+// links to it. The bool reports whether the post had an attachment.
+func (c *contentIndex) detach(postID string) (bool, error) {
+	c.mu.Lock()
+	filePath, ok := mockPostAttachments[postID]
+	if !ok {
+		c.mu.Unlock()
+		return false, nil
+	}
+	delete(mockPostAttachments, postID)
+	key, unused := c.releaseLocked(filepath.Base(filePath))
+	c.mu.Unlock()
+
+	if !unused {
+		return true, nil
+	}
+	return true, c.store.Delete(key)
+}
+
+// attachment returns the file path of postID's attachment.
+func (c *contentIndex) attachment(postID string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	filePath, ok := mockPostAttachments[postID]
+	return filePath, ok
+}
+
+// releaseLocked drops one reference to the blob under key and reports whether
+// it is now unused and should be deleted from the store. c.mu must be held.
+func (c *contentIndex) releaseLocked(key string) (string, bool) {
+	ref, ok := c.byKey[key]
+	if !ok {
+		return "", false
+	}
+	ref.Refs--
+	if ref.Refs > 0 {
+		return "", false
+	}
+	delete(c.byKey, key)
+	delete(c.byHash, ref.SHA256)
+	c.counter.UniqueBlobs--
+	c.counter.StoredBytes -= ref.Size
+	return key, true
+}
+
+func (c *contentIndex) stats() DedupStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counter
+}
+
+// mostDuplicated returns up to limit stored blobs that were uploaded more
+// than once, most uploads first, then largest.
+func (c *contentIndex) mostDuplicated(limit int) []contentRef {
+	c.mu.Lock()
+	refs := make([]contentRef, 0, len(c.byHash))
+	for _, ref := range c.byHash {
+		if ref.Uploads > 1 {
+			refs = append(refs, *ref)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Uploads != refs[j].Uploads {
+			return refs[i].Uploads > refs[j].Uploads
+		}
+		if refs[i].Size != refs[j].Size {
+			return refs[i].Size > refs[j].Size
+		}
+		return refs[i].SHA256 < refs[j].SHA256
+	})
+	if len(refs) > limit {
+		refs = refs[:limit]
+	}
+	return refs
+}
+
 // --- Helper Functions ---
 
 type ParsedFile struct {
@@ -234,8 +999,232 @@ type ParsedFile struct {
 	File      *os.File
 }
 
+// ParsedForm is the result of parsing a multipart body: file parts are spooled
+// to temp files and text parts are collected into Values.
+type ParsedForm struct {
+	Files  []ParsedFile
+	Blobs  []StoredBlob // file parts, in streaming mode
+	Values map[string][]string
+
+	blobStore BlobStore
+}
+
+// Value returns the first value of a text field, or "" if it was not sent.
+func (f *ParsedForm) Value(name string) string {
+	if values := f.Values[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// RemoveAll closes and deletes the temp files backing the file parts.
+func (f *ParsedForm) RemoveAll() {
+	for _, parsed := range f.Files {
+		parsed.File.Close()
+		os.Remove(parsed.File.Name())
+	}
+}
+
+// discardBlobs deletes blobs stored while parsing in streaming mode.
+func (f *ParsedForm) discardBlobs() {
+	for _, blob := range f.Blobs {
+		if err := f.blobStore.Delete(blob.Key); err != nil {
+			log.Printf("Could not delete blob %s: %v", blob.Key, err)
+		}
+	}
+}
+
+// Limits on text form fields. File parts are bounded by whoever receives
+// them, not here.
+const (
+	maxFormFieldBytes      = 64 << 10
+	maxFormFieldsTotalSize = 1 << 20
+	maxFormFields          = 100
+	maxPartHeaderBytes     = 8 << 10
+)
+
+var errFormFieldTooLarge = errors.New("form field exceeds size limit")
+
+// limitedBuffer fails writes that would grow it past limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errFormFieldTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// multipartStream reads the request body, holding any bytes read past a part
+// delimiter in pending so the next part starts where the last one ended.
+type multipartStream struct {
+	body    *bufio.Reader
+	pending []byte
+}
+
+func (m *multipartStream) Read(p []byte) (int, error) {
+	if len(m.pending) > 0 {
+		n := copy(p, m.pending)
+		m.pending = m.pending[n:]
+		return n, nil
+	}
+	return m.body.Read(p)
+}
+
+func (m *multipartStream) readLine() ([]byte, error) {
+	if idx := bytes.IndexByte(m.pending, '\n'); idx != -1 {
+		line := m.pending[:idx+1]
+		m.pending = m.pending[idx+1:]
+		return line, nil
+	}
+	rest, err := m.body.ReadBytes('\n')
+	line := append(m.pending, rest...)
+	m.pending = nil
+	return line, err
+}
+
+// copyPartBody streams one part body into dst up to the next delimiter and
+// reports whether that delimiter closed the multipart body.
+func (m *multipartStream) copyPartBody(dst io.Writer, delimiter []byte) (bool, error) {
+	var buffer [4096]byte
+	var overflow []byte // To handle a delimiter split across reads
+	for {
+		n, err := m.Read(buffer[:])
+		if n > 0 {
+			searchData := append(overflow, buffer[:n]...)
+			if idx := bytes.Index(searchData, delimiter); idx != -1 {
+				if _, wErr := dst.Write(searchData[:idx]); wErr != nil {
+					return false, wErr
+				}
+				after := searchData[idx+len(delimiter):]
+				// Need two bytes to tell "--" (closing) from CRLF (next part).
+				for len(after) < 2 {
+					n, err := m.Read(buffer[:])
+					after = append(after, buffer[:n]...)
+					if err != nil && len(after) < 2 {
+						return false, errors.New("unexpected EOF after boundary")
+					}
+				}
+				if bytes.HasPrefix(after, []byte("--")) {
+					return true, nil
+				}
+				m.pending = append(append([]byte{}, after...), m.pending...)
+				// Drop the rest of the boundary line.
+				if _, err := m.readLine(); err != nil {
+					return false, err
+				}
+				return false, nil
+			}
+
+			// Delimiter not found, write all but the tail that could be a partial delimiter
+			writeLen := len(searchData) - len(delimiter)
+			if writeLen < 0 {
+				writeLen = 0
+			}
+			if _, wErr := dst.Write(searchData[:writeLen]); wErr != nil {
+				return false, wErr
+			}
+			overflow = append([]byte{}, searchData[writeLen:]...)
+		}
+		if err == io.EOF {
+			return false, errors.New("unexpected EOF, missing final boundary")
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// readPartHeaders reads header lines up to the blank line ending them.
+func (m *multipartStream) readPartHeaders() (map[string]string, error) {
+	headers := make(map[string]string)
+	total := 0
+	for {
+		line, err := m.readLine()
+		if err != nil {
+			return nil, fmt.Errorf("error reading part headers: %w", err)
+		}
+		total += len(line)
+		if total > maxPartHeaderBytes {
+			return nil, errors.New("part headers too large")
+		}
+		trimmed := strings.TrimSpace(string(line))
+		if trimmed == "" { // End of headers
+			return headers, nil
+		}
+		name, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed part header: %q", trimmed)
+		}
+		headers[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+}
+
+// filePartSink supplies the writer a file part's body is copied into, and a
+// finish func that is given the copy's outcome and returns the part's result.
+type filePartSink func(form *ParsedForm, fieldName, fileName string) (dst io.Writer, finish func(copyErr error) error, err error)
+
 // parseMultipartRequestManually demonstrates manual stream parsing of a multipart request.
-func parseMultipartRequestManually(request *http.Request) ([]ParsedFile, error) {
+// File parts are written to temp files; text parts are captured as form values,
+// which must be valid UTF-8 and stay within the form field limits.
+func parseMultipartRequestManually(request *http.Request) (*ParsedForm, error) {
+	return parseMultipart(request, nil, func(form *ParsedForm, fieldName, fileName string) (io.Writer, func(error) error, error) {
+		tempFile, err := os.CreateTemp("", "upload-*-"+filepath.Base(fileName))
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create temp file: %w", err)
+		}
+		form.Files = append(form.Files, ParsedFile{FieldName: fieldName, FileName: fileName, File: tempFile})
+		return tempFile, func(copyErr error) error { return copyErr }, nil
+	})
+}
+
+// parseMultipartToBlobs is the streaming mode: each file part is piped into
+// store as it is read, hashed on the way, and cut off as soon as it passes
+// maxFileBytes. On error every blob already stored is deleted.
+func parseMultipartToBlobs(request *http.Request, store BlobStore, maxFileBytes int64) (*ParsedForm, error) {
+	return parseMultipart(request, store, func(form *ParsedForm, fieldName, fileName string) (io.Writer, func(error) error, error) {
+		key, err := randomHex(16)
+		if err != nil {
+			return nil, nil, err
+		}
+		pr, pw := io.Pipe()
+		type putResult struct {
+			size int64
+			err  error
+		}
+		done := make(chan putResult, 1)
+		go func() {
+			n, err := store.Put(key, pr)
+			pr.CloseWithError(err) // unblock the parser if Put gave up early
+			done <- putResult{n, err}
+		}()
+		w := &hashingLimitWriter{dst: pw, hash: sha256.New(), limit: maxFileBytes}
+		finish := func(copyErr error) error {
+			pw.CloseWithError(copyErr) // nil closes cleanly
+			res := <-done
+			if copyErr != nil {
+				return copyErr
+			}
+			if res.err != nil {
+				return fmt.Errorf("could not store %q: %w", fileName, res.err)
+			}
+			form.Blobs = append(form.Blobs, StoredBlob{
+				FieldName: fieldName,
+				FileName:  fileName,
+				Key:       key,
+				Size:      res.size,
+				SHA256:    hex.EncodeToString(w.hash.Sum(nil)),
+			})
+			return nil
+		}
+		return w, finish, nil
+	})
+}
+
+func parseMultipart(request *http.Request, store BlobStore, onFile filePartSink) (_ *ParsedForm, err error) {
 	contentType := request.Header.Get("Content-Type")
 	_, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
@@ -247,14 +1236,21 @@ func parseMultipartRequestManually(request *http.Request) ([]ParsedFile, error)
 		return nil, errors.New("no boundary found in content type")
 	}
 
-	var parsedFiles []ParsedFile
-	bodyReader := bufio.NewReader(request.Body)
+	form := &ParsedForm{Values: make(map[string][]string), blobStore: store}
+	defer func() {
+		if err != nil {
+			form.RemoveAll()
+			form.discardBlobs()
+		}
+	}()
+
+	stream := &multipartStream{body: bufio.NewReader(request.Body)}
 	boundaryBytes := []byte("--" + boundary)
-	finalBoundaryBytes := []byte("--" + boundary + "--")
+	delimiter := []byte("\r\n--" + boundary)
 
 	// Discard preamble before the first boundary
 	for {
-		line, err := bodyReader.ReadBytes('\n')
+		line, err := stream.readLine()
 		if err != nil {
 			return nil, fmt.Errorf("error finding first boundary: %w", err)
 		}
@@ -263,79 +1259,66 @@ func parseMultipartRequestManually(request *http.Request) ([]ParsedFile, error)
 		}
 	}
 
+	fieldCount, fieldBytes := 0, 0
 	for {
-		var partHeaders strings.Builder
-		for {
-			line, err := bodyReader.ReadBytes('\n')
-			if err != nil {
-				return nil, fmt.Errorf("error reading part headers: %w", err)
-			}
-			if len(bytes.TrimSpace(line)) == 0 { // End of headers
-				break
-			}
-			partHeaders.Write(line)
-		}
-
-		disposition, dispParams, err := mime.ParseMediaType(partHeaders.String())
-		if err != nil || !strings.HasPrefix(disposition, "Content-Disposition: form-data") {
-			// Not a file part we can handle, skip it
-			continue
+		headers, err := stream.readPartHeaders()
+		if err != nil {
+			return nil, err
 		}
 
-		fileName, hasFileName := dispParams["filename"]
-		if !hasFileName {
-			// This is a form field, not a file, skip for this example
-			continue
-		}
+		disposition, dispParams, err := mime.ParseMediaType(headers["content-disposition"])
 		fieldName := dispParams["name"]
+		fileName, hasFileName := dispParams["filename"]
 
-		tempFile, err := os.CreateTemp("", "upload-*-"+filepath.Base(fileName))
-		if err != nil {
-			return nil, fmt.Errorf("could not create temp file: %w", err)
-		}
-
-		// Stream part body to temp file, watching for the next boundary
-		var buffer [4096]byte
-		var overflow []byte // To handle boundary split across reads
-		for {
-			n, err := bodyReader.Read(buffer[:])
-			if n > 0 {
-				searchData := append(overflow, buffer[:n]...)
-				if idx := bytes.Index(searchData, boundaryBytes); idx != -1 {
-					// Boundary found. Write data before it.
-					if _, wErr := tempFile.Write(searchData[:idx]); wErr != nil {
-						return nil, wErr
-					}
-					// Check if it's the final boundary
-					if bytes.Contains(searchData[idx:], finalBoundaryBytes) {
-						return parsedFiles, nil // End of multipart data
-					}
-					goto nextPart
-				}
+		var final bool
+		switch {
+		case err != nil || disposition != "form-data" || fieldName == "":
+			// Not a part we can handle, skip its body
+			final, err = stream.copyPartBody(io.Discard, delimiter)
+			if err != nil {
+				return nil, err
+			}
 
-				// Boundary not found, write all but the tail that could be a partial boundary
-				writeLen := len(searchData) - len(boundaryBytes) - 2
-				if writeLen < 0 {
-					writeLen = 0
-				}
-				if _, wErr := tempFile.Write(searchData[:writeLen]); wErr != nil {
-					return nil, wErr
-				}
-				overflow = searchData[writeLen:]
+		case hasFileName:
+			dst, finish, err := onFile(form, fieldName, fileName)
+			if err != nil {
+				return nil, err
 			}
-			if err == io.EOF {
-				return nil, errors.New("unexpected EOF, missing final boundary")
+			final, err = stream.copyPartBody(dst, delimiter)
+			if err = finish(err); err != nil {
+				return nil, err
 			}
-			if err != nil {
+
+		default:
+			fieldCount++
+			if fieldCount > maxFormFields {
+				return nil, fmt.Errorf("too many form fields (max %d)", maxFormFields)
+			}
+			limit := maxFormFieldBytes
+			if remaining := maxFormFieldsTotalSize - fieldBytes; remaining < limit {
+				limit = remaining
+			}
+			value := &limitedBuffer{limit: limit}
+			if final, err = stream.copyPartBody(value, delimiter); err != nil {
+				if errors.Is(err, errFormFieldTooLarge) {
+					return nil, fmt.Errorf("form field %q: %w", fieldName, err)
+				}
 				return nil, err
 			}
+			if !utf8.Valid(value.Bytes()) {
+				return nil, fmt.Errorf("form field %q is not valid UTF-8", fieldName)
+			}
+			fieldBytes += value.Len()
+			form.Values[fieldName] = append(form.Values[fieldName], value.String())
+		}
+
+		if final {
+			return form, nil // End of multipart data
 		}
-	nextPart:
-		parsedFiles = append(parsedFiles, ParsedFile{FieldName: fieldName, FileName: fileName, File: tempFile})
 	}
 }
 
-func processCsvData(fileReader io.Reader) ([]User, error) {
+func processCsvData(fileReader io.Reader, defaultRole Role, active bool) ([]User, error) {
 	csvReader := csv.NewReader(fileReader)
 	// Assuming header: id,email,role
 	if _, err := csvReader.Read(); err != nil {
@@ -352,11 +1335,15 @@ func processCsvData(fileReader io.Reader) ([]User, error) {
 		if len(record) < 3 {
 			continue
 		}
+		role := Role(record[2])
+		if role == "" {
+			role = defaultRole
+		}
 		user := User{
 			ID:        record[0],
 			Email:     record[1],
-			UserRole:  Role(record[2]),
-			IsActive:  true,
+			UserRole:  role,
+			IsActive:  active,
 			CreatedAt: time.Now(),
 		}
 		users = append(users, user)
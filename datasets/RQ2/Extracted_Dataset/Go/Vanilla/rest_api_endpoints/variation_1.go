@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -66,6 +71,170 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
+// --- Compression Middleware ---
+
+// compressResponses wraps a handler so that textual responses of at least
+// minBytes are sent gzip- or deflate-encoded to clients that accept it.
+// Responses are buffered in full, which suits this API's bounded pages.
+func compressResponses(next http.Handler, minBytes int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buffered := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		body := encodeBody(w.Header(), r.Header.Get("Accept-Encoding"), buffered.buf.Bytes(), minBytes)
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
+
+type bufferedWriter struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) WriteHeader(code int)        { w.status = code }
+func (w *bufferedWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+// encodeBody compresses body when it is worth it and sets the headers that go
+// with the chosen encoding.
+func encodeBody(h http.Header, acceptEncoding string, body []byte, minBytes int) []byte {
+	if len(body) == 0 || h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		return body
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if enc := negotiateEncoding(acceptEncoding); enc != "" && len(body) >= minBytes {
+		if z, err := compressBody(enc, body); err == nil {
+			h.Set("Content-Encoding", enc)
+			body = z
+		}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	return body
+}
+
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasPrefix(ct, "text/") || ct == "application/json" ||
+		ct == "application/xml" || ct == "application/javascript" || strings.HasSuffix(ct, "+json")
+}
+
+// negotiateEncoding picks gzip, then deflate, skipping codings sent with q=0.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressBody uses zlib for "deflate", as RFC 9110 defines it.
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// --- Pagination Guards ---
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+	// Deeper pages than this are a full export in disguise.
+	maxListOffset = 10000
+)
+
+// exportURL points clients who want every user at the async export API.
+var exportURL = "/exports/users"
+
+// parseLimit caps limit at maxLimit. ok is false when the client asked for
+// everything (limit=all, 0 or negative), which is only available as an export.
+func parseLimit(raw string) (limit int, ok bool, err error) {
+	if raw == "" {
+		return defaultLimit, true, nil
+	}
+	if strings.EqualFold(raw, "all") {
+		return 0, false, nil
+	}
+	limit, err = strconv.Atoi(raw)
+	if err != nil {
+		return 0, false, fmt.Errorf("limit must be an integer")
+	}
+	if limit < 1 {
+		return 0, false, nil
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, true, nil
+}
+
+func respondUnbounded(w http.ResponseWriter) {
+	respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":      "Listing every user is not supported over HTTP; use the export API",
+		"export_url": exportURL,
+		"max_limit":  maxLimit,
+	})
+}
+
+// countCache saves recounting a filter's total on every page. Any write
+// clears it, and entries expire after ttl regardless.
+type countCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]countEntry
+}
+
+type countEntry struct {
+	n  int
+	at time.Time
+}
+
+func (cc *countCache) get(key string, count func() int) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if e, ok := cc.entries[key]; ok && time.Since(e.at) < cc.ttl {
+		return e.n
+	}
+	n := count()
+	cc.entries[key] = countEntry{n: n, at: time.Now()}
+	return n
+}
+
+func (cc *countCache) invalidate() {
+	cc.mu.Lock()
+	cc.entries = make(map[string]countEntry)
+	cc.mu.Unlock()
+}
+
+var userCounts = &countCache{ttl: 30 * time.Second, entries: make(map[string]countEntry)}
+
 // --- Request DTOs ---
 
 type CreateUserRequest struct {
@@ -162,6 +331,7 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	userStore[newUser.ID] = newUser
+	userCounts.invalidate()
 
 	respondWithJSON(w, http.StatusCreated, newUser)
 }
@@ -179,6 +349,22 @@ func getUserByID(w http.ResponseWriter, r *http.Request, id string) {
 }
 
 func listUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, bounded, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset := (page - 1) * limit
+	if !bounded || offset > maxListOffset {
+		respondUnbounded(w)
+		return
+	}
+
 	storeLock.RLock()
 	allUsers := make([]User, 0, len(userStore))
 	for _, user := range userStore {
@@ -187,7 +373,6 @@ func listUsers(w http.ResponseWriter, r *http.Request) {
 	storeLock.RUnlock()
 
 	// Filtering
-	query := r.URL.Query()
 	filteredUsers := []User{}
 	roleFilter := query.Get("role")
 	isActiveFilter := query.Get("is_active")
@@ -213,16 +398,10 @@ func listUsers(w http.ResponseWriter, r *http.Request) {
 		return filteredUsers[i].CreatedAt.Before(filteredUsers[j].CreatedAt)
 	})
 
+	total := userCounts.get(roleFilter+"|"+isActiveFilter, func() int { return len(filteredUsers) })
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
 	// Pagination
-	page, _ := strconv.Atoi(query.Get("page"))
-	if page < 1 {
-		page = 1
-	}
-	limit, _ := strconv.Atoi(query.Get("limit"))
-	if limit <= 0 {
-		limit = 10
-	}
-	offset := (page - 1) * limit
 	if offset >= len(filteredUsers) {
 		respondWithJSON(w, http.StatusOK, []User{})
 		return
@@ -263,6 +442,7 @@ func updateUser(w http.ResponseWriter, r *http.Request, id string) {
 	}
 
 	userStore[id] = user
+	userCounts.invalidate()
 	respondWithJSON(w, http.StatusOK, user)
 }
 
@@ -276,6 +456,7 @@ func deleteUser(w http.ResponseWriter, r *http.Request, id string) {
 	}
 
 	delete(userStore, id)
+	userCounts.invalidate()
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -291,9 +472,20 @@ func main() {
 	userStore[id3] = User{ID: id3, Email: "user2@example.com", PasswordHash: "...", Role: RoleUser, IsActive: false, CreatedAt: time.Now().UTC().Add(time.Hour)}
 
 	http.HandleFunc("/users/", usersHandler)
+	if url := os.Getenv("USERS_EXPORT_URL"); url != "" {
+		exportURL = url
+	}
+	minBytes := 1024
+	if v := os.Getenv("COMPRESS_MIN_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("COMPRESS_MIN_BYTES must be a non-negative integer, got %q", v)
+		}
+		minBytes = n
+	}
 
 	log.Println("Starting server on :8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	if err := http.ListenAndServe(":8080", compressResponses(http.DefaultServeMux, minBytes)); err != nil {
 		log.Fatalf("Could not start server: %s\n", err)
 	}
 }
\ No newline at end of file
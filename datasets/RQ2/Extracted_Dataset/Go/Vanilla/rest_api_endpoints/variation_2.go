@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -31,6 +32,51 @@ type User struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// --- Domain Errors ---
+
+// ErrorKind classifies what the repository reports, so handlers choose a
+// status code by kind in writeError instead of reading error text.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindConflict
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	default:
+		return "internal"
+	}
+}
+
+// DomainError carries a kind and the resource and field it is about.
+type DomainError struct {
+	Kind     ErrorKind
+	Resource string
+	Field    string
+	Message  string
+}
+
+func (e *DomainError) Error() string { return e.Message }
+
+var ErrUserNotFound = &DomainError{Kind: KindNotFound, Resource: "user", Message: "User not found"}
+
+func errEmailTaken(email string) error {
+	return &DomainError{Kind: KindConflict, Resource: "user", Field: "email", Message: fmt.Sprintf("email '%s' already exists", email)}
+}
+
+var statusByKind = map[ErrorKind]int{
+	KindInternal: http.StatusInternalServerError,
+	KindNotFound: http.StatusNotFound,
+	KindConflict: http.StatusConflict,
+}
+
 // --- Data Layer (Repository) ---
 
 type UserRepository struct {
@@ -50,18 +96,21 @@ func (r *UserRepository) Create(user User) (User, error) {
 
 	for _, u := range r.users {
 		if u.Email == user.Email {
-			return User{}, fmt.Errorf("email '%s' already exists", user.Email)
+			return User{}, errEmailTaken(user.Email)
 		}
 	}
 	r.users[user.ID] = user
 	return user, nil
 }
 
-func (r *UserRepository) FindByID(id string) (User, bool) {
+func (r *UserRepository) FindByID(id string) (User, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	user, found := r.users[id]
-	return user, found
+	if !found {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
 }
 
 func (r *UserRepository) FindAll() []User {
@@ -74,25 +123,30 @@ func (r *UserRepository) FindAll() []User {
 	return users
 }
 
-func (r *UserRepository) Update(id string, user User) (User, bool) {
+func (r *UserRepository) Update(id string, user User) (User, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, found := r.users[id]; !found {
-		return User{}, false
+		return User{}, ErrUserNotFound
+	}
+	for otherID, u := range r.users {
+		if otherID != id && u.Email == user.Email {
+			return User{}, errEmailTaken(user.Email)
+		}
 	}
 	user.ID = id // Ensure ID is not changed
 	r.users[id] = user
-	return user, true
+	return user, nil
 }
 
-func (r *UserRepository) Delete(id string) bool {
+func (r *UserRepository) Delete(id string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, found := r.users[id]; !found {
-		return false
+		return ErrUserNotFound
 	}
 	delete(r.users, id)
-	return true
+	return nil
 }
 
 // --- Service/Handler Layer ---
@@ -156,16 +210,16 @@ func (s *UserApiServer) handleCreateUser(w http.ResponseWriter, r *http.Request)
 
 	createdUser, err := s.repo.Create(newUser)
 	if err != nil {
-		s.writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		s.writeError(w, err)
 		return
 	}
 	s.writeJSON(w, http.StatusCreated, createdUser)
 }
 
 func (s *UserApiServer) handleGetUser(w http.ResponseWriter, r *http.Request, id string) {
-	user, found := s.repo.FindByID(id)
-	if !found {
-		s.writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+	user, err := s.repo.FindByID(id)
+	if err != nil {
+		s.writeError(w, err)
 		return
 	}
 	s.writeJSON(w, http.StatusOK, user)
@@ -215,9 +269,9 @@ func (s *UserApiServer) handleListUsers(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *UserApiServer) handleUpdateUser(w http.ResponseWriter, r *http.Request, id string) {
-	existingUser, found := s.repo.FindByID(id)
-	if !found {
-		s.writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+	existingUser, err := s.repo.FindByID(id)
+	if err != nil {
+		s.writeError(w, err)
 		return
 	}
 
@@ -235,18 +289,41 @@ func (s *UserApiServer) handleUpdateUser(w http.ResponseWriter, r *http.Request,
 	if payload.Role != nil { existingUser.Role = *payload.Role }
 	if payload.IsActive != nil { existingUser.IsActive = *payload.IsActive }
 
-	updatedUser, _ := s.repo.Update(id, existingUser)
+	updatedUser, err := s.repo.Update(id, existingUser)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
 	s.writeJSON(w, http.StatusOK, updatedUser)
 }
 
 func (s *UserApiServer) handleDeleteUser(w http.ResponseWriter, r *http.Request, id string) {
-	if !s.repo.Delete(id) {
-		s.writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+	if err := s.repo.Delete(id); err != nil {
+		s.writeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// writeError sends a repository error with the status for its kind. Errors
+// without a kind are logged and hidden behind a generic message.
+func (s *UserApiServer) writeError(w http.ResponseWriter, err error) {
+	var de *DomainError
+	if !errors.As(err, &de) || de.Kind == KindInternal {
+		log.Printf("Internal error: %v", err)
+		s.writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+		return
+	}
+	body := map[string]string{"error": de.Message, "kind": de.Kind.String()}
+	if de.Resource != "" {
+		body["resource"] = de.Resource
+	}
+	if de.Field != "" {
+		body["field"] = de.Field
+	}
+	s.writeJSON(w, statusByKind[de.Kind], body)
+}
+
 func (s *UserApiServer) writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/labstack/echo/v4"
 )
 
 // --- Domain Model ---
@@ -68,89 +75,90 @@ func (db *UserDataStore) Remove(id string) {
 	delete(db.users, id)
 }
 
-// --- Resource/Controller Layer ---
-type UserResource struct {
-	db *UserDataStore
+// --- Handler Core ---
+// The core knows nothing about HTTP frameworks: it takes request DTOs and
+// returns a Result or a *CoreError. Features are written here once and the
+// adapters below expose them on net/http, Gin, Echo and Fiber.
+
+// Result is a successful outcome. A nil Body renders as an empty response.
+type Result struct {
+	Status int
+	Body   interface{}
 }
 
-func NewUserResource(db *UserDataStore) *UserResource {
-	return &UserResource{db: db}
+// CoreError is a failure the client should see. Any other error is treated
+// as internal and its message is not exposed.
+type CoreError struct {
+	Status  int
+	Message string
 }
 
-// Handles /users
-func (ur *UserResource) handleCollection(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		ur.listUsers(w, r)
-	case http.MethodPost:
-		ur.createUser(w, r)
-	default:
-		ur.jsonError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-	}
+func (e *CoreError) Error() string { return e.Message }
+
+func errBadRequest(msg string) error { return &CoreError{Status: http.StatusBadRequest, Message: msg} }
+func errNotFound(msg string) error   { return &CoreError{Status: http.StatusNotFound, Message: msg} }
+
+type CreateUserRequest struct {
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Role     UserRole `json:"role"`
 }
 
-// Handles /users/{id}
-func (ur *UserResource) handleItem(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/users/")
-	if id == "" {
-		ur.jsonError(w, "Not Found", http.StatusNotFound)
-		return
-	}
+// UpdateUserRequest uses pointers so that omitted fields are left unchanged.
+type UpdateUserRequest struct {
+	Email    *string   `json:"email"`
+	Role     *UserRole `json:"role"`
+	IsActive *bool     `json:"is_active"`
+}
 
-	switch r.Method {
-	case http.MethodGet:
-		ur.getUser(w, r, id)
-	case http.MethodPut, http.MethodPatch:
-		ur.updateUser(w, r, id)
-	case http.MethodDelete:
-		ur.deleteUser(w, r, id)
-	default:
-		ur.jsonError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-	}
+type ListUsersRequest struct {
+	Role     string
+	IsActive *bool
+	Page     int
+	Limit    int
 }
 
-func (ur *UserResource) createUser(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Email    string   `json:"email"`
-		Password string   `json:"password"`
-		Role     UserRole `json:"role"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		ur.jsonError(w, "Bad request body", http.StatusBadRequest)
-		return
+type UserCore struct {
+	db *UserDataStore
+}
+
+func NewUserCore(db *UserDataStore) *UserCore {
+	return &UserCore{db: db}
+}
+
+func (uc *UserCore) CreateUser(ctx context.Context, req CreateUserRequest) (Result, error) {
+	if strings.TrimSpace(req.Email) == "" {
+		return Result{}, errBadRequest("email is required")
 	}
-	if body.Role == "" {
-		body.Role = ROLE_USER
+	if req.Role == "" {
+		req.Role = ROLE_USER
 	}
 
-	id, _ := generateUUID()
+	id, err := generateUUID()
+	if err != nil {
+		return Result{}, err
+	}
 	user := &User{
 		Id:        id,
-		Email:     body.Email,
-		Password:  "hashed:" + body.Password, // Use bcrypt
-		Role:      body.Role,
+		Email:     req.Email,
+		Password:  "hashed:" + req.Password, // Use bcrypt
+		Role:      req.Role,
 		IsActive:  true,
 		CreatedAt: time.Now().UTC(),
 	}
-	ur.db.Add(user)
-	ur.writeJSON(w, http.StatusCreated, user)
+	uc.db.Add(user)
+	return Result{Status: http.StatusCreated, Body: user}, nil
 }
 
-func (ur *UserResource) listUsers(w http.ResponseWriter, r *http.Request) {
-	allUsers := ur.db.GetAll()
-	
+func (uc *UserCore) ListUsers(ctx context.Context, req ListUsersRequest) (Result, error) {
 	// Filtering
-	q := r.URL.Query()
-	var result []*User
-	for _, u := range allUsers {
-		if role := q.Get("role"); role != "" && string(u.Role) != role {
+	result := []*User{}
+	for _, u := range uc.db.GetAll() {
+		if req.Role != "" && string(u.Role) != req.Role {
 			continue
 		}
-		if active := q.Get("is_active"); active != "" {
-			isActive, _ := strconv.ParseBool(active)
-			if u.IsActive != isActive {
-				continue
-			}
+		if req.IsActive != nil && u.IsActive != *req.IsActive {
+			continue
 		}
 		result = append(result, u)
 	}
@@ -159,73 +167,224 @@ func (ur *UserResource) listUsers(w http.ResponseWriter, r *http.Request) {
 	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
 
 	// Pagination
-	page, _ := strconv.Atoi(q.Get("page"))
-	if page < 1 { page = 1 }
-	limit, _ := strconv.Atoi(q.Get("limit"))
-	if limit <= 0 { limit = 10 }
-	start := (page - 1) * limit
+	if req.Page < 1 { req.Page = 1 }
+	if req.Limit <= 0 { req.Limit = 10 }
+	start := (req.Page - 1) * req.Limit
 	if start >= len(result) {
-		ur.writeJSON(w, http.StatusOK, []*User{})
-		return
+		return Result{Status: http.StatusOK, Body: []*User{}}, nil
 	}
-	end := start + limit
+	end := start + req.Limit
 	if end > len(result) {
 		end = len(result)
 	}
-	ur.writeJSON(w, http.StatusOK, result[start:end])
+	return Result{Status: http.StatusOK, Body: result[start:end]}, nil
 }
 
-func (ur *UserResource) getUser(w http.ResponseWriter, r *http.Request, id string) {
-	user, ok := ur.db.Get(id)
+func (uc *UserCore) GetUser(ctx context.Context, id string) (Result, error) {
+	user, ok := uc.db.Get(id)
 	if !ok {
-		ur.jsonError(w, "User not found", http.StatusNotFound)
-		return
+		return Result{}, errNotFound("User not found")
 	}
-	ur.writeJSON(w, http.StatusOK, user)
+	return Result{Status: http.StatusOK, Body: user}, nil
 }
 
-func (ur *UserResource) updateUser(w http.ResponseWriter, r *http.Request, id string) {
-	user, ok := ur.db.Get(id)
+func (uc *UserCore) UpdateUser(ctx context.Context, id string, req UpdateUserRequest) (Result, error) {
+	existing, ok := uc.db.Get(id)
 	if !ok {
-		ur.jsonError(w, "User not found", http.StatusNotFound)
-		return
+		return Result{}, errNotFound("User not found")
+	}
+
+	user := *existing
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+	if req.IsActive != nil {
+		user.IsActive = *req.IsActive
 	}
 
-	var body map[string]interface{}
-	json.NewDecoder(r.Body).Decode(&body)
+	uc.db.Add(&user) // Add acts as an upsert
+	return Result{Status: http.StatusOK, Body: &user}, nil
+}
 
-	if email, ok := body["email"].(string); ok {
-		user.Email = email
+func (uc *UserCore) DeleteUser(ctx context.Context, id string) (Result, error) {
+	if _, ok := uc.db.Get(id); !ok {
+		return Result{}, errNotFound("User not found")
 	}
-	if role, ok := body["role"].(string); ok {
-		user.Role = UserRole(role)
+	uc.db.Remove(id)
+	return Result{Status: http.StatusNoContent}, nil
+}
+
+// --- Routing Table ---
+
+// Input is what an adapter exposes of the incoming request. Path parameters
+// are declared as ":name" in route paths.
+type Input interface {
+	Context() context.Context
+	Param(name string) string
+	Query(name string) string
+	Bind(v interface{}) error
+}
+
+type Endpoint struct {
+	Method string
+	Path   string
+	Handle func(in Input) (Result, error)
+}
+
+// Routes is the single list of endpoints that every adapter mounts.
+func Routes(uc *UserCore) []Endpoint {
+	return []Endpoint{
+		{http.MethodGet, "/users", func(in Input) (Result, error) {
+			req := ListUsersRequest{Role: in.Query("role")}
+			req.Page, _ = strconv.Atoi(in.Query("page"))
+			req.Limit, _ = strconv.Atoi(in.Query("limit"))
+			if active := in.Query("is_active"); active != "" {
+				isActive, err := strconv.ParseBool(active)
+				if err != nil {
+					return Result{}, errBadRequest("is_active must be a boolean")
+				}
+				req.IsActive = &isActive
+			}
+			return uc.ListUsers(in.Context(), req)
+		}},
+		{http.MethodPost, "/users", func(in Input) (Result, error) {
+			var req CreateUserRequest
+			if err := in.Bind(&req); err != nil {
+				return Result{}, errBadRequest("Bad request body")
+			}
+			return uc.CreateUser(in.Context(), req)
+		}},
+		{http.MethodGet, "/users/:id", func(in Input) (Result, error) {
+			return uc.GetUser(in.Context(), in.Param("id"))
+		}},
+		{http.MethodPut, "/users/:id", updateEndpoint(uc)},
+		{http.MethodPatch, "/users/:id", updateEndpoint(uc)},
+		{http.MethodDelete, "/users/:id", func(in Input) (Result, error) {
+			return uc.DeleteUser(in.Context(), in.Param("id"))
+		}},
 	}
-	if isActive, ok := body["is_active"].(bool); ok {
-		user.IsActive = isActive
+}
+
+func updateEndpoint(uc *UserCore) func(in Input) (Result, error) {
+	return func(in Input) (Result, error) {
+		var req UpdateUserRequest
+		if err := in.Bind(&req); err != nil {
+			return Result{}, errBadRequest("Bad request body")
+		}
+		return uc.UpdateUser(in.Context(), in.Param("id"), req)
 	}
-	
-	ur.db.Add(user) // Add acts as an upsert
-	ur.writeJSON(w, http.StatusOK, user)
 }
 
-func (ur *UserResource) deleteUser(w http.ResponseWriter, r *http.Request, id string) {
-	if _, ok := ur.db.Get(id); !ok {
-		ur.jsonError(w, "User not found", http.StatusNotFound)
-		return
+// outcome maps a core return value to the status and JSON body to send.
+// A nil body means no content.
+func outcome(res Result, err error) (int, interface{}) {
+	if err == nil {
+		return res.Status, res.Body
+	}
+	var ce *CoreError
+	if errors.As(err, &ce) {
+		return ce.Status, map[string]string{"error": ce.Message}
 	}
-	ur.db.Remove(id)
-	w.WriteHeader(http.StatusNoContent)
+	log.Printf("internal error: %v", err)
+	return http.StatusInternalServerError, map[string]string{"error": http.StatusText(http.StatusInternalServerError)}
 }
 
-// --- JSON Helpers ---
-func (ur *UserResource) jsonError(w http.ResponseWriter, message string, code int) {
-	ur.writeJSON(w, code, map[string]string{"error": message})
+// --- net/http Adapter ---
+type httpInput struct{ r *http.Request }
+
+func (in httpInput) Context() context.Context { return in.r.Context() }
+func (in httpInput) Param(name string) string { return in.r.PathValue(name) }
+func (in httpInput) Query(name string) string { return in.r.URL.Query().Get(name) }
+func (in httpInput) Bind(v interface{}) error { return json.NewDecoder(in.r.Body).Decode(v) }
+
+func mountHTTP(mux *http.ServeMux, endpoints []Endpoint) {
+	for _, ep := range endpoints {
+		ep := ep
+		// ServeMux spells ":id" as "{id}".
+		segments := strings.Split(ep.Path, "/")
+		for i, s := range segments {
+			if strings.HasPrefix(s, ":") {
+				segments[i] = "{" + s[1:] + "}"
+			}
+		}
+		mux.HandleFunc(ep.Method+" "+strings.Join(segments, "/"), func(w http.ResponseWriter, r *http.Request) {
+			code, body := outcome(ep.Handle(httpInput{r}))
+			if body == nil {
+				w.WriteHeader(code)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(body)
+		})
+	}
 }
 
-func (ur *UserResource) writeJSON(w http.ResponseWriter, code int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(data)
+// --- Gin Adapter ---
+type ginInput struct{ c *gin.Context }
+
+func (in ginInput) Context() context.Context { return in.c.Request.Context() }
+func (in ginInput) Param(name string) string { return in.c.Param(name) }
+func (in ginInput) Query(name string) string { return in.c.Query(name) }
+func (in ginInput) Bind(v interface{}) error { return in.c.ShouldBindJSON(v) }
+
+func mountGin(r gin.IRoutes, endpoints []Endpoint) {
+	for _, ep := range endpoints {
+		ep := ep
+		r.Handle(ep.Method, ep.Path, func(c *gin.Context) {
+			code, body := outcome(ep.Handle(ginInput{c}))
+			if body == nil {
+				c.Status(code)
+				return
+			}
+			c.JSON(code, body)
+		})
+	}
+}
+
+// --- Echo Adapter ---
+type echoInput struct{ c echo.Context }
+
+func (in echoInput) Context() context.Context { return in.c.Request().Context() }
+func (in echoInput) Param(name string) string { return in.c.Param(name) }
+func (in echoInput) Query(name string) string { return in.c.QueryParam(name) }
+func (in echoInput) Bind(v interface{}) error { return in.c.Bind(v) }
+
+func mountEcho(e *echo.Echo, endpoints []Endpoint) {
+	for _, ep := range endpoints {
+		ep := ep
+		e.Add(ep.Method, ep.Path, func(c echo.Context) error {
+			code, body := outcome(ep.Handle(echoInput{c}))
+			if body == nil {
+				return c.NoContent(code)
+			}
+			return c.JSON(code, body)
+		})
+	}
+}
+
+// --- Fiber Adapter ---
+type fiberInput struct{ c *fiber.Ctx }
+
+func (in fiberInput) Context() context.Context { return in.c.UserContext() }
+func (in fiberInput) Param(name string) string { return in.c.Params(name) }
+func (in fiberInput) Query(name string) string { return in.c.Query(name) }
+func (in fiberInput) Bind(v interface{}) error { return in.c.BodyParser(v) }
+
+func mountFiber(app *fiber.App, endpoints []Endpoint) {
+	for _, ep := range endpoints {
+		ep := ep
+		app.Add(ep.Method, ep.Path, func(c *fiber.Ctx) error {
+			code, body := outcome(ep.Handle(fiberInput{c}))
+			if body == nil {
+				return c.SendStatus(code)
+			}
+			return c.Status(code).JSON(body)
+		})
+	}
 }
 
 // --- Util ---
@@ -237,6 +396,8 @@ func generateUUID() (string, error) {
 }
 
 // --- Main ---
+// TRANSPORT selects the stack serving the shared routes: http (default),
+// gin, echo or fiber.
 func main() {
 	db := NewUserDataStore()
 	// Seed
@@ -245,13 +406,32 @@ func main() {
 	id2, _ := generateUUID()
 	db.Add(&User{Id: id2, Email: "user@example.com", Role: ROLE_USER, IsActive: false, CreatedAt: time.Now().UTC()})
 
-	resource := NewUserResource(db)
-	mux := http.NewServeMux()
-	mux.HandleFunc("/users", resource.handleCollection)
-	mux.HandleFunc("/users/", resource.handleItem)
+	endpoints := Routes(NewUserCore(db))
+	transport := os.Getenv("TRANSPORT")
+	log.Printf("Starting RESTful resource server on :8080 (transport=%q)", transport)
 
-	log.Println("Starting RESTful resource server on :8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+	var err error
+	switch transport {
+	case "", "http":
+		mux := http.NewServeMux()
+		mountHTTP(mux, endpoints)
+		err = http.ListenAndServe(":8080", mux)
+	case "gin":
+		r := gin.Default()
+		mountGin(r, endpoints)
+		err = r.Run(":8080")
+	case "echo":
+		e := echo.New()
+		mountEcho(e, endpoints)
+		err = e.Start(":8080")
+	case "fiber":
+		app := fiber.New()
+		mountFiber(app, endpoints)
+		err = app.Listen(":8080")
+	default:
+		log.Fatalf("unknown TRANSPORT %q (want http, gin, echo or fiber)", transport)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
-}
\ No newline at end of file
+}